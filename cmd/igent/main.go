@@ -1,15 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 
 	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/backup"
+	"github.com/igm/igent/internal/batch"
+	"github.com/igm/igent/internal/bundle"
 	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/daemon"
+	"github.com/igm/igent/internal/llm"
 	"github.com/igm/igent/internal/logger"
+	"github.com/igm/igent/internal/memory"
+	"github.com/igm/igent/internal/notebook"
+	"github.com/igm/igent/internal/remotesync"
+	"github.com/igm/igent/internal/render"
+	"github.com/igm/igent/internal/sched"
+	"github.com/igm/igent/internal/server"
+	"github.com/igm/igent/internal/skills"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+	"github.com/igm/igent/internal/tracing"
+	"github.com/igm/igent/internal/transcript"
+	"github.com/igm/igent/internal/tui"
 )
 
 var (
@@ -18,12 +49,29 @@ var (
 	streaming   bool
 	showVersion bool
 	verbose     bool
+	teeFile     string
+	teeTools    bool
+	recordFile  string
+	accessible  bool
+	toolsFlag   []string
+	noTools     bool
+	assumeYes   bool
+	planFirst   bool
+	profileName string
+	orchestrate bool
+	noDaemon    bool
+	systemFile  string
+	showStats   bool
+	plain       bool
+	quiet       bool
 
 	version = "dev"
 )
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	stopTracing()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -35,22 +83,105 @@ var rootCmd = &cobra.Command{
 	Long: `igent is an AI agent that maintains conversation history and memory
 across sessions. It uses context optimization to keep conversations
 relevant while staying within token limits.`,
-	Args: cobra.ArbitraryArgs,
-	RunE: runAgent,
+	Args:             cobra.ArbitraryArgs,
+	PersistentPreRun: setup,
+	RunE:             runAgent,
+}
+
+// notices is where igent reports what it did besides answering, such as
+// where a partial answer was saved: stderr, or nowhere with --quiet. Errors
+// and questions that need an answer always go to stderr.
+var notices io.Writer = os.Stderr
+
+// setup runs before every command: --quiet silences logs and notices, then
+// tracing starts
+func setup(cmd *cobra.Command, args []string) {
+	if quiet {
+		notices = io.Discard
+		logger.Init(logger.DefaultConfig(), io.Discard)
+	}
+	// A config that does not load is left for the command to report
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return
+	}
+	// The theme is resolved once, before any agent prints with it
+	if err := agent.UseTheme(cfg.UI); err != nil {
+		fmt.Fprintf(notices, "Warning: %v; using the default theme\n", err)
+	}
+	startTracing(cfg)
+}
+
+// stopTracing exports the spans left when igent exits; set by startTracing
+var stopTracing = func() {}
+
+// startTracing sets up tracing from the config before every command
+func startTracing(cfg *config.Config) {
+	if cfg.Tracing.Exporter == "" {
+		return
+	}
+	netPolicy, err := agent.NewNetworkPolicy(cfg.Network)
+	if err != nil {
+		return
+	}
+	shutdown, err := tracing.Setup(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Headers:     cfg.Tracing.Headers,
+		File:        cfg.Tracing.File,
+		ServiceName: cfg.Tracing.ServiceName,
+		Version:     version,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Transport:   netPolicy.Transport("tracing", http.DefaultTransport.(*http.Transport).Clone()),
+	})
+	if err != nil {
+		fmt.Fprintf(notices, "Warning: tracing disabled: %v\n", err)
+		return
+	}
+	stopTracing = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			fmt.Fprintf(notices, "Warning: exporting traces: %v\n", err)
+		}
+	}
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is ~/.igent/config.yaml)")
-	rootCmd.PersistentFlags().StringVarP(&convID, "conversation", "C", "default", "conversation ID")
+	rootCmd.PersistentFlags().StringVarP(&convID, "conversation", "C", "default", "conversation ID (default: <repo>/default inside a git repository)")
 	rootCmd.PersistentFlags().BoolVarP(&streaming, "stream", "s", true, "stream response")
 	rootCmd.PersistentFlags().BoolVarP(&showVersion, "version", "v", false, "show version")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "V", false, "enable verbose (debug) logging")
+	rootCmd.PersistentFlags().StringVar(&teeFile, "tee", "", "also append the streamed response to this file as it arrives")
+	rootCmd.PersistentFlags().BoolVar(&teeTools, "tee-tools", false, "include tool calls and results in the --tee file")
+	rootCmd.PersistentFlags().StringVar(&recordFile, "record", "", "record the session (prompts, answers, tool calls, timings) to this transcript file for igent replay")
+	rootCmd.PersistentFlags().StringSliceVar(&toolsFlag, "tools", nil, "only offer these tools to the model (names or patterns such as git_*), overriding tools.enabled/disabled")
+	rootCmd.PersistentFlags().BoolVar(&noTools, "no-tools", false, "offer no tools to the model")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "run as this agent profile (profiles in the config): its prompt, model and tools")
+	rootCmd.PersistentFlags().BoolVar(&showStats, "stats", false, "print the model, token usage, tool calls and duration of the answer to stderr")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "print only the answer on stdout: no logs, warnings or notices on stderr (errors and questions still show)")
+	rootCmd.PersistentFlags().BoolVar(&plain, "plain", false, "print answers as written instead of rendering their markdown (agent.markdown)")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "yes", false, "run tools that need confirmation without asking (tools.confirm deny rules still apply)")
+	rootCmd.Flags().BoolVar(&accessible, "accessible", false, "screen reader friendly REPL: plain text, tool activity announced in sentences")
+	rootCmd.Flags().BoolVar(&planFirst, "plan", false, "plan the task first and carry it out step by step after approval (in the REPL: every message)")
+	rootCmd.Flags().StringVar(&systemFile, "system-file", "", "set the conversation's system prompt from this file (replaces agent.system_prompt in it)")
+	rootCmd.Flags().BoolVar(&noDaemon, "no-daemon", false, "answer here even if igent daemon is running")
+	rootCmd.Flags().BoolVar(&orchestrate, "orchestrate", false, "have the agent profiles handle the request, delegated by a coordinator (in the REPL: every message)")
 
 	// Subcommands
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(exportCmd)
 	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(titleCmd)
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(renameCmd)
+	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(compactCmd)
 	rootCmd.AddCommand(memoryCmd)
 	rootCmd.AddCommand(skillCmd)
+	rootCmd.AddCommand(artifactsCmd)
 }
 
 func runAgent(cmd *cobra.Command, args []string) error {
@@ -82,21 +213,80 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		"work_dir", cfg.Storage.WorkDir,
 	)
 
+	if accessible {
+		cfg.Agent.Accessible = true
+	}
+	if err := applyAgentFlags(cfg); err != nil {
+		return err
+	}
+
+	// Piped stdin is context for a one-shot prompt:
+	// cat error.log | igent "what's wrong here?"
+	var stdin []byte
+	if len(args) > 0 && stdinIsPiped() {
+		if stdin, err = readStdin(agent.AttachInputLimit(cfg)); err != nil {
+			return err
+		}
+	}
+
+	// One-shot prompts go to igent daemon when it runs, which expands @path
+	// references in this directory; it takes no piped input, so prompts
+	// with it are answered here
+	if len(args) > 0 && len(stdin) == 0 && useDaemon() {
+		err := chatWithDaemon(cfg, resolveConversation(cmd, cfg), strings.Join(args, " "))
+		if !errors.Is(err, daemon.ErrNotRunning) {
+			return err
+		}
+		log.Debug("daemon not running, answering here")
+	}
+
+	if path, err := backup.Rotate(cfg.Storage.WorkDir, cfg.Storage.BackupKeep, time.Now()); err != nil {
+		log.Warn("daily backup failed", "error", err)
+	} else if path != "" {
+		log.Info("daily backup created", "path", path)
+	}
+
 	// Create agent
 	ag, err := agent.New(cfg)
 	if err != nil {
 		return fmt.Errorf("creating agent: %w", err)
 	}
 
+	setupConsole(ag, cfg)
+	defer ag.Close()
+
 	// Set conversation
+	convID = resolveConversation(cmd, cfg)
 	if err := ag.SetConversation(convID); err != nil {
 		return fmt.Errorf("setting conversation: %w", err)
 	}
+	if systemFile != "" {
+		data, err := os.ReadFile(systemFile)
+		if err != nil {
+			return fmt.Errorf("reading system prompt: %w", err)
+		}
+		if err := ag.SetSystemPrompt(string(data)); err != nil {
+			return err
+		}
+	}
+
+	closeTee, err := setupTee(ag)
+	if err != nil {
+		return err
+	}
+	defer closeTee()
+	stopRecording, err := setupRecorder(ag)
+	if err != nil {
+		return err
+	}
+	defer stopRecording()
 
 	ctx := context.Background()
 
 	// Interactive mode if no prompt provided
 	if len(args) == 0 {
+		ag.SetPlanMode(planFirst)
+		ag.SetOrchestrateMode(orchestrate)
 		return ag.Interactive(ctx)
 	}
 
@@ -113,22 +303,57 @@ func runAgent(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	prompt, err = ag.ExpandAttachments(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	prompt, err = ag.AttachInput(ctx, prompt, "standard input", stdin)
+	if err != nil {
+		return err
+	}
+
 	log.Debug("single message mode", "streaming", streaming)
 
+	if orchestrate {
+		_, err := ag.OrchestrateConsole(ctx, prompt, printChunk)
+		fmt.Println()
+		return err
+	}
+
+	if planFirst {
+		result, err := ag.RunPlan(ctx, prompt, agent.ConsolePlanOptions(printChunk, func() {}))
+		fmt.Println()
+		if result != nil {
+			fmt.Fprintln(notices, agent.FormatPlanResult(result))
+		}
+		return err
+	}
+
+	md := ag.AnswerRenderer()
 	if streaming {
-		_, err = ag.ChatStream(ctx, prompt, func(chunk string) {
-			fmt.Print(chunk)
-		})
+		result, err := ag.ChatStream(ctx, prompt, md.Write)
+		md.Flush()
 		fmt.Println()
-	} else {
-		response, err := ag.Chat(ctx, prompt)
+		var partial *agent.PartialResponseError
+		if errors.As(err, &partial) {
+			fmt.Fprintf(notices, "Partial answer saved; resume it with /continue in: igent -C %s\n", convID)
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Println(response)
+		printStats(result)
+		return nil
 	}
 
-	return err
+	result, err := ag.Chat(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	md.Write(result.Content)
+	md.Flush()
+	fmt.Println()
+	printStats(result)
+	return nil
 }
 
 // configCmd handles configuration
@@ -153,31 +378,27 @@ var configInitCmd = &cobra.Command{
 			fmt.Scanln(&cfg.Provider.APIKey)
 		}
 
-		fmt.Print("Provider (openai/zhipu/glm) [openai]: ")
+		fmt.Print("Provider (openai/zhipu/glm/deepseek/moonshot) [openai]: ")
 		var provider string
 		fmt.Scanln(&provider)
 		if provider != "" {
 			cfg.Provider.Type = provider
 		}
 
-		fmt.Print("Model [gpt-4o-mini]: ")
+		// Set provider defaults based on type
+		preset, ok := llm.LookupPreset(cfg.Provider.Type)
+		if ok {
+			cfg.Provider.BaseURL = preset.BaseURL
+			cfg.Provider.Model = preset.DefaultModel
+		}
+
+		fmt.Printf("Model [%s]: ", cfg.Provider.Model)
 		var model string
 		fmt.Scanln(&model)
 		if model != "" {
 			cfg.Provider.Model = model
 		}
 
-		// Set provider defaults based on type
-		switch cfg.Provider.Type {
-		case "zhipu", "glm":
-			if cfg.Provider.BaseURL == "" {
-				cfg.Provider.BaseURL = "https://open.bigmodel.cn/api/paas/v4"
-			}
-			if model == "" {
-				cfg.Provider.Model = "glm-4-flash"
-			}
-		}
-
 		if err := cfg.Save(); err != nil {
 			return fmt.Errorf("saving config: %w", err)
 		}
@@ -199,6 +420,15 @@ var configShowCmd = &cobra.Command{
 		fmt.Printf("Provider: %s\n", cfg.Provider.Type)
 		fmt.Printf("Base URL: %s\n", cfg.Provider.BaseURL)
 		fmt.Printf("Model: %s\n", cfg.Provider.Model)
+		if cfg.Provider.Proxy != "" {
+			fmt.Printf("Proxy: %s\n", cfg.Provider.Proxy)
+		}
+		if cfg.Provider.CACertFile != "" {
+			fmt.Printf("CA Cert File: %s\n", cfg.Provider.CACertFile)
+		}
+		if cfg.Provider.InsecureSkipVerify {
+			fmt.Println("TLS Verify: disabled")
+		}
 		fmt.Printf("Work Dir: %s\n", cfg.Storage.WorkDir)
 		fmt.Printf("Max Messages: %d\n", cfg.Context.MaxMessages)
 		fmt.Printf("Max Tokens: %d\n", cfg.Context.MaxTokens)
@@ -208,149 +438,304 @@ var configShowCmd = &cobra.Command{
 	},
 }
 
-func init() {
-	configCmd.AddCommand(configInitCmd)
-	configCmd.AddCommand(configShowCmd)
-}
-
-// listCmd lists conversations
-var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List conversations",
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Show a setting, e.g. context.max_tokens, or a section such as provider",
+	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
 		}
-
-		ag, err := agent.New(cfg)
+		value, err := cfg.Get(args[0])
 		if err != nil {
 			return err
 		}
+		fmt.Println(value)
+		return nil
+	},
+}
 
-		convs, err := ag.ListConversations()
-		if err != nil {
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a setting in the config file, e.g. provider.model gpt-4o",
+	Long: `Set a setting in the config file, keeping the others. The value is
+checked against the setting's type: true/false, a number, or a
+comma-separated list such as tools.disabled "shell,ssh". Entries of maps
+are set by name, e.g. tools.confirm.git_commit allow.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.FilePath(cfgFile)
+		if err := config.SetKey(path, args[0], args[1]); err != nil {
 			return err
 		}
+		fmt.Printf("Set %s in %s\n", args[0], path)
+		return nil
+	},
+}
 
-		if len(convs) == 0 {
-			fmt.Println("No conversations found")
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Remove a setting from the config file, restoring its default",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := config.FilePath(cfgFile)
+		removed, err := config.UnsetKey(path, args[0])
+		if err != nil {
+			return err
+		}
+		if !removed {
+			fmt.Printf("%s is not set in %s\n", args[0], path)
 			return nil
 		}
+		fmt.Printf("Unset %s in %s\n", args[0], path)
+		return nil
+	},
+}
 
-		fmt.Println("Conversations:")
-		for _, c := range convs {
-			fmt.Printf("  %s\n", c)
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration: unknown keys, values, context limits and the API key",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		if err := cfg.ValidateProvider(); err != nil {
+			return err
 		}
+		fmt.Printf("Configuration is valid: %s\n", config.FilePath(cfgFile))
 		return nil
 	},
 }
 
-// memoryCmd manages memories
-var memoryCmd = &cobra.Command{
-	Use:   "memory",
-	Short: "Manage agent memory",
+func init() {
+	configCmd.AddCommand(configInitCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
 }
 
-var memoryListCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List all memories",
+var fromBundle string
+
+// initCmd sets up igent from a team-shared bundle
+var initCmd = &cobra.Command{
+	Use:   "init --from-bundle <url|path>",
+	Short: "Install a team bundle of skills, prompts, tool policy and memories",
+	Long: `Install an organization's curated setup in one step. A bundle is a
+directory, .zip archive, or manifest URL containing igent-bundle.yaml with
+skills, system prompt files, a tools policy, and starter memories.
+Installing a bundle again updates it in place.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if fromBundle == "" {
+			return errors.New("--from-bundle is required; use 'igent config init' for an interactive setup")
+		}
+
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
 		}
 
-		ag, err := agent.New(cfg)
+		policy, err := agent.NewNetworkPolicy(cfg.Network)
 		if err != nil {
 			return err
 		}
+		client := &http.Client{Transport: policy.Transport("bundle", http.DefaultTransport.(*http.Transport).Clone())}
 
-		memories, err := ag.ListMemories()
+		b, err := bundle.Load(cmd.Context(), fromBundle, client)
 		if err != nil {
 			return err
 		}
-
-		if len(memories) == 0 {
-			fmt.Println("No memories found")
-			return nil
+		store, err := storage.NewJSONStore(cfg.Storage.WorkDir)
+		if err != nil {
+			return err
+		}
+		store.SetIntegrityKey(cfg.Storage.IntegrityKey)
+		result, err := b.Install(cfg, store)
+		if err != nil {
+			return fmt.Errorf("installing bundle %s: %w", b.Name, err)
+		}
+		// Only what the bundle changed is written: a whole Save would put
+		// API keys from the environment in the file
+		var keys []string
+		if len(result.Prompts) > 0 {
+			keys = append(keys, "agent.system_prompt_files")
+		}
+		if result.ToolsPolicy {
+			keys = append(keys, "tools")
+		}
+		path := config.FilePath(cfgFile)
+		if len(keys) > 0 {
+			if err := cfg.SaveKeys(path, keys...); err != nil {
+				return fmt.Errorf("saving config: %w", err)
+			}
 		}
 
-		fmt.Println("Memories:")
-		for _, m := range memories {
-			fmt.Printf("  [%s] %s (relevance: %.2f)\n", m.Type, m.Content, m.Relevance)
+		name := b.Name
+		if b.Version != "" {
+			name += " " + b.Version
+		}
+		fmt.Printf("Installed bundle %s:\n", name)
+		fmt.Printf("  Skills: %d\n", result.Skills)
+		fmt.Printf("  Prompt files: %d\n", len(result.Prompts))
+		fmt.Printf("  New memories: %d\n", result.Memories)
+		if result.ToolsPolicy {
+			fmt.Println("  Tools policy: applied")
+		}
+		if len(keys) > 0 {
+			fmt.Printf("Configuration saved to: %s\n", path)
 		}
 		return nil
 	},
 }
 
-var memoryAddCmd = &cobra.Command{
-	Use:   "add <type> <content>",
-	Short: "Add a memory",
-	Args:  cobra.MinimumNArgs(2),
+func init() {
+	initCmd.Flags().StringVar(&fromBundle, "from-bundle", "", "bundle directory, .zip archive, or URL")
+}
+
+var (
+	exportFormat string
+	exportOutput string
+)
+
+// exportCmd exports a conversation as a notebook
+var exportCmd = &cobra.Command{
+	Use:   "export [conversation]",
+	Short: "Export a conversation as a Jupyter notebook or literate markdown",
+	Long: `Export a conversation with its prompts, tool calls, outputs and code
+blocks as cells. Shell commands, run_code snippets and python/bash/javascript
+code blocks become code cells that can be rerun.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
 		}
 
-		ag, err := agent.New(cfg)
-		if err != nil {
-			return err
+		id := resolveConversation(cmd, cfg)
+		if len(args) == 1 {
+			id = args[0]
 		}
 
-		memType := args[0]
-		content := args[1]
-		if len(args) > 2 {
-			for i := 2; i < len(args); i++ {
-				content += " " + args[i]
+		format := exportFormat
+		if format == "" {
+			format = string(notebook.FormatMarkdown)
+			if ext := filepath.Ext(exportOutput); ext != "" {
+				format = ext
 			}
 		}
+		f, err := notebook.ParseFormat(format)
+		if err != nil {
+			return err
+		}
 
-		if err := ag.AddMemory(content, memType); err != nil {
+		store, err := storage.NewJSONStore(cfg.Storage.WorkDir)
+		if err != nil {
 			return err
 		}
+		store.SetIntegrityKey(cfg.Storage.IntegrityKey)
+		conv, err := store.LoadConversation(id)
+		if err != nil {
+			return fmt.Errorf("loading conversation %s: %w", id, err)
+		}
 
-		fmt.Println("Memory added successfully")
+		if exportOutput == "" {
+			return notebook.Export(os.Stdout, conv, f)
+		}
+		out, err := os.Create(exportOutput)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", exportOutput, err)
+		}
+		defer out.Close()
+		if err := notebook.Export(out, conv, f); err != nil {
+			return fmt.Errorf("writing %s: %w", exportOutput, err)
+		}
+		fmt.Fprintf(notices, "Exported %s to %s\n", id, exportOutput)
 		return nil
 	},
 }
 
-var memoryDeleteCmd = &cobra.Command{
-	Use:   "delete <id>",
-	Short: "Delete a memory",
-	Args:  cobra.ExactArgs(1),
+func init() {
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "", "ipynb or md (default: from the output file extension, else md)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "output file (default: stdout)")
+}
+
+var compactExtract bool
+
+// compactCmd summarizes a conversation's older messages on demand
+var compactCmd = &cobra.Command{
+	Use:   "compact [conversation]",
+	Short: "Summarize a conversation's older messages now",
+	Long: `Fold all but the most recent messages of a conversation into its summary
+without waiting for the automatic threshold (context.summarize_when), and
+report the tokens saved. --extract also saves facts from the summarized
+messages as memories.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
 		}
 
+		id := resolveConversation(cmd, cfg)
+		if len(args) == 1 {
+			id = args[0]
+		}
+
 		ag, err := agent.New(cfg)
 		if err != nil {
 			return err
 		}
+		convs, err := ag.ListConversations()
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(convs, id) {
+			return fmt.Errorf("conversation not found: %s", id)
+		}
+		if err := ag.SetConversation(id); err != nil {
+			return err
+		}
 
-		return ag.DeleteMemory(args[0])
+		result, err := ag.Compact(context.Background(), compactExtract)
+		if err != nil {
+			return err
+		}
+		fmt.Println(result)
+		return nil
 	},
 }
 
 func init() {
-	memoryCmd.AddCommand(memoryListCmd)
-	memoryCmd.AddCommand(memoryAddCmd)
-	memoryCmd.AddCommand(memoryDeleteCmd)
+	compactCmd.Flags().BoolVar(&compactExtract, "extract", false, "also extract memories from the summarized messages")
 }
 
-// skillCmd manages skills
-var skillCmd = &cobra.Command{
-	Use:   "skill",
-	Short: "Manage agent skills",
-}
+var (
+	listTags   []string
+	listSort   string
+	listLimit  int
+	listOffset int
+)
 
-var skillListCmd = &cobra.Command{
+// listCmd lists conversations
+var listCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all skills",
+	Short: "List conversations with their title, message count and last update",
+	Long: `List conversations, most recently updated first. --sort orders them by
+updated, created, id or messages instead; --limit and --offset page through them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		order, err := storage.ParseConversationSort(listSort)
+		if err != nil {
+			return err
+		}
+		if listLimit < 0 || listOffset < 0 {
+			return errors.New("--limit and --offset must not be negative")
+		}
+
 		cfg, err := config.Load(cfgFile)
 		if err != nil {
 			return err
@@ -361,24 +746,2490 @@ var skillListCmd = &cobra.Command{
 			return err
 		}
 
-		skills := ag.ListSkills()
-		if len(skills) == 0 {
-			fmt.Println("No skills found")
+		infos, total, err := ag.QueryConversations(storage.ConversationQuery{
+			Tags:   listTags,
+			Sort:   order,
+			Limit:  listLimit,
+			Offset: listOffset,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(infos) == 0 {
+			if total > 0 {
+				fmt.Printf("No conversations past %d (of %d)\n", listOffset, total)
+			} else {
+				fmt.Println("No conversations found")
+			}
 			return nil
 		}
 
-		fmt.Println("Skills:")
-		for _, s := range skills {
-			status := "disabled"
-			if s.Enabled {
-				status = "enabled"
+		fmt.Println("Conversations:")
+		for _, info := range infos {
+			fmt.Printf("  %s\n", agent.FormatConversationInfo(info))
+		}
+		if len(infos) < total {
+			fmt.Printf("Showing %d-%d of %d", listOffset+1, listOffset+len(infos), total)
+			if next := listOffset + len(infos); next < total {
+				fmt.Printf(" (--offset %d for more)", next)
 			}
-			fmt.Printf("  %s (%s): %s\n", s.Name, status, s.Description)
+			fmt.Println()
 		}
 		return nil
 	},
 }
 
 func init() {
-	skillCmd.AddCommand(skillListCmd)
+	listCmd.Flags().StringSliceVar(&listTags, "tag", nil, "only conversations with this tag (repeatable)")
+	listCmd.Flags().StringVar(&listSort, "sort", "updated", "order: updated, created, id or messages")
+	listCmd.Flags().IntVar(&listLimit, "limit", 0, "show at most this many conversations (0 = all)")
+	listCmd.Flags().IntVar(&listOffset, "offset", 0, "skip this many conversations")
+}
+
+// titleCmd sets a conversation's title
+var titleCmd = &cobra.Command{
+	Use:   "title <conversation> <title>",
+	Short: "Set the title of a conversation",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		if err := ag.SetTitle(args[0], strings.Join(args[1:], " ")); err != nil {
+			return fmt.Errorf("setting title of %s: %w", args[0], err)
+		}
+		fmt.Println("Title set")
+		return nil
+	},
+}
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <conversation> <new-id>",
+	Short: "Change the ID of a conversation",
+	Long: `Rename a conversation. Its working document moves along, and the memories
+scoped to it, runs, schedules and entities referring to it are updated.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		if err := ag.RenameConversation(args[0], args[1]); err != nil {
+			return fmt.Errorf("renaming %s: %w", args[0], err)
+		}
+		fmt.Printf("Renamed %s to %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <conversation> <new-id>",
+	Short: "Copy a conversation and its working document to a new ID",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		if err := ag.CloneConversation(args[0], args[1]); err != nil {
+			return fmt.Errorf("cloning %s: %w", args[0], err)
+		}
+		fmt.Printf("Cloned %s to %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var tagRemove bool
+
+// tagCmd adds or removes conversation tags
+var tagCmd = &cobra.Command{
+	Use:   "tag <conversation> [tag...]",
+	Short: "Show, add or remove (--remove) tags of a conversation",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		add, remove := args[1:], []string(nil)
+		if tagRemove {
+			add, remove = nil, args[1:]
+		}
+		tags, err := ag.TagConversation(args[0], add, remove)
+		if err != nil {
+			return fmt.Errorf("tagging %s: %w", args[0], err)
+		}
+		if len(tags) == 0 {
+			fmt.Println("No tags")
+		} else {
+			fmt.Printf("Tags: %s\n", strings.Join(tags, ", "))
+		}
+		return nil
+	},
+}
+
+func init() {
+	tagCmd.Flags().BoolVar(&tagRemove, "remove", false, "remove the given tags instead of adding them")
+}
+
+// memoryCmd manages memories
+var memoryCmd = &cobra.Command{
+	Use:   "memory",
+	Short: "Manage agent memory",
+}
+
+var memoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all memories",
+	Long: `List all memories, global and per conversation. With --conversation, list
+only the memories that conversation sees: the global ones and its own.
+--type and --tag narrow the list further; a memory needs every given tag.`,
+	Example: `  igent memory list --type preference --tag project-x`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		memories, err := ag.QueryMemories(storage.MemoryFilter{
+			Type:      memoryType,
+			Tags:      memoryTags,
+			VisibleIn: memoryScopeFlag(cmd),
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(memories) == 0 {
+			fmt.Println("No memories found")
+			return nil
+		}
+
+		fmt.Println("Memories:")
+		printMemories(memories)
+		return nil
+	},
+}
+
+var memorySearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search memories by content",
+	Long: `List the memories whose content contains the query, ignoring case, as the
+memory_search tool finds them for the model. --type, --tag and --conversation
+narrow the search as for 'igent memory list'.`,
+	Example: `  igent memory search friday
+  igent memory search "dark mode" --type preference`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		query := strings.Join(args, " ")
+		memories, err := ag.QueryMemories(storage.MemoryFilter{
+			Query:     query,
+			Type:      memoryType,
+			Tags:      memoryTags,
+			VisibleIn: memoryScopeFlag(cmd),
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(memories) == 0 {
+			fmt.Printf("No memories match %q\n", query)
+			return nil
+		}
+
+		fmt.Printf("Memories matching %q:\n", query)
+		printMemories(memories)
+		return nil
+	},
+}
+
+var (
+	memoryContent   string
+	memoryRelevance float64
+)
+
+var memoryUpdateCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Update a memory",
+	Long: `Change the content, type, relevance or tags of a memory, as the memory_update
+tool does for the model. Only the given flags are changed; --tag replaces all
+tags (--tag "" clears them). IDs are shown by 'igent memory list' and search.`,
+	Example: `  igent memory update mem_123 --content "Prefers dark mode" --relevance 0.9
+  igent memory update mem_123 --tag project-x --tag ui`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		updates := map[string]interface{}{}
+		if cmd.Flag("content").Changed {
+			if strings.TrimSpace(memoryContent) == "" {
+				return fmt.Errorf("--content cannot be empty; use 'igent memory delete' to remove a memory")
+			}
+			updates["content"] = memoryContent
+		}
+		if cmd.Flag("type").Changed {
+			if !memory.ValidType(memoryType) {
+				return fmt.Errorf("--type is %q, want fact, preference or context", memoryType)
+			}
+			updates["type"] = strings.ToLower(strings.TrimSpace(memoryType))
+		}
+		if cmd.Flag("relevance").Changed {
+			if memoryRelevance < 0 || memoryRelevance > 1 {
+				return fmt.Errorf("--relevance is %v, want a value from 0 to 1", memoryRelevance)
+			}
+			updates["relevance"] = memoryRelevance
+		}
+		if cmd.Flag("tag").Changed {
+			tags := []string{}
+			for _, tag := range memoryTags {
+				if tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+			updates["tags"] = tags
+		}
+		if len(updates) == 0 {
+			return fmt.Errorf("nothing to update: give --content, --type, --relevance or --tag")
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		m, err := ag.UpdateMemory(args[0], updates)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("memory %s not found", args[0])
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Memory updated:")
+		printMemories([]*storage.MemoryItem{m})
+		return nil
+	},
+}
+
+var memoryAddCmd = &cobra.Command{
+	Use:   "add <type> <content>",
+	Short: "Add a memory",
+	Long: `Add a global memory, used in every conversation. With --conversation, the
+memory belongs to that conversation only and is deleted with it.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		memType := args[0]
+		content := args[1]
+		if len(args) > 2 {
+			for i := 2; i < len(args); i++ {
+				content += " " + args[i]
+			}
+		}
+
+		if err := ag.AddMemory(content, memType, memoryScopeFlag(cmd), memoryTags...); err != nil {
+			return err
+		}
+
+		fmt.Println("Memory added successfully")
+		return nil
+	},
+}
+
+var memoryDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a memory",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		return ag.DeleteMemory(args[0])
+	},
+}
+
+var memoryExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export memories as JSON",
+	Long: `Export memories as JSON, to a file or stdout, to move them to another machine or
+seed another agent. --type, --tag and --conversation select what is exported.
+Embeddings are left out; they are recomputed where the memories are used.`,
+	Example: `  igent memory export memories.json
+  igent memory export --tag project-x > project-x.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		n, err := ag.ExportMemories(out, storage.MemoryFilter{
+			Type:      memoryType,
+			Tags:      memoryTags,
+			VisibleIn: memoryScopeFlag(cmd),
+		})
+		if err != nil {
+			return err
+		}
+		if out != os.Stdout {
+			fmt.Printf("Exported %d memories to %s\n", n, args[0])
+		}
+		return nil
+	},
+}
+
+var memoryImportStrategy string
+
+var memoryImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import memories from JSON",
+	Long: `Import memories written by 'igent memory export', or a JSON array of memories
+such as [{"type": "fact", "content": "...", "tags": ["x"]}] ("-" reads stdin).
+
+--strategy merge (default) keeps the stored memories and skips imported ones with
+the same content and scope; replace deletes all stored memories first. Imported
+memories whose ID is missing or already taken get a new one.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		strategy, err := memory.ParseImportStrategy(memoryImportStrategy)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		in := os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		if strategy == memory.ImportReplace && !assumeYes {
+			if in == os.Stdin {
+				return fmt.Errorf("replace reads the confirmation from stdin; pass --yes when importing from stdin")
+			}
+			existing, err := ag.ListMemories()
+			if err != nil {
+				return err
+			}
+			if len(existing) > 0 {
+				fmt.Printf("Replace deletes all %d stored memories. Continue? [y/N]: ", len(existing))
+				answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+				if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+					fmt.Println("Import cancelled")
+					return nil
+				}
+			}
+		}
+
+		result, err := ag.ImportMemories(in, strategy)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d memories", result.Added)
+		if result.Skipped > 0 {
+			fmt.Printf(", %d duplicates skipped", result.Skipped)
+		}
+		if result.Remapped > 0 {
+			fmt.Printf(", %d given new IDs", result.Remapped)
+		}
+		if result.Removed > 0 {
+			fmt.Printf(", %d replaced memories deleted", result.Removed)
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+var (
+	memoryType string
+	memoryTags []string
+)
+
+// printMemories lists memories one per line, with the IDs the update and
+// delete commands take
+func printMemories(memories []*storage.MemoryItem) {
+	for _, m := range memories {
+		fmt.Printf("  %s [%s] %s (relevance: %.2f", m.ID, m.Type, m.Content, m.Relevance)
+		if m.Scope != "" {
+			fmt.Printf(", conversation: %s", m.Scope)
+		}
+		if len(m.Tags) > 0 {
+			fmt.Printf(", tags: %s", strings.Join(m.Tags, ", "))
+		}
+		fmt.Println(")")
+	}
+}
+
+// memoryScopeFlag returns the conversation the memory commands are scoped
+// to: the --conversation flag when given, otherwise none (global)
+func memoryScopeFlag(cmd *cobra.Command) string {
+	if !cmd.Flag("conversation").Changed {
+		return ""
+	}
+	return convID
+}
+
+func init() {
+	memoryListCmd.Flags().StringVar(&memoryType, "type", "", "only list memories of this type (fact, preference, context)")
+	memoryListCmd.Flags().StringSliceVar(&memoryTags, "tag", nil, "only list memories with this tag (repeatable)")
+	memoryAddCmd.Flags().StringSliceVar(&memoryTags, "tag", nil, "tag the memory (repeatable)")
+	memorySearchCmd.Flags().StringVar(&memoryType, "type", "", "only search memories of this type")
+	memorySearchCmd.Flags().StringSliceVar(&memoryTags, "tag", nil, "only search memories with this tag (repeatable)")
+	memoryUpdateCmd.Flags().StringVar(&memoryContent, "content", "", "new content")
+	memoryUpdateCmd.Flags().StringVar(&memoryType, "type", "", "new type (fact, preference, context)")
+	memoryUpdateCmd.Flags().Float64Var(&memoryRelevance, "relevance", 0, "new relevance, from 0 to 1")
+	memoryUpdateCmd.Flags().StringSliceVar(&memoryTags, "tag", nil, "replace the tags (repeatable)")
+	memoryExportCmd.Flags().StringVar(&memoryType, "type", "", "only export memories of this type")
+	memoryExportCmd.Flags().StringSliceVar(&memoryTags, "tag", nil, "only export memories with this tag (repeatable)")
+	memoryImportCmd.Flags().StringVar(&memoryImportStrategy, "strategy", "merge", "merge or replace the stored memories")
+	memoryCmd.AddCommand(memoryListCmd)
+	memoryCmd.AddCommand(memoryAddCmd)
+	memoryCmd.AddCommand(memorySearchCmd)
+	memoryCmd.AddCommand(memoryUpdateCmd)
+	memoryCmd.AddCommand(memoryDeleteCmd)
+	memoryCmd.AddCommand(memoryExportCmd)
+	memoryCmd.AddCommand(memoryImportCmd)
+}
+
+// skillCmd manages skills
+var skillCmd = &cobra.Command{
+	Use:   "skill",
+	Short: "Manage agent skills",
+}
+
+var skillListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all skills",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		list, err := ag.AllSkills()
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			fmt.Println("No skills found")
+			return nil
+		}
+
+		fmt.Println("Skills:")
+		for _, s := range list {
+			status := "disabled"
+			if s.Enabled {
+				status = "enabled"
+			}
+			fmt.Printf("  %s: %s (%s): %s\n", s.ID, s.Name, status, s.Description)
+		}
+		return nil
+	},
+}
+
+var (
+	skillName        string
+	skillDescription string
+	skillPrompt      string
+	skillFile        string
+	skillTriggers    []string
+	skillDisabled    bool
+)
+
+var skillAddCmd = &cobra.Command{
+	Use:   "add [id]",
+	Short: "Create or replace a skill",
+	Long: `Create a skill, or replace the one with the same ID. The prompt comes from
+--prompt or --file; a .json file holds a whole skill in the stored format,
+which the other flags override. A skill is used when its name appears in the
+input or a --trigger regular expression matches it.`,
+	Example: `  igent skill add review --name Reviewer --file review.md --trigger '(?i)review'
+  igent skill add --file sql.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		skill := &storage.Skill{Enabled: true}
+		if skillFile != "" {
+			data, err := os.ReadFile(skillFile)
+			if err != nil {
+				return err
+			}
+			if filepath.Ext(skillFile) == ".json" {
+				if err := json.Unmarshal(data, skill); err != nil {
+					return fmt.Errorf("parsing %s: %w", skillFile, err)
+				}
+			} else {
+				skill.Prompt = string(data)
+			}
+		}
+		if len(args) > 0 {
+			skill.ID = args[0]
+		}
+		if cmd.Flags().Changed("name") {
+			skill.Name = skillName
+		}
+		if cmd.Flags().Changed("description") {
+			skill.Description = skillDescription
+		}
+		if cmd.Flags().Changed("prompt") {
+			skill.Prompt = skillPrompt
+		}
+		if skillDisabled {
+			skill.Enabled = false
+		}
+		for i, pattern := range skillTriggers {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("invalid trigger %q: %w", pattern, err)
+			}
+			if skill.Parameters == nil {
+				skill.Parameters = make(map[string]string)
+			}
+			skill.Parameters[fmt.Sprintf("%s%d", skills.TriggerPrefix, i+1)] = pattern
+		}
+		if skill.ID == "" {
+			return errors.New("no skill id: give one as argument or in the --file JSON")
+		}
+		if strings.TrimSpace(skill.Prompt) == "" {
+			return errors.New("the skill has no prompt: use --prompt or --file")
+		}
+		if skill.Name == "" {
+			skill.Name = skill.ID
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		if err := ag.RegisterSkill(skill); err != nil {
+			return err
+		}
+		fmt.Printf("Skill %s saved\n", skill.ID)
+		return nil
+	},
+}
+
+var skillShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a skill and its prompt",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		s, err := ag.FindSkill(args[0])
+		if err != nil {
+			return err
+		}
+
+		status := "disabled"
+		if s.Enabled {
+			status = "enabled"
+		}
+		fmt.Printf("ID: %s\n", s.ID)
+		fmt.Printf("Name: %s\n", s.Name)
+		fmt.Printf("Status: %s\n", status)
+		if s.Description != "" {
+			fmt.Printf("Description: %s\n", s.Description)
+		}
+		keys := make([]string, 0, len(s.Parameters))
+		for key := range s.Parameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("Parameter %s: %s\n", key, s.Parameters[key])
+		}
+		fmt.Printf("\n%s\n", strings.TrimSpace(s.Prompt))
+		return nil
+	},
+}
+
+// skillToggleCmd returns the command enabling or disabling skills
+func skillToggleCmd(enabled bool) *cobra.Command {
+	use, short := "disable <id>...", "Disable skills, keeping them stored"
+	if enabled {
+		use, short = "enable <id>...", "Enable skills"
+	}
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(cfgFile)
+			if err != nil {
+				return err
+			}
+			ag, err := agent.New(cfg)
+			if err != nil {
+				return err
+			}
+			for _, id := range args {
+				if _, err := ag.SetSkillEnabled(id, enabled); err != nil {
+					return err
+				}
+				if enabled {
+					fmt.Printf("Skill %s enabled\n", id)
+				} else {
+					fmt.Printf("Skill %s disabled\n", id)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+var skillRemoveCmd = &cobra.Command{
+	Use:     "remove <id>...",
+	Aliases: []string{"delete"},
+	Short:   "Delete skills",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		for _, id := range args {
+			if err := ag.UnregisterSkill(id); err != nil {
+				return err
+			}
+			fmt.Printf("Skill %s deleted\n", id)
+		}
+		return nil
+	},
+}
+
+func init() {
+	skillAddCmd.Flags().StringVar(&skillName, "name", "", "name of the skill; the skill is used when it appears in the input (default: the id)")
+	skillAddCmd.Flags().StringVar(&skillDescription, "description", "", "what the skill is for")
+	skillAddCmd.Flags().StringVar(&skillPrompt, "prompt", "", "text added to the system prompt when the skill is used")
+	skillAddCmd.Flags().StringVarP(&skillFile, "file", "f", "", "read the prompt from this file, or the whole skill from a .json file")
+	skillAddCmd.Flags().StringArrayVar(&skillTriggers, "trigger", nil, "regular expression that activates the skill (repeatable)")
+	skillAddCmd.Flags().BoolVar(&skillDisabled, "disabled", false, "save the skill disabled")
+	skillCmd.AddCommand(skillListCmd)
+	skillCmd.AddCommand(skillAddCmd)
+	skillCmd.AddCommand(skillShowCmd)
+	skillCmd.AddCommand(skillToggleCmd(true))
+	skillCmd.AddCommand(skillToggleCmd(false))
+	skillCmd.AddCommand(skillRemoveCmd)
+}
+
+// artifactsCmd manages generated artifacts
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Manage generated artifacts",
+}
+
+var artifactsFrom string
+
+var artifactsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List artifacts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		artifacts, err := ag.ListArtifacts(artifactsFrom)
+		if err != nil {
+			return err
+		}
+
+		if len(artifacts) == 0 {
+			fmt.Println("No artifacts found")
+			return nil
+		}
+
+		fmt.Println("Artifacts:")
+		for _, a := range artifacts {
+			fmt.Printf("  %s  %-30s %6d bytes  %s#%d  %s\n",
+				a.ShortHash(), a.Name, a.Size, a.ConversationID, a.Turn, a.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+var artifactsShowCmd = &cobra.Command{
+	Use:   "show <hash|name>",
+	Short: "Show an artifact",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		a, content, err := ag.GetArtifact(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Name:         %s\n", a.Name)
+		fmt.Printf("Hash:         %s\n", a.Hash)
+		if a.Language != "" {
+			fmt.Printf("Language:     %s\n", a.Language)
+		}
+		fmt.Printf("Conversation: %s (turn %d)\n", a.ConversationID, a.Turn)
+		fmt.Printf("Created:      %s\n\n", a.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Print(string(content))
+		return nil
+	},
+}
+
+var artifactsExportCmd = &cobra.Command{
+	Use:   "export <hash|name> [path]",
+	Short: "Write an artifact to a file",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+
+		a, content, err := ag.GetArtifact(args[0])
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Base(a.Name)
+		if len(args) == 2 {
+			dest = args[1]
+			if info, err := os.Stat(dest); err == nil && info.IsDir() {
+				dest = filepath.Join(dest, filepath.Base(a.Name))
+			}
+		}
+
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("creating %s: %w", dest, err)
+		}
+		defer f.Close()
+		if _, err := f.Write(content); err != nil {
+			return fmt.Errorf("writing %s: %w", dest, err)
+		}
+
+		fmt.Printf("Exported %s to %s\n", a.ShortHash(), dest)
+		return nil
+	},
+}
+
+func init() {
+	artifactsListCmd.Flags().StringVar(&artifactsFrom, "from", "", "only list artifacts from this conversation")
+	artifactsCmd.AddCommand(artifactsListCmd)
+	artifactsCmd.AddCommand(artifactsShowCmd)
+	artifactsCmd.AddCommand(artifactsExportCmd)
+}
+
+// debateCmd runs a multi-agent debate
+var (
+	debateAgents int
+	debateModels []string
+	debateRounds int
+)
+
+var debateCmd = &cobra.Command{
+	Use:   "debate <question>",
+	Short: "Have several agents debate a question and synthesize an answer",
+	Long: `Runs several personas (optionally on different models) on the same question,
+has them critique each other's answers for a number of rounds, and
+synthesizes a final answer.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		setupConsole(ag, cfg)
+		defer ag.Close()
+		ag.SetPriority(sched.Batch)
+
+		opts := agent.DebateOptions{
+			Agents: debateAgents,
+			Models: debateModels,
+			Rounds: debateRounds,
+		}
+		if !quiet {
+			opts.OnTurn = func(round int, turn agent.DebateTurn) {
+				label := "Initial answer"
+				if round > 0 {
+					label = fmt.Sprintf("Round %d", round)
+				}
+				fmt.Printf("── %s · %s (%s) ──\n%s\n\n", label, turn.Agent, turn.Model, turn.Answer)
+			}
+		}
+
+		result, err := ag.Debate(context.Background(), strings.Join(args, " "), opts)
+		if err != nil {
+			return err
+		}
+
+		if !quiet {
+			fmt.Println("── Final answer ──")
+		}
+		fmt.Println(result.Answer)
+		return nil
+	},
+}
+
+func init() {
+	debateCmd.Flags().IntVar(&debateAgents, "agents", 3, "number of debating agents")
+	debateCmd.Flags().StringSliceVar(&debateModels, "models", nil, "comma-separated models assigned to agents round-robin")
+	debateCmd.Flags().IntVar(&debateRounds, "rounds", 2, "critique rounds after the initial answers")
+	rootCmd.AddCommand(debateCmd)
+}
+
+// runCmd starts an autonomous run with a progress journal
+var runCmd = &cobra.Command{
+	Use:   "run <task>",
+	Short: "Start a resumable autonomous run",
+	Long: `Runs a task autonomously for up to agent.max_run_iterations iterations,
+saving a progress journal after every step. Interrupted runs (Ctrl+C, crash,
+or an exhausted iteration budget) can be continued with 'igent resume'.
+
+With --evaluate (or agent.evaluate_runs), a critic scores whether the result
+satisfies the task once the run completes; igent exits non-zero if it fails.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		setupConsole(ag, cfg)
+		defer ag.Close()
+		ag.SetPriority(sched.Batch)
+		if err := ag.SetConversation(resolveConversation(cmd, cfg)); err != nil {
+			return fmt.Errorf("setting conversation: %w", err)
+		}
+		closeTee, err := setupTee(ag)
+		if err != nil {
+			return err
+		}
+		defer closeTee()
+
+		// Flags override the configured pause points
+		pause := storage.PausePolicy{
+			EveryToolCalls: cfg.Agent.PauseEveryToolCalls,
+			EveryCost:      cfg.Agent.PauseEveryCost,
+			Labels:         cfg.Agent.PauseAt,
+		}
+		if cmd.Flags().Changed("pause-every") {
+			pause.EveryToolCalls = runPauseEvery
+		}
+		if cmd.Flags().Changed("pause-cost") {
+			pause.EveryCost = runPauseCost
+		}
+		if cmd.Flags().Changed("pause-at") {
+			pause.Labels = runPauseAt
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		run, err := ag.StartRun(ctx, strings.Join(args, " "), agent.RunOptions{
+			Pause:    pause,
+			OnChunk:  printChunk,
+			Evaluate: runEvaluate,
+		})
+		return reportRun(run, err)
+	},
+}
+
+var (
+	runPauseEvery int
+	runPauseCost  float64
+	runPauseAt    []string
+	runEvaluate   bool
+	resumeApprove bool
+)
+
+// resumeCmd continues an interrupted run
+var resumeCmd = &cobra.Command{
+	Use:   "resume <run-id>",
+	Short: "Resume an interrupted autonomous run",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		defer ag.Close()
+
+		ag.SetPriority(sched.Batch)
+
+		run, err := ag.GetRun(args[0])
+		if err != nil {
+			return err
+		}
+		if run.Status == storage.RunPaused && !resumeApprove {
+			fmt.Printf("Run %s paused: %s\n", run.ID, run.PauseReason)
+			fmt.Printf("  %d tool calls, ~$%.2f spent\n", run.ToolCalls, run.Cost)
+			if run.NextAction != "" {
+				fmt.Printf("  Next: %s\n", run.NextAction)
+			}
+			fmt.Print("Approve and continue? [y/N]: ")
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				fmt.Println("Run left paused")
+				return nil
+			}
+		}
+
+		closeTee, err := setupTee(ag)
+		if err != nil {
+			return err
+		}
+		defer closeTee()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		run, err = ag.ResumeRun(ctx, args[0], printChunk)
+		return reportRun(run, err)
+	},
+}
+
+// runsCmd inspects run journals
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Manage autonomous runs",
+}
+
+var runsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+
+		runs, err := ag.ListRuns()
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("No runs found")
+			return nil
+		}
+
+		fmt.Println("Runs:")
+		for _, r := range runs {
+			prompt := r.Prompt
+			if len(prompt) > 50 {
+				prompt = prompt[:50] + "..."
+			}
+			fmt.Printf("  %s  %-11s %3d steps  %s  %s\n",
+				r.ID, r.Status, len(r.Steps), r.UpdatedAt.Format("2006-01-02 15:04"), prompt)
+		}
+		return nil
+	},
+}
+
+var runsShowCmd = &cobra.Command{
+	Use:   "show <run-id>",
+	Short: "Show a run's progress journal",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+
+		r, err := ag.GetRun(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Run:          %s\n", r.ID)
+		fmt.Printf("Status:       %s\n", r.Status)
+		fmt.Printf("Conversation: %s (turn %d)\n", r.ConversationID, r.Turn)
+		fmt.Printf("Task:         %s\n", r.Prompt)
+		fmt.Printf("Iterations:   %d\n", r.Iteration)
+		fmt.Printf("Usage:        %d tool calls, ~$%.2f\n", r.ToolCalls, r.Cost)
+		if r.PauseReason != "" {
+			fmt.Printf("Paused:       %s\n", r.PauseReason)
+		}
+		if r.Error != "" {
+			fmt.Printf("Error:        %s\n", r.Error)
+		}
+		if r.NextAction != "" {
+			fmt.Printf("Next action:  %s\n", r.NextAction)
+		}
+		if len(r.Artifacts) > 0 {
+			fmt.Printf("Artifacts:    %s\n", strings.Join(r.Artifacts, ", "))
+		}
+		if e := r.Evaluation; e != nil {
+			fmt.Printf("Evaluation:   %s\n", evaluationSummary(e))
+		}
+
+		if len(r.Steps) > 0 {
+			fmt.Println("\nSteps:")
+			for _, s := range r.Steps {
+				mark := "✓"
+				if s.Error {
+					mark = "✗"
+				}
+				fmt.Printf("  %3d %s %-12s %s\n", s.Iteration, mark, s.Tool, s.Summary)
+			}
+		}
+		if r.Result != "" {
+			fmt.Printf("\nResult:\n%s\n", r.Result)
+		}
+		return nil
+	},
+}
+
+var runsEvaluateCmd = &cobra.Command{
+	Use:   "evaluate <run-id>",
+	Short: "Have a critic evaluate a completed run",
+	Long: `Asks a critic (agent.evaluator_model) whether the run's result and artifacts
+satisfy its task, and saves the verdict in the journal. Exits non-zero if the
+run scores below agent.evaluator_min_score.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		run, err := ag.EvaluateRun(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(evaluationSummary(run.Evaluation))
+		return evaluationError(run)
+	},
+}
+
+// evaluationSummary formats a critic's verdict on one line
+func evaluationSummary(e *storage.Evaluation) string {
+	verdict := "passed"
+	if !e.Passed {
+		verdict = "FAILED"
+	}
+	return fmt.Sprintf("%s, %d/10 by %s: %s", verdict, e.Score, e.Model, e.Reason)
+}
+
+// evaluationError returns an error for a run that failed evaluation, so
+// igent exits non-zero in CI
+func evaluationError(run *storage.Run) error {
+	if e := run.Evaluation; e != nil && !e.Passed {
+		return fmt.Errorf("run %s failed evaluation (score %d/10)", run.ID, e.Score)
+	}
+	return nil
+}
+
+// newRunAgent loads the config and creates an agent for run commands
+func newRunAgent() (*agent.Agent, error) {
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	if err := applyAgentFlags(cfg); err != nil {
+		return nil, err
+	}
+	ag, err := agent.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	setupConsole(ag, cfg)
+	return ag, nil
+}
+
+// applyAgentFlags applies --profile, then lets --no-tools and --tools
+// replace the tools config and --plain turn off markdown rendering
+func applyAgentFlags(cfg *config.Config) error {
+	if profileName != "" {
+		p, err := cfg.WithProfile(profileName)
+		if err != nil {
+			return err
+		}
+		*cfg = *p
+	}
+	if plain {
+		cfg.Agent.Markdown = false
+	}
+	switch {
+	case noTools:
+		cfg.Tools.Enabled, cfg.Tools.Disabled = nil, []string{"*"}
+	case len(toolsFlag) > 0:
+		cfg.Tools.Enabled, cfg.Tools.Disabled = toolsFlag, nil
+	}
+	return nil
+}
+
+// setupConsole sets how tool calls that need confirmation are asked
+// about: not at all with --yes, else on the terminal. Without a terminal
+// to ask on, such calls are refused. Going past a token budget is asked
+// about on the terminal even with --yes, and refused without one. Warnings
+// and other reports go to the notices.
+func setupConsole(ag *agent.Agent, cfg *config.Config) {
+	ag.SetToolPrompt(toolPrompt(cfg))
+	ag.SetWarningHandler(func(msg string) { fmt.Fprintf(notices, "Warning: %s\n", msg) })
+	ag.SetNotices(notices)
+	if stdinIsTerminal() {
+		ag.SetBudgetPrompt(agent.DefaultBudgetConfirmation)
+	}
+}
+
+// toolPrompt returns the tool confirmation prompt setupConsole sets
+func toolPrompt(cfg *config.Config) agent.ToolPromptFunc {
+	switch {
+	case assumeYes:
+		return func(*tools.ToolCall) agent.ToolAnswer { return agent.ToolAnswerYes }
+	case !stdinIsTerminal():
+		return func(call *tools.ToolCall) agent.ToolAnswer {
+			fmt.Fprintf(os.Stderr, "Tool %s needs confirmation, but stdin is not a terminal; pass --yes or allow it in tools.confirm\n", call.Name)
+			return agent.ToolAnswerNo
+		}
+	case cfg.Agent.Accessible:
+		return agent.AccessibleToolConfirmation
+	}
+	return agent.DefaultToolConfirmation
+}
+
+// stdinIsTerminal reports whether stdin is a terminal a user can answer on
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stdinIsPiped reports whether stdin is a pipe or a file to read input
+// from; other stdins, such as a terminal or a socket a service left open,
+// are not read
+func stdinIsPiped() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && (fi.Mode()&os.ModeNamedPipe != 0 || fi.Mode().IsRegular())
+}
+
+// readStdin reads at most limit bytes of stdin, so a pipe that keeps
+// writing neither blocks nor fills memory; the rest is left out with a
+// notice
+func readStdin(limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin: %w", err)
+	}
+	if len(data) > limit {
+		fmt.Fprintf(notices, "Warning: standard input cut at %d bytes\n", limit)
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(data[cut]) {
+			cut--
+		}
+		data = data[:cut]
+	}
+	return data, nil
+}
+
+// resolveConversation returns the conversation to use: the -C flag if
+// given, else <repo>/default inside a git repository when
+// agent.project_namespace is on, else the flag's default
+func resolveConversation(cmd *cobra.Command, cfg *config.Config) string {
+	if cmd.Flag("conversation").Changed || !cfg.Agent.ProjectNamespace {
+		return convID
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return convID
+	}
+	return agent.ProjectConversation(wd)
+}
+
+// setupTee opens the --tee file, appending so earlier sessions are kept,
+// and returns a function that closes it
+func setupTee(ag *agent.Agent) (func(), error) {
+	if teeFile == "" {
+		return func() {}, nil
+	}
+	f, err := os.OpenFile(teeFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening tee file: %w", err)
+	}
+	ag.SetTee(f, teeTools)
+	return func() {
+		ag.SetTee(nil, false)
+		f.Close()
+	}, nil
+}
+
+// setupRecorder records the session to the --record transcript, if given,
+// and returns the function that stops recording
+func setupRecorder(ag *agent.Agent) (func(), error) {
+	if recordFile == "" {
+		return func() {}, nil
+	}
+	r, err := transcript.Create(recordFile, logger.L())
+	if err != nil {
+		return nil, err
+	}
+	ag.SetRecorder(r)
+	return func() {
+		ag.SetRecorder(nil)
+		r.Close()
+	}, nil
+}
+
+// printChunk writes streamed output to stdout
+func printChunk(chunk string) {
+	fmt.Print(chunk)
+}
+
+// printStats prints the metadata of an answer to stderr with --stats
+func printStats(result *agent.ChatResult) {
+	if showStats {
+		fmt.Fprintf(os.Stderr, "[%s]\n", result.Summary())
+	}
+}
+
+// reportRun prints how a run ended and how to resume it
+func reportRun(run *storage.Run, err error) error {
+	fmt.Println()
+	if run == nil {
+		return err
+	}
+	switch run.Status {
+	case storage.RunPaused:
+		fmt.Fprintf(notices, "Run %s paused (%s); review and approve with: igent resume %s\n", run.ID, run.PauseReason, run.ID)
+	case storage.RunCompleted:
+		fmt.Fprintf(notices, "Run %s completed after %d iterations\n", run.ID, run.Iteration)
+		if e := run.Evaluation; e != nil && err == nil {
+			fmt.Fprintf(notices, "Evaluation %s\n", evaluationSummary(e))
+			return evaluationError(run)
+		}
+	default:
+		fmt.Fprintf(notices, "Run %s %s; continue with: igent resume %s\n", run.ID, run.Status, run.ID)
+	}
+	return err
+}
+
+func init() {
+	runCmd.Flags().IntVar(&runPauseEvery, "pause-every", 0, "pause for review every N tool calls (overrides agent.pause_every_tool_calls)")
+	runCmd.Flags().Float64Var(&runPauseCost, "pause-cost", 0, "pause for review every N USD spent (overrides agent.pause_every_cost)")
+	runCmd.Flags().StringSliceVar(&runPauseAt, "pause-at", nil, "pause at these checkpoint labels, or * for all (overrides agent.pause_at)")
+	runCmd.Flags().BoolVar(&runEvaluate, "evaluate", false, "have a critic evaluate the result; exit non-zero if it fails")
+	resumeCmd.Flags().BoolVarP(&resumeApprove, "approve", "y", false, "approve a paused run without prompting")
+	runsCmd.AddCommand(runsListCmd)
+	runsCmd.AddCommand(runsShowCmd)
+	runsCmd.AddCommand(runsEvaluateCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(resumeCmd)
+	rootCmd.AddCommand(runsCmd)
+}
+
+// askCmd sends a prompt to the most relevant conversation
+var askCmd = &cobra.Command{
+	Use:   "ask <prompt>",
+	Short: "Ask in the most relevant conversation",
+	Long: `Sends the prompt to the existing conversation it is most similar to,
+comparing embeddings of the prompt and each conversation's summary and recent
+requests (keyword overlap when the provider has no embeddings). If no
+conversation reaches routing.min_similarity, a new one named after the prompt
+is started. An explicit -C skips routing.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		setupConsole(ag, cfg)
+		defer ag.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		prompt := strings.Join(args, " ")
+		if cmd.Flag("conversation").Changed {
+			if err := ag.SetConversation(convID); err != nil {
+				return fmt.Errorf("setting conversation: %w", err)
+			}
+		} else {
+			route, err := ag.RouteConversation(ctx, prompt)
+			if err != nil {
+				return err
+			}
+			if route.Created {
+				fmt.Fprintf(notices, "→ new conversation %s\n", route.ConversationID)
+			} else {
+				fmt.Fprintf(notices, "→ %s (%s similarity %.2f)\n", route.ConversationID, route.Method, route.Similarity)
+			}
+		}
+
+		prompt, err = ag.ExpandAttachments(ctx, prompt)
+		if err != nil {
+			return err
+		}
+
+		closeTee, err := setupTee(ag)
+		if err != nil {
+			return err
+		}
+		defer closeTee()
+		stopRecording, err := setupRecorder(ag)
+		if err != nil {
+			return err
+		}
+		defer stopRecording()
+
+		md := ag.AnswerRenderer()
+		result, err := ag.ChatStream(ctx, prompt, md.Write)
+		md.Flush()
+		fmt.Println()
+		if err != nil {
+			return err
+		}
+		printStats(result)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(askCmd)
+}
+
+var (
+	batchOutput      string
+	batchConcurrency int
+	batchTimeout     time.Duration
+)
+
+// batchCmd answers the prompts of a JSONL file
+var batchCmd = &cobra.Command{
+	Use:   "batch <prompts.jsonl>",
+	Short: "Answer many prompts from a JSONL file",
+	Long: `Answers every prompt of a JSONL file (- for stdin) without a user, several
+at a time, and writes one JSON result per item in input order:
+
+  {"id": "q1", "prompt": "Summarize RFC 2616"}
+  {"id": "q2", "prompt": "And RFC 7230?", "conversation": "rfcs"}
+
+  {"line": 1, "id": "q1", "conversation": "batch-.../q1", "response": "...", "duration_ms": 5120}
+
+Each item gets a new conversation (batch-<time>/<id or line>) unless it names
+one; items naming the same conversation are answered in order. With -C, all
+items without a conversation share that one. Failed items carry an "error"
+and do not stop the others; igent exits non-zero if any failed. Tools that
+need confirmation are refused unless --yes.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+
+		in := os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		items, err := batch.Read(in)
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if batchOutput != "" && batchOutput != "-" {
+			f, err := os.Create(batchOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		prefix := "batch-" + time.Now().Format("20060102-150405")
+		shared := cmd.Flag("conversation").Changed
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		var (
+			summary batch.Summary
+			agents  []*agent.Agent
+		)
+		enc := json.NewEncoder(out)
+		err = batch.Run(ctx, items, batch.Options{
+			Concurrency: batchConcurrency,
+			Timeout:     batchTimeout,
+			NewAgent: func() (batch.Agent, error) {
+				ag, err := agent.New(cfg)
+				if err != nil {
+					return nil, err
+				}
+				setupConsole(ag, cfg)
+				// Parallel items can't share the terminal
+				ag.SetToolPrompt(func(call *tools.ToolCall) agent.ToolAnswer {
+					if assumeYes {
+						return agent.ToolAnswerYes
+					}
+					fmt.Fprintf(notices, "Tool %s needs confirmation, which batch items can't ask for; pass --yes or allow it in tools.confirm\n", call.Name)
+					return agent.ToolAnswerNo
+				})
+				ag.SetBudgetPrompt(nil)
+				ag.SetPriority(sched.Batch)
+				agents = append(agents, ag)
+				return ag, nil
+			},
+			Conversation: func(item batch.Item) string {
+				if shared {
+					return convID
+				}
+				if item.ID != "" {
+					return prefix + "/" + item.ID
+				}
+				return fmt.Sprintf("%s/%d", prefix, item.Line)
+			},
+		}, func(r batch.Result) error {
+			summary.Add(r)
+			if r.Error != "" {
+				fmt.Fprintf(os.Stderr, "line %d: %s\n", r.Line, r.Error)
+			}
+			return enc.Encode(r)
+		})
+		for _, ag := range agents {
+			ag.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("writing results: %w", err)
+		}
+
+		fmt.Fprintf(notices, "Answered %d of %d items\n", summary.Items-summary.Failed, summary.Items)
+		if summary.Failed > 0 {
+			return fmt.Errorf("%d of %d items failed", summary.Failed, summary.Items)
+		}
+		return nil
+	},
+}
+
+func init() {
+	batchCmd.Flags().StringVarP(&batchOutput, "output", "o", "", "write results to this file (default: stdout)")
+	batchCmd.Flags().IntVarP(&batchConcurrency, "concurrency", "j", batch.DefaultConcurrency, "items answered at once (provider.max_concurrent still caps provider calls)")
+	batchCmd.Flags().DurationVar(&batchTimeout, "timeout", 0, "give up on an item after this long (0 = no limit)")
+	rootCmd.AddCommand(batchCmd)
+}
+
+// tuiCmd runs the full-screen terminal UI
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Chat in a full-screen terminal UI",
+	Long: `Chats in a full-screen terminal UI instead of the readline REPL: a sidebar
+lists the conversations (Tab to focus it, Enter to open one, Ctrl+N for a new
+one), the conversation scrolls with PgUp/PgDn or the mouse wheel, running tool
+calls show their status, and tool calls that need confirmation are asked about
+inline. Ctrl+C cancels the answer being written, or quits.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !stdinIsTerminal() {
+			return errors.New("igent tui needs a terminal")
+		}
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+		// Log lines would tear the screen
+		logger.Init(logger.Config{
+			Level:  logger.Level(cfg.Logging.Level),
+			Format: logger.Format(cfg.Logging.Format),
+		}, io.Discard)
+
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return fmt.Errorf("creating agent: %w", err)
+		}
+		defer ag.Close()
+		if err := ag.SetConversation(resolveConversation(cmd, cfg)); err != nil {
+			return fmt.Errorf("setting conversation: %w", err)
+		}
+		return tui.Run(context.Background(), ag, tui.Options{Name: cfg.Agent.Name, AssumeYes: assumeYes})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
+
+var replayModel string
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <transcript>",
+	Short: "Re-render a recorded session, or run it again against a model",
+	Long: `Show a session recorded with --record: its prompts, tool calls with their
+results, answers and timings.
+
+With --model, the prompts are sent again to that model in a new conversation
+(replay-<time>, or -C) and each answer is shown next to the recorded one, with
+durations and tool call counts for comparison. Tools run again too, asking
+for confirmation as usual.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		events, err := transcript.Load(args[0])
+		if err != nil {
+			return err
+		}
+		turns := transcript.Turns(events)
+		if len(turns) == 0 {
+			return fmt.Errorf("%s has no recorded turns", args[0])
+		}
+		if replayModel == "" {
+			transcript.Render(os.Stdout, turns)
+			return nil
+		}
+
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+		cfg.Provider.Model = replayModel
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		setupConsole(ag, cfg)
+		id := "replay-" + time.Now().Format("20060102-150405")
+		if cmd.Flag("conversation").Changed {
+			id = convID
+		}
+		if err := ag.SetConversation(id); err != nil {
+			return fmt.Errorf("setting conversation: %w", err)
+		}
+		stopRecording, err := setupRecorder(ag)
+		if err != nil {
+			return err
+		}
+		defer stopRecording()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		summary := func(t transcript.Turn) string {
+			s := t.Duration().Round(time.Millisecond).String()
+			if n := t.ToolCalls(); n > 0 {
+				s += fmt.Sprintf(", %d tool calls", n)
+			}
+			return s
+		}
+		recordedModel := "recorded"
+		var recordedTotal, replayTotal time.Duration
+		results, err := ag.Replay(ctx, turns, agent.ReplayOptions{
+			OnChunk: printChunk,
+			BeforeTurn: func(i int, t transcript.Turn) {
+				if t.Session != nil {
+					recordedModel = t.Session.Model
+				}
+				fmt.Printf("--- Turn %d/%d ---\n> %s\n\n", i+1, len(turns), t.Prompt.Text)
+				fmt.Printf("[%s, %s]\n%s\n\n[%s]\n", recordedModel, summary(t), t.Outcome(), replayModel)
+			},
+			AfterTurn: func(i int, t agent.ReplayedTurn) {
+				if t.Replayed.Response == nil {
+					fmt.Print(t.Replayed.Outcome())
+				}
+				fmt.Printf("\n(%s)\n\n", summary(t.Replayed))
+				recordedTotal += t.Recorded.Duration()
+				replayTotal += t.Replayed.Duration()
+			},
+		})
+		fmt.Printf("Replayed %d turns in conversation %s: %s recorded, %s with %s\n",
+			len(results), id, recordedTotal.Round(time.Millisecond), replayTotal.Round(time.Millisecond), replayModel)
+		return err
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayModel, "model", "", "send the prompts again to this model and compare the answers")
+	rootCmd.AddCommand(replayCmd)
+}
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the agent over an OpenAI-compatible API",
+	Long: `Serve the agent at /v1/chat/completions and /v1/models of an OpenAI-compatible
+HTTP API, so clients and UIs made for chat models (Open WebUI and the like)
+can use igent as a model, memory, skills and tools included. Streaming is
+supported.
+
+The agent keeps each conversation's history itself: only the last user
+message of a request is sent to it. The X-Igent-Conversation header names the
+conversation; without it, the conversation is derived from the request's user
+field and first user message, which stay the same while a client resends a
+chat. A request with neither is refused. Requests are answered one at a time.
+
+Set server.api_key to require it as a bearer token. Tools that need
+confirmation are refused unless --yes is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		defer ag.Close()
+		ag.SetToolPrompt(func(*tools.ToolCall) agent.ToolAnswer {
+			if assumeYes {
+				return agent.ToolAnswerYes
+			}
+			return agent.ToolAnswerNo
+		})
+		if serveAddr != "" {
+			cfg.Server.Addr = serveAddr
+		}
+		stopRecording, err := setupRecorder(ag)
+		if err != nil {
+			return err
+		}
+		defer stopRecording()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		httpServer := &http.Server{
+			Addr:              cfg.Server.Addr,
+			Handler:           server.New(ag, cfg.Server).Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		errc := make(chan error, 1)
+		go func() { errc <- httpServer.ListenAndServe() }()
+		fmt.Fprintf(notices, "Serving on http://%s/v1 (Ctrl+C to stop)\n", cfg.Server.Addr)
+
+		select {
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "", "listen address (default server.addr, 127.0.0.1:8080)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep the agent running for one-shot prompts",
+	Long: `Run the agent in the background, keeping the provider, memory indexes and
+conversation state loaded. One-shot prompts (igent "...") are then answered by
+the daemon over a unix socket (daemon.socket, default <work_dir>/daemon.sock)
+instead of starting up each time; when no daemon runs, igent answers itself.
+
+Tools run in the directory igent was started in, and confirmations are asked
+on its terminal as usual. Prompts with --plan, --orchestrate, --profile,
+--tools, --no-tools, --tee or --record, the REPL and --no-daemon bypass the
+daemon. Restart it after changing the config.
+
+  igent daemon &
+  igent daemon status
+  igent daemon stop`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := applyAgentFlags(cfg); err != nil {
+			return err
+		}
+		if path, err := backup.Rotate(cfg.Storage.WorkDir, cfg.Storage.BackupKeep, time.Now()); err != nil {
+			logger.L().Warn("daily backup failed", "error", err)
+		} else if path != "" {
+			logger.L().Info("daily backup created", "path", path)
+		}
+		ag, err := agent.New(cfg)
+		if err != nil {
+			return err
+		}
+		defer ag.Close()
+		stopRecording, err := setupRecorder(ag)
+		if err != nil {
+			return err
+		}
+		defer stopRecording()
+
+		ln, err := daemon.Listen(cfg.DaemonSocket())
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(notices, "igent daemon listening on %s (Ctrl+C or igent daemon stop to stop)\n", cfg.DaemonSocket())
+		return daemon.New(ag).Serve(ctx, ln)
+	},
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is running",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		status, err := daemon.Ping(context.Background(), cfg.DaemonSocket())
+		if errors.Is(err, daemon.ErrNotRunning) {
+			fmt.Println("igent daemon is not running")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("igent daemon running on %s\n", cfg.DaemonSocket())
+		fmt.Printf("  pid:      %d\n", status.PID)
+		fmt.Printf("  up since: %s (%s)\n", status.Started.Format("2006-01-02 15:04:05"), time.Since(status.Started).Round(time.Second))
+		fmt.Printf("  prompts:  %d\n", status.Requests)
+		if status.Conversation != "" {
+			fmt.Printf("  last:     %s\n", status.Conversation)
+		}
+		for _, p := range []sched.Priority{sched.Interactive, sched.Scheduled, sched.Batch} {
+			stats, ok := status.Queues[p.String()]
+			if !ok {
+				continue
+			}
+			var avg time.Duration
+			if stats.Calls > 0 {
+				avg = stats.TotalWait / time.Duration(stats.Calls)
+			}
+			fmt.Printf("  %-9s %d calls, %d queued (avg wait %s, max %s), %d waiting\n", p.String()+":",
+				stats.Calls, stats.Waited, avg.Round(time.Millisecond), stats.MaxWait.Round(time.Millisecond), stats.Queued)
+		}
+		return nil
+	},
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the daemon",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return fmt.Errorf("loading config: %w", err)
+		}
+		if err := daemon.Stop(context.Background(), cfg.DaemonSocket()); err != nil {
+			return err
+		}
+		fmt.Println("igent daemon stopped")
+		return nil
+	},
+}
+
+func init() {
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonStopCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
+
+// useDaemon reports whether a one-shot prompt may go to igent daemon: the
+// flags that change the agent or need it in this process bypass it
+func useDaemon() bool {
+	return !noDaemon && !planFirst && !orchestrate && profileName == "" && systemFile == "" &&
+		!noTools && len(toolsFlag) == 0 && teeFile == "" && recordFile == ""
+}
+
+// chatWithDaemon answers a one-shot prompt with igent daemon, printing it
+// as runAgent would. It returns daemon.ErrNotRunning if no daemon runs.
+func chatWithDaemon(cfg *config.Config, conversation, prompt string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	streamed := false
+	md := agent.NewAnswerRenderer(cfg, render.FileImages)
+	handlers := daemon.ChatHandlers{
+		OnWarning: func(msg string) { fmt.Fprintf(notices, "Warning: %s\n", msg) },
+		Confirm:   toolPrompt(cfg),
+	}
+	if streaming {
+		handlers.OnChunk = func(chunk string) {
+			streamed = true
+			md.Write(chunk)
+		}
+	}
+	result, err := daemon.Chat(ctx, cfg.DaemonSocket(), daemon.Request{
+		Conversation: conversation,
+		Prompt:       prompt,
+		Dir:          wd,
+	}, handlers)
+	if errors.Is(err, daemon.ErrNotRunning) {
+		return err
+	}
+	if !streamed && result != nil && result.Content != "" {
+		md.Write(result.Content)
+	}
+	md.Flush()
+	if streamed || (result != nil && result.Content != "") {
+		fmt.Println()
+	}
+	var derr *daemon.Error
+	if errors.As(err, &derr) && derr.Partial {
+		fmt.Fprintf(notices, "Partial answer saved; resume it with /continue in: igent -C %s\n", conversation)
+	}
+	if err != nil {
+		return err
+	}
+	printStats(result)
+	return nil
+}
+
+// guardrailsLimit caps the events igent guardrails shows
+var guardrailsLimit int
+
+// guardrailsCmd shows the audit of triggered guardrails
+var guardrailsCmd = &cobra.Command{
+	Use:   "guardrails",
+	Short: "Show the guardrails that were triggered",
+	Long: `Show the latest entries of the guardrail audit: the input, tool calls
+and answers that guardrails blocked, redacted, cut or warned about. The
+matched text itself is not recorded.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		store, err := storage.NewJSONStore(cfg.Storage.WorkDir)
+		if err != nil {
+			return err
+		}
+		events, err := store.LoadGuardrailEvents()
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			fmt.Println("No guardrails triggered")
+			return nil
+		}
+		if guardrailsLimit > 0 && len(events) > guardrailsLimit {
+			events = events[len(events)-guardrailsLimit:]
+		}
+
+		for _, e := range events {
+			line := fmt.Sprintf("  %s  %-20s %-9s %-8s %s",
+				e.Time.Local().Format("2006-01-02 15:04:05"), e.Conversation, e.Stage, e.Action, e.Rule)
+			if e.Detail != "" {
+				line += " (" + e.Detail + ")"
+			}
+			fmt.Println(line)
+		}
+		return nil
+	},
+}
+
+func init() {
+	guardrailsCmd.Flags().IntVar(&guardrailsLimit, "limit", 20, "show at most this many of the latest events (0 = all)")
+	rootCmd.AddCommand(guardrailsCmd)
+}
+
+// scheduleCmd manages prompts run on a cron schedule
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run prompts on a cron schedule",
+	Long: `Scheduled tasks send a prompt to a named conversation on a cron schedule
+and keep their recent results. Tasks run while 'igent schedule daemon' is
+running, or from the system scheduler with a crontab entry such as
+
+  * * * * * igent schedule run
+
+Unattended runs can't confirm tools: pass --yes or allow the tools the task
+needs in tools.confirm.`,
+}
+
+var scheduleAddCmd = &cobra.Command{
+	Use:   `add "<cron>" <prompt>`,
+	Short: "Schedule a prompt",
+	Long: `Schedules a prompt on a five-field cron expression (minute hour day month
+weekday) or @hourly, @daily, @weekly, @monthly. The prompt runs in the -C
+conversation, or in a conversation of its own.
+
+  igent schedule add "0 9 * * 1-5" "summarize my TODO file" -C todos`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		conversation := ""
+		if cmd.Flag("conversation").Changed {
+			conversation = convID
+		}
+		s, err := ag.AddSchedule(args[0], strings.Join(args[1:], " "), conversation)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Scheduled %s in conversation %s, next run %s\n",
+			s.ID, s.ConversationID, s.NextRun.Format("2006-01-02 15:04"))
+		return nil
+	},
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List scheduled tasks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		schedules, err := ag.ListSchedules()
+		if err != nil {
+			return err
+		}
+		if len(schedules) == 0 {
+			fmt.Println("No scheduled tasks")
+			return nil
+		}
+
+		fmt.Println("Scheduled tasks:")
+		for _, s := range schedules {
+			prompt := s.Prompt
+			if len(prompt) > 40 {
+				prompt = prompt[:40] + "..."
+			}
+			fmt.Printf("  %s  %-14s next %s  %-6s  %s  %s\n", s.ID, s.Cron,
+				s.NextRun.Format("2006-01-02 15:04"), scheduleStatus(s), s.ConversationID, prompt)
+		}
+		return nil
+	},
+}
+
+var scheduleShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a scheduled task and its recent results",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		s, err := ag.GetSchedule(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Schedule:     %s\n", s.ID)
+		fmt.Printf("Cron:         %s\n", s.Cron)
+		fmt.Printf("Conversation: %s\n", s.ConversationID)
+		fmt.Printf("Prompt:       %s\n", s.Prompt)
+		fmt.Printf("Next run:     %s\n", s.NextRun.Format("2006-01-02 15:04"))
+		for i := len(s.Results) - 1; i >= 0; i-- {
+			r := s.Results[i]
+			fmt.Printf("\n── %s (%s) ──\n", r.At.Format("2006-01-02 15:04"), r.Duration.Round(time.Second))
+			if r.Error != "" {
+				fmt.Printf("Error: %s\n", r.Error)
+			}
+			if r.Response != "" {
+				fmt.Println(r.Response)
+			}
+		}
+		return nil
+	},
+}
+
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a scheduled task (its conversation is kept)",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		if err := ag.RemoveSchedule(args[0]); err != nil {
+			return err
+		}
+		fmt.Println("Schedule removed")
+		return nil
+	},
+}
+
+var scheduleRunCmd = &cobra.Command{
+	Use:   "run [id]",
+	Short: "Run due tasks once, or one task now",
+	Long: `Without an ID, runs every task that is due and exits; call it every minute
+from cron or launchd. With an ID, runs that task now without changing its
+next run.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		defer ag.Close()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if len(args) == 1 {
+			s, err := ag.RunSchedule(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			printScheduleResult(s)
+			return nil
+		}
+		_, err = ag.RunDueSchedules(ctx, time.Now(), printScheduleResult)
+		return err
+	},
+}
+
+var scheduleDaemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled tasks in the foreground until interrupted",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		defer ag.Close()
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Fprintln(notices, "Running scheduled tasks; press Ctrl+C to stop")
+		for {
+			if _, err := ag.RunDueSchedules(ctx, time.Now(), printScheduleResult); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "schedule: %v\n", err)
+			}
+
+			// Wake for the next run, and at least every minute to pick up
+			// tasks added meanwhile
+			wait := time.Minute
+			schedules, _ := ag.ListSchedules()
+			for _, s := range schedules {
+				if !s.NextRun.IsZero() {
+					wait = max(min(time.Until(s.NextRun), wait), time.Second)
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(wait):
+			}
+		}
+	},
+}
+
+// scheduleStatus describes how a task's last run went
+func scheduleStatus(s *storage.Schedule) string {
+	switch last := s.LastResult(); {
+	case last == nil:
+		return "never"
+	case last.Error != "":
+		return "failed"
+	}
+	return "ok"
+}
+
+// printScheduleResult prints the first line of a task's last result
+func printScheduleResult(s *storage.Schedule) {
+	last := s.LastResult()
+	if last == nil {
+		return
+	}
+	summary := last.Response
+	if last.Error != "" {
+		summary = "error: " + last.Error
+	}
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = summary[:i] + " ..."
+	}
+	fmt.Printf("%s  %s  %s\n", last.At.Format("2006-01-02 15:04"), s.ID, summary)
+}
+
+func init() {
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleShowCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(scheduleRunCmd)
+	scheduleCmd.AddCommand(scheduleDaemonCmd)
+	rootCmd.AddCommand(scheduleCmd)
+}
+
+var gcDryRun bool
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Archive or delete stale conversations and prune low-relevance memories",
+	Long: `Apply the retention policy of the storage config:
+
+  storage.retention_days     archive or delete conversations not updated for this many days
+  storage.max_conversations  keep only this many most recently updated conversations
+  storage.retention_action   archive (move to <work_dir>/archive/messages) or delete
+  storage.prune_relevance    delete memories with a lower relevance (default 0.3)
+
+Use --dry-run to see what would be removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ag, err := newRunAgent()
+		if err != nil {
+			return err
+		}
+		result, err := ag.GC(time.Now(), gcDryRun)
+		if err != nil {
+			return err
+		}
+
+		if result.Empty() {
+			fmt.Println("Nothing to remove")
+			return nil
+		}
+		verb := func(done, planned string) string {
+			if result.DryRun {
+				return planned
+			}
+			return done
+		}
+		if len(result.Archived) > 0 {
+			fmt.Printf("%s %d conversations: %s\n", verb("Archived", "Would archive"), len(result.Archived), strings.Join(result.Archived, ", "))
+		}
+		if len(result.Deleted) > 0 {
+			fmt.Printf("%s %d conversations: %s\n", verb("Deleted", "Would delete"), len(result.Deleted), strings.Join(result.Deleted, ", "))
+		}
+		if len(result.Memories) > 0 {
+			fmt.Printf("%s %d memories:\n", verb("Pruned", "Would prune"), len(result.Memories))
+			for _, m := range result.Memories {
+				fmt.Printf("  [%s] %.2f %s\n", m.ID, m.Relevance, m.Content)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "only report what would be removed")
+	rootCmd.AddCommand(gcCmd)
+}
+
+var syncDryRun bool
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Push and pull conversations and memories to the sync remote",
+	Long: `Sync the conversations, memories and entities of the work dir with the remote
+configured under sync (backend: git, url, branch), so the same agent state is
+available on several machines. Local and remote changes since the last sync
+are exchanged, deletions included; a file changed on both sides is resolved
+in favor of the newer one.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		backend, err := remotesync.NewBackend(cfg.Storage.WorkDir, cfg.Sync)
+		if err != nil {
+			return err
+		}
+		result, err := remotesync.New(cfg.Storage.WorkDir, backend).Sync(cmd.Context(), syncDryRun)
+		if err != nil {
+			return err
+		}
+
+		if result.Changes() == 0 {
+			fmt.Println("Already in sync")
+			return nil
+		}
+		report := func(label string, paths []string) {
+			if len(paths) > 0 {
+				fmt.Printf("%s (%d): %s\n", label, len(paths), strings.Join(paths, ", "))
+			}
+		}
+		if result.DryRun {
+			fmt.Println("Dry run; nothing was changed")
+		}
+		report("Pushed", result.Pushed)
+		report("Pulled", result.Pulled)
+		report("Deleted locally", result.DeletedLocal)
+		report("Deleted remotely", result.DeletedRemote)
+		report("Conflicts, newer kept", result.Conflicts)
+		return nil
+	},
+}
+
+func init() {
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "only report what would be pushed and pulled")
+	rootCmd.AddCommand(syncCmd)
+}
+
+var backupOutput string
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up and restore the work dir",
+	Long: `Snapshot the whole work dir (conversations, memories, skills, runs, artifacts
+and the config file kept there) into a .tar.gz archive with a SHA-256
+manifest, and restore it after checking every file. Set storage.backup_keep
+to make a daily backup in <work_dir>/backups automatically.
+
+Backups contain the config, including any API key stored in it.`,
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Write a backup of the work dir",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		path := backupOutput
+		if path == "" {
+			path = filepath.Join(cfg.Storage.WorkDir, backup.Dir, "backup-"+time.Now().Format("20060102-150405")+".tar.gz")
+		}
+		manifest, err := backup.CreateFile(cfg.Storage.WorkDir, path)
+		if err != nil {
+			return fmt.Errorf("creating backup: %w", err)
+		}
+		fmt.Printf("Backed up %d files (%d bytes) to %s\n", len(manifest.Files), manifest.Size(), path)
+		return nil
+	},
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <archive>",
+	Short: "Replace the work dir with a backup",
+	Long: `Restore a backup made by 'igent backup create'. The archive is verified first;
+the current contents of the work dir are then saved to
+<work_dir>/backups/pre-restore-<time>.tar.gz and replaced.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		manifest, err := backup.VerifyFile(args[0])
+		if err != nil {
+			return err
+		}
+
+		if !assumeYes {
+			fmt.Printf("Replace the contents of %s with the backup of %s (%d files)? [y/N]: ",
+				cfg.Storage.WorkDir, manifest.CreatedAt.Format("2006-01-02 15:04"), len(manifest.Files))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				fmt.Println("Restore cancelled")
+				return nil
+			}
+		}
+
+		manifest, previous, err := backup.Restore(cfg.Storage.WorkDir, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Restored %d files to %s\n", len(manifest.Files), cfg.Storage.WorkDir)
+		fmt.Printf("The previous contents were saved to %s\n", previous)
+		return nil
+	},
+}
+
+var backupVerifyCmd = &cobra.Command{
+	Use:   "verify <archive>",
+	Short: "Check a backup against its manifest",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifest, err := backup.VerifyFile(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: %d files (%d bytes), created %s\n",
+			len(manifest.Files), manifest.Size(), manifest.CreatedAt.Format("2006-01-02 15:04"))
+		return nil
+	},
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backups in the work dir",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(cfgFile)
+		if err != nil {
+			return err
+		}
+		backups, err := backup.List(cfg.Storage.WorkDir)
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Println("No backups")
+			return nil
+		}
+		for _, b := range backups {
+			fmt.Printf("%-40s %12d bytes  %s\n", b.Name(), b.Size(), b.ModTime().Format("2006-01-02 15:04"))
+		}
+		return nil
+	},
+}
+
+func init() {
+	backupCreateCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "archive to write (default <work_dir>/backups/backup-<time>.tar.gz)")
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupVerifyCmd)
+	backupCmd.AddCommand(backupListCmd)
+	rootCmd.AddCommand(backupCmd)
 }
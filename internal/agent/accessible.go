@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/igm/igent/internal/tools"
+)
+
+// FormatToolCallPlain formats a tool call as plain sentences for screen
+// readers: no colors, box drawing or symbols, and arguments in a stable order
+func FormatToolCallPlain(call *tools.ToolCall) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\nThe assistant wants to run the tool %s.\n", call.Name)
+
+	if call.Name == "shell" || call.Name == "shell_session" {
+		if cmd, ok := call.Args["command"].(string); ok {
+			fmt.Fprintf(&sb, "Command: %s\n", cmd)
+		}
+	} else if len(call.Args) > 0 {
+		keys := make([]string, 0, len(call.Args))
+		for key := range call.Args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		sb.WriteString("Arguments:\n")
+		for _, key := range keys {
+			fmt.Fprintf(&sb, "%s: %v\n", key, call.Args[key])
+		}
+	}
+	return sb.String()
+}
+
+// AccessibleToolConfirmation is the confirmation prompt of accessible mode
+func AccessibleToolConfirmation(call *tools.ToolCall) ToolAnswer {
+	fmt.Fprint(os.Stderr, FormatToolCallPlain(call))
+	fmt.Fprint(os.Stderr, "Allow it? Type yes, no, or always to allow this tool for the session: ")
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return ToolAnswerNo
+	}
+	return parseToolAnswer(response)
+}
+
+// announceToolStart and announceToolEnd report tool activity to the tool
+// status handler and in accessible mode, where safe tools would otherwise
+// run without any visible trace
+func (a *Agent) announceToolStart(call *tools.ToolCall) {
+	if a.onToolStatus != nil {
+		a.onToolStatus(call, nil)
+	}
+	if a.onAnnounce != nil {
+		a.onAnnounce(fmt.Sprintf("Running tool %s.", call.Name))
+	}
+}
+
+func (a *Agent) announceToolEnd(call *tools.ToolCall, result *tools.ToolResult) {
+	if a.onToolStatus != nil {
+		a.onToolStatus(call, result)
+	}
+	if a.onAnnounce == nil {
+		return
+	}
+	if result.Error != "" {
+		a.onAnnounce(fmt.Sprintf("Tool %s failed: %s", call.Name, result.Error))
+		return
+	}
+	a.onAnnounce(fmt.Sprintf("Tool %s finished.", call.Name))
+}
@@ -3,24 +3,39 @@ package agent
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/guardrails"
 	"github.com/igm/igent/internal/llm"
 	"github.com/igm/igent/internal/logger"
 	"github.com/igm/igent/internal/memory"
+	"github.com/igm/igent/internal/netpolicy"
+	"github.com/igm/igent/internal/render"
+	"github.com/igm/igent/internal/sched"
 	"github.com/igm/igent/internal/skills"
 	"github.com/igm/igent/internal/storage"
 	"github.com/igm/igent/internal/tools"
+	"github.com/igm/igent/internal/tracing"
+	"github.com/igm/igent/internal/transcript"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// maxParallelTools bounds how many tool calls from one response run concurrently
+const maxParallelTools = 4
+
 // ErrToolDenied is returned when user denies tool execution
 var ErrToolDenied = fmt.Errorf("tool execution denied by user")
 
@@ -32,19 +47,121 @@ type ToolConfirmationFunc func(call *tools.ToolCall) bool
 type Agent struct {
 	config         *config.Config
 	provider       llm.Provider
+	model          string // The model provider answers with; Retry swaps both
 	store          *storage.JSONStore
 	memory         *memory.Manager
 	skills         *skills.Registry
 	tools          *tools.Registry
+	policy         *toolPolicy
+	netPolicy      *netpolicy.Policy
 	conversationID string
+	style          ResponseStyle
 	log            *slog.Logger
 
-	// onToolConfirm is called before each tool execution for user confirmation
-	onToolConfirm ToolConfirmationFunc
+	// conversationPrompt replaces agent.system_prompt in the current
+	// conversation, if set (Conversation.SystemPrompt)
+	conversationPrompt string
+
+	// onToolConfirm asks the user about tool calls the policy does not
+	// decide; without it those calls run
+	onToolConfirm ToolPromptFunc
+
+	// onReasoning receives the thinking stream of reasoning models, if set
+	onReasoning func(string)
+
+	// tee copies streamed output to a file, if set
+	tee *teeWriter
+
+	// onToolOutput receives live output of tools that stream it, if set
+	onToolOutput func(tool, chunk string)
+
+	// onAnnounce receives plain-sentence reports of tool activity, if set
+	onAnnounce func(string)
+
+	// onToolStatus receives tool calls as they start (nil result) and
+	// finish, if set
+	onToolStatus ToolStatusFunc
+
+	// promptFiles holds the system prompt include files
+	promptFiles *promptFiles
+
+	// quota records usage and enforces the configured quotas
+	quota *quota
+
+	// sched admits provider calls under the provider's concurrency cap, by priority
+	sched    *sched.Scheduler
+	priority sched.Priority
+
+	// onWarning receives warnings for the user, such as quotas nearly used
+	// up or answers cut off by the provider
+	onWarning func(string)
+
+	// notices receives reports besides the answer, such as the delegations
+	// of an orchestrated request (default: stderr)
+	notices io.Writer
+
+	// planMode makes the REPL plan every message before carrying it out
+	planMode bool
+
+	// orchestrateMode makes the REPL hand every message to the orchestrator
+	orchestrateMode bool
+
+	// temperature is the sampling temperature of turns (nil = provider
+	// default), set by Retry for one turn
+	temperature *float64
+
+	// profiles holds the agents of the profiles the orchestrator delegated
+	// to, by name
+	profiles map[string]*Agent
+
+	// recorder writes the session transcript, if set
+	recorder *transcript.Recorder
+
+	// planStepTools holds the tools allowed for the running plan step; nil
+	// outside of plans
+	planStepTools map[string]bool
+
+	// guard screens input, tool calls and answers; nil without guardrails
+	guard *guardrails.Guard
+
+	// tracer records turns, provider calls and tool executions as spans
+	tracer trace.Tracer
+
+	// critiqueMode has a reviewer check final answers: off, note or revise
+	critiqueMode string
+
+	// attachments holds the files queued with /attach for the next message
+	attachments []string
+
+	// budget enforces the token budgets; onBudgetExceeded asks whether to
+	// go past one
+	budget           *budget
+	onBudgetExceeded BudgetPromptFunc
+
+	// titles generates conversation titles in the background
+	titles titler
+
+	// persona is the persona of the conversation (/persona), "" for none,
+	// and personaConfig its settings
+	persona       string
+	personaConfig config.PersonaConfig
+
+	// lastResult is the metadata of the last turn answered, for /stats
+	lastResult *ChatResult
+	// showUsage prints lastResult dimmed after each REPL answer; /usage
+	// toggles it
+	showUsage bool
 }
 
 // New creates a new agent instance
 func New(cfg *config.Config) (*Agent, error) {
+	return NewWithProvider(cfg, nil)
+}
+
+// NewWithProvider creates an agent that uses provider instead of the
+// configured one, such as a scripted fake in tests. A nil provider is
+// created from the config.
+func NewWithProvider(cfg *config.Config, provider llm.Provider) (*Agent, error) {
 	log := logger.L().With("component", "agent")
 
 	// Initialize logger with config
@@ -67,30 +184,52 @@ func New(cfg *config.Config) (*Agent, error) {
 	if err != nil {
 		return nil, fmt.Errorf("initializing storage: %w", err)
 	}
+	store.SetIntegrityKey(cfg.Storage.IntegrityKey)
 	log.Debug("storage initialized")
 
-	// Initialize LLM provider
-	provider, err := llm.New(llm.ProviderConfig{
-		Type:    cfg.Provider.Type,
-		BaseURL: cfg.Provider.BaseURL,
-		APIKey:  cfg.Provider.APIKey,
-		Model:   cfg.Provider.Model,
-	})
+	// Initialize outbound network policy
+	netPolicy, err := NewNetworkPolicy(cfg.Network)
 	if err != nil {
-		return nil, fmt.Errorf("initializing provider: %w", err)
+		return nil, fmt.Errorf("initializing network policy: %w", err)
+	}
+
+	// Initialize LLM provider
+	if provider == nil {
+		if err := cfg.ValidateProvider(); err != nil {
+			return nil, err
+		}
+		provider, err = llm.New(providerConfig(cfg, netPolicy))
+		if err != nil {
+			return nil, fmt.Errorf("initializing provider: %w", err)
+		}
+		log.Info("LLM provider initialized", "type", cfg.Provider.Type, "model", cfg.Provider.Model)
 	}
-	log.Info("LLM provider initialized", "type", cfg.Provider.Type, "model", cfg.Provider.Model)
 
 	// Initialize memory manager
+	summarizeWhen := cfg.Context.SummarizeWhen
+	if cfg.Memory.SummarizeWhen > 0 {
+		summarizeWhen = cfg.Memory.SummarizeWhen
+	}
 	memMgr := memory.NewManager(store, provider,
 		cfg.Context.MaxMessages,
 		cfg.Context.MaxTokens,
-		cfg.Context.SummarizeWhen,
+		summarizeWhen,
 	)
+	memMgr.SetSummarization(memory.Summarization{
+		KeepMessages:     cfg.Memory.KeepMessages,
+		SummaryPrompt:    cfg.Memory.SummaryPrompt,
+		SummaryMaxTokens: cfg.Memory.SummaryMaxTokens,
+		AbstractPrompt:   cfg.Memory.AbstractPrompt,
+		ExtractMemories:  cfg.Memory.ExtractMemories,
+		ExtractPrompt:    cfg.Memory.ExtractPrompt,
+	})
+	memMgr.SetScoring(cfg.Memory.ScoreImportance, cfg.Memory.ScorePrompt)
+	memMgr.SetRetrieval(cfg.Context.MemoryTopK, cfg.Context.MemoryMinSimilarity,
+		cfg.Provider.Type+"/"+cfg.Provider.EmbeddingModel)
 	log.Debug("memory manager initialized",
 		"max_messages", cfg.Context.MaxMessages,
 		"max_tokens", cfg.Context.MaxTokens,
-		"summarize_when", cfg.Context.SummarizeWhen,
+		"summarize_when", summarizeWhen,
 	)
 
 	// Initialize skill registry
@@ -108,64 +247,239 @@ func New(cfg *config.Config) (*Agent, error) {
 	// Initialize tools registry
 	toolRegistry := tools.NewRegistry()
 	toolRegistry.SetStorage(store) // Enable memory tools
+	if cfg.Memory.ScoreImportance {
+		toolRegistry.SetMemoryScorer(memMgr.ScoreMemory)
+	}
+	toolRegistry.SetNetworkPolicy(netPolicy)
+	if err := toolRegistry.SetSearch(tools.SearchConfig{
+		Backend:    cfg.Search.Backend,
+		URL:        cfg.Search.URL,
+		APIKey:     cfg.Search.APIKey,
+		MaxResults: cfg.Search.MaxResults,
+	}); err != nil {
+		return nil, fmt.Errorf("configuring web search: %w", err)
+	}
+	if err := toolRegistry.SetCodeRunner(tools.CodeConfig{
+		Backend:    cfg.Code.Backend,
+		Image:      cfg.Code.Image,
+		Timeout:    cfg.Code.Timeout,
+		CPUSeconds: cfg.Code.CPUSeconds,
+		MemoryMB:   cfg.Code.MemoryMB,
+	}); err != nil {
+		return nil, fmt.Errorf("configuring code runner: %w", err)
+	}
+	if err := toolRegistry.SetSSH(tools.SSHConfig{
+		Hosts:          cfg.SSH.Hosts,
+		User:           cfg.SSH.User,
+		IdentityFiles:  cfg.SSH.IdentityFiles,
+		KnownHostsFile: cfg.SSH.KnownHostsFile,
+		Timeout:        cfg.SSH.Timeout,
+	}); err != nil {
+		return nil, fmt.Errorf("configuring ssh: %w", err)
+	}
+	custom := make([]tools.CustomTool, len(cfg.Tools.Custom))
+	for i, t := range cfg.Tools.Custom {
+		params := make([]tools.CustomParam, len(t.Parameters))
+		for j, p := range t.Parameters {
+			params[j] = tools.CustomParam{
+				Name:        p.Name,
+				Type:        p.Type,
+				Description: p.Description,
+				Required:    p.Required,
+				Enum:        p.Enum,
+				Default:     p.Default,
+			}
+		}
+		custom[i] = tools.CustomTool{
+			Name:        t.Name,
+			Namespace:   t.Namespace,
+			Description: t.Description,
+			Parameters:  params,
+			Command:     t.Command,
+			Timeout:     t.Timeout,
+		}
+	}
+	if err := toolRegistry.RegisterCustomTools(custom); err != nil {
+		return nil, fmt.Errorf("configuring custom tools: %w", err)
+	}
+	if err := toolRegistry.LoadPlugins(filepath.Join(cfg.Storage.WorkDir, "tools")); err != nil {
+		return nil, fmt.Errorf("loading tool plugins: %w", err)
+	}
+	if err := toolRegistry.SetAliases(cfg.Tools.Aliases); err != nil {
+		return nil, err
+	}
+	limits := make(map[string]tools.ToolLimits, len(cfg.Tools.Limits))
+	for name, l := range cfg.Tools.Limits {
+		limits[name] = tools.ToolLimits{Timeout: l.Timeout, MaxTimeout: l.MaxTimeout, MaxOutput: l.MaxOutput}
+	}
+	if err := toolRegistry.SetLimits(limits); err != nil {
+		return nil, fmt.Errorf("configuring tool limits: %w", err)
+	}
+	if err := toolRegistry.Restrict(cfg.Tools.Enabled, cfg.Tools.Disabled); err != nil {
+		return nil, fmt.Errorf("restricting tools: %w", err)
+	}
 	log.Debug("tools registry initialized", "tool_count", len(toolRegistry.List()))
+	policy, err := newToolPolicy(cfg.Tools.Confirm)
+	if err != nil {
+		return nil, err
+	}
+	guard, err := NewGuard(cfg.Guardrails)
+	if err != nil {
+		return nil, fmt.Errorf("initializing guardrails: %w", err)
+	}
+	critiqueMode, err := ParseCritiqueMode(cfg.Agent.Critique)
+	if err != nil {
+		return nil, fmt.Errorf("agent.critique: %w", err)
+	}
 
 	log.Info("agent ready", "name", cfg.Agent.Name)
 
-	return &Agent{
-		config:   cfg,
-		provider: provider,
-		store:    store,
-		memory:   memMgr,
-		skills:   skillRegistry,
-		tools:    toolRegistry,
-		log:      log,
-	}, nil
+	a := &Agent{
+		config:    cfg,
+		provider:  provider,
+		model:     cfg.Provider.Model,
+		store:     store,
+		memory:    memMgr,
+		skills:    skillRegistry,
+		tools:     toolRegistry,
+		policy:    policy,
+		netPolicy: netPolicy,
+		style:     styleFromConfig(cfg.Agent),
+		showUsage: cfg.Agent.ShowUsage,
+		log:       log,
+		guard:     guard,
+		tracer:    tracing.Tracer(),
+
+		critiqueMode: critiqueMode,
+
+		promptFiles: newPromptFiles(cfg.Agent.SystemPromptFiles, log),
+		sched:       sched.Default,
+		priority:    sched.Interactive,
+		onWarning: func(msg string) {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+		},
+		notices: os.Stderr,
+	}
+	a.quota = newQuota(cfg, store, log)
+	if a.budget, err = newBudget(cfg, store, a.quota.userSubject(), log); err != nil {
+		return nil, err
+	}
+	a.guard.SetModerator(a.moderate)
+	a.sched.SetLimit(schedKey(cfg), cfg.Provider.MaxConcurrent)
+
+	// Summaries, extraction and compression are metered like the turns,
+	// as background work
+	memMgr.SetProvider(a.metered(provider, cfg.Provider.Model, "", sched.Batch))
+	if err := a.configureCompression(netPolicy); err != nil {
+		return nil, err
+	}
+	return a, nil
 }
 
 // SetToolConfirmation sets the callback function for tool confirmation
 func (a *Agent) SetToolConfirmation(fn ToolConfirmationFunc) {
+	if fn == nil {
+		a.onToolConfirm = nil
+		return
+	}
+	a.onToolConfirm = func(call *tools.ToolCall) ToolAnswer {
+		if fn(call) {
+			return ToolAnswerYes
+		}
+		return ToolAnswerNo
+	}
+}
+
+// SetToolPrompt sets the prompt asking about tool calls that need
+// confirmation; it may allow a tool for the rest of the session
+func (a *Agent) SetToolPrompt(fn ToolPromptFunc) {
 	a.onToolConfirm = fn
 }
 
+// ResetToolSession forgets the tools allowed with "always" and those
+// disabled with /tools disable, and ends the shell sessions, so a new
+// session starts with the configured rules and fresh shells, such as the
+// next client of igent daemon
+func (a *Agent) ResetToolSession() {
+	a.policy.resetSession()
+	a.tools.CloseSessions()
+	for _, p := range a.profiles {
+		p.tools.CloseSessions()
+	}
+}
+
+// Close waits for the conversation titles being generated and ends the
+// shell sessions of the agent and its profile agents. Call it when done
+// with the agent.
+func (a *Agent) Close() {
+	a.WaitTitles()
+	a.tools.CloseSessions()
+	for _, p := range a.profiles {
+		p.Close()
+	}
+}
+
+// SetWarningHandler sets where warnings for the user, such as quotas
+// nearly used, go instead of stderr
+func (a *Agent) SetWarningHandler(fn func(string)) {
+	a.onWarning = fn
+}
+
+// SetNotices sets where reports besides the answer, such as the
+// delegations of an orchestrated request, go instead of stderr
+func (a *Agent) SetNotices(w io.Writer) {
+	a.notices = w
+}
+
+// ToolStatusFunc receives a tool call when it starts, with a nil result,
+// and again with its result when it finishes. Calls of one turn may run in
+// parallel.
+type ToolStatusFunc func(call *tools.ToolCall, result *tools.ToolResult)
+
+// SetToolStatusHandler sets where tool calls are reported as they start
+// and finish, such as the status line of igent tui
+func (a *Agent) SetToolStatusHandler(fn ToolStatusFunc) {
+	a.onToolStatus = fn
+}
+
 // FormatToolCall formats a tool call for display, showing the exact command/payload
 func FormatToolCall(call *tools.ToolCall) string {
 	var sb strings.Builder
 
-	sb.WriteString(fmt.Sprintf("\n\033[1;33m━━━ Tool Call ━━━\033[0m\n"))
-	sb.WriteString(fmt.Sprintf("\033[1;36mTool:\033[0m %s\n", call.Name))
+	sb.WriteString("\n" + theme.Heading.Render("━━━ Tool Call ━━━") + "\n")
+	sb.WriteString(fmt.Sprintf("%s %s\n", theme.Label.Render("Tool:"), call.Name))
 
 	// Format arguments nicely
 	if len(call.Args) > 0 {
-		sb.WriteString("\033[1;36mPayload:\033[0m\n")
+		sb.WriteString(theme.Label.Render("Payload:") + "\n")
 		for key, val := range call.Args {
 			sb.WriteString(fmt.Sprintf("  %s: %v\n", key, val))
 		}
 	}
 
-	// For shell tool, show the actual command prominently
-	if call.Name == "shell" {
+	// For shell tools, show the actual command prominently
+	if call.Name == "shell" || call.Name == "shell_session" {
 		if cmd, ok := call.Args["command"].(string); ok {
-			sb.WriteString(fmt.Sprintf("\n\033[1;32m▶ Executing:\033[0m %s\n", cmd))
+			sb.WriteString(fmt.Sprintf("\n%s %s\n", theme.Command.Render("▶ Executing:"), cmd))
 		}
 	}
 
 	return sb.String()
 }
 
-// DefaultToolConfirmation is the default confirmation function for interactive mode
-func DefaultToolConfirmation(call *tools.ToolCall) bool {
-	fmt.Print(FormatToolCall(call))
-	fmt.Print("\033[1;33mAllow execution? [y/N]: \033[0m")
+// DefaultToolConfirmation is the default confirmation prompt; "a" allows
+// the tool for the rest of the session. It asks on stderr, keeping stdout
+// for the answer.
+func DefaultToolConfirmation(call *tools.ToolCall) ToolAnswer {
+	fmt.Fprint(os.Stderr, FormatToolCall(call))
+	fmt.Fprint(os.Stderr, theme.Prompt.Render("Allow execution? [y/N/a=always]: "))
 
 	reader := bufio.NewReader(os.Stdin)
 	response, err := reader.ReadString('\n')
 	if err != nil {
-		return false
+		return ToolAnswerNo
 	}
-
-	response = strings.TrimSpace(strings.ToLower(response))
-	return response == "y" || response == "yes"
+	return parseToolAnswer(response)
 }
 
 // SetConversation sets or creates a conversation
@@ -175,9 +489,10 @@ func (a *Agent) SetConversation(id string) error {
 	}
 
 	a.conversationID = id
+	a.conversationPrompt = ""
 
 	// Check if conversation exists, create if not
-	_, err := a.store.LoadConversation(id)
+	conv, err := a.store.LoadConversation(id)
 	if err == storage.ErrNotFound {
 		a.log.Info("creating new conversation", "id", id)
 		conv := &storage.Conversation{
@@ -186,19 +501,20 @@ func (a *Agent) SetConversation(id string) error {
 			UpdatedAt: time.Now(),
 			Messages:  []llm.Message{},
 		}
-		if err := a.store.SaveConversation(conv); err != nil {
+		if err := a.saveConversation(conv); err != nil {
 			return err
 		}
 		a.log.Debug("conversation created", "id", id)
-		return nil
+		return a.restorePersona("")
 	}
 
 	if err != nil {
 		return err
 	}
 
+	a.conversationPrompt = conv.SystemPrompt
 	a.log.Debug("conversation loaded", "id", id)
-	return nil
+	return a.restorePersona(conv.Persona)
 }
 
 // buildSystemPrompt constructs the system prompt with dynamic information
@@ -207,6 +523,15 @@ func (a *Agent) buildSystemPrompt() string {
 	dateTime := now.Format("Monday, January 2, 2006 at 3:04 PM MST")
 
 	prompt := a.config.Agent.SystemPrompt
+	if a.personaConfig.SystemPrompt != "" {
+		prompt = a.personaConfig.SystemPrompt
+	}
+	if a.conversationPrompt != "" {
+		prompt = a.conversationPrompt
+	}
+	if files := a.promptFiles.text(); files != "" {
+		prompt += "\n\n" + files
+	}
 	prompt += fmt.Sprintf("\n\nCurrent date and time: %s", dateTime)
 
 	// Add memory management instructions
@@ -222,11 +547,13 @@ You have access to persistent memory. You are responsible for managing it using
 - memory_search: Find memories by keyword
 - memory_update: Update existing memories
 - memory_delete: Remove memories
+- memory_graph: Track people, projects and systems with their attributes and relations
 
 ### When to Use Memory
 - Store important facts about the user (name, preferences, context)
 - Remember user preferences (coding style, communication style, etc.)
 - Keep track of ongoing projects or tasks
+- Record the people, projects and systems the user works with, and how they relate, in memory_graph
 - Remember decisions made in previous conversations
 
 ### When to Update Memory
@@ -241,36 +568,107 @@ You have access to persistent memory. You are responsible for managing it using
 
 Be selective - not everything needs to be remembered. Focus on information that will be useful in future conversations.`
 
+	prompt += a.documentPromptSection()
+	prompt += a.style.promptSection()
+
 	a.log.Debug("system prompt built", "datetime", dateTime)
 
 	return prompt
 }
 
-// Chat sends a message and returns the response
-func (a *Agent) Chat(ctx context.Context, userInput string) (string, error) {
+// Chat sends a message and returns the answer with the turn's metadata
+func (a *Agent) Chat(ctx context.Context, userInput string) (*ChatResult, error) {
 	return a.ChatStream(ctx, userInput, nil)
 }
 
-// ChatStream sends a message and streams the response
-func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(string)) (string, error) {
+// ChatStream sends a message, streams the answer to onChunk and returns it
+// with the turn's metadata
+func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(string)) (*ChatResult, error) {
+	ctx, span := a.tracer.Start(ctx, "igent.chat", trace.WithAttributes(attrConversation.String(a.conversationID)))
+	start := time.Now()
+	result, err := a.chatStream(ctx, userInput, onChunk)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	result.Duration = time.Since(start)
+	result.Cost = a.pricing(result.Model).Cost(result.PromptTokens, result.OutputTokens)
+	a.lastResult = result
+	a.log.Info("turn finished",
+		"model", result.Model,
+		"tokens", result.TotalTokens,
+		"tool_calls", len(result.ToolCalls),
+		"finish_reason", result.FinishReason,
+		"duration_ms", result.Duration.Milliseconds(),
+	)
+	return result, nil
+}
+
+func (a *Agent) chatStream(ctx context.Context, userInput string, onChunk func(string)) (*ChatResult, error) {
 	a.log.Debug("chat request started", "input_length", len(userInput))
 
 	// Load current conversation
 	conv, err := a.store.LoadConversation(a.conversationID)
 	if err != nil {
-		return "", fmt.Errorf("loading conversation: %w", err)
+		return nil, fmt.Errorf("loading conversation: %w", err)
+	}
+
+	// The model and the conversation only get input the guardrails let through
+	userInput, err = a.screenInput(ctx, userInput)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span := a.tracer.Start(ctx, "igent.build_context")
+	fullMessages, err := a.buildTurnMessages(conv, userInput)
+	span.SetAttributes(attribute.Int("igent.context_messages", len(fullMessages)))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tools learn which conversation and turn they run in
+	turn := countUserMessages(conv.Messages) + 1
+	ctx = tools.WithConversation(ctx, a.conversationID, turn)
+	trace.SpanFromContext(ctx).SetAttributes(attrTurn.Int(turn))
+
+	a.tee.prompt(userInput)
+	recorded := a.recordTurn(userInput, false)
+	result, loop, err := a.runLoop(ctx, fullMessages, turn, maxChatIterations, onChunk, loopHooks{})
+	if err != nil {
+		recorded("", err)
+		a.savePartial(conv, userInput, "", err)
+		return nil, err
 	}
+	recorded(result.Content, nil)
 
+	_, span = a.tracer.Start(ctx, "igent.save_turn")
+	records := len(conv.ToolCalls)
+	err = a.finishTurn(conv, userInput, result.Content, turn, loop)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+	result.ToolCalls = conv.ToolCalls[records:]
+	return result, nil
+}
+
+// maxChatIterations bounds the agentic loop of an interactive turn
+const maxChatIterations = 10
+
+// buildTurnMessages builds the system prompt, optimized history and user
+// message that start a turn
+func (a *Agent) buildTurnMessages(conv *storage.Conversation, userInput string) ([]llm.Message, error) {
 	// Build context with memory optimization
 	messages, err := a.memory.BuildContext(conv, userInput)
 	if err != nil {
-		return "", fmt.Errorf("building context: %w", err)
+		return nil, fmt.Errorf("building context: %w", err)
 	}
 	a.log.Debug("context built", "message_count", len(messages))
 
 	// Build system prompt with current date/time
 	systemPrompt := a.buildSystemPrompt()
-	systemPrompt = a.skills.EnhancePrompt(userInput, systemPrompt)
+	systemPrompt = a.skills.EnhancePrompt(userInput, systemPrompt, a.personaConfig.Skills...)
 	a.log.Debug("prompt enhanced with skills")
 
 	fullMessages := []llm.Message{{Role: "system", Content: systemPrompt}}
@@ -278,33 +676,76 @@ func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(s
 
 	// Add user message
 	fullMessages = append(fullMessages, llm.Message{Role: "user", Content: userInput})
+	return fullMessages, nil
+}
+
+// loopHooks let callers observe the agentic loop; a hook returning an error
+// stops the loop with that error
+type loopHooks struct {
+	// onResponse is called with every LLM response, before its tools run
+	onResponse func(resp *llm.Response) error
 
+	// afterTools is called once the tool results were added to messages
+	afterTools func(messages []llm.Message, results []llm.Message) error
+}
+
+// runLoop calls the LLM and executes tool calls until it answers without
+// tools. It returns the final response with its usage and the loop
+// messages.
+func (a *Agent) runLoop(ctx context.Context, fullMessages []llm.Message, turn, maxIterations int, onChunk func(string), hooks loopHooks) (*ChatResult, []llm.Message, error) {
 	// Build tool definitions
 	toolDefs := a.buildToolDefinitions()
 	a.log.Debug("tools prepared", "tool_count", len(toolDefs))
 
 	// Agentic loop: keep calling LLM until we get a text response
-	maxIterations := 10
 	iteration := 0
 	var response string
 	var toolCallsMade []llm.ToolCall
+	answered := false
 
 	startTime := time.Now()
+	result := &ChatResult{Model: a.model}
+	a.budget.startTurn()
+
+	// Answers the guardrails screen or the reviewer may revise are shown
+	// once final, not as they stream
+	streamChunk := onChunk
+	screened := a.guard.ScreensOutput()
+	buffered := screened || a.critiqueMode == CritiqueRevise
+	if buffered {
+		streamChunk = nil
+	}
 
 	for iteration < maxIterations {
 		iteration++
 		a.log.Debug("agent loop iteration", "iteration", iteration)
 
+		// Stop before a call that would go past a token budget
+		if err := a.checkBudget(result.TotalTokens); err != nil {
+			return nil, fullMessages, err
+		}
+
 		// Get response from LLM with tools
-		opts := &llm.CompleteOptions{Tools: toolDefs}
-		resp, err := a.provider.CompleteWithOptions(ctx, fullMessages, opts)
+		opts := &llm.CompleteOptions{Tools: toolDefs, MaxTokens: a.style.MaxTokens, CacheKey: a.conversationID, Temperature: a.temperature}
+		resp, err := a.complete(ctx, fullMessages, opts, streamChunk)
+		if err == nil {
+			resp, err = a.checkFinish(ctx, fullMessages, resp, opts, streamChunk)
+		}
 		if err != nil {
-			return "", fmt.Errorf("LLM completion: %w", err)
+			return nil, fullMessages, fmt.Errorf("LLM completion: %w", err)
+		}
+		result.add(resp)
+
+		if hooks.onResponse != nil {
+			if err := hooks.onResponse(resp); err != nil {
+				return nil, fullMessages, err
+			}
 		}
 
 		// If no tool calls, we have our final response
 		if !resp.HasToolCalls() {
 			response = resp.Content
+			answered = true
 			break
 		}
 
@@ -312,6 +753,9 @@ func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(s
 		a.log.Info("processing tool calls", "count", len(resp.ToolCalls))
 		toolCallsMade = resp.ToolCalls
 
+		// Compress results of earlier iterations before adding this one
+		fullMessages = a.compressToolHistory(fullMessages, len(fullMessages), turn)
+
 		// Add assistant message with tool calls to conversation
 		fullMessages = append(fullMessages, llm.Message{
 			Role:      "assistant",
@@ -319,35 +763,343 @@ func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(s
 			ToolCalls: resp.ToolCalls,
 		})
 
-		// Execute each tool and add result to messages
-		for _, tc := range resp.ToolCalls {
+		// Execute tools and add results to messages in call order
+		toolMessages, err := a.executeToolCalls(ctx, resp.ToolCalls)
+		if err != nil {
+			return nil, fullMessages[:len(fullMessages)-1], err
+		}
+		fullMessages = append(fullMessages, toolMessages...)
+
+		// Stop if the turn was cancelled while tools were running
+		if err := ctx.Err(); err != nil {
+			return nil, fullMessages, err
+		}
+
+		if hooks.afterTools != nil {
+			if err := hooks.afterTools(fullMessages, toolMessages); err != nil {
+				return nil, fullMessages, err
+			}
+		}
+	}
+
+	if !answered {
+		return nil, fullMessages, fmt.Errorf("%w (%d)", errMaxIterations, maxIterations)
+	}
+
+	duration := time.Since(startTime)
+	a.log.Info("chat completed",
+		"response_length", len(response),
+		"iterations", iteration,
+		"tool_calls", len(toolCallsMade),
+		"cached_tokens", result.CachedTokens,
+		"duration_ms", duration.Milliseconds(),
+	)
+
+	draft := response
+	response = a.reviewAnswer(ctx, fullMessages, response)
+	if screened {
+		var err error
+		if response, err = a.screenOutput(ctx, response); err != nil {
+			return nil, fullMessages, err
+		}
+	}
+
+	// Send the full response if it was not streamed, or the review note
+	// that follows the streamed answer
+	_, streamed := a.provider.(llm.StreamingProvider)
+	switch {
+	case onChunk == nil || response == "":
+	case buffered || !streamed:
+		onChunk(response)
+	case len(response) > len(draft) && strings.HasPrefix(response, draft):
+		onChunk(response[len(draft):])
+	}
+
+	result.Content = response
+	result.Iterations = iteration
+	return result, fullMessages, nil
+}
+
+// errMaxIterations is returned when the loop runs out of iterations
+var errMaxIterations = errors.New("max tool iterations reached")
+
+// finishTurn saves the turn to the conversation: the user input, the
+// assistant's tool calls with their results, and the final response, plus
+// records of the tool calls for exports
+func (a *Agent) finishTurn(conv *storage.Conversation, userInput, response string, turn int, loop []llm.Message) error {
+	activity := turnActivity(loop)
+	first := len(conv.Messages) + 1 // Index of the turn's first message after the input
+	conv.ToolCalls = append(conv.ToolCalls, toolRecords(activity, first)...)
+
+	conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: userInput})
+	for _, m := range activity {
+		if m.Role == "tool" {
+			m.Content = truncateToolOutput(m.Content)
+		}
+		conv.Messages = append(conv.Messages, m)
+	}
+	conv.Messages = append(conv.Messages, llm.Message{Role: "assistant", Content: response})
+	conv.Partial = nil
+
+	if err := a.saveConversation(conv); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	a.log.Debug("conversation saved", "total_messages", len(conv.Messages))
+	a.titleConversation(conv, userInput, response)
+
+	if a.config.Storage.AutoArtifacts {
+		a.saveResponseArtifacts(response, turn)
+	}
+	return nil
+}
+
+// turnActivity returns the assistant tool calls and tool results of a turn:
+// the loop messages after its last user message, which is the turn's input
+// (or the request to continue a partial answer)
+func turnActivity(loop []llm.Message) []llm.Message {
+	for i := len(loop) - 1; i >= 0; i-- {
+		if loop[i].Role == "user" {
+			return loop[i+1:]
+		}
+	}
+	return nil
+}
+
+// truncateToolOutput caps a tool result kept in the conversation history
+func truncateToolOutput(output string) string {
+	if len(output) > storage.ToolRecordMaxOutput {
+		return truncateRunes(output, storage.ToolRecordMaxOutput) + "\n... (truncated)"
+	}
+	return output
+}
+
+// toolRecords extracts the tool calls of a turn's activity and their
+// results. first is the index the activity starts at in the conversation;
+// each record points at the assistant message that made the call.
+func toolRecords(activity []llm.Message, first int) []storage.ToolRecord {
+	results := make(map[string]string)
+	for _, m := range activity {
+		if m.Role == "tool" {
+			results[m.ToolCallID] = m.Content
+		}
+	}
+
+	var records []storage.ToolRecord
+	for i, m := range activity {
+		for _, tc := range m.ToolCalls {
 			if tc.Function == nil {
 				continue
 			}
+			output := results[tc.ID]
+			records = append(records, storage.ToolRecord{
+				Message: first + i,
+				Name:    tc.Function.Name,
+				Args:    tc.Function.Arguments,
+				Output:  truncateToolOutput(output),
+				Error:   strings.HasPrefix(output, "Error"),
+			})
+		}
+	}
+	return records
+}
 
-			// Parse tool call
-			call, err := tools.ParseToolCall(tc.ID, tc.Function.Name, tc.Function.Arguments)
-			if err != nil {
-				a.log.Error("failed to parse tool call", "error", err)
-				fullMessages = append(fullMessages, llm.Message{
-					Role:       "tool",
-					ToolCallID: tc.ID,
-					Name:       tc.Function.Name,
-					Content:    fmt.Sprintf("Error parsing tool arguments: %v", err),
-				})
-				continue
+// countUserMessages counts the user turns of a conversation
+func countUserMessages(messages []llm.Message) int {
+	n := 0
+	for _, m := range messages {
+		if m.Role == "user" {
+			n++
+		}
+	}
+	return n
+}
+
+// complete requests one completion, streaming it to onChunk when the
+// provider supports streaming
+func (a *Agent) complete(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions, onChunk func(string)) (resp *llm.Response, err error) {
+	ctx, span := a.startProviderSpan(ctx, a.model, opts)
+	defer func() { endProviderSpan(span, resp, err) }()
+
+	if err := a.quota.check(time.Now(), a.onWarning); err != nil {
+		return nil, err
+	}
+	release, err := a.acquireProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	span.AddEvent("provider slot acquired")
+	resp, err = a.completeOnce(ctx, messages, opts, onChunk)
+	if err == nil {
+		a.quota.record(time.Now(), resp, a.conversationID, a.pricing(a.model))
+	}
+	return resp, err
+}
+
+// SetPriority sets the priority of the agent's provider calls when they
+// queue behind the provider's concurrency cap (default: interactive)
+func (a *Agent) SetPriority(p sched.Priority) {
+	a.priority = p
+}
+
+// QueueStats returns the queue-time metrics of provider calls by priority
+func (a *Agent) QueueStats() map[sched.Priority]sched.Stats {
+	return a.sched.Stats()
+}
+
+// acquireProvider waits for a provider slot and returns the function that
+// frees it
+func (a *Agent) acquireProvider(ctx context.Context) (func(), error) {
+	start := time.Now()
+	release, err := a.sched.Acquire(ctx, schedKey(a.config), a.priority)
+	if err != nil {
+		return nil, err
+	}
+	if wait := time.Since(start); wait > 100*time.Millisecond {
+		a.log.Debug("queued for provider", "priority", a.priority, "wait_ms", wait.Milliseconds())
+	}
+	return release, nil
+}
+
+// schedKey identifies the provider account whose concurrency cap a call
+// counts against
+func schedKey(cfg *config.Config) string {
+	return cfg.Provider.Type + " " + cfg.Provider.BaseURL
+}
+
+// completeOnce makes one provider call, streaming when possible
+func (a *Agent) completeOnce(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions, onChunk func(string)) (*llm.Response, error) {
+	sp, ok := a.provider.(llm.StreamingProvider)
+	if !ok || onChunk == nil {
+		resp, err := a.provider.CompleteWithOptions(ctx, messages, opts)
+		if err == nil {
+			a.tee.write(resp.Content)
+		}
+		return resp, err
+	}
+
+	// Keep what was streamed so a response cut off by a network error or
+	// interrupted with Ctrl+C can be continued instead of regenerated
+	var streamed strings.Builder
+	resp, err := sp.CompleteStream(ctx, messages, opts, llm.StreamHandler{
+		OnContent: a.tee.wrap(func(chunk string) {
+			streamed.WriteString(chunk)
+			onChunk(chunk)
+		}),
+		OnReasoning: a.onReasoning,
+	})
+	if err != nil && streamed.Len() > 0 {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, &PartialResponseError{Partial: streamed.String(), Err: err}
+	}
+	return resp, err
+}
+
+// executeToolCalls runs the tool calls of a single response on a bounded worker
+// pool and returns the resulting tool messages in the order the calls were made.
+// Parsing and confirmation happen sequentially up front so prompts never interleave.
+func (a *Agent) executeToolCalls(ctx context.Context, toolCalls []llm.ToolCall) ([]llm.Message, error) {
+	messages := make([]llm.Message, len(toolCalls))
+	calls := make([]*tools.ToolCall, len(toolCalls))
+
+	for i, tc := range toolCalls {
+		if tc.Function == nil {
+			continue
+		}
+
+		// Parse tool call
+		call, err := tools.ParseToolCall(tc.ID, tc.Function.Name, tc.Function.Arguments)
+		if err != nil {
+			a.log.Error("failed to parse tool call", "error", err)
+			messages[i] = llm.Message{
+				Role:       "tool",
+				ToolCallID: tc.ID,
+				Name:       tc.Function.Name,
+				Content:    fmt.Sprintf("Error parsing tool arguments: %v", err),
+			}
+			continue
+		}
+		// Providers call namespaced tools by their wire name
+		if name := a.tools.Resolve(call.Name); name != "" {
+			call.Name = name
+		}
+
+		// Guardrails stop tool calls before the policy or the user is asked
+		if err := a.screenToolCall(ctx, call); err != nil {
+			messages[i] = llm.Message{
+				Role:       "tool",
+				ToolCallID: tc.ID,
+				Name:       tc.Function.Name,
+				Content:    fmt.Sprintf("Error: %v", err),
 			}
+			continue
+		}
 
-			// Request confirmation before execution (skip for safe tools)
-			if a.onToolConfirm != nil && !a.tools.IsSafeTool(call.Name) {
-				if !a.onToolConfirm(call) {
-					// User denied execution - stop and return to input
-					return "", ErrToolDenied
+		// Apply the confirmation policy before execution
+		switch a.planToolDecision(call.Name, a.policy.decide(call.Name, a.tools.IsSafeTool(call.Name))) {
+		case toolDeny:
+			a.log.Info("tool denied by policy", "tool", call.Name)
+			reason := "is not allowed by the tool policy (tools.confirm)"
+			if a.policy.disabled(call.Name) {
+				reason = "was disabled by the user for this session"
+			}
+			messages[i] = llm.Message{
+				Role:       "tool",
+				ToolCallID: tc.ID,
+				Name:       tc.Function.Name,
+				Content:    fmt.Sprintf("Error: %s %s", call.Name, reason),
+			}
+			continue
+		case toolAsk:
+			if a.onToolConfirm == nil {
+				break
+			}
+			switch a.onToolConfirm(call) {
+			case ToolAnswerAlways:
+				if a.planStepTools != nil {
+					a.planStepTools[call.Name] = true
+				} else {
+					a.policy.allowForSession(call.Name)
 				}
+			case ToolAnswerYes:
+			default:
+				// User denied execution - stop and return to input
+				return nil, ErrToolDenied
 			}
+		}
+
+		calls[i] = call
+		a.tee.toolCall(call.Name, call.Args)
+		a.recorder.Record(transcript.Event{Type: transcript.EventToolCall, Tool: call.Name, CallID: call.ID, Args: call.Args})
+	}
+
+	sem := make(chan struct{}, maxParallelTools)
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		if call == nil {
+			continue
+		}
 
-			// Execute tool
-			result := a.tools.Execute(ctx, call)
+		wg.Add(1)
+		go func(i int, call *tools.ToolCall) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			callCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			if a.onToolOutput != nil {
+				callCtx = tools.WithOutput(callCtx, func(chunk string) { a.onToolOutput(call.Name, chunk) })
+			}
+
+			a.announceToolStart(call)
+			start := time.Now()
+			callCtx, span := a.startToolSpan(callCtx, call)
+			result := a.tools.Execute(callCtx, call)
+			endToolSpan(span, result)
+			a.announceToolEnd(call, result)
 
 			// Format result for LLM
 			var resultContent string
@@ -363,83 +1115,188 @@ func (a *Agent) ChatStream(ctx context.Context, userInput string, onChunk func(s
 				"output_length", len(resultContent),
 			)
 
-			// Add tool result to messages
-			fullMessages = append(fullMessages, llm.Message{
+			a.tee.toolResult(call.Name, resultContent)
+			a.recorder.Record(transcript.Event{
+				Type:       transcript.EventToolResult,
+				Tool:       call.Name,
+				CallID:     call.ID,
+				Output:     truncateToolOutput(resultContent),
+				DurationMS: time.Since(start).Milliseconds(),
+			})
+			messages[i] = llm.Message{
 				Role:       "tool",
-				ToolCallID: tc.ID,
-				Name:       tc.Function.Name,
+				ToolCallID: call.ID,
+				Name:       tools.WireName(call.Name),
 				Content:    resultContent,
-			})
-		}
+			}
+		}(i, call)
 	}
+	wg.Wait()
 
-	if iteration >= maxIterations {
-		return "", fmt.Errorf("max tool iterations reached (%d)", maxIterations)
+	// Drop slots of skipped calls (nil function)
+	result := make([]llm.Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Role != "" {
+			result = append(result, m)
+		}
 	}
+	return result, nil
+}
 
-	duration := time.Since(startTime)
-	a.log.Info("chat completed",
-		"response_length", len(response),
-		"iterations", iteration,
-		"tool_calls", len(toolCallsMade),
-		"duration_ms", duration.Milliseconds(),
-	)
+// configureCompression enables compression of retrieved snippets, creating
+// a separate provider when a cheaper compression model is configured
+func (a *Agent) configureCompression(netPolicy *netpolicy.Policy) error {
+	cfg := a.config
+	level, err := memory.ParseCompressionLevel(cfg.Context.CompressSnippets)
+	if err != nil {
+		return fmt.Errorf("context.compress_snippets: %w", err)
+	}
 
-	// Stream the response if callback provided
-	if onChunk != nil && response != "" {
-		// For streaming, we already have the full response, so send it in chunks
-		// In a real implementation, we might want to chunk this more naturally
-		onChunk(response)
+	provider, model := a.provider, cfg.Provider.Model
+	if level == memory.CompressLLM && cfg.Context.CompressModel != "" && cfg.Context.CompressModel != cfg.Provider.Model {
+		pc := providerConfig(cfg, netPolicy)
+		pc.Model = cfg.Context.CompressModel
+		model = pc.Model
+		if provider, err = llm.New(pc); err != nil {
+			return fmt.Errorf("initializing compression provider: %w", err)
+		}
 	}
 
-	// Save messages to conversation
-	// Note: We save the simplified version (user + assistant) for conversation history
-	// The tool call details are kept in the session but simplified for storage
-	conv.Messages = append(conv.Messages,
-		llm.Message{Role: "user", Content: userInput},
-		llm.Message{Role: "assistant", Content: response},
-	)
+	a.memory.SetCompression(level, a.metered(provider, model, "", sched.Batch))
+	return nil
+}
 
-	if err := a.store.SaveConversation(conv); err != nil {
-		return "", fmt.Errorf("saving conversation: %w", err)
+// providerConfig builds the LLM provider settings from config
+func providerConfig(cfg *config.Config, netPolicy *netpolicy.Policy) llm.ProviderConfig {
+	return llm.ProviderConfig{
+		Type:    cfg.Provider.Type,
+		BaseURL: cfg.Provider.BaseURL,
+		APIKey:  cfg.Provider.APIKey,
+		Model:   cfg.Provider.Model,
+
+		Proxy:              cfg.Provider.Proxy,
+		CACertFile:         cfg.Provider.CACertFile,
+		InsecureSkipVerify: cfg.Provider.InsecureSkipVerify,
+		NetPolicy:          netPolicy,
+
+		WebSearch:   cfg.Provider.WebSearch,
+		PromptCache: cfg.Provider.PromptCache,
+
+		Compat: llm.Compat{
+			Roles:                    cfg.Provider.Compat.Roles,
+			MergeToolResults:         cfg.Provider.Compat.MergeToolResults,
+			DisableParallelToolCalls: cfg.Provider.Compat.DisableParallelToolCalls,
+		},
+		EmbeddingModel: cfg.Provider.EmbeddingModel,
 	}
-	a.log.Debug("conversation saved", "total_messages", len(conv.Messages))
+}
 
-	return response, nil
+// NewNetworkPolicy creates the outbound network policy from config
+func NewNetworkPolicy(cfg config.NetworkConfig) (*netpolicy.Policy, error) {
+	certs := make([]netpolicy.ClientCert, len(cfg.ClientCerts))
+	for i, c := range cfg.ClientCerts {
+		certs[i] = netpolicy.ClientCert{Host: c.Host, CertFile: c.CertFile, KeyFile: c.KeyFile}
+	}
+	return netpolicy.New(netpolicy.Config{
+		AllowedHosts: cfg.AllowedHosts,
+		ClientCerts:  certs,
+		Audit:        cfg.Audit,
+	})
 }
 
 // buildToolDefinitions converts tool registry to LLM tool definitions
 func (a *Agent) buildToolDefinitions() []llm.ToolDefinition {
+	// Providers known not to accept tools get none
+	if preset, ok := llm.LookupPreset(a.config.Provider.Type); ok && !preset.SupportsTools {
+		return nil
+	}
+
 	toolList := a.tools.List()
-	defs := make([]llm.ToolDefinition, len(toolList))
+	defs := make([]llm.ToolDefinition, 0, len(toolList))
 
-	for i, t := range toolList {
-		defs[i] = llm.ToolDefinition{
+	for _, t := range toolList {
+		// Tools disabled for the session are not offered
+		if a.policy.disabled(t.Name) {
+			continue
+		}
+		defs = append(defs, llm.ToolDefinition{
 			Type: "function",
 			Function: &llm.ToolFunctionDef{
-				Name:        t.Name,
+				Name:        tools.WireName(t.Name),
 				Description: t.Description,
 				Parameters:  t.Parameters,
 			},
-		}
+		})
 	}
 
 	return defs
 }
 
+// Compact summarizes the older messages of the current conversation now,
+// instead of when it reaches the summarization threshold. extract also
+// saves facts from the summarized messages as memories.
+func (a *Agent) Compact(ctx context.Context, extract bool) (*memory.CompactResult, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("loading conversation: %w", err)
+	}
+	return a.memory.Compact(ctx, conv, extract)
+}
+
 // ListConversations returns all conversation IDs
 func (a *Agent) ListConversations() ([]string, error) {
 	return a.store.ListConversations()
 }
 
+// ConversationID returns the ID of the current conversation
+func (a *Agent) ConversationID() string {
+	return a.conversationID
+}
+
+// Transcript returns the messages of the current conversation shown to a
+// person, see storage.Transcript
+func (a *Agent) Transcript() ([]llm.Message, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Transcript(conv.Messages), nil
+}
+
 // DeleteConversation removes a conversation
 func (a *Agent) DeleteConversation(id string) error {
-	return a.store.DeleteConversation(id)
+	if err := a.store.DeleteConversation(id); err != nil {
+		return err
+	}
+	if err := a.deleteScopedMemories(id); err != nil {
+		return err
+	}
+	if err := a.deleteHistory(id); err != nil {
+		return err
+	}
+	return a.store.DeleteDocument(id)
 }
 
-// AddMemory adds a new memory
-func (a *Agent) AddMemory(content, memType string) error {
-	return a.memory.AddMemory(content, memType)
+// deleteScopedMemories removes the memories that belong to a conversation
+func (a *Agent) deleteScopedMemories(id string) error {
+	memories, err := a.store.LoadMemories()
+	if err != nil {
+		return err
+	}
+	for _, m := range memories {
+		if m.Scope == id {
+			if err := a.store.DeleteMemory(m.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AddMemory adds a new memory, global when scope is empty or belonging to
+// the conversation scope otherwise
+func (a *Agent) AddMemory(content, memType, scope string, tags ...string) error {
+	return a.memory.AddMemory(content, memType, scope, tags...)
 }
 
 // ListMemories returns all memories
@@ -447,6 +1304,28 @@ func (a *Agent) ListMemories() ([]*storage.MemoryItem, error) {
 	return a.store.LoadMemories()
 }
 
+// QueryMemories returns the memories matching filter
+func (a *Agent) QueryMemories(filter storage.MemoryFilter) ([]*storage.MemoryItem, error) {
+	return a.store.QueryMemories(filter)
+}
+
+// ExportMemories writes the memories matching filter as JSON and returns
+// how many were written
+func (a *Agent) ExportMemories(w io.Writer, filter storage.MemoryFilter) (int, error) {
+	return a.memory.ExportMemories(w, filter)
+}
+
+// ImportMemories reads exported memories and saves them
+func (a *Agent) ImportMemories(r io.Reader, strategy memory.ImportStrategy) (*memory.ImportResult, error) {
+	return a.memory.ImportMemories(r, strategy)
+}
+
+// UpdateMemory changes the content, type, relevance or tags of a memory,
+// as set in updates (see storage.JSONStore.UpdateMemory)
+func (a *Agent) UpdateMemory(id string, updates map[string]interface{}) (*storage.MemoryItem, error) {
+	return a.store.UpdateMemory(id, updates)
+}
+
 // DeleteMemory removes a memory
 func (a *Agent) DeleteMemory(id string) error {
 	return a.store.DeleteMemory(id)
@@ -457,6 +1336,21 @@ func (a *Agent) ListSkills() []*storage.Skill {
 	return a.skills.List()
 }
 
+// AllSkills returns every stored skill, disabled ones included
+func (a *Agent) AllSkills() ([]*storage.Skill, error) {
+	return a.skills.All()
+}
+
+// FindSkill returns a stored skill, enabled or not
+func (a *Agent) FindSkill(id string) (*storage.Skill, error) {
+	return a.skills.Find(id)
+}
+
+// SetSkillEnabled enables or disables a skill
+func (a *Agent) SetSkillEnabled(id string, enabled bool) (*storage.Skill, error) {
+	return a.skills.SetEnabled(id, enabled)
+}
+
 // RegisterSkill adds a new skill
 func (a *Agent) RegisterSkill(skill *storage.Skill) error {
 	return a.skills.Register(skill)
@@ -467,28 +1361,73 @@ func (a *Agent) UnregisterSkill(id string) error {
 	return a.skills.Unregister(id)
 }
 
+// RegisterFunc adds a Go function as a tool of the agent, with the
+// arguments schema derived from T (see tools.RegisterFunc). The tools
+// config does not restrict tools registered this way.
+func RegisterFunc[T any](a *Agent, name, description string, fn func(context.Context, T) (string, error)) error {
+	return tools.RegisterFunc(a.tools, name, description, fn)
+}
+
 // Interactive starts an interactive REPL session
 func (a *Agent) Interactive(ctx context.Context) error {
 	a.log.Info("starting interactive session", "conversation", a.conversationID)
 
-	// Set up default tool confirmation
-	a.SetToolConfirmation(DefaultToolConfirmation)
+	// Accessible mode prints plain text only, for screen readers
+	accessible := a.config.Agent.Accessible
+	dim := theme.Dim.Render
+	warn := theme.Warning.Render
+	if accessible {
+		dim = func(s string) string { return s }
+		warn = dim
+	}
+
+	// Set up default tool confirmation, unless the caller chose a prompt
+	if a.onToolConfirm == nil {
+		a.SetToolPrompt(DefaultToolConfirmation)
+		if accessible {
+			a.SetToolPrompt(AccessibleToolConfirmation)
+		}
+	}
+	if accessible {
+		a.onAnnounce = func(msg string) { fmt.Println(msg) }
+	}
+
+	// Show output of long-running tools such as run_code as it arrives
+	a.onToolOutput = func(tool, chunk string) {
+		fmt.Print(dim(chunk))
+	}
+
+	// Answers are styled, and tables and images drawn, when the terminal
+	// supports it
+	md := a.AnswerRenderer()
 
 	fmt.Printf("%s ready. Type your message (Ctrl+C or /exit to exit).\n", a.config.Agent.Name)
+	if a.HasPartial() {
+		fmt.Println("The last answer was interrupted; type /continue to resume it.")
+	}
 
+	// SIGINT cancels the in-flight turn instead of killing the process
+	var turns turnInterrupter
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
 
 	go func() {
-		<-sigChan
-		fmt.Println("\nGoodbye!")
-		os.Exit(0)
+		for sig := range sigChan {
+			if sig == syscall.SIGTERM {
+				fmt.Println("\nGoodbye!")
+				os.Exit(0)
+			}
+			if turns.interrupt() {
+				a.log.Info("turn interrupted by user")
+			}
+		}
 	}()
 
-	// Initialize readline with history support
+	// Initialize readline; history is set per conversation before each
+	// prompt
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:          "> ",
-		HistoryFile:     "/tmp/.igent_history",
 		AutoComplete:    nil,
 		InterruptPrompt: "^C",
 		EOFPrompt:       "exit",
@@ -498,8 +1437,14 @@ func (a *Agent) Interactive(ctx context.Context) error {
 	}
 	defer rl.Close()
 
+	history := ""
 	for {
+		history = a.useHistory(rl, history)
 		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) && line != "" {
+			// Ctrl+C discards the line being typed; on an empty line it exits
+			continue
+		}
 		if err != nil {
 			// Handle Ctrl+D (EOF) or Ctrl+C
 			break
@@ -510,26 +1455,127 @@ func (a *Agent) Interactive(ctx context.Context) error {
 			continue
 		}
 
-		// Handle special commands
-		if strings.HasPrefix(input, "/") {
+		// Include @path references and files queued with /attach in
+		// messages
+		if !strings.HasPrefix(input, "/") || strings.HasPrefix(input, "/plan ") || strings.HasPrefix(input, "/orchestrate ") {
+			expanded, err := a.ExpandAttachments(ctx, input)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			input = expanded
+		}
+
+		// Handle special commands; /continue resumes an interrupted answer
+		// and /plan <task> (or any message in plan mode) plans it first
+		send := func(ctx context.Context, onChunk func(string)) (string, error) {
+			result, err := a.ChatStream(ctx, input, onChunk)
+			if err != nil {
+				return "", err
+			}
+			return result.Content, nil
+		}
+		switch {
+		case input == "/continue":
+			send = a.ContinuePartial
+		case input == "/retry", strings.HasPrefix(input, "/retry "):
+			opts, err := ParseRetryOptions(strings.Fields(input)[1:])
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			send = func(ctx context.Context, onChunk func(string)) (string, error) {
+				return a.Retry(ctx, opts, onChunk)
+			}
+		case input == "/plan":
+			a.planMode = !a.planMode
+			if a.planMode {
+				fmt.Println("Plan mode on: messages are planned and carried out step by step after approval.")
+			} else {
+				fmt.Println("Plan mode off.")
+			}
+			continue
+		case strings.HasPrefix(input, "/orchestrate "), a.orchestrateMode && !strings.HasPrefix(input, "/"):
+			request := strings.TrimSpace(strings.TrimPrefix(input, "/orchestrate "))
+			send = func(ctx context.Context, onChunk func(string)) (string, error) {
+				return a.orchestrateConsole(ctx, request, onChunk, md.Flush)
+			}
+		case strings.HasPrefix(input, "/plan "), a.planMode && !strings.HasPrefix(input, "/"):
+			task := strings.TrimSpace(strings.TrimPrefix(input, "/plan "))
+			send = func(ctx context.Context, onChunk func(string)) (string, error) {
+				result, err := a.RunPlan(ctx, task, ConsolePlanOptions(onChunk, md.Flush))
+				md.Flush()
+				if result != nil {
+					fmt.Printf("\n%s", FormatPlanResult(result))
+				}
+				return "", err
+			}
+		case strings.HasPrefix(input, "/"):
 			a.handleCommand(ctx, input, rl)
 			continue
 		}
 
 		// Send to LLM and stream response
 		fmt.Print("\n")
-		_, err = a.ChatStream(ctx, input, func(chunk string) {
-			fmt.Print(chunk)
+		thinking := false
+		if a.config.Agent.ShowReasoning {
+			a.onReasoning = func(chunk string) {
+				if !thinking && accessible {
+					fmt.Print("Reasoning:\n")
+				}
+				thinking = true
+				fmt.Print(dim(chunk))
+			}
+		}
+		last := a.lastResult
+		turnCtx, done := turns.start(ctx)
+		_, err = send(turnCtx, func(chunk string) {
+			if thinking {
+				thinking = false
+				fmt.Print("\n\n")
+				if accessible {
+					fmt.Print("Answer:\n")
+				}
+			}
+			md.Write(chunk)
 		})
+		md.Flush()
+		interrupted := turnCtx.Err() != nil
+		done()
+		if interrupted {
+			var partial *PartialResponseError
+			if errors.As(err, &partial) {
+				fmt.Printf("\n\n%s\nThe partial answer was saved; type /continue to resume it.\n\n", warn("Response interrupted."))
+			} else {
+				fmt.Print("\nInterrupted.\n\n")
+			}
+			continue
+		}
 		if err != nil {
 			if err == ErrToolDenied {
 				// Tool denied - just return to prompt
 				fmt.Print("\n\n")
 				continue
 			}
+			if errors.Is(err, ErrNoPartialResponse) {
+				fmt.Print("Nothing to continue.\n\n")
+				continue
+			}
+			if errors.Is(err, ErrNoExchange) {
+				fmt.Print("Nothing to retry.\n\n")
+				continue
+			}
+			var partial *PartialResponseError
+			if errors.As(err, &partial) {
+				fmt.Printf("\n\n%s\nThe partial answer was saved; type /continue to resume it.\n\n", warn("Response interrupted: "+partial.Err.Error()))
+				continue
+			}
 			fmt.Printf("\nError: %v\n", err)
 			continue
 		}
+		if a.showUsage && a.lastResult != last {
+			fmt.Print("\n\n" + dim(a.lastResult.Summary()))
+		}
 		fmt.Print("\n\n")
 	}
 
@@ -537,6 +1583,97 @@ func (a *Agent) Interactive(ctx context.Context) error {
 	return nil
 }
 
+// NewAnswerRenderer returns the renderer of answers shown on stdout: tables
+// and images where the terminal supports them, and styled markdown with
+// highlighted code with agent.markdown. Accessible mode and output that is
+// not a terminal get the answer as written; resolve may be nil.
+func NewAnswerRenderer(cfg *config.Config, resolve render.ImageResolver) *render.Markdown {
+	caps := render.Detect()
+	if cfg.Agent.Accessible {
+		caps = render.Capabilities{}
+	}
+	switch strings.ToLower(cfg.UI.Color) {
+	case "always":
+		caps.Color = true
+	case "never":
+		caps.Color = false
+	}
+	md := render.NewMarkdown(os.Stdout, caps, resolve)
+	if cfg.Agent.Markdown && caps.Color {
+		markdownTheme := cfg.Agent.MarkdownTheme
+		if ui := strings.ToLower(cfg.UI.Theme); (markdownTheme == "" || markdownTheme == render.DefaultTheme) && (ui == "dark" || ui == "light") {
+			markdownTheme = ui
+		}
+		styler, err := render.NewStyler(markdownTheme, caps.Width)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; showing answers as written\n", err)
+			return md
+		}
+		md.SetStyler(styler)
+	}
+	return md
+}
+
+// AnswerRenderer returns the renderer of this agent's answers on stdout,
+// see NewAnswerRenderer
+func (a *Agent) AnswerRenderer() *render.Markdown {
+	return NewAnswerRenderer(a.config, a.resolveImage)
+}
+
+// resolveImage loads an image referenced in an answer from a local file
+// or, failing that, from the artifact store by name or hash
+func (a *Agent) resolveImage(ref string) ([]byte, string, bool) {
+	if data, name, ok := render.FileImages(ref); ok {
+		return data, name, true
+	}
+	artifact, err := a.store.FindArtifact(ref)
+	if err != nil {
+		return nil, "", false
+	}
+	data, err := a.store.ReadArtifact(artifact)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, artifact.Name, true
+}
+
+// turnInterrupter tracks the cancel function of the in-flight turn so a
+// signal handler can abort it
+type turnInterrupter struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+}
+
+// start derives a cancellable context for a new turn; the returned func must
+// be called when the turn ends
+func (t *turnInterrupter) start(ctx context.Context) (context.Context, func()) {
+	turnCtx, cancel := context.WithCancel(ctx)
+
+	t.mu.Lock()
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	return turnCtx, func() {
+		t.mu.Lock()
+		t.cancel = nil
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// interrupt cancels the in-flight turn, reporting whether one was running
+func (t *turnInterrupter) interrupt() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cancel == nil {
+		return false
+	}
+	t.cancel()
+	t.cancel = nil
+	return true
+}
+
 // handleCommand processes slash commands
 func (a *Agent) handleCommand(ctx context.Context, input string, rl *readline.Instance) {
 	parts := strings.Fields(input)
@@ -547,18 +1684,38 @@ func (a *Agent) handleCommand(ctx context.Context, input string, rl *readline.In
 		fmt.Println(`Commands:
   /help          - Show this help
   /new [name]    - Start a new conversation
-  /list          - List conversations
+  /list [tag]    - List conversations (title, messages, last update)
+  /title [text]  - Show or set the conversation title
+  /system [text|reset] - Show, set or reset the conversation's system prompt
+  /persona [name|off] - Show or switch the persona (ops, coder, writer, ...)
+  /stats         - Show the model, tokens, tool calls and duration of the last answer
+  /usage [on|off] - Show or hide the usage footer (tokens, cost, duration, tool calls) after answers
+  /tag [-]<tag>... - Show, add or (with -) remove conversation tags
   /switch <id>   - Switch to a conversation
+  /rename [id] <new> - Rename the current (or the given) conversation
   /delete <id>   - Delete a conversation
   /memory        - List memories
   /memory add <type> <content> - Add memory
   /skills        - List skills
-  /tools         - List available tools
+  /tools [name]  - List tools (safe or not, what the policy does), or show one's parameters
+  /tools disable|enable <name>... - Turn tools off (or on again) for this session; patterns such as git_* work
+  /style         - Show or change response style (bullets, code, max)
+  /critique [on|off|note|revise] - Review answers: attach a confidence note (on, note) or revise them
+  /attach [path] - Include a file in the next message (no path: list queued files); @path works inline too
+  /artifacts     - List artifacts from this conversation
+  /doc           - Show the working document
+  /compact [--extract] - Summarize older messages now (--extract saves memories)
+  /continue      - Resume an answer cut off by a stream error
+  /plan [task]   - Plan a task, then run it step by step after approval (no task: toggle plan mode)
+  /retry [model] [temperature] - Regenerate the last answer, optionally with another model or temperature
+  /undo          - Remove the last exchange from the conversation
+  /orchestrate <request> - Have the agent profiles handle a request, coordinated
+  /profiles      - List agent profiles
   /clear         - Clear screen
   /exit          - Exit
 
 Navigation:
-  UP/DOWN arrows - Navigate through message history`)
+  UP/DOWN arrows - Recall the prompts sent in this conversation`)
 
 	case "/new":
 		name := "default"
@@ -572,18 +1729,78 @@ Navigation:
 		}
 
 	case "/list":
-		convs, err := a.ListConversations()
+		infos, err := a.ConversationInfos(parts[1:]...)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			break
 		}
 		fmt.Println("Conversations:")
-		for _, c := range convs {
-			marker := ""
-			if c == a.conversationID {
-				marker = " *"
+		for _, info := range infos {
+			marker := "  "
+			if info.ID == a.conversationID {
+				marker = "* "
+			}
+			fmt.Printf("%s%s\n", marker, FormatConversationInfo(info))
+		}
+
+	case "/title":
+		if len(parts) < 2 {
+			conv, err := a.store.LoadConversation(a.conversationID)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			} else if conv.Title == "" {
+				fmt.Println("This conversation has no title")
+			} else {
+				fmt.Printf("Title: %s\n", conv.Title)
 			}
-			fmt.Printf("  %s%s\n", c, marker)
+			break
+		}
+		if err := a.SetTitle(a.conversationID, strings.Join(parts[1:], " ")); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Println("Title set")
+		}
+
+	case "/system":
+		text := strings.TrimSpace(strings.TrimPrefix(input, "/system"))
+		if text == "" {
+			prompt, own := a.SystemPrompt()
+			if own {
+				fmt.Printf("System prompt of this conversation:\n%s\n", prompt)
+			} else if a.persona != "" {
+				fmt.Printf("System prompt (persona %s):\n%s\n", a.persona, prompt)
+			} else {
+				fmt.Printf("System prompt (agent.system_prompt):\n%s\n", prompt)
+			}
+			break
+		}
+		if text == "reset" {
+			text = ""
+		}
+		if err := a.SetSystemPrompt(text); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else if text == "" {
+			fmt.Println("System prompt reset to agent.system_prompt")
+		} else {
+			fmt.Println("System prompt set for this conversation")
+		}
+
+	case "/tag":
+		var add, remove []string
+		for _, tag := range parts[1:] {
+			if t, ok := strings.CutPrefix(tag, "-"); ok {
+				remove = append(remove, t)
+			} else {
+				add = append(add, tag)
+			}
+		}
+		tags, err := a.TagConversation(a.conversationID, add, remove)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else if len(tags) == 0 {
+			fmt.Println("No tags")
+		} else {
+			fmt.Printf("Tags: %s\n", strings.Join(tags, ", "))
 		}
 
 	case "/switch":
@@ -597,6 +1814,21 @@ Navigation:
 			fmt.Printf("Switched to: %s\n", parts[1])
 		}
 
+	case "/rename":
+		if len(parts) < 2 || len(parts) > 3 {
+			fmt.Println("Usage: /rename [conversation-id] <new-id>")
+			break
+		}
+		oldID, newID := a.conversationID, parts[1]
+		if len(parts) == 3 {
+			oldID, newID = parts[1], parts[2]
+		}
+		if err := a.RenameConversation(oldID, newID); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		} else {
+			fmt.Printf("Renamed %s to %s\n", oldID, newID)
+		}
+
 	case "/delete":
 		if len(parts) < 2 {
 			fmt.Println("Usage: /delete <conversation-id>")
@@ -616,7 +1848,7 @@ Navigation:
 			}
 			memType := parts[2]
 			content := strings.Join(parts[3:], " ")
-			if err := a.AddMemory(content, memType); err != nil {
+			if err := a.AddMemory(content, memType, ""); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			} else {
 				fmt.Println("Memory added")
@@ -630,7 +1862,14 @@ Navigation:
 		}
 		fmt.Println("Memories:")
 		for _, m := range memories {
-			fmt.Printf("  [%s] %s\n", m.Type, m.Content)
+			if !m.VisibleIn(a.conversationID) {
+				continue
+			}
+			if m.Scope != "" {
+				fmt.Printf("  [%s, this conversation] %s\n", m.Type, m.Content)
+			} else {
+				fmt.Printf("  [%s] %s\n", m.Type, m.Content)
+			}
 		}
 
 	case "/skills":
@@ -641,17 +1880,148 @@ Navigation:
 		}
 
 	case "/tools":
-		tools := a.tools.List()
-		fmt.Println("Available Tools:")
-		for _, t := range tools {
-			fmt.Printf("  %s: %s\n", t.Name, t.Description)
+		a.handleToolsCommand(parts[1:])
+
+	case "/style":
+		a.handleStyleCommand(parts[1:])
+
+	case "/persona":
+		a.handlePersonaCommand(parts[1:])
+
+	case "/stats":
+		if a.lastResult == nil {
+			fmt.Println("No answer yet in this session")
+			break
+		}
+		fmt.Println(a.lastResult.Summary())
+		for _, tc := range a.lastResult.ToolCalls {
+			status := "ok"
+			if tc.Error {
+				status = "error"
+			}
+			fmt.Printf("  %s %s (%s)\n", tc.Name, truncateRunes(tc.Args, 80), status)
+		}
+
+	case "/usage":
+		if len(parts) > 1 {
+			switch strings.ToLower(parts[1]) {
+			case "on":
+				a.showUsage = true
+			case "off":
+				a.showUsage = false
+			default:
+				fmt.Println("Usage: /usage [on|off]")
+				return
+			}
+		}
+		if a.showUsage {
+			fmt.Println("Usage footer on: tokens, estimated cost, duration and tool calls are shown after answers")
+		} else {
+			fmt.Println("Usage footer off (/stats shows the last answer's usage)")
+		}
+
+	case "/critique":
+		if len(parts) > 1 {
+			if err := a.SetCritique(parts[1]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+		fmt.Printf("Critique: %s\n", a.critiqueMode)
+
+	case "/attach":
+		path := strings.TrimSpace(strings.TrimPrefix(input, "/attach"))
+		if path == "" {
+			if len(a.attachments) == 0 {
+				fmt.Println("No files attached")
+				return
+			}
+			fmt.Printf("Attached to the next message: %s\n", strings.Join(a.attachments, ", "))
+			return
+		}
+		size, err := a.Attach(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Attached %s (%d bytes); it is sent with your next message\n", path, size)
+
+	case "/doc":
+		doc, err := a.Document()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if doc == nil {
+			fmt.Println("No working document in this conversation")
+			return
+		}
+		fmt.Printf("Working document (version %d)\n\n%s\n", doc.Version, doc.Content)
+
+	case "/artifacts":
+		artifacts, err := a.ListArtifacts(a.conversationID)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if len(artifacts) == 0 {
+			fmt.Println("No artifacts in this conversation")
+			return
+		}
+		fmt.Println("Artifacts:")
+		for _, art := range artifacts {
+			fmt.Printf("  %s  %s (turn %d, %d bytes)\n", art.ShortHash(), art.Name, art.Turn, art.Size)
+		}
+
+	case "/compact":
+		extract := len(parts) > 1 && parts[1] == "--extract"
+		fmt.Println("Compacting conversation...")
+		result, err := a.Compact(ctx, extract)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Println(result)
+
+	case "/undo":
+		input, err := a.Undo()
+		if errors.Is(err, ErrNoExchange) {
+			fmt.Println("Nothing to undo.")
+			break
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			break
+		}
+		fmt.Printf("Removed the last exchange: %s\n", truncateRunes(input, 60))
+
+	case "/profiles":
+		names := a.config.ProfileNames()
+		if len(names) == 0 {
+			fmt.Println("No agent profiles configured (profiles in the config)")
+			break
+		}
+		fmt.Println("Agent profiles:")
+		for _, name := range names {
+			p := a.config.Profiles[name]
+			model := p.Model
+			if model == "" {
+				model = a.config.Provider.Model
+			}
+			fmt.Printf("  %s (%s) %s\n", name, model, p.Description)
 		}
 
 	case "/clear":
+		if a.config.Agent.Accessible {
+			// Clearing the screen would drop the screen reader's review buffer
+			fmt.Println("Screen clearing is off in accessible mode.")
+			return
+		}
 		fmt.Print("\033[2J\033[H")
 
 	case "/exit":
 		rl.Close()
+		a.Close()
 		fmt.Println("Goodbye!")
 		os.Exit(0)
 
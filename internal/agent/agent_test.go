@@ -1,17 +1,35 @@
 package agent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/guardrails"
 	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/sched"
 	"github.com/igm/igent/internal/storage"
 	"github.com/igm/igent/internal/tools"
+	"github.com/igm/igent/internal/transcript"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // mockProvider for testing
@@ -54,6 +72,38 @@ func (m *mockProvider) CountTokens(messages []llm.Message) int {
 	return len(messages) * 10
 }
 
+// newTestAgent creates an agent backed by a temp work dir
+func newTestAgent(t *testing.T) *Agent {
+	t.Helper()
+
+	cfg := &config.Config{
+		Provider: config.ProviderConfig{
+			Type:    "openai",
+			APIKey:  "test-key",
+			BaseURL: "https://api.example.com/v1",
+			Model:   "test-model",
+		},
+		Storage: config.StorageConfig{
+			WorkDir: t.TempDir(),
+		},
+		Context: config.ContextConfig{
+			MaxMessages:   10,
+			MaxTokens:     1000,
+			SummarizeWhen: 5,
+		},
+		Agent: config.AgentConfig{
+			Name:         "test-agent",
+			SystemPrompt: "Test prompt",
+		},
+	}
+
+	ag, err := New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	return ag
+}
+
 func TestNewAgent(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "igent-test-*")
 	if err != nil {
@@ -228,7 +278,7 @@ func TestMemoryOperations(t *testing.T) {
 	}
 
 	// Add memory
-	if err := ag.AddMemory("Test memory", "fact"); err != nil {
+	if err := ag.AddMemory("Test memory", "fact", ""); err != nil {
 		t.Fatalf("failed to add memory: %v", err)
 	}
 
@@ -358,6 +408,125 @@ func TestBuildSystemPrompt(t *testing.T) {
 	}
 }
 
+func TestConversationSystemPrompt(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("work"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	if prompt, own := ag.SystemPrompt(); own || prompt != "Test prompt" {
+		t.Errorf("SystemPrompt = %q, %v; want the config prompt", prompt, own)
+	}
+
+	if err := ag.SetSystemPrompt("  You review Go code.\n"); err != nil {
+		t.Fatalf("SetSystemPrompt failed: %v", err)
+	}
+	prompt := ag.buildSystemPrompt()
+	if !strings.HasPrefix(prompt, "You review Go code.") || strings.Contains(prompt, "Test prompt") {
+		t.Errorf("expected the conversation prompt instead of the config one, got %q", prompt)
+	}
+	if !strings.Contains(prompt, "## Memory Management") {
+		t.Error("expected the memory instructions kept")
+	}
+
+	// The prompt is stored with the conversation and only applies there
+	if err := ag.SetConversation("other"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ag.buildSystemPrompt(), "Test prompt") {
+		t.Error("expected the config prompt in another conversation")
+	}
+	if err := ag.SetConversation("work"); err != nil {
+		t.Fatal(err)
+	}
+	if prompt, own := ag.SystemPrompt(); !own || prompt != "You review Go code." {
+		t.Errorf("SystemPrompt = %q, %v after switching back", prompt, own)
+	}
+
+	// A title generated while the prompt is set is not lost
+	ag.titles.pending = map[string]string{"work": "Go code review"}
+	if err := ag.SetSystemPrompt(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, own := ag.SystemPrompt(); own {
+		t.Error("expected the prompt reset")
+	}
+	if conv, err := ag.store.LoadConversation("work"); err != nil || conv.Title != "Go code review" {
+		t.Errorf("expected the pending title saved, got %+v, %v", conv, err)
+	}
+}
+
+// chatText returns the answer of a turn
+func chatText(result *ChatResult, err error) (string, error) {
+	if result == nil {
+		return "", err
+	}
+	return result.Content, err
+}
+
+func TestPersona(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.config.Tools.Confirm = map[string]string{"shell": "allow", "git_*": "deny"}
+	ag.config.Personas = map[string]config.PersonaConfig{
+		"Reviewer": {SystemPrompt: "You review diffs.", Confirm: map[string]string{"shell": "deny", "write_file": "allow"}},
+	}
+	if err := ag.SetConversation("work"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	if err := ag.SetPersona("poet"); err == nil || !strings.Contains(err.Error(), "coder, ops, reviewer, writer") {
+		t.Errorf("expected an unknown persona error listing the personas, got %v", err)
+	}
+
+	if err := ag.SetPersona("Coder"); err != nil {
+		t.Fatalf("SetPersona failed: %v", err)
+	}
+	if ag.Persona() != "coder" || !strings.HasPrefix(ag.buildSystemPrompt(), "You are an experienced software engineer.") {
+		t.Errorf("expected the coder prompt, got %q", ag.buildSystemPrompt())
+	}
+	if d := ag.policy.decide("shell", false); d != toolAllow {
+		t.Errorf("expected the config's rules kept, got %s for shell", d)
+	}
+	// A persona only tightens the rules: the coder's git_commit ask does
+	// not loosen the config's git_* deny
+	if d := ag.policy.decide("git_commit", false); d != toolDeny {
+		t.Errorf("expected the config's stricter rule kept, got %s for git_commit", d)
+	}
+
+	// The persona is saved with the conversation
+	if err := ag.SetConversation("other"); err != nil {
+		t.Fatal(err)
+	}
+	if ag.Persona() != "" || !strings.HasPrefix(ag.buildSystemPrompt(), "Test prompt") {
+		t.Errorf("expected no persona in another conversation, got %q", ag.Persona())
+	}
+	if err := ag.SetConversation("work"); err != nil {
+		t.Fatal(err)
+	}
+	if ag.Persona() != "coder" {
+		t.Errorf("expected the coder persona restored, got %q", ag.Persona())
+	}
+
+	if err := ag.SetPersona("reviewer"); err != nil {
+		t.Fatalf("SetPersona failed: %v", err)
+	}
+	if prompt, own := ag.SystemPrompt(); own || prompt != "You review diffs." {
+		t.Errorf("SystemPrompt = %q, %v; want the configured persona's", prompt, own)
+	}
+	if d := ag.policy.decide("shell", false); d != toolDeny {
+		t.Errorf("expected the persona's stricter rule over the config's, got %s for shell", d)
+	}
+	if d := ag.policy.decide("write_file", false); d != toolAsk {
+		t.Errorf("expected the persona's allow ignored, got %s for write_file", d)
+	}
+
+	if err := ag.SetPersona("off"); err != nil {
+		t.Fatal(err)
+	}
+	conv, _ := ag.store.LoadConversation("work")
+	if ag.Persona() != "" || conv.Persona != "" || !strings.HasPrefix(ag.buildSystemPrompt(), "Test prompt") {
+		t.Errorf("expected the persona off, got %q (saved %q)", ag.Persona(), conv.Persona)
+	}
+}
+
 func TestBuildToolDefinitions(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "igent-test-*")
 	if err != nil {
@@ -460,7 +629,7 @@ func TestChat(t *testing.T) {
 	}
 
 	// Test Chat
-	resp, err := ag.Chat(context.Background(), "Hello")
+	resp, err := chatText(ag.Chat(context.Background(), "Hello"))
 	if err != nil {
 		t.Fatalf("Chat() error = %v", err)
 	}
@@ -529,15 +698,15 @@ func TestChatStream(t *testing.T) {
 	}
 
 	var chunks []string
-	resp, err := ag.ChatStream(context.Background(), "Hello", func(chunk string) {
+	result, err := ag.ChatStream(context.Background(), "Hello", func(chunk string) {
 		chunks = append(chunks, chunk)
 	})
 	if err != nil {
 		t.Fatalf("ChatStream() error = %v", err)
 	}
 
-	if resp != "Streaming response" {
-		t.Errorf("unexpected response: %s", resp)
+	if result.Content != "Streaming response" {
+		t.Errorf("unexpected response: %s", result.Content)
 	}
 
 	if len(chunks) != 1 {
@@ -598,7 +767,7 @@ func TestChatStream_WithToolCalls(t *testing.T) {
 		t.Fatalf("failed to set conversation: %v", err)
 	}
 
-	resp, err := ag.ChatStream(context.Background(), "Use the echo tool", nil)
+	resp, err := chatText(ag.ChatStream(context.Background(), "Use the echo tool", nil))
 	if err != nil {
 		t.Fatalf("ChatStream() error = %v", err)
 	}
@@ -608,6 +777,47 @@ func TestChatStream_WithToolCalls(t *testing.T) {
 	}
 }
 
+func TestChatResult(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &mockProviderWithCustomBehavior{
+		responses: []*llm.Response{
+			{
+				ToolCalls: []llm.ToolCall{{
+					ID:       "call-1",
+					Type:     "function",
+					Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "ping"}`},
+				}},
+				PromptTokens: 100, OutputTokens: 20, TokensUsed: 120, FinishReason: llm.FinishReasonToolCalls,
+			},
+			{Content: "pong", PromptTokens: 150, OutputTokens: 5, TokensUsed: 155, CachedTokens: 100, FinishReason: llm.FinishReasonStop},
+		},
+	}
+	ag.config.Provider.InputPrice, ag.config.Provider.OutputPrice = 2, 10 // USD per 1M tokens
+	if err := ag.SetConversation("result"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ag.Chat(context.Background(), "ping")
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if result.Content != "pong" || result.Model != "test-model" || result.FinishReason != llm.FinishReasonStop || result.Iterations != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.PromptTokens != 250 || result.OutputTokens != 25 || result.TotalTokens != 275 || result.CachedTokens != 100 {
+		t.Errorf("expected the usage of both calls, got %+v", result)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Name != "echo" || result.ToolCalls[0].Error || result.Duration <= 0 {
+		t.Errorf("expected the echo call and a duration, got %+v", result)
+	}
+	if result.Cost != 0.00075 {
+		t.Errorf("expected 250 in at $2 and 25 out at $10 per 1M tokens, got $%v", result.Cost)
+	}
+	if summary := result.Summary(); summary != "test-model · 275 tokens (250 in, 25 out) · ~$0.0008 · 1 tool call · "+result.Duration.Round(100*time.Millisecond).String() {
+		t.Errorf("unexpected summary %q", summary)
+	}
+}
+
 func TestChatStream_MaxIterations(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "igent-test-*")
 	if err != nil {
@@ -726,6 +936,12 @@ func TestDeleteConversation(t *testing.T) {
 	if err := ag.SetConversation("to-delete"); err != nil {
 		t.Fatalf("failed to create conversation: %v", err)
 	}
+	if err := ag.AddMemory("Scoped memory", "fact", "to-delete"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ag.AddMemory("Global memory", "fact", ""); err != nil {
+		t.Fatal(err)
+	}
 
 	// Delete it
 	if err := ag.DeleteConversation("to-delete"); err != nil {
@@ -738,6 +954,12 @@ func TestDeleteConversation(t *testing.T) {
 	if err == nil {
 		t.Error("expected error loading deleted conversation")
 	}
+
+	// Its memories go with it; global ones stay
+	memories, _ := store.LoadMemories()
+	if len(memories) != 1 || memories[0].Content != "Global memory" {
+		t.Errorf("expected only the global memory left, got %+v", memories)
+	}
 }
 
 func TestSetConversation_EmptyID(t *testing.T) {
@@ -789,6 +1011,8 @@ type mockProviderWithCustomBehavior struct {
 	responseIndex  int
 	completeError  error
 	completeCalled int
+	requests       [][]llm.Message
+	options        []*llm.CompleteOptions
 }
 
 func (m *mockProviderWithCustomBehavior) Complete(ctx context.Context, messages []llm.Message) (*llm.Response, error) {
@@ -797,6 +1021,8 @@ func (m *mockProviderWithCustomBehavior) Complete(ctx context.Context, messages
 
 func (m *mockProviderWithCustomBehavior) CompleteWithOptions(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions) (*llm.Response, error) {
 	m.completeCalled++
+	m.requests = append(m.requests, append([]llm.Message(nil), messages...))
+	m.options = append(m.options, opts)
 	if m.completeError != nil {
 		return nil, m.completeError
 	}
@@ -934,7 +1160,7 @@ func TestChat_MultipleToolCalls(t *testing.T) {
 		t.Fatalf("failed to set conversation: %v", err)
 	}
 
-	resp, err := ag.Chat(context.Background(), "Use multiple tools")
+	resp, err := chatText(ag.Chat(context.Background(), "Use multiple tools"))
 	if err != nil {
 		t.Fatalf("Chat() error = %v", err)
 	}
@@ -1007,7 +1233,7 @@ func TestChat_ToolCallWithNilFunction(t *testing.T) {
 		t.Fatalf("failed to set conversation: %v", err)
 	}
 
-	resp, err := ag.Chat(context.Background(), "Test nil function")
+	resp, err := chatText(ag.Chat(context.Background(), "Test nil function"))
 	if err != nil {
 		t.Fatalf("Chat() error = %v", err)
 	}
@@ -1210,3 +1436,2438 @@ func TestToolConfirmation_Denied(t *testing.T) {
 		t.Fatalf("Chat() error = %v, want ErrToolDenied", err)
 	}
 }
+
+func TestToolPolicy(t *testing.T) {
+	for _, confirm := range []map[string]string{{"shell": "maybe"}, {"[": "allow"}} {
+		if _, err := newToolPolicy(confirm); err == nil {
+			t.Errorf("expected error for %v", confirm)
+		}
+	}
+
+	p, err := newToolPolicy(map[string]string{
+		"shell": "deny", "git_*": "allow", "git_commit": "ask", "docker_*": "Ask",
+	})
+	if err != nil {
+		t.Fatalf("newToolPolicy failed: %v", err)
+	}
+	tests := []struct {
+		name string
+		safe bool
+		want toolDecision
+	}{
+		{"shell", false, toolDeny},
+		{"git_status", false, toolAllow},
+		{"git_commit", true, toolAsk}, // Exact rule beats the pattern
+		{"docker_ps", true, toolAsk},  // Rules override safe tools
+		{"cat", true, toolAllow},
+		{"echo", false, toolAsk},
+	}
+	for _, tt := range tests {
+		if got := p.decide(tt.name, tt.safe); got != tt.want {
+			t.Errorf("decide(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	p.allowForSession("echo")
+	p.allowForSession("shell")
+	if p.decide("echo", false) != toolAllow || p.decide("shell", false) != toolDeny {
+		t.Error("session answers must allow asked tools but not denied ones")
+	}
+
+	// In a chat, denied tools are refused to the model and "always"
+	// answers stop further prompts
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("policy"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.policy, _ = newToolPolicy(map[string]string{"uname": "deny"})
+	call := func(id, name string) llm.ToolCall {
+		return llm.ToolCall{ID: id, Type: "function", Function: &llm.ToolCallFunction{Name: name, Arguments: `{"text": "hi"}`}}
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{call("1", "echo"), call("2", "uname")}},
+		{ToolCalls: []llm.ToolCall{call("3", "echo")}},
+		{Content: "Done"},
+	}}
+	ag.provider = provider
+	prompts := 0
+	ag.SetToolPrompt(func(call *tools.ToolCall) ToolAnswer {
+		prompts++
+		return ToolAnswerAlways
+	})
+
+	if _, err := ag.Chat(context.Background(), "go"); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("expected one prompt, got %d", prompts)
+	}
+	var refused bool
+	for _, m := range provider.requests[1] {
+		if m.Role == "tool" && m.Name == "uname" && strings.Contains(m.Content, "not allowed by the tool policy") {
+			refused = true
+		}
+	}
+	if !refused {
+		t.Error("denied tool was not refused to the model")
+	}
+
+	for answer, want := range map[string]ToolAnswer{"y\n": ToolAnswerYes, "Always": ToolAnswerAlways, "a": ToolAnswerAlways, "": ToolAnswerNo, "nope": ToolAnswerNo} {
+		if got := parseToolAnswer(answer); got != want {
+			t.Errorf("parseToolAnswer(%q) = %d, want %d", answer, got, want)
+		}
+	}
+}
+
+func TestResetToolSession_EndsShells(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	ag := newTestAgent(t)
+	defer ag.Close()
+	run := func(command string) string {
+		ctx := tools.WithConversation(context.Background(), "shells", 1)
+		return ag.tools.Execute(ctx, &tools.ToolCall{ID: "s", Name: "shell_session", Args: map[string]interface{}{"command": command}}).Output
+	}
+
+	run("export IGENT_TEST_VAR=kept")
+	if got := run(`echo "${IGENT_TEST_VAR:-unset}"`); got != "kept" {
+		t.Fatalf("expected the session kept between calls, got %q", got)
+	}
+	ag.ResetToolSession()
+	if got := run(`echo "${IGENT_TEST_VAR:-unset}"`); got != "unset" {
+		t.Errorf("expected a fresh shell after the reset, got %q", got)
+	}
+}
+
+func TestDisableTool(t *testing.T) {
+	p, err := newToolPolicy(map[string]string{"git_*": "allow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.disableForSession("git_status")
+	if p.decide("git_status", true) != toolDeny {
+		t.Error("a tool disabled for the session must be denied, whatever tools.confirm says")
+	}
+	if !p.enableForSession("git_status") || p.decide("git_status", true) != toolAllow {
+		t.Error("expected the tools.confirm rule to apply again once enabled")
+	}
+	if p.enableForSession("git_status") {
+		t.Error("expected enabling a tool that is not disabled to report so")
+	}
+
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("disable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ag.DisableTool("nope*"); err == nil {
+		t.Error("expected a pattern matching no tool to fail")
+	}
+	names, err := ag.DisableTool("echo")
+	if err != nil || len(names) != 1 || names[0] != "echo" {
+		t.Fatalf("DisableTool(echo) = %v, %v", names, err)
+	}
+	if got := ag.toolStatus("echo"); got != "disabled for this session" {
+		t.Errorf("unexpected status %q", got)
+	}
+	for _, def := range ag.buildToolDefinitions() {
+		if def.Function.Name == "echo" {
+			t.Error("expected the disabled tool not to be offered")
+		}
+	}
+
+	// A call the model makes anyway is refused
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}}}},
+		{Content: "Done"},
+	}}
+	ag.provider = provider
+	ag.SetToolPrompt(func(*tools.ToolCall) ToolAnswer { return ToolAnswerAlways })
+	if _, err := ag.Chat(context.Background(), "go"); err != nil {
+		t.Fatal(err)
+	}
+	last := provider.requests[1][len(provider.requests[1])-1]
+	if last.Role != "tool" || !strings.Contains(last.Content, "disabled by the user") {
+		t.Errorf("expected the call refused, got %+v", last)
+	}
+
+	// Switching persona keeps it disabled, and profile agents share it
+	if err := ag.SetPersona("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if ag.toolStatus("echo") != "disabled for this session" {
+		t.Error("expected the tool to stay disabled under a persona")
+	}
+	ag.config.Profiles = map[string]config.ProfileConfig{"helper": {Description: "Helps"}}
+	pa, err := ag.profileAgent("helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pa.policy.disabled("echo") {
+		t.Error("expected the tool disabled for profile agents too")
+	}
+
+	if names, err := ag.EnableTool("echo"); err != nil || len(names) != 1 {
+		t.Errorf("EnableTool(echo) = %v, %v", names, err)
+	}
+	if pa.policy.disabled("echo") {
+		t.Error("expected the tool enabled again for profile agents too")
+	}
+	if _, err := ag.EnableTool("echo"); err == nil {
+		t.Error("expected enabling an enabled tool to fail")
+	}
+}
+
+func TestFormatToolParameters(t *testing.T) {
+	ag := newTestAgent(t)
+	tool, ok := ag.tools.Get("memory_add")
+	if !ok {
+		t.Fatal("memory_add is not registered")
+	}
+	got := FormatToolParameters(tool.Parameters)
+	for _, want := range []string{
+		"  content (string, required): The content to remember\n",
+		"  scope (string): global to remember it in every conversation (default), conversation to only remember it in this one [global, conversation]\n",
+		"  tags (string[])",
+		"  type (string, required): Type of memory: fact, preference, or context [fact, preference, context]\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if got := FormatToolParameters(map[string]interface{}{"type": "object"}); got != "  (no parameters)\n" {
+		t.Errorf("unexpected output for no parameters: %q", got)
+	}
+}
+
+func TestChat_ParallelToolCallsPreserveOrder(t *testing.T) {
+	ag := newTestAgent(t)
+
+	// Register a tool whose latency decreases with call order, so completion
+	// order is the reverse of request order
+	ag.tools.Register(&tools.Tool{
+		Name:        "sleepy",
+		Description: "Sleeps then echoes",
+		Parameters:  map[string]interface{}{"type": "object"},
+		Executor: func(args map[string]interface{}) (string, error) {
+			ms, _ := args["ms"].(float64)
+			time.Sleep(time.Duration(ms) * time.Millisecond)
+			return fmt.Sprintf("slept %.0f", ms), nil
+		},
+	})
+
+	var calls []llm.ToolCall
+	for i, ms := range []int{200, 150, 100, 50} {
+		calls = append(calls, llm.ToolCall{
+			ID:   fmt.Sprintf("call-%d", i),
+			Type: "function",
+			Function: &llm.ToolCallFunction{
+				Name:      "sleepy",
+				Arguments: fmt.Sprintf(`{"ms": %d}`, ms),
+			},
+		})
+	}
+
+	mock := &mockProviderWithCustomBehavior{
+		responses: []*llm.Response{
+			{ToolCalls: calls},
+			{Content: "done"},
+		},
+	}
+	ag.provider = mock
+
+	if err := ag.SetConversation("test-parallel"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := ag.Chat(context.Background(), "fan out"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("tool calls did not run concurrently, took %v", elapsed)
+	}
+
+	if len(mock.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(mock.requests))
+	}
+	var toolMsgs []llm.Message
+	for _, m := range mock.requests[1] {
+		if m.Role == "tool" {
+			toolMsgs = append(toolMsgs, m)
+		}
+	}
+	if len(toolMsgs) != len(calls) {
+		t.Fatalf("expected %d tool messages, got %d", len(calls), len(toolMsgs))
+	}
+	for i, m := range toolMsgs {
+		if m.ToolCallID != calls[i].ID {
+			t.Errorf("tool message %d has ID %s, want %s", i, m.ToolCallID, calls[i].ID)
+		}
+	}
+}
+
+func TestResponseStyle(t *testing.T) {
+	ag := newTestAgent(t)
+
+	if strings.Contains(ag.buildSystemPrompt(), "Response Style") {
+		t.Error("default style should not add style instructions")
+	}
+
+	ag.SetStyle(ResponseStyle{MaxTokens: 200, BulletPoints: true, CodeOnly: true})
+	prompt := ag.buildSystemPrompt()
+	for _, want := range []string{"## Response Style", "bullet points", "code only", "200 tokens"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("system prompt missing %q", want)
+		}
+	}
+
+	mock := &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "ok"}}}
+	ag.provider = mock
+	if err := ag.SetConversation("test-style"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+	if _, err := ag.Chat(context.Background(), "Hello"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if mock.options[0].MaxTokens != 200 {
+		t.Errorf("expected MaxTokens 200, got %d", mock.options[0].MaxTokens)
+	}
+}
+
+func TestHandleStyleCommand(t *testing.T) {
+	ag := newTestAgent(t)
+
+	ag.handleStyleCommand([]string{"bullets", "on"})
+	ag.handleStyleCommand([]string{"max", "150"})
+	if !ag.Style().BulletPoints || ag.Style().MaxTokens != 150 {
+		t.Errorf("unexpected style after commands: %s", ag.Style())
+	}
+
+	// Invalid values leave the style untouched
+	ag.handleStyleCommand([]string{"max", "lots"})
+	ag.handleStyleCommand([]string{"code", "maybe"})
+	if ag.Style().MaxTokens != 150 || ag.Style().CodeOnly {
+		t.Errorf("invalid commands changed style: %s", ag.Style())
+	}
+
+	ag.handleStyleCommand([]string{"reset"})
+	if ag.Style() != (ResponseStyle{}) {
+		t.Errorf("expected reset to config defaults, got %s", ag.Style())
+	}
+}
+
+func TestChatStream_CancelledDuringTool(t *testing.T) {
+	ag := newTestAgent(t)
+
+	ag.tools.Register(&tools.Tool{
+		Name:       "block",
+		Parameters: map[string]interface{}{"type": "object"},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	})
+	mock := &mockProviderWithCustomBehavior{
+		responses: []*llm.Response{
+			{ToolCalls: []llm.ToolCall{{ID: "call-1", Type: "function", Function: &llm.ToolCallFunction{Name: "block"}}}},
+			{Content: "should not be reached"},
+		},
+	}
+	ag.provider = mock
+
+	if err := ag.SetConversation("test-cancel"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	var turns turnInterrupter
+	ctx, done := turns.start(context.Background())
+	defer done()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if !turns.interrupt() {
+			t.Error("expected an in-flight turn to interrupt")
+		}
+	}()
+
+	_, err := ag.ChatStream(ctx, "block please", nil)
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if mock.completeCalled != 1 {
+		t.Errorf("expected no LLM call after cancellation, got %d calls", mock.completeCalled)
+	}
+	if turns.interrupt() {
+		t.Error("interrupt should report false once the turn was cancelled")
+	}
+}
+
+// mockStreamingProvider streams each response's reasoning and content
+type mockStreamingProvider struct {
+	mockProviderWithCustomBehavior
+	streamCalled int
+}
+
+func (m *mockStreamingProvider) CompleteStream(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions, handler llm.StreamHandler) (*llm.Response, error) {
+	m.streamCalled++
+	resp, err := m.CompleteWithOptions(ctx, messages, opts)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Reasoning != "" && handler.OnReasoning != nil {
+		handler.OnReasoning(resp.Reasoning)
+	}
+	if resp.Content != "" {
+		handler.OnContent(resp.Content)
+	}
+	return resp, nil
+}
+
+func TestChatStream_StreamingProvider(t *testing.T) {
+	ag := newTestAgent(t)
+	mock := &mockStreamingProvider{mockProviderWithCustomBehavior: mockProviderWithCustomBehavior{
+		responses: []*llm.Response{{Content: "Hello there", Reasoning: "greet the user"}},
+	}}
+	ag.provider = mock
+
+	if err := ag.SetConversation("test-streaming"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	var reasoning string
+	ag.onReasoning = func(s string) { reasoning += s }
+
+	var chunks []string
+	resp, err := chatText(ag.ChatStream(context.Background(), "hi", func(s string) { chunks = append(chunks, s) }))
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if resp != "Hello there" {
+		t.Errorf("unexpected response: %s", resp)
+	}
+	if mock.streamCalled != 1 {
+		t.Errorf("expected CompleteStream to be used, called %d times", mock.streamCalled)
+	}
+	if len(chunks) != 1 || chunks[0] != "Hello there" {
+		t.Errorf("expected response streamed once, got %v", chunks)
+	}
+	if reasoning != "greet the user" {
+		t.Errorf("expected reasoning forwarded, got %q", reasoning)
+	}
+
+	// Without a chunk callback the non-streaming path is used
+	if _, err := ag.Chat(context.Background(), "again"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if mock.streamCalled != 1 {
+		t.Errorf("expected Chat not to stream, called %d times", mock.streamCalled)
+	}
+}
+
+func TestChatStream_Tee(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &mockStreamingProvider{mockProviderWithCustomBehavior: mockProviderWithCustomBehavior{
+		responses: []*llm.Response{
+			{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "memory_list", Arguments: `{}`}}}},
+			{Content: "All done"},
+		},
+	}}
+	if err := ag.SetConversation("test-tee"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	var tee strings.Builder
+	ag.SetTee(&tee, true)
+	if _, err := ag.ChatStream(context.Background(), "list memories", func(string) {}); err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	out := tee.String()
+	for _, want := range []string{"> list memories", "[tool memory_list]", "[result memory_list]", "All done"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in tee output:\n%s", want, out)
+		}
+	}
+
+	// Without tool activity only prompts and responses are written
+	tee.Reset()
+	ag.provider = &mockStreamingProvider{mockProviderWithCustomBehavior: mockProviderWithCustomBehavior{
+		responses: []*llm.Response{
+			{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "memory_list", Arguments: `{}`}}}},
+			{Content: "Again"},
+		},
+	}}
+	ag.SetTee(&tee, false)
+	if _, err := ag.Chat(context.Background(), "once more"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if out := tee.String(); strings.Contains(out, "[tool") || !strings.Contains(out, "Again") {
+		t.Errorf("unexpected tee output:\n%s", out)
+	}
+}
+
+// interruptedStreamProvider streams cut before its first response ends,
+// then behaves like mockStreamingProvider
+type interruptedStreamProvider struct {
+	mockStreamingProvider
+	cut string
+}
+
+func (m *interruptedStreamProvider) CompleteStream(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions, handler llm.StreamHandler) (*llm.Response, error) {
+	if m.cut != "" {
+		cut := m.cut
+		m.cut = ""
+		handler.OnContent(cut)
+		return nil, llm.ErrStreamInterrupted
+	}
+	return m.mockStreamingProvider.CompleteStream(ctx, messages, opts, handler)
+}
+
+func TestChatStream_PartialResponse(t *testing.T) {
+	ag := newTestAgent(t)
+	mock := &interruptedStreamProvider{
+		mockStreamingProvider: mockStreamingProvider{mockProviderWithCustomBehavior: mockProviderWithCustomBehavior{
+			responses: []*llm.Response{{Content: "ld!"}},
+		}},
+		cut: "Hello, wor",
+	}
+	ag.provider = mock
+	if err := ag.SetConversation("test-partial"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	if _, err := ag.ContinuePartial(context.Background(), func(string) {}); !errors.Is(err, ErrNoPartialResponse) {
+		t.Errorf("expected ErrNoPartialResponse, got %v", err)
+	}
+
+	_, err := ag.ChatStream(context.Background(), "greet me", func(string) {})
+	var partial *PartialResponseError
+	if !errors.As(err, &partial) || partial.Partial != "Hello, wor" || !errors.Is(err, llm.ErrStreamInterrupted) {
+		t.Fatalf("expected partial response error, got %v", err)
+	}
+	if !ag.HasPartial() {
+		t.Fatal("expected partial response to be saved")
+	}
+
+	var streamed string
+	resp, err := ag.ContinuePartial(context.Background(), func(s string) { streamed += s })
+	if err != nil {
+		t.Fatalf("ContinuePartial() error = %v", err)
+	}
+	if resp != "Hello, world!" || streamed != "ld!" {
+		t.Errorf("unexpected continuation %q (streamed %q)", resp, streamed)
+	}
+
+	// The model saw its partial answer and the request to continue it
+	req := mock.requests[len(mock.requests)-1]
+	if n := len(req); n < 2 || req[n-2].Content != "Hello, wor" || req[n-1].Content != continuePrompt {
+		t.Errorf("unexpected continuation request: %+v", req)
+	}
+
+	conv, err := ag.store.LoadConversation("test-partial")
+	if err != nil {
+		t.Fatalf("LoadConversation() error = %v", err)
+	}
+	if conv.Partial != nil || len(conv.Messages) != 2 || conv.Messages[0].Content != "greet me" || conv.Messages[1].Content != "Hello, world!" {
+		t.Errorf("unexpected conversation after continue: partial=%v messages=%+v", conv.Partial, conv.Messages)
+	}
+}
+
+// stallingStreamProvider streams its first chunk, then waits until the
+// turn is cancelled
+type stallingStreamProvider struct {
+	mockStreamingProvider
+}
+
+func (m *stallingStreamProvider) CompleteStream(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions, handler llm.StreamHandler) (*llm.Response, error) {
+	handler.OnContent("Once upon")
+	<-ctx.Done()
+	return nil, fmt.Errorf("reading stream: %w", ctx.Err())
+}
+
+func TestChatStream_InterruptKeepsPartial(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &stallingStreamProvider{}
+	if err := ag.SetConversation("test-interrupt"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	var turns turnInterrupter
+	ctx, done := turns.start(context.Background())
+	defer done()
+	_, err := ag.ChatStream(ctx, "tell me a story", func(string) { turns.interrupt() })
+
+	var partial *PartialResponseError
+	if !errors.As(err, &partial) || partial.Partial != "Once upon" || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled partial response, got %v", err)
+	}
+	if !ag.HasPartial() {
+		t.Error("expected the interrupted answer to be saved for /continue")
+	}
+}
+
+func TestExtractCodeBlocks(t *testing.T) {
+	text := "Intro\n```go\npackage main\n```\nMiddle\n```\nplain\ntext\n```\n```python\nunterminated"
+	blocks := extractCodeBlocks(text)
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0].Language != "go" || blocks[0].Content != "package main\n" {
+		t.Errorf("unexpected first block: %+v", blocks[0])
+	}
+	if blocks[1].Language != "" || blocks[1].Content != "plain\ntext\n" {
+		t.Errorf("unexpected second block: %+v", blocks[1])
+	}
+}
+
+func TestChatStream_AutoArtifacts(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.config.Storage.AutoArtifacts = true
+	code := "```go\npackage main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n```"
+	ag.provider = &mockProviderWithCustomBehavior{
+		responses: []*llm.Response{{Content: "Here you go:\n" + code + "\nand a snippet `x`\n```sh\nls\n```"}},
+	}
+	if err := ag.SetConversation("test-artifacts"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	if _, err := ag.Chat(context.Background(), "write hello world"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	artifacts, err := ag.ListArtifacts("test-artifacts")
+	if err != nil {
+		t.Fatalf("ListArtifacts() error = %v", err)
+	}
+	if len(artifacts) != 1 {
+		t.Fatalf("expected only the long code block to be saved, got %d", len(artifacts))
+	}
+	if artifacts[0].Name != "test-artifacts-1-1.go" || artifacts[0].Turn != 1 {
+		t.Errorf("unexpected artifact: %+v", artifacts[0])
+	}
+
+	_, content, err := ag.GetArtifact(artifacts[0].Name)
+	if err != nil || !strings.HasPrefix(string(content), "package main") {
+		t.Errorf("GetArtifact() = %q, %v", content, err)
+	}
+}
+
+func TestDocumentPromptSection(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("test-doc"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+
+	if section := ag.documentPromptSection(); strings.Contains(section, "Current document") {
+		t.Errorf("expected no document details without a document, got %q", section)
+	}
+
+	ag.store.SaveDocument(&storage.Document{
+		ConversationID: "test-doc",
+		Version:        2,
+		Content:        "# Report\n\n## Findings\n\ntext\n\n### Detail\n",
+	})
+
+	section := ag.documentPromptSection()
+	if !strings.Contains(section, "version 2") || !strings.Contains(section, "- Report\n  - Findings\n    - Detail") {
+		t.Errorf("unexpected document section: %q", section)
+	}
+
+	if err := ag.DeleteConversation("test-doc"); err != nil {
+		t.Fatalf("DeleteConversation() error = %v", err)
+	}
+	if doc, _ := ag.Document(); doc != nil {
+		t.Error("expected document to be deleted with its conversation")
+	}
+}
+
+// debateProvider answers with the persona name and records prompts; it is
+// safe for the concurrent calls made by debaters
+type debateProvider struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (p *debateProvider) Complete(ctx context.Context, messages []llm.Message) (*llm.Response, error) {
+	return p.CompleteWithOptions(ctx, messages, nil)
+}
+
+func (p *debateProvider) CompleteWithOptions(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prompt := messages[len(messages)-1].Content
+	p.prompts = append(p.prompts, prompt)
+	persona := strings.Fields(messages[0].Content)
+	return &llm.Response{Content: fmt.Sprintf("answer %d from %s", len(p.prompts), persona[len(persona)-1])}, nil
+}
+
+func (p *debateProvider) Stream(ctx context.Context, messages []llm.Message, onChunk func(string)) error {
+	return nil
+}
+
+func (p *debateProvider) CountTokens(messages []llm.Message) int {
+	return len(messages) * 10
+}
+
+func TestDebate(t *testing.T) {
+	ag := newTestAgent(t)
+	provider := &debateProvider{}
+	ag.provider = provider
+
+	var turns int
+	result, err := ag.Debate(context.Background(), "Tabs or spaces?", DebateOptions{
+		Agents: 3,
+		Rounds: 1,
+		OnTurn: func(round int, turn DebateTurn) { turns++ },
+	})
+	if err != nil {
+		t.Fatalf("Debate failed: %v", err)
+	}
+
+	if len(result.Rounds) != 2 {
+		t.Fatalf("expected 2 rounds (initial + 1 critique), got %d", len(result.Rounds))
+	}
+	if turns != 6 {
+		t.Errorf("expected 6 turns reported, got %d", turns)
+	}
+	if got := result.Rounds[0][1].Agent; got != "Skeptic" {
+		t.Errorf("expected second debater to be Skeptic, got %s", got)
+	}
+	if result.Rounds[0][0].Model != "test-model" {
+		t.Errorf("expected debaters to default to the configured model, got %s", result.Rounds[0][0].Model)
+	}
+
+	// 3 initial + 3 critiques + 1 synthesis
+	if len(provider.prompts) != 7 {
+		t.Fatalf("expected 7 completions, got %d", len(provider.prompts))
+	}
+	critique := debatePrompt("Tabs or spaces?", 0, result.Rounds[0])
+	if !strings.Contains(critique, "Answer from Skeptic") || strings.Contains(critique, "Answer from Analyst") {
+		t.Errorf("critique prompt should include the other answers only:\n%s", critique)
+	}
+	synthesis := provider.prompts[6]
+	for _, turn := range result.Rounds[1] {
+		if !strings.Contains(synthesis, turn.Answer) {
+			t.Errorf("synthesis prompt missing final answer of %s", turn.Agent)
+		}
+	}
+	if result.Answer == "" {
+		t.Error("expected a synthesized answer")
+	}
+}
+
+func TestDebate_TooManyAgents(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &debateProvider{}
+
+	if _, err := ag.Debate(context.Background(), "q", DebateOptions{Agents: 10}); err == nil {
+		t.Error("expected error for too many agents")
+	}
+	if _, err := ag.Debate(context.Background(), "q", DebateOptions{Rounds: -1}); err == nil {
+		t.Error("expected error for negative rounds")
+	}
+}
+
+func TestDebate_NoRounds(t *testing.T) {
+	ag := newTestAgent(t)
+	provider := &debateProvider{}
+	ag.provider = provider
+
+	result, err := ag.Debate(context.Background(), "Tabs or spaces?", DebateOptions{Agents: 2})
+	if err != nil {
+		t.Fatalf("Debate failed: %v", err)
+	}
+	// 2 initial answers + 1 synthesis
+	if len(result.Rounds) != 1 || len(provider.prompts) != 3 {
+		t.Errorf("expected the initial answers synthesized, got %d rounds and %d completions", len(result.Rounds), len(provider.prompts))
+	}
+}
+
+func TestCompressToolHistory(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("compress"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.config.Context.ToolHistoryTokens = 500
+
+	big := strings.Repeat("log line with some output\n", 200)
+	messages := []llm.Message{
+		{Role: "system", Content: "system"},
+		{Role: "user", Content: "check the logs"},
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "c1", Function: &llm.ToolCallFunction{Name: "shell"}}}},
+		{Role: "tool", ToolCallID: "c1", Content: big},
+		{Role: "assistant", ToolCalls: []llm.ToolCall{{ID: "c2", Function: &llm.ToolCallFunction{Name: "shell"}}}},
+		{Role: "tool", ToolCallID: "c2", Content: big},
+	}
+
+	// The latest result (from index 4) is kept verbatim
+	messages = ag.compressToolHistory(messages, 4, 1)
+
+	if !strings.HasPrefix(messages[3].Content, compressedMarker) {
+		t.Fatalf("expected older tool result to be compressed, got %q", messages[3].Content[:80])
+	}
+	if messages[5].Content != big {
+		t.Error("expected latest tool result to be kept")
+	}
+
+	artifacts, err := ag.ListArtifacts("compress")
+	if err != nil || len(artifacts) != 1 {
+		t.Fatalf("expected full output saved as artifact, got %d (%v)", len(artifacts), err)
+	}
+	if !strings.Contains(messages[3].Content, artifacts[0].ShortHash()) {
+		t.Error("expected compressed result to point at the artifact")
+	}
+
+	// Already compressed results are left alone
+	again := messages[3].Content
+	ag.compressToolHistory(messages, 4, 1)
+	if messages[3].Content != again {
+		t.Error("expected compressed result not to be compressed twice")
+	}
+}
+
+func TestCompressToolHistory_UnderBudget(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.config.Context.ToolHistoryTokens = 100000
+
+	content := strings.Repeat("x", 2000)
+	messages := []llm.Message{{Role: "tool", ToolCallID: "c1", Content: content}}
+	ag.compressToolHistory(messages, 1, 1)
+	if messages[0].Content != content {
+		t.Error("expected no compression under budget")
+	}
+}
+
+func TestRunJournalAndResume(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("task"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+
+	echoCall := &llm.Response{
+		Content: "Let me check first.",
+		ToolCalls: []llm.ToolCall{{
+			ID:       "call-1",
+			Type:     "function",
+			Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "step one"}`},
+		}},
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{echoCall}}
+	ag.provider = provider
+
+	// A budget of one iteration pauses the run after the first tool call
+	ag.config.Agent.MaxRunIterations = 1
+	run, err := ag.StartRun(context.Background(), "do the task", RunOptions{})
+	if err == nil {
+		t.Fatal("expected run to stop at the iteration budget")
+	}
+	if run.Status != storage.RunInterrupted || run.Iteration != 1 {
+		t.Fatalf("unexpected run state: status=%s iteration=%d", run.Status, run.Iteration)
+	}
+
+	saved, err := ag.GetRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if len(saved.Steps) != 1 || saved.Steps[0].Tool != "echo" || saved.Steps[0].Summary != "step one" {
+		t.Errorf("unexpected journal steps: %+v", saved.Steps)
+	}
+	if saved.NextAction == "" {
+		t.Error("expected the journal to record the next action")
+	}
+
+	// Resume with a final answer
+	ag.config.Agent.MaxRunIterations = 5
+	provider.responses = append(provider.responses, &llm.Response{Content: "All done."})
+	run, err = ag.ResumeRun(context.Background(), run.ID, nil)
+	if err != nil {
+		t.Fatalf("ResumeRun failed: %v", err)
+	}
+	if run.Status != storage.RunCompleted || run.Result != "All done." {
+		t.Errorf("unexpected resumed run: status=%s result=%q", run.Status, run.Result)
+	}
+
+	// The resumed request continues from the journaled tool result
+	last := provider.requests[len(provider.requests)-1]
+	if last[len(last)-1].Role != "tool" || last[len(last)-1].Content != "step one" {
+		t.Errorf("expected resume to continue after the tool result, got %+v", last[len(last)-1])
+	}
+
+	conv, err := ag.store.LoadConversation("task")
+	if err != nil {
+		t.Fatalf("LoadConversation failed: %v", err)
+	}
+	if len(conv.Messages) != 4 || conv.Messages[2].Role != "tool" || conv.Messages[3].Content != "All done." {
+		t.Errorf("expected completed run saved to conversation with its tool activity, got %+v", conv.Messages)
+	}
+
+	if _, err := ag.ResumeRun(context.Background(), run.ID, nil); err == nil {
+		t.Error("expected error resuming a completed run")
+	}
+}
+
+func TestRunEvaluation(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("task"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "I wrote the report."},
+		{Content: "Verdict:\n```json\n{\"score\": 3, \"reason\": \"No report was produced.\"}\n```"},
+		{Content: `{"score": 9, "reason": "Looks complete."}`},
+	}}
+	ag.provider = provider
+	ag.config.Agent.EvaluatorMinScore = 7
+
+	run, err := ag.StartRun(context.Background(), "write the report", RunOptions{Evaluate: true})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	e := run.Evaluation
+	if run.Status != storage.RunCompleted || e == nil {
+		t.Fatalf("expected an evaluated completed run, got %s with %+v", run.Status, e)
+	}
+	if e.Score != 3 || e.Passed || e.Reason != "No report was produced." {
+		t.Errorf("unexpected evaluation: %+v", e)
+	}
+
+	critic := provider.requests[1]
+	if critic[0].Content != criticPersona || !strings.Contains(critic[1].Content, "write the report") ||
+		!strings.Contains(critic[1].Content, "I wrote the report.") {
+		t.Errorf("critic did not get the task and result: %+v", critic)
+	}
+
+	// The verdict is saved, and re-evaluating replaces it
+	run, err = ag.EvaluateRun(context.Background(), run.ID)
+	if err != nil {
+		t.Fatalf("EvaluateRun failed: %v", err)
+	}
+	saved, err := ag.GetRun(run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if saved.Evaluation == nil || saved.Evaluation.Score != 9 || !saved.Evaluation.Passed {
+		t.Errorf("expected saved passing evaluation, got %+v", saved.Evaluation)
+	}
+
+	if _, err := parseEvaluation("I think it is fine."); err == nil {
+		t.Error("expected an error for a reply without a verdict")
+	}
+}
+
+func TestRunPausePoints(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("paused"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+
+	checkpoint := &llm.Response{
+		ToolCalls: []llm.ToolCall{{
+			ID:       "call-1",
+			Type:     "function",
+			Function: &llm.ToolCallFunction{Name: "checkpoint", Arguments: `{"label": "Before-Deploy"}`},
+		}},
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{checkpoint, {Content: "Deployed."}}}
+	ag.provider = provider
+
+	run, err := ag.StartRun(context.Background(), "deploy", RunOptions{
+		Pause: storage.PausePolicy{Labels: []string{"before-deploy"}},
+	})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	if run.Status != storage.RunPaused || !strings.Contains(run.PauseReason, "before-deploy") {
+		t.Fatalf("expected run paused at checkpoint, got status=%s reason=%q", run.Status, run.PauseReason)
+	}
+	if provider.completeCalled != 1 {
+		t.Errorf("expected no completion after pausing, got %d", provider.completeCalled)
+	}
+
+	run, err = ag.ResumeRun(context.Background(), run.ID, nil)
+	if err != nil {
+		t.Fatalf("ResumeRun failed: %v", err)
+	}
+	if run.Status != storage.RunCompleted || run.Approved.ToolCalls != 1 {
+		t.Errorf("expected approved and completed run, got status=%s approved=%+v", run.Status, run.Approved)
+	}
+}
+
+func TestPauseReason(t *testing.T) {
+	run := &storage.Run{
+		ToolCalls: 7,
+		Cost:      1.5,
+		Approved:  storage.RunUsage{ToolCalls: 5, Cost: 1.0},
+	}
+
+	if reason := pauseReason(run, nil); reason != "" {
+		t.Errorf("expected no pause without a policy, got %q", reason)
+	}
+
+	run.Pause = storage.PausePolicy{EveryToolCalls: 3}
+	if reason := pauseReason(run, nil); reason != "" {
+		t.Errorf("expected no pause after 2 of 3 tool calls, got %q", reason)
+	}
+	run.Pause.EveryToolCalls = 2
+	if reason := pauseReason(run, nil); !strings.Contains(reason, "2 tool calls") {
+		t.Errorf("expected tool call pause, got %q", reason)
+	}
+
+	run.Pause = storage.PausePolicy{EveryCost: 0.5}
+	if reason := pauseReason(run, nil); !strings.Contains(reason, "$0.50") {
+		t.Errorf("expected cost pause, got %q", reason)
+	}
+
+	run.Pause = storage.PausePolicy{Labels: []string{"*"}}
+	if reason := pauseReason(run, []string{"tests-pass"}); !strings.Contains(reason, "tests-pass") {
+		t.Errorf("expected wildcard checkpoint pause, got %q", reason)
+	}
+}
+
+// embeddingProvider embeds texts as counts of topic words
+type embeddingProvider struct {
+	mockProviderWithCustomBehavior
+	embedded int
+}
+
+func (m *embeddingProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	m.embedded += len(texts)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		vectors[i] = []float64{
+			float64(strings.Count(text, "docker")),
+			float64(strings.Count(text, "recipe")),
+			0.1,
+		}
+	}
+	return vectors, nil
+}
+
+func TestRouteConversation(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.config.Routing.MinSimilarity = 0.4
+	for id, request := range map[string]string{
+		"containers": "Why does my docker build fail with a cache error?",
+		"cooking":    "Suggest a pasta recipe for dinner",
+	} {
+		conv := &storage.Conversation{ID: id, Messages: []llm.Message{
+			{Role: "user", Content: request},
+			{Role: "assistant", Content: "Sure."},
+		}}
+		if err := ag.store.SaveConversation(conv); err != nil {
+			t.Fatalf("SaveConversation() error = %v", err)
+		}
+	}
+
+	// Keyword fallback without embedding support
+	route, err := ag.RouteConversation(context.Background(), "docker build cache keeps failing")
+	if err != nil {
+		t.Fatalf("RouteConversation() error = %v", err)
+	}
+	if route.ConversationID != "containers" || route.Created || route.Method != "keyword" {
+		t.Errorf("unexpected keyword route: %+v", route)
+	}
+	if ag.conversationID != "containers" {
+		t.Errorf("expected agent to switch conversation, got %s", ag.conversationID)
+	}
+
+	// Embeddings, cached between calls
+	mock := &embeddingProvider{}
+	ag.provider = mock
+	route, err = ag.RouteConversation(context.Background(), "Another recipe idea?")
+	if err != nil {
+		t.Fatalf("RouteConversation() error = %v", err)
+	}
+	if route.ConversationID != "cooking" || route.Method != "embedding" || route.Similarity < 0.9 {
+		t.Errorf("unexpected embedding route: %+v", route)
+	}
+	if mock.embedded != 3 {
+		t.Errorf("expected prompt and both conversations embedded, got %d texts", mock.embedded)
+	}
+	if _, err := ag.RouteConversation(context.Background(), "docker compose networking"); err != nil {
+		t.Fatalf("RouteConversation() error = %v", err)
+	}
+	if mock.embedded != 4 {
+		t.Errorf("expected cached conversation embeddings to be reused, embedded %d texts", mock.embedded)
+	}
+
+	// Unrelated prompts start a new conversation named after the prompt
+	route, err = ag.RouteConversation(context.Background(), "Plan a trip to Lisbon in spring")
+	if err != nil {
+		t.Fatalf("RouteConversation() error = %v", err)
+	}
+	if !route.Created || route.ConversationID != "plan-trip-lisbon-spring" {
+		t.Errorf("expected a new conversation, got %+v", route)
+	}
+}
+
+func TestNewConversationID(t *testing.T) {
+	if id := newConversationID("Fix the login bug!", []string{"fix-login-bug"}); id != "fix-login-bug-2" {
+		t.Errorf("expected numbered id, got %s", id)
+	}
+	if id := newConversationID("?", nil); id != "chat" {
+		t.Errorf("expected fallback id, got %s", id)
+	}
+}
+
+func TestProjectConversation(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "my project")
+	sub := filepath.Join(root, "cmd", "tool")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if findRepoRoot(outside) == "" && ProjectConversation(outside) != "default" {
+		t.Error("expected the plain default conversation outside a repository")
+	}
+
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if ns := ProjectNamespace(sub); ns != "my-project" {
+		t.Errorf("expected namespace from repository root, got %q", ns)
+	}
+	if id := ProjectConversation(sub); id != "my-project/default" {
+		t.Errorf("unexpected project conversation %q", id)
+	}
+
+	// The namespaced conversation is stored and listed like any other
+	ag := newTestAgent(t)
+	if err := ag.SetConversation(ProjectConversation(root)); err != nil {
+		t.Fatalf("SetConversation() error = %v", err)
+	}
+	ids, err := ag.ListConversations()
+	if err != nil {
+		t.Fatalf("ListConversations() error = %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "my-project/default" {
+		t.Errorf("unexpected conversations %v", ids)
+	}
+}
+
+func TestAccessibleToolActivity(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &mockProvider{
+		toolCalls: []llm.ToolCall{
+			{ID: "call-1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}},
+			{ID: "call-2", Type: "function", Function: &llm.ToolCallFunction{Name: "read_file", Arguments: `{"path": "/nonexistent/file"}`}},
+		},
+		response: "Done",
+	}
+	var mu sync.Mutex
+	var announced []string
+	ag.onAnnounce = func(msg string) {
+		mu.Lock()
+		announced = append(announced, msg)
+		mu.Unlock()
+	}
+
+	if err := ag.SetConversation("test-accessible"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+	if _, err := ag.Chat(context.Background(), "Test"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	sort.Strings(announced)
+	got := strings.Join(announced, "\n")
+	for _, want := range []string{"Running tool echo.", "Tool echo finished.", "Running tool read_file.", "Tool read_file failed: "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing announcement %q in:\n%s", want, got)
+		}
+	}
+
+	plain := FormatToolCallPlain(&tools.ToolCall{Name: "write_file", Args: map[string]interface{}{"path": "a.txt", "content": "x"}})
+	if strings.Contains(plain, "\033") || !strings.Contains(plain, "run the tool write_file.\nArguments:\ncontent: x\npath: a.txt\n") {
+		t.Errorf("unexpected plain tool call:\n%q", plain)
+	}
+}
+
+func TestSystemPromptFiles(t *testing.T) {
+	ag := newTestAgent(t)
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.md")
+	if err := os.WriteFile(base, []byte("Always answer in haiku.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ag.promptFiles = newPromptFiles([]string{base, filepath.Join(dir, "IGENT.md")}, ag.log)
+
+	prompt := ag.buildSystemPrompt()
+	if !strings.Contains(prompt, ag.config.Agent.SystemPrompt+"\n\nAlways answer in haiku.") {
+		t.Errorf("include file missing from system prompt:\n%s", prompt)
+	}
+
+	// Edits and newly created files apply to the next prompt
+	if err := os.WriteFile(base, []byte("Answer in limericks instead."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "IGENT.md"), []byte("Project: igent"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompt = ag.buildSystemPrompt()
+	if strings.Contains(prompt, "haiku") || !strings.Contains(prompt, "Answer in limericks instead.\n\nProject: igent") {
+		t.Errorf("changed include files not picked up:\n%s", prompt)
+	}
+}
+
+// usageProvider answers every request with fixed token usage
+type usageProvider struct{ mockProvider }
+
+func (p *usageProvider) CompleteWithOptions(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions) (*llm.Response, error) {
+	return &llm.Response{Content: "ok", TokensUsed: 1000, PromptTokens: 600, OutputTokens: 400}, nil
+}
+
+func TestUsageQuota(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &usageProvider{}
+	ag.config.Quota = config.QuotaConfig{
+		User:    "alice",
+		PerUser: config.QuotaLimits{DailyTokens: 2500},
+		WarnAt:  0.8,
+	}
+	ag.quota = newQuota(ag.config, ag.store, ag.log)
+	var warnings []string
+	ag.onWarning = func(msg string) { warnings = append(warnings, msg) }
+	if err := ag.SetConversation("quota"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ag.Chat(context.Background(), "hi"); err != nil {
+			t.Fatalf("chat %d: %v", i+1, err)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "80% of the daily quota of 2500 tokens for user alice") {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	_, err := ag.Chat(context.Background(), "hi")
+	var qe *QuotaError
+	if !errors.Is(err, ErrQuotaExceeded) || !errors.As(err, &qe) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if qe.Period != "daily" || qe.StatusCode() != http.StatusTooManyRequests {
+		t.Errorf("unexpected quota error %+v", qe)
+	}
+
+	// Side completions, such as a debate's, are metered too
+	if _, err := ag.Debate(context.Background(), "Tabs or spaces?", DebateOptions{Agents: 2}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected the debate refused by the quota, got %v", err)
+	}
+
+	// Usage is also recorded under the API key, without the key itself
+	_, month, err := ag.store.LoadUsage("key:"+keyFingerprint("test-key"), time.Now())
+	if err != nil || month.Tokens != 3000 {
+		t.Errorf("key usage = %+v, %v", month, err)
+	}
+}
+
+func TestTokenBudget(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("budget"); err != nil {
+		t.Fatal(err)
+	}
+	echo := llm.ToolCall{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}}
+	looping := func() []*llm.Response {
+		return []*llm.Response{
+			{ToolCalls: []llm.ToolCall{echo}, TokensUsed: 600},
+			{ToolCalls: []llm.ToolCall{echo}, TokensUsed: 600},
+			{Content: "done", TokensUsed: 600},
+		}
+	}
+	ag.config.Budget = config.BudgetConfig{TurnTokens: 1000, OnExceed: BudgetAsk}
+	ag.budget.limits = ag.config.Budget
+
+	// Without a prompt to ask on, the turn stops at its budget
+	mock := &mockProviderWithCustomBehavior{responses: looping()}
+	ag.provider = mock
+	_, err := ag.Chat(context.Background(), "loop")
+	var be *BudgetError
+	if !errors.Is(err, ErrBudgetExceeded) || !errors.As(err, &be) || be.Scope != BudgetTurn || be.Used != 1200 {
+		t.Fatalf("expected the turn budget error, got %v", err)
+	}
+	if mock.completeCalled != 2 {
+		t.Errorf("expected no call past the budget, got %d calls", mock.completeCalled)
+	}
+
+	// Approving goes on for another budget's worth
+	var asked []*BudgetError
+	ag.SetBudgetPrompt(func(e *BudgetError) bool {
+		asked = append(asked, e)
+		return true
+	})
+	ag.provider = &mockProviderWithCustomBehavior{responses: looping()}
+	if response, err := chatText(ag.Chat(context.Background(), "loop")); err != nil || response != "done" {
+		t.Fatalf("expected the approved turn to finish, got %q, %v", response, err)
+	}
+	if len(asked) != 1 {
+		t.Errorf("expected one budget prompt, got %d", len(asked))
+	}
+
+	// The conversation's usage comes from the ledger; refuse never asks
+	ag.config.Budget = config.BudgetConfig{ConversationTokens: 3000, OnExceed: BudgetRefuse}
+	ag.budget.limits = ag.config.Budget
+	ag.provider = &mockProviderWithCustomBehavior{responses: looping()}
+	_, err = ag.Chat(context.Background(), "again")
+	if !errors.As(err, &be) || be.Scope != BudgetConversation || be.Used != 3000 || len(asked) != 1 {
+		t.Fatalf("expected the conversation budget refused, got %v (%d prompts)", err, len(asked))
+	}
+	if err := ag.SetConversation("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ag.Chat(context.Background(), "hi"); err != nil {
+		t.Errorf("expected another conversation within budget, got %v", err)
+	}
+
+	ag.config.Budget.OnExceed = "warn"
+	if _, err := newBudget(ag.config, ag.store, "user:test", ag.log); err == nil {
+		t.Error("expected an unknown on_exceed action to fail")
+	}
+}
+
+func TestToolCallsRecorded(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.provider = &mockProvider{
+		toolCalls: []llm.ToolCall{{
+			ID:       "call-1",
+			Type:     "function",
+			Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "recorded"}`},
+		}},
+		response: "Done.",
+	}
+	if err := ag.SetConversation("records"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ag.Chat(context.Background(), "echo something"); err != nil {
+		t.Fatal(err)
+	}
+
+	conv, err := ag.store.LoadConversation("records")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conv.ToolCalls) != 1 {
+		t.Fatalf("got %d tool records, want 1", len(conv.ToolCalls))
+	}
+	r := conv.ToolCalls[0]
+	if r.Message != 1 || r.Name != "echo" || r.Args != `{"text": "recorded"}` || r.Output != "recorded" || r.Error {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	// The history keeps the tool call and its result; the transcript hides them
+	roles := make([]string, len(conv.Messages))
+	for i, m := range conv.Messages {
+		roles[i] = m.Role
+	}
+	if strings.Join(roles, ",") != "user,assistant,tool,assistant" || len(conv.Messages[1].ToolCalls) != 1 ||
+		conv.Messages[2].ToolCallID != "call-1" || conv.Messages[2].Content != "recorded" {
+		t.Errorf("unexpected stored messages %+v", conv.Messages)
+	}
+	if shown := storage.Transcript(conv.Messages); len(shown) != 2 || shown[1].Content != "Done." {
+		t.Errorf("unexpected transcript %+v", shown)
+	}
+
+	// Dropping summarized messages drops their records
+	conv.DropMessages(2)
+	if len(conv.ToolCalls) != 0 {
+		t.Errorf("records of dropped messages kept: %+v", conv.ToolCalls)
+	}
+
+	// Long outputs are cut on a rune boundary
+	long := strings.Repeat("a", storage.ToolRecordMaxOutput-1) + "é"
+	if cut := truncateToolOutput(long); !utf8.ValidString(cut) || !strings.HasSuffix(cut, "a\n... (truncated)") {
+		t.Errorf("expected the output cut before the split rune, got %q", cut[len(cut)-20:])
+	}
+}
+
+func TestFinishReasons(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("finish"); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	ag.onWarning = func(msg string) { warnings = append(warnings, msg) }
+
+	// An answer cut off at the token limit is continued and stitched together
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "Hello, ", FinishReason: llm.FinishReasonLength},
+		{Content: "wor", FinishReason: llm.FinishReasonLength},
+		{Content: "ld.", FinishReason: llm.FinishReasonStop},
+	}}
+	ag.provider = provider
+	response, err := chatText(ag.Chat(context.Background(), "greet"))
+	if err != nil || response != "Hello, world." {
+		t.Fatalf("Chat = %q, %v; want stitched answer", response, err)
+	}
+	last := provider.requests[2]
+	if n := len(last); last[n-1].Content != continuePrompt || last[n-2].Content != "Hello, wor" {
+		t.Errorf("continuation request ends with %+v", last[n-2:])
+	}
+	if len(warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+
+	// With max_response_tokens the cut is intended: no continuation, a warning
+	ag.style.MaxTokens = 10
+	provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "Short", FinishReason: llm.FinishReasonLength},
+	}}
+	ag.provider = provider
+	if response, err := chatText(ag.Chat(context.Background(), "greet")); err != nil || response != "Short" {
+		t.Errorf("Chat = %q, %v", response, err)
+	}
+	if provider.completeCalled != 1 || len(warnings) != 1 {
+		t.Errorf("expected one call and a warning, got %d calls, warnings %v", provider.completeCalled, warnings)
+	}
+	ag.style.MaxTokens = 0
+
+	// A filtered answer fails the turn
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "I can't", FinishReason: llm.FinishReasonContentFilter},
+	}}
+	if _, err := ag.Chat(context.Background(), "something"); !errors.Is(err, ErrContentFiltered) {
+		t.Errorf("expected ErrContentFiltered, got %v", err)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("main"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "3 open TODOs."},
+		{Content: "Still 3."},
+	}}
+
+	if _, err := ag.AddSchedule("0 25 * * *", "x", ""); err == nil {
+		t.Error("expected an invalid cron expression to fail")
+	}
+	daily, err := ag.AddSchedule("0 9 * * *", "summarize my TODO file", "todos")
+	if err != nil {
+		t.Fatalf("AddSchedule failed: %v", err)
+	}
+	hourly, err := ag.AddSchedule("@hourly", "check the build", "")
+	if err != nil {
+		t.Fatalf("AddSchedule failed: %v", err)
+	}
+	if hourly.ConversationID != "schedule-"+hourly.ID || !daily.NextRun.After(time.Now()) {
+		t.Errorf("unexpected schedule: %+v", hourly)
+	}
+
+	// Nothing is due yet
+	if ran, err := ag.RunDueSchedules(context.Background(), time.Now(), nil); err != nil || len(ran) != 0 {
+		t.Fatalf("expected nothing due, got %d (%v)", len(ran), err)
+	}
+
+	// At the daily run both are due; each runs once in its conversation
+	at := daily.NextRun
+	ran, err := ag.RunDueSchedules(context.Background(), at, nil)
+	if err != nil || len(ran) != 2 {
+		t.Fatalf("expected 2 runs, got %d (%v)", len(ran), err)
+	}
+	saved, err := ag.GetSchedule(daily.ID)
+	if err != nil {
+		t.Fatalf("GetSchedule failed: %v", err)
+	}
+	last := saved.LastResult()
+	if last == nil || last.Response == "" || last.Error != "" {
+		t.Fatalf("expected a recorded result, got %+v", last)
+	}
+	if want := at.Add(24 * time.Hour); !saved.NextRun.Equal(want) {
+		t.Errorf("next run = %v, want %v", saved.NextRun, want)
+	}
+	conv, err := ag.store.LoadConversation("todos")
+	if err != nil || len(conv.Messages) == 0 || conv.Messages[0].Content != "summarize my TODO file" {
+		t.Errorf("prompt not sent to its conversation: %+v (%v)", conv, err)
+	}
+	if ag.conversationID != "main" || ag.priority != sched.Interactive {
+		t.Errorf("conversation or priority not restored: %s %s", ag.conversationID, ag.priority)
+	}
+
+	if err := ag.RemoveSchedule(hourly.ID); err != nil {
+		t.Fatalf("RemoveSchedule failed: %v", err)
+	}
+	if err := ag.RemoveSchedule(hourly.ID); err == nil {
+		t.Error("expected removing twice to fail")
+	}
+	if list, _ := ag.ListSchedules(); len(list) != 1 {
+		t.Errorf("expected 1 schedule left, got %d", len(list))
+	}
+}
+
+func TestConversationTitleAndTags(t *testing.T) {
+	ag := newTestAgent(t)
+	ag.config.Agent.AutoTitle = true
+	ag.provider = &mockProvider{response: "Title: \"Planning the **Atlas** launch\"\nextra"}
+
+	if err := ag.SetConversation("atlas"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+	if _, err := ag.Chat(context.Background(), "Help me plan the launch"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	ag.WaitTitles()
+	ag.provider = &mockProvider{response: "Something else"}
+	if _, err := ag.Chat(context.Background(), "And the budget?"); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	if err := ag.SetConversation("other"); err != nil {
+		t.Fatalf("failed to set conversation: %v", err)
+	}
+	if tags, err := ag.TagConversation("atlas", []string{"Work", "launch"}, nil); err != nil || len(tags) != 2 {
+		t.Fatalf("TagConversation() = %v, %v", tags, err)
+	}
+	if tags, _ := ag.TagConversation("atlas", nil, []string{"launch"}); len(tags) != 1 || tags[0] != "work" {
+		t.Errorf("expected only the work tag left, got %v", tags)
+	}
+
+	infos, err := ag.ConversationInfos()
+	if err != nil || len(infos) != 2 || infos[0].ID != "atlas" {
+		t.Fatalf("expected 2 conversations, last updated first, got %+v (%v)", infos, err)
+	}
+	if infos[0].Title != "Planning the **Atlas** launch" || infos[0].Messages != 4 {
+		t.Errorf("title kept from the first exchange and 4 messages expected, got %+v", infos[0])
+	}
+	if infos, _ = ag.ConversationInfos("work"); len(infos) != 1 || infos[0].ID != "atlas" {
+		t.Errorf("expected only atlas tagged work, got %+v", infos)
+	}
+	if line := FormatConversationInfo(infos[0]); !strings.Contains(line, "4 msgs") || !strings.HasSuffix(line, "[work]") {
+		t.Errorf("unexpected listing: %q", line)
+	}
+
+	if err := ag.SetTitle("other", "Scratch"); err != nil {
+		t.Fatalf("SetTitle() error = %v", err)
+	}
+	if infos, _ = ag.ConversationInfos(); infos[0].Title != "Scratch" {
+		t.Errorf("expected the retitled conversation first, got %+v", infos[0])
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	long := strings.Repeat("word ", 30)
+	for in, want := range map[string]string{
+		"\n  # Debugging the parser  \n": "Debugging the parser",
+		"title: 'Go generics'":           "Go generics",
+		"":                               "",
+		long:                             strings.TrimSpace(long[:80]) + "…",
+	} {
+		if got := cleanTitle(in); got != want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	ag := newTestAgent(t)
+	for _, id := range []string{"old", "middle", "recent"} {
+		if err := ag.store.SaveConversation(&storage.Conversation{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond) // Distinct update times
+	}
+	for _, m := range []*storage.MemoryItem{
+		{ID: "weak", Content: "Maybe likes tea", Relevance: 0.1},
+		{ID: "strong", Content: "Prefers Go", Relevance: 0.9},
+	} {
+		if err := ag.store.SaveMemory(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ag.config.Storage.MaxConversations = 2
+	ag.config.Storage.PruneRelevance = 0.3
+
+	// A dry run only reports
+	result, err := ag.GC(time.Now(), true)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(result.Archived) != 1 || result.Archived[0] != "old" || len(result.Memories) != 1 || result.Memories[0].ID != "weak" {
+		t.Errorf("unexpected dry run %+v", result)
+	}
+	if ids, _ := ag.ListConversations(); len(ids) != 3 {
+		t.Errorf("dry run changed conversations: %v", ids)
+	}
+
+	// Archiving moves the conversation out of the listings
+	if _, err := ag.GC(time.Now(), false); err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if ids, _ := ag.ListConversations(); len(ids) != 2 {
+		t.Errorf("expected 2 conversations left, got %v", ids)
+	}
+	if _, err := os.Stat(filepath.Join(ag.config.Storage.WorkDir, "archive", "messages", "old.json")); err != nil {
+		t.Errorf("expected the archived conversation: %v", err)
+	}
+	if memories, _ := ag.ListMemories(); len(memories) != 1 || memories[0].ID != "strong" {
+		t.Errorf("expected the weak memory pruned, got %+v", memories)
+	}
+
+	// Expired conversations are deleted, except the current one
+	if err := ag.SetConversation("recent"); err != nil {
+		t.Fatal(err)
+	}
+	ag.config.Storage.MaxConversations = 0
+	ag.config.Storage.RetentionDays = 30
+	ag.config.Storage.RetentionAction = "delete"
+	result, err = ag.GC(time.Now().AddDate(0, 0, 31), false)
+	if err != nil {
+		t.Fatalf("GC failed: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != "middle" || len(result.Archived) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if ids, _ := ag.ListConversations(); len(ids) != 1 || ids[0] != "recent" {
+		t.Errorf("expected only the current conversation left, got %v", ids)
+	}
+
+	ag.config.Storage.RetentionAction = "shred"
+	if _, err := ag.GC(time.Now(), true); err == nil {
+		t.Error("expected an error for an unknown retention action")
+	}
+}
+
+func TestRenameAndCloneConversation(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("draft"); err != nil {
+		t.Fatal(err)
+	}
+	conv, _ := ag.store.LoadConversation("draft")
+	conv.Title = "Launch plan"
+	conv.Messages = []llm.Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+	ag.store.SaveConversation(conv)
+	ag.store.SaveDocument(&storage.Document{ConversationID: "draft", Content: "# Plan"})
+	ag.store.SaveMemory(&storage.MemoryItem{ID: "scoped", Content: "Ships in May", Scope: "draft", Relevance: 1})
+	ag.store.SaveRun(&storage.Run{ID: "run-1", ConversationID: "draft"})
+	ag.store.SaveSchedule(&storage.Schedule{ID: "daily", Cron: "0 9 * * *", ConversationID: "draft"})
+	ag.store.SaveEntity(&storage.Entity{Name: "Atlas", Conversations: []string{"draft"}})
+	ag.store.SaveConversation(&storage.Conversation{ID: "taken"})
+
+	if err := ag.RenameConversation("draft", "taken"); err == nil {
+		t.Error("expected an error renaming to an existing conversation")
+	}
+	if err := ag.RenameConversation("draft", "../escape"); err == nil {
+		t.Error("expected an error for an invalid ID")
+	}
+
+	if err := ag.RenameConversation("draft", "work/launch"); err != nil {
+		t.Fatalf("RenameConversation failed: %v", err)
+	}
+	if ag.conversationID != "work/launch" {
+		t.Errorf("expected the current conversation renamed, got %s", ag.conversationID)
+	}
+	if _, err := ag.store.LoadConversation("draft"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected the old ID gone, got %v", err)
+	}
+	renamed, err := ag.store.LoadConversation("work/launch")
+	if err != nil || renamed.Title != "Launch plan" || len(renamed.Messages) != 2 || len(renamed.Tampered) != 0 {
+		t.Fatalf("unexpected renamed conversation %+v, %v", renamed, err)
+	}
+	if doc, err := ag.store.LoadDocument("work/launch"); err != nil || doc.Content != "# Plan" {
+		t.Errorf("expected the document moved, got %+v, %v", doc, err)
+	}
+	if memories, _ := ag.QueryMemories(storage.MemoryFilter{}); len(memories) != 1 || memories[0].Scope != "work/launch" {
+		t.Errorf("expected the scoped memory updated, got %+v", memories)
+	}
+	if run, _ := ag.store.LoadRun("run-1"); run == nil || run.ConversationID != "work/launch" {
+		t.Errorf("expected the run updated, got %+v", run)
+	}
+	if s, _ := ag.store.LoadSchedule("daily"); s == nil || s.ConversationID != "work/launch" {
+		t.Errorf("expected the schedule updated, got %+v", s)
+	}
+	if e, _ := ag.store.LoadEntity("Atlas"); e == nil || !slices.Equal(e.Conversations, []string{"work/launch"}) {
+		t.Errorf("expected the entity updated, got %+v", e)
+	}
+
+	// Cloning copies the conversation and its document, not its memories
+	if err := ag.CloneConversation("work/launch", "work/launch-b"); err != nil {
+		t.Fatalf("CloneConversation failed: %v", err)
+	}
+	clone, err := ag.store.LoadConversation("work/launch-b")
+	if err != nil || len(clone.Messages) != 2 || clone.Title != "Launch plan" {
+		t.Errorf("unexpected clone %+v, %v", clone, err)
+	}
+	if doc, err := ag.store.LoadDocument("work/launch-b"); err != nil || doc.Content != "# Plan" {
+		t.Errorf("expected the document copied, got %+v, %v", doc, err)
+	}
+	if _, err := ag.store.LoadConversation("work/launch"); err != nil {
+		t.Errorf("expected the original kept: %v", err)
+	}
+	if err := ag.CloneConversation("missing", "other"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	// A clone of a conversation modified outside igent stays flagged
+	path := filepath.Join(ag.config.Storage.WorkDir, "messages", "work", "launch.json")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.Replace(data, []byte(`"hello"`), []byte(`"edited"`), 1), 0644)
+	if err := ag.CloneConversation("work/launch", "work/launch-c"); err != nil {
+		t.Fatalf("CloneConversation failed: %v", err)
+	}
+	if clone, err := ag.store.LoadConversation("work/launch-c"); err != nil || len(clone.Tampered) == 0 || clone.Tampered[0].Message != 1 {
+		t.Errorf("expected the clone to keep the modification on record, got %+v, %v", clone, err)
+	}
+}
+
+func TestRenameConversation_Undo(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("draft"); err != nil {
+		t.Fatal(err)
+	}
+	ag.store.SaveDocument(&storage.Document{ConversationID: "draft", Content: "# Plan"})
+	ag.store.SaveRun(&storage.Run{ID: "run-1", ConversationID: "draft"})
+	// Moving the prompt history, the last step, fails: work is a file
+	os.MkdirAll(filepath.Join(ag.config.Storage.WorkDir, "history"), 0755)
+	os.WriteFile(filepath.Join(ag.config.Storage.WorkDir, "history", "work"), nil, 0644)
+
+	if err := ag.RenameConversation("draft", "work/launch"); err == nil {
+		t.Fatal("expected the rename to fail")
+	}
+	if _, err := ag.store.LoadConversation("draft"); err != nil {
+		t.Errorf("expected draft kept: %v", err)
+	}
+	if _, err := ag.store.LoadConversation("work/launch"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected no work/launch, got %v", err)
+	}
+	if doc, err := ag.store.LoadDocument("draft"); err != nil || doc.Content != "# Plan" {
+		t.Errorf("expected the document back, got %+v, %v", doc, err)
+	}
+	if run, _ := ag.store.LoadRun("run-1"); run == nil || run.ConversationID != "draft" {
+		t.Errorf("expected the run back, got %+v", run)
+	}
+	if ag.conversationID != "draft" {
+		t.Errorf("expected the current conversation unchanged, got %s", ag.conversationID)
+	}
+}
+
+func TestConversationHistory(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("draft"); err != nil {
+		t.Fatal(err)
+	}
+	path := ag.HistoryPath("draft")
+	if want := filepath.Join(ag.config.Storage.WorkDir, "history", "draft.txt"); path != want {
+		t.Errorf("expected the history under the work dir, got %s", path)
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte("first prompt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ag.RenameConversation("draft", "work/launch"); err != nil {
+		t.Fatalf("RenameConversation failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected the old history moved away")
+	}
+	data, err := os.ReadFile(ag.HistoryPath("work/launch"))
+	if err != nil || string(data) != "first prompt\n" {
+		t.Errorf("expected the history moved with the conversation, got %q %v", data, err)
+	}
+
+	if err := ag.DeleteConversation("work/launch"); err != nil {
+		t.Fatalf("DeleteConversation failed: %v", err)
+	}
+	if _, err := os.Stat(ag.HistoryPath("work/launch")); !os.IsNotExist(err) {
+		t.Error("expected the history deleted with the conversation")
+	}
+}
+
+func TestRunPlan(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("plan"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.policy, _ = newToolPolicy(map[string]string{"echo": "allow"})
+	echo := func(id string) *llm.Response {
+		return &llm.Response{ToolCalls: []llm.ToolCall{
+			{ID: id, Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}},
+		}}
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "Plan:\n1. Greet the user\n2) Skip this\n**3.** Say goodbye\n\nThat's it."},
+		echo("1"), {Content: "Greeted"},
+		echo("2"), echo("3"), {Content: "Said goodbye"},
+		{Content: "Direct answer"},
+	}}
+	ag.provider = provider
+	prompts := 0
+	ag.SetToolPrompt(func(call *tools.ToolCall) ToolAnswer {
+		prompts++
+		return ToolAnswerAlways
+	})
+
+	var shown *Plan
+	result, err := ag.RunPlan(context.Background(), "greet and leave", PlanOptions{
+		Approve: func(plan *Plan) bool { shown = plan; return true },
+		BeforeStep: func(plan *Plan, i int) PlanStepAction {
+			if i == 1 {
+				return PlanStepSkip
+			}
+			return PlanStepRun
+		},
+	})
+	if err != nil {
+		t.Fatalf("RunPlan failed: %v", err)
+	}
+	if shown == nil || !slices.Equal(shown.Steps, []string{"Greet the user", "Skip this", "Say goodbye"}) {
+		t.Fatalf("unexpected plan %+v", shown)
+	}
+	if result.Ran != 2 || result.Aborted || result.Answers[0] != "Greeted" || result.Answers[1] != "" || result.Answers[2] != "Said goodbye" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(provider.options[0].Tools) != 0 {
+		t.Error("the plan must be made without tools")
+	}
+	// echo is allowed by tools.confirm, but asks once per step in a plan
+	if prompts != 2 {
+		t.Errorf("expected a prompt per step, got %d", prompts)
+	}
+	if got := FormatPlanResult(result); got != "Plan finished: 2 of 3 steps run, 1 skipped." {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	conv, err := ag.store.LoadConversation("plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countUserMessages(conv.Messages); n != 2 {
+		t.Errorf("expected a turn per step run, got %d", n)
+	}
+
+	// Outside of plans, the policy applies again
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{echo("4"), {Content: "Done"}}}
+	if _, err := ag.Chat(context.Background(), "echo"); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if prompts != 2 {
+		t.Errorf("expected no prompt outside of the plan, got %d", prompts)
+	}
+
+	// Denying a tool aborts the plan
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "1. Echo\n2. Stop"}, echo("5"),
+	}}
+	ag.SetToolPrompt(func(call *tools.ToolCall) ToolAnswer { return ToolAnswerNo })
+	result, err = ag.RunPlan(context.Background(), "echo", PlanOptions{})
+	if err != nil {
+		t.Fatalf("RunPlan failed: %v", err)
+	}
+	if !result.Aborted || result.Ran != 0 {
+		t.Errorf("expected the plan aborted, got %+v", result)
+	}
+
+	// A rejected plan runs nothing
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "1. Echo"}}}
+	result, err = ag.RunPlan(context.Background(), "echo", PlanOptions{Approve: func(*Plan) bool { return false }})
+	if err != nil || !result.Aborted || FormatPlanResult(result) != "Plan aborted; no steps were run." {
+		t.Errorf("unexpected rejected plan %+v, %v", result, err)
+	}
+
+	// A reply without a numbered list is no plan
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "Sure, I'll do it."}}}
+	if _, err := ag.MakePlan(context.Background(), "echo"); err == nil {
+		t.Error("expected an error without a numbered plan")
+	}
+}
+
+func TestOrchestrate(t *testing.T) {
+	ag := newTestAgent(t)
+	if _, err := ag.Orchestrate(context.Background(), "anything", OrchestrateOptions{}); err == nil || !strings.Contains(err.Error(), "no agent profiles") {
+		t.Errorf("expected an error without profiles, got %v", err)
+	}
+
+	ag.config.Profiles = map[string]config.ProfileConfig{
+		"coder":    {Description: "Writes code", SystemPrompt: "You write code"},
+		"reviewer": {Description: "Reviews code", SystemPrompt: "You review code", DisabledTools: []string{"*"}},
+	}
+	if err := ag.SetConversation("orchestrate"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "Let me think about it."},
+		{Content: "```json\n{\"agent\": \"coder\", \"task\": \"Write hello.go\"}\n```"},
+		{Content: "Wrote hello.go"},
+		{Content: `{"agent": "tester", "task": "Test it"}`},
+		{Content: `{"agent": "reviewer", "task": "Review hello.go"}`},
+		{Content: "Looks good"},
+		{Content: `{"answer": "hello.go is written and reviewed"}`},
+	}}
+	ag.provider = provider
+
+	var delegated []string
+	result, err := ag.Orchestrate(context.Background(), "Write a hello world", OrchestrateOptions{
+		OnDelegate: func(d Delegation) { delegated = append(delegated, d.Profile+": "+d.Task) },
+	})
+	if err != nil {
+		t.Fatalf("Orchestrate failed: %v", err)
+	}
+	if result.Answer != "hello.go is written and reviewed" {
+		t.Errorf("unexpected answer %q", result.Answer)
+	}
+	if !slices.Equal(delegated, []string{"coder: Write hello.go", "tester: Test it", "reviewer: Review hello.go"}) {
+		t.Errorf("unexpected delegations %v", delegated)
+	}
+	if len(result.Delegations) != 3 || result.Delegations[0].Result != "Wrote hello.go" ||
+		result.Delegations[1].Err == nil || result.Delegations[2].Result != "Looks good" {
+		t.Errorf("unexpected result %+v", result.Delegations)
+	}
+
+	// The coordinator is told about bad replies and failed subtasks
+	retry := provider.requests[1]
+	if last := retry[len(retry)-1]; !strings.Contains(last.Content, "no JSON object") {
+		t.Errorf("expected the coordinator to be asked again, got %q", last.Content)
+	}
+	failed := provider.requests[4]
+	if last := failed[len(failed)-1]; !strings.Contains(last.Content, "tester failed: unknown profile") {
+		t.Errorf("expected the failure reported to the coordinator, got %q", last.Content)
+	}
+	// Profile agents run with their own prompt and tool policy
+	if !strings.Contains(provider.requests[2][0].Content, "You write code") {
+		t.Errorf("expected the coder prompt, got %q", provider.requests[2][0].Content)
+	}
+	if len(provider.options[2].Tools) == 0 || len(provider.options[5].Tools) != 0 {
+		t.Error("expected tools for the coder profile only")
+	}
+
+	for id, want := range map[string]int{"orchestrate": 2, "orchestrate/coder": 2, "orchestrate/reviewer": 2} {
+		conv, err := ag.store.LoadConversation(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(conv.Messages) != want {
+			t.Errorf("expected %d messages in %s, got %d", want, id, len(conv.Messages))
+		}
+	}
+
+	// On the console, delegations go to the notices and results to write
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: `{"agent": "coder", "task": "Fix hello.go"}`},
+		{Content: "Fixed"},
+		{Content: `{"answer": "hello.go is fixed"}`},
+	}}
+	var notices, written strings.Builder
+	ag.SetNotices(&notices)
+	if _, err := ag.OrchestrateConsole(context.Background(), "Fix it", func(s string) { written.WriteString(s) }); err != nil {
+		t.Fatalf("OrchestrateConsole failed: %v", err)
+	}
+	if notices.String() != "→ coder: Fix hello.go\n\n" || strings.Contains(written.String(), "→") || !strings.HasSuffix(written.String(), "hello.go is fixed") {
+		t.Errorf("notices = %q, written = %q", notices.String(), written.String())
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("recorded"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}}}},
+		{Content: "Echoed"},
+		{Content: "Bye"},
+	}}
+	var buf strings.Builder
+	ag.SetRecorder(transcript.NewRecorder(&buf, nil))
+	for _, prompt := range []string{"echo hi", "bye"} {
+		if _, err := ag.Chat(context.Background(), prompt); err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+	}
+	ag.SetRecorder(nil)
+
+	events, err := transcript.Read(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	turns := transcript.Turns(events)
+	if len(turns) != 2 || turns[0].Session == nil || turns[0].Session.Model != "test-model" {
+		t.Fatalf("unexpected turns %+v", turns)
+	}
+	if turns[0].ToolCalls() != 1 || turns[0].Tools[1].Output != "hi" || turns[0].Outcome() != "Echoed" || turns[1].Outcome() != "Bye" {
+		t.Errorf("unexpected recorded turns %+v", turns)
+	}
+
+	// Replaying sends the prompts again and reports the new answers
+	if err := ag.SetConversation("replay"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "Echo: hi"}}}
+	var before []int
+	results, err := ag.Replay(context.Background(), turns, ReplayOptions{
+		BeforeTurn: func(i int, _ transcript.Turn) { before = append(before, i) },
+	})
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(results) != 2 || !slices.Equal(before, []int{0, 1}) {
+		t.Fatalf("unexpected replay %+v", results)
+	}
+	if results[0].Replayed.Outcome() != "Echo: hi" || results[0].Replayed.ToolCalls() != 0 || results[0].Recorded.Outcome() != "Echoed" {
+		t.Errorf("unexpected first replayed turn %+v", results[0])
+	}
+	if results[1].Replayed.Outcome() != "response-1" {
+		t.Errorf("unexpected second replayed turn %+v", results[1])
+	}
+	if ag.recorder != nil {
+		t.Error("replay must not leave a recorder behind")
+	}
+}
+
+func TestUndoAndRetry(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("retry"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "First answer"},
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}}}},
+		{Content: "Second answer"},
+		{Content: "Second answer, again"},
+	}}
+	ag.provider = provider
+	for _, input := range []string{"first", "second"} {
+		if _, err := ag.Chat(context.Background(), input); err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+	}
+
+	temperature := 0.0
+	response, err := ag.Retry(context.Background(), RetryOptions{Temperature: &temperature}, nil)
+	if err != nil || response != "Second answer, again" {
+		t.Fatalf("Retry = %q, %v", response, err)
+	}
+	last := provider.requests[len(provider.requests)-1]
+	if last[len(last)-1].Content != "second" || slices.ContainsFunc(last, func(m llm.Message) bool { return m.Content == "Second answer" }) {
+		t.Errorf("expected the input sent again without the old answer, got %+v", last)
+	}
+	if sent := provider.options[len(provider.options)-1].Temperature; sent == nil || *sent != 0 || ag.temperature != nil {
+		t.Error("expected a zero temperature for the retried turn only")
+	}
+	conv, err := ag.store.LoadConversation("retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conv.Messages) != 4 || conv.Messages[3].Content != "Second answer, again" || len(conv.ToolCalls) != 0 {
+		t.Errorf("expected the old exchange replaced, got %d messages, %d tool records", len(conv.Messages), len(conv.ToolCalls))
+	}
+
+	// A failed retry keeps the old exchange
+	provider.completeError = errors.New("provider down")
+	if _, err := ag.Retry(context.Background(), RetryOptions{}, nil); err == nil {
+		t.Error("expected the retry to fail")
+	}
+	if conv, _ := ag.store.LoadConversation("retry"); len(conv.Messages) != 4 {
+		t.Errorf("expected the exchange kept after a failed retry, got %d messages", len(conv.Messages))
+	}
+
+	for _, want := range []string{"second", "first"} {
+		if input, err := ag.Undo(); err != nil || input != want {
+			t.Errorf("Undo = %q, %v; want %q", input, err, want)
+		}
+	}
+	if _, err := ag.Undo(); !errors.Is(err, ErrNoExchange) {
+		t.Errorf("expected ErrNoExchange, got %v", err)
+	}
+	if _, err := ag.Retry(context.Background(), RetryOptions{}, nil); !errors.Is(err, ErrNoExchange) {
+		t.Errorf("expected ErrNoExchange, got %v", err)
+	}
+
+	opts, err := ParseRetryOptions([]string{"gpt-4o", "0.2"})
+	if err != nil || opts.Model != "gpt-4o" || opts.Temperature == nil || *opts.Temperature != 0.2 {
+		t.Errorf("ParseRetryOptions = %+v, %v", opts, err)
+	}
+	if opts, err := ParseRetryOptions([]string{"0"}); err != nil || opts.Temperature == nil || *opts.Temperature != 0 {
+		t.Errorf("expected /retry 0 to set a zero temperature, got %+v, %v", opts, err)
+	}
+	if _, err := ParseRetryOptions([]string{"3"}); err == nil {
+		t.Error("expected an out of range temperature to fail")
+	}
+}
+
+func TestRetry_Model(t *testing.T) {
+	var models []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Model string }
+		json.NewDecoder(r.Body).Decode(&body)
+		models = append(models, body.Model)
+		fmt.Fprintf(w, `{"choices": [{"message": {"role": "assistant", "content": "from %s"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 1000, "completion_tokens": 1000}}`, body.Model)
+	}))
+	defer srv.Close()
+
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("retry"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.config.Provider.BaseURL = srv.URL
+	ag.config.Provider.InputPrice, ag.config.Provider.OutputPrice = 1, 2
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "from test-model"}}}
+	if _, err := ag.Chat(context.Background(), "hi"); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	response, err := ag.Retry(context.Background(), RetryOptions{Model: "other-model"}, nil)
+	if err != nil || response != "from other-model" {
+		t.Fatalf("Retry = %q, %v", response, err)
+	}
+	if !slices.Equal(models, []string{"other-model"}) {
+		t.Errorf("expected one request to other-model, got %v", models)
+	}
+	if _, ok := ag.provider.(*mockProviderWithCustomBehavior); !ok {
+		t.Error("expected the configured provider back after the retry")
+	}
+	// The configured prices are test-model's, not other-model's
+	if ag.lastResult.Model != "other-model" || ag.lastResult.Cost != 0 {
+		t.Errorf("expected an unpriced answer from other-model, got %s at $%g", ag.lastResult.Model, ag.lastResult.Cost)
+	}
+	if ag.model != ag.config.Provider.Model {
+		t.Errorf("expected the configured model back after the retry, got %s", ag.model)
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("guarded"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.config.Guardrails = config.GuardrailsConfig{
+		Input: []config.GuardrailRule{
+			{Name: "drop-table", Pattern: `(?i)drop\s+table`},
+			{Name: "email", Pattern: `[\w.]+@[\w.]+`, Action: "redact"},
+		},
+		Output: []config.GuardrailRule{
+			{Name: "rm-rf", Pattern: `rm -rf /`},
+			{Name: "api-key", Pattern: `sk-[A-Za-z0-9]{8,}`, Action: "redact"},
+		},
+		MaxOutputChars: 60,
+	}
+	guard, err := NewGuard(ag.config.Guardrails)
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+	ag.guard = guard
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "rm -rf /"}`}}}},
+		{Content: "Your key is sk-abcdefgh1234"},
+		{Content: strings.Repeat("x", 100)},
+	}}
+	ag.provider = provider
+
+	var streamed string
+	response, err := chatText(ag.ChatStream(context.Background(), "mail ann@example.com", func(chunk string) { streamed += chunk }))
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	if response != "Your key is [redacted: api-key]" || streamed != response {
+		t.Errorf("expected the answer redacted before it is shown, got %q, streamed %q", response, streamed)
+	}
+	first := provider.requests[0]
+	if got := first[len(first)-1].Content; got != "mail [redacted: email]" {
+		t.Errorf("expected the input redacted for the model, got %q", got)
+	}
+	second := provider.requests[1]
+	if got := second[len(second)-1]; got.Role != "tool" || !strings.Contains(got.Content, "tool call blocked by guardrail rm-rf") {
+		t.Errorf("expected the tool call blocked, got %+v", got)
+	}
+
+	// Blocked input never reaches the model or the conversation
+	var blocked *guardrails.BlockedError
+	if _, err := ag.Chat(context.Background(), "please DROP TABLE users"); !errors.As(err, &blocked) || blocked.Rule != "drop-table" {
+		t.Errorf("expected the input blocked, got %v", err)
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("expected no request for blocked input, got %d requests", len(provider.requests))
+	}
+
+	response, err = chatText(ag.Chat(context.Background(), "long please"))
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if !strings.HasPrefix(response, strings.Repeat("x", 60)+"\n\n[Cut at 60") {
+		t.Errorf("expected the answer cut, got %q", response)
+	}
+
+	conv, err := ag.store.LoadConversation("guarded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conv.Messages) != 6 || conv.Messages[0].Content != "mail [redacted: email]" || conv.Messages[3].Content != "Your key is [redacted: api-key]" {
+		t.Errorf("expected the screened turns saved, got %+v", conv.Messages)
+	}
+
+	events, err := ag.store.LoadGuardrailEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules []string
+	for _, e := range events {
+		if e.Conversation != "guarded" {
+			t.Errorf("unexpected conversation in %+v", e)
+		}
+		rules = append(rules, e.Stage+":"+e.Rule)
+	}
+	want := []string{"input:email", "tool_call:rm-rf", "output:api-key", "input:drop-table", "output:max_output_chars"}
+	if !slices.Equal(rules, want) {
+		t.Errorf("audit = %v, want %v", rules, want)
+	}
+
+	// Debates and plans are screened like turns
+	if _, err := ag.Debate(context.Background(), "drop table users?", DebateOptions{Agents: 2}); !errors.As(err, &blocked) || blocked.Rule != "drop-table" {
+		t.Errorf("expected the debate question blocked, got %v", err)
+	}
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{{Content: "1. Run rm -rf /"}}}
+	if _, err := ag.MakePlan(context.Background(), "clean up"); !errors.As(err, &blocked) || blocked.Rule != "rm-rf" {
+		t.Errorf("expected the plan blocked, got %v", err)
+	}
+}
+
+func TestGuardrails_Moderation(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("moderated"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	ag.config.Guardrails = config.GuardrailsConfig{Moderation: true, ModerationPolicy: "No insults."}
+	guard, err := NewGuard(ag.config.Guardrails)
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+	ag.guard = guard
+	ag.guard.SetModerator(ag.moderate)
+	provider := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "SAFE"},
+		{Content: "You fool"},
+		{Content: "UNSAFE: insult"},
+	}}
+	ag.provider = provider
+
+	response, err := chatText(ag.Chat(context.Background(), "Hi"))
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if response != "[Answer withheld: output blocked by guardrail moderation: insult]" {
+		t.Errorf("expected the answer withheld, got %q", response)
+	}
+	if policy := provider.requests[2][0].Content; !strings.Contains(policy, "No insults.") {
+		t.Errorf("expected the moderation policy in the request, got %q", policy)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("traced"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	ag.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+	ag.provider = &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "hi"}`}}}, PromptTokens: 12},
+		{Content: "Done", PromptTokens: 20, OutputTokens: 3},
+	}}
+
+	if _, err := ag.Chat(context.Background(), "echo hi"); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	spans := recorder.Ended()
+	var chat sdktrace.ReadOnlySpan
+	names := make(map[string]int)
+	for _, s := range spans {
+		names[s.Name()]++
+		if s.Name() == "igent.chat" {
+			chat = s
+		}
+	}
+	if chat == nil {
+		t.Fatalf("expected a chat span, got %v", names)
+	}
+	want := map[string]int{"igent.chat": 1, "igent.build_context": 1, "chat test-model": 2, "execute_tool echo": 1, "igent.save_turn": 1}
+	for name, n := range want {
+		if names[name] != n {
+			t.Errorf("expected %d %q spans, got %v", n, name, names)
+		}
+	}
+	for _, s := range spans {
+		if s != chat && s.Parent().SpanID() != chat.SpanContext().SpanID() {
+			t.Errorf("expected %s under the chat span", s.Name())
+		}
+		if s.Name() == "chat test-model" && s.SpanKind() != trace.SpanKindClient {
+			t.Errorf("expected provider calls as client spans")
+		}
+	}
+	attrs := attribute.NewSet(chat.Attributes()...)
+	if v, _ := attrs.Value("igent.conversation"); v.AsString() != "traced" {
+		t.Errorf("expected the conversation on the chat span, got %v", chat.Attributes())
+	}
+	if v, _ := attrs.Value("igent.turn"); v.AsInt64() != 1 {
+		t.Errorf("expected the turn on the chat span, got %v", chat.Attributes())
+	}
+	for _, s := range spans {
+		if s.Name() != "chat test-model" {
+			continue
+		}
+		usage := attribute.NewSet(s.Attributes()...)
+		if v, _ := usage.Value("gen_ai.usage.input_tokens"); v.AsInt64() != 12 {
+			t.Errorf("expected the usage of the first call, got %v", s.Attributes())
+		}
+		break
+	}
+}
+
+func TestCritique(t *testing.T) {
+	ag := newTestAgent(t)
+	if err := ag.SetConversation("reviewed"); err != nil {
+		t.Fatalf("SetConversation failed: %v", err)
+	}
+	if err := ag.SetCritique("on"); err != nil || ag.Critique() != CritiqueNote {
+		t.Fatalf("SetCritique(on) = %v, mode %q", err, ag.Critique())
+	}
+	mock := &mockStreamingProvider{mockProviderWithCustomBehavior: mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{ToolCalls: []llm.ToolCall{{ID: "1", Type: "function", Function: &llm.ToolCallFunction{Name: "echo", Arguments: `{"text": "42"}`}}}},
+		{Content: "The answer is 41"},
+		{Content: "```json\n{\"confidence\": \"Low\", \"issues\": [\"The tool said 42\"]}\n```"},
+		{Content: "The answer is 41"},
+		{Content: `{"confidence": "low", "issues": ["Off by one"], "revision": "The answer is 42"}`},
+		{Content: "Fine answer"},
+		{Content: "no verdict"},
+	}}}
+	ag.provider = mock
+
+	// Note mode streams the answer, then the note
+	var chunks []string
+	response, err := chatText(ag.ChatStream(context.Background(), "what is it?", func(s string) { chunks = append(chunks, s) }))
+	if err != nil {
+		t.Fatalf("ChatStream failed: %v", err)
+	}
+	want := "The answer is 41\n\n---\nReview: low confidence. Possible issues:\n- The tool said 42"
+	if response != want || strings.Join(chunks, "") != want || len(chunks) != 2 {
+		t.Errorf("unexpected answer %q, chunks %q", response, chunks)
+	}
+	review := mock.requests[2]
+	if !strings.Contains(review[0].Content, `"issues"`) || strings.Contains(review[0].Content, "revision") {
+		t.Errorf("unexpected reviewer persona %q", review[0].Content)
+	}
+	for _, part := range []string{"## Request\n\nwhat is it?", "### echo", "42", "## Draft answer\n\nThe answer is 41"} {
+		if !strings.Contains(review[1].Content, part) {
+			t.Errorf("expected %q in the review prompt, got %q", part, review[1].Content)
+		}
+	}
+
+	// Revise mode shows only the revision
+	if err := ag.SetCritique("revise"); err != nil {
+		t.Fatal(err)
+	}
+	chunks = nil
+	response, err = chatText(ag.ChatStream(context.Background(), "again?", func(s string) { chunks = append(chunks, s) }))
+	if err != nil || response != "The answer is 42" || strings.Join(chunks, "") != response {
+		t.Errorf("expected the revision shown, got %q, chunks %q, %v", response, chunks, err)
+	}
+
+	// A failed review keeps the answer
+	if response, err := chatText(ag.Chat(context.Background(), "and now?")); err != nil || response != "Fine answer" {
+		t.Errorf("expected the answer kept, got %q, %v", response, err)
+	}
+
+	conv, err := ag.store.LoadConversation("reviewed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conv.Messages[len(conv.Messages)-3].Content; got != "The answer is 42" {
+		t.Errorf("expected the revision saved, got %q", got)
+	}
+
+	if _, err := ParseCritiqueMode("loud"); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+}
+
+func TestExpandAttachments(t *testing.T) {
+	ag := newTestAgent(t)
+	dir := t.TempDir()
+	small := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(small, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	large := filepath.Join(dir, "big.log")
+	if err := os.WriteFile(large, []byte(strings.Repeat("line of log output\n", 2000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(binary, []byte{0x7f, 'E', 'L', 'F', 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// References to files are inlined, others left alone
+	got, err := ag.ExpandAttachments(context.Background(), "explain @"+small+", then ping @alice or bob@"+small)
+	if err != nil {
+		t.Fatalf("ExpandAttachments failed: %v", err)
+	}
+	want := "explain " + small + ", then ping @alice or bob@" + small +
+		"\n\n## Attached file: " + small + " (3 lines)\n\n```\npackage main\n\nfunc main() {}\n```"
+	if got != want {
+		t.Errorf("unexpected expansion:\n%s", got)
+	}
+	if got, _ := ag.ExpandAttachments(context.Background(), "no files here"); got != "no files here" {
+		t.Errorf("expected the input unchanged, got %q", got)
+	}
+
+	// Queued files go with the next message only; large ones are summarized
+	ag.config.Agent.AttachmentMaxBytes = 10000
+	mock := &mockProviderWithCustomBehavior{responses: []*llm.Response{
+		{Content: "Repeated log lines."}, {Content: "More of them."}, {Content: "The rest."},
+	}}
+	ag.provider = mock
+	if _, err := ag.Attach(large); err != nil {
+		t.Fatalf("Attach failed: %v", err)
+	}
+	if _, err := ag.Attach(dir); err == nil {
+		t.Error("expected attaching a directory to fail")
+	}
+	got, err = ag.ExpandAttachments(context.Background(), "why does it repeat?")
+	if err != nil {
+		t.Fatalf("ExpandAttachments failed: %v", err)
+	}
+	if !strings.Contains(got, "summarized in 3 parts") || !strings.Contains(got, "### Part 2 of 3\n\nMore of them.") {
+		t.Errorf("expected a summary in parts, got:\n%s", got)
+	}
+	if len(mock.requests) != 3 || !strings.Contains(mock.requests[0][1].Content, "why does it repeat?") {
+		t.Errorf("expected each part summarized for the message, got %d requests", len(mock.requests))
+	}
+	if len(ag.Attachments()) != 0 {
+		t.Errorf("expected the queue emptied, got %v", ag.Attachments())
+	}
+
+	if _, err := ag.ExpandAttachments(context.Background(), "what is @"+binary); err == nil || !strings.Contains(err.Error(), "not a text file") {
+		t.Errorf("expected binary files refused, got %v", err)
+	}
+}
+
+func TestAttachInput(t *testing.T) {
+	ag := newTestAgent(t)
+	got, err := ag.AttachInput(context.Background(), "what's wrong here?", "standard input", []byte("panic: nil map\n"))
+	if err != nil {
+		t.Fatalf("AttachInput failed: %v", err)
+	}
+	if want := "what's wrong here?\n\n## Attached standard input (1 lines)\n\n```\npanic: nil map\n```"; got != want {
+		t.Errorf("unexpected prompt %q", got)
+	}
+	if got, _ := ag.AttachInput(context.Background(), "hi", "standard input", []byte("\n")); got != "hi" {
+		t.Errorf("expected empty input ignored, got %q", got)
+	}
+
+	// Input beyond what is summarized keeps its end
+	ag.config.Agent.AttachmentMaxBytes = 1000
+	mock := &mockProviderWithCustomBehavior{}
+	for i := 0; i < maxAttachParts; i++ {
+		mock.responses = append(mock.responses, &llm.Response{Content: fmt.Sprintf("part %d", i+1)})
+	}
+	ag.provider = mock
+	log := strings.Repeat("ok\n", attachChunkBytes*maxAttachParts/3) + "FATAL: disk full\n"
+	got, err = ag.AttachInput(context.Background(), "why did it stop?", "standard input", []byte(log))
+	if err != nil {
+		t.Fatalf("AttachInput failed: %v", err)
+	}
+	if len(mock.requests) != maxAttachParts || !strings.Contains(got, "bytes were left out") {
+		t.Errorf("expected %d summarized parts without the start, got %d requests:\n%.300s", maxAttachParts, len(mock.requests), got)
+	}
+	if last := mock.requests[len(mock.requests)-1][1].Content; !strings.Contains(last, "FATAL: disk full") {
+		t.Errorf("expected the end of the input summarized, got %.200s", last)
+	}
+}
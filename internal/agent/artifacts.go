@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// minArtifactLines is the smallest code block captured automatically
+const minArtifactLines = 5
+
+// codeBlock is a fenced code block from a response
+type codeBlock struct {
+	Language string
+	Content  string
+}
+
+// extractCodeBlocks returns the fenced code blocks of a markdown response
+func extractCodeBlocks(text string) []codeBlock {
+	var blocks []codeBlock
+	var current *codeBlock
+	var lines []string
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "```") {
+			if current != nil {
+				lines = append(lines, line)
+			}
+			continue
+		}
+
+		if current == nil {
+			current = &codeBlock{Language: strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))}
+			lines = nil
+			continue
+		}
+
+		current.Content = strings.Join(lines, "\n") + "\n"
+		blocks = append(blocks, *current)
+		current = nil
+	}
+
+	return blocks
+}
+
+// saveResponseArtifacts stores sizeable code blocks of a response as artifacts
+func (a *Agent) saveResponseArtifacts(response string, turn int) {
+	n := 0
+	for _, block := range extractCodeBlocks(response) {
+		if strings.Count(block.Content, "\n") < minArtifactLines {
+			continue
+		}
+		n++
+
+		name := fmt.Sprintf("%s-%d-%d%s", a.conversationID, turn, n, artifactExt(block.Language))
+		_, err := a.store.SaveArtifact(&storage.Artifact{
+			Name:           name,
+			Language:       block.Language,
+			ConversationID: a.conversationID,
+			Turn:           turn,
+		}, []byte(block.Content))
+		if err != nil {
+			a.log.Warn("failed to save artifact", "name", name, "error", err)
+		}
+	}
+}
+
+// artifactExt maps a code block language to a file extension
+func artifactExt(language string) string {
+	switch strings.ToLower(language) {
+	case "":
+		return ".txt"
+	case "go", "golang":
+		return ".go"
+	case "python", "py":
+		return ".py"
+	case "javascript", "js":
+		return ".js"
+	case "typescript", "ts":
+		return ".ts"
+	case "bash", "sh", "shell", "zsh":
+		return ".sh"
+	case "markdown", "md":
+		return ".md"
+	case "yaml", "yml":
+		return ".yaml"
+	case "rust", "rs":
+		return ".rs"
+	default:
+		return "." + strings.ToLower(language)
+	}
+}
+
+// ListArtifacts returns stored artifacts, optionally for one conversation
+func (a *Agent) ListArtifacts(conversationID string) ([]*storage.Artifact, error) {
+	artifacts, err := a.store.ListArtifacts()
+	if err != nil || conversationID == "" {
+		return artifacts, err
+	}
+
+	var filtered []*storage.Artifact
+	for _, art := range artifacts {
+		if art.ConversationID == conversationID {
+			filtered = append(filtered, art)
+		}
+	}
+	return filtered, nil
+}
+
+// GetArtifact resolves an artifact by hash prefix or name and returns its content
+func (a *Agent) GetArtifact(ref string) (*storage.Artifact, []byte, error) {
+	art, err := a.store.FindArtifact(ref)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding artifact %s: %w", ref, err)
+	}
+	content, err := a.store.ReadArtifact(art)
+	if err != nil {
+		return nil, nil, err
+	}
+	return art, content, nil
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/render"
+)
+
+const (
+	attachChunkBytes = 16000 // Size of the parts a large attachment is summarized in
+	maxAttachParts   = 20    // Parts summarized at most; larger attachments keep their end
+)
+
+// attachSummaryPersona is the system prompt of the sub-agent summarizing
+// large attachments
+const attachSummaryPersona = `You summarize one part of a file the user attached to a message, ` +
+	`so another assistant can answer the message without the full file. ` +
+	`Keep what the message is likely to need: names of functions, types and settings, signatures, ` +
+	`important values, errors and line-level details relevant to the message. Reply with the summary only.`
+
+// attachRef matches @path references; an @ inside a word (mail addresses)
+// is not one
+var attachRef = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// Attach queues a file to be included in the next message
+func (a *Agent) Attach(path string) (int64, error) {
+	info, err := os.Stat(resolvePromptPath(path))
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, fmt.Errorf("%s is a directory", path)
+	}
+	for _, p := range a.attachments {
+		if p == path {
+			return info.Size(), nil
+		}
+	}
+	a.attachments = append(a.attachments, path)
+	return info.Size(), nil
+}
+
+// Attachments returns the files queued for the next message
+func (a *Agent) Attachments() []string {
+	return a.attachments
+}
+
+// ExpandAttachments includes the files referenced as @path in input and the
+// files queued with Attach in the message, each framed with its name. Files
+// larger than agent.attachment_max_bytes are summarized in chunks instead.
+// References to paths that are not files, such as @someone, are left as
+// they are.
+func (a *Agent) ExpandAttachments(ctx context.Context, input string) (string, error) {
+	paths := append([]string(nil), a.attachments...)
+
+	input = attachRef.ReplaceAllStringFunc(input, func(m string) string {
+		sub := attachRef.FindStringSubmatch(m)
+		path, rest := splitAttachRef(sub[2])
+		if path == "" {
+			return m
+		}
+		paths = append(paths, path)
+		return sub[1] + path + rest
+	})
+	if len(paths) == 0 {
+		return input, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(input)
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		section, err := a.attachment(ctx, path, input)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString("\n\n")
+		sb.WriteString(section)
+	}
+	a.attachments = nil
+	return sb.String(), nil
+}
+
+// AttachInputLimit is the most of a piped input an attachment can use:
+// agent.attachment_max_bytes inlined, or the parts summarized of larger
+// input
+func AttachInputLimit(cfg *config.Config) int {
+	return max(cfg.Agent.AttachmentMaxBytes, maxAttachParts*attachChunkBytes)
+}
+
+// splitAttachRef finds the file an @ reference names, trimming trailing
+// punctuation that is not part of it; path is empty if there is no such file
+func splitAttachRef(ref string) (path, rest string) {
+	for candidate := ref; candidate != ""; candidate = candidate[:len(candidate)-1] {
+		if info, err := os.Stat(resolvePromptPath(candidate)); err == nil && !info.IsDir() {
+			return candidate, ref[len(candidate):]
+		}
+		if !strings.ContainsAny(candidate[len(candidate)-1:], `.,;:!?)]}"'`) {
+			break
+		}
+	}
+	return "", ref
+}
+
+// attachment renders one attached file for the message
+func (a *Agent) attachment(ctx context.Context, path, input string) (string, error) {
+	data, err := os.ReadFile(resolvePromptPath(path))
+	if err != nil {
+		return "", fmt.Errorf("attaching %s: %w", path, err)
+	}
+	return a.renderAttachment(ctx, "file: "+path, data, input)
+}
+
+// AttachInput appends data, such as piped standard input, to input as an
+// attachment called name; large data is summarized like large files
+func (a *Agent) AttachInput(ctx context.Context, input, name string, data []byte) (string, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return input, nil
+	}
+	section, err := a.renderAttachment(ctx, name, data, input)
+	if err != nil {
+		return "", err
+	}
+	return input + "\n\n" + section, nil
+}
+
+// renderAttachment frames data under an "Attached <label>" heading, inline
+// or summarized in parts when it exceeds agent.attachment_max_bytes. Data
+// too large to summarize in maxAttachParts parts keeps only its end, where
+// logs have their latest lines.
+func (a *Agent) renderAttachment(ctx context.Context, label string, data []byte, input string) (string, error) {
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return "", fmt.Errorf("attaching %s: not a text file", label)
+	}
+	content := string(data)
+	lines := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") && content != "" {
+		lines++
+	}
+
+	limit := a.config.Agent.AttachmentMaxBytes
+	if limit <= 0 || len(content) <= limit {
+		a.log.Info("attached", "name", label, "bytes", len(content))
+		return fmt.Sprintf("## Attached %s (%d lines)\n\n%s", label, lines, render.Fence(content, "")), nil
+	}
+
+	chunks := splitChunks(content, attachChunkBytes)
+	omitted := 0
+	if n := len(chunks) - maxAttachParts; n > 0 {
+		for _, chunk := range chunks[:n] {
+			omitted += len(chunk)
+		}
+		chunks = chunks[n:]
+	}
+	summary, err := a.summarizeAttachment(ctx, label, chunks, input)
+	if err != nil {
+		return "", fmt.Errorf("summarizing %s: %w", label, err)
+	}
+	a.log.Info("attached as summary", "name", label, "bytes", len(content), "parts", len(chunks), "omitted", omitted)
+	detail := fmt.Sprintf("%d lines, %d bytes; too large to include, summarized in %d parts", lines, len(content), len(chunks))
+	if omitted > 0 {
+		detail += fmt.Sprintf("; the first %d bytes were left out", omitted)
+	}
+	return fmt.Sprintf("## Attached %s (%s)\n\n%s", label, detail, summary), nil
+}
+
+// summarizeAttachment summarizes the parts of an attachment with input as
+// the message the summaries should serve
+func (a *Agent) summarizeAttachment(ctx context.Context, label string, chunks []string, input string) (string, error) {
+	summarizer, err := a.newSubAgent("attachments", attachSummaryPersona, a.config.Agent.AttachmentModel)
+	if err != nil {
+		return "", err
+	}
+	summaries := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		prompt := fmt.Sprintf("## Message\n\n%s\n\n## Attached %s, part %d of %d\n\n%s", input, label, i+1, len(chunks), render.Fence(chunk, ""))
+		summary, err := summarizer.ask(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(summary) == "" {
+			return "", errors.New("empty summary")
+		}
+		summaries[i] = fmt.Sprintf("### Part %d of %d\n\n%s", i+1, len(chunks), strings.TrimSpace(summary))
+	}
+	return strings.Join(summaries, "\n\n"), nil
+}
+
+// splitChunks splits text into parts of at most size bytes, at line breaks
+// where possible
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		cut := strings.LastIndexByte(text[:size], '\n') + 1
+		if cut == 0 {
+			cut = size
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// ErrBudgetExceeded is returned when a token budget is used up and going
+// past it was not approved
+var ErrBudgetExceeded = errors.New("token budget exceeded")
+
+// Budget scopes
+const (
+	BudgetTurn         = "turn"
+	BudgetConversation = "conversation"
+	BudgetDaily        = "daily"
+)
+
+// Budget actions (budget.on_exceed)
+const (
+	BudgetAsk    = "ask"    // Ask whether to go past the budget; refuse without a prompt
+	BudgetRefuse = "refuse" // Stop the turn
+)
+
+// BudgetError reports the token budget a turn ran into
+type BudgetError struct {
+	Scope string // turn, conversation or daily
+	Limit int    // Tokens
+	Used  int
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("%s token budget of %d exceeded (%d used)", e.Scope, e.Limit, e.Used)
+}
+
+func (e *BudgetError) Unwrap() error { return ErrBudgetExceeded }
+
+// StatusCode is the HTTP status an API answers a BudgetError with
+func (e *BudgetError) StatusCode() int { return http.StatusTooManyRequests }
+
+// BudgetPromptFunc asks the user whether to go past a used up budget
+type BudgetPromptFunc func(err *BudgetError) bool
+
+// budget enforces the budget.* token limits. Turn usage is counted by the
+// agentic loop; conversation and daily usage come from the usage ledger.
+// Going past a limit once approved allows another limit's worth of tokens.
+// Side completions check it from other goroutines.
+type budget struct {
+	limits config.BudgetConfig
+	store  *storage.JSONStore
+	user   string // Ledger subject of the daily budget
+	log    *slog.Logger
+
+	mu      sync.Mutex
+	allowed map[string]int // Tokens approved past a limit, by scope key
+}
+
+func newBudget(cfg *config.Config, store *storage.JSONStore, user string, log *slog.Logger) (*budget, error) {
+	switch strings.ToLower(cfg.Budget.OnExceed) {
+	case "", BudgetAsk, BudgetRefuse:
+	default:
+		return nil, fmt.Errorf("budget.on_exceed: %q is not ask or refuse", cfg.Budget.OnExceed)
+	}
+	return &budget{
+		limits:  cfg.Budget,
+		store:   store,
+		user:    user,
+		log:     log,
+		allowed: make(map[string]int),
+	}, nil
+}
+
+// startTurn forgets what was approved past the turn budget
+func (b *budget) startTurn() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.allowed, BudgetTurn)
+}
+
+// check returns a BudgetError for the first budget the turn has used up;
+// turnTokens is what the turn used so far. Calls outside a conversation
+// pass "" and skip the conversation budget.
+func (b *budget) check(now time.Time, conversation string, turnTokens int) *BudgetError {
+	l := b.limits
+	if err := b.exceeded(BudgetTurn, BudgetTurn, l.TurnTokens, func() (int, error) { return turnTokens, nil }); err != nil {
+		return err
+	}
+	if conversation != "" {
+		if err := b.exceeded(BudgetConversation, BudgetConversation+":"+conversation, l.ConversationTokens, func() (int, error) {
+			total, err := b.store.LoadUsageTotal(conversationSubject(conversation))
+			return total.Tokens, err
+		}); err != nil {
+			return err
+		}
+	}
+	return b.exceeded(BudgetDaily, BudgetDaily+":"+now.Format(time.DateOnly), l.DailyTokens, func() (int, error) {
+		day, _, err := b.store.LoadUsage(b.user, now)
+		return day.Tokens, err
+	})
+}
+
+// exceeded compares the usage of one scope with its limit plus what was
+// approved past it
+func (b *budget) exceeded(scope, key string, limit int, used func() (int, error)) *BudgetError {
+	if limit <= 0 {
+		return nil
+	}
+	n, err := used()
+	if err != nil {
+		// An unreadable ledger must not stop the agent
+		b.log.Warn("reading usage ledger failed", "error", err)
+		return nil
+	}
+	b.mu.Lock()
+	allowed := b.allowed[key]
+	b.mu.Unlock()
+	if n < limit+allowed {
+		return nil
+	}
+	return &BudgetError{Scope: scope, Limit: limit, Used: n}
+}
+
+// allow approves another limit's worth of tokens past a used up budget
+func (b *budget) allow(now time.Time, conversation string, e *BudgetError) {
+	key := e.Scope
+	switch e.Scope {
+	case BudgetConversation:
+		key += ":" + conversation
+	case BudgetDaily:
+		key += ":" + now.Format(time.DateOnly)
+	}
+	b.mu.Lock()
+	b.allowed[key] = e.Used
+	b.mu.Unlock()
+}
+
+// checkBudget stops a turn that used up a budget unless the user approves
+// going past it
+func (a *Agent) checkBudget(turnTokens int) error {
+	now := time.Now()
+	e := a.budget.check(now, a.conversationID, turnTokens)
+	if e == nil {
+		return nil
+	}
+	a.log.Warn("token budget exceeded", "scope", e.Scope, "limit", e.Limit, "used", e.Used)
+	if !strings.EqualFold(a.config.Budget.OnExceed, BudgetRefuse) && a.onBudgetExceeded != nil && a.onBudgetExceeded(e) {
+		a.log.Info("going past the token budget", "scope", e.Scope)
+		a.budget.allow(now, a.conversationID, e)
+		return nil
+	}
+	return e
+}
+
+// CheckLimits reports whether the quota or a token budget of the current
+// conversation is used up already, so a turn would be refused; callers such
+// as the API server check before they commit to a response
+func (a *Agent) CheckLimits() error {
+	if err := a.quota.check(time.Now(), nil); err != nil {
+		return err
+	}
+	return a.checkBudget(0)
+}
+
+// SetBudgetPrompt sets the prompt asking whether to go past a used up
+// token budget; without one, budgets refuse
+func (a *Agent) SetBudgetPrompt(fn BudgetPromptFunc) {
+	a.onBudgetExceeded = fn
+}
+
+// DefaultBudgetConfirmation asks on the terminal (stderr) whether to go past
+// a budget
+func DefaultBudgetConfirmation(err *BudgetError) bool {
+	fmt.Fprintf(os.Stderr, "\nThe %s token budget of %d is used up (%d tokens). Continue anyway? [y/N]: ", err.Scope, err.Limit, err.Used)
+	answer, readErr := bufio.NewReader(os.Stdin).ReadString('\n')
+	if readErr != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// responseTokens is the tokens a response used
+func responseTokens(resp *llm.Response) int {
+	if resp.TokensUsed > 0 {
+		return resp.TokensUsed
+	}
+	return resp.PromptTokens + resp.OutputTokens
+}
+
+// conversationSubject is the usage ledger entry of a conversation
+func conversationSubject(id string) string {
+	return "conversation:" + id
+}
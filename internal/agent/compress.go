@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	// minCompressChars is the smallest tool result worth compressing
+	minCompressChars = 800
+
+	// compressExcerptLines is how many leading lines of a result are kept
+	compressExcerptLines = 8
+
+	// compressedMarker tags results that were already compressed
+	compressedMarker = "[compressed tool output:"
+)
+
+// compressToolHistory shrinks tool results that precede keepFrom once the
+// in-loop messages exceed the tool history token budget. The oldest results
+// go first; each is replaced by a short excerpt and, when possible, a pointer
+// to an artifact holding the full output, so later iterations can still
+// read it with artifact_read.
+func (a *Agent) compressToolHistory(messages []llm.Message, keepFrom, turn int) []llm.Message {
+	limit := a.config.Context.ToolHistoryTokens
+	if limit <= 0 {
+		return messages
+	}
+
+	tokens := a.provider.CountTokens(messages)
+	if tokens <= limit {
+		return messages
+	}
+
+	toolNames := make(map[string]string)
+	for _, m := range messages[:keepFrom] {
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil {
+				toolNames[tc.ID] = tc.Function.Name
+			}
+		}
+	}
+
+	compressed, before := 0, tokens
+	for i := 0; i < keepFrom && tokens > limit; i++ {
+		m := messages[i]
+		if m.Role != "tool" || len(m.Content) < minCompressChars || strings.HasPrefix(m.Content, compressedMarker) {
+			continue
+		}
+
+		old := a.provider.CountTokens([]llm.Message{m})
+		messages[i].Content = a.compressToolResult(toolNames[m.ToolCallID], m.ToolCallID, m.Content, turn)
+		tokens -= old - a.provider.CountTokens([]llm.Message{messages[i]})
+		compressed++
+	}
+
+	if compressed > 0 {
+		a.log.Info("tool history compressed",
+			"results", compressed,
+			"tokens_before", before,
+			"tokens_after", tokens,
+			"limit", limit,
+		)
+	}
+	return messages
+}
+
+// compressToolResult returns the excerpt that replaces a tool result,
+// saving the full output as an artifact
+func (a *Agent) compressToolResult(tool, callID, output string, turn int) string {
+	lines := strings.Split(output, "\n")
+	excerpt := lines
+	if len(excerpt) > compressExcerptLines {
+		excerpt = excerpt[:compressExcerptLines]
+	}
+	head := strings.Join(excerpt, "\n")
+	if len(head) > minCompressChars/2 {
+		head = head[:minCompressChars/2]
+	}
+
+	if tool == "" {
+		tool = "tool"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s, %d lines, %d bytes]\n%s\n[...]\n", compressedMarker, tool, len(lines), len(output), head)
+
+	artifact, err := a.store.SaveArtifact(&storage.Artifact{
+		Name:           fmt.Sprintf("%s-%d-%s-%s.txt", a.conversationID, turn, tool, callID),
+		Language:       "text",
+		ConversationID: a.conversationID,
+		Turn:           turn,
+	}, []byte(output))
+	if err != nil {
+		a.log.Warn("failed to save tool output", "tool", tool, "error", err)
+		sb.WriteString("[full output discarded; run the tool again if you need it]")
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "[full output saved as artifact %s; use artifact_read to view it]", artifact.ShortHash())
+	return sb.String()
+}
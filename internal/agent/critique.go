@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/render"
+	"github.com/igm/igent/internal/tracing"
+)
+
+// Critique modes (agent.critique, /critique)
+const (
+	CritiqueOff    = "off"
+	CritiqueNote   = "note"   // Attach the reviewer's confidence note to the answer
+	CritiqueRevise = "revise" // Replace the answer with the reviewer's revision when it finds problems
+)
+
+const (
+	maxCritiqueToolOutput = 2000  // Bytes of each tool output shown to the reviewer
+	maxCritiqueInput      = 20000 // Bytes of tool outputs shown in total
+)
+
+// critiquePersona is the system prompt of the reviewer; the reply format
+// depends on the mode
+const critiquePersona = `You review the draft answer of an AI assistant before the user sees it. ` +
+	`Check it against the user's request and the tool outputs it was based on: ` +
+	`claims the tool outputs do not support, factual or logical mistakes, and parts of the request left unanswered. ` +
+	`Reply with a single JSON object and nothing else: `
+
+const (
+	critiqueNoteFormat   = `{"confidence": "high" | "medium" | "low", "issues": ["<problem, one sentence>", ...]}`
+	critiqueReviseFormat = `{"confidence": "high" | "medium" | "low", "issues": ["<problem, one sentence>", ...], ` +
+		`"revision": "<the corrected full answer, or an empty string if the draft needs no changes>"}`
+)
+
+// critique is the reviewer's verdict on a draft answer
+type critique struct {
+	Confidence string   `json:"confidence"`
+	Issues     []string `json:"issues"`
+	Revision   string   `json:"revision"`
+}
+
+// ParseCritiqueMode reads a critique mode; "on" is note and "" is off
+func ParseCritiqueMode(s string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", CritiqueOff, "false", "no":
+		return CritiqueOff, nil
+	case CritiqueNote, "on", "true", "yes":
+		return CritiqueNote, nil
+	case CritiqueRevise:
+		return CritiqueRevise, nil
+	}
+	return "", fmt.Errorf("unknown critique mode %q (want off, note or revise)", s)
+}
+
+// SetCritique sets the critique mode of later answers
+func (a *Agent) SetCritique(mode string) error {
+	m, err := ParseCritiqueMode(mode)
+	if err != nil {
+		return err
+	}
+	a.critiqueMode = m
+	return nil
+}
+
+// Critique returns the critique mode
+func (a *Agent) Critique() string {
+	return a.critiqueMode
+}
+
+// reviewAnswer has the reviewer check a final answer against the request
+// and the tool outputs of the turn. In revise mode a revision replaces the
+// answer; in note mode the reviewer's confidence is appended to it. If the
+// review fails the answer is kept as it is.
+func (a *Agent) reviewAnswer(ctx context.Context, messages []llm.Message, answer string) string {
+	if a.critiqueMode == CritiqueOff || a.critiqueMode == "" || strings.TrimSpace(answer) == "" {
+		return answer
+	}
+	ctx, span := a.tracer.Start(ctx, "igent.critique")
+	c, err := a.critique(ctx, messages, answer)
+	tracing.End(span, err)
+	if err != nil {
+		a.log.Warn("answer review failed", "error", err)
+		return answer
+	}
+	a.log.Info("answer reviewed", "mode", a.critiqueMode, "confidence", c.Confidence, "issues", len(c.Issues))
+
+	if a.critiqueMode == CritiqueRevise {
+		if revision := strings.TrimSpace(c.Revision); revision != "" && revision != strings.TrimSpace(answer) {
+			a.log.Info("answer revised after review")
+			return revision
+		}
+		return answer
+	}
+	return answer + c.note()
+}
+
+// critique asks the reviewer for its verdict on answer
+func (a *Agent) critique(ctx context.Context, messages []llm.Message, answer string) (*critique, error) {
+	format := critiqueNoteFormat
+	if a.critiqueMode == CritiqueRevise {
+		format = critiqueReviseFormat
+	}
+	reviewer, err := a.newSubAgent("critic", critiquePersona+format, a.config.Agent.CritiqueModel)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := reviewer.ask(ctx, critiquePrompt(messages, answer))
+	if err != nil {
+		return nil, err
+	}
+	return parseCritique(reply)
+}
+
+// critiquePrompt shows the reviewer the turn's request, its tool outputs
+// and the draft answer
+func critiquePrompt(messages []llm.Message, answer string) string {
+	last := -1
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+
+	var sb strings.Builder
+	if last >= 0 {
+		fmt.Fprintf(&sb, "## Request\n\n%s\n\n", messages[last].Content)
+	}
+	budget := maxCritiqueInput
+	var outputs strings.Builder
+	for _, m := range messages[last+1:] {
+		if m.Role != "tool" {
+			continue
+		}
+		text := m.Content
+		limit := min(maxCritiqueToolOutput, budget)
+		if limit <= 0 {
+			fmt.Fprintf(&outputs, "### %s (%d bytes, not shown)\n\n", m.Name, len(text))
+			continue
+		}
+		if len(text) > limit {
+			text = text[:limit] + "\n... (truncated)"
+		}
+		budget -= limit
+		fmt.Fprintf(&outputs, "### %s\n\n%s\n\n", m.Name, render.Fence(text, ""))
+	}
+	if outputs.Len() > 0 {
+		sb.WriteString("## Tool outputs\n\n")
+		sb.WriteString(outputs.String())
+	}
+	fmt.Fprintf(&sb, "## Draft answer\n\n%s\n", answer)
+	return sb.String()
+}
+
+// parseCritique reads the reviewer's JSON verdict, tolerating prose or code
+// fences around it
+func parseCritique(reply string) (*critique, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("reviewer did not return a verdict")
+	}
+	var c critique
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &c); err != nil {
+		return nil, fmt.Errorf("parsing reviewer verdict: %w", err)
+	}
+	c.Confidence = strings.ToLower(strings.TrimSpace(c.Confidence))
+	if c.Confidence == "" {
+		return nil, errors.New("reviewer verdict has no confidence")
+	}
+	return &c, nil
+}
+
+// note renders the verdict as a note below the answer
+func (c *critique) note() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n\n---\nReview: %s confidence.", c.Confidence)
+	if len(c.Issues) > 0 {
+		sb.WriteString(" Possible issues:")
+		for _, issue := range c.Issues {
+			fmt.Fprintf(&sb, "\n- %s", strings.TrimSpace(issue))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// debatePersonas are assigned to debaters in order
+var debatePersonas = []struct {
+	name   string
+	prompt string
+}{
+	{"Analyst", "You are a careful analyst. Reason step by step and support claims with evidence."},
+	{"Skeptic", "You are a skeptic. Look for flaws, hidden assumptions and counterexamples."},
+	{"Pragmatist", "You are a pragmatist. Focus on practical, actionable answers and their trade-offs."},
+	{"Expert", "You are a domain expert. Bring in specialist knowledge and precise terminology."},
+	{"Contrarian", "You are a contrarian. Argue for the strongest alternative to the obvious answer."},
+}
+
+// DebateOptions configures a debate
+type DebateOptions struct {
+	Agents int      // Number of debaters (default 3)
+	Models []string // Models assigned round-robin; empty uses the configured model
+	Rounds int      // Critique rounds after the initial answers; 0 synthesizes them as they are
+
+	// OnTurn is called after each debater answers; round 0 is the initial answer
+	OnTurn func(round int, turn DebateTurn)
+}
+
+// DebateTurn is one debater's answer in a round
+type DebateTurn struct {
+	Agent  string
+	Model  string
+	Answer string
+}
+
+// DebateResult holds every round and the synthesized answer
+type DebateResult struct {
+	Rounds [][]DebateTurn
+	Answer string
+}
+
+// Debate runs several personas/models on the same question, has them
+// critique each other's answers for a number of rounds, and synthesizes a
+// final answer with the agent's own model. The question is screened as
+// input, and every answer shown as output.
+func (a *Agent) Debate(ctx context.Context, question string, opts DebateOptions) (*DebateResult, error) {
+	if opts.Agents <= 0 {
+		opts.Agents = 3
+	}
+	if opts.Agents < len(opts.Models) {
+		opts.Agents = len(opts.Models)
+	}
+	if opts.Agents > len(debatePersonas) {
+		return nil, fmt.Errorf("at most %d agents are supported", len(debatePersonas))
+	}
+	if opts.Rounds < 0 {
+		return nil, fmt.Errorf("rounds is %d, want 0 or more", opts.Rounds)
+	}
+
+	question, err := a.screenInput(ctx, question)
+	if err != nil {
+		return nil, err
+	}
+
+	debaters := make([]*subAgent, opts.Agents)
+	for i := range debaters {
+		var model string
+		if len(opts.Models) > 0 {
+			model = opts.Models[i%len(opts.Models)]
+		}
+		persona := debatePersonas[i]
+		sa, err := a.newSubAgent(persona.name, persona.prompt, model)
+		if err != nil {
+			return nil, err
+		}
+		debaters[i] = sa
+	}
+
+	a.log.Info("debate started", "agents", len(debaters), "rounds", opts.Rounds)
+
+	result := &DebateResult{}
+	for round := 0; round <= opts.Rounds; round++ {
+		var previous []DebateTurn
+		if round > 0 {
+			previous = result.Rounds[round-1]
+		}
+
+		turns := make([]DebateTurn, len(debaters))
+		errs := make([]error, len(debaters))
+		var wg sync.WaitGroup
+		for i, d := range debaters {
+			wg.Add(1)
+			go func(i int, d *subAgent) {
+				defer wg.Done()
+				answer, err := d.ask(ctx, debatePrompt(question, i, previous))
+				turns[i] = DebateTurn{Agent: d.name, Model: d.model, Answer: answer}
+				errs[i] = err
+			}(i, d)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("debate round %d: %w", round, err)
+			}
+		}
+		for i := range turns {
+			if turns[i].Answer, err = a.screenOutput(ctx, turns[i].Answer); err != nil {
+				return nil, err
+			}
+		}
+		result.Rounds = append(result.Rounds, turns)
+
+		if opts.OnTurn != nil {
+			for _, turn := range turns {
+				opts.OnTurn(round, turn)
+			}
+		}
+	}
+
+	judge, err := a.newSubAgent("Moderator", a.config.Agent.SystemPrompt, "")
+	if err != nil {
+		return nil, err
+	}
+	answer, err := judge.ask(ctx, synthesisPrompt(question, result.Rounds[len(result.Rounds)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("synthesizing answer: %w", err)
+	}
+	if result.Answer, err = a.screenOutput(ctx, answer); err != nil {
+		return nil, err
+	}
+
+	a.log.Info("debate completed", "agents", len(debaters), "rounds", opts.Rounds)
+	return result, nil
+}
+
+// debatePrompt builds a debater's prompt; after the first round it includes
+// the debater's own previous answer and the other answers to critique
+func debatePrompt(question string, self int, previous []DebateTurn) string {
+	if previous == nil {
+		return question
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Question: %s\n\nYour previous answer:\n%s\n\n", question, previous[self].Answer)
+	for i, turn := range previous {
+		if i != self {
+			fmt.Fprintf(&sb, "Answer from %s:\n%s\n\n", turn.Agent, turn.Answer)
+		}
+	}
+	sb.WriteString("Critique the other answers: point out errors, gaps and points you agree with. " +
+		"Then give your revised answer, changing your position only where the arguments convince you.")
+	return sb.String()
+}
+
+// synthesisPrompt asks the moderator for a final answer from the last round
+func synthesisPrompt(question string, final []DebateTurn) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Several experts debated this question: %s\n\n", question)
+	for _, turn := range final {
+		fmt.Fprintf(&sb, "Final answer from %s:\n%s\n\n", turn.Agent, turn.Answer)
+	}
+	sb.WriteString("Synthesize the best final answer. Build on the points of consensus, " +
+		"resolve disagreements where the arguments allow, and briefly note any that remain open.")
+	return sb.String()
+}
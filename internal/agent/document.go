@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// documentPromptSection describes the conversation's working document so
+// the model can edit it with the document tools without seeing the full text
+func (a *Agent) documentPromptSection() string {
+	section := `
+
+## Working Document
+
+This conversation can have a working document for drafting long texts. Edit it
+with document_append and document_replace_section instead of repeating the whole
+text in your reply; use document_write to create it and document_read to review it.`
+
+	doc, err := a.store.LoadDocument(a.conversationID)
+	if err != nil {
+		return section
+	}
+
+	section += fmt.Sprintf("\n\nCurrent document: version %d, %d lines", doc.Version, strings.Count(doc.Content, "\n")+1)
+	if doc.Title != "" {
+		section += fmt.Sprintf(", title %q", doc.Title)
+	}
+	if outline := documentOutline(doc.Content); outline != "" {
+		section += ". Outline:\n" + outline
+	}
+	return section
+}
+
+// documentOutline lists the markdown headings of a document
+func documentOutline(content string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if level == 0 || level > 6 || !strings.HasPrefix(trimmed[level:], " ") {
+			continue
+		}
+		sb.WriteString(strings.Repeat("  ", level-1) + "- " + strings.TrimSpace(trimmed[level:]) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Document returns the working document of the current conversation
+func (a *Agent) Document() (*storage.Document, error) {
+	doc, err := a.store.LoadDocument(a.conversationID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	return doc, err
+}
@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/render"
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	maxEvaluationArtifact = 4000  // Bytes of each artifact shown to the critic
+	maxEvaluationInput    = 30000 // Bytes of artifacts shown in total
+)
+
+// criticPersona is the system prompt of the run evaluator
+const criticPersona = `You are a strict reviewer of work done by an autonomous AI agent. ` +
+	`Judge only whether the final result and the produced artifacts satisfy the original task; ` +
+	`claims the agent makes without evidence do not count. ` +
+	`Reply with a single JSON object and nothing else: ` +
+	`{"score": <integer 0-10, 10 = fully satisfied>, "reason": "<one or two sentences>"}`
+
+// EvaluateRun has a critic evaluate a completed run and saves the verdict
+// in its journal, replacing an earlier one
+func (a *Agent) EvaluateRun(ctx context.Context, id string) (*storage.Run, error) {
+	run, err := a.GetRun(id)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != storage.RunCompleted {
+		return run, fmt.Errorf("run %s is %s; only completed runs can be evaluated", run.ID, run.Status)
+	}
+	return run, a.evaluate(ctx, run)
+}
+
+// evaluate asks the critic whether run satisfied its task and records the
+// verdict. A run that fails evaluation stays completed; callers check
+// run.Evaluation.Passed.
+func (a *Agent) evaluate(ctx context.Context, run *storage.Run) error {
+	critic, err := a.newSubAgent("evaluator", criticPersona, a.config.Agent.EvaluatorModel)
+	if err != nil {
+		return fmt.Errorf("evaluating run: %w", err)
+	}
+
+	answer, err := critic.ask(ctx, a.evaluationPrompt(run))
+	if err != nil {
+		return fmt.Errorf("evaluating run: %w", err)
+	}
+	eval, err := parseEvaluation(answer)
+	if err != nil {
+		return fmt.Errorf("evaluating run: %w", err)
+	}
+	eval.Model = critic.model
+	eval.Passed = eval.Score >= a.config.Agent.EvaluatorMinScore
+	eval.At = time.Now()
+
+	run.Evaluation = eval
+	if err := a.store.SaveRun(run); err != nil {
+		return fmt.Errorf("saving run: %w", err)
+	}
+	a.log.Info("run evaluated", "id", run.ID, "score", eval.Score, "passed", eval.Passed)
+	return nil
+}
+
+// evaluationPrompt shows the critic the task, the steps taken, the result
+// and the contents of the artifacts produced
+func (a *Agent) evaluationPrompt(run *storage.Run) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Task\n\n%s\n\n", run.Prompt)
+
+	if len(run.Steps) > 0 {
+		sb.WriteString("## Steps\n\n")
+		for _, step := range run.Steps {
+			status := ""
+			if step.Error {
+				status = " (failed)"
+			}
+			fmt.Fprintf(&sb, "- %s%s: %s\n", step.Tool, status, step.Summary)
+		}
+		sb.WriteString("\n")
+	}
+
+	fmt.Fprintf(&sb, "## Final result\n\n%s\n", run.Result)
+
+	budget := maxEvaluationInput
+	for _, ref := range run.Artifacts {
+		art, content, err := a.GetArtifact(ref)
+		if err != nil {
+			a.log.Warn("artifact unavailable for evaluation", "artifact", ref, "error", err)
+			continue
+		}
+		text := string(content)
+		limit := min(maxEvaluationArtifact, budget)
+		if limit <= 0 {
+			fmt.Fprintf(&sb, "\n## Artifact %s (%d bytes, not shown)\n", art.Name, art.Size)
+			continue
+		}
+		if len(text) > limit {
+			text = text[:limit] + "\n... (truncated)"
+		}
+		budget -= limit
+		fmt.Fprintf(&sb, "\n## Artifact %s\n\n%s\n", art.Name, render.Fence(text, ""))
+	}
+	return sb.String()
+}
+
+// parseEvaluation reads the critic's JSON verdict, tolerating prose or code
+// fences around it
+func parseEvaluation(answer string) (*storage.Evaluation, error) {
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("evaluator did not return a verdict")
+	}
+	var verdict struct {
+		Score  *float64 `json:"score"`
+		Reason string   `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &verdict); err != nil {
+		return nil, fmt.Errorf("parsing evaluator verdict: %w", err)
+	}
+	if verdict.Score == nil {
+		return nil, errors.New("evaluator verdict has no score")
+	}
+	score := int(*verdict.Score + 0.5)
+	return &storage.Evaluation{Score: max(0, min(10, score)), Reason: strings.TrimSpace(verdict.Reason)}, nil
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// maxLengthContinuations bounds the follow-up requests made to finish an
+// answer cut off at the provider's token limit
+const maxLengthContinuations = 3
+
+// ErrContentFiltered is returned when the provider's content filter blocked
+// a response
+var ErrContentFiltered = errors.New("the provider's content filter blocked the response")
+
+// checkFinish handles responses that did not end normally. An answer cut
+// off at the token limit is continued in follow-up requests and stitched
+// together, so the user sees one answer; one blocked by the content filter
+// fails the turn instead of passing as a normal answer.
+func (a *Agent) checkFinish(ctx context.Context, messages []llm.Message, resp *llm.Response, opts *llm.CompleteOptions, onChunk func(string)) (*llm.Response, error) {
+	for n := 0; resp.FinishReason == llm.FinishReasonLength && !resp.HasToolCalls(); n++ {
+		if a.style.MaxTokens > 0 {
+			// The user asked for short answers; don't work around the limit
+			a.warn(fmt.Sprintf("answer cut off at the response limit of %d tokens", a.style.MaxTokens))
+			break
+		}
+		if n == maxLengthContinuations {
+			a.warn(fmt.Sprintf("answer still cut off at the token limit after %d continuations; it may be incomplete", n))
+			break
+		}
+
+		a.log.Info("continuing answer cut off at the token limit", "length", len(resp.Content), "continuation", n+1)
+		continued := append(append([]llm.Message(nil), messages...),
+			llm.Message{Role: "assistant", Content: resp.Content},
+			llm.Message{Role: "user", Content: continuePrompt},
+		)
+		next, err := a.complete(ctx, continued, opts, onChunk)
+		if err != nil {
+			var pe *PartialResponseError
+			if errors.As(err, &pe) {
+				pe.Partial = resp.Content + pe.Partial
+			}
+			return nil, err
+		}
+		resp = stitchResponses(resp, next)
+	}
+
+	if resp.FinishReason == llm.FinishReasonContentFilter {
+		a.log.Warn("response blocked by content filter", "length", len(resp.Content))
+		return nil, ErrContentFiltered
+	}
+	return resp, nil
+}
+
+// stitchResponses joins a response cut off at the token limit with its
+// continuation, adding up the usage of both
+func stitchResponses(first, next *llm.Response) *llm.Response {
+	return &llm.Response{
+		Content:      first.Content + next.Content,
+		Reasoning:    first.Reasoning + next.Reasoning,
+		ToolCalls:    next.ToolCalls,
+		TokensUsed:   first.TokensUsed + next.TokensUsed,
+		PromptTokens: first.PromptTokens + next.PromptTokens,
+		OutputTokens: first.OutputTokens + next.OutputTokens,
+		CachedTokens: first.CachedTokens + next.CachedTokens,
+		FinishReason: next.FinishReason,
+	}
+}
+
+// warn passes a warning to the user
+func (a *Agent) warn(msg string) {
+	if a.onWarning != nil {
+		a.onWarning(msg)
+	}
+}
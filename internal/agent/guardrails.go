@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/guardrails"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+)
+
+// moderationPrompt asks the model whether text breaks the moderation policy
+const moderationPrompt = `You moderate the %s of an AI assistant against this policy. Flag text that violates it:
+
+%s
+
+Reply with SAFE if the text is acceptable, or with UNSAFE: and a short reason if it is not. Reply with nothing else.`
+
+// NewGuard creates the guardrails from config; it is nil when none are configured
+func NewGuard(cfg config.GuardrailsConfig) (*guardrails.Guard, error) {
+	convert := func(rules []config.GuardrailRule) []guardrails.Rule {
+		result := make([]guardrails.Rule, len(rules))
+		for i, r := range rules {
+			result[i] = guardrails.Rule{Name: r.Name, Pattern: r.Pattern, Action: guardrails.Action(r.Action)}
+		}
+		return result
+	}
+	return guardrails.New(guardrails.Config{
+		Input:          convert(cfg.Input),
+		Output:         convert(cfg.Output),
+		MaxOutputChars: cfg.MaxOutputChars,
+		Moderation:     cfg.Moderation,
+	})
+}
+
+// moderate asks the model whether text breaks guardrails.moderation_policy
+func (a *Agent) moderate(ctx context.Context, stage guardrails.Stage, text string) (string, error) {
+	what := "user input"
+	if stage == guardrails.StageOutput {
+		what = "answers"
+	}
+	policy := a.config.Guardrails.ModerationPolicy
+	if policy == "" {
+		policy = config.DefaultModerationPolicy
+	}
+	resp, err := a.metered(a.provider, a.model, a.conversationID, a.priority).Complete(ctx, []llm.Message{
+		{Role: "system", Content: fmt.Sprintf(moderationPrompt, what, policy)},
+		{Role: "user", Content: text},
+	})
+	if err != nil {
+		return "", err
+	}
+	verdict := strings.TrimSpace(resp.Content)
+	if len(verdict) < len("UNSAFE") || !strings.EqualFold(verdict[:len("UNSAFE")], "UNSAFE") {
+		return "", nil
+	}
+	reason := strings.TrimSpace(strings.TrimLeft(verdict[len("UNSAFE"):], ":"))
+	if reason == "" {
+		reason = "flagged by moderation"
+	}
+	return reason, nil
+}
+
+// screen runs the guardrails on text at a stage and records the rules it
+// triggered in the audit
+func (a *Agent) screen(ctx context.Context, stage guardrails.Stage, text string) (*guardrails.Result, error) {
+	result, err := a.guard.Screen(ctx, stage, text)
+	if err != nil {
+		return nil, fmt.Errorf("guardrails: %w", err)
+	}
+	if len(result.Triggers) == 0 {
+		return result, nil
+	}
+
+	now := time.Now()
+	events := make([]storage.GuardrailEvent, len(result.Triggers))
+	for i, t := range result.Triggers {
+		a.log.Warn("guardrail triggered", "stage", t.Stage, "rule", t.Rule, "action", t.Action, "detail", t.Detail)
+		events[i] = storage.GuardrailEvent{
+			Time:         now,
+			Conversation: a.conversationID,
+			Stage:        string(t.Stage),
+			Rule:         t.Rule,
+			Action:       string(t.Action),
+			Detail:       t.Detail,
+		}
+	}
+	if err := a.store.AppendGuardrailEvents(events); err != nil {
+		a.log.Warn("writing guardrail audit failed", "error", err)
+	}
+	return result, nil
+}
+
+// screenInput returns user input as the model may see it, or the
+// BlockedError of a guardrail that stopped it
+func (a *Agent) screenInput(ctx context.Context, input string) (string, error) {
+	result, err := a.screen(ctx, guardrails.StageInput, input)
+	if err != nil {
+		return "", err
+	}
+	if err := result.Err(); err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// screenToolCall returns the BlockedError of a guardrail that stops a tool
+// call. Rules see the tool name followed by its JSON arguments.
+func (a *Agent) screenToolCall(ctx context.Context, call *tools.ToolCall) error {
+	if a.guard == nil {
+		return nil
+	}
+	args := call.RawArgs
+	if args == "" {
+		raw, err := json.Marshal(call.Args)
+		if err != nil {
+			return err
+		}
+		args = string(raw)
+	}
+	result, err := a.screen(ctx, guardrails.StageToolCall, call.Name+" "+args)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// screenOutput returns an answer as it may be shown; a blocked answer is
+// replaced by a notice saying why
+func (a *Agent) screenOutput(ctx context.Context, response string) (string, error) {
+	result, err := a.screen(ctx, guardrails.StageOutput, response)
+	if err != nil {
+		return "", err
+	}
+	if err := result.Err(); err != nil {
+		return fmt.Sprintf("[Answer withheld: %v]", err), nil
+	}
+	return result.Text, nil
+}
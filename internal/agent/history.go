@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chzyer/readline"
+)
+
+// HistoryPath returns the file the REPL keeps a conversation's prompts in,
+// under the work directory, so UP/DOWN only recall prompts sent to it
+func (a *Agent) HistoryPath(id string) string {
+	return filepath.Join(a.config.Storage.WorkDir, "history", filepath.FromSlash(id)+".txt")
+}
+
+// useHistory points the REPL's history at the current conversation when it
+// changed since the last prompt; it returns the conversation the history
+// belongs to
+func (a *Agent) useHistory(rl *readline.Instance, current string) string {
+	if current == a.conversationID {
+		return current
+	}
+	path := a.HistoryPath(a.conversationID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		a.log.Warn("history unavailable", "error", err)
+	}
+	rl.SetHistoryPath(path)
+	return a.conversationID
+}
+
+// moveHistory renames a conversation's prompt history along with it
+func (a *Agent) moveHistory(oldID, newID string) error {
+	newPath := a.HistoryPath(newID)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("moving history: %w", err)
+	}
+	if err := os.Rename(a.HistoryPath(oldID), newPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("moving history: %w", err)
+	}
+	return nil
+}
+
+// deleteHistory removes a conversation's prompt history
+func (a *Agent) deleteHistory(id string) error {
+	if err := os.Remove(a.HistoryPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/sched"
+)
+
+// meteredProvider routes the provider calls made outside the agentic loop,
+// such as sub-agents, titles, moderation and memory summaries, through what
+// the loop's calls go through: the quota and token budgets, a slot of the
+// provider scheduler, and the usage ledger. Budgets refuse rather than ask,
+// as these calls may run in the background.
+type meteredProvider struct {
+	llm.Provider
+	a            *Agent
+	model        string // Prices the calls in the ledger
+	conversation string // Charged in the ledger besides the user, if set
+	priority     sched.Priority
+}
+
+// metered wraps a provider of the agent answering with a model, charging
+// its calls to a conversation ("" for none) at a scheduler priority
+func (a *Agent) metered(p llm.Provider, model, conversation string, priority sched.Priority) *meteredProvider {
+	return &meteredProvider{Provider: p, a: a, model: model, conversation: conversation, priority: priority}
+}
+
+// Complete implements llm.Provider
+func (m *meteredProvider) Complete(ctx context.Context, messages []llm.Message) (*llm.Response, error) {
+	return m.CompleteWithOptions(ctx, messages, nil)
+}
+
+// CompleteWithOptions implements llm.Provider
+func (m *meteredProvider) CompleteWithOptions(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions) (resp *llm.Response, err error) {
+	a := m.a
+	ctx, span := a.startProviderSpan(ctx, m.model, opts)
+	defer func() { endProviderSpan(span, resp, err) }()
+
+	now := time.Now()
+	if err := a.quota.check(now, a.onWarning); err != nil {
+		return nil, err
+	}
+	if e := a.budget.check(now, m.conversation, 0); e != nil {
+		return nil, e
+	}
+	release, err := a.sched.Acquire(ctx, schedKey(a.config), m.priority)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	span.AddEvent("provider slot acquired")
+
+	resp, err = m.Provider.CompleteWithOptions(ctx, messages, opts)
+	if err == nil {
+		a.quota.record(time.Now(), resp, m.conversation, a.pricing(m.model))
+	}
+	return resp, err
+}
+
+// Stream implements llm.Provider. The answer is sent in one piece, as only
+// a complete response reports its usage.
+func (m *meteredProvider) Stream(ctx context.Context, messages []llm.Message, onChunk func(string)) error {
+	resp, err := m.CompleteWithOptions(ctx, messages, nil)
+	if err != nil {
+		return err
+	}
+	onChunk(resp.Content)
+	return nil
+}
@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// maxOrchestrationSteps bounds the delegations of one request
+const maxOrchestrationSteps = 8
+
+// coordinatorPrompt is the system prompt of the orchestrator's coordinator
+const coordinatorPrompt = `You are a coordinator. You do not do the work yourself: you split the user's request into subtasks and delegate each to the best suited of these agents, one at a time, using their results for the next step.
+
+Agents:
+%s
+Reply with a JSON object only, either
+{"agent": "<name>", "task": "<self-contained instructions with all context the agent needs>"}
+to delegate a subtask, or, once the request is handled,
+{"answer": "<final answer to the user, drawing on the agents' results>"}`
+
+// coordinatorStep is a reply of the coordinator
+type coordinatorStep struct {
+	Agent  string `json:"agent"`
+	Task   string `json:"task"`
+	Answer string `json:"answer"`
+}
+
+// Delegation is a subtask the coordinator gave to a profile agent
+type Delegation struct {
+	Profile string
+	Task    string
+	Result  string
+	Err     error
+}
+
+// OrchestrateOptions configures an orchestrated request
+type OrchestrateOptions struct {
+	OnDelegate func(d Delegation) // Before a subtask is run
+	OnResult   func(d Delegation) // After a subtask was run
+	OnChunk    func(string)       // Streamed results of the profile agents
+}
+
+// OrchestrateResult reports an orchestrated request
+type OrchestrateResult struct {
+	Delegations []Delegation
+	Answer      string
+}
+
+// Orchestrate handles a request with the configured agent profiles: a
+// coordinator, running on the agent's own model without tools, delegates
+// subtasks to the profiles one at a time and answers from their results.
+// Each profile works in the conversation <conversation>/<profile> with its
+// own prompt, model and tool policy. The request and the answer are saved
+// to the current conversation.
+func (a *Agent) Orchestrate(ctx context.Context, request string, opts OrchestrateOptions) (*OrchestrateResult, error) {
+	names := a.config.ProfileNames()
+	if len(names) == 0 {
+		return nil, errors.New("no agent profiles are configured (profiles in the config)")
+	}
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("loading conversation: %w", err)
+	}
+	if request, err = a.screenInput(ctx, request); err != nil {
+		return nil, err
+	}
+
+	var agents strings.Builder
+	for _, name := range names {
+		p := a.config.Profiles[name]
+		fmt.Fprintf(&agents, "- %s", name)
+		if p.Description != "" {
+			fmt.Fprintf(&agents, ": %s", p.Description)
+		}
+		agents.WriteString("\n")
+	}
+	messages := []llm.Message{
+		{Role: "system", Content: fmt.Sprintf(coordinatorPrompt, agents.String())},
+		{Role: "user", Content: request},
+	}
+	a.log.Info("orchestration started", "profiles", len(names))
+
+	result := &OrchestrateResult{}
+	for step := 0; step < maxOrchestrationSteps; step++ {
+		resp, err := a.complete(ctx, messages, &llm.CompleteOptions{}, nil)
+		if err != nil {
+			return result, fmt.Errorf("coordinator: %w", err)
+		}
+		messages = append(messages, llm.Message{Role: "assistant", Content: resp.Content})
+
+		next, err := parseCoordinatorStep(resp.Content)
+		if err != nil {
+			messages = append(messages, llm.Message{Role: "user", Content: err.Error() + ". Reply with the JSON object only."})
+			continue
+		}
+		if next.Agent == "" {
+			result.Answer = next.Answer
+			break
+		}
+
+		d := Delegation{Profile: next.Agent, Task: next.Task}
+		if opts.OnDelegate != nil {
+			opts.OnDelegate(d)
+		}
+		d.Result, d.Err = a.delegate(ctx, next.Agent, next.Task, opts.OnChunk)
+		if errors.Is(d.Err, ErrToolDenied) || ctx.Err() != nil {
+			return result, d.Err
+		}
+		result.Delegations = append(result.Delegations, d)
+		if opts.OnResult != nil {
+			opts.OnResult(d)
+		}
+
+		report := fmt.Sprintf("Result from %s:\n%s", d.Profile, d.Result)
+		if d.Err != nil {
+			report = fmt.Sprintf("%s failed: %v", d.Profile, d.Err)
+		}
+		messages = append(messages, llm.Message{Role: "user", Content: report})
+	}
+	if result.Answer == "" {
+		return result, fmt.Errorf("the coordinator gave no answer within %d steps", maxOrchestrationSteps)
+	}
+
+	if result.Answer, err = a.screenOutput(ctx, result.Answer); err != nil {
+		return result, err
+	}
+
+	a.log.Info("orchestration finished", "delegations", len(result.Delegations))
+	if err := a.finishTurn(conv, request, result.Answer, countUserMessages(conv.Messages)+1, nil); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// parseCoordinatorStep reads the JSON object of a coordinator reply, which
+// may be wrapped in prose or a code fence
+func parseCoordinatorStep(reply string) (*coordinatorStep, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in the reply")
+	}
+	var step coordinatorStep
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &step); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %v", err)
+	}
+	if step.Agent == "" && step.Answer == "" {
+		return nil, errors.New(`the JSON object has neither "agent" nor "answer"`)
+	}
+	if step.Agent != "" && step.Task == "" {
+		return nil, fmt.Errorf("no task for %s", step.Agent)
+	}
+	return &step, nil
+}
+
+// delegate runs a subtask with a profile agent
+func (a *Agent) delegate(ctx context.Context, profile, task string, onChunk func(string)) (string, error) {
+	pa, err := a.profileAgent(profile)
+	if err != nil {
+		return "", err
+	}
+	a.log.Info("subtask delegated", "profile", profile)
+	result, err := pa.ChatStream(ctx, task, onChunk)
+	if err != nil {
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// profileAgent returns the agent of a profile, creating it on first use.
+// It shares the provider when the profile keeps the model, and the tool
+// prompts of this agent.
+func (a *Agent) profileAgent(name string) (*Agent, error) {
+	if pa, ok := a.profiles[name]; ok {
+		return pa, pa.SetConversation(a.conversationID + "/" + name)
+	}
+	cfg, err := a.config.WithProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var pa *Agent
+	if cfg.Provider.Model == a.config.Provider.Model {
+		pa, err = NewWithProvider(cfg, a.provider)
+	} else {
+		pa, err = New(cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s agent: %w", name, err)
+	}
+	pa.onToolConfirm = a.onToolConfirm
+	pa.onToolOutput = a.onToolOutput
+	pa.onAnnounce = a.onAnnounce
+	pa.onToolStatus = a.onToolStatus
+	pa.onWarning = a.onWarning
+	pa.notices = a.notices
+	pa.priority = a.priority
+	pa.policy.off = a.policy.off // Tools disabled with /tools disable stay off in delegations
+	if err := pa.SetConversation(a.conversationID + "/" + name); err != nil {
+		return nil, err
+	}
+	if a.profiles == nil {
+		a.profiles = make(map[string]*Agent)
+	}
+	a.profiles[name] = pa
+	return pa, nil
+}
+
+// orchestrateConsole runs an orchestrated request on the terminal,
+// announcing each delegation and failure in the notices while the profile
+// agents' results stream to write
+func (a *Agent) orchestrateConsole(ctx context.Context, request string, write func(string), flush func()) (string, error) {
+	result, err := a.Orchestrate(ctx, request, OrchestrateOptions{
+		OnDelegate: func(d Delegation) {
+			flush()
+			fmt.Fprintf(a.notices, "→ %s: %s\n\n", d.Profile, d.Task)
+		},
+		OnResult: func(d Delegation) {
+			flush()
+			if d.Err != nil {
+				fmt.Fprintf(a.notices, "%s failed: %v\n", d.Profile, d.Err)
+				return
+			}
+			fmt.Print("\n\n")
+		},
+		OnChunk: write,
+	})
+	if err != nil {
+		return "", err
+	}
+	write(result.Answer)
+	return result.Answer, nil
+}
+
+// OrchestrateConsole is Orchestrate for the terminal: delegations are
+// announced in the notices and results streamed to write, followed by the
+// answer
+func (a *Agent) OrchestrateConsole(ctx context.Context, request string, write func(string)) (string, error) {
+	return a.orchestrateConsole(ctx, request, write, func() {})
+}
+
+// SetOrchestrateMode makes the REPL hand every message to the
+// orchestrator, as /orchestrate does for one request
+func (a *Agent) SetOrchestrateMode(on bool) {
+	a.orchestrateMode = on
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+)
+
+// ErrNoPartialResponse is returned by ContinuePartial when the conversation
+// has no interrupted response
+var ErrNoPartialResponse = errors.New("no interrupted response to continue")
+
+// continuePrompt asks the model to resume a cut-off answer
+const continuePrompt = "Your previous response was cut off. Continue it exactly where it stopped, " +
+	"without repeating anything already written and without any preamble."
+
+// PartialResponseError reports a response whose stream died midway; Partial
+// holds the content streamed before the failure
+type PartialResponseError struct {
+	Partial string
+	Err     error
+}
+
+func (e *PartialResponseError) Error() string {
+	return fmt.Sprintf("response interrupted after %d characters: %v", len(e.Partial), e.Err)
+}
+
+func (e *PartialResponseError) Unwrap() error {
+	return e.Err
+}
+
+// savePartial keeps the partial answer of an interrupted stream in the
+// conversation, appended to prefix, so it can be continued later
+func (a *Agent) savePartial(conv *storage.Conversation, input, prefix string, err error) {
+	var pe *PartialResponseError
+	if !errors.As(err, &pe) {
+		return
+	}
+
+	conv.Partial = &storage.PartialResponse{
+		Input:     input,
+		Content:   prefix + pe.Partial,
+		CreatedAt: time.Now(),
+	}
+	if err := a.saveConversation(conv); err != nil {
+		a.log.Warn("saving partial response failed", "error", err)
+		return
+	}
+	a.log.Info("partial response saved", "conversation", conv.ID, "length", len(conv.Partial.Content))
+}
+
+// HasPartial reports whether the current conversation has an interrupted
+// response that ContinuePartial can resume
+func (a *Agent) HasPartial() bool {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	return err == nil && conv.Partial != nil
+}
+
+// ContinuePartial asks the model to resume the interrupted response of the
+// current conversation from where it stopped instead of regenerating it.
+// The completed answer replaces the partial one in the history; tool results
+// gathered before the interruption are not replayed.
+func (a *Agent) ContinuePartial(ctx context.Context, onChunk func(string)) (string, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return "", fmt.Errorf("loading conversation: %w", err)
+	}
+	partial := conv.Partial
+	if partial == nil {
+		return "", ErrNoPartialResponse
+	}
+
+	fullMessages, err := a.buildTurnMessages(conv, partial.Input)
+	if err != nil {
+		return "", err
+	}
+	fullMessages = append(fullMessages,
+		llm.Message{Role: "assistant", Content: partial.Content},
+		llm.Message{Role: "user", Content: continuePrompt},
+	)
+
+	turn := countUserMessages(conv.Messages) + 1
+	ctx = tools.WithConversation(ctx, a.conversationID, turn)
+
+	a.tee.prompt("(continue)")
+	recorded := a.recordTurn(partial.Input, true)
+	rest, loop, err := a.runLoop(ctx, fullMessages, turn, maxChatIterations, onChunk, loopHooks{})
+	if err != nil {
+		recorded("", err)
+		// Interrupted again: keep everything received so far
+		a.savePartial(conv, partial.Input, partial.Content, err)
+		return "", err
+	}
+	recorded(rest.Content, nil)
+
+	response := partial.Content + rest.Content
+	if err := a.finishTurn(conv, partial.Input, response, turn, loop); err != nil {
+		return "", err
+	}
+	a.log.Info("partial response continued", "conversation", conv.ID, "length", len(response))
+	return response, nil
+}
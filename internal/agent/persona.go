@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/igm/igent/internal/config"
+)
+
+// builtinPersonas are available without configuration; personas of the
+// same name in the config replace them
+var builtinPersonas = map[string]config.PersonaConfig{
+	"ops": {
+		Description: "Operations: servers, containers, logs and incidents",
+		SystemPrompt: "You are an operations engineer. Diagnose before changing anything: check status, logs and resource usage first. " +
+			"Before a command that changes the state of a system, say what it does and how to undo it, and prefer reversible steps. " +
+			"Report findings as a short summary with the evidence behind them.",
+		Skills:  []string{"explain", "summarize"},
+		Confirm: map[string]string{"shell": "ask", "shell_session": "ask", "ssh": "ask", "docker_exec": "ask", "kill": "ask"},
+	},
+	"coder": {
+		Description: "Software development: reading, writing and reviewing code",
+		SystemPrompt: "You are an experienced software engineer. Read the relevant code before changing it, follow the conventions of the project " +
+			"and keep changes focused. Explain what you changed and why in a few sentences, and run the tests when you can.",
+		Skills:  []string{"code", "explain"},
+		Confirm: map[string]string{"git_commit": "ask"},
+	},
+	"writer": {
+		Description: "Writing and editing prose",
+		SystemPrompt: "You are a careful writer and editor. Write clear, well-structured prose for the intended reader, " +
+			"keep the author's voice and meaning when editing, and point out unclear or unsupported claims.",
+		Skills:  []string{"summarize", "explain"},
+		Confirm: map[string]string{"shell": "deny", "shell_session": "deny", "run_code": "deny", "ssh": "deny", "kill": "deny", "docker_*": "deny"},
+	},
+}
+
+// Personas returns the personas /persona switches to, by name: the built-in
+// ones and those of the config
+func (a *Agent) Personas() map[string]config.PersonaConfig {
+	personas := make(map[string]config.PersonaConfig, len(builtinPersonas)+len(a.config.Personas))
+	for name, p := range builtinPersonas {
+		personas[name] = p
+	}
+	for name, p := range a.config.Personas {
+		personas[strings.ToLower(name)] = p
+	}
+	return personas
+}
+
+// PersonaNames returns the names of the personas, sorted
+func (a *Agent) PersonaNames() []string {
+	personas := a.Personas()
+	names := make([]string, 0, len(personas))
+	for name := range personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Persona returns the persona of the current conversation, "" if none
+func (a *Agent) Persona() string {
+	return a.persona
+}
+
+// SetPersona switches the current conversation to a persona, whose system
+// prompt and skills replace the config's, and whose tool confirmation rules
+// tighten the config's, until it is switched again; "" or "off" goes back to the config. The persona is
+// saved with the conversation, so it is kept when the conversation is
+// resumed.
+func (a *Agent) SetPersona(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "off" || name == "none" {
+		name = ""
+	}
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return fmt.Errorf("loading conversation: %w", err)
+	}
+	if err := a.applyPersona(name); err != nil {
+		return err
+	}
+	conv.Persona = name
+	if err := a.saveConversation(conv); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	a.log.Info("persona set", "conversation", a.conversationID, "persona", name)
+	return nil
+}
+
+// applyPersona takes on the settings of a persona, or the config's for "".
+// Tools allowed for the session are asked about again under the new rules;
+// tools disabled for the session stay disabled.
+func (a *Agent) applyPersona(name string) error {
+	var p config.PersonaConfig
+	confirm := a.config.Tools.Confirm
+	if name != "" {
+		var ok bool
+		if p, ok = a.Personas()[name]; !ok {
+			return fmt.Errorf("unknown persona %q (want one of %s)", name, strings.Join(a.PersonaNames(), ", "))
+		}
+		var err error
+		if confirm, err = tightenConfirm(a.config.Tools.Confirm, p.Confirm); err != nil {
+			return fmt.Errorf("persona %s: %w", name, err)
+		}
+	}
+	policy, err := newToolPolicy(confirm)
+	if err != nil {
+		return fmt.Errorf("persona %s: %w", name, err)
+	}
+	if a.policy != nil {
+		policy.off = a.policy.off
+	}
+	a.policy = policy
+	a.persona = name
+	a.personaConfig = p
+	return nil
+}
+
+// strictness orders tool decisions from the least to the most strict
+var strictness = map[toolDecision]int{toolAllow: 0, toolAsk: 1, toolDeny: 2}
+
+// tightenConfirm merges the confirm rules of a persona over the config's.
+// A persona can only make them stricter: its allow rules are dropped, as
+// are rules for tools the config already asks about or denies as strictly,
+// by an exact or glob rule.
+func tightenConfirm(base, persona map[string]string) (map[string]string, error) {
+	configured, err := newToolPolicy(base)
+	if err != nil {
+		return nil, err
+	}
+	confirm := make(map[string]string, len(base)+len(persona))
+	for tool, decision := range base {
+		confirm[tool] = decision
+	}
+	for tool, value := range persona {
+		decision := toolDecision(strings.ToLower(strings.TrimSpace(value)))
+		if decision == toolAllow {
+			continue
+		}
+		if current, ok := configured.rule(tool); ok && strictness[current] >= strictness[decision] {
+			continue
+		}
+		confirm[tool] = value
+	}
+	return confirm, nil
+}
+
+// restorePersona takes on the persona saved with a conversation when it
+// differs from the current one. A persona no longer configured is dropped
+// with a warning.
+func (a *Agent) restorePersona(name string) error {
+	if name == a.persona {
+		return nil
+	}
+	if err := a.applyPersona(name); err != nil {
+		a.log.Warn("conversation persona not restored", "conversation", a.conversationID, "error", err)
+		return a.applyPersona("")
+	}
+	return nil
+}
+
+// handlePersonaCommand processes /persona [name|off]
+func (a *Agent) handlePersonaCommand(args []string) {
+	if len(args) == 0 {
+		current := a.persona
+		if current == "" {
+			current = "none"
+		}
+		fmt.Printf("Persona: %s\n", current)
+		personas := a.Personas()
+		for _, name := range a.PersonaNames() {
+			fmt.Printf("  %-10s %s\n", name, personas[name].Description)
+		}
+		fmt.Println("Usage: /persona <name>|off")
+		return
+	}
+	if err := a.SetPersona(args[0]); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if a.persona == "" {
+		fmt.Println("Persona off; using the configured prompt, skills and tool rules")
+		return
+	}
+	fmt.Printf("Persona set to %s for this conversation\n", a.persona)
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/igm/igent/internal/guardrails"
+	"github.com/igm/igent/internal/llm"
+)
+
+// maxPlanSteps bounds the steps of a plan
+const maxPlanSteps = 12
+
+// planRequest asks for a plan instead of an answer
+const planRequest = `Do not carry out the following task yet. First make a plan for it: reply with a numbered list of at most %d concrete steps, one line each, in the order you will do them, and nothing else.
+
+Task: %s`
+
+// planStepRequest is the prompt of each step of an approved plan
+const planStepRequest = `We are carrying out this plan for the task "%s":
+
+%s
+Now do step %d only: %s
+
+Use tools as needed. When the step is done, briefly report what you did.`
+
+// planStepPattern matches a step of a numbered plan, e.g. "1. Read the file"
+var planStepPattern = regexp.MustCompile(`^\s*(?:\*\*)?\d+[.)](?:\*\*)?\s+(.+)$`)
+
+// Plan is a numbered list of steps for a task
+type Plan struct {
+	Task  string
+	Steps []string
+}
+
+// String returns the plan as a numbered list
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for i, step := range p.Steps {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, step)
+	}
+	return sb.String()
+}
+
+// PlanStepAction is the user's choice before a step of a plan
+type PlanStepAction int
+
+const (
+	PlanStepRun   PlanStepAction = iota // Run the step
+	PlanStepSkip                        // Skip to the next step
+	PlanStepAbort                       // Stop the plan
+)
+
+// PlanOptions configures the execution of a plan
+type PlanOptions struct {
+	// Approve is shown the plan and returns whether to execute it; nil
+	// approves every plan
+	Approve func(plan *Plan) bool
+
+	// BeforeStep decides about step i (0-based) of the plan; nil runs
+	// every step
+	BeforeStep func(plan *Plan, i int) PlanStepAction
+
+	// OnChunk receives the streamed answer of each step
+	OnChunk func(string)
+}
+
+// PlanResult reports the execution of a plan
+type PlanResult struct {
+	Plan    *Plan
+	Answers []string // Answer of each step run; empty for skipped steps
+	Ran     int      // Steps run
+	Aborted bool     // The plan was rejected or stopped before its end
+}
+
+// MakePlan asks the model for a numbered plan for a task, with the context
+// of the current conversation but without tools. Nothing is stored. The
+// task and the plan are screened like a turn's input and answer; a plan the
+// guardrails block fails.
+func (a *Agent) MakePlan(ctx context.Context, task string) (*Plan, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("loading conversation: %w", err)
+	}
+	if task, err = a.screenInput(ctx, task); err != nil {
+		return nil, err
+	}
+	messages, err := a.buildTurnMessages(conv, fmt.Sprintf(planRequest, maxPlanSteps, task))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.complete(ctx, messages, &llm.CompleteOptions{CacheKey: a.conversationID}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("planning: %w", err)
+	}
+	screened, err := a.screen(ctx, guardrails.StageOutput, resp.Content)
+	if err != nil {
+		return nil, err
+	}
+	if err := screened.Err(); err != nil {
+		return nil, fmt.Errorf("planning: %w", err)
+	}
+
+	plan := &Plan{Task: task, Steps: parsePlanSteps(screened.Text)}
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("the model returned no numbered plan: %s", truncateRunes(resp.Content, 200))
+	}
+	a.log.Info("plan made", "steps", len(plan.Steps))
+	return plan, nil
+}
+
+// parsePlanSteps returns the numbered lines of a reply, at most
+// maxPlanSteps
+func parsePlanSteps(reply string) []string {
+	var steps []string
+	for _, line := range strings.Split(reply, "\n") {
+		m := planStepPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if step := strings.TrimSpace(m[1]); step != "" {
+			steps = append(steps, step)
+		}
+		if len(steps) == maxPlanSteps {
+			break
+		}
+	}
+	return steps
+}
+
+// RunPlan makes a plan for a task and, once approved, executes it
+func (a *Agent) RunPlan(ctx context.Context, task string, opts PlanOptions) (*PlanResult, error) {
+	plan, err := a.MakePlan(ctx, task)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Approve != nil && !opts.Approve(plan) {
+		a.log.Info("plan rejected")
+		return &PlanResult{Plan: plan, Aborted: true}, nil
+	}
+	return a.ExecutePlan(ctx, plan, opts)
+}
+
+// ExecutePlan runs the steps of a plan one turn each. Within a step every
+// tool that is not read-only asks for confirmation, even when tools.confirm
+// or an earlier "always" answer allows it; "always" then holds for the
+// rest of the step. Denying a tool aborts the plan.
+func (a *Agent) ExecutePlan(ctx context.Context, plan *Plan, opts PlanOptions) (*PlanResult, error) {
+	result := &PlanResult{Plan: plan, Answers: make([]string, len(plan.Steps))}
+	defer func() { a.planStepTools = nil }()
+
+	for i, step := range plan.Steps {
+		action := PlanStepRun
+		if opts.BeforeStep != nil {
+			action = opts.BeforeStep(plan, i)
+		}
+		if action == PlanStepSkip {
+			a.log.Info("plan step skipped", "step", i+1)
+			continue
+		}
+		if action == PlanStepAbort {
+			result.Aborted = true
+			break
+		}
+
+		a.log.Info("plan step started", "step", i+1, "of", len(plan.Steps))
+		a.planStepTools = make(map[string]bool)
+		prompt := fmt.Sprintf(planStepRequest, plan.Task, plan.String(), i+1, step)
+		answer, err := a.ChatStream(ctx, prompt, opts.OnChunk)
+		if errors.Is(err, ErrToolDenied) {
+			result.Aborted = true
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		result.Answers[i] = answer.Content
+		result.Ran++
+	}
+	a.log.Info("plan finished", "ran", result.Ran, "steps", len(plan.Steps), "aborted", result.Aborted)
+	return result, nil
+}
+
+// planToolDecision tightens the policy decision for a call made during a
+// plan step: tools that would run unasked ask unless they are read-only or
+// were allowed for the step
+func (a *Agent) planToolDecision(name string, decision toolDecision) toolDecision {
+	if a.planStepTools == nil || decision != toolAllow || a.tools.IsSafeTool(name) || a.planStepTools[name] {
+		return decision
+	}
+	return toolAsk
+}
+
+// ConsolePlanOptions asks on the terminal whether to run a plan and each of
+// its steps, showing the plan and questions on stderr. The answer of each
+// step goes to write; flush is called before each prompt so buffered output
+// shows first.
+func ConsolePlanOptions(write func(string), flush func()) PlanOptions {
+	ask := func(prompt string) string {
+		flush()
+		fmt.Fprint(os.Stderr, prompt)
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return "q"
+		}
+		return strings.ToLower(strings.TrimSpace(answer))
+	}
+	return PlanOptions{
+		Approve: func(plan *Plan) bool {
+			fmt.Fprintf(os.Stderr, "Plan:\n%s\n", plan)
+			answer := ask("Run this plan? [y/N]: ")
+			return answer == "y" || answer == "yes"
+		},
+		BeforeStep: func(plan *Plan, i int) PlanStepAction {
+			fmt.Fprintf(os.Stderr, "\nStep %d/%d: %s\n", i+1, len(plan.Steps), plan.Steps[i])
+			switch ask("Run it? [Y/s=skip/q=abort]: ") {
+			case "s", "skip":
+				return PlanStepSkip
+			case "q", "quit", "abort", "n", "no":
+				return PlanStepAbort
+			}
+			fmt.Fprintln(os.Stderr)
+			return PlanStepRun
+		},
+		OnChunk: write,
+	}
+}
+
+// FormatPlanResult summarizes how a plan went
+func FormatPlanResult(r *PlanResult) string {
+	switch {
+	case r.Ran == 0 && r.Aborted:
+		return "Plan aborted; no steps were run."
+	case r.Aborted:
+		return fmt.Sprintf("Plan aborted after %d of %d steps.", r.Ran, len(r.Plan.Steps))
+	case r.Ran < len(r.Plan.Steps):
+		return fmt.Sprintf("Plan finished: %d of %d steps run, %d skipped.", r.Ran, len(r.Plan.Steps), len(r.Plan.Steps)-r.Ran)
+	}
+	return fmt.Sprintf("Plan finished: all %d steps run.", r.Ran)
+}
+
+// SetPlanMode makes the REPL plan every message before carrying it out,
+// as /plan does for one task
+func (a *Agent) SetPlanMode(on bool) {
+	a.planMode = on
+}
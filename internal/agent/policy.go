@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/igm/igent/internal/tools"
+)
+
+// ToolAnswer is the user's answer to a tool confirmation prompt
+type ToolAnswer int
+
+const (
+	ToolAnswerNo     ToolAnswer = iota // Deny; the turn stops
+	ToolAnswerYes                      // Allow this call
+	ToolAnswerAlways                   // Allow this tool for the rest of the session
+)
+
+// ToolPromptFunc asks the user whether a tool call may run
+type ToolPromptFunc func(call *tools.ToolCall) ToolAnswer
+
+// toolDecision is what the confirmation policy decides for a tool call
+type toolDecision string
+
+const (
+	toolAllow toolDecision = "allow"
+	toolDeny  toolDecision = "deny"
+	toolAsk   toolDecision = "ask"
+)
+
+// toolPolicy decides which tool calls need confirmation: tools disabled
+// for the session, then per-tool rules from tools.confirm, then tools
+// allowed for the session, then the registry's safe tools
+type toolPolicy struct {
+	rules    map[string]toolDecision // By exact tool name
+	patterns []toolRule              // Glob rules, longest pattern first
+
+	mu      sync.Mutex
+	session map[string]bool // Tools the user allowed for the session
+
+	// Tools the user disabled for the session. They outlive the policy:
+	// a persona's policy takes them over, and profile agents share them.
+	off *toolSet
+}
+
+// toolSet is a set of tool names safe for concurrent use
+type toolSet struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newToolSet() *toolSet {
+	return &toolSet{names: make(map[string]bool)}
+}
+
+func (s *toolSet) add(name string) {
+	s.mu.Lock()
+	s.names[name] = true
+	s.mu.Unlock()
+}
+
+// remove reports whether the set had the name
+func (s *toolSet) remove(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	had := s.names[name]
+	delete(s.names, name)
+	return had
+}
+
+func (s *toolSet) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names[name]
+}
+
+func (s *toolSet) clear() {
+	s.mu.Lock()
+	clear(s.names)
+	s.mu.Unlock()
+}
+
+type toolRule struct {
+	pattern  string
+	decision toolDecision
+}
+
+// newToolPolicy validates the tools.confirm rules
+func newToolPolicy(confirm map[string]string) (*toolPolicy, error) {
+	p := &toolPolicy{
+		rules:   make(map[string]toolDecision),
+		session: make(map[string]bool),
+		off:     newToolSet(),
+	}
+	for pattern, value := range confirm {
+		decision := toolDecision(strings.ToLower(strings.TrimSpace(value)))
+		switch decision {
+		case toolAllow, toolDeny, toolAsk:
+		default:
+			return nil, fmt.Errorf("tools.confirm.%s: %q is not allow, deny or ask", pattern, value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("tools.confirm: invalid pattern %q: %w", pattern, err)
+		}
+		if strings.ContainsAny(pattern, "*?[") {
+			p.patterns = append(p.patterns, toolRule{pattern, decision})
+		} else {
+			p.rules[pattern] = decision
+		}
+	}
+	// The most specific (longest) pattern wins
+	sort.Slice(p.patterns, func(i, j int) bool {
+		if len(p.patterns[i].pattern) != len(p.patterns[j].pattern) {
+			return len(p.patterns[i].pattern) > len(p.patterns[j].pattern)
+		}
+		return p.patterns[i].pattern < p.patterns[j].pattern
+	})
+	return p, nil
+}
+
+// decide returns the decision for a tool. A tool disabled for the session
+// is denied; configured rules come next, so a deny rule cannot be
+// overridden by an answer in the session.
+func (p *toolPolicy) decide(name string, safe bool) toolDecision {
+	if p.off.has(name) {
+		return toolDeny
+	}
+
+	decision, ok := p.rule(name)
+	if ok && decision != toolAsk {
+		return decision
+	}
+	p.mu.Lock()
+	allowed := p.session[name]
+	p.mu.Unlock()
+	if allowed || (!ok && safe) {
+		return toolAllow
+	}
+	return toolAsk
+}
+
+// rule returns the tools.confirm decision for a tool, if a rule matches it
+func (p *toolPolicy) rule(name string) (toolDecision, bool) {
+	if decision, ok := p.rules[name]; ok {
+		return decision, true
+	}
+	for _, r := range p.patterns {
+		if matched, _ := path.Match(r.pattern, name); matched {
+			return r.decision, true
+		}
+	}
+	return "", false
+}
+
+// allowForSession stops asking about a tool until the agent exits
+func (p *toolPolicy) allowForSession(name string) {
+	p.mu.Lock()
+	p.session[name] = true
+	p.mu.Unlock()
+}
+
+// disableForSession denies a tool until the agent exits or it is enabled
+// again, whatever tools.confirm says
+func (p *toolPolicy) disableForSession(name string) {
+	p.off.add(name)
+}
+
+// enableForSession undoes disableForSession; it reports whether the tool
+// was disabled
+func (p *toolPolicy) enableForSession(name string) bool {
+	return p.off.remove(name)
+}
+
+// disabled reports whether a tool is disabled for the session
+func (p *toolPolicy) disabled(name string) bool {
+	return p.off.has(name)
+}
+
+// resetSession forgets the tools allowed and disabled for the session
+func (p *toolPolicy) resetSession() {
+	p.mu.Lock()
+	clear(p.session)
+	p.mu.Unlock()
+	p.off.clear()
+}
+
+// parseToolAnswer reads a typed answer to a confirmation prompt
+func parseToolAnswer(answer string) ToolAnswer {
+	switch strings.TrimSpace(strings.ToLower(answer)) {
+	case "y", "yes":
+		return ToolAnswerYes
+	case "a", "always":
+		return ToolAnswerAlways
+	}
+	return ToolAnswerNo
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProjectNamespace returns the conversation namespace for dir: the name of
+// the enclosing git repository, or "" outside a repository. Conversations
+// started in a project default to <namespace>/default.
+func ProjectNamespace(dir string) string {
+	root := findRepoRoot(dir)
+	if root == "" {
+		return ""
+	}
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ' ', ':':
+			return '-'
+		}
+		return r
+	}, filepath.Base(root))
+	if name == "." || name == ".." || name == "" {
+		return ""
+	}
+	return name
+}
+
+// ProjectConversation returns the default conversation ID for dir:
+// <namespace>/default inside a git repository, otherwise "default"
+func ProjectConversation(dir string) string {
+	if ns := ProjectNamespace(dir); ns != "" {
+		return ns + "/default"
+	}
+	return "default"
+}
+
+// findRepoRoot walks up from dir to the directory containing .git (a
+// directory, or a file in worktrees and submodules)
+func findRepoRoot(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
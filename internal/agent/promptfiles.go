@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// promptFiles are the agent.system_prompt_files appended to the system
+// prompt. Files are re-read only when their size or modification time
+// changes, so edits apply to the next turn without re-reading every file on
+// every request.
+type promptFiles struct {
+	mu    sync.Mutex
+	paths []string
+	cache map[string]promptFile // Keyed by resolved path
+	log   *slog.Logger
+}
+
+// promptFile is the cached content of one include file
+type promptFile struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+func newPromptFiles(paths []string, log *slog.Logger) *promptFiles {
+	return &promptFiles{paths: paths, cache: make(map[string]promptFile), log: log}
+}
+
+// text returns the contents of the include files in order, separated by
+// blank lines. Missing files are skipped, so project files such as
+// ./IGENT.md can be listed for repositories that may not have one.
+func (p *promptFiles) text() string {
+	if p == nil || len(p.paths) == 0 {
+		return ""
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var parts []string
+	for _, path := range p.paths {
+		if content := p.read(resolvePromptPath(path)); content != "" {
+			parts = append(parts, content)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// read returns a file's content, from the cache unless it changed
+func (p *promptFiles) read(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			p.log.Warn("reading system prompt file failed", "path", path, "error", err)
+		}
+		delete(p.cache, path)
+		return ""
+	}
+
+	cached, ok := p.cache[path]
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.content
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.log.Warn("reading system prompt file failed", "path", path, "error", err)
+		return cached.content
+	}
+	if ok {
+		p.log.Info("system prompt file changed", "path", path)
+	}
+	content := strings.TrimSpace(string(data))
+	p.cache[path] = promptFile{modTime: info.ModTime(), size: info.Size(), content: content}
+	return content
+}
+
+// resolvePromptPath expands a leading ~/; relative paths are resolved
+// against the working directory
+func resolvePromptPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
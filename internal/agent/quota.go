@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// ErrQuotaExceeded is returned when a usage quota is used up
+var ErrQuotaExceeded = errors.New("usage quota exceeded")
+
+// QuotaError reports the quota that is used up
+type QuotaError struct {
+	Subject string    // e.g. "user alice" or "API key 3f2a9c1e"
+	Period  string    // daily or monthly
+	Limit   string    // e.g. "100000 tokens" or "$5.00"
+	Resets  time.Time // Start of the next period
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of %s for %s exceeded; resets %s",
+		e.Period, e.Limit, e.Subject, e.Resets.Format("2006-01-02 15:04"))
+}
+
+func (e *QuotaError) Unwrap() error { return ErrQuotaExceeded }
+
+// StatusCode is the HTTP status an API answers a QuotaError with
+func (e *QuotaError) StatusCode() int { return http.StatusTooManyRequests }
+
+// quota records LLM usage in the usage ledger and enforces the configured
+// daily and monthly limits per user and per API key
+type quota struct {
+	store    *storage.JSONStore
+	subjects []quotaSubject
+	warnAt   float64
+	log      *slog.Logger
+
+	mu     sync.Mutex
+	warned map[string]bool // Warnings already given, by subject, period and period start
+}
+
+// quotaSubject is a ledger entry usage is recorded under
+type quotaSubject struct {
+	id     string // Ledger key
+	name   string // For messages
+	limits config.QuotaLimits
+}
+
+func newQuota(cfg *config.Config, store *storage.JSONStore, log *slog.Logger) *quota {
+	name := cfg.Quota.User
+	if name == "" {
+		name = currentUser()
+	}
+	q := &quota{
+		store:  store,
+		warnAt: cfg.Quota.WarnAt,
+		log:    log,
+		warned: make(map[string]bool),
+		subjects: []quotaSubject{
+			{id: "user:" + name, name: "user " + name, limits: cfg.Quota.PerUser},
+		},
+	}
+	if key := cfg.Provider.APIKey; key != "" {
+		fp := keyFingerprint(key)
+		q.subjects = append(q.subjects, quotaSubject{id: "key:" + fp, name: "API key " + fp, limits: cfg.Quota.PerKey})
+	}
+	return q
+}
+
+// check returns a QuotaError when a quota is used up, and reports quotas
+// past the warning threshold to warn once per period
+func (q *quota) check(now time.Time, warn func(string)) error {
+	if q == nil {
+		return nil
+	}
+	for _, s := range q.subjects {
+		l := s.limits
+		if l == (config.QuotaLimits{}) {
+			continue
+		}
+		day, month, err := q.store.LoadUsage(s.id, now)
+		if err != nil {
+			// An unreadable ledger must not stop the agent
+			q.log.Warn("reading usage ledger failed", "error", err)
+			return nil
+		}
+
+		dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		periods := []struct {
+			name   string
+			start  time.Time
+			resets time.Time
+			used   usageAmount
+			limit  usageAmount
+		}{
+			{"daily", dayStart, dayStart.AddDate(0, 0, 1), usageAmount{day.Tokens, day.Cost}, usageAmount{l.DailyTokens, l.DailyCost}},
+			{"monthly", monthStart, monthStart.AddDate(0, 1, 0), usageAmount{month.Tokens, month.Cost}, usageAmount{l.MonthlyTokens, l.MonthlyCost}},
+		}
+		for _, p := range periods {
+			fraction, limit := p.used.fractionOf(p.limit)
+			if fraction >= 1 {
+				return &QuotaError{Subject: s.name, Period: p.name, Limit: limit, Resets: p.resets}
+			}
+			if q.warnAt <= 0 || fraction < q.warnAt || warn == nil {
+				continue
+			}
+			key := s.id + "/" + p.name + "/" + p.start.Format(time.DateOnly)
+			q.mu.Lock()
+			warned := q.warned[key]
+			q.warned[key] = true
+			q.mu.Unlock()
+			if !warned {
+				warn(fmt.Sprintf("%.0f%% of the %s quota of %s for %s used", fraction*100, p.name, limit, s.name))
+			}
+		}
+	}
+	return nil
+}
+
+// record adds the usage of a response to the ledger, under the quota
+// subjects and the conversation it was made in, priced by the model that
+// answered
+func (q *quota) record(now time.Time, resp *llm.Response, conversation string, pricing llm.Preset) {
+	if q == nil || resp == nil {
+		return
+	}
+	tokens := responseTokens(resp)
+	if tokens == 0 {
+		return
+	}
+	ids := make([]string, len(q.subjects), len(q.subjects)+1)
+	for i, s := range q.subjects {
+		ids[i] = s.id
+	}
+	if conversation != "" {
+		ids = append(ids, conversationSubject(conversation))
+	}
+	if err := q.store.AddUsage(ids, now, tokens, pricing.Cost(resp.PromptTokens, resp.OutputTokens)); err != nil {
+		q.log.Warn("recording usage failed", "error", err)
+	}
+}
+
+// userSubject is the ledger entry of the user
+func (q *quota) userSubject() string {
+	return q.subjects[0].id
+}
+
+// usageAmount is an amount of tokens and estimated USD
+type usageAmount struct {
+	Tokens int
+	Cost   float64
+}
+
+// fractionOf returns the largest used fraction of the non-zero limits and
+// that limit formatted for messages
+func (u usageAmount) fractionOf(limit usageAmount) (float64, string) {
+	var fraction float64
+	var label string
+	if limit.Tokens > 0 {
+		fraction = float64(u.Tokens) / float64(limit.Tokens)
+		label = fmt.Sprintf("%d tokens", limit.Tokens)
+	}
+	if limit.Cost > 0 {
+		if f := u.Cost / limit.Cost; label == "" || f > fraction {
+			fraction = f
+			label = fmt.Sprintf("$%.2f", limit.Cost)
+		}
+	}
+	return fraction, label
+}
+
+// keyFingerprint identifies an API key in the ledger without storing it
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// currentUser returns the OS user name
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "default"
+}
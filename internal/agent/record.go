@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/igm/igent/internal/transcript"
+)
+
+// SetRecorder records the session to r as a replayable transcript: every
+// chat turn with its tool calls, results and timings. A nil r stops
+// recording.
+func (a *Agent) SetRecorder(r *transcript.Recorder) {
+	a.recorder = r
+	r.Record(transcript.Event{
+		Type:         transcript.EventSession,
+		Conversation: a.conversationID,
+		Provider:     a.config.Provider.Type,
+		Model:        a.config.Provider.Model,
+	})
+}
+
+// recordTurn records the prompt of a turn and returns the function that
+// records how the turn ended. A continued turn resumes an interrupted
+// answer to input.
+func (a *Agent) recordTurn(input string, continued bool) func(response string, err error) {
+	if a.recorder == nil {
+		return func(string, error) {}
+	}
+	start := time.Now()
+	a.recorder.Record(transcript.Event{Type: transcript.EventPrompt, Conversation: a.conversationID, Text: input, Continued: continued})
+	return func(response string, err error) {
+		e := transcript.Event{
+			Type:         transcript.EventResponse,
+			Conversation: a.conversationID,
+			Text:         response,
+			DurationMS:   time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			e.Type, e.Text = transcript.EventError, err.Error()
+		}
+		a.recorder.Record(e)
+	}
+}
+
+// ReplayedTurn is a recorded turn next to its replay
+type ReplayedTurn struct {
+	Recorded transcript.Turn
+	Replayed transcript.Turn
+}
+
+// ReplayOptions configures a replay
+type ReplayOptions struct {
+	OnChunk    func(string)                          // Streamed answers of the replay
+	BeforeTurn func(i int, recorded transcript.Turn) // Before turn i is sent again
+	AfterTurn  func(i int, turn ReplayedTurn)        // After turn i was replayed
+}
+
+// Replay sends the prompts of recorded turns again in the current
+// conversation, e.g. to compare another model with the recorded one, and
+// returns each replayed turn next to the recorded one. Continued turns are
+// skipped, their prompt having been sent already. A failed turn is
+// reported and the replay goes on; cancelling ctx stops it.
+func (a *Agent) Replay(ctx context.Context, turns []transcript.Turn, opts ReplayOptions) ([]ReplayedTurn, error) {
+	if a.recorder == nil {
+		a.recorder = transcript.NewRecorder(io.Discard, a.log)
+		defer func() { a.recorder = nil }()
+	}
+
+	var results []ReplayedTurn
+	for i, recorded := range turns {
+		if recorded.Prompt.Continued {
+			continue
+		}
+		if opts.BeforeTurn != nil {
+			opts.BeforeTurn(i, recorded)
+		}
+
+		var events []transcript.Event
+		untap := a.recorder.Tap(func(e transcript.Event) { events = append(events, e) })
+		_, err := a.ChatStream(ctx, recorded.Prompt.Text, opts.OnChunk)
+		untap()
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		result := ReplayedTurn{Recorded: recorded, Replayed: transcript.Turn{Prompt: recorded.Prompt}}
+		if replayed := transcript.Turns(events); len(replayed) > 0 {
+			result.Replayed = replayed[0]
+		}
+		if err != nil {
+			a.log.Warn("replayed turn failed", "turn", i+1, "error", err)
+		}
+		results = append(results, result)
+		if opts.AfterTurn != nil {
+			opts.AfterTurn(i, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// checkNewConversationID validates an ID for a renamed or cloned
+// conversation, which must not exist yet
+func (a *Agent) checkNewConversationID(id string) error {
+	if err := storage.ValidateConversationID(id); err != nil {
+		return err
+	}
+	_, err := a.store.LoadConversation(id)
+	if err == nil {
+		return fmt.Errorf("conversation %s already exists", id)
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// RenameConversation changes the ID of a conversation. Its working
+// document moves along, and the memories scoped to it, runs, schedules,
+// entities and the routing cache referring to it are updated. Artifacts
+// keep the ID they were produced under. If a step fails, the steps before
+// it are undone.
+func (a *Agent) RenameConversation(oldID, newID string) error {
+	if oldID == newID {
+		return nil
+	}
+	conv, err := a.store.LoadConversation(oldID)
+	if err != nil {
+		return err
+	}
+	if err := a.checkNewConversationID(newID); err != nil {
+		return err
+	}
+
+	// Save under the new ID first, so the conversation is never missing
+	conv.ID = newID
+	if err := a.store.SaveConversation(conv); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	undo := func() {
+		if err := a.renameReferences(newID, oldID); err != nil {
+			a.log.Warn("undoing the rename failed", "from", oldID, "to", newID, "error", err)
+		}
+		if err := a.store.DeleteConversation(newID); err != nil {
+			a.log.Warn("undoing the rename failed", "from", oldID, "to", newID, "error", err)
+		}
+	}
+	if err := a.renameReferences(oldID, newID); err != nil {
+		undo()
+		return err
+	}
+	if err := a.store.DeleteConversation(oldID); err != nil {
+		undo()
+		return fmt.Errorf("removing %s: %w", oldID, err)
+	}
+
+	if a.conversationID == oldID {
+		a.conversationID = newID
+	}
+	a.log.Info("conversation renamed", "from", oldID, "to", newID)
+	return nil
+}
+
+// renameReferences points everything stored about a conversation to its
+// new ID
+func (a *Agent) renameReferences(oldID, newID string) error {
+	doc, err := a.store.LoadDocument(oldID)
+	if err == nil {
+		doc.ConversationID = newID
+		if err := a.store.SaveDocument(doc); err != nil {
+			return fmt.Errorf("moving document: %w", err)
+		}
+		if err := a.store.DeleteDocument(oldID); err != nil {
+			return fmt.Errorf("moving document: %w", err)
+		}
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	memories, err := a.store.LoadMemories()
+	if err != nil {
+		return err
+	}
+	for _, m := range memories {
+		if m.Scope == oldID {
+			m.Scope = newID
+			if err := a.store.SaveMemory(m); err != nil {
+				return fmt.Errorf("updating memory %s: %w", m.ID, err)
+			}
+		}
+	}
+
+	runs, err := a.store.ListRuns()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.ConversationID == oldID {
+			run.ConversationID = newID
+			if err := a.store.SaveRun(run); err != nil {
+				return fmt.Errorf("updating run %s: %w", run.ID, err)
+			}
+		}
+	}
+
+	schedules, err := a.store.ListSchedules()
+	if err != nil {
+		return err
+	}
+	for _, s := range schedules {
+		if s.ConversationID == oldID {
+			s.ConversationID = newID
+			if err := a.store.SaveSchedule(s); err != nil {
+				return fmt.Errorf("updating schedule %s: %w", s.ID, err)
+			}
+		}
+	}
+
+	entities, err := a.store.ListEntities()
+	if err != nil {
+		return err
+	}
+	for _, e := range entities {
+		if i := slices.Index(e.Conversations, oldID); i >= 0 {
+			e.Conversations = slices.Delete(e.Conversations, i, i+1)
+			e.MentionedIn(newID)
+			if err := a.store.SaveEntity(e); err != nil {
+				return fmt.Errorf("updating entity %s: %w", e.Name, err)
+			}
+		}
+	}
+
+	cache, err := a.store.LoadEmbeddings()
+	if err != nil {
+		return err
+	}
+	if embedding, ok := cache[oldID]; ok {
+		delete(cache, oldID)
+		cache[newID] = embedding
+		if err := a.store.SaveEmbeddings(cache); err != nil {
+			return fmt.Errorf("updating routing cache: %w", err)
+		}
+	}
+	return a.moveHistory(oldID, newID)
+}
+
+// CloneConversation copies a conversation and its working document to a
+// new ID, e.g. to try a different direction without losing the original.
+// Memories scoped to the original are not copied. The clone keeps the
+// original's integrity record, as its new hash chain only vouches for the
+// copy.
+func (a *Agent) CloneConversation(id, newID string) error {
+	conv, err := a.store.LoadConversation(id)
+	if err != nil {
+		return err
+	}
+	if err := a.checkNewConversationID(newID); err != nil {
+		return err
+	}
+
+	conv.ID = newID
+	conv.CreatedAt = time.Now()
+	if err := a.store.SaveConversation(conv); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+
+	doc, err := a.store.LoadDocument(id)
+	if err == nil {
+		doc.ConversationID = newID
+		if err := a.store.SaveDocument(doc); err != nil {
+			return fmt.Errorf("copying document: %w", err)
+		}
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	a.log.Info("conversation cloned", "from", id, "to", newID)
+	return nil
+}
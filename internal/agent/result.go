@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// ChatResult is the outcome of a turn: the answer and what it took to get
+type ChatResult struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+
+	// Token usage of all provider calls of the turn
+	PromptTokens int `json:"prompt_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	TotalTokens  int `json:"total_tokens"`
+
+	// ToolCalls are the tool calls made, with their output, in order
+	ToolCalls []storage.ToolRecord `json:"tool_calls,omitempty"`
+
+	// Cost is the estimated cost in USD from the model's per-token prices;
+	// 0 when they are unknown
+	Cost float64 `json:"cost,omitempty"`
+
+	Iterations   int           `json:"iterations"`    // Provider calls of the agentic loop
+	Duration     time.Duration `json:"duration"`      // From the first provider call to the final answer
+	FinishReason string        `json:"finish_reason"` // Of the final provider call
+}
+
+// add counts the usage of one provider response
+func (r *ChatResult) add(resp *llm.Response) {
+	r.PromptTokens += resp.PromptTokens
+	r.OutputTokens += resp.OutputTokens
+	r.CachedTokens += resp.CachedTokens
+	r.TotalTokens += responseTokens(resp)
+	r.FinishReason = resp.FinishReason
+}
+
+// Summary renders the turn's metadata as one line, such as
+// "gpt-4o · 1234 tokens (1000 in, 234 out) · ~$0.0048 · 2 tool calls · 3.4s"
+func (r *ChatResult) Summary() string {
+	parts := []string{r.Model}
+	if r.PromptTokens > 0 || r.OutputTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d tokens (%d in, %d out)", r.TotalTokens, r.PromptTokens, r.OutputTokens))
+	} else {
+		parts = append(parts, fmt.Sprintf("%d tokens", r.TotalTokens))
+	}
+	if r.Cost > 0 {
+		parts = append(parts, fmt.Sprintf("~$%.4f", r.Cost))
+	}
+	if n := len(r.ToolCalls); n == 1 {
+		parts = append(parts, "1 tool call")
+	} else if n > 1 {
+		parts = append(parts, fmt.Sprintf("%d tool calls", n))
+	}
+	parts = append(parts, r.Duration.Round(100*time.Millisecond).String())
+	if r.FinishReason != "" && r.FinishReason != llm.FinishReasonStop {
+		parts = append(parts, "finish: "+r.FinishReason)
+	}
+	return strings.Join(parts, " · ")
+}
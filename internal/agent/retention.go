@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// GCResult reports what a garbage collection removed, or would remove on a
+// dry run
+type GCResult struct {
+	Archived []string              // Conversations moved to the archive
+	Deleted  []string              // Conversations deleted
+	Memories []*storage.MemoryItem // Low-relevance memories deleted
+	DryRun   bool
+}
+
+// Empty reports whether nothing was removed
+func (r *GCResult) Empty() bool {
+	return len(r.Archived) == 0 && len(r.Deleted) == 0 && len(r.Memories) == 0
+}
+
+// GC applies the retention policy of the storage config: conversations not
+// updated for retention_days, or beyond the max_conversations most recently
+// updated, are archived or deleted per retention_action, and memories with
+// a relevance below prune_relevance are deleted. The current conversation
+// is kept. With dryRun nothing is changed.
+func (a *Agent) GC(now time.Time, dryRun bool) (*GCResult, error) {
+	cfg := a.config.Storage
+	action := strings.ToLower(cfg.RetentionAction)
+	if action == "" {
+		action = "archive"
+	}
+	if action != "archive" && action != "delete" {
+		return nil, fmt.Errorf("unknown storage.retention_action %q (want archive or delete)", cfg.RetentionAction)
+	}
+	result := &GCResult{DryRun: dryRun}
+
+	infos, err := a.store.ListConversationInfos()
+	if err != nil {
+		return nil, fmt.Errorf("listing conversations: %w", err)
+	}
+	cutoff := now.AddDate(0, 0, -cfg.RetentionDays)
+	kept := 0
+	for _, info := range infos {
+		expired := cfg.RetentionDays > 0 && info.UpdatedAt.Before(cutoff)
+		excess := cfg.MaxConversations > 0 && kept >= cfg.MaxConversations
+		if info.ID == a.conversationID || (!expired && !excess) {
+			kept++
+			continue
+		}
+
+		if action == "delete" {
+			if !dryRun {
+				if err := a.DeleteConversation(info.ID); err != nil {
+					return result, fmt.Errorf("deleting conversation %s: %w", info.ID, err)
+				}
+			}
+			result.Deleted = append(result.Deleted, info.ID)
+			continue
+		}
+		if !dryRun {
+			if err := a.store.ArchiveConversation(info.ID); err != nil {
+				return result, fmt.Errorf("archiving conversation %s: %w", info.ID, err)
+			}
+		}
+		result.Archived = append(result.Archived, info.ID)
+	}
+
+	if cfg.PruneRelevance > 0 {
+		memories, err := a.store.LoadMemories()
+		if err != nil {
+			return result, fmt.Errorf("loading memories: %w", err)
+		}
+		for _, m := range memories {
+			if m.Relevance >= cfg.PruneRelevance {
+				continue
+			}
+			if !dryRun {
+				if err := a.store.DeleteMemory(m.ID); err != nil {
+					return result, fmt.Errorf("deleting memory %s: %w", m.ID, err)
+				}
+			}
+			result.Memories = append(result.Memories, m)
+		}
+	}
+
+	a.log.Info("garbage collection finished", "archived", len(result.Archived), "deleted", len(result.Deleted),
+		"memories", len(result.Memories), "dry_run", dryRun)
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// ErrNoExchange is returned by Undo and Retry when the conversation has no
+// exchange yet
+var ErrNoExchange = errors.New("the conversation has no exchange yet")
+
+// RetryOptions changes how Retry regenerates the last answer. Zero values
+// keep the configured model and the provider's default temperature.
+type RetryOptions struct {
+	Model       string
+	Temperature *float64
+}
+
+// ParseRetryOptions reads the arguments of /retry: a number is the
+// temperature, anything else the model
+func ParseRetryOptions(args []string) (RetryOptions, error) {
+	var opts RetryOptions
+	for _, arg := range args {
+		t, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			opts.Model = arg
+			continue
+		}
+		if t < 0 || t > 2 {
+			return opts, fmt.Errorf("temperature %s is out of range (0 to 2)", arg)
+		}
+		opts.Temperature = &t
+	}
+	return opts, nil
+}
+
+// Undo removes the last exchange from the current conversation: the last
+// user message with the tool calls and answer that followed it. An
+// interrupted answer waiting for /continue is the last exchange if there
+// is one. It returns the removed user input.
+func (a *Agent) Undo() (string, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return "", fmt.Errorf("loading conversation: %w", err)
+	}
+	input, ok := dropLastExchange(conv)
+	if !ok {
+		return "", ErrNoExchange
+	}
+	if err := a.saveConversation(conv); err != nil {
+		return "", fmt.Errorf("saving conversation: %w", err)
+	}
+	a.log.Info("last exchange undone", "conversation", a.conversationID)
+	return input, nil
+}
+
+// Retry regenerates the last answer: the last exchange is dropped and its
+// input sent again, with opts applied to this turn only. If the new turn
+// fails the old exchange is kept, unless the new answer was cut off and
+// saved for /continue.
+func (a *Agent) Retry(ctx context.Context, opts RetryOptions, onChunk func(string)) (string, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return "", fmt.Errorf("loading conversation: %w", err)
+	}
+	original := *conv
+	input, ok := dropLastExchange(conv)
+	if !ok {
+		return "", ErrNoExchange
+	}
+
+	if opts.Model != "" && opts.Model != a.model {
+		cfg := *a.config
+		cfg.Provider.Model = opts.Model
+		provider, err := llm.New(providerConfig(&cfg, a.netPolicy))
+		if err != nil {
+			return "", fmt.Errorf("initializing provider for %s: %w", opts.Model, err)
+		}
+		defaultProvider, defaultModel := a.provider, a.model
+		a.provider, a.model = provider, opts.Model
+		defer func() { a.provider, a.model = defaultProvider, defaultModel }()
+	}
+	a.temperature = opts.Temperature
+	defer func() { a.temperature = nil }()
+
+	if err := a.saveConversation(conv); err != nil {
+		return "", fmt.Errorf("saving conversation: %w", err)
+	}
+	if opts.Temperature != nil {
+		a.log.Info("retrying last exchange", "model", opts.Model, "temperature", *opts.Temperature)
+	} else {
+		a.log.Info("retrying last exchange", "model", opts.Model)
+	}
+	result, err := a.ChatStream(ctx, input, onChunk)
+	if err != nil {
+		var partial *PartialResponseError
+		if !errors.As(err, &partial) {
+			if saveErr := a.saveConversation(&original); saveErr != nil {
+				a.log.Warn("restoring the last exchange failed", "error", saveErr)
+			}
+		}
+		return "", err
+	}
+	return result.Content, nil
+}
+
+// dropLastExchange removes the last exchange from conv and returns its
+// user input
+func dropLastExchange(conv *storage.Conversation) (string, bool) {
+	if conv.Partial != nil {
+		input := conv.Partial.Input
+		conv.Partial = nil
+		return input, true
+	}
+	last := -1
+	for i := len(conv.Messages) - 1; i >= 0; i-- {
+		if conv.Messages[i].Role == "user" {
+			last = i
+			break
+		}
+	}
+	if last < 0 {
+		return "", false
+	}
+	input := conv.Messages[last].Content
+	conv.Messages = conv.Messages[:last]
+
+	var records []storage.ToolRecord
+	for _, r := range conv.ToolCalls {
+		if r.Message < last {
+			records = append(records, r)
+		}
+	}
+	conv.ToolCalls = records
+	return input, true
+}
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	// routeProfileChars caps the text that represents a conversation
+	routeProfileChars = 3000
+
+	// routeProfileMessages is how many recent user messages describe a conversation
+	routeProfileMessages = 10
+
+	// routeSlugWords is how many prompt words name a new conversation
+	routeSlugWords = 4
+)
+
+// routeStopWords are skipped when comparing prompts by keyword and naming
+// new conversations
+var routeStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "that": true, "this": true,
+	"what": true, "how": true, "why": true, "can": true, "you": true, "are": true,
+	"was": true, "from": true, "into": true, "about": true, "please": true, "should": true,
+	"would": true, "could": true, "does": true, "have": true, "has": true, "but": true,
+	"not": true, "all": true, "any": true, "its": true, "our": true, "your": true,
+	"when": true, "where": true, "which": true, "who": true, "will": true, "there": true,
+}
+
+// RouteResult describes the conversation a prompt was routed to
+type RouteResult struct {
+	ConversationID string
+	Similarity     float64 // Similarity of the prompt to the chosen conversation
+	Created        bool    // No conversation was similar enough
+	Method         string  // "embedding", or "keyword" when embeddings are unavailable
+}
+
+// routeCandidate is an existing conversation considered for a prompt
+type routeCandidate struct {
+	id      string
+	profile string
+}
+
+// RouteConversation switches to the existing conversation most relevant to
+// prompt, compared by embedding similarity to each conversation's summary
+// and recent requests, or to a new conversation named after the prompt when
+// none reaches routing.min_similarity. Without embedding support it falls
+// back to keyword overlap.
+func (a *Agent) RouteConversation(ctx context.Context, prompt string) (*RouteResult, error) {
+	ids, err := a.store.ListConversations()
+	if err != nil {
+		return nil, fmt.Errorf("listing conversations: %w", err)
+	}
+
+	var candidates []routeCandidate
+	for _, id := range ids {
+		conv, err := a.store.LoadConversation(id)
+		if err != nil {
+			a.log.Warn("skipping conversation for routing", "id", id, "error", err)
+			continue
+		}
+		if profile := conversationProfile(conv); profile != "" {
+			candidates = append(candidates, routeCandidate{id: id, profile: profile})
+		}
+	}
+
+	result := &RouteResult{Method: "embedding"}
+	scores, err := a.embeddingScores(ctx, prompt, candidates)
+	if err != nil {
+		if !errors.Is(err, llm.ErrEmbeddingsUnsupported) {
+			a.log.Warn("embedding conversations failed, using keywords", "error", err)
+		}
+		result.Method = "keyword"
+		scores = keywordScores(prompt, candidates)
+	}
+
+	for i, c := range candidates {
+		if scores[i] > result.Similarity {
+			result.ConversationID, result.Similarity = c.id, scores[i]
+		}
+	}
+	if result.ConversationID == "" || result.Similarity < a.config.Routing.MinSimilarity {
+		result.ConversationID = newConversationID(prompt, ids)
+		result.Created = true
+	}
+
+	a.log.Info("prompt routed",
+		"conversation", result.ConversationID,
+		"similarity", result.Similarity,
+		"created", result.Created,
+		"method", result.Method,
+	)
+	if err := a.SetConversation(result.ConversationID); err != nil {
+		return nil, fmt.Errorf("setting conversation: %w", err)
+	}
+	return result, nil
+}
+
+// embeddingScores compares the prompt to each candidate by cosine
+// similarity, embedding only conversations whose profile changed since the
+// cached embedding
+func (a *Agent) embeddingScores(ctx context.Context, prompt string, candidates []routeCandidate) ([]float64, error) {
+	embedder, ok := a.provider.(llm.Embedder)
+	if !ok {
+		return nil, llm.ErrEmbeddingsUnsupported
+	}
+
+	cache, err := a.store.LoadEmbeddings()
+	if err != nil {
+		return nil, err
+	}
+
+	texts := []string{prompt}
+	var stale []int
+	hashes := make([]string, len(candidates))
+	for i, c := range candidates {
+		hashes[i] = a.profileHash(c.profile)
+		if cached := cache[c.id]; cached == nil || cached.Hash != hashes[i] {
+			texts = append(texts, c.profile)
+			stale = append(stale, i)
+		}
+	}
+
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh the cache, dropping deleted conversations
+	fresh := make(map[string]*storage.ConversationEmbedding, len(candidates))
+	for _, c := range candidates {
+		fresh[c.id] = cache[c.id]
+	}
+	for j, i := range stale {
+		fresh[candidates[i].id] = &storage.ConversationEmbedding{Hash: hashes[i], Vector: vectors[j+1]}
+	}
+	if len(stale) > 0 || len(fresh) != len(cache) {
+		if err := a.store.SaveEmbeddings(fresh); err != nil {
+			a.log.Warn("saving conversation embeddings failed", "error", err)
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, c := range candidates {
+		scores[i] = llm.CosineSimilarity(vectors[0], fresh[c.id].Vector)
+	}
+	return scores, nil
+}
+
+// profileHash identifies a profile text embedded with the configured model
+func (a *Agent) profileHash(profile string) string {
+	sum := sha256.Sum256([]byte(a.config.Provider.Type + "\x00" + a.config.Provider.EmbeddingModel + "\x00" + profile))
+	return hex.EncodeToString(sum[:8])
+}
+
+// keywordScores scores each candidate by the share of the prompt's words
+// that appear in its profile
+func keywordScores(prompt string, candidates []routeCandidate) []float64 {
+	words := routeWords(prompt)
+	scores := make([]float64, len(candidates))
+	if len(words) == 0 {
+		return scores
+	}
+
+	seen := make(map[string]bool)
+	for i, c := range candidates {
+		clear(seen)
+		for _, w := range routeWords(c.profile) {
+			seen[w] = true
+		}
+		hits := 0
+		for _, w := range words {
+			if seen[w] {
+				hits++
+			}
+		}
+		scores[i] = float64(hits) / float64(len(words))
+	}
+	return scores
+}
+
+// conversationProfile is the text that represents a conversation for
+// routing: its summaries and most recent requests
+func conversationProfile(conv *storage.Conversation) string {
+	var requests []string
+	for i := len(conv.Messages) - 1; i >= 0 && len(requests) < routeProfileMessages; i-- {
+		if conv.Messages[i].Role == "user" {
+			requests = append(requests, conv.Messages[i].Content)
+		}
+	}
+
+	var sb strings.Builder
+	for _, summary := range []string{conv.LongTermSummary, conv.Summary} {
+		if summary != "" {
+			sb.WriteString(summary)
+			sb.WriteString("\n")
+		}
+	}
+	for i := len(requests) - 1; i >= 0; i-- {
+		sb.WriteString(requests[i])
+		sb.WriteString("\n")
+	}
+
+	profile := strings.TrimSpace(sb.String())
+	if len(profile) > routeProfileChars {
+		profile = profile[len(profile)-routeProfileChars:]
+	}
+	return profile
+}
+
+// routeWords returns the distinct lowercase words of text, without short
+// and stop words
+func routeWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(fields))
+	var words []string
+	for _, f := range fields {
+		if len([]rune(f)) < 3 || routeStopWords[f] || seen[f] {
+			continue
+		}
+		seen[f] = true
+		words = append(words, f)
+	}
+	return words
+}
+
+// newConversationID names a conversation after the first words of its
+// prompt, adding a numeric suffix if the name is taken
+func newConversationID(prompt string, existing []string) string {
+	words := routeWords(prompt)
+	if len(words) > routeSlugWords {
+		words = words[:routeSlugWords]
+	}
+	base := strings.Join(words, "-")
+	if base == "" {
+		base = "chat"
+	}
+
+	taken := make(map[string]bool, len(existing))
+	for _, id := range existing {
+		taken[id] = true
+	}
+	id := base
+	for n := 2; taken[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	return id
+}
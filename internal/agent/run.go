@@ -0,0 +1,315 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultRunIterations is used when agent.max_run_iterations is unset
+const defaultRunIterations = 50
+
+// maxStepSummary bounds the tool output kept per journal step
+const maxStepSummary = 200
+
+// errRunPaused stops the loop of a run that reached a pause point
+var errRunPaused = errors.New("run paused")
+
+// RunOptions configures an autonomous run
+type RunOptions struct {
+	Pause   storage.PausePolicy // When to stop for user review
+	OnChunk func(string)        // Receives streamed output, if set
+
+	Evaluate bool // Have a critic evaluate the result (also enabled by agent.evaluate_runs)
+}
+
+// StartRun begins an autonomous run of a task in the current conversation.
+// Its progress journal is saved every iteration so ResumeRun can continue
+// it after an interruption or a pause.
+func (a *Agent) StartRun(ctx context.Context, prompt string, opts RunOptions) (*storage.Run, error) {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("loading conversation: %w", err)
+	}
+	if prompt, err = a.screenInput(ctx, prompt); err != nil {
+		return nil, err
+	}
+
+	fullMessages, err := a.buildTurnMessages(conv, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &storage.Run{
+		ID:             "run-" + time.Now().Format("20060102-150405"),
+		ConversationID: a.conversationID,
+		Prompt:         prompt,
+		Turn:           countUserMessages(conv.Messages) + 1,
+		Status:         storage.RunRunning,
+		Pause:          opts.Pause,
+		Evaluate:       opts.Evaluate || a.config.Agent.EvaluateRuns,
+		Messages:       fullMessages[1:],
+	}
+	if err := a.store.SaveRun(run); err != nil {
+		return nil, fmt.Errorf("saving run: %w", err)
+	}
+	a.log.Info("run started", "id", run.ID, "conversation", run.ConversationID)
+
+	a.tee.prompt(prompt)
+	return a.continueRun(ctx, run, fullMessages, opts.OnChunk)
+}
+
+// ResumeRun continues an interrupted, failed or paused run from its journal.
+// Resuming a paused run approves the usage so far.
+func (a *Agent) ResumeRun(ctx context.Context, id string, onChunk func(string)) (*storage.Run, error) {
+	run, err := a.GetRun(id)
+	if err != nil {
+		return nil, err
+	}
+	if !run.Resumable() {
+		return run, fmt.Errorf("run %s is already %s", run.ID, run.Status)
+	}
+
+	if err := a.SetConversation(run.ConversationID); err != nil {
+		return nil, fmt.Errorf("setting conversation: %w", err)
+	}
+
+	// The system prompt is rebuilt so the date and skills are current
+	systemPrompt := a.skills.EnhancePrompt(run.Prompt, a.buildSystemPrompt(), a.personaConfig.Skills...)
+	fullMessages := append([]llm.Message{{Role: "system", Content: systemPrompt}}, run.Messages...)
+
+	if run.Status == storage.RunPaused {
+		run.Approved = storage.RunUsage{ToolCalls: run.ToolCalls, Cost: run.Cost}
+		run.PauseReason = ""
+	}
+	run.Status = storage.RunRunning
+	run.Error = ""
+	if err := a.store.SaveRun(run); err != nil {
+		return nil, fmt.Errorf("saving run: %w", err)
+	}
+	a.log.Info("run resumed", "id", run.ID, "iteration", run.Iteration)
+
+	return a.continueRun(ctx, run, fullMessages, onChunk)
+}
+
+// GetRun loads a run journal
+func (a *Agent) GetRun(id string) (*storage.Run, error) {
+	run, err := a.store.LoadRun(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("run not found: %s", id)
+	}
+	return run, err
+}
+
+// ListRuns returns all runs, most recently updated first
+func (a *Agent) ListRuns() ([]*storage.Run, error) {
+	return a.store.ListRuns()
+}
+
+// continueRun drives the agentic loop of a run, journaling every iteration
+func (a *Agent) continueRun(ctx context.Context, run *storage.Run, fullMessages []llm.Message, onChunk func(string)) (*storage.Run, error) {
+	ctx = tools.WithConversation(ctx, run.ConversationID, run.Turn)
+	ctx, span := a.tracer.Start(ctx, "igent.run", trace.WithAttributes(
+		attribute.String("igent.run.id", run.ID),
+		attrConversation.String(run.ConversationID),
+		attrTurn.Int(run.Turn),
+	))
+	defer endRunSpan(span, run)
+
+	var checkpoints []string
+	pricing := a.pricing(a.model)
+
+	hooks := loopHooks{
+		onResponse: func(resp *llm.Response) error {
+			run.Iteration++
+			run.Cost += pricing.Cost(resp.PromptTokens, resp.OutputTokens)
+			if !resp.HasToolCalls() {
+				return nil
+			}
+
+			run.ToolCalls += len(resp.ToolCalls)
+			checkpoints = checkpointLabels(resp.ToolCalls)
+			run.NextAction = describeNextAction(resp)
+			return a.store.SaveRun(run)
+		},
+		afterTools: func(messages []llm.Message, results []llm.Message) error {
+			for _, r := range results {
+				run.Steps = append(run.Steps, storage.RunStep{
+					Iteration: run.Iteration,
+					Tool:      r.Name,
+					Summary:   stepSummary(r.Content),
+					Error:     strings.HasPrefix(r.Content, "Error"),
+					At:        time.Now(),
+				})
+			}
+			run.Messages = messages[1:]
+			run.Artifacts = a.runArtifacts(run)
+			run.NextAction = "Review the tool results and decide the next step"
+
+			if reason := pauseReason(run, checkpoints); reason != "" {
+				run.Status = storage.RunPaused
+				run.PauseReason = reason
+				if err := a.store.SaveRun(run); err != nil {
+					return err
+				}
+				a.log.Info("run paused", "id", run.ID, "reason", reason)
+				return errRunPaused
+			}
+			return a.store.SaveRun(run)
+		},
+	}
+
+	maxIterations := a.config.Agent.MaxRunIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultRunIterations
+	}
+
+	result, loop, err := a.runLoop(ctx, fullMessages, run.Turn, maxIterations, onChunk, hooks)
+	if errors.Is(err, errRunPaused) {
+		return run, nil
+	}
+	if err != nil {
+		run.Error = err.Error()
+		run.Status = storage.RunFailed
+		if errors.Is(err, context.Canceled) || errors.Is(err, ErrToolDenied) || errors.Is(err, errMaxIterations) || errors.Is(err, ErrBudgetExceeded) {
+			run.Status = storage.RunInterrupted
+		}
+		if saveErr := a.store.SaveRun(run); saveErr != nil {
+			a.log.Error("failed to save run", "id", run.ID, "error", saveErr)
+		}
+		a.log.Warn("run stopped", "id", run.ID, "status", run.Status, "error", err)
+		return run, err
+	}
+
+	conv, err := a.store.LoadConversation(run.ConversationID)
+	if err != nil {
+		return run, fmt.Errorf("loading conversation: %w", err)
+	}
+	if err := a.finishTurn(conv, run.Prompt, result.Content, run.Turn, loop); err != nil {
+		return run, err
+	}
+
+	run.Status = storage.RunCompleted
+	run.Result = result.Content
+	run.NextAction = ""
+	run.Artifacts = a.runArtifacts(run)
+	if err := a.store.SaveRun(run); err != nil {
+		return run, fmt.Errorf("saving run: %w", err)
+	}
+	a.log.Info("run completed", "id", run.ID, "iterations", run.Iteration, "steps", len(run.Steps))
+
+	if run.Evaluate || a.config.Agent.EvaluateRuns {
+		if err := a.evaluate(ctx, run); err != nil {
+			return run, err
+		}
+	}
+	return run, nil
+}
+
+// pauseReason returns why a run should pause after its latest tool calls,
+// or an empty string to keep going
+func pauseReason(run *storage.Run, checkpoints []string) string {
+	policy := run.Pause
+	for _, label := range checkpoints {
+		for _, l := range policy.Labels {
+			if l == "*" || strings.EqualFold(l, label) {
+				return fmt.Sprintf("reached checkpoint %q", label)
+			}
+		}
+	}
+
+	if n := run.ToolCalls - run.Approved.ToolCalls; policy.EveryToolCalls > 0 && n >= policy.EveryToolCalls {
+		return fmt.Sprintf("%d tool calls since the last review", n)
+	}
+	if spent := run.Cost - run.Approved.Cost; policy.EveryCost > 0 && spent >= policy.EveryCost {
+		return fmt.Sprintf("spent $%.2f since the last review", spent)
+	}
+	return ""
+}
+
+// checkpointLabels returns the labels of checkpoint tool calls
+func checkpointLabels(calls []llm.ToolCall) []string {
+	var labels []string
+	for _, tc := range calls {
+		if tc.Function == nil || tc.Function.Name != "checkpoint" {
+			continue
+		}
+		call, err := tools.ParseToolCall(tc.ID, tc.Function.Name, tc.Function.Arguments)
+		if err != nil {
+			continue
+		}
+		if label := tools.CheckpointLabel(call.Args); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// pricing returns the per-1M token prices of a model: the configured prices
+// for the configured model, else the provider preset's for its default model
+func (a *Agent) pricing(model string) llm.Preset {
+	p := a.config.Provider
+	if model == p.Model && (p.InputPrice > 0 || p.OutputPrice > 0) {
+		return llm.Preset{InputPrice: p.InputPrice, OutputPrice: p.OutputPrice}
+	}
+	if preset, ok := llm.LookupPreset(p.Type); ok && preset.DefaultModel == model {
+		return preset
+	}
+	return llm.Preset{}
+}
+
+// runArtifacts lists the short hashes of artifacts produced during a run
+func (a *Agent) runArtifacts(run *storage.Run) []string {
+	artifacts, err := a.store.ListArtifacts()
+	if err != nil {
+		a.log.Warn("failed to list artifacts", "error", err)
+		return run.Artifacts
+	}
+
+	var hashes []string
+	for _, art := range artifacts {
+		if art.ConversationID == run.ConversationID && art.Turn == run.Turn {
+			hashes = append(hashes, art.ShortHash())
+		}
+	}
+	return hashes
+}
+
+// describeNextAction summarizes what a response is about to do
+func describeNextAction(resp *llm.Response) string {
+	var names []string
+	for _, tc := range resp.ToolCalls {
+		if tc.Function != nil {
+			names = append(names, tc.Function.Name)
+		}
+	}
+
+	action := "Run tools: " + strings.Join(names, ", ")
+	if plan := stepSummary(resp.Content); plan != "" {
+		action = plan + " (" + action + ")"
+	}
+	return action
+}
+
+// stepSummary returns the first non-empty line of text, shortened
+func stepSummary(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if len(line) > maxStepSummary {
+			line = line[:maxStepSummary] + "..."
+		}
+		return line
+	}
+	return ""
+}
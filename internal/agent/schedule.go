@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/igm/igent/internal/cron"
+	"github.com/igm/igent/internal/sched"
+	"github.com/igm/igent/internal/storage"
+)
+
+// AddSchedule schedules a prompt to run on a cron expression in the given
+// conversation ("" = a conversation of its own, schedule-<id>)
+func (a *Agent) AddSchedule(spec, prompt, conversationID string) (*storage.Schedule, error) {
+	cs, err := cron.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	next := cs.Next(time.Now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", spec)
+	}
+
+	id, err := scheduleID()
+	if err != nil {
+		return nil, err
+	}
+	if conversationID == "" {
+		conversationID = "schedule-" + id
+	}
+	s := &storage.Schedule{
+		ID:             id,
+		Cron:           spec,
+		Prompt:         prompt,
+		ConversationID: conversationID,
+		NextRun:        next,
+	}
+	if err := a.store.SaveSchedule(s); err != nil {
+		return nil, fmt.Errorf("saving schedule: %w", err)
+	}
+	a.log.Info("schedule added", "id", id, "cron", spec, "next_run", next)
+	return s, nil
+}
+
+// GetSchedule loads a scheduled task
+func (a *Agent) GetSchedule(id string) (*storage.Schedule, error) {
+	s, err := a.store.LoadSchedule(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("schedule not found: %s", id)
+	}
+	return s, err
+}
+
+// ListSchedules returns all scheduled tasks, soonest first
+func (a *Agent) ListSchedules() ([]*storage.Schedule, error) {
+	return a.store.ListSchedules()
+}
+
+// RemoveSchedule deletes a scheduled task. Its conversation is kept.
+func (a *Agent) RemoveSchedule(id string) error {
+	if err := a.store.DeleteSchedule(id); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("schedule not found: %s", id)
+		}
+		return err
+	}
+	a.log.Info("schedule removed", "id", id)
+	return nil
+}
+
+// RunDueSchedules runs every task due at now, one after another, and
+// returns them with their results. A task that missed several runs (the
+// machine was off) runs once. onRun, if set, is called as each one finishes.
+func (a *Agent) RunDueSchedules(ctx context.Context, now time.Time, onRun func(*storage.Schedule)) ([]*storage.Schedule, error) {
+	schedules, err := a.store.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []*storage.Schedule
+	for _, s := range schedules {
+		if s.NextRun.IsZero() {
+			continue // Never fires
+		}
+		if s.NextRun.After(now) {
+			break // Sorted by next run
+		}
+		if err := ctx.Err(); err != nil {
+			return ran, err
+		}
+		s, err := a.runSchedule(ctx, s, now)
+		if err != nil {
+			return ran, err
+		}
+		ran = append(ran, s)
+		if onRun != nil {
+			onRun(s)
+		}
+	}
+	return ran, nil
+}
+
+// RunSchedule runs a scheduled task now, without changing when it next runs
+func (a *Agent) RunSchedule(ctx context.Context, id string) (*storage.Schedule, error) {
+	s, err := a.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	return a.runSchedule(ctx, s, time.Time{})
+}
+
+// runSchedule sends a task's prompt to its conversation at scheduled
+// priority and records the result. A due task is moved to its next run
+// before it starts, so an overlapping tick doesn't run it twice.
+func (a *Agent) runSchedule(ctx context.Context, s *storage.Schedule, due time.Time) (*storage.Schedule, error) {
+	if !due.IsZero() {
+		cs, err := cron.Parse(s.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", s.ID, err)
+		}
+		s.NextRun = cs.Next(due)
+		if err := a.store.SaveSchedule(s); err != nil {
+			return nil, fmt.Errorf("saving schedule: %w", err)
+		}
+	}
+
+	prevConv, prevPriority := a.conversationID, a.priority
+	defer func() {
+		a.conversationID, a.priority = prevConv, prevPriority
+	}()
+	a.priority = sched.Scheduled
+	if err := a.SetConversation(s.ConversationID); err != nil {
+		return nil, fmt.Errorf("setting conversation: %w", err)
+	}
+
+	a.log.Info("running schedule", "id", s.ID, "conversation", s.ConversationID)
+	start := time.Now()
+	answer, err := a.Chat(ctx, s.Prompt)
+	result := storage.ScheduleResult{At: start, Duration: time.Since(start)}
+	if err != nil {
+		result.Error = err.Error()
+		a.log.Warn("scheduled run failed", "id", s.ID, "error", err)
+	} else {
+		result.Response = answer.Content
+	}
+
+	// Reload so a concurrent edit of the next run isn't lost
+	latest, err := a.store.LoadSchedule(s.ID)
+	switch {
+	case err == nil:
+		s = latest
+	case errors.Is(err, storage.ErrNotFound):
+		s.AddResult(result)
+		return s, nil // Removed while running
+	}
+	s.AddResult(result)
+	if err := a.store.SaveSchedule(s); err != nil {
+		return nil, fmt.Errorf("saving schedule: %w", err)
+	}
+	return s, nil
+}
+
+// scheduleID returns a short random ID
+func scheduleID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating schedule ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/igm/igent/internal/config"
+)
+
+// ResponseStyle holds the response constraints applied to each turn
+type ResponseStyle struct {
+	MaxTokens    int  // Max response tokens sent to the provider (0 = provider default)
+	BulletPoints bool // Prefer bullet points over prose
+	CodeOnly     bool // Reply with code only, no explanations
+}
+
+// promptSection renders the style as system prompt instructions
+func (s ResponseStyle) promptSection() string {
+	var rules []string
+	if s.BulletPoints {
+		rules = append(rules, "- Format answers as concise bullet points rather than paragraphs.")
+	}
+	if s.CodeOnly {
+		rules = append(rules, "- Respond with code only. Do not add explanations outside of code comments.")
+	}
+	if s.MaxTokens > 0 {
+		rules = append(rules, fmt.Sprintf("- Keep responses under roughly %d tokens.", s.MaxTokens))
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "\n\n## Response Style\n\n" + strings.Join(rules, "\n")
+}
+
+// String returns a human-readable summary of the style
+func (s ResponseStyle) String() string {
+	maxTokens := "unlimited"
+	if s.MaxTokens > 0 {
+		maxTokens = strconv.Itoa(s.MaxTokens)
+	}
+	return fmt.Sprintf("bullets: %s, code-only: %s, max tokens: %s",
+		onOff(s.BulletPoints), onOff(s.CodeOnly), maxTokens)
+}
+
+// Style returns the current response style
+func (a *Agent) Style() ResponseStyle {
+	return a.style
+}
+
+// SetStyle replaces the response style for subsequent turns
+func (a *Agent) SetStyle(style ResponseStyle) {
+	a.style = style
+	a.log.Debug("response style updated", "style", style.String())
+}
+
+// handleStyleCommand processes /style [bullets|code on|off, max <n>, reset]
+func (a *Agent) handleStyleCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Printf("Style: %s\n", a.style)
+		return
+	}
+
+	style := a.style
+	switch args[0] {
+	case "bullets", "code":
+		if len(args) < 2 {
+			fmt.Printf("Usage: /style %s on|off\n", args[0])
+			return
+		}
+		on, ok := parseOnOff(args[1])
+		if !ok {
+			fmt.Printf("Usage: /style %s on|off\n", args[0])
+			return
+		}
+		if args[0] == "bullets" {
+			style.BulletPoints = on
+		} else {
+			style.CodeOnly = on
+		}
+
+	case "max":
+		if len(args) < 2 {
+			fmt.Println("Usage: /style max <tokens> (0 for unlimited)")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			fmt.Println("Usage: /style max <tokens> (0 for unlimited)")
+			return
+		}
+		style.MaxTokens = n
+
+	case "reset":
+		style = styleFromConfig(a.config.Agent)
+
+	default:
+		fmt.Println("Usage: /style [bullets on|off | code on|off | max <tokens> | reset]")
+		return
+	}
+
+	a.SetStyle(style)
+	fmt.Printf("Style: %s\n", a.style)
+}
+
+// styleFromConfig builds the initial style from agent config
+func styleFromConfig(cfg config.AgentConfig) ResponseStyle {
+	return ResponseStyle{
+		MaxTokens:    cfg.MaxResponseTokens,
+		BulletPoints: cfg.BulletPoints,
+		CodeOnly:     cfg.CodeOnly,
+	}
+}
+
+// parseOnOff parses on/off style toggles
+func parseOnOff(s string) (bool, bool) {
+	switch strings.ToLower(s) {
+	case "on", "true", "yes", "1":
+		return true, true
+	case "off", "false", "no", "0":
+		return false, true
+	}
+	return false, false
+}
+
+// onOff formats a boolean toggle
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
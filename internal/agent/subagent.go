@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// subAgent is a lightweight helper agent with its own persona and model.
+// It has no tools, memory or conversation; callers pass all context in the
+// prompt. Its calls are metered as the parent agent's, charged to the
+// parent's conversation.
+type subAgent struct {
+	name     string
+	persona  string // System prompt
+	model    string
+	provider llm.Provider
+}
+
+// newSubAgent creates a sub-agent. An empty model shares the agent's provider.
+func (a *Agent) newSubAgent(name, persona, model string) (*subAgent, error) {
+	provider := a.provider
+	if model == "" {
+		model = a.model
+	} else if model != a.model {
+		cfg := providerConfig(a.config, a.netPolicy)
+		cfg.Model = model
+		p, err := llm.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating provider for %s: %w", model, err)
+		}
+		provider = p
+	}
+
+	return &subAgent{
+		name:     name,
+		persona:  persona,
+		model:    model,
+		provider: a.metered(provider, model, a.conversationID, a.priority),
+	}, nil
+}
+
+// ask sends a single prompt to the sub-agent and returns its answer
+func (s *subAgent) ask(ctx context.Context, prompt string) (string, error) {
+	resp, err := s.provider.Complete(ctx, []llm.Message{
+		{Role: "system", Content: s.persona},
+		{Role: "user", Content: prompt},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", s.name, err)
+	}
+	return resp.Content, nil
+}
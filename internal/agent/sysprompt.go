@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetSystemPrompt sets the system prompt of the current conversation, which
+// replaces agent.system_prompt in it; an empty prompt goes back to the
+// config's. Prompt files, memory instructions and the response style are
+// still added.
+func (a *Agent) SetSystemPrompt(prompt string) error {
+	conv, err := a.store.LoadConversation(a.conversationID)
+	if err != nil {
+		return fmt.Errorf("loading conversation: %w", err)
+	}
+	conv.SystemPrompt = strings.TrimSpace(prompt)
+	if err := a.saveConversation(conv); err != nil {
+		return fmt.Errorf("saving conversation: %w", err)
+	}
+	a.conversationPrompt = conv.SystemPrompt
+	a.log.Info("conversation system prompt set", "conversation", a.conversationID, "length", len(conv.SystemPrompt))
+	return nil
+}
+
+// SystemPrompt returns the system prompt of the current conversation and
+// whether it is the conversation's own rather than the persona's or
+// agent.system_prompt
+func (a *Agent) SystemPrompt() (string, bool) {
+	if a.conversationPrompt != "" {
+		return a.conversationPrompt, true
+	}
+	if a.personaConfig.SystemPrompt != "" {
+		return a.personaConfig.SystemPrompt, false
+	}
+	return a.config.Agent.SystemPrompt, false
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// teeToolOutputLimit caps how much of each tool result is copied to the tee
+const teeToolOutputLimit = 2000
+
+// teeWriter copies the streamed response, and optionally tool activity, to
+// a writer as it arrives. Writes are serialized because tool calls run in
+// parallel; write errors are logged once and otherwise ignored so a full
+// disk never breaks the conversation.
+type teeWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	tools  bool
+	failed bool
+	log    *slog.Logger
+}
+
+// SetTee copies streamed responses to w as they arrive, so long generations
+// survive terminal crashes and can be tailed elsewhere. With tools set, tool
+// calls and their results are written too. A nil w disables the tee.
+func (a *Agent) SetTee(w io.Writer, tools bool) {
+	if w == nil {
+		a.tee = nil
+		return
+	}
+	a.tee = &teeWriter{w: w, tools: tools, log: a.log}
+}
+
+// write copies s to the tee; it is a no-op on a nil tee
+func (t *teeWriter) write(s string) {
+	if t == nil || s == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := io.WriteString(t.w, s); err != nil && !t.failed {
+		t.failed = true
+		t.log.Warn("writing tee output failed", "error", err)
+	}
+}
+
+// prompt marks the start of a turn
+func (t *teeWriter) prompt(input string) {
+	t.write(fmt.Sprintf("\n--- %s ---\n> %s\n\n", time.Now().Format(time.RFC3339), input))
+}
+
+// toolCall records a tool call when tool activity is enabled
+func (t *teeWriter) toolCall(name string, args map[string]interface{}) {
+	if t == nil || !t.tools {
+		return
+	}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", k, args[k])
+	}
+	t.write(fmt.Sprintf("\n[tool %s] %s\n", name, strings.Join(parts, " ")))
+}
+
+// toolResult records a tool result when tool activity is enabled
+func (t *teeWriter) toolResult(name, content string) {
+	if t == nil || !t.tools {
+		return
+	}
+	if len(content) > teeToolOutputLimit {
+		content = content[:teeToolOutputLimit] + "\n... (truncated)"
+	}
+	t.write(fmt.Sprintf("[result %s]\n%s\n\n", name, strings.TrimRight(content, "\n")))
+}
+
+// wrap returns onChunk extended to copy each chunk to the tee
+func (t *teeWriter) wrap(onChunk func(string)) func(string) {
+	if t == nil || onChunk == nil {
+		return onChunk
+	}
+	return func(chunk string) {
+		t.write(chunk)
+		onChunk(chunk)
+	}
+}
@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/render"
+)
+
+// theme styles the REPL's own output, tool calls and the tool confirmation
+// prompt; UseTheme sets it from the ui config
+var theme = render.DarkTheme
+
+// UseTheme sets the theme of the REPL and console prompts from the ui
+// config. With colors off (ui.color, NO_COLOR, or output that is not a
+// terminal) the theme is plain. It may ask the terminal for its background
+// and sets a package-wide theme, so the CLI calls it once before a command
+// runs, while nothing reads the theme yet; New leaves it alone.
+func UseTheme(ui config.UIConfig) error {
+	color, err := render.UseColor(ui.Color, os.Stdout, os.Stderr)
+	if err != nil {
+		return fmt.Errorf("ui.color: %w", err)
+	}
+	name := ui.Theme
+	if !color && (name == "" || strings.EqualFold(name, "auto")) {
+		name = "dark" // Plain either way; don't ask the terminal
+	}
+	t, err := render.NewTheme(name, ui.Colors)
+	if err != nil {
+		return fmt.Errorf("ui: %w", err)
+	}
+	if !color {
+		t = t.Plain()
+	}
+	theme = t
+	return nil
+}
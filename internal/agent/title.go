@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/sched"
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	// titlePrompt asks for the title of a new conversation
+	titlePrompt = "Write a short title, at most 5 words, for a conversation that starts with the following exchange. " +
+		"Reply with the title only, in the language of the conversation."
+
+	// maxTitleLength caps conversation titles, in bytes
+	maxTitleLength = 80
+
+	// titleTimeout bounds the title request
+	titleTimeout = 15 * time.Second
+)
+
+// titler generates conversation titles in the background. Saving a title
+// and saving a turn hold mu, so neither overwrites the other.
+type titler struct {
+	mu      sync.Mutex
+	pending map[string]string // Titles generated, by conversation
+	wg      sync.WaitGroup
+}
+
+// saveConversation saves conv with the title generated for it, if any
+func (a *Agent) saveConversation(conv *storage.Conversation) error {
+	a.titles.mu.Lock()
+	defer a.titles.mu.Unlock()
+	if conv.Title == "" {
+		conv.Title = a.titles.pending[conv.ID]
+	}
+	return a.store.SaveConversation(conv)
+}
+
+// titleConversation titles a conversation after its first exchange when
+// agent.auto_title is on. The title is generated in the background, so the
+// answer is not held up; WaitTitles waits for it. If the request fails, the
+// start of the first message is used instead.
+func (a *Agent) titleConversation(conv *storage.Conversation, userInput, response string) {
+	if conv.Title != "" || !a.config.Agent.AutoTitle || countUserMessages(conv.Messages) != 1 {
+		return
+	}
+
+	id, provider := conv.ID, a.metered(a.provider, a.model, conv.ID, sched.Batch)
+	a.titles.wg.Add(1)
+	go func() {
+		defer a.titles.wg.Done()
+		title := a.generateTitle(provider, userInput, response)
+
+		a.titles.mu.Lock()
+		defer a.titles.mu.Unlock()
+		if a.titles.pending == nil {
+			a.titles.pending = make(map[string]string)
+		}
+		a.titles.pending[id] = title
+		conv, err := a.store.LoadConversation(id)
+		if err != nil {
+			a.log.Warn("saving conversation title failed", "id", id, "error", err)
+			return
+		}
+		if conv.Title != "" {
+			return
+		}
+		conv.Title = title
+		if err := a.store.SaveConversation(conv); err != nil {
+			a.log.Warn("saving conversation title failed", "id", id, "error", err)
+			return
+		}
+		a.log.Debug("conversation titled", "id", id, "title", title)
+	}()
+}
+
+// generateTitle asks the LLM for the title of a conversation starting with
+// the exchange
+func (a *Agent) generateTitle(provider llm.Provider, userInput, response string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), titleTimeout)
+	defer cancel()
+	resp, err := provider.Complete(ctx, []llm.Message{
+		{Role: "system", Content: titlePrompt},
+		{Role: "user", Content: fmt.Sprintf("user: %s\n\nassistant: %s", userInput, truncateRunes(response, 2000))},
+	})
+	title := ""
+	if err == nil {
+		title = cleanTitle(resp.Content)
+	} else {
+		a.log.Warn("generating conversation title failed", "error", err)
+	}
+	if title == "" {
+		title = cleanTitle(userInput)
+	}
+	return title
+}
+
+// WaitTitles waits for the conversation titles being generated, so they are
+// saved before the program exits
+func (a *Agent) WaitTitles() {
+	a.titles.wg.Wait()
+	for _, p := range a.profiles {
+		p.WaitTitles()
+	}
+}
+
+// cleanTitle reduces a reply to a one-line title: the first non-empty line
+// without a "Title:" label, markdown or quotes, cut at a word boundary
+func cleanTitle(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if label, rest, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(label), "title") {
+			line = rest
+		}
+		line = strings.Trim(strings.TrimSpace(line), "#*_`\"'“”")
+		line = strings.TrimSpace(line)
+		if len(line) <= maxTitleLength {
+			return line
+		}
+		cut := truncateRunes(line, maxTitleLength)
+		if i := strings.LastIndex(cut, " "); i > maxTitleLength/2 {
+			cut = cut[:i]
+		}
+		return strings.TrimSpace(cut) + "…"
+	}
+	return ""
+}
+
+// truncateRunes cuts s to at most n bytes without splitting a rune
+func truncateRunes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ConversationInfos returns the metadata of all conversations, most
+// recently updated first, optionally only those with all of tags
+func (a *Agent) ConversationInfos(tags ...string) ([]*storage.ConversationInfo, error) {
+	infos, _, err := a.store.QueryConversations(storage.ConversationQuery{Tags: tags})
+	return infos, err
+}
+
+// QueryConversations returns a sorted page of conversation metadata and
+// the number of matching conversations
+func (a *Agent) QueryConversations(q storage.ConversationQuery) ([]*storage.ConversationInfo, int, error) {
+	return a.store.QueryConversations(q)
+}
+
+// SetTitle sets the title of a conversation
+func (a *Agent) SetTitle(id, title string) error {
+	conv, err := a.store.LoadConversation(id)
+	if err != nil {
+		return err
+	}
+	conv.Title = cleanTitle(title)
+	return a.store.SaveConversation(conv)
+}
+
+// TagConversation adds and removes tags of a conversation and returns its
+// tags
+func (a *Agent) TagConversation(id string, add, remove []string) ([]string, error) {
+	conv, err := a.store.LoadConversation(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return conv.Tags, nil
+	}
+	removed := storage.NormalizeTags(remove)
+	var tags []string
+	for _, tag := range conv.Tags {
+		if !slices.Contains(removed, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	conv.Tags = storage.NormalizeTags(append(tags, add...))
+	if err := a.store.SaveConversation(conv); err != nil {
+		return nil, err
+	}
+	return conv.Tags, nil
+}
+
+// FormatConversationInfo renders a conversation for listings
+func FormatConversationInfo(info *storage.ConversationInfo) string {
+	title := info.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	line := fmt.Sprintf("%-24s %-40s %4d msgs  %s", info.ID, title, info.Messages, info.UpdatedAt.Format("2006-01-02 15:04"))
+	if len(info.Tags) > 0 {
+		line += "  [" + strings.Join(info.Tags, ", ") + "]"
+	}
+	return line
+}
@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/igm/igent/internal/tools"
+)
+
+// sortedTools returns the registered tools sorted by name
+func (a *Agent) sortedTools() []*tools.Tool {
+	list := a.tools.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// matchTools returns the names of the tools a name or pattern such as
+// git_* matches
+func (a *Agent) matchTools(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+	}
+	var names []string
+	for _, t := range a.sortedTools() {
+		if matched, _ := path.Match(pattern, t.Name); matched {
+			names = append(names, t.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no tool matches %q; /tools lists them", pattern)
+	}
+	return names, nil
+}
+
+// DisableTool stops offering the tools a name or pattern matches to the
+// model and denies calls of them for the rest of the session, even if
+// tools.confirm allows them. It returns the tools disabled.
+func (a *Agent) DisableTool(pattern string) ([]string, error) {
+	names, err := a.matchTools(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		a.policy.disableForSession(name)
+	}
+	a.log.Info("tools disabled for the session", "tools", names)
+	return names, nil
+}
+
+// EnableTool undoes DisableTool for the tools a name or pattern matches;
+// it returns the tools enabled again
+func (a *Agent) EnableTool(pattern string) ([]string, error) {
+	names, err := a.matchTools(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var enabled []string
+	for _, name := range names {
+		if a.policy.enableForSession(name) {
+			enabled = append(enabled, name)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil, fmt.Errorf("%s is not disabled", pattern)
+	}
+	a.log.Info("tools enabled again", "tools", enabled)
+	return enabled, nil
+}
+
+// toolStatus describes what the tool policy does with calls of a tool
+func (a *Agent) toolStatus(name string) string {
+	if a.policy.disabled(name) {
+		return "disabled for this session"
+	}
+	switch a.policy.decide(name, a.tools.IsSafeTool(name)) {
+	case toolDeny:
+		return "denied by tools.confirm"
+	case toolAllow:
+		return "runs without asking"
+	}
+	return "asks first"
+}
+
+// safety is the registry's classification of a tool: safe tools only
+// read, and run without confirmation unless tools.confirm says otherwise
+func (a *Agent) safety(name string) string {
+	if a.tools.IsSafeTool(name) {
+		return "safe"
+	}
+	return "unsafe"
+}
+
+// FormatToolParameters lists the parameters of a JSON schema, one per
+// line: name, type, whether it is required, and its description and
+// allowed values
+func FormatToolParameters(schema map[string]interface{}) string {
+	props, _ := schema["properties"].(map[string]interface{})
+	if len(props) == 0 {
+		return "  (no parameters)\n"
+	}
+	required := map[string]bool{}
+	switch r := schema["required"].(type) {
+	case []string:
+		for _, name := range r {
+			required[name] = true
+		}
+	case []interface{}:
+		for _, name := range r {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		prop, _ := props[name].(map[string]interface{})
+		kind, _ := prop["type"].(string)
+		if items, ok := prop["items"].(map[string]interface{}); ok && kind == "array" {
+			if itemKind, ok := items["type"].(string); ok {
+				kind = itemKind + "[]"
+			}
+		}
+		if kind == "" {
+			kind = "any"
+		}
+		fmt.Fprintf(&sb, "  %s (%s", name, kind)
+		if required[name] {
+			sb.WriteString(", required")
+		}
+		sb.WriteString(")")
+		if desc, ok := prop["description"].(string); ok && desc != "" {
+			sb.WriteString(": " + desc)
+		}
+		var values []string
+		switch enum := prop["enum"].(type) {
+		case []string:
+			values = enum
+		case []interface{}:
+			for _, v := range enum {
+				values = append(values, fmt.Sprint(v))
+			}
+		}
+		if len(values) > 0 {
+			fmt.Fprintf(&sb, " [%s]", strings.Join(values, ", "))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// handleToolsCommand processes /tools [<name> | disable <tool>... | enable <tool>...]
+func (a *Agent) handleToolsCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Tools (/tools <name> shows parameters; /tools disable <name> turns one off for the session):")
+		for _, t := range a.sortedTools() {
+			fmt.Printf("  %-18s %-6s  %-25s %s\n", t.Name, a.safety(t.Name), a.toolStatus(t.Name), truncateRunes(firstLine(t.Description), 60))
+		}
+		return
+	}
+
+	switch args[0] {
+	case "disable", "enable":
+		if len(args) < 2 {
+			fmt.Printf("Usage: /tools %s <name or pattern>...\n", args[0])
+			return
+		}
+		for _, pattern := range args[1:] {
+			var names []string
+			var err error
+			if args[0] == "disable" {
+				names, err = a.DisableTool(pattern)
+			} else {
+				names, err = a.EnableTool(pattern)
+			}
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			if args[0] == "disable" {
+				fmt.Printf("Disabled for this session: %s\n", strings.Join(names, ", "))
+			} else {
+				fmt.Printf("Enabled again: %s\n", strings.Join(names, ", "))
+			}
+		}
+		return
+	}
+
+	t, ok := a.tools.Get(args[0])
+	if !ok {
+		fmt.Printf("Unknown tool %s; /tools lists them\n", args[0])
+		return
+	}
+	fmt.Printf("%s (%s, %s)\n%s\n\nParameters:\n%s", t.Name, a.safety(t.Name), a.toolStatus(t.Name), t.Description, FormatToolParameters(t.Parameters))
+}
+
+// firstLine returns s up to its first line break
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
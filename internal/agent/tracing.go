@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"errors"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+	"github.com/igm/igent/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes of igent's own; provider calls and tools use the
+// OpenTelemetry gen_ai conventions
+const (
+	attrConversation = attribute.Key("igent.conversation")
+	attrTurn         = attribute.Key("igent.turn")
+)
+
+// startProviderSpan starts the span of a provider call to a model
+func (a *Agent) startProviderSpan(ctx context.Context, model string, opts *llm.CompleteOptions) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("gen_ai.operation.name", "chat"),
+		attribute.String("gen_ai.system", a.config.Provider.Type),
+		attribute.String("gen_ai.request.model", model),
+	}
+	if opts != nil {
+		attrs = append(attrs, attribute.Int("igent.tools_offered", len(opts.Tools)))
+		if opts.MaxTokens > 0 {
+			attrs = append(attrs, attribute.Int("gen_ai.request.max_tokens", opts.MaxTokens))
+		}
+		if opts.Temperature != nil {
+			attrs = append(attrs, attribute.Float64("gen_ai.request.temperature", *opts.Temperature))
+		}
+	}
+	return a.tracer.Start(ctx, "chat "+model,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endProviderSpan records the usage of a provider call and ends its span
+func endProviderSpan(span trace.Span, resp *llm.Response, err error) {
+	if resp != nil {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", resp.PromptTokens),
+			attribute.Int("gen_ai.usage.output_tokens", resp.OutputTokens),
+			attribute.Int("igent.cached_tokens", resp.CachedTokens),
+			attribute.Int("igent.tool_calls", len(resp.ToolCalls)),
+		)
+		if resp.FinishReason != "" {
+			span.SetAttributes(attribute.StringSlice("gen_ai.response.finish_reasons", []string{resp.FinishReason}))
+		}
+	}
+	tracing.End(span, err)
+}
+
+// startToolSpan starts the span of a tool execution
+func (a *Agent) startToolSpan(ctx context.Context, call *tools.ToolCall) (context.Context, trace.Span) {
+	return a.tracer.Start(ctx, "execute_tool "+call.Name, trace.WithAttributes(
+		attribute.String("gen_ai.operation.name", "execute_tool"),
+		attribute.String("gen_ai.tool.name", call.Name),
+		attribute.String("gen_ai.tool.call.id", call.ID),
+	))
+}
+
+// endToolSpan records the outcome of a tool execution and ends its span
+func endToolSpan(span trace.Span, result *tools.ToolResult) {
+	span.SetAttributes(attribute.Int("igent.tool.output_length", len(result.Output)))
+	var err error
+	if result.Error != "" {
+		err = errors.New(result.Error)
+	}
+	tracing.End(span, err)
+}
+
+// endRunSpan records how a run ended and ends its span
+func endRunSpan(span trace.Span, run *storage.Run) {
+	span.SetAttributes(
+		attribute.String("igent.run.status", string(run.Status)),
+		attribute.Int("igent.run.iterations", run.Iteration),
+		attribute.Int("igent.run.tool_calls", run.ToolCalls),
+	)
+	if run.Status == storage.RunFailed {
+		span.SetStatus(codes.Error, run.Error)
+	}
+	span.End()
+}
@@ -0,0 +1,426 @@
+// Package backup snapshots the work dir (conversations, memories, skills,
+// config and everything else igent stores there) into a gzipped tar
+// archive and restores it. Every archive ends with a manifest of the
+// SHA-256 of each file, which is checked before anything is restored.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	// ManifestName is the manifest entry of an archive
+	ManifestName = "igent-backup.json"
+
+	// Dir is the directory of the work dir holding backups; it is never
+	// backed up or replaced by a restore itself
+	Dir = "backups"
+
+	// formatVersion is the archive format written by Create
+	formatVersion = 1
+
+	// dailyPrefix names the backups made by Rotate
+	dailyPrefix = "daily-"
+)
+
+// Manifest lists the files of an archive
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []File    `json:"files"`
+}
+
+// File is a file of an archive, by path relative to the work dir
+type File struct {
+	Path   string `json:"path"` // Slash separated
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Size returns the total size of the files
+func (m *Manifest) Size() int64 {
+	var n int64
+	for _, f := range m.Files {
+		n += f.Size
+	}
+	return n
+}
+
+// skipped reports whether a path of the work dir is left out of backups:
+// the backups, the lock file and files being written
+func skipped(rel string) bool {
+	return rel == Dir || strings.HasPrefix(rel, Dir+"/") || rel == storage.LockFileName || strings.HasSuffix(rel, ".tmp")
+}
+
+// Create writes a backup of workDir to w. It holds a shared lock on the
+// work dir, so no igent process writes to it meanwhile.
+func Create(workDir string, w io.Writer) (*Manifest, error) {
+	unlock, err := storage.LockDirectory(workDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("locking work dir: %w", err)
+	}
+	defer unlock()
+	return create(workDir, w)
+}
+
+// CreateFile writes a backup of workDir to path, replacing it only once the
+// backup is complete
+func CreateFile(workDir, path string) (*Manifest, error) {
+	unlock, err := storage.LockDirectory(workDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("locking work dir: %w", err)
+	}
+	defer unlock()
+	return createFile(workDir, path)
+}
+
+// createFile is CreateFile for callers holding the lock
+func createFile(workDir, path string) (*Manifest, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("creating backup directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := create(workDir, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// create writes the archive; the caller holds the lock
+func create(workDir string, w io.Writer) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: formatVersion, CreatedAt: time.Now()}
+
+	err := filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if skipped(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		file, err := addFile(tw, path, rel)
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", rel, err)
+		}
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling manifest: %w", err)
+	}
+	hdr := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// addFile writes one file to the archive and returns its manifest entry
+func addFile(tw *tar.Writer, path, rel string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return File{}, err
+	}
+
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return File{}, err
+	}
+	hdr.Name = rel
+	if err := tw.WriteHeader(hdr); err != nil {
+		return File{}, err
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, info.Size()); err != nil {
+		return File{}, err
+	}
+	return File{Path: rel, Size: info.Size(), SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// entryPath validates the name of an archive entry and returns it as a
+// path relative to the work dir
+func entryPath(name string) (string, error) {
+	rel := filepath.FromSlash(name)
+	if !filepath.IsLocal(rel) || skipped(filepath.ToSlash(filepath.Clean(rel))) {
+		return "", fmt.Errorf("invalid path in backup: %q", name)
+	}
+	return rel, nil
+}
+
+// Verify reads an archive and checks every file against the manifest. It
+// fails on files that are missing, modified or not listed.
+func Verify(r io.Reader) (*Manifest, error) {
+	var manifest *Manifest
+	hashes := make(map[string]string)
+	err := walk(r, func(hdr *tar.Header, content io.Reader) error {
+		if hdr.Name == ManifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(content).Decode(manifest); err != nil {
+				return fmt.Errorf("reading manifest: %w", err)
+			}
+			return nil
+		}
+		if _, err := entryPath(hdr.Name); err != nil {
+			return err
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, content); err != nil {
+			return err
+		}
+		hashes[hdr.Name] = hex.EncodeToString(h.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, errors.New("not an igent backup: no manifest")
+	}
+	if manifest.Version > formatVersion {
+		return nil, fmt.Errorf("backup format %d is newer than this igent supports", manifest.Version)
+	}
+
+	for _, f := range manifest.Files {
+		sum, ok := hashes[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("backup is missing %s", f.Path)
+		}
+		if sum != f.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", f.Path)
+		}
+		delete(hashes, f.Path)
+	}
+	for path := range hashes {
+		return nil, fmt.Errorf("backup contains %s, which is not in its manifest", path)
+	}
+	return manifest, nil
+}
+
+// VerifyFile verifies the archive at path
+func VerifyFile(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Verify(f)
+}
+
+// walk calls fn for each regular file of a gzipped tar archive
+func walk(r io.Reader, fn func(hdr *tar.Header, content io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("reading backup: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading backup: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// Restore replaces the contents of workDir with the archive at path, after
+// verifying it. The current contents are backed up to the backups directory
+// first; previous is the path of that backup. The backups directory itself
+// is kept. It holds an exclusive lock on the work dir, so it waits for
+// running igent processes to finish writing.
+func Restore(workDir, path string) (manifest *Manifest, previous string, err error) {
+	if manifest, err = VerifyFile(path); err != nil {
+		return nil, "", err
+	}
+
+	unlock, err := storage.LockDirectory(workDir, true)
+	if err != nil {
+		return nil, "", fmt.Errorf("locking work dir: %w", err)
+	}
+	defer unlock()
+
+	previous = filepath.Join(workDir, Dir, "pre-restore-"+time.Now().Format("20060102-150405")+".tar.gz")
+	if _, err := createFile(workDir, previous); err != nil {
+		return nil, "", fmt.Errorf("backing up the current work dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return nil, previous, err
+	}
+	for _, e := range entries {
+		if e.Name() == Dir || e.Name() == storage.LockFileName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(workDir, e.Name())); err != nil {
+			return nil, previous, fmt.Errorf("clearing work dir: %w", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, previous, err
+	}
+	defer f.Close()
+	err = walk(f, func(hdr *tar.Header, content io.Reader) error {
+		if hdr.Name == ManifestName {
+			return nil
+		}
+		rel, err := entryPath(hdr.Name)
+		if err != nil {
+			return err
+		}
+		return extract(filepath.Join(workDir, rel), hdr, content)
+	})
+	if err != nil {
+		return nil, previous, fmt.Errorf("restoring backup (the previous work dir is in %s): %w", previous, err)
+	}
+	return manifest, previous, nil
+}
+
+// extract writes one file of the archive
+func extract(path string, hdr *tar.Header, content io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
+
+// Rotate makes the daily backup of workDir unless today's exists, and
+// deletes daily backups beyond the keep most recent. It returns the path
+// of the backup it made, if any; keep <= 0 disables daily backups.
+func Rotate(workDir string, keep int, now time.Time) (string, error) {
+	if keep <= 0 {
+		return "", nil
+	}
+	dir := filepath.Join(workDir, Dir)
+	path := filepath.Join(dir, dailyPrefix+now.Format(time.DateOnly)+".tar.gz")
+
+	var created string
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := CreateFile(workDir, path); err != nil {
+			return "", err
+		}
+		created = path
+	}
+
+	daily, err := filepath.Glob(filepath.Join(dir, dailyPrefix+"*.tar.gz"))
+	if err != nil {
+		return created, err
+	}
+	// Dated names sort chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(daily)))
+	for _, old := range daily[min(keep, len(daily)):] {
+		if err := os.Remove(old); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// List returns the backups in the backups directory of workDir, newest
+// first
+func List(workDir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(workDir, Dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var backups []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, info)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+	return backups, nil
+}
@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	workDir := t.TempDir()
+	writeFiles(t, workDir, map[string]string{
+		"config.yaml":              "provider:\n  type: openai\n",
+		"messages/default.json":    `{"id": "default"}`,
+		"messages/proj/main.json":  `{"id": "proj/main"}`,
+		"memory/m1.json":           `{"id": "m1"}`,
+		"usage/2026-10.json.tmp":   "partial",
+		"backups/old.tar.gz":       "not backed up",
+		"skills/review/skill.json": `{"id": "review"}`,
+	})
+
+	archive := filepath.Join(t.TempDir(), "backup.tar.gz")
+	manifest, err := CreateFile(workDir, archive)
+	if err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if len(manifest.Files) != 5 {
+		t.Errorf("expected 5 files backed up, got %+v", manifest.Files)
+	}
+	if _, err := VerifyFile(archive); err != nil {
+		t.Fatalf("VerifyFile failed: %v", err)
+	}
+
+	// Change the work dir, then restore
+	writeFiles(t, workDir, map[string]string{
+		"messages/default.json": `{"id": "default", "changed": true}`,
+		"messages/new.json":     `{"id": "new"}`,
+	})
+	os.Remove(filepath.Join(workDir, "memory", "m1.json"))
+
+	_, previous, err := Restore(workDir, archive)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(workDir, "messages", "default.json"))
+	if err != nil || string(data) != `{"id": "default"}` {
+		t.Errorf("expected the backed up conversation restored, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "memory", "m1.json")); err != nil {
+		t.Errorf("expected the deleted memory restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "messages", "new.json")); !os.IsNotExist(err) {
+		t.Errorf("expected files missing from the backup removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "backups", "old.tar.gz")); err != nil {
+		t.Errorf("expected the backups directory kept: %v", err)
+	}
+
+	// The replaced contents are backed up first
+	pre, err := VerifyFile(previous)
+	if err != nil {
+		t.Fatalf("pre-restore backup: %v", err)
+	}
+	found := false
+	for _, f := range pre.Files {
+		found = found || f.Path == "messages/new.json"
+	}
+	if !found {
+		t.Errorf("expected the pre-restore backup to hold the replaced files, got %+v", pre.Files)
+	}
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	workDir := t.TempDir()
+	writeFiles(t, workDir, map[string]string{"memory/m1.json": `{"id": "m1"}`})
+
+	var buf bytes.Buffer
+	if _, err := Create(workDir, &buf); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// Rewrite the archive with a modified file and the original manifest
+	var tampered bytes.Buffer
+	gz := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gz)
+	err := walk(bytes.NewReader(buf.Bytes()), func(hdr *tar.Header, content io.Reader) error {
+		var data bytes.Buffer
+		data.ReadFrom(content)
+		if hdr.Name != ManifestName {
+			data.Reset()
+			data.WriteString(`{"id": "evil"}`)
+		}
+		hdr.Size = int64(data.Len())
+		tw.WriteHeader(hdr)
+		_, err := tw.Write(data.Bytes())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	gz.Close()
+
+	if _, err := Verify(&tampered); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+	if _, err := Verify(strings.NewReader("not a backup")); err == nil {
+		t.Error("expected an error for a file that is not a backup")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	workDir := t.TempDir()
+	writeFiles(t, workDir, map[string]string{"memory/m1.json": `{"id": "m1"}`})
+
+	if path, err := Rotate(workDir, 0, time.Now()); err != nil || path != "" {
+		t.Errorf("expected no backup with keep 0, got %q, %v", path, err)
+	}
+
+	day := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	for i := 0; i < 4; i++ {
+		path, err := Rotate(workDir, 2, day.AddDate(0, 0, i))
+		if err != nil || path == "" {
+			t.Fatalf("Rotate failed: %q, %v", path, err)
+		}
+	}
+	if path, err := Rotate(workDir, 2, day.AddDate(0, 0, 3).Add(time.Hour)); err != nil || path != "" {
+		t.Errorf("expected one backup a day, got %q, %v", path, err)
+	}
+
+	backups, err := List(workDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name())
+	}
+	if len(names) != 2 || !strings.Contains(strings.Join(names, " "), "daily-2026-10-04.tar.gz") ||
+		!strings.Contains(strings.Join(names, " "), "daily-2026-10-03.tar.gz") {
+		t.Errorf("expected the 2 most recent daily backups kept, got %v", names)
+	}
+}
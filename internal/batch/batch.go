@@ -0,0 +1,238 @@
+// Package batch answers many prompts without a user: each line of a JSONL
+// file is a prompt, answered by one of several agents working in parallel,
+// and each result or error becomes a line of JSONL output, for evaluations
+// and bulk processing. A failing item is recorded and does not stop the
+// others.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/agent"
+)
+
+// DefaultConcurrency is how many items are answered at once by default
+const DefaultConcurrency = 4
+
+// maxLineBytes bounds one line of the input
+const maxLineBytes = 16 << 20
+
+// Item is one prompt of the input
+type Item struct {
+	ID           string `json:"id,omitempty"`
+	Prompt       string `json:"prompt"`
+	Conversation string `json:"conversation,omitempty"` // Items naming the same conversation run in order
+
+	Line int   `json:"-"` // Line number in the input
+	err  error // Why the line is not a valid item
+}
+
+// Result is the outcome of one item, written in input order
+type Result struct {
+	Line         int    `json:"line"`
+	ID           string `json:"id,omitempty"`
+	Conversation string `json:"conversation,omitempty"`
+	Response     string `json:"response,omitempty"`
+	Error        string `json:"error,omitempty"`
+	DurationMS   int64  `json:"duration_ms"`
+
+	// Metadata of the answer
+	Model        string `json:"model,omitempty"`
+	Tokens       int    `json:"tokens,omitempty"`
+	ToolCalls    int    `json:"tool_calls,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+}
+
+// Agent answers prompts in conversations; each worker has its own
+type Agent interface {
+	SetConversation(id string) error
+	Chat(ctx context.Context, input string) (*agent.ChatResult, error)
+}
+
+// Options configure a batch
+type Options struct {
+	Concurrency int // Items answered at once (0 = DefaultConcurrency)
+
+	// NewAgent creates the agent of a worker
+	NewAgent func() (Agent, error)
+
+	// Conversation names the conversation of an item without one, so
+	// items are answered independently of each other
+	Conversation func(Item) string
+
+	// Timeout bounds each item (0 = none)
+	Timeout time.Duration
+}
+
+// Read parses JSONL items. Blank lines are skipped; a line that is not a
+// valid item is kept and fails when run, so its error appears in the
+// results with its line number.
+func Read(r io.Reader) ([]Item, error) {
+	var items []Item
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		item := Item{Line: n}
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			item.err = fmt.Errorf("invalid item: %w", err)
+		} else if strings.TrimSpace(item.Prompt) == "" {
+			item.err = errors.New("item has no prompt")
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading items: %w", err)
+	}
+	return items, nil
+}
+
+// Run answers items with opts.Concurrency agents and passes each result to
+// emit in input order. Items of one conversation are answered one after the
+// other by the same worker. Run returns the first error of emit, which
+// stops the batch; item errors are only reported in their results.
+func Run(ctx context.Context, items []Item, opts Options, emit func(Result) error) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	// Group items by conversation, keeping the order of first appearance
+	conversations := make([]string, len(items))
+	var groups [][]int
+	byConversation := make(map[string]int)
+	for i, item := range items {
+		conv := item.Conversation
+		if conv == "" && opts.Conversation != nil {
+			conv = opts.Conversation(item)
+		}
+		conversations[i] = conv
+		g, ok := byConversation[conv]
+		if !ok || item.err != nil {
+			g = len(groups)
+			groups = append(groups, nil)
+			if item.err == nil {
+				byConversation[conv] = g
+			}
+		}
+		groups[g] = append(groups[g], i)
+	}
+	concurrency = min(concurrency, len(groups))
+
+	agents := make([]Agent, concurrency)
+	for w := range agents {
+		ag, err := opts.NewAgent()
+		if err != nil {
+			return fmt.Errorf("creating agent: %w", err)
+		}
+		agents[w] = ag
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Results are emitted in input order as soon as all earlier ones are in
+	var (
+		mu       sync.Mutex
+		results  = make([]*Result, len(items))
+		next     int
+		emitErr  error
+		complete = func(i int, r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = &r
+			for next < len(results) && results[next] != nil && emitErr == nil {
+				if err := emit(*results[next]); err != nil {
+					emitErr = err
+					cancel()
+				}
+				results[next] = nil
+				next++
+			}
+		}
+	)
+
+	jobs := make(chan []int)
+	var wg sync.WaitGroup
+	for _, ag := range agents {
+		wg.Add(1)
+		go func(ag Agent) {
+			defer wg.Done()
+			for group := range jobs {
+				for _, i := range group {
+					complete(i, answer(ctx, ag, items[i], conversations[i], opts.Timeout))
+				}
+			}
+		}(ag)
+	}
+	for _, group := range groups {
+		jobs <- group
+	}
+	close(jobs)
+	wg.Wait()
+	return emitErr
+}
+
+// answer runs one item
+func answer(ctx context.Context, ag Agent, item Item, conversation string, timeout time.Duration) Result {
+	result := Result{Line: item.Line, ID: item.ID, Conversation: conversation}
+	if item.err != nil {
+		result.Error = item.err.Error()
+		return result
+	}
+	if err := ctx.Err(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	answer, err := chat(ctx, ag, conversation, item.Prompt)
+	result.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Response = answer.Content
+	result.Model = answer.Model
+	result.Tokens = answer.TotalTokens
+	result.ToolCalls = len(answer.ToolCalls)
+	result.FinishReason = answer.FinishReason
+	return result
+}
+
+func chat(ctx context.Context, ag Agent, conversation, prompt string) (*agent.ChatResult, error) {
+	if err := ag.SetConversation(conversation); err != nil {
+		return nil, fmt.Errorf("setting conversation: %w", err)
+	}
+	return ag.Chat(ctx, prompt)
+}
+
+// Summary counts the results of a batch
+type Summary struct {
+	Items  int
+	Failed int
+}
+
+// Add counts a result
+func (s *Summary) Add(r Result) {
+	s.Items++
+	if r.Error != "" {
+		s.Failed++
+	}
+}
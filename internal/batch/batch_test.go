@@ -0,0 +1,177 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/igm/igent/internal/agent"
+)
+
+// fakeAgent answers with the conversation and prompt, tracking how many
+// agents answer at once
+type fakeAgent struct {
+	conversation string
+	shared       *fakeShared
+}
+
+type fakeShared struct {
+	running, peak atomic.Int32
+	mu            sync.Mutex
+	order         map[string][]string // Prompts by conversation, in the order answered
+}
+
+func (f *fakeAgent) SetConversation(id string) error {
+	f.conversation = id
+	return nil
+}
+
+func (f *fakeAgent) Chat(ctx context.Context, input string) (*agent.ChatResult, error) {
+	n := f.shared.running.Add(1)
+	defer f.shared.running.Add(-1)
+	for {
+		peak := f.shared.peak.Load()
+		if n <= peak || f.shared.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	delay := 5 * time.Millisecond
+	if input == "slow" {
+		delay = time.Minute
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if input == "fail" {
+		return nil, errors.New("provider error")
+	}
+	f.shared.mu.Lock()
+	f.shared.order[f.conversation] = append(f.shared.order[f.conversation], input)
+	f.shared.mu.Unlock()
+	return &agent.ChatResult{Content: f.conversation + ": " + input, Model: "fake", TotalTokens: 10}, nil
+}
+
+func TestRead(t *testing.T) {
+	items, err := Read(strings.NewReader(`{"id": "a", "prompt": "one"}
+
+not json
+{"id": "b"}
+{"prompt": "two", "conversation": "c"}
+`))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("expected 4 items, got %+v", items)
+	}
+	if items[0].ID != "a" || items[0].Line != 1 || items[0].err != nil {
+		t.Errorf("unexpected first item %+v", items[0])
+	}
+	if items[1].Line != 3 || items[1].err == nil || items[2].err == nil {
+		t.Errorf("expected invalid lines kept with their errors, got %+v %+v", items[1], items[2])
+	}
+	if items[3].Conversation != "c" || items[3].Line != 5 {
+		t.Errorf("unexpected last item %+v", items[3])
+	}
+}
+
+func TestRun(t *testing.T) {
+	shared := &fakeShared{order: make(map[string][]string)}
+	var items []Item
+	for i := 1; i <= 8; i++ {
+		items = append(items, Item{ID: fmt.Sprint(i), Prompt: fmt.Sprintf("q%d", i), Line: i})
+	}
+	items = append(items,
+		Item{Prompt: "first", Conversation: "thread", Line: 9},
+		Item{Prompt: "fail", Line: 10},
+		Item{Prompt: "second", Conversation: "thread", Line: 11},
+		Item{Line: 12, err: errors.New("item has no prompt")},
+		Item{Prompt: "third", Conversation: "thread", Line: 13},
+	)
+
+	var results []Result
+	err := Run(context.Background(), items, Options{
+		Concurrency: 3,
+		NewAgent:    func() (Agent, error) { return &fakeAgent{shared: shared}, nil },
+		Conversation: func(item Item) string {
+			return fmt.Sprintf("batch/%d", item.Line)
+		},
+	}, func(r Result) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, r := range results {
+		if r.Line != items[i].Line {
+			t.Fatalf("expected results in input order, got line %d at %d", r.Line, i)
+		}
+	}
+	if r := results[0]; r.Response != "batch/1: q1" || r.ID != "1" || r.Conversation != "batch/1" || r.Model != "fake" || r.Tokens != 10 {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if r := results[9]; r.Error != "provider error" || r.Response != "" {
+		t.Errorf("expected the failed item's error, got %+v", r)
+	}
+	if r := results[11]; r.Error != "item has no prompt" {
+		t.Errorf("expected the invalid item's error, got %+v", r)
+	}
+	if got := strings.Join(shared.order["thread"], ","); got != "first,second,third" {
+		t.Errorf("expected a conversation's items in order, got %s", got)
+	}
+	if peak := shared.peak.Load(); peak < 2 || peak > 3 {
+		t.Errorf("expected up to 3 items at once, peak was %d", peak)
+	}
+
+	var summary Summary
+	for _, r := range results {
+		summary.Add(r)
+	}
+	if summary.Items != 13 || summary.Failed != 2 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+}
+
+func TestRun_StopsOnWriteError(t *testing.T) {
+	shared := &fakeShared{order: make(map[string][]string)}
+	items := []Item{{Prompt: "a", Line: 1}, {Prompt: "b", Line: 2}, {Prompt: "c", Line: 3}}
+	written := 0
+	err := Run(context.Background(), items, Options{
+		Concurrency:  1,
+		NewAgent:     func() (Agent, error) { return &fakeAgent{shared: shared}, nil },
+		Conversation: func(item Item) string { return fmt.Sprint(item.Line) },
+	}, func(r Result) error {
+		written++
+		return errors.New("disk full")
+	})
+	if err == nil || err.Error() != "disk full" || written != 1 {
+		t.Errorf("expected the write error after one result, got %v (%d written)", err, written)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	shared := &fakeShared{order: make(map[string][]string)}
+	var results []Result
+	err := Run(context.Background(), []Item{{Prompt: "slow", Line: 1}}, Options{
+		Timeout:  time.Millisecond,
+		NewAgent: func() (Agent, error) { return &fakeAgent{shared: shared}, nil },
+	}, func(r Result) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil || len(results) != 1 || !strings.Contains(results[0].Error, "deadline exceeded") {
+		t.Errorf("expected the item to time out, got %v %+v", err, results)
+	}
+}
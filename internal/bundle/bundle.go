@@ -0,0 +1,330 @@
+// Package bundle installs team-shared agent setups: skills, system prompt
+// files, tool policies and starter memories described by one manifest, so
+// an organization can standardize its agents in one step.
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/storage"
+	"github.com/spf13/viper"
+)
+
+// ManifestName is the manifest file of a bundle directory or archive
+const ManifestName = "igent-bundle.yaml"
+
+// maxDownload caps bundles and files fetched over HTTP
+const maxDownload = 20 << 20
+
+// validName matches bundle names and skill IDs
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Bundle is a parsed bundle manifest
+type Bundle struct {
+	Name     string              `mapstructure:"name"`
+	Version  string              `mapstructure:"version"`
+	Skills   []Skill             `mapstructure:"skills"`
+	Prompts  []Prompt            `mapstructure:"prompts"`
+	Tools    *config.ToolsConfig `mapstructure:"tools"` // Replaces the tools config when set
+	Memories []Memory            `mapstructure:"memories"`
+
+	// readFile reads files referenced by the manifest, relative to it
+	readFile func(name string) ([]byte, error)
+}
+
+// Skill is a skill shipped in a bundle; the prompt is inline or in a file
+type Skill struct {
+	ID          string            `mapstructure:"id"`
+	Name        string            `mapstructure:"name"`
+	Description string            `mapstructure:"description"`
+	Prompt      string            `mapstructure:"prompt"`
+	PromptFile  string            `mapstructure:"prompt_file"`
+	Parameters  map[string]string `mapstructure:"parameters"`
+	Enabled     *bool             `mapstructure:"enabled"` // Default true
+}
+
+// Prompt is a system prompt include file; its content is inline or in a file
+type Prompt struct {
+	Name    string `mapstructure:"name"` // File name under prompts/<bundle>/
+	Content string `mapstructure:"content"`
+	File    string `mapstructure:"file"`
+}
+
+// Memory is a starter memory
+type Memory struct {
+	Type      string   `mapstructure:"type"` // fact, preference, context
+	Content   string   `mapstructure:"content"`
+	Relevance float64  `mapstructure:"relevance"` // Default 1
+	Tags      []string `mapstructure:"tags"`
+}
+
+// Result summarizes an installation
+type Result struct {
+	Skills      int
+	Prompts     []string // Installed prompt file paths
+	Memories    int      // New memories; already installed ones are kept
+	ToolsPolicy bool
+}
+
+// Load reads a bundle from a directory, a .zip archive, or a manifest file,
+// each either local or (archives and manifests) an http(s) URL
+func Load(ctx context.Context, src string, client *http.Client) (*Bundle, error) {
+	if u, err := url.Parse(src); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		data, err := download(ctx, client, u.String())
+		if err != nil {
+			return nil, err
+		}
+		if isZip(data) {
+			return loadZip(data)
+		}
+		return parse(data, func(name string) ([]byte, error) {
+			ref, err := url.Parse(name)
+			if err != nil {
+				return nil, err
+			}
+			return download(ctx, client, u.ResolveReference(ref).String())
+		})
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle: %w", err)
+	}
+	if info.IsDir() {
+		return loadFS(os.DirFS(src))
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle: %w", err)
+	}
+	if isZip(data) {
+		return loadZip(data)
+	}
+	return parse(data, readFS(os.DirFS(filepath.Dir(src))))
+}
+
+// loadZip reads a bundle archive; the manifest may be at the root or in a
+// single top-level directory, as produced by zipping a bundle directory
+func loadZip(data []byte) (*Bundle, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle archive: %w", err)
+	}
+	var fsys fs.FS = zr
+	if _, err := fs.Stat(zr, ManifestName); err != nil {
+		entries, err := fs.ReadDir(zr, ".")
+		if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+			return nil, fmt.Errorf("bundle archive has no %s", ManifestName)
+		}
+		if fsys, err = fs.Sub(zr, entries[0].Name()); err != nil {
+			return nil, err
+		}
+	}
+	return loadFS(fsys)
+}
+
+// loadFS reads a bundle from a directory tree
+func loadFS(fsys fs.FS) (*Bundle, error) {
+	data, err := fs.ReadFile(fsys, ManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle manifest: %w", err)
+	}
+	return parse(data, readFS(fsys))
+}
+
+// readFS returns a file reader confined to fsys
+func readFS(fsys fs.FS) func(string) ([]byte, error) {
+	return func(name string) ([]byte, error) {
+		name = path.Clean(filepath.ToSlash(name))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid file path %q: must be relative to the bundle", name)
+		}
+		return fs.ReadFile(fsys, name)
+	}
+}
+
+// parse decodes and validates a manifest
+func parse(data []byte, readFile func(string) ([]byte, error)) (*Bundle, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("parsing bundle manifest: %w", err)
+	}
+	b := &Bundle{readFile: readFile}
+	if err := v.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("parsing bundle manifest: %w", err)
+	}
+
+	if !validName.MatchString(b.Name) {
+		return nil, fmt.Errorf("invalid bundle name %q", b.Name)
+	}
+	for _, s := range b.Skills {
+		if !validName.MatchString(s.ID) {
+			return nil, fmt.Errorf("invalid skill id %q", s.ID)
+		}
+	}
+	for _, p := range b.Prompts {
+		if !validName.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid prompt name %q", p.Name)
+		}
+	}
+	for _, m := range b.Memories {
+		if strings.TrimSpace(m.Content) == "" {
+			return nil, errors.New("memory without content")
+		}
+	}
+	return b, nil
+}
+
+// Install adds the bundle to storage and cfg. Skills and prompt files are
+// overwritten and memories are keyed by content, so installing a newer
+// version of a bundle updates it in place. The caller saves cfg.
+func (b *Bundle) Install(cfg *config.Config, store *storage.JSONStore) (*Result, error) {
+	result := &Result{}
+
+	for _, s := range b.Skills {
+		prompt, err := b.content(s.Prompt, s.PromptFile)
+		if err != nil {
+			return nil, fmt.Errorf("skill %s: %w", s.ID, err)
+		}
+		skill := &storage.Skill{
+			ID:          s.ID,
+			Name:        s.Name,
+			Description: s.Description,
+			Prompt:      prompt,
+			Parameters:  s.Parameters,
+			Enabled:     s.Enabled == nil || *s.Enabled,
+		}
+		if skill.Name == "" {
+			skill.Name = s.ID
+		}
+		if err := store.SaveSkill(skill); err != nil {
+			return nil, fmt.Errorf("saving skill %s: %w", s.ID, err)
+		}
+		result.Skills++
+	}
+
+	promptDir := filepath.Join(cfg.Storage.WorkDir, "prompts", b.Name)
+	for _, p := range b.Prompts {
+		content, err := b.content(p.Content, p.File)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", p.Name, err)
+		}
+		if err := os.MkdirAll(promptDir, 0755); err != nil {
+			return nil, fmt.Errorf("creating prompt directory: %w", err)
+		}
+		file := filepath.Join(promptDir, p.Name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			return nil, fmt.Errorf("writing prompt %s: %w", p.Name, err)
+		}
+		if !slices.Contains(cfg.Agent.SystemPromptFiles, file) {
+			cfg.Agent.SystemPromptFiles = append(cfg.Agent.SystemPromptFiles, file)
+		}
+		result.Prompts = append(result.Prompts, file)
+	}
+
+	if b.Tools != nil {
+		cfg.Tools = *b.Tools
+		result.ToolsPolicy = true
+	}
+
+	if len(b.Memories) > 0 {
+		existing, err := store.LoadMemories()
+		if err != nil {
+			return nil, fmt.Errorf("loading memories: %w", err)
+		}
+		installed := make(map[string]bool, len(existing))
+		for _, m := range existing {
+			installed[m.ID] = true
+		}
+		for _, m := range b.Memories {
+			item := &storage.MemoryItem{
+				ID:        b.memoryID(m.Content),
+				Content:   strings.TrimSpace(m.Content),
+				Type:      m.Type,
+				CreatedAt: time.Now(),
+				Relevance: m.Relevance,
+				Tags:      storage.NormalizeTags(m.Tags),
+			}
+			if installed[item.ID] {
+				continue
+			}
+			if item.Type == "" {
+				item.Type = "fact"
+			}
+			if item.Relevance <= 0 {
+				item.Relevance = 1.0
+			}
+			if err := store.SaveMemory(item); err != nil {
+				return nil, fmt.Errorf("saving memory: %w", err)
+			}
+			result.Memories++
+		}
+	}
+	return result, nil
+}
+
+// content returns inline text or the contents of a bundle file
+func (b *Bundle) content(inline, file string) (string, error) {
+	if file == "" {
+		return inline, nil
+	}
+	data, err := b.readFile(file)
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", file, err)
+	}
+	return string(data), nil
+}
+
+// memoryID derives a stable ID so reinstalling does not duplicate memories
+func (b *Bundle) memoryID(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return "bundle-" + b.Name + "-" + hex.EncodeToString(sum[:6])
+}
+
+// download fetches a URL, capped at maxDownload
+func download(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", rawURL, err)
+	}
+	if len(data) > maxDownload {
+		return nil, fmt.Errorf("downloading %s: larger than %d MB", rawURL, maxDownload>>20)
+	}
+	return data, nil
+}
+
+// isZip reports whether data starts like a zip archive
+func isZip(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
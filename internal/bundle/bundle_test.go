@@ -0,0 +1,198 @@
+package bundle
+
+import (
+	"archive/zip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/storage"
+)
+
+const testManifest = `name: acme
+version: "1.2"
+skills:
+  - id: review
+    name: Code Review
+    description: Review a change
+    prompt_file: skills/review.md
+  - id: draft
+    prompt: Write a draft
+    enabled: false
+prompts:
+  - name: style.md
+    file: prompts/style.md
+  - name: policy.md
+    content: Never push to main.
+tools:
+  disabled: [ssh, "docker_*"]
+  limits:
+    shell:
+      timeout: 60
+memories:
+  - content: The staging cluster is staging.acme.internal
+  - type: preference
+    content: Prefer table-driven tests
+`
+
+var testFiles = map[string]string{
+	ManifestName:       testManifest,
+	"skills/review.md": "Review {{change}} carefully.",
+	"prompts/style.md": "Use the Acme style guide.",
+}
+
+func writeBundleDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range testFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func writeBundleZip(t *testing.T, prefix string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range testFiles {
+		w, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return path
+}
+
+func TestInstall(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir(writeBundleDir(t))))
+	defer srv.Close()
+
+	sources := map[string]string{
+		"directory":  writeBundleDir(t),
+		"manifest":   filepath.Join(writeBundleDir(t), ManifestName),
+		"zip":        writeBundleZip(t, ""),
+		"nested zip": writeBundleZip(t, "acme-bundle/"),
+		"url":        srv.URL + "/" + ManifestName,
+	}
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			b, err := Load(context.Background(), src, srv.Client())
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.Storage.WorkDir = t.TempDir()
+			store, err := storage.NewJSONStore(cfg.Storage.WorkDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := b.Install(cfg, store)
+			if err != nil {
+				t.Fatalf("Install: %v", err)
+			}
+			if result.Skills != 2 || len(result.Prompts) != 2 || result.Memories != 2 || !result.ToolsPolicy {
+				t.Errorf("unexpected result: %+v", result)
+			}
+
+			skills, err := store.LoadSkills()
+			if err != nil {
+				t.Fatal(err)
+			}
+			byID := make(map[string]*storage.Skill)
+			for _, s := range skills {
+				byID[s.ID] = s
+			}
+			if s := byID["review"]; s == nil || s.Prompt != "Review {{change}} carefully." || !s.Enabled {
+				t.Errorf("review skill = %+v", s)
+			}
+			if s := byID["draft"]; s == nil || s.Name != "draft" || s.Enabled {
+				t.Errorf("draft skill = %+v", s)
+			}
+
+			if len(cfg.Agent.SystemPromptFiles) != 2 {
+				t.Fatalf("system prompt files = %v", cfg.Agent.SystemPromptFiles)
+			}
+			data, err := os.ReadFile(cfg.Agent.SystemPromptFiles[0])
+			if err != nil || string(data) != "Use the Acme style guide." {
+				t.Errorf("style prompt = %q, %v", data, err)
+			}
+			if !strings.HasPrefix(cfg.Agent.SystemPromptFiles[0], filepath.Join(cfg.Storage.WorkDir, "prompts", "acme")) {
+				t.Errorf("prompt installed at %s", cfg.Agent.SystemPromptFiles[0])
+			}
+
+			if len(cfg.Tools.Disabled) != 2 || cfg.Tools.Limits["shell"].Timeout != 60 {
+				t.Errorf("tools = %+v", cfg.Tools)
+			}
+
+			// Reinstalling updates in place without duplicating anything
+			result, err = b.Install(cfg, store)
+			if err != nil {
+				t.Fatalf("reinstall: %v", err)
+			}
+			if result.Memories != 0 || len(cfg.Agent.SystemPromptFiles) != 2 {
+				t.Errorf("reinstall: result %+v, prompt files %v", result, cfg.Agent.SystemPromptFiles)
+			}
+			memories, err := store.LoadMemories()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(memories) != 2 {
+				t.Errorf("got %d memories, want 2", len(memories))
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidBundles(t *testing.T) {
+	tests := map[string]string{
+		"missing name":    "skills: []\n",
+		"bad skill id":    "name: acme\nskills:\n  - id: ../evil\n",
+		"bad prompt name": "name: acme\nprompts:\n  - name: ../../.bashrc\n    content: x\n",
+		"empty memory":    "name: acme\nmemories:\n  - content: \" \"\n",
+	}
+	for name, manifest := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, ManifestName), []byte(manifest), 0644)
+			if _, err := Load(context.Background(), dir, http.DefaultClient); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+
+	// Referenced files must stay inside the bundle
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ManifestName), []byte("name: acme\nprompts:\n  - name: p.md\n    file: ../secret\n"), 0644)
+	b, err := Load(context.Background(), dir, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Storage.WorkDir = t.TempDir()
+	store, _ := storage.NewJSONStore(cfg.Storage.WorkDir)
+	if _, err := b.Install(cfg, store); err == nil {
+		t.Error("expected error for file outside the bundle")
+	}
+}
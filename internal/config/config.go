@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/igm/igent/internal/logger"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
@@ -15,21 +18,86 @@ type Config struct {
 	Provider ProviderConfig `mapstructure:"provider"`
 	Storage  StorageConfig  `mapstructure:"storage"`
 	Context  ContextConfig  `mapstructure:"context"`
+	Memory   MemoryConfig   `mapstructure:"memory"`
 	Agent    AgentConfig    `mapstructure:"agent"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
+	UI       UIConfig       `mapstructure:"ui"`
+	Network  NetworkConfig  `mapstructure:"network"`
+	Search   SearchConfig   `mapstructure:"search"`
+	Routing  RoutingConfig  `mapstructure:"routing"`
+	Code     CodeConfig     `mapstructure:"code"`
+	SSH      SSHConfig      `mapstructure:"ssh"`
+	Tools    ToolsConfig    `mapstructure:"tools"`
+	Quota    QuotaConfig    `mapstructure:"quota"`
+	Budget   BudgetConfig   `mapstructure:"budget"`
+	Sync     SyncConfig     `mapstructure:"sync"`
+	Server   ServerConfig   `mapstructure:"server"`
+	Daemon   DaemonConfig   `mapstructure:"daemon"`
+
+	Guardrails GuardrailsConfig `mapstructure:"guardrails"`
+	Tracing    TracingConfig    `mapstructure:"tracing"`
+
+	// Profiles are named agents with their own prompt, model and tools,
+	// used with --profile or by the orchestrator, keyed by name
+	Profiles map[string]ProfileConfig `mapstructure:"profiles"`
+
+	// Personas are switched to with /persona in a conversation, keyed by
+	// name; they add to or replace the built-in ops, coder and writer
+	Personas map[string]PersonaConfig `mapstructure:"personas"`
 }
 
 // ProviderConfig holds LLM provider settings
 type ProviderConfig struct {
 	Type    string `mapstructure:"type"` // openai, zhipu, anthropic
 	BaseURL string `mapstructure:"base_url"`
-	APIKey  string `mapstructure:"api_key"`
+	APIKey  string `mapstructure:"api_key" secret:"true"`
 	Model   string `mapstructure:"model"`
+
+	Proxy              string `mapstructure:"proxy"`                // HTTP(S) proxy URL
+	CACertFile         string `mapstructure:"ca_cert_file"`         // Extra root CAs (PEM)
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Disable TLS verification
+
+	WebSearch bool `mapstructure:"web_search"` // GLM built-in web_search tool (glm/zhipu only)
+
+	PromptCache bool `mapstructure:"prompt_cache"` // Prompt caching hints (anthropic/openai)
+
+	MaxConcurrent int `mapstructure:"max_concurrent"` // Concurrent calls to the provider, to stay within rate limits (0 = unlimited)
+
+	// Prices for cost estimates, USD per 1M tokens (0 = preset price of the default model)
+	InputPrice  float64 `mapstructure:"input_price"`
+	OutputPrice float64 `mapstructure:"output_price"`
+
+	Compat CompatConfig `mapstructure:"compat"` // Quirks of OpenAI-compatible backends
+
+	EmbeddingModel string `mapstructure:"embedding_model"` // Embeddings model (empty = preset's, if any)
+}
+
+// CompatConfig works around OpenAI-compatible backends that deviate from the API
+type CompatConfig struct {
+	Roles                    map[string]string `mapstructure:"roles"`                       // Role renames, e.g. tool: function
+	MergeToolResults         bool              `mapstructure:"merge_tool_results"`          // Send tool calls/results as text in user messages
+	DisableParallelToolCalls bool              `mapstructure:"disable_parallel_tool_calls"` // Send parallel_tool_calls=false
 }
 
 // StorageConfig holds storage settings
 type StorageConfig struct {
-	WorkDir string `mapstructure:"work_dir"`
+	WorkDir       string `mapstructure:"work_dir"`
+	AutoArtifacts bool   `mapstructure:"auto_artifacts"` // Save code blocks from responses as artifacts
+	BackupKeep    int    `mapstructure:"backup_keep"`    // Daily backups of the work dir to keep (0 = no automatic backups)
+
+	// Retention applied by igent gc: conversations not updated for
+	// RetentionDays, or beyond the MaxConversations most recently updated,
+	// are archived or deleted (RetentionAction), and memories with a
+	// relevance below PruneRelevance are deleted. 0 disables each rule.
+	RetentionDays    int     `mapstructure:"retention_days"`
+	MaxConversations int     `mapstructure:"max_conversations"`
+	RetentionAction  string  `mapstructure:"retention_action"` // archive (move to archive/messages) or delete
+	PruneRelevance   float64 `mapstructure:"prune_relevance"`
+
+	// IntegrityKey keys the hash chains of conversations (HMAC-SHA256), so
+	// only holders of the key can rebuild a chain after editing a file;
+	// unkeyed chains catch accidental edits only. Also IGENT_STORAGE_INTEGRITY_KEY.
+	IntegrityKey string `mapstructure:"integrity_key" secret:"true"`
 }
 
 // ContextConfig holds context management settings
@@ -37,12 +105,322 @@ type ContextConfig struct {
 	MaxMessages   int `mapstructure:"max_messages"`   // Max messages before summarization
 	MaxTokens     int `mapstructure:"max_tokens"`     // Approximate max context tokens
 	SummarizeWhen int `mapstructure:"summarize_when"` // Trigger summarization at this count
+
+	// Compress older tool results within a turn once the loop exceeds this many tokens (0 = off)
+	ToolHistoryTokens int `mapstructure:"tool_history_tokens"`
+
+	// Compression of retrieved memories and summaries: off, light, medium, aggressive or llm
+	CompressSnippets string `mapstructure:"compress_snippets"`
+	CompressModel    string `mapstructure:"compress_model"` // Cheap model for llm compression (default: provider model)
+
+	// Memories injected per message, ranked by embedding similarity to it
+	MemoryTopK          int     `mapstructure:"memory_top_k"`          // At most this many
+	MemoryMinSimilarity float64 `mapstructure:"memory_min_similarity"` // Cosine similarity a memory needs (0-1)
+}
+
+// MemoryConfig tunes how long conversations are compressed into a summary
+// and, optionally, memories
+type MemoryConfig struct {
+	SummarizeWhen int    `mapstructure:"summarize_when"` // Summarize at this many messages (0 = context.summarize_when)
+	KeepMessages  int    `mapstructure:"keep_messages"`  // Recent messages kept verbatim when summarizing
+	SummaryPrompt string `mapstructure:"summary_prompt"` // System prompt of the summarizer (empty = built-in)
+
+	// Layered summaries: once the recent summary exceeds SummaryMaxTokens,
+	// it is merged into the long-term summary before the next summarization
+	SummaryMaxTokens int    `mapstructure:"summary_max_tokens"` // Size of the recent summary that triggers a merge
+	AbstractPrompt   string `mapstructure:"abstract_prompt"`    // System prompt of the long-term merge (empty = built-in)
+
+	ExtractMemories bool   `mapstructure:"extract_memories"` // Save facts from summarized messages as memories
+	ExtractPrompt   string `mapstructure:"extract_prompt"`   // System prompt of the extractor (empty = built-in)
+
+	// Importance scoring: the model rates memories it adds or extracts
+	ScoreImportance bool   `mapstructure:"score_importance"` // Ask the model for importance (relevance) and type
+	ScorePrompt     string `mapstructure:"score_prompt"`     // System prompt of the scorer (empty = built-in)
 }
 
 // AgentConfig holds general agent settings
 type AgentConfig struct {
 	SystemPrompt string `mapstructure:"system_prompt"`
 	Name         string `mapstructure:"name"`
+
+	SystemPromptFiles []string `mapstructure:"system_prompt_files"` // Files appended to system_prompt, re-read when changed
+
+	// Response constraints (toggleable at runtime with /style)
+	MaxResponseTokens int  `mapstructure:"max_response_tokens"` // 0 = provider default
+	BulletPoints      bool `mapstructure:"bullet_points"`       // Prefer bullet points
+	CodeOnly          bool `mapstructure:"code_only"`           // Reply with code only
+
+	ShowReasoning bool `mapstructure:"show_reasoning"` // Print the thinking stream of reasoning models (dimmed)
+	ShowUsage     bool `mapstructure:"show_usage"`     // Print the tokens, estimated cost, duration and tool calls of each REPL answer (dimmed; toggleable with /usage)
+
+	Accessible bool `mapstructure:"accessible"` // Screen reader mode: plain text REPL, tool activity announced in sentences
+
+	// Answers shown in a terminal are rendered as styled markdown with
+	// highlighted code blocks (--plain prints them as written)
+	Markdown      bool   `mapstructure:"markdown"`
+	MarkdownTheme string `mapstructure:"markdown_theme"` // auto, dark, light, dracula, pink, ascii, notty or a glamour JSON style file
+
+	MaxRunIterations int `mapstructure:"max_run_iterations"` // Iteration budget of autonomous runs before they pause
+
+	// Pause points of autonomous runs for user review
+	PauseEveryToolCalls int      `mapstructure:"pause_every_tool_calls"` // 0 = never
+	PauseEveryCost      float64  `mapstructure:"pause_every_cost"`       // USD; 0 = never
+	PauseAt             []string `mapstructure:"pause_at"`               // Checkpoint labels; "*" = every checkpoint
+
+	// Critic pass over completed autonomous runs
+	EvaluateRuns      bool   `mapstructure:"evaluate_runs"`       // Evaluate every run (--evaluate enables it per run)
+	EvaluatorModel    string `mapstructure:"evaluator_model"`     // Model of the critic (default: provider model)
+	EvaluatorMinScore int    `mapstructure:"evaluator_min_score"` // Score out of 10 a run needs to pass
+
+	// Review of answers before they are shown (toggleable at runtime with /critique)
+	Critique      string `mapstructure:"critique"`       // off, note (attach a confidence note) or revise
+	CritiqueModel string `mapstructure:"critique_model"` // Model of the reviewer (default: provider model)
+
+	// Files included in prompts with @path or /attach
+	AttachmentMaxBytes int    `mapstructure:"attachment_max_bytes"` // Larger files are summarized in chunks instead of inlined
+	AttachmentModel    string `mapstructure:"attachment_model"`     // Model summarizing large attachments (default: provider model)
+
+	ProjectNamespace bool `mapstructure:"project_namespace"` // Default to <repo>/default inside a git repository
+
+	AutoTitle bool `mapstructure:"auto_title"` // Title new conversations from their first exchange with the LLM
+}
+
+// NetworkConfig holds the outbound network policy for providers and tools
+type NetworkConfig struct {
+	AllowedHosts []string           `mapstructure:"allowed_hosts"` // Hosts or *.domain patterns; empty allows all
+	ClientCerts  []ClientCertConfig `mapstructure:"client_certs"`  // mTLS client certificates per host
+	Audit        bool               `mapstructure:"audit"`         // Log every outbound request
+}
+
+// SearchConfig configures the web_search tool
+type SearchConfig struct {
+	Backend    string `mapstructure:"backend"`               // searxng, brave, duckduckgo; empty disables web_search
+	URL        string `mapstructure:"url"`                   // SearxNG instance URL, or a custom endpoint
+	APIKey     string `mapstructure:"api_key" secret:"true"` // Brave Search API key
+	MaxResults int    `mapstructure:"max_results"`           // Results per query
+}
+
+// RoutingConfig configures routing of 'igent ask' prompts to conversations
+type RoutingConfig struct {
+	MinSimilarity float64 `mapstructure:"min_similarity"` // Below this a new conversation is started
+}
+
+// CodeConfig configures the run_code sandbox
+type CodeConfig struct {
+	Backend    string `mapstructure:"backend"`     // process or docker; empty disables run_code
+	Image      string `mapstructure:"image"`       // Docker image for all languages (empty = per-language default)
+	Timeout    int    `mapstructure:"timeout"`     // Default wall-clock limit in seconds
+	CPUSeconds int    `mapstructure:"cpu_seconds"` // CPU time limit (0 = none)
+	MemoryMB   int    `mapstructure:"memory_mb"`   // Memory limit in MB (0 = none)
+}
+
+// SSHConfig configures the ssh tool; keys come from the ssh-agent or key files
+type SSHConfig struct {
+	Hosts          []string `mapstructure:"hosts"`            // Allowed hosts or *.domain patterns; empty disables ssh
+	User           string   `mapstructure:"user"`             // Default remote user (empty = local user)
+	IdentityFiles  []string `mapstructure:"identity_files"`   // Private keys (empty = ~/.ssh/id_ed25519, id_ecdsa, id_rsa)
+	KnownHostsFile string   `mapstructure:"known_hosts_file"` // Host keys (empty = ~/.ssh/known_hosts)
+	Timeout        int      `mapstructure:"timeout"`          // Default command timeout in seconds
+}
+
+// ToolsConfig restricts the tools offered to the model; entries are tool
+// names or glob patterns such as git_*
+type ToolsConfig struct {
+	Enabled  []string `mapstructure:"enabled"`  // Only these tools (empty = all)
+	Disabled []string `mapstructure:"disabled"` // Never these tools; "*" disables all
+
+	Limits map[string]ToolLimitsConfig `mapstructure:"limits"` // Per-tool timeout and output size, keyed by tool name
+
+	// Confirm sets whether a tool runs without asking (allow), is refused
+	// (deny) or asks first (ask), keyed by tool name or pattern such as
+	// git_*; by default read-only tools are allowed and others ask
+	Confirm map[string]string `mapstructure:"confirm"`
+
+	Custom []CustomToolConfig `mapstructure:"custom"` // Shell-backed tools declared in config
+
+	// Aliases gives tools another name, keyed by alias, such as search for
+	// mcp.github.search_issues
+	Aliases map[string]string `mapstructure:"aliases"`
+}
+
+// CustomToolConfig declares a tool that runs a shell command. ${name} in
+// the command is replaced by the shell-quoted value of parameter name.
+type CustomToolConfig struct {
+	Name        string                  `mapstructure:"name"`
+	Namespace   string                  `mapstructure:"namespace"` // Optional; the tool is then <namespace>.<name>
+	Description string                  `mapstructure:"description"`
+	Parameters  []CustomToolParamConfig `mapstructure:"parameters"`
+	Command     string                  `mapstructure:"command"`
+	Timeout     int                     `mapstructure:"timeout"` // Seconds; default 30
+}
+
+// CustomToolParamConfig is one parameter of a custom tool
+type CustomToolParamConfig struct {
+	Name        string      `mapstructure:"name"`
+	Type        string      `mapstructure:"type"` // string (default), integer, number, boolean or array
+	Description string      `mapstructure:"description"`
+	Required    bool        `mapstructure:"required"`
+	Enum        []string    `mapstructure:"enum"`
+	Default     interface{} `mapstructure:"default"` // Used when the model omits the parameter
+}
+
+// ToolLimitsConfig overrides a tool's built-in limits; 0 keeps the default
+type ToolLimitsConfig struct {
+	Timeout    int `mapstructure:"timeout"`     // Default timeout in seconds
+	MaxTimeout int `mapstructure:"max_timeout"` // Longest timeout a call may request (tools with a timeout argument)
+	MaxOutput  int `mapstructure:"max_output"`  // Output cap in bytes
+}
+
+// QuotaConfig limits LLM usage, tracked in the usage ledger per user and
+// per API key
+type QuotaConfig struct {
+	User    string      `mapstructure:"user"`     // Ledger user; default the OS user
+	PerUser QuotaLimits `mapstructure:"per_user"` // Limits of the user
+	PerKey  QuotaLimits `mapstructure:"per_key"`  // Limits of the provider API key, across users sharing it
+	WarnAt  float64     `mapstructure:"warn_at"`  // Warn when this fraction of a quota is used
+}
+
+// QuotaLimits are daily and monthly usage limits; 0 = unlimited
+type QuotaLimits struct {
+	DailyTokens   int     `mapstructure:"daily_tokens"`
+	MonthlyTokens int     `mapstructure:"monthly_tokens"`
+	DailyCost     float64 `mapstructure:"daily_cost"`   // Estimated USD
+	MonthlyCost   float64 `mapstructure:"monthly_cost"` // Estimated USD
+}
+
+// BudgetConfig caps the tokens a turn, a conversation and a day may use,
+// so a runaway agentic loop cannot run up a bill; 0 = unlimited
+type BudgetConfig struct {
+	TurnTokens         int    `mapstructure:"turn_tokens"`         // All LLM calls of one turn
+	ConversationTokens int    `mapstructure:"conversation_tokens"` // A conversation over its lifetime
+	DailyTokens        int    `mapstructure:"daily_tokens"`        // The user's tokens today, across conversations
+	OnExceed           string `mapstructure:"on_exceed"`           // ask (confirm on the terminal, else refuse) or refuse
+}
+
+// SyncConfig holds the remote the conversations and memories of the work
+// dir are synced with by igent sync
+type SyncConfig struct {
+	Backend string `mapstructure:"backend"` // git; empty disables sync
+	URL     string `mapstructure:"url"`     // Repository URL or path
+	Branch  string `mapstructure:"branch"`
+}
+
+// ServerConfig holds the settings of igent serve, the OpenAI-compatible
+// HTTP API in front of the agent
+type ServerConfig struct {
+	Addr   string `mapstructure:"addr"`                  // Listen address
+	APIKey string `mapstructure:"api_key" secret:"true"` // Bearer token clients must send (empty = no auth)
+	Model  string `mapstructure:"model"`                 // Model name the API reports and accepts
+}
+
+// GuardrailsConfig holds the rules that screen user input before the model
+// sees it, and tool call arguments and answers before tools run or text is
+// shown
+type GuardrailsConfig struct {
+	Input            []GuardrailRule `mapstructure:"input"`             // Rules for user input
+	Output           []GuardrailRule `mapstructure:"output"`            // Rules for answers and tool call arguments
+	MaxOutputChars   int             `mapstructure:"max_output_chars"`  // Cut longer answers (0 = no limit)
+	Moderation       bool            `mapstructure:"moderation"`        // Have the model moderate input and answers
+	ModerationPolicy string          `mapstructure:"moderation_policy"` // What moderation flags
+}
+
+// DefaultModerationPolicy is what guardrails moderation flags by default
+const DefaultModerationPolicy = "Instructions for violence, weapons, malware or other serious crimes; self-harm encouragement; harassment or hate; sexual content involving minors; disclosure of passwords, API keys or other secrets."
+
+// GuardrailRule is a regular expression guardrail
+type GuardrailRule struct {
+	Name    string `mapstructure:"name"`
+	Pattern string `mapstructure:"pattern"` // Go regular expression, e.g. (?i)password\s*[:=]
+	Action  string `mapstructure:"action"`  // block (default), redact or warn
+}
+
+// TracingConfig configures OpenTelemetry tracing of turns, provider calls
+// and tool executions
+type TracingConfig struct {
+	Exporter    string            `mapstructure:"exporter"`              // otlp or file (empty = tracing off)
+	Endpoint    string            `mapstructure:"endpoint"`              // OTLP/HTTP traces URL (empty = OTEL_EXPORTER_OTLP_* or http://localhost:4318/v1/traces)
+	Headers     map[string]string `mapstructure:"headers" secret:"true"` // Sent with every export, e.g. an API key
+	File        string            `mapstructure:"file"`                  // Output of the file exporter, OTLP JSON lines
+	ServiceName string            `mapstructure:"service_name"`          // service.name of the spans
+	SampleRatio float64           `mapstructure:"sample_ratio"`          // Fraction of turns traced (0 or 1 = all)
+}
+
+// DaemonConfig holds the settings of igent daemon
+type DaemonConfig struct {
+	Socket string `mapstructure:"socket"` // Unix socket (empty = <work_dir>/daemon.sock)
+}
+
+// ProfileConfig is a named agent profile, such as a reviewer, coder or ops
+// agent. Empty fields keep the main config's settings.
+type ProfileConfig struct {
+	Description   string            `mapstructure:"description"`    // What the profile is for, shown to the orchestrator
+	SystemPrompt  string            `mapstructure:"system_prompt"`  // Replaces agent.system_prompt
+	Model         string            `mapstructure:"model"`          // Replaces provider.model
+	Tools         []string          `mapstructure:"tools"`          // Replaces tools.enabled
+	DisabledTools []string          `mapstructure:"disabled_tools"` // Replaces tools.disabled
+	Confirm       map[string]string `mapstructure:"confirm"`        // Added to tools.confirm, overriding its rules
+}
+
+// PersonaConfig is a role the agent takes on in a conversation: unlike a
+// profile it keeps the model and tools, and can be switched mid-conversation
+type PersonaConfig struct {
+	Description  string            `mapstructure:"description"`   // What the persona is for, shown by /persona
+	SystemPrompt string            `mapstructure:"system_prompt"` // Replaces agent.system_prompt
+	Skills       []string          `mapstructure:"skills"`        // IDs of the skills used (empty = all)
+	Confirm      map[string]string `mapstructure:"confirm"`       // Added to tools.confirm where stricter; allow is ignored
+}
+
+// ProfileNames returns the names of the configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns a copy of the config with the settings of a profile
+// applied
+func (c *Config) WithProfile(name string) (*Config, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		if len(c.Profiles) == 0 {
+			return nil, fmt.Errorf("unknown profile %q: no profiles are configured", name)
+		}
+		return nil, fmt.Errorf("unknown profile %q (want one of %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	cfg := *c
+	if p.SystemPrompt != "" {
+		cfg.Agent.SystemPrompt = p.SystemPrompt
+	}
+	if p.Model != "" {
+		cfg.Provider.Model = p.Model
+	}
+	if len(p.Tools) > 0 {
+		cfg.Tools.Enabled = p.Tools
+	}
+	if len(p.DisabledTools) > 0 {
+		cfg.Tools.Disabled = p.DisabledTools
+	}
+	if len(p.Confirm) > 0 {
+		confirm := make(map[string]string, len(c.Tools.Confirm)+len(p.Confirm))
+		for tool, decision := range c.Tools.Confirm {
+			confirm[tool] = decision
+		}
+		for tool, decision := range p.Confirm {
+			confirm[tool] = decision
+		}
+		cfg.Tools.Confirm = confirm
+	}
+	return &cfg, nil
+}
+
+// ClientCertConfig is an mTLS client certificate for one host
+type ClientCertConfig struct {
+	Host     string `mapstructure:"host"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
 }
 
 // LoggingConfig holds logging settings
@@ -51,6 +429,17 @@ type LoggingConfig struct {
 	Format string `mapstructure:"format"` // text, json
 }
 
+// UIConfig holds the colors of the terminal output
+type UIConfig struct {
+	Color string `mapstructure:"color"` // auto (terminals, unless NO_COLOR is set), always or never
+	Theme string `mapstructure:"theme"` // auto (by the terminal's background), dark or light; agent.markdown_theme auto follows it
+
+	// Colors override styles of the theme by role: heading, label, command,
+	// prompt, warning and dim. Styles are words such as "bold blue" or SGR
+	// codes such as 1;34; "none" leaves the text unstyled.
+	Colors map[string]string `mapstructure:"colors"`
+}
+
 // DefaultConfig returns sensible defaults
 func DefaultConfig() *Config {
 	home, _ := os.UserHomeDir()
@@ -61,23 +450,86 @@ func DefaultConfig() *Config {
 			Type:    "openai",
 			BaseURL: "https://api.openai.com/v1",
 			Model:   "gpt-4o-mini",
+
+			PromptCache: true,
 		},
 		Storage: StorageConfig{
-			WorkDir: workDir,
+			WorkDir:       workDir,
+			AutoArtifacts: true,
+
+			RetentionAction: "archive",
+			PruneRelevance:  0.3,
 		},
 		Context: ContextConfig{
 			MaxMessages:   50,
 			MaxTokens:     4000,
 			SummarizeWhen: 30,
+
+			ToolHistoryTokens: 12000,
+			CompressSnippets:  "off",
+
+			MemoryTopK:          5,
+			MemoryMinSimilarity: 0.3,
+		},
+		Memory: MemoryConfig{
+			KeepMessages:     10,
+			SummaryMaxTokens: 500,
 		},
 		Agent: AgentConfig{
 			Name:         "igent",
 			SystemPrompt: "You are a helpful AI assistant. Be concise and accurate.",
+
+			MaxRunIterations:   50,
+			EvaluatorMinScore:  7,
+			AttachmentMaxBytes: 32000,
+			ProjectNamespace:   true,
+			AutoTitle:          true,
+			ShowUsage:          true,
+			Markdown:           true,
+			MarkdownTheme:      "auto",
+		},
+		Search: SearchConfig{
+			MaxResults: 5,
+		},
+		Routing: RoutingConfig{
+			MinSimilarity: 0.4,
+		},
+		Code: CodeConfig{
+			Backend:    "process",
+			Timeout:    30,
+			CPUSeconds: 10,
+			MemoryMB:   512,
+		},
+		SSH: SSHConfig{
+			Timeout: 30,
+		},
+		Quota: QuotaConfig{
+			WarnAt: 0.8,
+		},
+		Budget: BudgetConfig{
+			OnExceed: "ask",
+		},
+		Sync: SyncConfig{
+			Branch: "main",
+		},
+		Server: ServerConfig{
+			Addr:  "127.0.0.1:8080",
+			Model: "igent",
+		},
+		Guardrails: GuardrailsConfig{
+			ModerationPolicy: DefaultModerationPolicy,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "igent",
 		},
 		Logging: LoggingConfig{
 			Level:  string(logger.LevelInfo),
 			Format: string(logger.FormatText),
 		},
+		UI: UIConfig{
+			Color: "auto",
+			Theme: "auto",
+		},
 	}
 }
 
@@ -85,31 +537,56 @@ func DefaultConfig() *Config {
 func Load(cfgFile string) (*Config, error) {
 	cfg := DefaultConfig()
 
-	v := viper.New()
-	v.SetConfigName("config")
-	v.SetConfigType("yaml")
-
-	if cfgFile != "" {
-		v.SetConfigFile(cfgFile)
-	} else {
-		// Check multiple locations
-		v.AddConfigPath(".")
-		v.AddConfigPath(cfg.Storage.WorkDir)
-		v.AddConfigPath("/etc/igent")
-	}
+	v := newViper(cfgFile)
 
 	// Set defaults
 	v.SetDefault("provider.type", cfg.Provider.Type)
 	v.SetDefault("provider.base_url", cfg.Provider.BaseURL)
 	v.SetDefault("provider.model", cfg.Provider.Model)
+	v.SetDefault("provider.prompt_cache", cfg.Provider.PromptCache)
 	v.SetDefault("storage.work_dir", cfg.Storage.WorkDir)
+	v.SetDefault("storage.auto_artifacts", cfg.Storage.AutoArtifacts)
+	v.SetDefault("storage.retention_action", cfg.Storage.RetentionAction)
+	v.SetDefault("storage.prune_relevance", cfg.Storage.PruneRelevance)
+	v.SetDefault("storage.integrity_key", cfg.Storage.IntegrityKey)
 	v.SetDefault("context.max_messages", cfg.Context.MaxMessages)
 	v.SetDefault("context.max_tokens", cfg.Context.MaxTokens)
 	v.SetDefault("context.summarize_when", cfg.Context.SummarizeWhen)
+	v.SetDefault("context.tool_history_tokens", cfg.Context.ToolHistoryTokens)
+	v.SetDefault("context.compress_snippets", cfg.Context.CompressSnippets)
+	v.SetDefault("context.memory_top_k", cfg.Context.MemoryTopK)
+	v.SetDefault("context.memory_min_similarity", cfg.Context.MemoryMinSimilarity)
+	v.SetDefault("memory.keep_messages", cfg.Memory.KeepMessages)
+	v.SetDefault("memory.summary_max_tokens", cfg.Memory.SummaryMaxTokens)
 	v.SetDefault("agent.name", cfg.Agent.Name)
 	v.SetDefault("agent.system_prompt", cfg.Agent.SystemPrompt)
+	v.SetDefault("agent.max_run_iterations", cfg.Agent.MaxRunIterations)
+	v.SetDefault("agent.evaluator_min_score", cfg.Agent.EvaluatorMinScore)
+	v.SetDefault("agent.attachment_max_bytes", cfg.Agent.AttachmentMaxBytes)
+	v.SetDefault("agent.project_namespace", cfg.Agent.ProjectNamespace)
+	v.SetDefault("agent.auto_title", cfg.Agent.AutoTitle)
+	v.SetDefault("agent.accessible", cfg.Agent.Accessible)
+	v.SetDefault("agent.show_usage", cfg.Agent.ShowUsage)
+	v.SetDefault("agent.markdown", cfg.Agent.Markdown)
+	v.SetDefault("agent.markdown_theme", cfg.Agent.MarkdownTheme)
+	v.SetDefault("search.max_results", cfg.Search.MaxResults)
+	v.SetDefault("routing.min_similarity", cfg.Routing.MinSimilarity)
+	v.SetDefault("code.backend", cfg.Code.Backend)
+	v.SetDefault("code.timeout", cfg.Code.Timeout)
+	v.SetDefault("code.cpu_seconds", cfg.Code.CPUSeconds)
+	v.SetDefault("code.memory_mb", cfg.Code.MemoryMB)
+	v.SetDefault("ssh.timeout", cfg.SSH.Timeout)
+	v.SetDefault("quota.warn_at", cfg.Quota.WarnAt)
+	v.SetDefault("budget.on_exceed", cfg.Budget.OnExceed)
+	v.SetDefault("sync.branch", cfg.Sync.Branch)
+	v.SetDefault("server.addr", cfg.Server.Addr)
+	v.SetDefault("server.model", cfg.Server.Model)
+	v.SetDefault("guardrails.moderation_policy", cfg.Guardrails.ModerationPolicy)
+	v.SetDefault("tracing.service_name", cfg.Tracing.ServiceName)
 	v.SetDefault("logging.level", cfg.Logging.Level)
 	v.SetDefault("logging.format", cfg.Logging.Format)
+	v.SetDefault("ui.color", cfg.UI.Color)
+	v.SetDefault("ui.theme", cfg.UI.Theme)
 
 	// Environment variable overrides
 	v.SetEnvPrefix("IGENT")
@@ -123,8 +600,17 @@ func Load(cfgFile string) (*Config, error) {
 		// Config file not found, use defaults
 	}
 
-	if err := v.Unmarshal(cfg); err != nil {
-		return nil, fmt.Errorf("error unmarshaling config: %w", err)
+	// Unknown keys come first: a misplaced key often fails decoding too
+	var problems []string
+	if file := v.ConfigFileUsed(); file != "" {
+		settings, err := readSettings(file)
+		if err != nil {
+			return nil, err
+		}
+		problems = unknownKeys(settings)
+	}
+	if err := decode(v, cfg); err != nil {
+		return nil, &ValidationError{File: v.ConfigFileUsed(), Problems: append(problems, decodeProblems(err)...)}
 	}
 
 	// Explicitly check for API key in environment (Viper nested env binding is unreliable)
@@ -137,15 +623,110 @@ func Load(cfgFile string) (*Config, error) {
 			cfg.Provider.APIKey = key
 		}
 	}
+	if cfg.Search.APIKey == "" {
+		cfg.Search.APIKey = os.Getenv("BRAVE_API_KEY")
+	}
+
+	// Fail now, naming every key to fix, rather than when a setting is used
+	problems = append(problems, cfg.problems()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{File: v.ConfigFileUsed(), Problems: problems}
+	}
 
 	return cfg, nil
 }
 
+// newViper returns a viper reading cfgFile, or else config.yaml from the
+// current directory, the default work dir or /etc/igent
+func newViper(cfgFile string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigName("config")
+	v.SetConfigType("yaml")
+
+	if cfgFile != "" {
+		v.SetConfigFile(cfgFile)
+	} else {
+		// Check multiple locations
+		v.AddConfigPath(".")
+		v.AddConfigPath(DefaultConfig().Storage.WorkDir)
+		v.AddConfigPath("/etc/igent")
+	}
+	return v
+}
+
+// decode unmarshals the settings of v into cfg
+func decode(v *viper.Viper, cfg *Config) error {
+	return v.Unmarshal(cfg, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		dottedKeysHook,
+	)))
+}
+
+// dottedKeysHook undoes viper splitting map keys at dots, so maps keyed by
+// tool names such as mcp.github.search_issues (tools.confirm, tools.limits,
+// tools.aliases) decode with the names intact
+func dottedKeysHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	m, ok := data.(map[string]interface{})
+	if !ok || from.Kind() != reflect.Map || to.Kind() != reflect.Map || to.Key().Kind() != reflect.String {
+		return data, nil
+	}
+
+	// A value is a map only for struct elements, whose field names end
+	// the nesting
+	elem := to.Elem()
+	fields := map[string]bool{}
+	if elem.Kind() == reflect.Struct {
+		for i := 0; i < elem.NumField(); i++ {
+			fields[elem.Field(i).Tag.Get("mapstructure")] = true
+		}
+	} else if elem.Kind() == reflect.Map || elem.Kind() == reflect.Interface {
+		return data, nil
+	}
+	isValue := func(v interface{}) bool {
+		sub, ok := v.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		for k := range sub {
+			if !fields[k] {
+				return false
+			}
+		}
+		return len(fields) > 0
+	}
+
+	flat := make(map[string]interface{}, len(m))
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			if sub, ok := v.(map[string]interface{}); ok && !isValue(v) {
+				walk(k, sub)
+				continue
+			}
+			flat[k] = v
+		}
+	}
+	walk("", m)
+	return flat, nil
+}
+
 // EnsureWorkDir creates the working directory if it doesn't exist
 func (c *Config) EnsureWorkDir() error {
 	return os.MkdirAll(c.Storage.WorkDir, 0755)
 }
 
+// DaemonSocket returns the path of the unix socket igent daemon listens on
+func (c *Config) DaemonSocket() string {
+	if c.Daemon.Socket != "" {
+		return c.Daemon.Socket
+	}
+	return filepath.Join(c.Storage.WorkDir, "daemon.sock")
+}
+
 // ConfigPath returns the path to config file
 func (c *Config) ConfigPath() string {
 	return filepath.Join(c.Storage.WorkDir, "config.yaml")
@@ -157,37 +738,350 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	// Use a map with explicit keys to preserve snake_case
-	configMap := map[string]interface{}{
+	v := viper.New()
+	v.SetConfigFile(c.ConfigPath())
+	for key, value := range c.settings() {
+		v.Set(key, value)
+	}
+
+	return v.WriteConfig()
+}
+
+// SaveKeys writes the settings of dotted keys such as tools or
+// agent.system_prompt_files to the config file at path, keeping its other
+// settings. Unlike Save it writes nothing else, so values taken from the
+// environment, such as API keys, stay out of the file.
+func (c *Config) SaveKeys(path string, keys ...string) error {
+	file, err := readSettings(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		var value interface{} = c.settings()
+		for _, part := range parts {
+			section, ok := value.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unknown config key %q", key)
+			}
+			if value, ok = section[part]; !ok {
+				return fmt.Errorf("unknown config key %q", key)
+			}
+		}
+		m := file
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := m[part].(map[string]interface{})
+			if !ok {
+				sub = map[string]interface{}{}
+				m[part] = sub
+			}
+			m = sub
+		}
+		m[parts[len(parts)-1]] = value
+	}
+	return writeSettings(path, file, "")
+}
+
+// settings returns the config as Save writes it, with explicit keys to
+// preserve snake_case
+func (c *Config) settings() map[string]interface{} {
+	return map[string]interface{}{
 		"provider": map[string]interface{}{
 			"type":     c.Provider.Type,
 			"base_url": c.Provider.BaseURL,
 			"api_key":  c.Provider.APIKey,
 			"model":    c.Provider.Model,
+
+			"proxy":                c.Provider.Proxy,
+			"ca_cert_file":         c.Provider.CACertFile,
+			"insecure_skip_verify": c.Provider.InsecureSkipVerify,
+			"web_search":           c.Provider.WebSearch,
+			"prompt_cache":         c.Provider.PromptCache,
+			"max_concurrent":       c.Provider.MaxConcurrent,
+			"input_price":          c.Provider.InputPrice,
+			"output_price":         c.Provider.OutputPrice,
+			"compat": map[string]interface{}{
+				"roles":                       c.Provider.Compat.Roles,
+				"merge_tool_results":          c.Provider.Compat.MergeToolResults,
+				"disable_parallel_tool_calls": c.Provider.Compat.DisableParallelToolCalls,
+			},
+			"embedding_model": c.Provider.EmbeddingModel,
 		},
 		"storage": map[string]interface{}{
-			"work_dir": c.Storage.WorkDir,
+			"work_dir":       c.Storage.WorkDir,
+			"auto_artifacts": c.Storage.AutoArtifacts,
+			"backup_keep":    c.Storage.BackupKeep,
+
+			"retention_days":    c.Storage.RetentionDays,
+			"max_conversations": c.Storage.MaxConversations,
+			"retention_action":  c.Storage.RetentionAction,
+			"prune_relevance":   c.Storage.PruneRelevance,
+			"integrity_key":     c.Storage.IntegrityKey,
 		},
 		"context": map[string]interface{}{
 			"max_messages":   c.Context.MaxMessages,
 			"max_tokens":     c.Context.MaxTokens,
 			"summarize_when": c.Context.SummarizeWhen,
+
+			"tool_history_tokens": c.Context.ToolHistoryTokens,
+			"compress_snippets":   c.Context.CompressSnippets,
+			"compress_model":      c.Context.CompressModel,
+
+			"memory_top_k":          c.Context.MemoryTopK,
+			"memory_min_similarity": c.Context.MemoryMinSimilarity,
+		},
+		"memory": map[string]interface{}{
+			"summarize_when":     c.Memory.SummarizeWhen,
+			"keep_messages":      c.Memory.KeepMessages,
+			"summary_prompt":     c.Memory.SummaryPrompt,
+			"summary_max_tokens": c.Memory.SummaryMaxTokens,
+			"abstract_prompt":    c.Memory.AbstractPrompt,
+			"extract_memories":   c.Memory.ExtractMemories,
+			"extract_prompt":     c.Memory.ExtractPrompt,
+			"score_importance":   c.Memory.ScoreImportance,
+			"score_prompt":       c.Memory.ScorePrompt,
 		},
 		"agent": map[string]interface{}{
 			"name":          c.Agent.Name,
 			"system_prompt": c.Agent.SystemPrompt,
+
+			"system_prompt_files": c.Agent.SystemPromptFiles,
+
+			"max_response_tokens": c.Agent.MaxResponseTokens,
+			"bullet_points":       c.Agent.BulletPoints,
+			"code_only":           c.Agent.CodeOnly,
+			"show_reasoning":      c.Agent.ShowReasoning,
+			"show_usage":          c.Agent.ShowUsage,
+			"accessible":          c.Agent.Accessible,
+			"markdown":            c.Agent.Markdown,
+			"markdown_theme":      c.Agent.MarkdownTheme,
+
+			"max_run_iterations":     c.Agent.MaxRunIterations,
+			"pause_every_tool_calls": c.Agent.PauseEveryToolCalls,
+			"pause_every_cost":       c.Agent.PauseEveryCost,
+			"pause_at":               c.Agent.PauseAt,
+			"evaluate_runs":          c.Agent.EvaluateRuns,
+			"evaluator_model":        c.Agent.EvaluatorModel,
+			"evaluator_min_score":    c.Agent.EvaluatorMinScore,
+			"critique":               c.Agent.Critique,
+			"critique_model":         c.Agent.CritiqueModel,
+			"attachment_max_bytes":   c.Agent.AttachmentMaxBytes,
+			"attachment_model":       c.Agent.AttachmentModel,
+			"project_namespace":      c.Agent.ProjectNamespace,
+			"auto_title":             c.Agent.AutoTitle,
 		},
 		"logging": map[string]interface{}{
 			"level":  c.Logging.Level,
 			"format": c.Logging.Format,
 		},
+		"ui": map[string]interface{}{
+			"color":  c.UI.Color,
+			"theme":  c.UI.Theme,
+			"colors": c.UI.Colors,
+		},
+		"network": map[string]interface{}{
+			"allowed_hosts": c.Network.AllowedHosts,
+			"client_certs":  clientCertsMap(c.Network.ClientCerts),
+			"audit":         c.Network.Audit,
+		},
+		"search": map[string]interface{}{
+			"backend":     c.Search.Backend,
+			"url":         c.Search.URL,
+			"api_key":     c.Search.APIKey,
+			"max_results": c.Search.MaxResults,
+		},
+		"routing": map[string]interface{}{
+			"min_similarity": c.Routing.MinSimilarity,
+		},
+		"code": map[string]interface{}{
+			"backend":     c.Code.Backend,
+			"image":       c.Code.Image,
+			"timeout":     c.Code.Timeout,
+			"cpu_seconds": c.Code.CPUSeconds,
+			"memory_mb":   c.Code.MemoryMB,
+		},
+		"ssh": map[string]interface{}{
+			"hosts":            c.SSH.Hosts,
+			"user":             c.SSH.User,
+			"identity_files":   c.SSH.IdentityFiles,
+			"known_hosts_file": c.SSH.KnownHostsFile,
+			"timeout":          c.SSH.Timeout,
+		},
+		"tools": map[string]interface{}{
+			"enabled":  c.Tools.Enabled,
+			"disabled": c.Tools.Disabled,
+			"limits":   nestDottedKeys(toolLimitsMap(c.Tools.Limits)),
+			"confirm":  nestDottedKeys(c.Tools.Confirm),
+			"custom":   customToolsMap(c.Tools.Custom),
+			"aliases":  nestDottedKeys(c.Tools.Aliases),
+		},
+		"quota": map[string]interface{}{
+			"user":     c.Quota.User,
+			"per_user": quotaLimitsMap(c.Quota.PerUser),
+			"per_key":  quotaLimitsMap(c.Quota.PerKey),
+			"warn_at":  c.Quota.WarnAt,
+		},
+		"budget": map[string]interface{}{
+			"turn_tokens":         c.Budget.TurnTokens,
+			"conversation_tokens": c.Budget.ConversationTokens,
+			"daily_tokens":        c.Budget.DailyTokens,
+			"on_exceed":           c.Budget.OnExceed,
+		},
+		"sync": map[string]interface{}{
+			"backend": c.Sync.Backend,
+			"url":     c.Sync.URL,
+			"branch":  c.Sync.Branch,
+		},
+		"server": map[string]interface{}{
+			"addr":    c.Server.Addr,
+			"api_key": c.Server.APIKey,
+			"model":   c.Server.Model,
+		},
+		"daemon": map[string]interface{}{
+			"socket": c.Daemon.Socket,
+		},
+		"guardrails": map[string]interface{}{
+			"input":             guardrailRulesMap(c.Guardrails.Input),
+			"output":            guardrailRulesMap(c.Guardrails.Output),
+			"max_output_chars":  c.Guardrails.MaxOutputChars,
+			"moderation":        c.Guardrails.Moderation,
+			"moderation_policy": c.Guardrails.ModerationPolicy,
+		},
+		"tracing": map[string]interface{}{
+			"exporter":     c.Tracing.Exporter,
+			"endpoint":     c.Tracing.Endpoint,
+			"headers":      c.Tracing.Headers,
+			"file":         c.Tracing.File,
+			"service_name": c.Tracing.ServiceName,
+			"sample_ratio": c.Tracing.SampleRatio,
+		},
+		"profiles": profilesMap(c.Profiles),
+		"personas": personasMap(c.Personas),
 	}
+}
 
-	v := viper.New()
-	v.SetConfigFile(c.ConfigPath())
-	for key, value := range configMap {
-		v.Set(key, value)
+// nestDottedKeys nests the values of keys such as mcp.github.search_issues
+// the way viper reads them back; dottedKeysHook joins them again on Load
+func nestDottedKeys[V any](m map[string]V) map[string]interface{} {
+	nested := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		parts := strings.Split(key, ".")
+		level := nested
+		for _, part := range parts[:len(parts)-1] {
+			sub, ok := level[part].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				level[part] = sub
+			}
+			level = sub
+		}
+		level[parts[len(parts)-1]] = value
 	}
+	return nested
+}
 
-	return v.WriteConfig()
+// toolLimitsMap converts tool limits to snake_case maps for Save
+func toolLimitsMap(limits map[string]ToolLimitsConfig) map[string]interface{} {
+	m := make(map[string]interface{}, len(limits))
+	for name, l := range limits {
+		m[name] = map[string]interface{}{
+			"timeout":     l.Timeout,
+			"max_timeout": l.MaxTimeout,
+			"max_output":  l.MaxOutput,
+		}
+	}
+	return m
+}
+
+// customToolsMap converts custom tools to snake_case maps for Save
+func customToolsMap(custom []CustomToolConfig) []map[string]interface{} {
+	m := make([]map[string]interface{}, len(custom))
+	for i, t := range custom {
+		params := make([]map[string]interface{}, len(t.Parameters))
+		for j, p := range t.Parameters {
+			params[j] = map[string]interface{}{
+				"name":        p.Name,
+				"type":        p.Type,
+				"description": p.Description,
+				"required":    p.Required,
+				"enum":        p.Enum,
+				"default":     p.Default,
+			}
+		}
+		m[i] = map[string]interface{}{
+			"name":        t.Name,
+			"namespace":   t.Namespace,
+			"description": t.Description,
+			"parameters":  params,
+			"command":     t.Command,
+			"timeout":     t.Timeout,
+		}
+	}
+	return m
+}
+
+// quotaLimitsMap converts quota limits to a snake_case map for Save
+func quotaLimitsMap(l QuotaLimits) map[string]interface{} {
+	return map[string]interface{}{
+		"daily_tokens":   l.DailyTokens,
+		"monthly_tokens": l.MonthlyTokens,
+		"daily_cost":     l.DailyCost,
+		"monthly_cost":   l.MonthlyCost,
+	}
+}
+
+// profilesMap converts agent profiles to snake_case maps for Save
+func profilesMap(profiles map[string]ProfileConfig) map[string]interface{} {
+	m := make(map[string]interface{}, len(profiles))
+	for name, p := range profiles {
+		m[name] = map[string]interface{}{
+			"description":    p.Description,
+			"system_prompt":  p.SystemPrompt,
+			"model":          p.Model,
+			"tools":          p.Tools,
+			"disabled_tools": p.DisabledTools,
+			"confirm":        nestDottedKeys(p.Confirm),
+		}
+	}
+	return m
+}
+
+// personasMap converts personas to snake_case maps for Save
+func personasMap(personas map[string]PersonaConfig) map[string]interface{} {
+	m := make(map[string]interface{}, len(personas))
+	for name, p := range personas {
+		m[name] = map[string]interface{}{
+			"description":   p.Description,
+			"system_prompt": p.SystemPrompt,
+			"skills":        p.Skills,
+			"confirm":       nestDottedKeys(p.Confirm),
+		}
+	}
+	return m
+}
+
+// guardrailRulesMap converts guardrail rules to snake_case maps for Save
+func guardrailRulesMap(rules []GuardrailRule) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(rules))
+	for i, r := range rules {
+		result[i] = map[string]interface{}{
+			"name":    r.Name,
+			"pattern": r.Pattern,
+			"action":  r.Action,
+		}
+	}
+	return result
+}
+
+// clientCertsMap converts client certificates to snake_case maps for Save
+func clientCertsMap(certs []ClientCertConfig) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(certs))
+	for i, c := range certs {
+		result[i] = map[string]interface{}{
+			"host":      c.Host,
+			"cert_file": c.CertFile,
+			"key_file":  c.KeyFile,
+		}
+	}
+	return result
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -79,7 +81,42 @@ func TestSaveAndLoad(t *testing.T) {
 			Model:   "test-model",
 		},
 		Storage: StorageConfig{
-			WorkDir: tmpDir,
+			WorkDir:    tmpDir,
+			BackupKeep: 7,
+
+			RetentionDays:    90,
+			MaxConversations: 200,
+			RetentionAction:  "delete",
+			IntegrityKey:     "audit-key",
+		},
+		Sync: SyncConfig{
+			Backend: "git",
+			URL:     "git@example.com:me/igent-state.git",
+		},
+		Server: ServerConfig{
+			Addr:   ":9000",
+			APIKey: "secret",
+		},
+		Daemon: DaemonConfig{
+			Socket: "/run/user/1000/igent.sock",
+		},
+		Guardrails: GuardrailsConfig{
+			Input:            []GuardrailRule{{Name: "secrets", Pattern: `(?i)password\s*[:=]`, Action: "redact"}},
+			MaxOutputChars:   20000,
+			Moderation:       true,
+			ModerationPolicy: "No spoilers.",
+		},
+		Budget: BudgetConfig{
+			TurnTokens:         20000,
+			ConversationTokens: 500000,
+			OnExceed:           "refuse",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "otlp",
+			Endpoint:    "https://otel.example.com/v1/traces",
+			Headers:     map[string]string{"x-api-key": "secret"},
+			ServiceName: "igent-ci",
+			SampleRatio: 0.5,
 		},
 		Context: ContextConfig{
 			MaxMessages:   20,
@@ -87,8 +124,33 @@ func TestSaveAndLoad(t *testing.T) {
 			SummarizeWhen: 15,
 		},
 		Agent: AgentConfig{
-			Name:         "test-agent",
-			SystemPrompt: "Test prompt",
+			Name:               "test-agent",
+			SystemPrompt:       "Test prompt",
+			Critique:           "revise",
+			CritiqueModel:      "gpt-4o-mini",
+			AttachmentMaxBytes: 8000,
+			MarkdownTheme:      "dracula",
+		},
+		UI: UIConfig{
+			Color:  "never",
+			Theme:  "light",
+			Colors: map[string]string{"prompt": "bold blue"},
+		},
+		Profiles: map[string]ProfileConfig{
+			"reviewer": {
+				Description:  "Reviews diffs",
+				SystemPrompt: "You review code.",
+				Model:        "gpt-4o",
+				Tools:        []string{"git_*", "cat"},
+				Confirm:      map[string]string{"mcp.github.*": "deny"},
+			},
+		},
+		Personas: map[string]PersonaConfig{
+			"ops": {
+				SystemPrompt: "You keep services running.",
+				Skills:       []string{"summarize"},
+				Confirm:      map[string]string{"shell": "allow"},
+			},
 		},
 	}
 
@@ -108,4 +170,453 @@ func TestSaveAndLoad(t *testing.T) {
 	if loaded.Agent.Name != cfg.Agent.Name {
 		t.Errorf("expected agent name %s, got %s", cfg.Agent.Name, loaded.Agent.Name)
 	}
+	if loaded.Agent.Critique != "revise" || loaded.Agent.CritiqueModel != "gpt-4o-mini" {
+		t.Errorf("unexpected critique config: %q, %q", loaded.Agent.Critique, loaded.Agent.CritiqueModel)
+	}
+	if loaded.Budget.TurnTokens != 20000 || loaded.Budget.ConversationTokens != 500000 || loaded.Budget.DailyTokens != 0 || loaded.Budget.OnExceed != "refuse" {
+		t.Errorf("unexpected budget: %+v", loaded.Budget)
+	}
+	if loaded.Agent.Markdown || loaded.Agent.MarkdownTheme != "dracula" {
+		t.Errorf("unexpected markdown config: %v, %q", loaded.Agent.Markdown, loaded.Agent.MarkdownTheme)
+	}
+	if loaded.UI.Color != "never" || loaded.UI.Theme != "light" || loaded.UI.Colors["prompt"] != "bold blue" {
+		t.Errorf("unexpected ui config: %+v", loaded.UI)
+	}
+	if loaded.Agent.ShowUsage {
+		t.Error("expected show_usage off as saved, not the default")
+	}
+	if loaded.Agent.AttachmentMaxBytes != 8000 {
+		t.Errorf("expected 8000 attachment bytes, got %d", loaded.Agent.AttachmentMaxBytes)
+	}
+
+	if loaded.Storage.BackupKeep != 7 {
+		t.Errorf("expected 7 daily backups kept, got %d", loaded.Storage.BackupKeep)
+	}
+	if loaded.Storage.RetentionDays != 90 || loaded.Storage.MaxConversations != 200 || loaded.Storage.RetentionAction != "delete" || loaded.Storage.IntegrityKey != "audit-key" {
+		t.Errorf("unexpected retention: %+v", loaded.Storage)
+	}
+	if loaded.Sync.Backend != "git" || loaded.Sync.URL != cfg.Sync.URL {
+		t.Errorf("unexpected sync config: %+v", loaded.Sync)
+	}
+	if loaded.Server.Addr != ":9000" || loaded.Server.APIKey != "secret" {
+		t.Errorf("unexpected server config: %+v", loaded.Server)
+	}
+	if g := loaded.Guardrails; len(g.Input) != 1 || g.Input[0].Pattern != `(?i)password\s*[:=]` || g.Input[0].Action != "redact" ||
+		g.MaxOutputChars != 20000 || !g.Moderation || g.ModerationPolicy != "No spoilers." {
+		t.Errorf("unexpected guardrails config: %+v", loaded.Guardrails)
+	}
+	if tr := loaded.Tracing; tr.Exporter != "otlp" || tr.Endpoint != cfg.Tracing.Endpoint || tr.Headers["x-api-key"] != "secret" ||
+		tr.ServiceName != "igent-ci" || tr.SampleRatio != 0.5 {
+		t.Errorf("unexpected tracing config: %+v", loaded.Tracing)
+	}
+	if loaded.DaemonSocket() != "/run/user/1000/igent.sock" {
+		t.Errorf("unexpected daemon socket %q", loaded.DaemonSocket())
+	}
+	reviewer := loaded.Profiles["reviewer"]
+	if reviewer.Model != "gpt-4o" || reviewer.Description != "Reviews diffs" || len(reviewer.Tools) != 2 || reviewer.Confirm["mcp.github.*"] != "deny" {
+		t.Errorf("unexpected profiles: %+v", loaded.Profiles)
+	}
+	ops := loaded.Personas["ops"]
+	if ops.SystemPrompt != "You keep services running." || len(ops.Skills) != 1 || ops.Confirm["shell"] != "allow" {
+		t.Errorf("unexpected personas: %+v", loaded.Personas)
+	}
+}
+
+func TestSaveAndLoad_Network(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage.WorkDir = t.TempDir()
+	cfg.Network = NetworkConfig{
+		AllowedHosts: []string{"api.openai.com", "*.corp.example"},
+		ClientCerts:  []ClientCertConfig{{Host: "llm.corp.example", CertFile: "/c.pem", KeyFile: "/k.pem"}},
+		Audit:        true,
+	}
+
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	loaded, err := Load(cfg.ConfigPath())
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(loaded.Network.AllowedHosts) != 2 || loaded.Network.AllowedHosts[1] != "*.corp.example" {
+		t.Errorf("unexpected allowed hosts: %v", loaded.Network.AllowedHosts)
+	}
+	if len(loaded.Network.ClientCerts) != 1 || loaded.Network.ClientCerts[0].KeyFile != "/k.pem" {
+		t.Errorf("unexpected client certs: %+v", loaded.Network.ClientCerts)
+	}
+	if !loaded.Network.Audit {
+		t.Error("expected audit to be enabled")
+	}
+}
+
+func TestSaveKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("provider:\n  model: gpt-4o\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IGENT_API_KEY", "sk-from-env")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Agent.SystemPromptFiles = []string{"/prompts/team.md"}
+	cfg.Tools.Confirm = map[string]string{"shell": "deny"}
+
+	if err := cfg.SaveKeys(path, "agent.system_prompt_files", "tools"); err != nil {
+		t.Fatalf("SaveKeys failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-from-env") || strings.Contains(string(data), "api_key") {
+		t.Errorf("expected the API key from the environment left out:\n%s", data)
+	}
+	t.Setenv("IGENT_API_KEY", "")
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Provider.Model != "gpt-4o" || loaded.Provider.APIKey != "" {
+		t.Errorf("expected the other settings kept, got %+v", loaded.Provider)
+	}
+	if len(loaded.Agent.SystemPromptFiles) != 1 || loaded.Tools.Confirm["shell"] != "deny" {
+		t.Errorf("expected the saved keys written, got %v %v", loaded.Agent.SystemPromptFiles, loaded.Tools.Confirm)
+	}
+
+	if err := cfg.SaveKeys(path, "agent.nope"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestSaveAndLoad_CustomTools(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage.WorkDir = t.TempDir()
+	cfg.Tools.Custom = []CustomToolConfig{{
+		Name:        "deploy_status",
+		Description: "Show a service's rollout status",
+		Parameters: []CustomToolParamConfig{
+			{Name: "service", Required: true},
+			{Name: "env", Enum: []string{"staging", "prod"}, Default: "staging"},
+		},
+		Command: "kubectl -n ${env} rollout status deploy/${service}",
+		Timeout: 60,
+	}}
+
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	loaded, err := Load(cfg.ConfigPath())
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if len(loaded.Tools.Custom) != 1 {
+		t.Fatalf("unexpected custom tools: %+v", loaded.Tools.Custom)
+	}
+	tool := loaded.Tools.Custom[0]
+	if tool.Command != cfg.Tools.Custom[0].Command || tool.Timeout != 60 || len(tool.Parameters) != 2 {
+		t.Errorf("unexpected custom tool: %+v", tool)
+	}
+	if p := tool.Parameters[1]; p.Name != "env" || p.Default != "staging" || len(p.Enum) != 2 || p.Required {
+		t.Errorf("unexpected parameter: %+v", p)
+	}
+}
+
+func TestSaveAndLoad_Memory(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Storage.WorkDir = t.TempDir()
+	cfg.Memory.SummarizeWhen = 40
+	cfg.Memory.SummaryPrompt = "Fasse das Gespräch kurz zusammen."
+	cfg.Memory.ExtractMemories = true
+	cfg.Memory.AbstractPrompt = "Fasse die Zusammenfassungen zusammen."
+	cfg.Memory.ScoreImportance = true
+
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	loaded, err := Load(cfg.ConfigPath())
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if loaded.Memory != cfg.Memory || loaded.Memory.KeepMessages != 10 || loaded.Memory.SummaryMaxTokens != 500 {
+		t.Errorf("memory config = %+v, want %+v", loaded.Memory, cfg.Memory)
+	}
+}
+
+func TestLoad_DottedToolNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `tools:
+  confirm:
+    mcp.github.*: allow
+    git_commit: ask
+  limits:
+    mcp.github.search_issues:
+      timeout: 5
+    shell:
+      max_output: 100
+  aliases:
+    search: mcp.github.search_issues
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Tools.Confirm["mcp.github.*"] != "allow" || cfg.Tools.Confirm["git_commit"] != "ask" {
+		t.Errorf("unexpected confirm rules: %v", cfg.Tools.Confirm)
+	}
+	if cfg.Tools.Limits["mcp.github.search_issues"].Timeout != 5 || cfg.Tools.Limits["shell"].MaxOutput != 100 {
+		t.Errorf("unexpected limits: %+v", cfg.Tools.Limits)
+	}
+	if cfg.Tools.Aliases["search"] != "mcp.github.search_issues" {
+		t.Errorf("unexpected aliases: %v", cfg.Tools.Aliases)
+	}
+
+	// Saving and loading again keeps the names
+	cfg.Storage.WorkDir = dir
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	loaded, err := Load(cfg.ConfigPath())
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if loaded.Tools.Confirm["mcp.github.*"] != "allow" || loaded.Tools.Limits["mcp.github.search_issues"].Timeout != 5 {
+		t.Errorf("names lost in round trip: %v %+v", loaded.Tools.Confirm, loaded.Tools.Limits)
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Tools.Confirm = map[string]string{"shell": "ask", "git_*": "allow"}
+	cfg.Profiles = map[string]ProfileConfig{
+		"ops":   {SystemPrompt: "You run operations.", Model: "ops-model", Confirm: map[string]string{"shell": "allow"}},
+		"coder": {Tools: []string{"cat", "write_file"}, DisabledTools: []string{"shell"}},
+	}
+
+	ops, err := cfg.WithProfile("ops")
+	if err != nil {
+		t.Fatalf("WithProfile failed: %v", err)
+	}
+	if ops.Agent.SystemPrompt != "You run operations." || ops.Provider.Model != "ops-model" {
+		t.Errorf("profile settings not applied: %+v %+v", ops.Agent, ops.Provider)
+	}
+	if ops.Tools.Confirm["shell"] != "allow" || ops.Tools.Confirm["git_*"] != "allow" {
+		t.Errorf("unexpected merged confirm rules %v", ops.Tools.Confirm)
+	}
+	if cfg.Tools.Confirm["shell"] != "ask" || cfg.Provider.Model == "ops-model" {
+		t.Error("WithProfile must not change the original config")
+	}
+
+	coder, err := cfg.WithProfile("coder")
+	if err != nil {
+		t.Fatalf("WithProfile failed: %v", err)
+	}
+	if coder.Agent.SystemPrompt != cfg.Agent.SystemPrompt || len(coder.Tools.Enabled) != 2 || coder.Tools.Disabled[0] != "shell" {
+		t.Errorf("unexpected coder profile %+v", coder.Tools)
+	}
+
+	if _, err := cfg.WithProfile("reviewer"); err == nil || !strings.Contains(err.Error(), "coder, ops") {
+		t.Errorf("expected an error listing the profiles, got %v", err)
+	}
+}
+
+func TestSetKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("provider:\n  type: deepseek\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range map[string]string{
+		"provider.model":                         "gpt-4o",
+		"context.max_tokens":                     "8000",
+		"agent.markdown":                         "false",
+		"tools.disabled":                         "shell, ssh",
+		"tools.confirm.mcp.github.*":             "allow",
+		"tools.limits.mcp.github.search.timeout": "5",
+		"profiles.coder.model":                   "gpt-4o-mini",
+	} {
+		if err := SetKey(path, key, value); err != nil {
+			t.Fatalf("SetKey(%s) failed: %v", key, err)
+		}
+	}
+	for key, value := range map[string]string{
+		"context.max_tokens":  "many",
+		"context.max_tokns":   "5",
+		"context":             "5",
+		"agent.markdown":      "maybe",
+		"profiles.coder":      "x",
+		"tools.custom":        "x",
+		"provider.model.name": "x",
+	} {
+		if err := SetKey(path, key, value); err == nil {
+			t.Errorf("expected an error setting %s to %q", key, value)
+		}
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Provider.Type != "deepseek" || cfg.Provider.Model != "gpt-4o" || cfg.Context.MaxTokens != 8000 || cfg.Agent.Markdown {
+		t.Errorf("unexpected settings: %+v %+v", cfg.Provider, cfg.Context)
+	}
+	if strings.Join(cfg.Tools.Disabled, ",") != "shell,ssh" || cfg.Tools.Confirm["mcp.github.*"] != "allow" {
+		t.Errorf("unexpected tools: %+v", cfg.Tools)
+	}
+	if cfg.Tools.Limits["mcp.github.search"].Timeout != 5 || cfg.Profiles["coder"].Model != "gpt-4o-mini" {
+		t.Errorf("unexpected map entries: %+v %+v", cfg.Tools.Limits, cfg.Profiles)
+	}
+
+	for key, want := range map[string]string{
+		"provider.model":                         "gpt-4o",
+		"tools.disabled":                         "shell,ssh",
+		"tools.confirm.mcp.github.*":             "allow",
+		"tools.limits.mcp.github.search.timeout": "5",
+		"profiles.coder.model":                   "gpt-4o-mini",
+	} {
+		if got, err := cfg.Get(key); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+	if got, err := cfg.Get("context"); err != nil || !strings.Contains(got, "context.max_tokens: 8000\n") {
+		t.Errorf("expected the section's settings, got %q %v", got, err)
+	}
+	if _, err := cfg.Get("tools.confirm.shell"); err == nil {
+		t.Error("expected an error for an entry that is not set")
+	}
+
+	// Secrets are masked, alone or in their section
+	cfg.Provider.APIKey = "sk-secret"
+	cfg.Tracing.Headers = map[string]string{"authorization": "Bearer secret"}
+	for _, key := range []string{"provider.api_key", "provider", "tracing", "tracing.headers.authorization"} {
+		got, err := cfg.Get(key)
+		if err != nil || strings.Contains(got, "secret") {
+			t.Errorf("Get(%s) = %q, %v; want the secrets masked", key, got, err)
+		}
+	}
+	if got, _ := cfg.Get("provider"); !strings.Contains(got, "provider.api_key: (set, hidden)") || !strings.Contains(got, "provider.model: gpt-4o") {
+		t.Errorf("expected only the API key masked, got %q", got)
+	}
+	if got, _ := cfg.Get("server.api_key"); got != "" {
+		t.Errorf("expected an unset secret shown empty, got %q", got)
+	}
+
+	if removed, err := UnsetKey(path, "provider.model"); err != nil || !removed {
+		t.Fatalf("UnsetKey failed: %v %v", removed, err)
+	}
+	if removed, err := UnsetKey(path, "provider.model"); err != nil || removed {
+		t.Errorf("expected nothing to unset, got %v %v", removed, err)
+	}
+	cfg, _ = Load(path)
+	if cfg.Provider.Model != DefaultConfig().Provider.Model || cfg.Provider.Type != "deepseek" {
+		t.Errorf("expected the default model back, got %+v", cfg.Provider)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `provider:
+  modle: gpt-4o
+context:
+  max_messages: 20
+  summarize_when: 30
+  memory_min_similarity: 2
+logging:
+  level: verbose
+tools:
+  confirm:
+    shell: sometimes
+  limits:
+    shell:
+      timeout: -5
+ui:
+  colors:
+    prompt: blinking
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	if verr.File != path {
+		t.Errorf("expected the file in the error, got %q", verr.File)
+	}
+	for _, want := range []string{
+		`unknown config key "provider.modle"`,
+		"context.summarize_when (30) is more than context.max_messages (20)",
+		"context.memory_min_similarity is 2",
+		`logging.level is "verbose"`,
+		`tools.confirm.shell is "sometimes"`,
+		"tools.limits.shell.timeout is -5",
+		`ui.colors.prompt: unknown style "blinking"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+	if len(verr.Problems) != 7 {
+		t.Errorf("expected 7 problems, got %q", verr.Problems)
+	}
+
+	// Setting a key refuses values with problems, and fixes those it had
+	if err := SetKey(path, "context.max_messages", "10"); err == nil {
+		t.Error("expected an error for max_messages below summarize_when")
+	}
+	if err := SetKey(path, "context.summarize_when", "15"); err != nil {
+		t.Errorf("SetKey failed: %v", err)
+	}
+	if removed, err := UnsetKey(path, "provider.modle"); err != nil || !removed {
+		t.Errorf("expected the unknown key removed, got %v %v", removed, err)
+	}
+	_, err = Load(path)
+	if err == nil || strings.Contains(err.Error(), "summarize_when") || strings.Contains(err.Error(), "modle") {
+		t.Errorf("expected the fixed problems gone, got %v", err)
+	}
+
+	// Values are checked as the runtime reads them, so its spellings load
+	accepted := `agent:
+  critique: "on"
+storage:
+  retention_action: Archive
+budget:
+  on_exceed: Refuse
+tools:
+  confirm:
+    shell: " Deny"
+`
+	if err := os.WriteFile(path, []byte(accepted), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err != nil {
+		t.Errorf("expected the runtime's spellings accepted, got %v", err)
+	}
+}
+
+func TestValidateProvider(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+	if err := cfg.ValidateProvider(); err == nil || !strings.Contains(err.Error(), "provider.api_key") {
+		t.Errorf("expected a missing API key error, got %v", err)
+	}
+	cfg.Provider.APIKey = "key"
+	if err := cfg.ValidateProvider(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	cfg.Provider.Type = "openia"
+	if err := cfg.ValidateProvider(); err == nil {
+		t.Error("expected an error for an unknown provider type")
+	}
 }
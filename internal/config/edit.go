@@ -0,0 +1,373 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// FilePath returns the config file igent config set and unset edit: cfgFile,
+// else the file Load reads, else config.yaml in the default work dir
+func FilePath(cfgFile string) string {
+	v := newViper(cfgFile)
+	if err := v.ReadInConfig(); err == nil {
+		return v.ConfigFileUsed()
+	}
+	if cfgFile != "" {
+		return cfgFile
+	}
+	return DefaultConfig().ConfigPath()
+}
+
+// SetKey sets a dotted key such as provider.model in the config file at
+// path, keeping its other settings. The value is parsed as the key's type:
+// true/false, a number, or a comma-separated list.
+func SetKey(path, key, value string) error {
+	t, err := keyType(key)
+	if err != nil {
+		return err
+	}
+	parsed, err := parseValue(key, t, value)
+	if err != nil {
+		return err
+	}
+
+	settings, err := readSettings(path)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(key, ".")
+	m := settings
+	for _, part := range parts[:len(parts)-1] {
+		sub, ok := m[part].(map[string]interface{})
+		if !ok {
+			sub = map[string]interface{}{}
+			m[part] = sub
+		}
+		m = sub
+	}
+	m[parts[len(parts)-1]] = parsed
+	return writeSettings(path, settings, key)
+}
+
+// UnsetKey removes a dotted key from the config file at path, so its
+// default applies again; it reports whether the file set the key
+func UnsetKey(path, key string) (bool, error) {
+	settings, err := readSettings(path)
+	if err != nil {
+		return false, err
+	}
+	// Unknown keys the file has can be removed, to fix it
+	if !unset(settings, strings.Split(key, ".")) {
+		_, err := keyType(key)
+		return false, err
+	}
+	return true, writeSettings(path, settings, "")
+}
+
+// unset deletes a nested key from settings, and the sections it leaves
+// empty
+func unset(settings map[string]interface{}, parts []string) bool {
+	if len(parts) == 1 {
+		_, ok := settings[parts[0]]
+		delete(settings, parts[0])
+		return ok
+	}
+	sub, ok := settings[parts[0]].(map[string]interface{})
+	if !ok || !unset(sub, parts[1:]) {
+		return false
+	}
+	if len(sub) == 0 {
+		delete(settings, parts[0])
+	}
+	return true
+}
+
+// Get returns the value of a dotted key such as context.max_tokens as
+// igent config set takes it; a section such as context is returned as one
+// "key: value" line per setting. Secrets such as API keys are masked.
+func (c *Config) Get(key string) (string, error) {
+	if _, err := keyType(key); err != nil {
+		return "", err
+	}
+	v, secret, err := keyValue(reflect.ValueOf(c).Elem(), strings.Split(key, "."))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		var lines []string
+		flatten(key, v, secret, &lines)
+		sort.Strings(lines)
+		return strings.Join(lines, "\n"), nil
+	}
+	return formatSetting(v, secret), nil
+}
+
+// maskedValue stands in for a secret that is set
+const maskedValue = "(set, hidden)"
+
+// isSecret reports whether a config field holds a secret, such as an API
+// key, which is masked when settings are shown
+func isSecret(f reflect.StructField) bool {
+	return f.Tag.Get("secret") == "true"
+}
+
+// errNotSet is returned for a map entry the config doesn't have
+var errNotSet = errors.New("not set")
+
+// keyType resolves a dotted key to the type of the config field it sets.
+// Below a map the key names an entry, which may contain dots itself:
+// tools.confirm.mcp.github.* or tools.limits.shell.timeout.
+func keyType(key string) (reflect.Type, error) {
+	if key == "" {
+		return nil, errors.New("no key given")
+	}
+	t := reflect.TypeOf(Config{})
+	parts := strings.Split(key, ".")
+	for i := 0; i < len(parts); i++ {
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := fieldByTag(t, parts[i])
+			if !ok && i == 0 {
+				return nil, unknownKey(key, "", t)
+			}
+			if !ok {
+				return nil, unknownKey(key, strings.Join(parts[:i], ".")+" has", t)
+			}
+			t = f.Type
+		case reflect.Map:
+			if t.Elem().Kind() != reflect.Struct {
+				return t.Elem(), nil
+			}
+			j := entryEnd(t.Elem(), parts, i)
+			if j == len(parts) {
+				return nil, unknownKey(key, "entries of "+strings.Join(parts[:i], ".")+" have", t.Elem())
+			}
+			t, i = t.Elem(), j-1
+		default:
+			return nil, fmt.Errorf("unknown config key %q: %s has no keys", key, strings.Join(parts[:i], "."))
+		}
+	}
+	return t, nil
+}
+
+// keyValue walks a config value along the parts of a key keyType accepted;
+// it reports whether the value is or holds a secret
+func keyValue(v reflect.Value, parts []string) (reflect.Value, bool, error) {
+	secret := false
+	for i := 0; i < len(parts); i++ {
+		switch v.Kind() {
+		case reflect.Struct:
+			f, _ := fieldByTag(v.Type(), parts[i])
+			v = v.FieldByIndex(f.Index)
+			secret = secret || isSecret(f)
+		case reflect.Map:
+			j := len(parts)
+			if v.Type().Elem().Kind() == reflect.Struct {
+				j = entryEnd(v.Type().Elem(), parts, i)
+			}
+			v = v.MapIndex(reflect.ValueOf(strings.Join(parts[i:j], ".")))
+			if !v.IsValid() {
+				return reflect.Value{}, false, errNotSet
+			}
+			i = j - 1
+		}
+	}
+	return v, secret, nil
+}
+
+// entryEnd returns where the name of a map entry starting at parts[i]
+// ends: at the first field of the entry's struct after it
+func entryEnd(elem reflect.Type, parts []string, i int) int {
+	j := i + 1
+	for j < len(parts) && !hasField(elem, parts[j]) {
+		j++
+	}
+	return j
+}
+
+// parseValue converts the text of a value to the type of key
+func parseValue(key string, t reflect.Type, value string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return value, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not true or false", key, value)
+		}
+		return b, nil
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a whole number", key, value)
+		}
+		return n, nil
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a number", key, value)
+		}
+		return f, nil
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s is a list of entries; edit them in the config file", key)
+		}
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	case reflect.Struct:
+		return nil, fmt.Errorf("%s is a section; set one of its keys, such as %s.%s", key, key, tagNames(t)[0])
+	case reflect.Map:
+		return nil, fmt.Errorf("%s is a map; set one entry, such as %s.<name>", key, key)
+	}
+	return nil, fmt.Errorf("%s cannot be set from the command line", key)
+}
+
+// readSettings reads the config file at path; a missing file has no
+// settings
+func readSettings(path string) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	return v.AllSettings(), nil
+}
+
+// writeSettings writes settings to the config file at path. With a key set,
+// it refuses settings with problems involving that key; problems elsewhere
+// in the file are left for igent config validate to report.
+func writeSettings(path string, settings map[string]interface{}, key string) error {
+	if key != "" {
+		problems := settingsProblems(settings)
+		var ours []string
+		for _, problem := range problems {
+			if strings.Contains(problem, key) {
+				ours = append(ours, problem)
+			}
+		}
+		if len(ours) > 0 {
+			return &ValidationError{Problems: ours}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return settingsViper(path, settings).WriteConfig()
+}
+
+// settingsProblems validates the config settings of a file
+func settingsProblems(settings map[string]interface{}) []string {
+	problems := unknownKeys(settings)
+	cfg := DefaultConfig()
+	if err := decode(settingsViper("", settings), cfg); err != nil {
+		return append(problems, decodeProblems(err)...)
+	}
+	return append(problems, cfg.problems()...)
+}
+
+// settingsViper returns a viper holding settings, writing to path
+func settingsViper(path string, settings map[string]interface{}) *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	for key, value := range settings {
+		v.Set(key, value)
+	}
+	return v
+}
+
+// fieldByTag finds the field of a config struct with a mapstructure name
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.Tag.Get("mapstructure") == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func hasField(t reflect.Type, name string) bool {
+	_, ok := fieldByTag(t, name)
+	return ok
+}
+
+// tagNames lists the keys of a config struct
+func tagNames(t reflect.Type) []string {
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, t.Field(i).Tag.Get("mapstructure"))
+	}
+	return names
+}
+
+// unknownKey is the error for a key not in a section, listing the keys it
+// has; in is e.g. "context has", empty for the top level
+func unknownKey(key, in string, section reflect.Type) error {
+	names := tagNames(section)
+	sort.Strings(names)
+	if in == "" {
+		return fmt.Errorf("unknown config key %q (sections: %s)", key, strings.Join(names, ", "))
+	}
+	return fmt.Errorf("unknown config key %q (%s %s)", key, in, strings.Join(names, ", "))
+}
+
+// flatten appends a "key: value" line for every setting in a section or
+// map, masking the values of secrets
+func flatten(prefix string, v reflect.Value, secret bool, lines *[]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			flatten(prefix+"."+f.Tag.Get("mapstructure"), v.Field(i), secret || isSecret(f), lines)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			flatten(prefix+"."+iter.Key().String(), iter.Value(), secret, lines)
+		}
+	default:
+		*lines = append(*lines, prefix+": "+formatSetting(v, secret))
+	}
+}
+
+// formatSetting is formatValue, with secrets that are set masked
+func formatSetting(v reflect.Value, secret bool) string {
+	if secret && !v.IsZero() {
+		return maskedValue
+	}
+	return formatValue(v)
+}
+
+// formatValue formats a setting the way igent config set parses it
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.String {
+		return fmt.Sprintf("(%d entries)", v.Len())
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
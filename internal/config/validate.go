@@ -0,0 +1,227 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/igm/igent/internal/render"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ProviderTypes are the values provider.type accepts
+var ProviderTypes = []string{"openai", "anthropic", "zhipu", "glm", "deepseek", "moonshot"}
+
+// ValidationError lists everything wrong with a config, each problem naming
+// the key to fix
+type ValidationError struct {
+	File     string // Config file the settings came from, if any
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	header := "invalid config"
+	if e.File != "" {
+		header += " in " + e.File
+	}
+	return header + ":\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks that the settings make sense together: known values for
+// choices such as logging.level, numbers within their range and context
+// limits that agree. The API key is checked by ValidateProvider, as only
+// commands that call the model need one.
+func (c *Config) Validate() error {
+	if problems := c.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateProvider checks that the provider can be called: a known type
+// with an API key
+func (c *Config) ValidateProvider() error {
+	if !slices.Contains(ProviderTypes, c.Provider.Type) {
+		return fmt.Errorf("provider.type %q is not one of %s", c.Provider.Type, strings.Join(ProviderTypes, ", "))
+	}
+	if c.Provider.APIKey == "" {
+		return fmt.Errorf("no API key for provider %s: run igent config set provider.api_key <key>, or set IGENT_API_KEY", c.Provider.Type)
+	}
+	return nil
+}
+
+// problems lists what Validate reports
+func (c *Config) problems() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	oneOf := func(key, value string, choices ...string) {
+		if !slices.Contains(choices, value) {
+			add("%s is %q, want one of %s", key, value, strings.Join(choices, ", "))
+		}
+	}
+	optional := func(key, value string, choices ...string) {
+		if value != "" {
+			oneOf(key, value, choices...)
+		}
+	}
+	fraction := func(key string, value float64) {
+		if value < 0 || value > 1 {
+			add("%s is %v, want a value from 0 to 1", key, value)
+		}
+	}
+
+	negatives(reflect.ValueOf(*c), "", add)
+
+	oneOf("provider.type", c.Provider.Type, ProviderTypes...)
+	optional("logging.level", strings.ToLower(c.Logging.Level), "debug", "info", "warn", "error")
+	optional("logging.format", strings.ToLower(c.Logging.Format), "text", "json")
+	optional("ui.color", strings.ToLower(c.UI.Color), "auto", "always", "never")
+	optional("ui.theme", strings.ToLower(c.UI.Theme), "auto", "dark", "light")
+	for _, role := range sortedKeys(c.UI.Colors) {
+		if !slices.Contains(render.ThemeRoles, strings.ToLower(role)) {
+			add("ui.colors.%s is not a style, want one of %s", role, strings.Join(render.ThemeRoles, ", "))
+		} else if _, err := render.ParseStyle(c.UI.Colors[role]); err != nil {
+			add("ui.colors.%s: %v", role, err)
+		}
+	}
+
+	ctx := c.Context
+	if ctx.MaxMessages == 0 {
+		add("context.max_messages is 0: no messages would be kept; the default is %d", DefaultConfig().Context.MaxMessages)
+	}
+	if ctx.MaxTokens == 0 {
+		add("context.max_tokens is 0: the context would be empty; the default is %d", DefaultConfig().Context.MaxTokens)
+	}
+	if ctx.SummarizeWhen > ctx.MaxMessages && ctx.MaxMessages > 0 {
+		add("context.summarize_when (%d) is more than context.max_messages (%d): messages would be dropped before they are summarized", ctx.SummarizeWhen, ctx.MaxMessages)
+	}
+	if c.Memory.SummarizeWhen > ctx.MaxMessages && ctx.MaxMessages > 0 {
+		add("memory.summarize_when (%d) is more than context.max_messages (%d): messages would be dropped before they are summarized", c.Memory.SummarizeWhen, ctx.MaxMessages)
+	}
+	summarizeWhen := ctx.SummarizeWhen
+	if c.Memory.SummarizeWhen > 0 {
+		summarizeWhen = c.Memory.SummarizeWhen
+	}
+	if summarizeWhen > 0 && c.Memory.KeepMessages >= summarizeWhen {
+		add("memory.keep_messages (%d) is not less than the summarize_when threshold (%d): nothing would be summarized", c.Memory.KeepMessages, summarizeWhen)
+	}
+	optional("context.compress_snippets", strings.ToLower(ctx.CompressSnippets), "off", "light", "medium", "aggressive", "llm")
+	fraction("context.memory_min_similarity", ctx.MemoryMinSimilarity)
+	fraction("routing.min_similarity", c.Routing.MinSimilarity)
+	fraction("storage.prune_relevance", c.Storage.PruneRelevance)
+	fraction("quota.warn_at", c.Quota.WarnAt)
+	fraction("tracing.sample_ratio", c.Tracing.SampleRatio)
+	if c.Agent.EvaluatorMinScore > 10 {
+		add("agent.evaluator_min_score is %d, want a score out of 10", c.Agent.EvaluatorMinScore)
+	}
+
+	// Compared as the settings are read at runtime: case-insensitively, and
+	// with every alias agent.ParseCritiqueMode accepts
+	optional("storage.retention_action", strings.ToLower(c.Storage.RetentionAction), "archive", "delete")
+	optional("agent.critique", strings.ToLower(strings.TrimSpace(c.Agent.Critique)), "off", "false", "no", "note", "on", "true", "yes", "revise")
+	optional("budget.on_exceed", strings.ToLower(c.Budget.OnExceed), "ask", "refuse")
+	optional("search.backend", c.Search.Backend, "searxng", "brave", "duckduckgo")
+	optional("code.backend", c.Code.Backend, "process", "docker")
+	optional("sync.backend", c.Sync.Backend, "git")
+	optional("tracing.exporter", c.Tracing.Exporter, "otlp", "file")
+	if c.Search.Backend == "searxng" && c.Search.URL == "" {
+		add("search.backend is searxng but search.url is empty: set the URL of the SearxNG instance")
+	}
+	if c.Sync.Backend != "" && c.Sync.URL == "" {
+		add("sync.backend is %s but sync.url is empty: set the repository to sync with", c.Sync.Backend)
+	}
+
+	for _, tool := range sortedKeys(c.Tools.Confirm) {
+		oneOf("tools.confirm."+tool, strings.ToLower(strings.TrimSpace(c.Tools.Confirm[tool])), "allow", "ask", "deny")
+	}
+	for i, tool := range c.Tools.Custom {
+		if tool.Name == "" || tool.Command == "" {
+			add("tools.custom[%d] needs a name and a command", i)
+		}
+	}
+	for key, rules := range map[string][]GuardrailRule{"guardrails.input": c.Guardrails.Input, "guardrails.output": c.Guardrails.Output} {
+		for i, rule := range rules {
+			optional(fmt.Sprintf("%s[%d].action", key, i), rule.Action, "block", "redact", "warn")
+			if rule.Pattern == "" {
+				add("%s[%d] has no pattern", key, i)
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// negatives reports the numbers of a config section that are negative, as
+// no setting gives a negative number a meaning
+func negatives(v reflect.Value, prefix string, add func(string, ...interface{})) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			key := v.Type().Field(i).Tag.Get("mapstructure")
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			negatives(v.Field(i), key, add)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			negatives(iter.Value(), prefix+"."+iter.Key().String(), add)
+		}
+	case reflect.Int:
+		if v.Int() < 0 {
+			add("%s is %d, want 0 or more", prefix, v.Int())
+		}
+	case reflect.Float64:
+		if v.Float() < 0 {
+			add("%s is %v, want 0 or more", prefix, v.Float())
+		}
+	}
+}
+
+// decodeProblems lists the errors of decoding settings, one per key
+func decodeProblems(err error) []string {
+	var decodeErr *mapstructure.Error
+	if errors.As(err, &decodeErr) {
+		return decodeErr.Errors
+	}
+	return []string{err.Error()}
+}
+
+// unknownKeys reports the keys of config file settings that no field reads
+func unknownKeys(settings map[string]interface{}) []string {
+	var problems []string
+	var walk func(prefix string, m map[string]interface{})
+	walk = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+				walk(key, sub)
+				continue
+			}
+			if _, err := keyType(key); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	walk("", settings)
+	sort.Strings(problems)
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
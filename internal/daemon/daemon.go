@@ -0,0 +1,408 @@
+// Package daemon keeps an agent running in the background and answers
+// igent's one-shot prompts over a unix socket, so they skip loading the
+// config, storage, skills and provider on every run. Tool confirmations are
+// asked on the client's terminal and the tools run in its working
+// directory, so a prompt behaves as if igent had answered it itself.
+//
+// The protocol is one JSON object per line: the client sends a Request,
+// the daemon answers with Messages until one is Done. While a chat runs,
+// the client answers each Confirm message with a ToolReply.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/logger"
+	"github.com/igm/igent/internal/sched"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+)
+
+// Request types
+const (
+	RequestChat   = "chat"   // Answer a prompt
+	RequestStatus = "status" // Report on the daemon
+	RequestStop   = "stop"   // Shut the daemon down
+)
+
+// maxLineBytes bounds a line of the protocol
+const maxLineBytes = 16 << 20
+
+// ErrNotRunning is returned by the client when no daemon listens on the
+// socket
+var ErrNotRunning = errors.New("igent daemon is not running")
+
+// Request is the first line a client sends
+type Request struct {
+	Type         string `json:"type"`
+	Conversation string `json:"conversation,omitempty"`
+	Prompt       string `json:"prompt,omitempty"`
+	Dir          string `json:"dir,omitempty"` // Working directory of the client; tools run there
+}
+
+// Message is a line the daemon sends
+type Message struct {
+	Chunk    string            `json:"chunk,omitempty"`    // Streamed text of the answer
+	Warning  string            `json:"warning,omitempty"`  // Warning for the user, such as a quota nearly used
+	Confirm  *tools.ToolCall   `json:"confirm,omitempty"`  // Tool call the client must answer with a ToolReply
+	Status   *Status           `json:"status,omitempty"`   // Answer to a status request
+	Response string            `json:"response,omitempty"` // Final answer
+	Result   *agent.ChatResult `json:"result,omitempty"`   // Metadata of the turn, with the final answer
+	Error    string            `json:"error,omitempty"`
+	Partial  bool              `json:"partial,omitempty"` // The error cut off an answer that /continue can resume
+	Done     bool              `json:"done,omitempty"`    // Last message of the request
+}
+
+// ToolReply answers a Confirm message
+type ToolReply struct {
+	Answer agent.ToolAnswer `json:"answer"`
+}
+
+// Status reports on a running daemon
+type Status struct {
+	PID          int       `json:"pid"`
+	Started      time.Time `json:"started"`
+	Requests     int       `json:"requests"`               // Chats answered
+	Conversation string    `json:"conversation,omitempty"` // Of the last chat
+
+	// Queues holds the provider queue metrics by priority name
+	Queues map[string]sched.Stats `json:"queues,omitempty"`
+}
+
+// Error is a failed chat, as reported by the daemon
+type Error struct {
+	Message string
+	Partial bool // The answer was cut off; /continue resumes it
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Server answers requests with the agent
+type Server struct {
+	agent   *agent.Agent
+	log     *slog.Logger
+	started time.Time
+	stop    context.CancelFunc
+
+	// The agent works on one conversation, in one working directory, at a
+	// time, so chats are answered one after the other
+	mu           sync.Mutex
+	requests     int
+	conversation string
+}
+
+// New creates a server for ag
+func New(ag *agent.Agent) *Server {
+	return &Server{
+		agent:   ag,
+		log:     logger.L().With("component", "daemon"),
+		started: time.Now(),
+	}
+}
+
+// Listen listens on the unix socket at path, which only the user may
+// connect to. A socket left behind by a daemon that died is replaced; one
+// a daemon still answers on is an error.
+func Listen(path string) (net.Listener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("igent daemon is already running on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("removing stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Serve answers connections on ln until ctx is done or a client asks the
+// daemon to stop. ln is closed when Serve returns.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ctx, s.stop = context.WithCancel(ctx)
+	defer s.stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle answers the request of a connection
+func (s *Server) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	enc := json.NewEncoder(conn)
+
+	var req Request
+	if !scanner.Scan() {
+		return
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+		enc.Encode(Message{Error: "invalid request: " + err.Error(), Done: true})
+		return
+	}
+
+	switch req.Type {
+	case RequestChat:
+		s.chat(ctx, req, scanner, enc)
+	case RequestStatus:
+		s.mu.Lock()
+		status := &Status{PID: os.Getpid(), Started: s.started, Requests: s.requests, Conversation: s.conversation}
+		s.mu.Unlock()
+		status.Queues = make(map[string]sched.Stats)
+		for p, stats := range s.agent.QueueStats() {
+			status.Queues[p.String()] = stats
+		}
+		enc.Encode(Message{Status: status, Done: true})
+	case RequestStop:
+		s.log.Info("stop requested")
+		enc.Encode(Message{Done: true})
+		s.stop()
+	default:
+		enc.Encode(Message{Error: fmt.Sprintf("unknown request type %q", req.Type), Done: true})
+	}
+}
+
+// chat answers a prompt in the requested conversation and working
+// directory. The turn is cancelled if the client goes away.
+func (s *Server) chat(ctx context.Context, req Request, scanner *bufio.Scanner, enc *json.Encoder) {
+	var sendMu sync.Mutex
+	send := func(m Message) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return enc.Encode(m)
+	}
+	fail := func(err error) {
+		var partial *agent.PartialResponseError
+		send(Message{Error: err.Error(), Partial: errors.As(err, &partial), Done: true})
+	}
+	if err := storage.ValidateConversationID(req.Conversation); err != nil {
+		fail(err)
+		return
+	}
+	if req.Prompt == "" {
+		fail(errors.New("the prompt is empty"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Dir != "" {
+		restore, err := chdir(req.Dir)
+		if err != nil {
+			fail(err)
+			return
+		}
+		defer restore()
+	}
+	if err := s.agent.SetConversation(req.Conversation); err != nil {
+		fail(err)
+		return
+	}
+	s.requests++
+	s.conversation = req.Conversation
+	s.log.Info("chat", "conversation", req.Conversation, "dir", req.Dir)
+
+	// Tool replies are the only lines the client sends from now on; when
+	// it hangs up, the turn is cancelled
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	replies := make(chan ToolReply)
+	go func() {
+		defer cancel()
+		for scanner.Scan() {
+			var reply ToolReply
+			if json.Unmarshal(scanner.Bytes(), &reply) != nil {
+				return
+			}
+			select {
+			case replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.agent.ResetToolSession()
+	s.agent.SetToolPrompt(func(call *tools.ToolCall) agent.ToolAnswer {
+		if send(Message{Confirm: call}) != nil {
+			return agent.ToolAnswerNo
+		}
+		select {
+		case reply := <-replies:
+			return reply.Answer
+		case <-ctx.Done():
+			return agent.ToolAnswerNo
+		}
+	})
+	s.agent.SetWarningHandler(func(msg string) { send(Message{Warning: msg}) })
+
+	// @path references name files in the client's directory, where the
+	// daemon is now
+	prompt, err := s.agent.ExpandAttachments(ctx, req.Prompt)
+	if err != nil {
+		fail(err)
+		return
+	}
+	result, err := s.agent.ChatStream(ctx, prompt, func(chunk string) {
+		send(Message{Chunk: chunk})
+	})
+	if err != nil {
+		s.log.Warn("chat failed", "conversation", req.Conversation, "error", err)
+		fail(err)
+		return
+	}
+	send(Message{Response: result.Content, Result: result, Done: true})
+}
+
+// chdir changes the working directory of the daemon for a request and
+// returns the function changing it back
+func chdir(dir string) (func(), error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return nil, fmt.Errorf("changing to the client's directory: %w", err)
+	}
+	return func() { os.Chdir(wd) }, nil
+}
+
+// ChatHandlers receive what the daemon sends while it answers a prompt
+type ChatHandlers struct {
+	OnChunk   func(string)
+	OnWarning func(string)
+	Confirm   agent.ToolPromptFunc // Asks the user about a tool call; nil denies every call
+}
+
+// Chat sends a prompt to the daemon on the socket and returns its answer
+// with the turn's metadata. It returns ErrNotRunning if no daemon listens
+// there, and an *Error if the daemon failed to answer.
+func Chat(ctx context.Context, socket string, req Request, h ChatHandlers) (*agent.ChatResult, error) {
+	req.Type = RequestChat
+	var result *agent.ChatResult
+	err := roundTrip(ctx, socket, req, func(m *Message, enc *json.Encoder) error {
+		switch {
+		case m.Confirm != nil:
+			answer := agent.ToolAnswerNo
+			if h.Confirm != nil {
+				answer = h.Confirm(m.Confirm)
+			}
+			return enc.Encode(ToolReply{Answer: answer})
+		case m.Warning != "" && h.OnWarning != nil:
+			h.OnWarning(m.Warning)
+		case m.Chunk != "" && h.OnChunk != nil:
+			h.OnChunk(m.Chunk)
+		case m.Done:
+			result = m.Result
+			if result == nil {
+				result = &agent.ChatResult{Content: m.Response}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Ping asks the daemon on the socket how it is doing
+func Ping(ctx context.Context, socket string) (*Status, error) {
+	var status *Status
+	err := roundTrip(ctx, socket, Request{Type: RequestStatus}, func(m *Message, _ *json.Encoder) error {
+		status = m.Status
+		return nil
+	})
+	if err == nil && status == nil {
+		err = errors.New("the daemon sent no status")
+	}
+	return status, err
+}
+
+// Stop asks the daemon on the socket to shut down
+func Stop(ctx context.Context, socket string) error {
+	return roundTrip(ctx, socket, Request{Type: RequestStop}, func(*Message, *json.Encoder) error { return nil })
+}
+
+// roundTrip sends a request and hands each message to fn until the daemon
+// is done
+func roundTrip(ctx context.Context, socket string, req Request, fn func(m *Message, enc *json.Encoder) error) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ECONNREFUSED) {
+			return ErrNotRunning
+		}
+		return fmt.Errorf("connecting to igent daemon: %w", err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	enc := json.NewEncoder(conn)
+	if err := enc.Encode(req); err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for scanner.Scan() {
+		var m Message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return fmt.Errorf("invalid message from igent daemon: %w", err)
+		}
+		if err := fn(&m, enc); err != nil {
+			return err
+		}
+		if m.Done {
+			if m.Error != "" {
+				return &Error{Message: m.Error, Partial: m.Partial}
+			}
+			return nil
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading from igent daemon: %w", err)
+	}
+	return errors.New("igent daemon closed the connection")
+}
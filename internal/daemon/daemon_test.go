@@ -0,0 +1,156 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/tools"
+	"github.com/igm/igent/pkg/igenttest"
+)
+
+func startDaemon(t *testing.T, replies ...igenttest.Reply) (string, *igenttest.Harness, <-chan error) {
+	t.Helper()
+	h := igenttest.New(t, replies...)
+	socket := filepath.Join(t.TempDir(), "daemon.sock")
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- New(h.Agent).Serve(ctx, ln) }()
+	t.Cleanup(cancel)
+	return socket, h, done
+}
+
+func TestChat(t *testing.T) {
+	socket, h, done := startDaemon(t,
+		igenttest.Call("remove", map[string]interface{}{"path": "old.txt"}),
+		igenttest.Text("Removed old.txt"),
+		igenttest.Call("remove", map[string]interface{}{"path": "older.txt"}),
+		igenttest.Text("Removed older.txt"),
+	)
+	h.WriteFile("old.txt", "x")
+	h.WriteFile("older.txt", "x")
+
+	if _, err := Listen(socket); err == nil {
+		t.Error("expected a second daemon on the socket to fail")
+	}
+
+	var confirmed []string
+	handlers := ChatHandlers{Confirm: func(call *tools.ToolCall) agent.ToolAnswer {
+		confirmed = append(confirmed, call.Name+" "+call.Args["path"].(string))
+		return agent.ToolAnswerAlways
+	}}
+	var streamed string
+	handlers.OnChunk = func(chunk string) { streamed += chunk }
+
+	// Relative paths resolve in the client's directory
+	req := Request{Conversation: "work", Prompt: "remove old.txt", Dir: h.Workspace}
+	result, err := Chat(context.Background(), socket, req, handlers)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if result.Content != "Removed old.txt" || streamed != result.Content {
+		t.Errorf("unexpected answer %q, streamed %q", result.Content, streamed)
+	}
+	if len(result.ToolCalls) != 1 || result.Model == "" {
+		t.Errorf("expected the turn's metadata, got %+v", result)
+	}
+	if _, err := os.Stat(h.Path("old.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected old.txt removed in the workspace, got %v", err)
+	}
+
+	// "Always" lasts for one client only
+	req.Prompt = "remove older.txt"
+	if _, err := Chat(context.Background(), socket, req, handlers); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if len(confirmed) != 2 || confirmed[1] != "remove older.txt" {
+		t.Errorf("expected a confirmation per client, got %v", confirmed)
+	}
+	if messages := h.Conversation("work"); len(messages) != 8 {
+		t.Errorf("expected both turns in work, got %d messages", len(messages))
+	}
+	h.AssertScriptDone()
+
+	status, err := Ping(context.Background(), socket)
+	if err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if status.PID != os.Getpid() || status.Requests != 2 || status.Conversation != "work" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if calls := status.Queues["interactive"].Calls; calls < 2 {
+		t.Errorf("expected the chats' provider calls in the queue metrics, got %+v", status.Queues)
+	}
+
+	if err := Stop(context.Background(), socket); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the daemon did not stop")
+	}
+	if _, err := Ping(context.Background(), socket); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning after stop, got %v", err)
+	}
+}
+
+func TestChat_Attachments(t *testing.T) {
+	socket, h, _ := startDaemon(t, igenttest.Text("It greets"))
+	h.WriteFile("main.go", "package main // hello from main")
+
+	req := Request{Conversation: "work", Prompt: "explain @main.go", Dir: h.Workspace}
+	if _, err := Chat(context.Background(), socket, req, ChatHandlers{}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	requests := h.Provider.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected one provider call, got %d", len(requests))
+	}
+	messages := requests[0].Messages
+	if last := messages[len(messages)-1]; !strings.Contains(last.Content, "hello from main") {
+		t.Errorf("expected main.go attached from the client's directory, got %q", last.Content)
+	}
+
+	req.Prompt = "explain @missing.go"
+	h.Provider.Add(igenttest.Text("Nothing there"))
+	if _, err := Chat(context.Background(), socket, req, ChatHandlers{}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+}
+
+func TestChat_Errors(t *testing.T) {
+	socket, _, _ := startDaemon(t, igenttest.Fail(errors.New("provider down")))
+
+	tests := []struct {
+		name string
+		req  Request
+	}{
+		{"bad conversation", Request{Conversation: "../x", Prompt: "Hi"}},
+		{"empty prompt", Request{Conversation: "work"}},
+		{"provider error", Request{Conversation: "work", Prompt: "Hi"}},
+	}
+	for _, tt := range tests {
+		_, err := Chat(context.Background(), socket, tt.req, ChatHandlers{})
+		var derr *Error
+		if !errors.As(err, &derr) || derr.Message == "" {
+			t.Errorf("%s: expected a daemon error, got %v", tt.name, err)
+		}
+	}
+
+	if _, err := Chat(context.Background(), filepath.Join(t.TempDir(), "none.sock"), tests[2].req, ChatHandlers{}); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning without a daemon, got %v", err)
+	}
+}
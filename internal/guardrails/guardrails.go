@@ -0,0 +1,218 @@
+// Package guardrails screens user input and model output against configured
+// rules before the model sees the input, tools run or text is shown:
+// regular expression blocklists that block, redact or only warn, a cap on
+// the size of answers, and optional moderation by a model.
+package guardrails
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Action is what a rule does with text it matches
+type Action string
+
+const (
+	ActionBlock    Action = "block"    // Stop the input, tool call or answer
+	ActionRedact   Action = "redact"   // Replace the matched text
+	ActionWarn     Action = "warn"     // Only record the match
+	ActionTruncate Action = "truncate" // Cut an answer over the size limit
+)
+
+// Stage is the point at which text is screened
+type Stage string
+
+const (
+	StageInput    Stage = "input"     // User input, before the model sees it
+	StageToolCall Stage = "tool_call" // Tool call arguments, before the tool runs
+	StageOutput   Stage = "output"    // An answer, before it is shown
+)
+
+// Built-in rule names
+const (
+	RuleMaxOutput  = "max_output_chars"
+	RuleModeration = "moderation"
+)
+
+// Rule is a regular expression rule
+type Rule struct {
+	Name    string
+	Pattern string
+	Action  Action // Empty blocks
+}
+
+// Config configures a Guard
+type Config struct {
+	Input          []Rule // Screen user input
+	Output         []Rule // Screen answers and tool call arguments
+	MaxOutputChars int    // Cut longer answers (0 = no limit)
+	Moderation     bool   // Ask the moderator about input and answers
+}
+
+// Moderator asks a model whether text at a stage is acceptable; it returns
+// the reason when it is not, and an empty string when it is
+type Moderator func(ctx context.Context, stage Stage, text string) (string, error)
+
+// Trigger is a rule that matched. It does not hold the matched text, which
+// may be the secret a rule keeps out of the conversation.
+type Trigger struct {
+	Stage  Stage
+	Rule   string
+	Action Action
+	Detail string // Moderation reason or output size
+}
+
+// Result is the outcome of screening text
+type Result struct {
+	Text     string   // The text to use, redacted or cut as the rules say
+	Blocked  *Trigger // The trigger that blocked the text, if any
+	Triggers []Trigger
+}
+
+// BlockedError reports input or output a guardrail blocked
+type BlockedError struct {
+	Stage  Stage
+	Rule   string
+	Detail string
+}
+
+func (e *BlockedError) Error() string {
+	msg := fmt.Sprintf("%s blocked by guardrail %s", strings.ReplaceAll(string(e.Stage), "_", " "), e.Rule)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Err returns a BlockedError for a blocked result, or nil
+func (r *Result) Err() error {
+	if r.Blocked == nil {
+		return nil
+	}
+	return &BlockedError{Stage: r.Blocked.Stage, Rule: r.Blocked.Rule, Detail: r.Blocked.Detail}
+}
+
+// Guard screens text against the rules
+type Guard struct {
+	input     []rule
+	output    []rule
+	maxOutput int
+	moderate  bool
+	moderator Moderator
+}
+
+type rule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// New compiles the rules, so invalid patterns are reported at startup. A
+// config without rules returns a nil Guard, which lets everything pass.
+func New(cfg Config) (*Guard, error) {
+	if len(cfg.Input) == 0 && len(cfg.Output) == 0 && cfg.MaxOutputChars <= 0 && !cfg.Moderation {
+		return nil, nil
+	}
+	g := &Guard{maxOutput: cfg.MaxOutputChars, moderate: cfg.Moderation}
+	var err error
+	if g.input, err = compile(cfg.Input); err != nil {
+		return nil, err
+	}
+	if g.output, err = compile(cfg.Output); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func compile(rules []Rule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		switch r.Action {
+		case "":
+			r.Action = ActionBlock
+		case ActionBlock, ActionRedact, ActionWarn:
+		default:
+			return nil, fmt.Errorf("guardrail %s: unknown action %q (want block, redact or warn)", r.Name, r.Action)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("guardrail %s: %w", r.Name, err)
+		}
+		compiled = append(compiled, rule{Rule: r, re: re})
+	}
+	return compiled, nil
+}
+
+// SetModerator sets the model that moderates input and answers when
+// moderation is enabled
+func (g *Guard) SetModerator(m Moderator) {
+	if g != nil {
+		g.moderator = m
+	}
+}
+
+// ScreensOutput reports whether answers are screened, in which case they
+// cannot be shown as they stream
+func (g *Guard) ScreensOutput() bool {
+	return g != nil && (len(g.output) > 0 || g.maxOutput > 0 || (g.moderate && g.moderator != nil))
+}
+
+// Screen checks text at a stage. Rules apply in order: the first block
+// stops screening, redactions apply to the text later rules see. Answers
+// over the size limit are cut, and moderation runs last on input and
+// answers. The error is the moderator's.
+func (g *Guard) Screen(ctx context.Context, stage Stage, text string) (*Result, error) {
+	result := &Result{Text: text}
+	if g == nil {
+		return result, nil
+	}
+	block := func(t Trigger) (*Result, error) {
+		result.Triggers = append(result.Triggers, t)
+		result.Blocked = &result.Triggers[len(result.Triggers)-1]
+		return result, nil
+	}
+
+	rules := g.output
+	if stage == StageInput {
+		rules = g.input
+	}
+	for _, r := range rules {
+		if !r.re.MatchString(result.Text) {
+			continue
+		}
+		t := Trigger{Stage: stage, Rule: r.Name, Action: r.Action}
+		switch r.Action {
+		case ActionBlock:
+			return block(t)
+		case ActionRedact:
+			result.Text = r.re.ReplaceAllLiteralString(result.Text, "[redacted: "+r.Name+"]")
+		}
+		result.Triggers = append(result.Triggers, t)
+	}
+
+	if stage == StageOutput && g.maxOutput > 0 && utf8.RuneCountInString(result.Text) > g.maxOutput {
+		result.Triggers = append(result.Triggers, Trigger{
+			Stage:  stage,
+			Rule:   RuleMaxOutput,
+			Action: ActionTruncate,
+			Detail: fmt.Sprintf("%d characters, limit %d", utf8.RuneCountInString(result.Text), g.maxOutput),
+		})
+		result.Text = string([]rune(result.Text)[:g.maxOutput]) + fmt.Sprintf("\n\n[Cut at %d characters by guardrail %s]", g.maxOutput, RuleMaxOutput)
+	}
+
+	if g.moderate && g.moderator != nil && stage != StageToolCall {
+		reason, err := g.moderator(ctx, stage, result.Text)
+		if err != nil {
+			return result, fmt.Errorf("moderation: %w", err)
+		}
+		if reason != "" {
+			return block(Trigger{Stage: stage, Rule: RuleModeration, Action: ActionBlock, Detail: reason})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,124 @@
+package guardrails
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScreen(t *testing.T) {
+	g, err := New(Config{
+		Input: []Rule{
+			{Name: "drop-table", Pattern: `(?i)drop\s+table`},
+			{Name: "email", Pattern: `[\w.]+@[\w.]+`, Action: ActionRedact},
+		},
+		Output: []Rule{
+			{Name: "api-key", Pattern: `sk-[A-Za-z0-9]{8,}`, Action: ActionRedact},
+			{Name: "rm-rf", Pattern: `rm -rf /`, Action: ActionBlock},
+			{Name: "profanity", Pattern: `(?i)\bdarn\b`, Action: ActionWarn},
+		},
+		MaxOutputChars: 40,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		stage    Stage
+		text     string
+		want     string
+		blocked  string
+		triggers int
+	}{
+		{"clean input", StageInput, "hello", "hello", "", 0},
+		{"blocked input", StageInput, "please DROP TABLE users", "", "drop-table", 1},
+		{"redacted input", StageInput, "mail ann@example.com", "mail [redacted: email]", "", 1},
+		{"output rules only for output", StageInput, "rm -rf /", "rm -rf /", "", 0},
+		{"redacted output", StageOutput, "key sk-abcdefgh1234", "key [redacted: api-key]", "", 1},
+		{"warned output", StageOutput, "darn it", "darn it", "", 1},
+		{"blocked tool call", StageToolCall, `{"command": "rm -rf /"}`, "", "rm-rf", 1},
+		{"cut output", StageOutput, strings.Repeat("x", 50), strings.Repeat("x", 40) + "\n\n[Cut at 40 characters by guardrail max_output_chars]", "", 1},
+		{"tool calls are not cut", StageToolCall, strings.Repeat("x", 50), strings.Repeat("x", 50), "", 0},
+	}
+	for _, tt := range tests {
+		result, err := g.Screen(ctx, tt.stage, tt.text)
+		if err != nil {
+			t.Fatalf("%s: Screen failed: %v", tt.name, err)
+		}
+		if tt.blocked != "" {
+			if result.Blocked == nil || result.Blocked.Rule != tt.blocked {
+				t.Errorf("%s: expected blocked by %s, got %+v", tt.name, tt.blocked, result.Blocked)
+			}
+			var be *BlockedError
+			if !errors.As(result.Err(), &be) || be.Rule != tt.blocked {
+				t.Errorf("%s: expected a BlockedError, got %v", tt.name, result.Err())
+			}
+		} else if result.Blocked != nil || result.Text != tt.want {
+			t.Errorf("%s: got %q (blocked %+v), want %q", tt.name, result.Text, result.Blocked, tt.want)
+		}
+		if len(result.Triggers) != tt.triggers {
+			t.Errorf("%s: expected %d triggers, got %+v", tt.name, tt.triggers, result.Triggers)
+		}
+	}
+}
+
+func TestScreen_Moderation(t *testing.T) {
+	g, err := New(Config{Moderation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.ScreensOutput() {
+		t.Error("expected answers streamed while there is no moderator")
+	}
+	var stages []Stage
+	g.SetModerator(func(ctx context.Context, stage Stage, text string) (string, error) {
+		stages = append(stages, stage)
+		switch text {
+		case "bad":
+			return "harassment", nil
+		case "fail":
+			return "", errors.New("provider down")
+		}
+		return "", nil
+	})
+	if !g.ScreensOutput() {
+		t.Error("expected answers screened with a moderator")
+	}
+
+	ctx := context.Background()
+	result, err := g.Screen(ctx, StageOutput, "bad")
+	if err != nil || result.Blocked == nil || result.Blocked.Detail != "harassment" {
+		t.Errorf("expected the answer blocked by moderation, got %+v, %v", result.Blocked, err)
+	}
+	if got := result.Err().Error(); got != "output blocked by guardrail moderation: harassment" {
+		t.Errorf("unexpected error %q", got)
+	}
+	if _, err := g.Screen(ctx, StageInput, "fail"); err == nil {
+		t.Error("expected the moderation error")
+	}
+	if _, err := g.Screen(ctx, StageToolCall, "bad"); err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 2 {
+		t.Errorf("expected tool calls not moderated, got %v", stages)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if g, err := New(Config{}); g != nil || err != nil {
+		t.Errorf("expected no guard without rules, got %v, %v", g, err)
+	}
+	var g *Guard
+	if result, err := g.Screen(context.Background(), StageInput, "anything"); err != nil || result.Text != "anything" {
+		t.Errorf("expected a nil guard to pass text, got %+v, %v", result, err)
+	}
+	if _, err := New(Config{Input: []Rule{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Error("expected an invalid pattern to fail")
+	}
+	if _, err := New(Config{Output: []Rule{{Pattern: "x", Action: "delete"}}}); err == nil || !strings.Contains(err.Error(), "rule 1") {
+		t.Errorf("expected an unknown action to fail, got %v", err)
+	}
+}
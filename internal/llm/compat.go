@@ -0,0 +1,78 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compat describes the quirks of an OpenAI-compatible backend. The zero
+// value is standard OpenAI behavior.
+type Compat struct {
+	// Roles renames message roles, e.g. {"tool": "function"} for backends
+	// that only know the legacy function role
+	Roles map[string]string
+
+	// MergeToolResults sends tool calls and their results as plain text:
+	// the assistant's calls are described in its content and the results
+	// are merged into a single user message. For backends that reject the
+	// tool role or tool_calls in the history.
+	MergeToolResults bool
+
+	// DisableParallelToolCalls sends parallel_tool_calls=false with tools
+	DisableParallelToolCalls bool
+}
+
+// apply rewrites wire messages according to the backend's quirks
+func (c Compat) apply(messages []openAIMessage) []openAIMessage {
+	if c.MergeToolResults {
+		messages = mergeToolResults(messages)
+	}
+	if len(c.Roles) > 0 {
+		for i := range messages {
+			if role, ok := c.Roles[messages[i].Role]; ok {
+				messages[i].Role = role
+			}
+		}
+	}
+	return messages
+}
+
+// mergeToolResults turns tool calls into text and folds each run of tool
+// results into one user message
+func mergeToolResults(messages []openAIMessage) []openAIMessage {
+	result := make([]openAIMessage, 0, len(messages))
+	for i := 0; i < len(messages); i++ {
+		m := messages[i]
+
+		if len(m.ToolCalls) > 0 {
+			var sb strings.Builder
+			sb.WriteString(m.Content)
+			for _, tc := range m.ToolCalls {
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				fmt.Fprintf(&sb, "[Calling tool %s with %s]", tc.Function.Name, tc.Function.Arguments)
+			}
+			m.Content = sb.String()
+			m.ToolCalls = nil
+			result = append(result, m)
+			continue
+		}
+
+		if m.Role != "tool" {
+			result = append(result, m)
+			continue
+		}
+
+		var sb strings.Builder
+		for ; i < len(messages) && messages[i].Role == "tool"; i++ {
+			if sb.Len() > 0 {
+				sb.WriteString("\n\n")
+			}
+			fmt.Fprintf(&sb, "[Result of tool %s]\n%s", messages[i].Name, messages[i].Content)
+		}
+		i--
+		result = append(result, openAIMessage{Role: "user", Content: sb.String()})
+	}
+	return result
+}
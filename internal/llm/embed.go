@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Embedder is implemented by providers that can embed text as vectors
+type Embedder interface {
+	// Embed returns one vector per text, in order
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// ErrEmbeddingsUnsupported is returned by Embed when no embedding model is
+// configured or known for the provider
+var ErrEmbeddingsUnsupported = errors.New("embeddings not supported: no embedding model configured")
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Error *openAIError `json:"error,omitempty"`
+}
+
+// Embed embeds texts with the provider's embeddings endpoint
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if p.embeddingModel == "" {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	body, err := json.Marshal(openAIEmbeddingRequest{Model: p.embeddingModel, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+	resp, err := p.post(ctx, "/embeddings", body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	var result openAIEmbeddingResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+		}
+		return nil, fmt.Errorf("unmarshaling response: %w", err)
+	}
+	if result.Error != nil {
+		return nil, p.apiError(resp.StatusCode, result.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+
+	vectors := make([][]float64, len(texts))
+	for _, d := range result.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+
+	p.log.Debug("texts embedded", "count", len(texts), "model", p.embeddingModel)
+	return vectors, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, or
+// 0 if their lengths differ or either is zero
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
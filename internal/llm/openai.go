@@ -17,17 +17,20 @@ import (
 
 func init() {
 	Register("openai", NewOpenAIProvider)
-	Register("zhipu", NewOpenAIProvider)     // Z.AI uses OpenAI-compatible API
 	Register("anthropic", NewOpenAIProvider) // Can be adapted
 }
 
 // OpenAIProvider implements Provider for OpenAI-compatible APIs
 type OpenAIProvider struct {
-	baseURL string
-	apiKey  string
-	model   string
-	client  *http.Client
-	log     *slog.Logger
+	baseURL   string
+	apiKey    string
+	model     string
+	cacheMode string // "", "anthropic" (cache_control markers) or "openai" (prompt_cache_key)
+	compat    Compat // Backend quirks
+	client    *http.Client
+	log       *slog.Logger
+
+	embeddingModel string // Model for Embed; empty disables embeddings
 }
 
 // NewOpenAIProvider creates a new OpenAI-compatible provider
@@ -41,43 +44,114 @@ func NewOpenAIProvider(cfg ProviderConfig) (Provider, error) {
 		baseURL = "https://api.openai.com/v1"
 	}
 
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var cacheMode string
+	if cfg.PromptCache {
+		switch cfg.Type {
+		case "anthropic", "openai":
+			cacheMode = cfg.Type
+		}
+	}
+
+	preset, _ := LookupPreset(cfg.Type)
+	embeddingModel := cfg.EmbeddingModel
+	if embeddingModel == "" {
+		embeddingModel = preset.EmbeddingModel
+	}
+
 	return &OpenAIProvider{
-		baseURL: strings.TrimSuffix(baseURL, "/"),
-		apiKey:  cfg.APIKey,
-		model:   cfg.Model,
-		client: &http.Client{
-			Timeout: 120 * time.Second,
-		},
-		log: logger.L().With("component", "llm", "model", cfg.Model),
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		apiKey:    cfg.APIKey,
+		model:     cfg.Model,
+		cacheMode: cacheMode,
+		compat:    cfg.Compat,
+		client:    client,
+		log:       logger.L().With("component", "llm", "model", cfg.Model),
+
+		embeddingModel: embeddingModel,
 	}, nil
 }
 
 type openAIRequest struct {
-	Model       string           `json:"model"`
-	Messages    []openAIMessage  `json:"messages"`
-	Stream      bool             `json:"stream,omitempty"`
-	MaxTokens   int              `json:"max_tokens,omitempty"`
-	Temperature float64          `json:"temperature,omitempty"`
-	Tools       []ToolDefinition `json:"tools,omitempty"`
+	Model          string           `json:"model"`
+	Messages       []openAIMessage  `json:"messages"`
+	Stream         bool             `json:"stream,omitempty"`
+	MaxTokens      int              `json:"max_tokens,omitempty"`
+	Temperature    *float64         `json:"temperature,omitempty"`
+	Tools          []ToolDefinition `json:"tools,omitempty"`
+	PromptCacheKey string           `json:"prompt_cache_key,omitempty"`
+
+	ParallelToolCalls *bool `json:"parallel_tool_calls,omitempty"`
+
+	MaxCompletionTokens int                  `json:"max_completion_tokens,omitempty"` // OpenAI reasoning models
+	StreamOptions       *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index        int           `json:"index"`
-		Message      openAIMessage `json:"message"`
-		Delta        openAIMessage `json:"delta"`
-		FinishReason string        `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
-	Error *openAIError `json:"error,omitempty"`
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   openAIUsage    `json:"usage"`
+	Error   *openAIError   `json:"error,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int           `json:"index"`
+	Message      openAIMessage `json:"message"`
+	Delta        openAIDelta   `json:"delta"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+// openAIDelta is an incremental message update in a streamed response
+type openAIDelta struct {
+	Role             string                `json:"role,omitempty"`
+	Content          string                `json:"content,omitempty"`
+	ReasoningContent string                `json:"reasoning_content,omitempty"`
+	ToolCalls        []openAIToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// openAIToolCallDelta is a fragment of a tool call; fragments with the same
+// index are concatenated
+type openAIToolCallDelta struct {
+	Index    int                    `json:"index"`
+	ID       string                 `json:"id,omitempty"`
+	Type     string                 `json:"type,omitempty"`
+	Function openAIToolCallFunction `json:"function"`
+}
+
+// openAIUsage covers the token usage fields of OpenAI-compatible APIs,
+// including the different ways providers report prompt cache hits
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details,omitempty"` // OpenAI, Moonshot
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens,omitempty"` // DeepSeek
+	CacheReadInputTokens int `json:"cache_read_input_tokens,omitempty"` // Anthropic
+}
+
+// cachedTokens returns the number of prompt tokens served from cache
+func (u openAIUsage) cachedTokens() int {
+	switch {
+	case u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > 0:
+		return u.PromptTokensDetails.CachedTokens
+	case u.PromptCacheHitTokens > 0:
+		return u.PromptCacheHitTokens
+	default:
+		return u.CacheReadInputTokens
+	}
 }
 
 // openAIError handles both string and object error formats from different APIs
@@ -115,6 +189,9 @@ type openAIMessage struct {
 	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string           `json:"tool_call_id,omitempty"`
 	Name       string           `json:"name,omitempty"`
+	Reasoning  string           `json:"reasoning_content,omitempty"` // Only read from responses, never sent
+	Images     []string         `json:"-"`                           // Sent as content parts, see MarshalJSON
+	Cache      bool             `json:"-"`                           // Adds a cache_control breakpoint, see MarshalJSON
 }
 
 // openAIToolCall matches OpenAI's tool call format
@@ -129,17 +206,45 @@ type openAIToolCallFunction struct {
 	Arguments string `json:"arguments"`
 }
 
-// Complete sends a completion request
-func (p *OpenAIProvider) Complete(ctx context.Context, messages []Message) (*Response, error) {
-	return p.CompleteWithOptions(ctx, messages, nil)
+// MarshalJSON emits content parts when the message carries images or a
+// cache breakpoint
+func (m openAIMessage) MarshalJSON() ([]byte, error) {
+	type alias openAIMessage
+	if len(m.Images) == 0 && !m.Cache {
+		return json.Marshal(alias(m))
+	}
+
+	var parts []openAIContentPart
+	if m.Content != "" {
+		parts = append(parts, openAIContentPart{Type: "text", Text: m.Content})
+	}
+	for _, img := range m.Images {
+		parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: img}})
+	}
+	if m.Cache && len(parts) > 0 {
+		parts[len(parts)-1].CacheControl = &CacheControl{Type: "ephemeral"}
+	}
+
+	return json.Marshal(struct {
+		alias
+		Content []openAIContentPart `json:"content"`
+	}{alias(m), parts})
 }
 
-// CompleteWithOptions sends a completion request with optional tools
-func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Message, opts *CompleteOptions) (*Response, error) {
-	startTime := time.Now()
-	p.log.Debug("sending completion request", "message_count", len(messages))
+// openAIContentPart is one part of a multimodal message content array
+type openAIContentPart struct {
+	Type         string          `json:"type"` // text, image_url
+	Text         string          `json:"text,omitempty"`
+	ImageURL     *openAIImageURL `json:"image_url,omitempty"`
+	CacheControl *CacheControl   `json:"cache_control,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
 
-	// Convert messages to OpenAI format
+// toOpenAIMessages converts messages to OpenAI's wire format
+func toOpenAIMessages(messages []Message) []openAIMessage {
 	openAIMessages := make([]openAIMessage, len(messages))
 	for i, m := range messages {
 		openAIMessages[i] = openAIMessage{
@@ -147,6 +252,7 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 			Content:    m.Content,
 			ToolCallID: m.ToolCallID,
 			Name:       m.Name,
+			Images:     m.Images,
 		}
 		if len(m.ToolCalls) > 0 {
 			openAIMessages[i].ToolCalls = make([]openAIToolCall, len(m.ToolCalls))
@@ -162,34 +268,22 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 			}
 		}
 	}
+	return openAIMessages
+}
 
-	reqBody := openAIRequest{
-		Model:    p.model,
-		Messages: openAIMessages,
-	}
-
-	if opts != nil && len(opts.Tools) > 0 {
-		reqBody.Tools = opts.Tools
-		p.log.Debug("request includes tools", "tool_count", len(opts.Tools))
-	}
-
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("marshaling request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
-	}
+// Complete sends a completion request
+func (p *OpenAIProvider) Complete(ctx context.Context, messages []Message) (*Response, error) {
+	return p.CompleteWithOptions(ctx, messages, nil)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+// CompleteWithOptions sends a completion request with optional tools
+func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Message, opts *CompleteOptions) (*Response, error) {
+	startTime := time.Now()
+	p.log.Debug("sending completion request", "message_count", len(messages))
 
-	resp, err := p.client.Do(req)
+	resp, err := p.send(ctx, p.buildRequest(messages, opts, false))
 	if err != nil {
-		p.log.Error("request failed", "error", err)
-		return nil, fmt.Errorf("sending request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -204,8 +298,7 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 	}
 
 	if result.Error != nil {
-		p.log.Error("API error", "message", result.Error.Error(), "type", result.Error.Type)
-		return nil, fmt.Errorf("API error: %s", result.Error.Error())
+		return nil, p.apiError(resp.StatusCode, result.Error)
 	}
 
 	if len(result.Choices) == 0 {
@@ -215,7 +308,11 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 	choice := result.Choices[0]
 	response := &Response{
 		Content:      choice.Message.Content,
+		Reasoning:    choice.Message.Reasoning,
 		TokensUsed:   result.Usage.TotalTokens,
+		PromptTokens: result.Usage.PromptTokens,
+		OutputTokens: result.Usage.CompletionTokens,
+		CachedTokens: result.Usage.cachedTokens(),
 		FinishReason: choice.FinishReason,
 	}
 
@@ -240,6 +337,7 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 		"tokens_used", result.Usage.TotalTokens,
 		"prompt_tokens", result.Usage.PromptTokens,
 		"completion_tokens", result.Usage.CompletionTokens,
+		"cached_tokens", response.CachedTokens,
 		"duration_ms", duration.Milliseconds(),
 		"finish_reason", choice.FinishReason,
 	)
@@ -247,73 +345,159 @@ func (p *OpenAIProvider) CompleteWithOptions(ctx context.Context, messages []Mes
 	return response, nil
 }
 
-// Stream sends a streaming completion request
-func (p *OpenAIProvider) Stream(ctx context.Context, messages []Message, onChunk func(string)) error {
-	startTime := time.Now()
-	p.log.Debug("starting stream request", "message_count", len(messages))
+// buildRequest converts messages and options to a chat completions request
+func (p *OpenAIProvider) buildRequest(messages []Message, opts *CompleteOptions, stream bool) openAIRequest {
+	reqBody := openAIRequest{
+		Model:    p.model,
+		Messages: toOpenAIMessages(messages),
+		Stream:   stream,
+	}
+	if stream {
+		reqBody.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
 
-	// Convert messages to OpenAI format
-	openAIMessages := make([]openAIMessage, len(messages))
-	for i, m := range messages {
-		openAIMessages[i] = openAIMessage{
-			Role:       m.Role,
-			Content:    m.Content,
-			ToolCallID: m.ToolCallID,
-			Name:       m.Name,
+	if opts != nil && len(opts.Tools) > 0 {
+		reqBody.Tools = opts.Tools
+		if p.compat.DisableParallelToolCalls {
+			parallel := false
+			reqBody.ParallelToolCalls = &parallel
 		}
-		if len(m.ToolCalls) > 0 {
-			openAIMessages[i].ToolCalls = make([]openAIToolCall, len(m.ToolCalls))
-			for j, tc := range m.ToolCalls {
-				openAIMessages[i].ToolCalls[j] = openAIToolCall{
-					ID:   tc.ID,
-					Type: tc.Type,
-					Function: openAIToolCallFunction{
-						Name:      tc.Function.Name,
-						Arguments: tc.Function.Arguments,
-					},
-				}
-			}
+		p.log.Debug("request includes tools", "tool_count", len(opts.Tools))
+	}
+	reqBody.Messages = p.compat.apply(reqBody.Messages)
+
+	// Reasoning models reject temperature, and OpenAI's o-series replaced
+	// max_tokens with max_completion_tokens (which also covers reasoning tokens)
+	reasoning := IsReasoningModel(p.model)
+	if opts != nil && opts.MaxTokens > 0 {
+		if reasoning && usesMaxCompletionTokens(p.model) {
+			reqBody.MaxCompletionTokens = opts.MaxTokens
+		} else {
+			reqBody.MaxTokens = opts.MaxTokens
 		}
 	}
-
-	reqBody := openAIRequest{
-		Model:    p.model,
-		Messages: openAIMessages,
-		Stream:   true,
+	if opts != nil && !reasoning {
+		reqBody.Temperature = opts.Temperature
 	}
 
+	p.applyPromptCache(&reqBody, opts)
+	return reqBody
+}
+
+// send posts a request to the chat completions endpoint
+func (p *OpenAIProvider) send(ctx context.Context, reqBody openAIRequest) (*http.Response, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
-		return fmt.Errorf("marshaling request: %w", err)
+		return nil, fmt.Errorf("marshaling request: %w", err)
 	}
+	return p.post(ctx, "/chat/completions", body, reqBody.Stream)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+// post sends a JSON body to an API endpoint
+func (p *OpenAIProvider) post(ctx context.Context, path string, body []byte, stream bool) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+p.apiKey)
-	req.Header.Set("Accept", "text/event-stream")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
 
 	resp, err := p.client.Do(req)
 	if err != nil {
-		p.log.Error("stream request failed", "error", err)
-		return fmt.Errorf("sending request: %w", err)
+		p.log.Error("request failed", "error", err)
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	return resp, nil
+}
+
+// apiError converts an error payload to an APIError
+func (p *OpenAIProvider) apiError(statusCode int, e *openAIError) error {
+	p.log.Error("API error", "message", e.Error(), "type", e.Type)
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       e.Code,
+		Type:       e.Type,
+		Message:    e.Error(),
+	}
+}
+
+// applyPromptCache adds caching hints to a request. Anthropic caches the
+// prefix up to each cache_control breakpoint, so the system prompt and the
+// last tool definition are marked; OpenAI caches automatically and only
+// needs a stable key to route requests sharing a prefix to the same cache.
+func (p *OpenAIProvider) applyPromptCache(req *openAIRequest, opts *CompleteOptions) {
+	switch p.cacheMode {
+	case "anthropic":
+		for i := range req.Messages {
+			if req.Messages[i].Role == "system" {
+				req.Messages[i].Cache = true
+				break
+			}
+		}
+		if n := len(req.Tools); n > 0 {
+			tools := append([]ToolDefinition(nil), req.Tools...)
+			tools[n-1].CacheControl = &CacheControl{Type: "ephemeral"}
+			req.Tools = tools
+		}
+	case "openai":
+		if opts != nil {
+			req.PromptCacheKey = opts.CacheKey
+		}
+	}
+}
+
+// Stream sends a streaming completion request
+func (p *OpenAIProvider) Stream(ctx context.Context, messages []Message, onChunk func(string)) error {
+	_, err := p.CompleteStream(ctx, messages, nil, StreamHandler{OnContent: onChunk})
+	return err
+}
+
+// CompleteStream sends a streaming completion request, forwarding content and
+// reasoning deltas to the handler and accumulating tool call fragments
+func (p *OpenAIProvider) CompleteStream(ctx context.Context, messages []Message, opts *CompleteOptions, handler StreamHandler) (*Response, error) {
+	startTime := time.Now()
+	p.log.Debug("starting stream request", "message_count", len(messages))
+
+	resp, err := p.send(ctx, p.buildRequest(messages, opts, true))
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		var result openAIResponse
+		if err := json.Unmarshal(respBody, &result); err == nil && result.Error != nil {
+			return nil, p.apiError(resp.StatusCode, result.Error)
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+
+	var (
+		content   strings.Builder
+		reasoning strings.Builder
+		toolCalls []ToolCall
+		response  = &Response{}
+	)
+
 	chunkCount := 0
+	done := false
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 	for scanner.Scan() {
 		line := scanner.Text()
 
-		if !strings.HasPrefix(line, "data: ") {
+		if !strings.HasPrefix(line, "data:") {
 			continue
 		}
 
-		data := strings.TrimPrefix(line, "data: ")
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
 		if data == "[DONE]" {
+			done = true
 			break
 		}
 
@@ -321,20 +505,79 @@ func (p *OpenAIProvider) Stream(ctx context.Context, messages []Message, onChunk
 		if err := json.Unmarshal([]byte(data), &result); err != nil {
 			continue
 		}
+		if result.Error != nil {
+			return nil, p.apiError(resp.StatusCode, result.Error)
+		}
+		if result.Usage.TotalTokens > 0 {
+			response.TokensUsed = result.Usage.TotalTokens
+			response.PromptTokens = result.Usage.PromptTokens
+			response.OutputTokens = result.Usage.CompletionTokens
+			response.CachedTokens = result.Usage.cachedTokens()
+		}
+		if len(result.Choices) == 0 {
+			continue
+		}
+
+		choice := result.Choices[0]
+		if choice.FinishReason != "" {
+			response.FinishReason = choice.FinishReason
+		}
 
-		if len(result.Choices) > 0 && result.Choices[0].Delta.Content != "" {
-			onChunk(result.Choices[0].Delta.Content)
+		delta := choice.Delta
+		if delta.ReasoningContent != "" {
+			reasoning.WriteString(delta.ReasoningContent)
+			if handler.OnReasoning != nil {
+				handler.OnReasoning(delta.ReasoningContent)
+			}
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			if handler.OnContent != nil {
+				handler.OnContent(delta.Content)
+			}
 			chunkCount++
 		}
+		for _, tc := range delta.ToolCalls {
+			for len(toolCalls) <= tc.Index {
+				toolCalls = append(toolCalls, ToolCall{Function: &ToolCallFunction{}})
+			}
+			call := &toolCalls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading stream: %w: %v", ErrStreamInterrupted, err)
+	}
+	if !done && response.FinishReason == "" {
+		return nil, ErrStreamInterrupted
+	}
+
+	response.Content = content.String()
+	response.Reasoning = reasoning.String()
+	for _, tc := range toolCalls {
+		if tc.Function.Name != "" {
+			response.ToolCalls = append(response.ToolCalls, tc)
+		}
 	}
 
 	duration := time.Since(startTime)
 	p.log.Info("stream completed",
 		"chunks", chunkCount,
+		"tokens_used", response.TokensUsed,
+		"cached_tokens", response.CachedTokens,
+		"tool_calls", len(response.ToolCalls),
 		"duration_ms", duration.Milliseconds(),
+		"finish_reason", response.FinishReason,
 	)
 
-	return scanner.Err()
+	return response, nil
 }
 
 // CountTokens provides a rough estimate of token count
@@ -0,0 +1,108 @@
+package llm
+
+import "sort"
+
+// Preset describes the defaults of a known OpenAI-compatible provider
+type Preset struct {
+	Name          string
+	BaseURL       string
+	DefaultModel  string
+	ContextWindow int     // Context window of the default model, in tokens
+	SupportsTools bool    // Whether the API accepts tool definitions
+	InputPrice    float64 // Approximate USD per 1M prompt tokens
+	OutputPrice   float64 // Approximate USD per 1M completion tokens
+
+	EmbeddingModel string // Model of the embeddings endpoint; empty if there is none
+}
+
+var presets = map[string]Preset{
+	"openai": {
+		Name:          "openai",
+		BaseURL:       "https://api.openai.com/v1",
+		DefaultModel:  "gpt-4o-mini",
+		ContextWindow: 128000,
+		SupportsTools: true,
+		InputPrice:    0.15,
+		OutputPrice:   0.60,
+
+		EmbeddingModel: "text-embedding-3-small",
+	},
+	"zhipu": {
+		Name:          "zhipu",
+		BaseURL:       "https://open.bigmodel.cn/api/paas/v4",
+		DefaultModel:  "glm-4-flash",
+		ContextWindow: 128000,
+		SupportsTools: true,
+
+		EmbeddingModel: "embedding-3",
+	},
+	"glm": {
+		Name:          "glm",
+		BaseURL:       "https://open.bigmodel.cn/api/paas/v4",
+		DefaultModel:  "glm-4-flash",
+		ContextWindow: 128000,
+		SupportsTools: true,
+
+		EmbeddingModel: "embedding-3",
+	},
+	"deepseek": {
+		Name:          "deepseek",
+		BaseURL:       "https://api.deepseek.com/v1",
+		DefaultModel:  "deepseek-chat",
+		ContextWindow: 64000,
+		SupportsTools: true,
+		InputPrice:    0.27,
+		OutputPrice:   1.10,
+	},
+	"moonshot": {
+		Name:          "moonshot",
+		BaseURL:       "https://api.moonshot.cn/v1",
+		DefaultModel:  "moonshot-v1-8k",
+		ContextWindow: 8192,
+		SupportsTools: true,
+		InputPrice:    1.65,
+		OutputPrice:   1.65,
+	},
+}
+
+func init() {
+	Register("deepseek", presetFactory("deepseek"))
+	Register("moonshot", presetFactory("moonshot"))
+}
+
+// Cost estimates the USD cost of a completion at the preset's prices
+func (p Preset) Cost(promptTokens, outputTokens int) float64 {
+	return (float64(promptTokens)*p.InputPrice + float64(outputTokens)*p.OutputPrice) / 1e6
+}
+
+// LookupPreset returns the preset for a provider type
+func LookupPreset(name string) (Preset, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// Presets returns all known presets sorted by name
+func Presets() []Preset {
+	result := make([]Preset, 0, len(presets))
+	for _, p := range presets {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// presetFactory creates an OpenAI-compatible provider with preset defaults
+func presetFactory(name string) ProviderFactory {
+	return func(cfg ProviderConfig) (Provider, error) {
+		preset := presets[name]
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = preset.BaseURL
+		}
+		if cfg.Model == "" {
+			cfg.Model = preset.DefaultModel
+		}
+		return NewOpenAIProvider(cfg)
+	}
+}
@@ -2,7 +2,11 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/netpolicy"
 )
 
 // ToolCall represents a tool call in a message
@@ -25,16 +29,46 @@ type Message struct {
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // For assistant messages requesting tools
 	ToolCallID string     `json:"tool_call_id,omitempty"` // For tool response messages
 	Name       string     `json:"name,omitempty"`         // Tool name for tool role messages
+	Images     []string   `json:"images,omitempty"`       // Image URLs or data URIs for vision models
 }
 
 // Response represents the LLM response
 type Response struct {
 	Content      string     `json:"content"`
+	Reasoning    string     `json:"reasoning,omitempty"` // Thinking output of reasoning models
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	TokensUsed   int        `json:"tokens_used"`
+	PromptTokens int        `json:"prompt_tokens,omitempty"`
+	OutputTokens int        `json:"output_tokens,omitempty"` // Completion tokens, including reasoning
+	CachedTokens int        `json:"cached_tokens,omitempty"` // Prompt tokens served from the provider's cache
 	FinishReason string     `json:"finish_reason"`
 }
 
+// Normalized finish reasons shared by all providers
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonContentFilter = "content_filter"
+)
+
+// ErrStreamInterrupted is returned when a stream ends before the response is
+// complete, e.g. because the connection dropped; content already delivered to
+// the stream handler is a partial answer
+var ErrStreamInterrupted = errors.New("stream interrupted")
+
+// APIError is an error reported by the provider's API
+type APIError struct {
+	StatusCode int    // HTTP status code
+	Code       string // Provider-specific error code
+	Type       string // Provider-specific error type
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return "API error: " + e.Message
+}
+
 // HasToolCalls returns true if the response contains tool calls
 func (r *Response) HasToolCalls() bool {
 	return len(r.ToolCalls) > 0
@@ -42,8 +76,22 @@ func (r *Response) HasToolCalls() bool {
 
 // ToolDefinition represents a tool definition for the LLM
 type ToolDefinition struct {
-	Type     string           `json:"type"` // "function"
-	Function *ToolFunctionDef `json:"function"`
+	Type         string           `json:"type"` // "function", or a provider built-in such as "web_search"
+	Function     *ToolFunctionDef `json:"function,omitempty"`
+	WebSearch    *WebSearchTool   `json:"web_search,omitempty"`
+	CacheControl *CacheControl    `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks a prompt prefix breakpoint for Anthropic prompt caching
+type CacheControl struct {
+	Type string `json:"type"` // "ephemeral"
+}
+
+// WebSearchTool configures a provider-side web search tool (GLM)
+type WebSearchTool struct {
+	Enable       bool   `json:"enable"`
+	SearchQuery  string `json:"search_query,omitempty"`
+	SearchResult bool   `json:"search_result,omitempty"` // Return search results to the caller
 }
 
 // ToolFunctionDef defines a function tool
@@ -55,7 +103,13 @@ type ToolFunctionDef struct {
 
 // CompleteOptions holds optional parameters for completion
 type CompleteOptions struct {
-	Tools []ToolDefinition `json:"tools,omitempty"`
+	Tools     []ToolDefinition `json:"tools,omitempty"`
+	MaxTokens int              `json:"max_tokens,omitempty"` // Response token limit (0 = provider default)
+	CacheKey  string           `json:"cache_key,omitempty"`  // Groups requests sharing a prompt prefix, e.g. a conversation ID
+
+	// Temperature is the sampling temperature (nil = provider default); it
+	// is dropped for reasoning models, which reject it
+	Temperature *float64 `json:"temperature,omitempty"`
 }
 
 // Provider defines the interface for LLM providers
@@ -73,6 +127,52 @@ type Provider interface {
 	CountTokens(messages []Message) int
 }
 
+// StreamHandler receives incremental output of a streamed completion
+type StreamHandler struct {
+	OnContent   func(string) // Answer text
+	OnReasoning func(string) // Thinking output of reasoning models
+}
+
+// StreamingProvider is implemented by providers that can stream a completion
+// with tools, returning the assembled response once the stream ends
+type StreamingProvider interface {
+	CompleteStream(ctx context.Context, messages []Message, opts *CompleteOptions, handler StreamHandler) (*Response, error)
+}
+
+// IsReasoningModel reports whether a model is a reasoning model (OpenAI
+// o-series, DeepSeek-R1 and similar) that thinks before answering
+func IsReasoningModel(model string) bool {
+	m := baseModelName(model)
+	switch {
+	case usesMaxCompletionTokens(m):
+		return true
+	case strings.HasPrefix(m, "deepseek-reasoner"), strings.Contains(m, "-r1"):
+		return true
+	}
+	return false
+}
+
+// usesMaxCompletionTokens reports whether a model is an OpenAI o-series model
+func usesMaxCompletionTokens(model string) bool {
+	m := baseModelName(model)
+	for _, prefix := range []string{"o1", "o3", "o4"} {
+		if m == prefix || strings.HasPrefix(m, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// baseModelName lowercases a model name and strips any vendor prefix
+// such as "openai/" used by routers
+func baseModelName(model string) string {
+	m := strings.ToLower(model)
+	if i := strings.LastIndex(m, "/"); i >= 0 {
+		m = m[i+1:]
+	}
+	return m
+}
+
 // ProviderFactory creates a provider based on type
 type ProviderFactory func(cfg ProviderConfig) (Provider, error)
 
@@ -82,6 +182,25 @@ type ProviderConfig struct {
 	BaseURL string
 	APIKey  string
 	Model   string
+
+	// Network settings
+	Proxy              string            // HTTP(S) proxy URL; empty uses the environment
+	CACertFile         string            // PEM file with extra root CAs
+	InsecureSkipVerify bool              // Disable TLS certificate verification
+	NetPolicy          *netpolicy.Policy // Outbound allowlist, mTLS and audit; nil allows all
+
+	// GLM native features
+	WebSearch bool // Enable the built-in web_search tool
+
+	// PromptCache marks the system prompt and tools as cacheable (Anthropic)
+	// and sends a prompt cache key (OpenAI)
+	PromptCache bool
+
+	// Compat works around quirks of OpenAI-compatible backends
+	Compat Compat
+
+	// EmbeddingModel is used by Embed; empty uses the preset's, if any
+	EmbeddingModel string
 }
 
 var providers = make(map[string]ProviderFactory)
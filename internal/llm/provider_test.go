@@ -3,8 +3,13 @@ package llm
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -149,12 +154,7 @@ func TestComplete(t *testing.T) {
 		}
 
 		resp := openAIResponse{
-			Choices: []struct {
-				Index        int           `json:"index"`
-				Message      openAIMessage `json:"message"`
-				Delta        openAIMessage `json:"delta"`
-				FinishReason string        `json:"finish_reason"`
-			}{
+			Choices: []openAIChoice{
 				{
 					Index: 0,
 					Message: openAIMessage{
@@ -164,11 +164,7 @@ func TestComplete(t *testing.T) {
 					FinishReason: "stop",
 				},
 			},
-			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}{
+			Usage: openAIUsage{
 				PromptTokens:     10,
 				CompletionTokens: 5,
 				TotalTokens:      15,
@@ -222,12 +218,7 @@ func TestCompleteWithOptions_ToolCalls(t *testing.T) {
 		}
 
 		resp := openAIResponse{
-			Choices: []struct {
-				Index        int           `json:"index"`
-				Message      openAIMessage `json:"message"`
-				Delta        openAIMessage `json:"delta"`
-				FinishReason string        `json:"finish_reason"`
-			}{
+			Choices: []openAIChoice{
 				{
 					Index: 0,
 					Message: openAIMessage{
@@ -246,11 +237,7 @@ func TestCompleteWithOptions_ToolCalls(t *testing.T) {
 					FinishReason: "tool_calls",
 				},
 			},
-			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}{
+			Usage: openAIUsage{
 				PromptTokens:     20,
 				CompletionTokens: 10,
 				TotalTokens:      30,
@@ -359,12 +346,7 @@ func TestCompleteWithOptions_APIError(t *testing.T) {
 func TestCompleteWithOptions_NoChoices(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := openAIResponse{
-			Choices: []struct {
-				Index        int           `json:"index"`
-				Message      openAIMessage `json:"message"`
-				Delta        openAIMessage `json:"delta"`
-				FinishReason string        `json:"finish_reason"`
-			}{},
+			Choices: []openAIChoice{},
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -564,12 +546,7 @@ func TestNewOpenAIProvider_DefaultBaseURL(t *testing.T) {
 func TestCompleteWithOptions_ToolCallWithNilFunction(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		resp := openAIResponse{
-			Choices: []struct {
-				Index        int           `json:"index"`
-				Message      openAIMessage `json:"message"`
-				Delta        openAIMessage `json:"delta"`
-				FinishReason string        `json:"finish_reason"`
-			}{
+			Choices: []openAIChoice{
 				{
 					Index: 0,
 					Message: openAIMessage{
@@ -585,11 +562,7 @@ func TestCompleteWithOptions_ToolCallWithNilFunction(t *testing.T) {
 					FinishReason: "tool_calls",
 				},
 			},
-			Usage: struct {
-				PromptTokens     int `json:"prompt_tokens"`
-				CompletionTokens int `json:"completion_tokens"`
-				TotalTokens      int `json:"total_tokens"`
-			}{
+			Usage: openAIUsage{
 				TotalTokens: 10,
 			},
 		}
@@ -620,3 +593,503 @@ func TestCompleteWithOptions_ToolCallWithNilFunction(t *testing.T) {
 		t.Errorf("expected 1 tool call, got %d", len(resp.ToolCalls))
 	}
 }
+
+func TestNewOpenAIProvider_Proxy(t *testing.T) {
+	// The proxy receives requests with absolute URLs for the upstream host
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"via proxy"}}]}`))
+	}))
+	defer proxy.Close()
+
+	provider, err := NewOpenAIProvider(ProviderConfig{
+		APIKey:  "test-key",
+		BaseURL: "http://api.example.invalid/v1",
+		Model:   "test-model",
+		Proxy:   proxy.URL,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	resp, err := provider.Complete(context.Background(), []Message{{Role: "user", Content: "Hi"}})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "via proxy" {
+		t.Errorf("unexpected content: %s", resp.Content)
+	}
+	if proxied != "http://api.example.invalid/v1/chat/completions" {
+		t.Errorf("unexpected proxied URL: %s", proxied)
+	}
+}
+
+func TestNewOpenAIProvider_CustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"trusted"}}]}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	messages := []Message{{Role: "user", Content: "Hi"}}
+
+	// Without the CA the self-signed server is rejected
+	untrusted, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	if _, err := untrusted.Complete(context.Background(), messages); err == nil {
+		t.Error("expected TLS error without custom CA")
+	}
+
+	trusted, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", BaseURL: server.URL, CACertFile: caFile})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	resp, err := trusted.Complete(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.Content != "trusted" {
+		t.Errorf("unexpected content: %s", resp.Content)
+	}
+
+	insecure, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", BaseURL: server.URL, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	if _, err := insecure.Complete(context.Background(), messages); err != nil {
+		t.Errorf("expected insecure provider to skip verification: %v", err)
+	}
+}
+
+func TestNewOpenAIProvider_InvalidNetworkConfig(t *testing.T) {
+	if _, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", Proxy: "://bad"}); err == nil {
+		t.Error("expected error for invalid proxy URL")
+	}
+	if _, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", CACertFile: "/nonexistent/ca.pem"}); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
+
+func TestCompleteWithOptions_MaxTokens(t *testing.T) {
+	var req openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"short"}}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewOpenAIProvider(ProviderConfig{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	temperature := 0.0
+	_, err = provider.CompleteWithOptions(context.Background(), []Message{{Role: "user", Content: "Hi"}}, &CompleteOptions{MaxTokens: 64, Temperature: &temperature})
+	if err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if req.MaxTokens != 64 {
+		t.Errorf("expected max_tokens 64, got %d", req.MaxTokens)
+	}
+	if req.Temperature == nil || *req.Temperature != 0 {
+		t.Errorf("expected an explicit zero temperature sent, got %v", req.Temperature)
+	}
+}
+
+func TestZhipuProvider_WebSearchAndFinishReason(t *testing.T) {
+	var raw map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&raw)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":""},"finish_reason":"sensitive"}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := New(ProviderConfig{Type: "zhipu", APIKey: "test-key", BaseURL: server.URL, Model: "glm-4", WebSearch: true})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	if _, ok := provider.(*ZhipuProvider); !ok {
+		t.Fatalf("expected zhipu type to create a ZhipuProvider, got %T", provider)
+	}
+
+	resp, err := provider.Complete(context.Background(), []Message{{Role: "user", Content: "news?"}})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if resp.FinishReason != FinishReasonContentFilter {
+		t.Errorf("expected finish reason %q, got %q", FinishReasonContentFilter, resp.FinishReason)
+	}
+
+	tools, _ := raw["tools"].([]interface{})
+	if len(tools) != 1 {
+		t.Fatalf("expected web_search tool in request, got %v", raw["tools"])
+	}
+	tool := tools[0].(map[string]interface{})
+	if tool["type"] != "web_search" || tool["function"] != nil {
+		t.Errorf("unexpected web_search tool: %v", tool)
+	}
+}
+
+func TestZhipuProvider_ErrorCodeHint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"1303","message":"rate limited"}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewZhipuProvider(ProviderConfig{APIKey: "test-key", BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	_, err = provider.Complete(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "rate limit exceeded") {
+		t.Errorf("expected hint in error, got %v", err)
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "1303" || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected wrapped APIError with code 1303, got %v", err)
+	}
+}
+
+func TestOpenAIMessage_Images(t *testing.T) {
+	msgs := toOpenAIMessages([]Message{{Role: "user", Content: "What is this?", Images: []string{"https://example.com/cat.png"}}})
+
+	data, err := json.Marshal(msgs[0])
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	var out struct {
+		Role    string              `json:"role"`
+		Content []openAIContentPart `json:"content"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("expected content parts, got %s", data)
+	}
+	if len(out.Content) != 2 || out.Content[0].Text != "What is this?" || out.Content[1].ImageURL.URL != "https://example.com/cat.png" {
+		t.Errorf("unexpected content parts: %s", data)
+	}
+
+	// Plain messages keep string content
+	data, _ = json.Marshal(toOpenAIMessages([]Message{{Role: "user", Content: "hi"}})[0])
+	if !strings.Contains(string(data), `"content":"hi"`) {
+		t.Errorf("expected string content, got %s", data)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	for _, name := range []string{"deepseek", "moonshot"} {
+		preset, ok := LookupPreset(name)
+		if !ok {
+			t.Fatalf("expected preset for %s", name)
+		}
+		if preset.BaseURL == "" || preset.DefaultModel == "" || preset.ContextWindow == 0 {
+			t.Errorf("incomplete preset for %s: %+v", name, preset)
+		}
+
+		provider, err := New(ProviderConfig{Type: name, APIKey: "test-key"})
+		if err != nil {
+			t.Fatalf("New(%s) error = %v", name, err)
+		}
+		openai := provider.(*OpenAIProvider)
+		if openai.baseURL != preset.BaseURL || openai.model != preset.DefaultModel {
+			t.Errorf("%s provider not using preset defaults: %s %s", name, openai.baseURL, openai.model)
+		}
+	}
+
+	if _, ok := LookupPreset("unknown"); ok {
+		t.Error("expected no preset for unknown type")
+	}
+
+	all := Presets()
+	for i := 1; i < len(all); i++ {
+		if all[i-1].Name > all[i].Name {
+			t.Error("expected presets sorted by name")
+		}
+	}
+}
+
+func TestPromptCache(t *testing.T) {
+	var raw map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		json.NewDecoder(r.Body).Decode(&raw)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105,"prompt_tokens_details":{"cached_tokens":64}}}`))
+	}))
+	defer server.Close()
+
+	messages := []Message{{Role: "system", Content: "You are helpful"}, {Role: "user", Content: "Hi"}}
+	opts := &CompleteOptions{
+		Tools:    []ToolDefinition{{Type: "function", Function: &ToolFunctionDef{Name: "a"}}, {Type: "function", Function: &ToolFunctionDef{Name: "b"}}},
+		CacheKey: "conv-1",
+	}
+
+	anthropic, _ := NewOpenAIProvider(ProviderConfig{Type: "anthropic", APIKey: "k", BaseURL: server.URL, PromptCache: true})
+	resp, err := anthropic.CompleteWithOptions(context.Background(), messages, opts)
+	if err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if resp.CachedTokens != 64 {
+		t.Errorf("expected 64 cached tokens, got %d", resp.CachedTokens)
+	}
+	system := raw["messages"].([]interface{})[0].(map[string]interface{})
+	parts, ok := system["content"].([]interface{})
+	if !ok || parts[0].(map[string]interface{})["cache_control"] == nil {
+		t.Errorf("expected cache_control on system prompt, got %v", system["content"])
+	}
+	tools := raw["tools"].([]interface{})
+	if tools[0].(map[string]interface{})["cache_control"] != nil || tools[1].(map[string]interface{})["cache_control"] == nil {
+		t.Errorf("expected cache_control on last tool only, got %v", tools)
+	}
+	if opts.Tools[1].CacheControl != nil {
+		t.Error("caller's tool definitions should not be modified")
+	}
+
+	openai, _ := NewOpenAIProvider(ProviderConfig{Type: "openai", APIKey: "k", BaseURL: server.URL, PromptCache: true})
+	if _, err := openai.CompleteWithOptions(context.Background(), messages, opts); err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if raw["prompt_cache_key"] != "conv-1" {
+		t.Errorf("expected prompt_cache_key, got %v", raw["prompt_cache_key"])
+	}
+	if _, ok := raw["messages"].([]interface{})[0].(map[string]interface{})["content"].(string); !ok {
+		t.Error("expected plain system content for openai")
+	}
+
+	usage := openAIUsage{PromptCacheHitTokens: 32}
+	if usage.cachedTokens() != 32 {
+		t.Errorf("expected DeepSeek cache hits to be reported, got %d", usage.cachedTokens())
+	}
+}
+
+func TestCompleteStream_ReasoningAndToolCalls(t *testing.T) {
+	var req openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"role":"assistant","reasoning_content":"Let me "}}]}`,
+			`{"choices":[{"delta":{"reasoning_content":"think."}}]}`,
+			`{"choices":[{"delta":{"content":"Checking."}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"ls","arguments":"{\"pa"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"th\":\".\"}"}}]},"finish_reason":"tool_calls"}]}`,
+			`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	temperature := 0.5
+	provider, _ := NewOpenAIProvider(ProviderConfig{APIKey: "k", BaseURL: server.URL, Model: "o3-mini"})
+	var content, reasoning string
+	resp, err := provider.(StreamingProvider).CompleteStream(context.Background(),
+		[]Message{{Role: "user", Content: "hi"}},
+		&CompleteOptions{MaxTokens: 100, Temperature: &temperature},
+		StreamHandler{
+			OnContent:   func(s string) { content += s },
+			OnReasoning: func(s string) { reasoning += s },
+		})
+	if err != nil {
+		t.Fatalf("CompleteStream() error = %v", err)
+	}
+
+	if content != "Checking." || resp.Content != content {
+		t.Errorf("unexpected content: %q / %q", content, resp.Content)
+	}
+	if reasoning != "Let me think." || resp.Reasoning != reasoning {
+		t.Errorf("unexpected reasoning: %q / %q", reasoning, resp.Reasoning)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Function.Arguments != `{"path":"."}` {
+		t.Errorf("unexpected tool calls: %+v", resp.ToolCalls)
+	}
+	if resp.FinishReason != FinishReasonToolCalls || resp.TokensUsed != 15 {
+		t.Errorf("unexpected finish reason or usage: %s %d", resp.FinishReason, resp.TokensUsed)
+	}
+
+	if req.MaxCompletionTokens != 100 || req.MaxTokens != 0 {
+		t.Errorf("expected max_completion_tokens for o-series, got %d/%d", req.MaxCompletionTokens, req.MaxTokens)
+	}
+	if req.Temperature != nil {
+		t.Errorf("expected temperature omitted for reasoning model, got %v", *req.Temperature)
+	}
+}
+
+func TestIsReasoningModel(t *testing.T) {
+	tests := map[string]bool{
+		"o1":                true,
+		"o3-mini":           true,
+		"openai/o4-mini":    true,
+		"deepseek-reasoner": true,
+		"deepseek-r1":       true,
+		"gpt-4o-mini":       false,
+		"glm-4-flash":       false,
+		"omni":              false,
+	}
+	for model, want := range tests {
+		if got := IsReasoningModel(model); got != want {
+			t.Errorf("IsReasoningModel(%q) = %v, want %v", model, got, want)
+		}
+	}
+}
+
+func TestCompat(t *testing.T) {
+	var raw map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw = nil
+		json.NewDecoder(r.Body).Decode(&raw)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "1", Type: "function", Function: &ToolCallFunction{Name: "ls", Arguments: `{"path":"."}`}},
+			{ID: "2", Type: "function", Function: &ToolCallFunction{Name: "pwd", Arguments: `{}`}},
+		}},
+		{Role: "tool", ToolCallID: "1", Name: "ls", Content: "a.go"},
+		{Role: "tool", ToolCallID: "2", Name: "pwd", Content: "/src"},
+	}
+	opts := &CompleteOptions{Tools: []ToolDefinition{{Type: "function", Function: &ToolFunctionDef{Name: "ls"}}}}
+
+	roles := func() []string {
+		var r []string
+		for _, m := range raw["messages"].([]interface{}) {
+			r = append(r, m.(map[string]interface{})["role"].(string))
+		}
+		return r
+	}
+
+	// Standard behavior is unchanged
+	p, _ := NewOpenAIProvider(ProviderConfig{Type: "openai", APIKey: "k", BaseURL: server.URL})
+	if _, err := p.CompleteWithOptions(context.Background(), messages, opts); err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if got := strings.Join(roles(), ","); got != "system,user,assistant,tool,tool" {
+		t.Errorf("unexpected roles %s", got)
+	}
+	if _, ok := raw["parallel_tool_calls"]; ok {
+		t.Error("parallel_tool_calls should not be sent by default")
+	}
+
+	// Role renaming and disabled parallel tool calls
+	p, _ = NewOpenAIProvider(ProviderConfig{Type: "openai", APIKey: "k", BaseURL: server.URL, Compat: Compat{
+		Roles:                    map[string]string{"tool": "function"},
+		DisableParallelToolCalls: true,
+	}})
+	if _, err := p.CompleteWithOptions(context.Background(), messages, opts); err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if got := strings.Join(roles(), ","); got != "system,user,assistant,function,function" {
+		t.Errorf("unexpected renamed roles %s", got)
+	}
+	if raw["parallel_tool_calls"] != false {
+		t.Errorf("expected parallel_tool_calls=false, got %v", raw["parallel_tool_calls"])
+	}
+
+	// Tool results merged into a user message
+	p, _ = NewOpenAIProvider(ProviderConfig{Type: "openai", APIKey: "k", BaseURL: server.URL, Compat: Compat{MergeToolResults: true}})
+	if _, err := p.CompleteWithOptions(context.Background(), messages, opts); err != nil {
+		t.Fatalf("CompleteWithOptions() error = %v", err)
+	}
+	if got := strings.Join(roles(), ","); got != "system,user,assistant,user" {
+		t.Fatalf("unexpected merged roles %s", got)
+	}
+	sent := raw["messages"].([]interface{})
+	assistant := sent[2].(map[string]interface{})
+	if assistant["tool_calls"] != nil || !strings.Contains(assistant["content"].(string), `[Calling tool ls with {"path":"."}]`) {
+		t.Errorf("expected tool calls described as text, got %v", assistant)
+	}
+	results := sent[3].(map[string]interface{})["content"].(string)
+	if !strings.Contains(results, "[Result of tool ls]\na.go") || !strings.Contains(results, "[Result of tool pwd]\n/src") {
+		t.Errorf("expected both results in one user message, got %q", results)
+	}
+	if len(messages) != 5 || messages[3].Role != "tool" {
+		t.Error("caller's messages should not be modified")
+	}
+}
+
+func TestCompleteStream_Interrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// The connection closes before a finish reason or [DONE]
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello, wor\"}}]}\n\n")
+	}))
+	defer server.Close()
+
+	provider, _ := NewOpenAIProvider(ProviderConfig{APIKey: "k", BaseURL: server.URL, Model: "gpt-4o"})
+	var content string
+	_, err := provider.(StreamingProvider).CompleteStream(context.Background(),
+		[]Message{{Role: "user", Content: "hi"}}, nil,
+		StreamHandler{OnContent: func(s string) { content += s }})
+	if !errors.Is(err, ErrStreamInterrupted) {
+		t.Fatalf("expected ErrStreamInterrupted, got %v", err)
+	}
+	if content != "Hello, wor" {
+		t.Errorf("expected partial content to be delivered, got %q", content)
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	var req openAIEmbeddingRequest
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&req)
+		// Out of order on purpose; results are matched by index
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	p, _ := NewOpenAIProvider(ProviderConfig{Type: "openai", APIKey: "k", BaseURL: server.URL})
+	vectors, err := p.(Embedder).Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if path != "/embeddings" || req.Model != "text-embedding-3-small" || len(req.Input) != 2 {
+		t.Errorf("unexpected request to %s: %+v", path, req)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("unexpected vectors: %v", vectors)
+	}
+
+	// Presets without an embeddings endpoint
+	p, _ = NewOpenAIProvider(ProviderConfig{Type: "deepseek", APIKey: "k", BaseURL: server.URL})
+	if _, err := p.(Embedder).Embed(context.Background(), []string{"a"}); !errors.Is(err, ErrEmbeddingsUnsupported) {
+		t.Errorf("expected ErrEmbeddingsUnsupported, got %v", err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	if s := CosineSimilarity([]float64{1, 2}, []float64{2, 4}); s < 0.999 {
+		t.Errorf("expected parallel vectors to be similar, got %f", s)
+	}
+	if s := CosineSimilarity([]float64{1, 0}, []float64{0, 1}); s != 0 {
+		t.Errorf("expected orthogonal vectors to score 0, got %f", s)
+	}
+	if s := CosineSimilarity([]float64{1}, []float64{1, 0}); s != 0 {
+		t.Errorf("expected mismatched lengths to score 0, got %f", s)
+	}
+}
@@ -2,12 +2,40 @@ package llm
 
 import (
 	"context"
+	"errors"
+	"fmt"
 )
 
-// ZhipuProvider is a specialized provider for Z.AI/GLM models
-// Currently uses OpenAI-compatible mode, but can be extended for native API
+// ZhipuProvider is a specialized provider for Z.AI/GLM models.
+// It uses the OpenAI-compatible endpoints and layers GLM-native features on
+// top: the built-in web_search tool, Zhipu finish reasons, and error codes.
 type ZhipuProvider struct {
 	*OpenAIProvider
+	webSearch bool
+}
+
+// Zhipu-specific finish reasons
+const (
+	zhipuFinishSensitive    = "sensitive"     // Blocked by content moderation
+	zhipuFinishNetworkError = "network_error" // Inference failed upstream
+)
+
+// zhipuErrorHints maps Zhipu error codes to actionable explanations
+var zhipuErrorHints = map[string]string{
+	"1000": "authentication failed, check provider.api_key",
+	"1001": "authentication header missing",
+	"1002": "invalid API key, check provider.api_key",
+	"1003": "API key expired",
+	"1004": "authentication failed, check provider.api_key",
+	"1112": "account is locked",
+	"1113": "account balance is insufficient",
+	"1211": "model does not exist, check provider.model",
+	"1214": "invalid request parameters",
+	"1261": "prompt is too long for the model",
+	"1301": "content was blocked by the provider's safety filter",
+	"1302": "too many concurrent requests, retry later",
+	"1303": "request rate limit exceeded, retry later",
+	"1305": "too many requests, retry later",
 }
 
 // NewZhipuProvider creates a Z.AI specific provider
@@ -24,22 +52,82 @@ func NewZhipuProvider(cfg ProviderConfig) (Provider, error) {
 
 	return &ZhipuProvider{
 		OpenAIProvider: openai.(*OpenAIProvider),
+		webSearch:      cfg.WebSearch,
 	}, nil
 }
 
 func init() {
-	Register("glm", func(cfg ProviderConfig) (Provider, error) {
+	factory := func(cfg ProviderConfig) (Provider, error) {
 		return NewZhipuProvider(cfg)
-	})
+	}
+	Register("glm", factory)
+	Register("zhipu", factory)
 }
 
-// Complete overrides to add Z.AI specific handling if needed
+// Complete sends a completion request with GLM-specific handling
 func (p *ZhipuProvider) Complete(ctx context.Context, messages []Message) (*Response, error) {
-	// Add any Z.AI specific logic here
-	return p.OpenAIProvider.Complete(ctx, messages)
+	return p.CompleteWithOptions(ctx, messages, nil)
+}
+
+// CompleteWithOptions adds the web_search tool when enabled and normalizes
+// Zhipu finish reasons and error codes
+func (p *ZhipuProvider) CompleteWithOptions(ctx context.Context, messages []Message, opts *CompleteOptions) (*Response, error) {
+	resp, err := p.OpenAIProvider.CompleteWithOptions(ctx, messages, p.withWebSearch(opts))
+	return normalizeZhipuResponse(resp, err)
+}
+
+// CompleteStream streams a completion with the same GLM-specific handling
+// as CompleteWithOptions
+func (p *ZhipuProvider) CompleteStream(ctx context.Context, messages []Message, opts *CompleteOptions, handler StreamHandler) (*Response, error) {
+	resp, err := p.OpenAIProvider.CompleteStream(ctx, messages, p.withWebSearch(opts), handler)
+	return normalizeZhipuResponse(resp, err)
+}
+
+// normalizeZhipuResponse maps Zhipu finish reasons and error codes
+func normalizeZhipuResponse(resp *Response, err error) (*Response, error) {
+	if err != nil {
+		return nil, zhipuError(err)
+	}
+
+	switch resp.FinishReason {
+	case zhipuFinishSensitive:
+		resp.FinishReason = FinishReasonContentFilter
+	case zhipuFinishNetworkError:
+		return nil, fmt.Errorf("%w: GLM inference failed with a network error, retry the request", ErrStreamInterrupted)
+	}
+
+	return resp, nil
 }
 
 // Stream overrides to add Z.AI specific handling if needed
 func (p *ZhipuProvider) Stream(ctx context.Context, messages []Message, onChunk func(string)) error {
 	return p.OpenAIProvider.Stream(ctx, messages, onChunk)
 }
+
+// withWebSearch returns options with the built-in web_search tool appended
+func (p *ZhipuProvider) withWebSearch(opts *CompleteOptions) *CompleteOptions {
+	if !p.webSearch {
+		return opts
+	}
+
+	var withSearch CompleteOptions
+	if opts != nil {
+		withSearch = *opts
+	}
+	withSearch.Tools = append(append([]ToolDefinition(nil), withSearch.Tools...), ToolDefinition{
+		Type:      "web_search",
+		WebSearch: &WebSearchTool{Enable: true},
+	})
+	return &withSearch
+}
+
+// zhipuError annotates API errors with a hint for known Zhipu error codes
+func zhipuError(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if hint, ok := zhipuErrorHints[apiErr.Code]; ok {
+			return fmt.Errorf("%w (GLM error %s: %s)", err, apiErr.Code, hint)
+		}
+	}
+	return err
+}
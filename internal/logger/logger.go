@@ -41,13 +41,16 @@ func DefaultConfig() Config {
 
 var (
 	defaultLogger *slog.Logger
+	defaultOutput io.Writer = os.Stderr
 )
 
-// Init initializes the default logger with the given configuration.
+// Init initializes the default logger with the given configuration. A nil
+// output keeps the output of the last Init, stderr at first.
 func Init(cfg Config, output io.Writer) {
 	if output == nil {
-		output = os.Stderr
+		output = defaultOutput
 	}
+	defaultOutput = output
 
 	var handler slog.Handler
 	opts := &slog.HandlerOptions{
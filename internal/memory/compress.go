@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// CompressionLevel controls how retrieved snippets (memories and the
+// conversation summary) are shortened before they are injected
+type CompressionLevel string
+
+const (
+	CompressOff        CompressionLevel = "off"
+	CompressLight      CompressionLevel = "light"      // Whitespace and filler phrases
+	CompressMedium     CompressionLevel = "medium"     // Also drops low-information words
+	CompressAggressive CompressionLevel = "aggressive" // Also keeps only the first sentence of each line
+	CompressLLM        CompressionLevel = "llm"        // Rewrite with a (cheap) model, falling back to medium
+)
+
+// ParseCompressionLevel validates a configured compression level; empty means off
+func ParseCompressionLevel(s string) (CompressionLevel, error) {
+	switch level := CompressionLevel(strings.ToLower(strings.TrimSpace(s))); level {
+	case "":
+		return CompressOff, nil
+	case CompressOff, CompressLight, CompressMedium, CompressAggressive, CompressLLM:
+		return level, nil
+	default:
+		return "", fmt.Errorf("unknown compression level: %s", s)
+	}
+}
+
+// fillerPhrases are rewritten at every level; longer phrases come first
+var fillerPhrases = compileFillers([][2]string{
+	{"due to the fact that", "because"},
+	{"in order to", "to"},
+	{"it seems that", ""},
+	{"i think that", ""},
+	{"as a matter of fact", ""},
+	{"at this point in time", "now"},
+	{"basically", ""},
+	{"actually", ""},
+	{"really", ""},
+	{"very", ""},
+	{"just", ""},
+})
+
+type filler struct {
+	re *regexp.Regexp
+	to string
+}
+
+// compileFillers builds whole-word, case-insensitive matchers for phrases
+func compileFillers(phrases [][2]string) []filler {
+	fillers := make([]filler, len(phrases))
+	for i, p := range phrases {
+		fillers[i] = filler{re: regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(p[0]) + `\b`), to: p[1]}
+	}
+	return fillers
+}
+
+// stopWords carry little information in retrieved facts. Negations and
+// quantities are deliberately kept.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "is": true, "are": true, "was": true, "were": true,
+	"be": true, "been": true, "that": true, "which": true, "of": true, "so": true,
+	"also": true, "quite": true, "rather": true, "some": true, "there": true,
+}
+
+var (
+	spaceRe    = regexp.MustCompile(`[ \t]+`)
+	sentenceRe = regexp.MustCompile(`^(.+?[.!?])\s`)
+)
+
+// CompressSnippet shortens text heuristically, line by line so list
+// structure is preserved. Words containing digits, capitals or symbols are
+// never dropped, which keeps names, paths and identifiers intact.
+func CompressSnippet(text string, level CompressionLevel) string {
+	if level == CompressOff || level == "" {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = compressLine(line, level)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func compressLine(line string, level CompressionLevel) string {
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	body := strings.TrimSpace(line)
+
+	for _, f := range fillerPhrases {
+		body = f.re.ReplaceAllString(body, f.to)
+	}
+
+	if level == CompressAggressive {
+		if m := sentenceRe.FindStringSubmatch(body + " "); m != nil {
+			body = m[1]
+		}
+	}
+
+	if level == CompressMedium || level == CompressAggressive || level == CompressLLM {
+		words := strings.Fields(body)
+		kept := words[:0]
+		for _, w := range words {
+			if stopWords[w] {
+				continue
+			}
+			kept = append(kept, w)
+		}
+		body = strings.Join(kept, " ")
+	}
+
+	body = strings.TrimSpace(spaceRe.ReplaceAllString(body, " "))
+	return indent + body
+}
+
+// compressor applies the configured compression, caching model rewrites
+type compressor struct {
+	level    CompressionLevel
+	provider llm.Provider // Used by CompressLLM
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// compress shortens a snippet at the configured level
+func (c *compressor) compress(text string) string {
+	if c == nil || c.level == CompressOff || text == "" {
+		return text
+	}
+	if c.level != CompressLLM || c.provider == nil {
+		return CompressSnippet(text, c.level)
+	}
+
+	c.mu.Lock()
+	cached, ok := c.cache[text]
+	c.mu.Unlock()
+	if ok {
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	resp, err := c.provider.Complete(ctx, []llm.Message{
+		{
+			Role: "system",
+			Content: "Compress the following notes for use as context. Keep every fact, name, number and " +
+				"identifier; drop filler words and redundancy. Keep one line per note. Reply with the notes only.",
+		},
+		{Role: "user", Content: text},
+	})
+	if err != nil || strings.TrimSpace(resp.Content) == "" || len(resp.Content) >= len(text) {
+		// Fall back to the heuristic when the model fails or does not help
+		return CompressSnippet(text, CompressMedium)
+	}
+
+	result := strings.TrimSpace(resp.Content)
+	c.mu.Lock()
+	c.cache[text] = result
+	c.mu.Unlock()
+	return result
+}
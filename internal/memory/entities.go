@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// maxInjectedEntities caps the entities mentioned in a message that are
+// injected; related entities are injected up to twice as many in total
+const maxInjectedEntities = 5
+
+// entityContext describes the entities named in the message, and the
+// entities they relate to, for the context. It is empty when none is
+// named.
+func (m *Manager) entityContext(message string) string {
+	entities, err := m.store.ListEntities()
+	if err != nil {
+		m.log.Warn("loading entities failed", "error", err)
+		return ""
+	}
+	mentioned := mentionedEntities(entities, message)
+	if len(mentioned) == 0 {
+		return ""
+	}
+	if len(mentioned) > maxInjectedEntities {
+		mentioned = mentioned[:maxInjectedEntities]
+	}
+	m.log.Debug("entities mentioned", "count", len(mentioned))
+
+	byKey := make(map[string]*storage.Entity, len(entities))
+	for _, e := range entities {
+		byKey[storage.EntityKey(e.Name)] = e
+	}
+
+	// The mentioned entities first, then those they relate to
+	seen := make(map[string]bool)
+	var lines []string
+	add := func(e *storage.Entity) {
+		if key := storage.EntityKey(e.Name); !seen[key] && len(lines) < 2*maxInjectedEntities {
+			seen[key] = true
+			lines = append(lines, "- "+e.Describe())
+		}
+	}
+	for _, e := range mentioned {
+		add(e)
+	}
+	for _, e := range mentioned {
+		for _, r := range e.Relations {
+			if target, ok := byKey[storage.EntityKey(r.Target)]; ok {
+				add(target)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mentionedEntities returns the entities whose name or an alias appears in
+// the text as a whole word, ignoring case
+func mentionedEntities(entities []*storage.Entity, text string) []*storage.Entity {
+	text = strings.ToLower(text)
+	var mentioned []*storage.Entity
+	for _, e := range entities {
+		for _, name := range e.Names() {
+			if containsWord(text, storage.EntityKey(name)) {
+				mentioned = append(mentioned, e)
+				break
+			}
+		}
+	}
+	return mentioned
+}
+
+// containsWord reports whether word occurs in text without a letter or
+// digit directly before or after it
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
@@ -0,0 +1,126 @@
+package memory
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// DefaultExtractPrompt is the system prompt of the memory extractor. Replies
+// are parsed one memory per line, as "type: content".
+const DefaultExtractPrompt = "Extract the facts from the following conversation that are worth remembering in future " +
+	"conversations: the user's preferences, facts about them and their projects, and lasting decisions. " +
+	"Skip anything only relevant to this conversation. Reply with one memory per line as " +
+	"\"fact: ...\", \"preference: ...\" or \"context: ...\", or with NONE if there is nothing worth remembering."
+
+// extractedTag marks memories extracted from summarized conversations
+const extractedTag = "extracted"
+
+// listMarkerRe matches a bullet or number starting a list item
+var listMarkerRe = regexp.MustCompile(`^(?:[-*•]|\d+[.)])\s+`)
+
+// extractedRelevance is the relevance of extracted memories, below the 1.0
+// of memories the user added, unless they are scored
+const extractedRelevance = 0.8
+
+// extractMemories saves the facts worth remembering from summarized
+// messages as global memories, skipping ones already stored, and returns
+// how many were saved
+func (m *Manager) extractMemories(ctx context.Context, conversationID string, messages []llm.Message) int {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	resp, err := m.provider.Complete(ctx, []llm.Message{
+		{Role: "system", Content: m.summarization.ExtractPrompt},
+		{Role: "user", Content: formatMessagesForSummary(messages)},
+	})
+	if err != nil {
+		m.log.Error("memory extraction failed", "error", err)
+		return 0
+	}
+
+	existing, err := m.store.LoadMemories()
+	if err != nil {
+		m.log.Error("loading memories failed", "error", err)
+		return 0
+	}
+	taken := make(map[string]bool, len(existing))
+	known := make(map[string]bool, len(existing))
+	for _, mem := range existing {
+		taken[mem.ID] = true
+		known[contentKey(mem)] = true
+	}
+
+	added := 0
+	for _, line := range strings.Split(resp.Content, "\n") {
+		memType, content, ok := parseExtractedMemory(line)
+		if !ok {
+			continue
+		}
+		mem := &storage.MemoryItem{
+			ID:        uniqueID(taken),
+			Content:   content,
+			Type:      memType,
+			CreatedAt: time.Now(),
+			Relevance: extractedRelevance,
+			Tags:      []string{extractedTag},
+		}
+		if known[contentKey(mem)] {
+			continue
+		}
+		if m.scoring {
+			if memType, importance, err := m.ScoreMemory(ctx, mem.Content, mem.Type); err != nil {
+				m.log.Warn("scoring extracted memory failed", "error", err)
+			} else {
+				mem.Type, mem.Relevance = memType, importance
+			}
+		}
+		m.embedMemory(mem)
+		if err := m.store.SaveMemory(mem); err != nil {
+			m.log.Error("saving extracted memory failed", "error", err)
+			continue
+		}
+		taken[mem.ID] = true
+		known[contentKey(mem)] = true
+		added++
+	}
+
+	m.log.Info("memories extracted", "conversation_id", conversationID, "count", added)
+	return added
+}
+
+// parseExtractedMemory parses one line of the extractor's reply: an
+// optional list marker, an optional "type:" or "[type]" prefix (fact by
+// default) and the content
+func parseExtractedMemory(line string) (memType, content string, ok bool) {
+	line = listMarkerRe.ReplaceAllString(strings.TrimSpace(line), "")
+	if line == "" || strings.EqualFold(strings.Trim(line, "."), "none") {
+		return "", "", false
+	}
+
+	memType = "fact"
+	if rest, found := strings.CutPrefix(line, "["); found {
+		if t, c, found := strings.Cut(rest, "]"); found && ValidType(t) {
+			memType, line = strings.ToLower(strings.TrimSpace(t)), c
+		}
+	} else if t, c, found := strings.Cut(line, ":"); found && ValidType(t) {
+		memType, line = strings.ToLower(strings.TrimSpace(t)), c
+	}
+
+	content = strings.TrimSpace(line)
+	return memType, content, content != ""
+}
+
+// ValidType reports whether t names a memory type: fact, preference or
+// context, in any case
+func ValidType(t string) bool {
+	switch strings.ToLower(strings.TrimSpace(t)) {
+	case "fact", "preference", "context":
+		return true
+	}
+	return false
+}
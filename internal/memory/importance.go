@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// DefaultScorePrompt is the system prompt of the importance scorer. Replies
+// are parsed as "type: ..." and "importance: ..." lines.
+const DefaultScorePrompt = "Rate how important the following memory is for future conversations with the user, " +
+	"from 0 (trivia) to 1 (essential, e.g. a lasting decision or a strong preference), and classify it as " +
+	"fact, preference or context. Reply with exactly two lines: \"type: <fact|preference|context>\" and " +
+	"\"importance: <0-1>\"."
+
+// scoreTimeout bounds an importance scoring call
+const scoreTimeout = 15 * time.Second
+
+// SetScoring enables asking the model for the importance and type of
+// memories the model adds or extracts. An empty prompt uses
+// DefaultScorePrompt.
+func (m *Manager) SetScoring(enabled bool, prompt string) {
+	if strings.TrimSpace(prompt) == "" {
+		prompt = DefaultScorePrompt
+	}
+	m.scoring, m.scorePrompt = enabled, prompt
+}
+
+// ScoreMemory asks the model how important a memory is (0-1) and which type
+// it is. memType is the type proposed by the caller and is kept when the
+// reply does not name a valid one.
+func (m *Manager) ScoreMemory(ctx context.Context, content, memType string) (string, float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, scoreTimeout)
+	defer cancel()
+
+	resp, err := m.provider.Complete(ctx, []llm.Message{
+		{Role: "system", Content: m.scorePrompt},
+		{Role: "user", Content: fmt.Sprintf("Proposed type: %s\nMemory: %s", memType, content)},
+	})
+	if err != nil {
+		return memType, 0, err
+	}
+
+	scoredType, importance, err := parseScore(resp.Content)
+	if err != nil {
+		return memType, 0, err
+	}
+	if scoredType == "" {
+		scoredType = memType
+	}
+	m.log.Debug("memory scored", "type", scoredType, "importance", importance)
+	return scoredType, importance, nil
+}
+
+// parseScore reads the type and importance from the scorer's reply. The
+// importance is required and clamped to 0-1; the type is empty if missing
+// or unknown.
+func parseScore(reply string) (memType string, importance float64, err error) {
+	found := false
+	for _, line := range strings.Split(reply, "\n") {
+		key, value, ok := strings.Cut(listMarkerRe.ReplaceAllString(strings.TrimSpace(line), ""), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimRight(strings.Trim(strings.TrimSpace(value), `"*`), ".")
+		switch strings.ToLower(strings.Trim(strings.TrimSpace(key), "*")) {
+		case "type":
+			if ValidType(value) {
+				memType = strings.ToLower(value)
+			}
+		case "importance":
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid importance %q", value)
+			}
+			importance, found = min(max(v, 0), 1), true
+		}
+	}
+	if !found {
+		return "", 0, fmt.Errorf("no importance in reply %q", reply)
+	}
+	return memType, importance, nil
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"sort"
+	"slices"
 	"strings"
 	"time"
 
@@ -20,7 +20,67 @@ type Manager struct {
 	maxMessages   int
 	maxTokens     int
 	summarizeWhen int
+	compressor    *compressor // Shortens retrieved snippets; nil = off
 	log           *slog.Logger
+
+	// Retrieval of memories for BuildContext
+	topK          int     // Memories injected per query
+	minSimilarity float64 // Embedding similarity a memory needs to be injected
+	embeddingID   string  // Identifies the embedding model in memory embedding hashes
+
+	summarization Summarization
+
+	// Importance scoring of memories the model adds or extracts
+	scoring     bool
+	scorePrompt string
+}
+
+// DefaultSummaryPrompt is the system prompt of the summarizer
+const DefaultSummaryPrompt = "Summarize the following conversation concisely, preserving key facts, decisions, and context. Be brief but comprehensive."
+
+// DefaultAbstractPrompt is the system prompt that merges the recent summary
+// into the long-term summary
+const DefaultAbstractPrompt = "Merge the following summaries of a long conversation into one concise long-term summary. " +
+	"Keep every decision, agreed fact, requirement and open question, even old ones; drop details that no longer matter."
+
+// defaultKeepMessages is how many recent messages summarization keeps verbatim
+const defaultKeepMessages = 10
+
+// defaultSummaryMaxTokens is the size of the recent summary at which it is
+// merged into the long-term summary
+const defaultSummaryMaxTokens = 500
+
+// Summarization configures how a conversation that reached summarizeWhen
+// messages is compressed. Zero fields use the defaults.
+type Summarization struct {
+	KeepMessages  int    // Recent messages kept verbatim
+	SummaryPrompt string // System prompt of the summarizer
+
+	SummaryMaxTokens int    // Size of the recent summary that is merged into the long-term one
+	AbstractPrompt   string // System prompt of the long-term merge
+
+	ExtractMemories bool   // Also save facts from the summarized messages as memories
+	ExtractPrompt   string // System prompt of the extractor
+}
+
+// SetSummarization configures summarization and memory extraction
+func (m *Manager) SetSummarization(s Summarization) {
+	if s.KeepMessages <= 0 {
+		s.KeepMessages = defaultKeepMessages
+	}
+	if strings.TrimSpace(s.SummaryPrompt) == "" {
+		s.SummaryPrompt = DefaultSummaryPrompt
+	}
+	if s.SummaryMaxTokens <= 0 {
+		s.SummaryMaxTokens = defaultSummaryMaxTokens
+	}
+	if strings.TrimSpace(s.AbstractPrompt) == "" {
+		s.AbstractPrompt = DefaultAbstractPrompt
+	}
+	if strings.TrimSpace(s.ExtractPrompt) == "" {
+		s.ExtractPrompt = DefaultExtractPrompt
+	}
+	m.summarization = s
 }
 
 // NewManager creates a new memory manager
@@ -32,7 +92,39 @@ func NewManager(store *storage.JSONStore, provider llm.Provider, maxMessages, ma
 		maxTokens:     maxTokens,
 		summarizeWhen: summarizeWhen,
 		log:           logger.L().With("component", "memory"),
+		topK:          defaultTopK,
+		minSimilarity: defaultMinSimilarity,
+		summarization: Summarization{
+			KeepMessages:     defaultKeepMessages,
+			SummaryPrompt:    DefaultSummaryPrompt,
+			SummaryMaxTokens: defaultSummaryMaxTokens,
+			AbstractPrompt:   DefaultAbstractPrompt,
+			ExtractPrompt:    DefaultExtractPrompt,
+		},
+		scorePrompt: DefaultScorePrompt,
+	}
+}
+
+// SetProvider sets the provider of summaries, memory extraction and
+// importance scoring, such as one metered by the agent; the compression
+// provider is set by SetCompression
+func (m *Manager) SetProvider(provider llm.Provider) {
+	m.provider = provider
+}
+
+// SetCompression enables compression of retrieved memories and the
+// conversation summary. The provider is only used at CompressLLM and may be
+// a cheaper model than the one answering.
+func (m *Manager) SetCompression(level CompressionLevel, provider llm.Provider) {
+	if level == CompressOff || level == "" {
+		m.compressor = nil
+		return
+	}
+	if provider == nil {
+		provider = m.provider
 	}
+	m.compressor = &compressor{level: level, provider: provider, cache: make(map[string]string)}
+	m.log.Debug("snippet compression enabled", "level", level)
 }
 
 // BuildContext builds the optimal context for a new query
@@ -41,10 +133,10 @@ func (m *Manager) BuildContext(conv *storage.Conversation, userMessage string) (
 	var context []llm.Message
 
 	// 1. Start with relevant memories
-	memories, err := m.getRelevantMemories(userMessage)
+	memories, err := m.getRelevantMemories(userMessage, conv.ID)
 	if err == nil && len(memories) > 0 {
 		m.log.Debug("relevant memories found", "count", len(memories))
-		memoryContext := m.formatMemories(memories)
+		memoryContext := m.compressor.compress(m.formatMemories(memories))
 		if memoryContext != "" {
 			context = append(context, llm.Message{
 				Role:    "system",
@@ -53,86 +145,58 @@ func (m *Manager) BuildContext(conv *storage.Conversation, userMessage string) (
 		}
 	}
 
-	// 2. Add conversation summary if available
+	// 2. Describe the entities the message mentions
+	if entities := m.entityContext(userMessage); entities != "" {
+		context = append(context, llm.Message{
+			Role:    "system",
+			Content: "Known entities mentioned:\n" + m.compressor.compress(entities),
+		})
+	}
+
+	// 3. Add conversation summaries if available, the long-term one first
+	if conv.LongTermSummary != "" {
+		context = append(context, llm.Message{
+			Role:    "system",
+			Content: "Long-term conversation summary: " + m.compressor.compress(conv.LongTermSummary),
+		})
+	}
 	if conv.Summary != "" {
 		m.log.Debug("using conversation summary")
 		context = append(context, llm.Message{
 			Role:    "system",
-			Content: "Previous conversation summary: " + conv.Summary,
+			Content: "Previous conversation summary: " + m.compressor.compress(conv.Summary),
 		})
 	}
 
-	// 3. Add recent messages (sliding window)
+	// 4. Add recent messages (sliding window)
 	recentMessages := m.getRecentMessages(conv.Messages, userMessage)
 	context = append(context, recentMessages...)
 	m.log.Debug("recent messages added", "count", len(recentMessages))
 
-	// 4. Check if we need summarization
+	// 5. Check if we need summarization
 	if len(conv.Messages) >= m.summarizeWhen {
 		m.log.Info("summarization threshold reached, triggering async summarization",
 			"message_count", len(conv.Messages),
 			"threshold", m.summarizeWhen,
 		)
-		go m.summarizeConversation(conv) // Async summarization
+		// Async summarization, of a copy: the caller goes on adding the
+		// turn to conv
+		go m.summarizeConversation(conv.Clone())
 	}
 
 	return context, nil
 }
 
-// getRelevantMemories retrieves memories relevant to the query
-func (m *Manager) getRelevantMemories(query string) ([]*storage.MemoryItem, error) {
-	memories, err := m.store.LoadMemories()
-	if err != nil {
-		return nil, err
-	}
-
-	// Simple keyword-based relevance scoring
-	// In production, this could use embeddings
-	queryLower := strings.ToLower(query)
-	var relevant []*storage.MemoryItem
-
-	for _, mem := range memories {
-		if mem.Relevance < 0.3 {
-			continue
-		}
-
-		contentLower := strings.ToLower(mem.Content)
-		score := 0.0
-
-		// Check for keyword matches
-		queryWords := strings.Fields(queryLower)
-		for _, word := range queryWords {
-			if len(word) > 3 && strings.Contains(contentLower, word) {
-				score += 0.2
-			}
-		}
-
-		// Boost by stored relevance
-		score = score * mem.Relevance
-
-		if score > 0.1 {
-			relevant = append(relevant, mem)
-		}
-	}
-
-	// Sort by relevance
-	sort.Slice(relevant, func(i, j int) bool {
-		return relevant[i].Relevance > relevant[j].Relevance
-	})
-
-	// Limit to top 5 memories
-	if len(relevant) > 5 {
-		relevant = relevant[:5]
-	}
-
-	return relevant, nil
-}
-
-// formatMemories formats memories for context
+// formatMemories formats memories for context, marking those that belong
+// to the conversation
 func (m *Manager) formatMemories(memories []*storage.MemoryItem) string {
 	var parts []string
 	for _, mem := range memories {
-		parts = append(parts, fmt.Sprintf("- [%s] %s", mem.Type, mem.Content))
+		label := mem.Type
+		if mem.Scope != "" {
+			label += ", this conversation"
+		}
+		parts = append(parts, fmt.Sprintf("- [%s] %s", label, mem.Content))
 	}
 	return strings.Join(parts, "\n")
 }
@@ -163,10 +227,16 @@ func (m *Manager) getRecentMessages(messages []llm.Message, newUserMessage strin
 		}
 	}
 
+	// Tool results are only valid after the assistant message requesting them
+	for len(recent) > 0 && recent[0].Role == "tool" {
+		recent = recent[1:]
+	}
+
 	return append(recent, result...)
 }
 
-// summarizeConversation creates a summary of old messages
+// summarizeConversation creates a summary of old messages once the
+// conversation reaches summarizeWhen messages
 func (m *Manager) summarizeConversation(conv *storage.Conversation) {
 	if len(conv.Messages) < m.summarizeWhen {
 		return
@@ -177,70 +247,219 @@ func (m *Manager) summarizeConversation(conv *storage.Conversation) {
 		"message_count", len(conv.Messages),
 	)
 
-	// Keep last 10 messages, summarize the rest
-	keepCount := 10
-	if len(conv.Messages) <= keepCount {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	startTime := time.Now()
+	result, err := m.summarize(ctx, conv, m.summarization.ExtractMemories)
+	if err != nil {
+		m.log.Error("summarization failed", "error", err)
 		return
 	}
+	if result.Summarized == 0 {
+		return
+	}
+
+	m.log.Info("summarization completed",
+		"conversation_id", conv.ID,
+		"summary_length", len(conv.Summary),
+		"tokens_saved", result.TokensSaved(),
+		"duration_ms", time.Since(startTime).Milliseconds(),
+	)
+}
+
+// CompactResult reports what compacting a conversation did
+type CompactResult struct {
+	Summarized   int // Messages folded into the summary
+	Kept         int // Recent messages kept verbatim
+	TokensBefore int // Estimated tokens of the summary and messages before
+	TokensAfter  int // Estimated tokens of the summary and messages after
+	Memories     int // Memories extracted from the summarized messages
+
+	// Merged is set when the previous recent summary was merged into the
+	// long-term summary
+	Merged bool
+}
+
+// TokensSaved is the estimated reduction of the conversation's context
+func (r *CompactResult) TokensSaved() int {
+	return r.TokensBefore - r.TokensAfter
+}
+
+// String describes the result for the user
+func (r *CompactResult) String() string {
+	if r.Summarized == 0 {
+		return fmt.Sprintf("Nothing to compact: only %d messages, all kept verbatim", r.Kept)
+	}
+	s := fmt.Sprintf("Summarized %d messages, kept %d; ~%d tokens saved (%d -> %d)",
+		r.Summarized, r.Kept, r.TokensSaved(), r.TokensBefore, r.TokensAfter)
+	if r.Merged {
+		s += "; earlier summary merged into the long-term summary"
+	}
+	if r.Memories > 0 {
+		s += fmt.Sprintf("; %d memories extracted", r.Memories)
+	}
+	return s
+}
+
+// Compact summarizes all but the most recent messages of a conversation now
+// instead of at summarizeWhen, and saves it. Memories are extracted when
+// extract or memory extraction is enabled.
+func (m *Manager) Compact(ctx context.Context, conv *storage.Conversation, extract bool) (*CompactResult, error) {
+	return m.summarize(ctx, conv, extract || m.summarization.ExtractMemories)
+}
+
+// summarize folds all but the most recent messages into the conversation
+// summary, together with the previous summary, and saves the conversation.
+// A previous summary grown past SummaryMaxTokens is first merged into the
+// long-term summary, so the recent summary stays detailed while older
+// decisions survive in the abstract.
+func (m *Manager) summarize(ctx context.Context, conv *storage.Conversation, extract bool) (*CompactResult, error) {
+	keepCount := m.summarization.KeepMessages
+	result := &CompactResult{Kept: min(len(conv.Messages), keepCount)}
+	if len(conv.Messages) <= keepCount {
+		return result, nil
+	}
+
+	// Keep tool results together with the tool calls they answer
+	split := len(conv.Messages) - keepCount
+	for split > 0 && conv.Messages[split].Role == "tool" {
+		split--
+	}
+	if split == 0 {
+		return result, nil
+	}
+	keepCount = len(conv.Messages) - split
+	result.Kept = keepCount
 
-	toSummarize := conv.Messages[:len(conv.Messages)-keepCount]
+	toSummarize := slices.Clone(conv.Messages[:split])
 	m.log.Debug("messages to summarize", "count", len(toSummarize))
+	result.TokensBefore = m.conversationTokens(conv)
+
+	if m.summaryTokens(conv.Summary) > m.summarization.SummaryMaxTokens {
+		abstract, err := m.mergeLongTerm(ctx, conv)
+		if err != nil {
+			return nil, fmt.Errorf("merging long-term summary: %w", err)
+		}
+		conv.LongTermSummary, conv.Summary = abstract, ""
+		result.Merged = true
+	}
 
+	content := formatMessagesForSummary(toSummarize)
+	if conv.Summary != "" {
+		content = "Summary of the conversation before these messages:\n" + conv.Summary + "\n\n" + content
+	}
 	summarizePrompt := []llm.Message{
 		{
 			Role:    "system",
-			Content: "Summarize the following conversation concisely, preserving key facts, decisions, and context. Be brief but comprehensive.",
+			Content: m.summarization.SummaryPrompt,
 		},
 		{
 			Role:    "user",
-			Content: formatMessagesForSummary(toSummarize),
+			Content: content,
 		},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	startTime := time.Now()
 	resp, err := m.provider.Complete(ctx, summarizePrompt)
 	if err != nil {
-		m.log.Error("summarization failed", "error", err)
-		return
+		return nil, err
 	}
 
 	// Update conversation with summary
 	conv.Summary = resp.Content
-	conv.Messages = conv.Messages[len(conv.Messages)-keepCount:]
-	m.store.SaveConversation(conv)
+	conv.DropMessages(len(conv.Messages) - keepCount)
+	if err := m.store.SaveConversation(conv); err != nil {
+		return nil, fmt.Errorf("saving conversation: %w", err)
+	}
+	result.Summarized = len(toSummarize)
+	result.TokensAfter = m.conversationTokens(conv)
 
-	m.log.Info("summarization completed",
-		"conversation_id", conv.ID,
-		"summary_length", len(resp.Content),
-		"duration_ms", time.Since(startTime).Milliseconds(),
-	)
+	if extract {
+		result.Memories = m.extractMemories(ctx, conv.ID, storage.Transcript(toSummarize))
+	}
+	return result, nil
 }
 
-// formatMessagesForSummary formats messages for summarization
+// mergeLongTerm merges the recent summary into the long-term summary
+func (m *Manager) mergeLongTerm(ctx context.Context, conv *storage.Conversation) (string, error) {
+	content := "Recent summary:\n" + conv.Summary
+	if conv.LongTermSummary != "" {
+		content = "Long-term summary:\n" + conv.LongTermSummary + "\n\n" + content
+	}
+	resp, err := m.provider.Complete(ctx, []llm.Message{
+		{Role: "system", Content: m.summarization.AbstractPrompt},
+		{Role: "user", Content: content},
+	})
+	if err != nil {
+		return "", err
+	}
+	m.log.Debug("recent summary merged into long-term summary", "conversation_id", conv.ID)
+	return resp.Content, nil
+}
+
+// summaryTokens estimates the context tokens of a summary
+func (m *Manager) summaryTokens(summary string) int {
+	if summary == "" {
+		return 0
+	}
+	return m.provider.CountTokens([]llm.Message{{Role: "system", Content: summary}})
+}
+
+// conversationTokens estimates the context tokens of a conversation's
+// summaries and messages
+func (m *Manager) conversationTokens(conv *storage.Conversation) int {
+	return m.provider.CountTokens(conv.Messages) + m.summaryTokens(conv.LongTermSummary) + m.summaryTokens(conv.Summary)
+}
+
+// summaryToolOutput caps the tool results included in summarizer input
+const summaryToolOutput = 500
+
+// formatMessagesForSummary formats messages for summarization. Tool calls
+// and the start of their results are included, so the summary can keep
+// what the agent did.
 func formatMessagesForSummary(messages []llm.Message) string {
 	var parts []string
 	for _, msg := range messages {
-		parts = append(parts, fmt.Sprintf("%s: %s", msg.Role, msg.Content))
+		switch {
+		case msg.Role == "tool":
+			output := msg.Content
+			if len(output) > summaryToolOutput {
+				output = output[:summaryToolOutput] + "..."
+			}
+			parts = append(parts, fmt.Sprintf("tool %s result: %s", msg.Name, output))
+		case len(msg.ToolCalls) > 0:
+			if msg.Content != "" {
+				parts = append(parts, fmt.Sprintf("%s: %s", msg.Role, msg.Content))
+			}
+			for _, tc := range msg.ToolCalls {
+				if tc.Function != nil {
+					parts = append(parts, fmt.Sprintf("%s called %s(%s)", msg.Role, tc.Function.Name, tc.Function.Arguments))
+				}
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("%s: %s", msg.Role, msg.Content))
+		}
 	}
 	return strings.Join(parts, "\n\n")
 }
 
-// AddMemory adds a new memory manually
-func (m *Manager) AddMemory(content, memType string) error {
+// AddMemory adds a new memory manually. scope is the conversation it
+// belongs to; empty makes it global.
+func (m *Manager) AddMemory(content, memType, scope string, tags ...string) error {
 	memory := &storage.MemoryItem{
 		ID:        generateID(),
 		Content:   content,
 		Type:      memType,
 		CreatedAt: time.Now(),
 		Relevance: 1.0,
+		Scope:     scope,
+		Tags:      storage.NormalizeTags(tags),
 	}
+	m.embedMemory(memory)
 	if err := m.store.SaveMemory(memory); err != nil {
 		return err
 	}
-	m.log.Info("memory added", "type", memType, "content_length", len(content))
+	m.log.Info("memory added", "type", memType, "scope", scope, "content_length", len(content))
 	return nil
 }
 
@@ -1,8 +1,13 @@
 package memory
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/igm/igent/internal/llm"
@@ -119,7 +124,7 @@ func TestAddMemory(t *testing.T) {
 	provider := &mockProvider{}
 	mgr := NewManager(store, provider, 10, 1000, 5)
 
-	if err := mgr.AddMemory("User prefers dark mode", "preference"); err != nil {
+	if err := mgr.AddMemory("User prefers dark mode", "preference", ""); err != nil {
 		t.Fatalf("failed to add memory: %v", err)
 	}
 
@@ -167,7 +172,7 @@ func TestGetRelevantMemories(t *testing.T) {
 	mgr := NewManager(store, provider, 10, 1000, 5)
 
 	// Query related to programming
-	memories, err := mgr.getRelevantMemories("help me with programming")
+	memories, err := mgr.getRelevantMemories("help me with programming", "")
 	if err != nil {
 		t.Fatalf("failed to get relevant memories: %v", err)
 	}
@@ -177,3 +182,550 @@ func TestGetRelevantMemories(t *testing.T) {
 		t.Error("expected at least one relevant memory")
 	}
 }
+
+// embeddingProvider embeds text as counts of a few topic words, so
+// similarity follows the topics two texts share
+type embeddingProvider struct {
+	mockProvider
+	inputs int // Texts embedded so far
+}
+
+func (p *embeddingProvider) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	p.inputs += len(texts)
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		text = strings.ToLower(text)
+		for _, topic := range []string{"go", "coffee", "deploy"} {
+			vectors[i] = append(vectors[i], float64(strings.Count(text, topic)))
+		}
+	}
+	return vectors, nil
+}
+
+func TestGetRelevantMemories_Embeddings(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	provider := &embeddingProvider{}
+	mgr := NewManager(store, provider, 10, 1000, 50)
+	mgr.SetRetrieval(2, 0.5, "test/model")
+
+	// Embedded on save
+	if err := mgr.AddMemory("Drinks coffee black", "preference", ""); err != nil {
+		t.Fatalf("AddMemory failed: %v", err)
+	}
+	memories, _ := store.LoadMemories()
+	if len(memories) != 1 || len(memories[0].Embedding) != 3 || memories[0].EmbeddingHash == "" {
+		t.Fatalf("expected the memory saved with its embedding, got %+v", memories)
+	}
+
+	// Others are embedded at retrieval
+	store.SaveMemory(&storage.MemoryItem{ID: "go", Content: "Writes Go services", Relevance: 1})
+	store.SaveMemory(&storage.MemoryItem{ID: "godeploy", Content: "Deploys Go with a deploy script", Relevance: 1})
+	store.SaveMemory(&storage.MemoryItem{ID: "gogo", Content: "Likes Go and more Go", Relevance: 1})
+	provider.inputs = 0
+	relevant, err := mgr.getRelevantMemories("Go question", "")
+	if err != nil {
+		t.Fatalf("getRelevantMemories failed: %v", err)
+	}
+	if len(relevant) != 2 || relevant[0].ID != "go" && relevant[0].ID != "gogo" {
+		t.Errorf("expected the top 2 Go memories, got %+v", relevant)
+	}
+	for _, mem := range relevant {
+		if mem.ID == "godeploy" || strings.Contains(mem.Content, "coffee") {
+			t.Errorf("unexpected memory %q", mem.Content)
+		}
+	}
+	if provider.inputs != 4 {
+		t.Errorf("expected the query and 3 memories embedded, got %d", provider.inputs)
+	}
+
+	// Cached embeddings are reused until the content changes
+	provider.inputs = 0
+	mgr.getRelevantMemories("coffee", "")
+	if provider.inputs != 1 {
+		t.Errorf("expected only the query embedded, got %d", provider.inputs)
+	}
+	if _, err := store.UpdateMemory("go", map[string]interface{}{"content": "Writes Go and coffee scripts"}); err != nil {
+		t.Fatal(err)
+	}
+	provider.inputs = 0
+	relevant, _ = mgr.getRelevantMemories("coffee", "")
+	if provider.inputs != 2 {
+		t.Errorf("expected the query and the edited memory embedded, got %d", provider.inputs)
+	}
+	if len(relevant) != 2 || !strings.Contains(relevant[0].Content, "black") || relevant[1].ID != "go" {
+		t.Errorf("expected the coffee memories, most similar first, got %+v", relevant)
+	}
+
+	// Another model invalidates every embedding
+	mgr.SetRetrieval(0, 0, "test/other")
+	provider.inputs = 0
+	mgr.getRelevantMemories("coffee", "")
+	if provider.inputs != 5 {
+		t.Errorf("expected all memories embedded again, got %d", provider.inputs)
+	}
+}
+
+func TestBuildContext_ScopedMemories(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	mgr := NewManager(store, &mockProvider{}, 10, 1000, 50)
+	if err := mgr.AddMemory("Deploys use the blue cluster", "fact", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.AddMemory("Deploys of this service need approval", "fact", "svc"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, _ := mgr.BuildContext(&storage.Conversation{ID: "svc"}, "how do deploys work")
+	if len(messages) < 2 || !strings.Contains(messages[0].Content, "blue cluster") ||
+		!strings.Contains(messages[0].Content, "[fact, this conversation] Deploys of this service") {
+		t.Errorf("expected global and conversation memories merged, got %+v", messages)
+	}
+
+	messages, _ = mgr.BuildContext(&storage.Conversation{ID: "other"}, "how do deploys work")
+	if len(messages) < 2 || strings.Contains(messages[0].Content, "approval") || !strings.Contains(messages[0].Content, "blue cluster") {
+		t.Errorf("expected only the global memory in another conversation, got %+v", messages)
+	}
+}
+
+func TestExportImportMemories(t *testing.T) {
+	src, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	srcMgr := NewManager(src, &embeddingProvider{}, 10, 1000, 50)
+	srcMgr.AddMemory("Prefers Go", "preference", "", "lang")
+	srcMgr.AddMemory("Deploys need approval", "fact", "svc")
+	src.SaveMemory(&storage.MemoryItem{ID: "shared", Content: "Works at Acme", Type: "fact", Relevance: 0.7})
+
+	var buf bytes.Buffer
+	n, err := srcMgr.ExportMemories(&buf, storage.MemoryFilter{})
+	if err != nil || n != 3 {
+		t.Fatalf("ExportMemories = %d, %v", n, err)
+	}
+	if strings.Contains(buf.String(), "embedding") {
+		t.Error("embeddings should not be exported")
+	}
+
+	dst, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	dstMgr := NewManager(dst, &mockProvider{}, 10, 1000, 50)
+	dst.SaveMemory(&storage.MemoryItem{ID: "shared", Content: "Uses vim", Type: "preference", Relevance: 1})
+	dst.SaveMemory(&storage.MemoryItem{ID: "dup", Content: "prefers   go", Type: "preference", Relevance: 1})
+
+	// Merge: the duplicate is skipped, the taken ID is remapped
+	result, err := dstMgr.ImportMemories(bytes.NewReader(buf.Bytes()), ImportMerge)
+	if err != nil {
+		t.Fatalf("ImportMemories(merge) error = %v", err)
+	}
+	if result.Added != 2 || result.Skipped != 1 || result.Remapped != 1 || result.Removed != 0 {
+		t.Errorf("merge result = %+v", result)
+	}
+	memories, _ := dst.LoadMemories()
+	byContent := make(map[string]*storage.MemoryItem)
+	for _, m := range memories {
+		byContent[m.Content] = m
+	}
+	if len(memories) != 4 || byContent["Uses vim"].ID != "shared" || byContent["Works at Acme"].ID == "shared" {
+		t.Errorf("unexpected memories after merge: %+v", memories)
+	}
+	if byContent["Deploys need approval"].Scope != "svc" || byContent["Works at Acme"].Relevance != 0.7 {
+		t.Error("scope and relevance should be kept")
+	}
+
+	// Replace: a hand-written array with defaults
+	file := `[{"content": "Team uses trunk-based development", "tags": ["Process"]}]`
+	result, err = dstMgr.ImportMemories(strings.NewReader(file), ImportReplace)
+	if err != nil {
+		t.Fatalf("ImportMemories(replace) error = %v", err)
+	}
+	if result.Added != 1 || result.Removed != 4 || result.Remapped != 1 {
+		t.Errorf("replace result = %+v", result)
+	}
+	memories, _ = dst.LoadMemories()
+	if len(memories) != 1 || memories[0].Type != "fact" || memories[0].Relevance != 1 || memories[0].Tags[0] != "process" {
+		t.Errorf("expected one memory with defaults, got %+v", memories)
+	}
+
+	// A replace that fails to save keeps the stored memories
+	file = `[{"content": "Ships on Fridays"}, {"id": "` + strings.Repeat("x", 300) + `", "content": "Name too long"}]`
+	if _, err := dstMgr.ImportMemories(strings.NewReader(file), ImportReplace); err == nil {
+		t.Error("expected an error for a memory that cannot be saved")
+	}
+	if memories, _ = dst.LoadMemories(); len(memories) != 1 || memories[0].Content != "Team uses trunk-based development" {
+		t.Errorf("expected the stored memory kept after a failed replace, got %+v", memories)
+	}
+
+	// Invalid files change nothing
+	if _, err := dstMgr.ImportMemories(strings.NewReader(`[{"content": ""}]`), ImportReplace); err == nil {
+		t.Error("expected an error for a memory without content")
+	}
+	if _, err := dstMgr.ImportMemories(strings.NewReader(`{"version": 99}`), ImportMerge); err == nil {
+		t.Error("expected an error for a newer export version")
+	}
+	if memories, _ = dst.LoadMemories(); len(memories) != 1 {
+		t.Errorf("failed imports should not change memories, got %d", len(memories))
+	}
+	if _, err := ParseImportStrategy("overwrite"); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+// scriptedProvider replies to each call with the next response, recording
+// the system prompts and inputs it was sent
+type scriptedProvider struct {
+	mockProvider
+	responses []string
+	prompts   []string
+	inputs    []string
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, messages []llm.Message) (*llm.Response, error) {
+	p.prompts = append(p.prompts, messages[0].Content)
+	p.inputs = append(p.inputs, messages[len(messages)-1].Content)
+	resp := p.responses[0]
+	p.responses = p.responses[1:]
+	return &llm.Response{Content: resp}, nil
+}
+
+func TestSummarizeConversation_Configured(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	store.SaveMemory(&storage.MemoryItem{ID: "known", Content: "Uses Go", Type: "fact", Relevance: 1})
+
+	provider := &scriptedProvider{responses: []string{
+		"Resumen de la conversación",
+		"- preference: Prefers Spanish answers\n2. [fact] uses go\n3 kids at home\nNONE\n",
+	}}
+	mgr := NewManager(store, provider, 10, 1000, 6)
+	mgr.SetSummarization(Summarization{
+		KeepMessages:    2,
+		SummaryPrompt:   "Resume la conversación.",
+		ExtractMemories: true,
+	})
+
+	conv := &storage.Conversation{ID: "c"}
+	for i := 0; i < 6; i++ {
+		conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: strconv.Itoa(i)})
+	}
+	mgr.summarizeConversation(conv)
+
+	if conv.Summary != "Resumen de la conversación" || len(conv.Messages) != 2 {
+		t.Errorf("expected a summary and 2 kept messages, got %q and %d", conv.Summary, len(conv.Messages))
+	}
+	if len(provider.prompts) != 2 || provider.prompts[0] != "Resume la conversación." || provider.prompts[1] != DefaultExtractPrompt {
+		t.Errorf("unexpected prompts: %q", provider.prompts)
+	}
+
+	memories, _ := store.QueryMemories(storage.MemoryFilter{Tags: []string{"extracted"}})
+	got := make(map[string]string)
+	for _, m := range memories {
+		got[m.Content] = m.Type
+	}
+	want := map[string]string{"Prefers Spanish answers": "preference", "3 kids at home": "fact"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted memories = %v, want %v (duplicates skipped)", got, want)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	provider := &scriptedProvider{responses: []string{"New summary", "fact: Deploys on Fridays"}}
+	mgr := NewManager(store, provider, 10, 1000, 100)
+	mgr.SetSummarization(Summarization{KeepMessages: 2})
+
+	conv := &storage.Conversation{ID: "c", Summary: "Old summary"}
+	for i := 0; i < 6; i++ {
+		conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: strconv.Itoa(i)})
+	}
+	store.SaveConversation(conv)
+
+	// Below summarize_when, compacting still summarizes
+	result, err := mgr.Compact(context.Background(), conv, true)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	want := CompactResult{Summarized: 4, Kept: 2, TokensBefore: 70, TokensAfter: 30, Memories: 1}
+	if *result != want {
+		t.Errorf("result = %+v, want %+v", *result, want)
+	}
+	if result.TokensSaved() != 40 {
+		t.Errorf("expected 40 tokens saved, got %d", result.TokensSaved())
+	}
+	if !strings.Contains(provider.inputs[0], "Old summary") {
+		t.Errorf("the previous summary should be summarized too, got %q", provider.inputs[0])
+	}
+
+	saved, err := store.LoadConversation("c")
+	if err != nil {
+		t.Fatalf("failed to load conversation: %v", err)
+	}
+	if saved.Summary != "New summary" || len(saved.Messages) != 2 {
+		t.Errorf("expected the compacted conversation to be saved, got %q and %d messages", saved.Summary, len(saved.Messages))
+	}
+
+	// Nothing left to summarize
+	result, err = mgr.Compact(context.Background(), saved, false)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if result.Summarized != 0 || result.Kept != 2 || len(provider.prompts) != 2 {
+		t.Errorf("expected no summarization, got %+v after %d calls", *result, len(provider.prompts))
+	}
+}
+
+func TestCompact_ToolMessages(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	provider := &scriptedProvider{responses: []string{"Summary"}}
+	mgr := NewManager(store, provider, 2, 1000, 100)
+	mgr.SetSummarization(Summarization{KeepMessages: 2})
+
+	call := llm.ToolCall{ID: "call-1", Type: "function", Function: &llm.ToolCallFunction{Name: "shell", Arguments: `{"command":"ls"}`}}
+	conv := &storage.Conversation{ID: "c", Messages: []llm.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []llm.ToolCall{call}},
+		{Role: "tool", Name: "shell", ToolCallID: "call-1", Content: "a.txt"},
+		{Role: "assistant", Content: "There is a.txt."},
+	}}
+
+	// A window starting at a tool result drops it
+	recent := mgr.getRecentMessages(conv.Messages, "next")
+	if recent[0].Role == "tool" || len(recent) != 2 {
+		t.Errorf("expected the orphaned tool result dropped, got %+v", recent)
+	}
+
+	// The split moves before the tool call its result belongs to
+	result, err := mgr.Compact(context.Background(), conv, false)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if result.Summarized != 3 || result.Kept != 3 || conv.Messages[0].Role != "assistant" || len(conv.Messages[0].ToolCalls) != 1 {
+		t.Errorf("unexpected compaction %+v, kept %+v", *result, conv.Messages)
+	}
+
+	// Tool activity is summarized too
+	call.Function.Name = "web_search"
+	input := formatMessagesForSummary([]llm.Message{
+		{Role: "assistant", ToolCalls: []llm.ToolCall{call}},
+		{Role: "tool", Name: "web_search", Content: strings.Repeat("x", 600)},
+	})
+	if !strings.Contains(input, `assistant called web_search({"command":"ls"})`) || !strings.Contains(input, "tool web_search result: "+strings.Repeat("x", 500)+"...") {
+		t.Errorf("unexpected summary input %q", input)
+	}
+}
+
+func TestSummarize_LongTermMerge(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	provider := &scriptedProvider{responses: []string{"Project X uses Postgres", "Added an index"}}
+	mgr := NewManager(store, provider, 10, 1000, 100)
+	mgr.SetSummarization(Summarization{KeepMessages: 2, SummaryMaxTokens: 5})
+
+	conv := &storage.Conversation{ID: "c", LongTermSummary: "Project X", Summary: "Chose Postgres"}
+	for i := 0; i < 6; i++ {
+		conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: strconv.Itoa(i)})
+	}
+
+	result, err := mgr.Compact(context.Background(), conv, false)
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if !result.Merged || result.TokensBefore != 80 || result.TokensAfter != 40 {
+		t.Errorf("unexpected result: %+v", *result)
+	}
+	if provider.prompts[0] != DefaultAbstractPrompt || !strings.Contains(provider.inputs[0], "Project X") ||
+		!strings.Contains(provider.inputs[0], "Chose Postgres") {
+		t.Errorf("expected both summaries to be merged, got %q: %q", provider.prompts[0], provider.inputs[0])
+	}
+	if strings.Contains(provider.inputs[1], "Chose Postgres") {
+		t.Errorf("the merged summary should not be summarized again, got %q", provider.inputs[1])
+	}
+	if conv.LongTermSummary != "Project X uses Postgres" || conv.Summary != "Added an index" {
+		t.Errorf("unexpected summaries: %q, %q", conv.LongTermSummary, conv.Summary)
+	}
+
+	messages, err := mgr.BuildContext(conv, "next")
+	if err != nil {
+		t.Fatalf("BuildContext failed: %v", err)
+	}
+	if !strings.Contains(messages[0].Content, "Long-term conversation summary: Project X uses Postgres") ||
+		!strings.Contains(messages[1].Content, "Added an index") {
+		t.Errorf("expected the long-term summary before the recent one, got %+v", messages[:2])
+	}
+}
+
+func TestScoreMemory(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	provider := &scriptedProvider{responses: []string{
+		"Type: Preference\nImportance: 0.9",
+		"importance: 2",
+		"I think it matters",
+		"Summary",
+		"fact: Deploys on Fridays\ncontext: Debugging a flaky test",
+		"type: fact\nimportance: 0.7",
+		"- **type**: context\n- **importance**: .2",
+	}}
+	mgr := NewManager(store, provider, 10, 1000, 100)
+	mgr.SetScoring(true, "")
+
+	memType, importance, err := mgr.ScoreMemory(context.Background(), "Prefers tabs", "fact")
+	if err != nil || memType != "preference" || importance != 0.9 {
+		t.Errorf("ScoreMemory = %q, %v, %v", memType, importance, err)
+	}
+	if provider.prompts[0] != DefaultScorePrompt || !strings.Contains(provider.inputs[0], "Prefers tabs") {
+		t.Errorf("unexpected scoring request: %q, %q", provider.prompts[0], provider.inputs[0])
+	}
+	if memType, importance, err = mgr.ScoreMemory(context.Background(), "x", "context"); err != nil || memType != "context" || importance != 1 {
+		t.Errorf("expected the proposed type and a clamped importance, got %q, %v, %v", memType, importance, err)
+	}
+	if _, _, err = mgr.ScoreMemory(context.Background(), "x", "fact"); err == nil {
+		t.Error("expected an error without an importance")
+	}
+
+	// Extracted memories are scored too
+	mgr.SetSummarization(Summarization{KeepMessages: 1, ExtractMemories: true})
+	conv := &storage.Conversation{ID: "c"}
+	for i := 0; i < 3; i++ {
+		conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: strconv.Itoa(i)})
+	}
+	if _, err := mgr.Compact(context.Background(), conv, false); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	memories, _ := store.LoadMemories()
+	got := make(map[string]string)
+	for _, m := range memories {
+		got[m.Content] = fmt.Sprintf("%s %.1f", m.Type, m.Relevance)
+	}
+	want := map[string]string{"Deploys on Fridays": "fact 0.7", "Debugging a flaky test": "context 0.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted memories = %v, want %v", got, want)
+	}
+}
+
+func TestBuildContext_Entities(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	alice := &storage.Entity{Name: "Alice", Type: "person", Aliases: []string{"Al"}}
+	alice.Relate("works_on", "Atlas")
+	for _, e := range []*storage.Entity{alice, {Name: "Atlas", Type: "project"}, {Name: "Bob"}} {
+		store.SaveEntity(e)
+	}
+
+	mgr := NewManager(store, &mockProvider{}, 10, 1000, 100)
+	conv := &storage.Conversation{ID: "c"}
+
+	messages, err := mgr.BuildContext(conv, "Ask Al about the deadline")
+	if err != nil {
+		t.Fatalf("BuildContext failed: %v", err)
+	}
+	want := "Known entities mentioned:\n- Alice (person; aka Al): works_on Atlas\n- Atlas (project)"
+	if messages[0].Content != want {
+		t.Errorf("got %q, want %q", messages[0].Content, want)
+	}
+
+	// Names only match whole words
+	messages, _ = mgr.BuildContext(conv, "Bobby and Alicent")
+	if len(messages) != 1 {
+		t.Errorf("expected no entities, got %+v", messages)
+	}
+}
+
+func TestCompressSnippet(t *testing.T) {
+	text := "- [preference] The user really prefers   tabs in order to match the Makefile. They were very happy.\n" +
+		"- [fact] Deploys go to prod-eu-1 and there is no staging."
+
+	if got := CompressSnippet(text, CompressOff); got != text {
+		t.Errorf("off should not change text, got %q", got)
+	}
+
+	light := CompressSnippet(text, CompressLight)
+	if strings.Contains(light, "really") || strings.Contains(light, "in order to") || strings.Contains(light, "  ") {
+		t.Errorf("light should drop filler and extra spaces, got %q", light)
+	}
+
+	medium := CompressSnippet(text, CompressMedium)
+	if strings.Contains(medium, " the ") || strings.Contains(medium, " is ") {
+		t.Errorf("medium should drop stop words, got %q", medium)
+	}
+	for _, keep := range []string{"The user", "Makefile", "prod-eu-1", "no staging", "- [fact]"} {
+		if !strings.Contains(medium, keep) {
+			t.Errorf("medium should keep %q, got %q", keep, medium)
+		}
+	}
+
+	aggressive := CompressSnippet(text, CompressAggressive)
+	if strings.Contains(aggressive, "happy") {
+		t.Errorf("aggressive should keep only the first sentence of each line, got %q", aggressive)
+	}
+	if len(aggressive) >= len(medium) || len(medium) >= len(light) || len(light) >= len(text) {
+		t.Errorf("expected output to shrink with each level: %d, %d, %d, %d", len(text), len(light), len(medium), len(aggressive))
+	}
+
+	if _, err := ParseCompressionLevel("extreme"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+	if level, err := ParseCompressionLevel(""); err != nil || level != CompressOff {
+		t.Errorf("expected empty level to mean off, got %q, %v", level, err)
+	}
+}
+
+func TestBuildContext_CompressesSnippets(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	mgr := NewManager(store, &mockProvider{response: "short"}, 10, 1000, 50)
+	if err := mgr.AddMemory("The deployment pipeline basically runs the integration tests first", "fact", ""); err != nil {
+		t.Fatalf("AddMemory failed: %v", err)
+	}
+	conv := &storage.Conversation{ID: "test", Summary: "The user wants a very long report about deployment"}
+
+	// The model rewrite is used when it is shorter than the input
+	mgr.SetCompression(CompressLLM, nil)
+	messages, err := mgr.BuildContext(conv, "how does deployment work")
+	if err != nil {
+		t.Fatalf("BuildContext failed: %v", err)
+	}
+	if len(messages) < 2 || !strings.HasSuffix(messages[0].Content, "short") || !strings.HasSuffix(messages[1].Content, "short") {
+		t.Errorf("expected memories and summary rewritten by the model, got %+v", messages)
+	}
+
+	// Heuristic levels need no model
+	mgr.SetCompression(CompressMedium, nil)
+	messages, err = mgr.BuildContext(conv, "how does deployment work")
+	if err != nil {
+		t.Fatalf("BuildContext failed: %v", err)
+	}
+	if strings.Contains(messages[0].Content, "basically") || strings.Contains(messages[1].Content, "very") {
+		t.Errorf("expected heuristic compression, got %+v", messages[:2])
+	}
+}
@@ -0,0 +1,185 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+const (
+	// defaultTopK is how many memories are injected per query by default
+	defaultTopK = 5
+
+	// defaultMinSimilarity is the default embedding similarity a memory
+	// needs to be injected
+	defaultMinSimilarity = 0.3
+
+	// minStoredRelevance excludes memories marked as barely relevant
+	minStoredRelevance = 0.3
+
+	// embedTimeout bounds an embeddings call made while building context
+	embedTimeout = 15 * time.Second
+)
+
+// SetRetrieval configures which memories BuildContext injects: at most topK,
+// each with an embedding similarity to the query of at least minSimilarity.
+// embeddingID identifies the embedding model (e.g. provider type and model),
+// so memories embedded with another model are embedded again. Non-positive
+// values keep the defaults.
+func (m *Manager) SetRetrieval(topK int, minSimilarity float64, embeddingID string) {
+	if topK > 0 {
+		m.topK = topK
+	}
+	if minSimilarity > 0 {
+		m.minSimilarity = minSimilarity
+	}
+	m.embeddingID = embeddingID
+}
+
+// getRelevantMemories retrieves the global and conversation memories most
+// relevant to the query, ranked by embedding similarity. Without embedding
+// support it falls back to keyword overlap.
+func (m *Manager) getRelevantMemories(query, conversationID string) ([]*storage.MemoryItem, error) {
+	memories, err := m.store.LoadMemories()
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*storage.MemoryItem
+	for _, mem := range memories {
+		if mem.Relevance >= minStoredRelevance && mem.VisibleIn(conversationID) {
+			candidates = append(candidates, mem)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	relevant, err := m.semanticMemories(query, candidates)
+	if err != nil {
+		if !errors.Is(err, llm.ErrEmbeddingsUnsupported) {
+			m.log.Warn("embedding memories failed, using keywords", "error", err)
+		}
+		relevant = keywordMemories(query, candidates)
+	}
+
+	if len(relevant) > m.topK {
+		relevant = relevant[:m.topK]
+	}
+	return relevant, nil
+}
+
+// semanticMemories ranks memories by cosine similarity to the query,
+// weighted by their relevance, dropping those whose similarity is below
+// minSimilarity. Memories whose embedding is missing or
+// stale are embedded in the same call as the query and saved.
+func (m *Manager) semanticMemories(query string, memories []*storage.MemoryItem) ([]*storage.MemoryItem, error) {
+	embedder, ok := m.provider.(llm.Embedder)
+	if !ok {
+		return nil, llm.ErrEmbeddingsUnsupported
+	}
+
+	texts := []string{query}
+	var stale []*storage.MemoryItem
+	for _, mem := range memories {
+		if mem.EmbeddingHash != m.embeddingHash(mem.Content) {
+			texts = append(texts, mem.Content)
+			stale = append(stale, mem)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embedTimeout)
+	defer cancel()
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, mem := range stale {
+		mem.Embedding, mem.EmbeddingHash = vectors[i+1], m.embeddingHash(mem.Content)
+		if err := m.store.SaveMemory(mem); err != nil {
+			m.log.Warn("saving memory embedding failed", "id", mem.ID, "error", err)
+		}
+	}
+	if len(stale) > 0 {
+		m.log.Debug("memories embedded", "count", len(stale))
+	}
+
+	scores := make(map[*storage.MemoryItem]float64, len(memories))
+	var relevant []*storage.MemoryItem
+	for _, mem := range memories {
+		score := llm.CosineSimilarity(vectors[0], mem.Embedding)
+		if score >= m.minSimilarity {
+			scores[mem] = score * (0.5 + 0.5*mem.Relevance)
+			relevant = append(relevant, mem)
+		}
+	}
+	sort.SliceStable(relevant, func(i, j int) bool {
+		return scores[relevant[i]] > scores[relevant[j]]
+	})
+	return relevant, nil
+}
+
+// embedMemory embeds a memory's content before it is saved. Failures only
+// leave it to be embedded at the next retrieval.
+func (m *Manager) embedMemory(mem *storage.MemoryItem) {
+	embedder, ok := m.provider.(llm.Embedder)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embedTimeout)
+	defer cancel()
+	vectors, err := embedder.Embed(ctx, []string{mem.Content})
+	if err != nil {
+		if !errors.Is(err, llm.ErrEmbeddingsUnsupported) {
+			m.log.Warn("embedding memory failed", "error", err)
+		}
+		return
+	}
+	mem.Embedding, mem.EmbeddingHash = vectors[0], m.embeddingHash(mem.Content)
+}
+
+// embeddingHash identifies content embedded with the configured model
+func (m *Manager) embeddingHash(content string) string {
+	sum := sha256.Sum256([]byte(m.embeddingID + "\x00" + content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// keywordMemories scores memories by the query words they contain, weighted
+// by their stored relevance, most relevant first
+func keywordMemories(query string, memories []*storage.MemoryItem) []*storage.MemoryItem {
+	queryWords := strings.Fields(strings.ToLower(query))
+	var relevant []*storage.MemoryItem
+
+	for _, mem := range memories {
+		contentLower := strings.ToLower(mem.Content)
+		score := 0.0
+
+		// Check for keyword matches
+		for _, word := range queryWords {
+			if len(word) > 3 && strings.Contains(contentLower, word) {
+				score += 0.2
+			}
+		}
+
+		// Boost by stored relevance
+		score = score * mem.Relevance
+
+		if score > 0.1 {
+			relevant = append(relevant, mem)
+		}
+	}
+
+	sort.Slice(relevant, func(i, j int) bool {
+		return relevant[i].Relevance > relevant[j].Relevance
+	})
+	return relevant
+}
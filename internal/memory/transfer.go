@@ -0,0 +1,232 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// exportVersion is the version of the memory export format
+const exportVersion = 1
+
+// Export is the file format of exported memories. Import also accepts a
+// bare array of memories, so curated fact files can be written by hand.
+type Export struct {
+	Version    int                   `json:"version"`
+	ExportedAt time.Time             `json:"exported_at"`
+	Memories   []*storage.MemoryItem `json:"memories"`
+}
+
+// ImportStrategy decides what happens to the memories already stored
+type ImportStrategy string
+
+const (
+	ImportMerge   ImportStrategy = "merge"   // Keep existing memories; skip duplicates
+	ImportReplace ImportStrategy = "replace" // Delete existing memories once the import is saved
+)
+
+// ParseImportStrategy validates an import strategy; empty means merge
+func ParseImportStrategy(s string) (ImportStrategy, error) {
+	switch strategy := ImportStrategy(strings.ToLower(strings.TrimSpace(s))); strategy {
+	case "":
+		return ImportMerge, nil
+	case ImportMerge, ImportReplace:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown import strategy: %s (use merge or replace)", s)
+	}
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Added    int // Memories saved
+	Skipped  int // Duplicates of stored memories (merge)
+	Remapped int // Memories saved under a new ID because theirs was taken or missing
+	Removed  int // Stored memories replaced by the import (replace)
+}
+
+// ExportMemories writes the memories matching filter as JSON. Embeddings
+// are left out: they are specific to a model and recomputed on use.
+func (m *Manager) ExportMemories(w io.Writer, filter storage.MemoryFilter) (int, error) {
+	memories, err := m.store.QueryMemories(filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, mem := range memories {
+		mem.Embedding, mem.EmbeddingHash = nil, ""
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(&Export{Version: exportVersion, ExportedAt: time.Now(), Memories: memories})
+	return len(memories), err
+}
+
+// ImportMemories reads memories written by ExportMemories, or a bare JSON
+// array of them, and saves them. Only content is required; type defaults to
+// fact and relevance to 1. Merge skips memories whose content is already
+// stored in the same scope, and gives imported memories whose ID is taken a
+// new one. Replace saves the imported memories before deleting the stored
+// ones, and puts those back if saving fails. The whole file is validated
+// before anything is changed.
+func (m *Manager) ImportMemories(r io.Reader, strategy ImportStrategy) (*ImportResult, error) {
+	incoming, err := decodeMemories(r)
+	if err != nil {
+		return nil, err
+	}
+	for i, mem := range incoming {
+		if mem == nil || strings.TrimSpace(mem.Content) == "" {
+			return nil, fmt.Errorf("memory %d: content is required", i+1)
+		}
+	}
+
+	existing, err := m.store.LoadMemories()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	var replaced []*storage.MemoryItem
+	if strategy == ImportReplace {
+		replaced, existing = existing, nil
+	}
+
+	takenIDs := make(map[string]bool, len(existing)+len(incoming))
+	stored := make(map[string]bool, len(existing)+len(incoming))
+	for _, mem := range existing {
+		takenIDs[mem.ID] = true
+		stored[contentKey(mem)] = true
+	}
+
+	now := time.Now()
+	var saved []string
+	for _, mem := range incoming {
+		mem.Content = strings.TrimSpace(mem.Content)
+		if stored[contentKey(mem)] {
+			result.Skipped++
+			continue
+		}
+
+		if mem.ID == "" || takenIDs[mem.ID] || !validMemoryID(mem.ID) {
+			mem.ID = uniqueID(takenIDs)
+			result.Remapped++
+		}
+		if mem.Type == "" {
+			mem.Type = "fact"
+		}
+		if mem.Relevance <= 0 {
+			mem.Relevance = 1.0
+		}
+		if mem.CreatedAt.IsZero() {
+			mem.CreatedAt = now
+		}
+		mem.Tags = storage.NormalizeTags(mem.Tags)
+		mem.Embedding, mem.EmbeddingHash = nil, ""
+
+		if err := m.store.SaveMemory(mem); err != nil {
+			if strategy == ImportReplace {
+				m.undoImport(replaced, saved)
+				result.Added = 0
+			}
+			return result, fmt.Errorf("saving memory: %w", err)
+		}
+		saved = append(saved, mem.ID)
+		takenIDs[mem.ID] = true
+		stored[contentKey(mem)] = true
+		result.Added++
+	}
+
+	// Stored memories an imported one overwrote are already gone
+	for _, mem := range replaced {
+		if !takenIDs[mem.ID] {
+			if err := m.store.DeleteMemory(mem.ID); err != nil {
+				return result, fmt.Errorf("deleting memory %s: %w", mem.ID, err)
+			}
+		}
+		result.Removed++
+	}
+
+	m.log.Info("memories imported",
+		"strategy", strategy,
+		"added", result.Added,
+		"skipped", result.Skipped,
+		"remapped", result.Remapped,
+		"removed", result.Removed,
+	)
+	return result, nil
+}
+
+// undoImport restores the memories a failed replace import had replaced:
+// the saved IDs are deleted, or given back their old memory if they
+// overwrote one
+func (m *Manager) undoImport(replaced []*storage.MemoryItem, saved []string) {
+	old := make(map[string]*storage.MemoryItem, len(replaced))
+	for _, mem := range replaced {
+		old[mem.ID] = mem
+	}
+	for _, id := range saved {
+		var err error
+		if mem, ok := old[id]; ok {
+			err = m.store.SaveMemory(mem)
+		} else {
+			err = m.store.DeleteMemory(id)
+		}
+		if err != nil {
+			m.log.Warn("undoing memory import failed", "id", id, "error", err)
+		}
+	}
+}
+
+// decodeMemories parses an export file or a bare array of memories
+func decodeMemories(r io.Reader) ([]*storage.MemoryItem, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var memories []*storage.MemoryItem
+		if err := json.Unmarshal(data, &memories); err != nil {
+			return nil, fmt.Errorf("parsing memories: %w", err)
+		}
+		return memories, nil
+	}
+
+	var export Export
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parsing memories: %w", err)
+	}
+	if export.Version > exportVersion {
+		return nil, fmt.Errorf("memory export version %d is newer than supported (%d)", export.Version, exportVersion)
+	}
+	return export.Memories, nil
+}
+
+// contentKey identifies a memory's content within its scope, ignoring case
+// and spacing, to detect duplicates
+func contentKey(mem *storage.MemoryItem) string {
+	return mem.Scope + "\x00" + strings.ToLower(strings.Join(strings.Fields(mem.Content), " "))
+}
+
+// validMemoryID reports whether an imported ID is safe as a file name
+func validMemoryID(id string) bool {
+	return !strings.ContainsAny(id, `/\`) && id != "." && id != ".."
+}
+
+// uniqueID generates an ID like generateID that is not in taken
+func uniqueID(taken map[string]bool) string {
+	n := time.Now().UnixNano()
+	id := strconv.FormatInt(n, 10)
+	for taken[id] {
+		n++
+		id = strconv.FormatInt(n, 10)
+	}
+	return id
+}
@@ -0,0 +1,221 @@
+// Package netpolicy enforces the outbound network policy shared by LLM
+// providers and network tools: a host allowlist, per-host mTLS client
+// certificates, and audit logging of outbound requests.
+package netpolicy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/logger"
+)
+
+// ErrHostNotAllowed is returned for requests to hosts outside the allowlist
+var ErrHostNotAllowed = errors.New("host not allowed by network policy")
+
+// ClientCert is an mTLS client certificate used for one host
+type ClientCert struct {
+	Host     string // Host name or wildcard pattern such as *.corp.example
+	CertFile string
+	KeyFile  string
+}
+
+// Config configures a Policy
+type Config struct {
+	AllowedHosts []string // Host names or wildcard patterns; empty allows all hosts
+	ClientCerts  []ClientCert
+	Audit        bool // Log every outbound request
+}
+
+// Policy decides which hosts may be contacted and how
+type Policy struct {
+	allowed []string
+	certs   []ClientCert
+	loaded  map[string]tls.Certificate // Keyed by ClientCert.Host
+	audit   bool
+	log     *slog.Logger
+}
+
+// New creates a policy, loading client certificates up front so
+// misconfiguration is reported at startup
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{
+		certs:  cfg.ClientCerts,
+		loaded: make(map[string]tls.Certificate),
+		audit:  cfg.Audit,
+		log:    logger.L().With("component", "netpolicy"),
+	}
+
+	for _, h := range cfg.AllowedHosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			p.allowed = append(p.allowed, h)
+		}
+	}
+
+	for _, c := range cfg.ClientCerts {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate for %s: %w", c.Host, err)
+		}
+		p.loaded[c.Host] = cert
+	}
+
+	p.log.Debug("network policy initialized",
+		"allowed_hosts", len(p.allowed),
+		"client_certs", len(p.loaded),
+		"audit", p.audit,
+	)
+	return p, nil
+}
+
+// Allowed reports whether a host may be contacted
+func (p *Policy) Allowed(host string) bool {
+	if p == nil || len(p.allowed) == 0 {
+		return true
+	}
+	host = normalizeHost(host)
+	for _, pattern := range p.allowed {
+		if matchHost(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL returns ErrHostNotAllowed if the URL's host is not allowed
+func (p *Policy) CheckURL(rawURL string) error {
+	host := Host(rawURL)
+	if host == "" {
+		return fmt.Errorf("parsing URL: no host in %q", rawURL)
+	}
+	if !p.Allowed(host) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	return nil
+}
+
+// Host returns the host name of a URL; bare hosts such as example.com/path,
+// which curl accepts, are treated as http URLs
+func Host(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		if u, err = url.Parse("http://" + rawURL); err != nil {
+			return ""
+		}
+	}
+	return u.Hostname()
+}
+
+// ClientCert returns the client certificate configured for a host
+func (p *Policy) ClientCert(host string) (ClientCert, bool) {
+	if p == nil {
+		return ClientCert{}, false
+	}
+	host = normalizeHost(host)
+	for _, c := range p.certs {
+		if matchHost(strings.ToLower(c.Host), host) {
+			return c, true
+		}
+	}
+	return ClientCert{}, false
+}
+
+// Audit records an outbound request made outside an http.Client, e.g. by
+// an external command
+func (p *Policy) Audit(source, method, rawURL string) {
+	if p == nil || !p.audit {
+		return
+	}
+	p.log.Info("outbound request", "source", source, "method", method, "url", redact(rawURL))
+}
+
+// Transport wraps a base transport so requests are checked against the
+// allowlist, use the host's client certificate, and are audited
+func (p *Policy) Transport(source string, base *http.Transport) http.RoundTripper {
+	if p == nil {
+		return base
+	}
+
+	perHost := make(map[string]*http.Transport, len(p.certs))
+	for _, c := range p.certs {
+		t := base.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{p.loaded[c.Host]}
+		perHost[c.Host] = t
+	}
+
+	return &policyTransport{policy: p, source: source, base: base, perHost: perHost}
+}
+
+type policyTransport struct {
+	policy  *Policy
+	source  string
+	base    *http.Transport
+	perHost map[string]*http.Transport
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if !t.policy.Allowed(host) {
+		t.policy.log.Warn("outbound request blocked", "source", t.source, "host", host)
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+
+	rt := t.base
+	if c, ok := t.policy.ClientCert(host); ok {
+		rt = t.perHost[c.Host]
+	}
+
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	if t.policy.audit {
+		attrs := []any{
+			"source", t.source,
+			"method", req.Method,
+			"url", redact(req.URL.String()),
+			"duration_ms", time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		} else {
+			attrs = append(attrs, "status", resp.StatusCode)
+		}
+		t.policy.log.Info("outbound request", attrs...)
+	}
+	return resp, err
+}
+
+// matchHost matches a host against an exact name or a *.suffix wildcard
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return pattern == host
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// redact drops credentials and the query string, which may carry secrets
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
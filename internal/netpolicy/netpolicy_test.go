@@ -0,0 +1,158 @@
+package netpolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAllowed(t *testing.T) {
+	p, err := New(Config{AllowedHosts: []string{"api.openai.com", "*.corp.example", " "}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"api.openai.com", true},
+		{"API.OpenAI.com.", true},
+		{"api.openai.com:443", true},
+		{"evil.com", false},
+		{"openai.com", false},
+		{"corp.example", true},
+		{"llm.corp.example", true},
+		{"a.b.corp.example", true},
+		{"notcorp.example", false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(tt.host); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	open, _ := New(Config{})
+	if !open.Allowed("anything.example") {
+		t.Error("expected empty allowlist to allow all hosts")
+	}
+	var nilPolicy *Policy
+	if !nilPolicy.Allowed("anything.example") {
+		t.Error("expected nil policy to allow all hosts")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	p, _ := New(Config{AllowedHosts: []string{"example.com"}})
+
+	if err := p.CheckURL("https://example.com/path?q=1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.CheckURL("example.com/path"); err != nil {
+		t.Errorf("expected bare host to be accepted: %v", err)
+	}
+	if err := p.CheckURL("https://user:pw@other.com/"); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected ErrHostNotAllowed, got %v", err)
+	}
+}
+
+func TestTransport_BlocksDisallowedHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	allowed, _ := New(Config{AllowedHosts: []string{"127.0.0.1"}, Audit: true})
+	client := &http.Client{Transport: allowed.Transport("test", base)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected request to allowed host to succeed: %v", err)
+	}
+	resp.Body.Close()
+
+	blocked, _ := New(Config{AllowedHosts: []string{"example.com"}})
+	client = &http.Client{Transport: blocked.Transport("test", base)}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected ErrHostNotAllowed, got %v", err)
+	}
+}
+
+func TestTransport_ClientCert(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	certFile, keyFile := writeClientCert(t)
+	p, err := New(Config{ClientCerts: []ClientCert{{Host: "127.0.0.1", CertFile: certFile, KeyFile: keyFile}}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	base := server.Client().Transport.(*http.Transport).Clone()
+	client := &http.Client{Transport: p.Transport("test", base)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected client certificate to be presented, got status %d", resp.StatusCode)
+	}
+
+	if _, err := New(Config{ClientCerts: []ClientCert{{Host: "x", CertFile: "/nonexistent", KeyFile: "/nonexistent"}}}); err == nil {
+		t.Error("expected error for missing client certificate")
+	}
+}
+
+// writeClientCert writes a self-signed client certificate and key
+func writeClientCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "igent-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshaling key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
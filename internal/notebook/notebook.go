@@ -0,0 +1,262 @@
+// Package notebook exports conversations as Jupyter notebooks or literate
+// markdown. Prompts and answers become markdown cells; shell commands,
+// run_code snippets and runnable code blocks of answers become code cells,
+// so a session can be rerun and shared as an executable document.
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/igm/igent/internal/render"
+	"github.com/igm/igent/internal/storage"
+)
+
+// Format is an export format
+type Format string
+
+const (
+	FormatIPynb    Format = "ipynb" // Jupyter notebook (Python kernel; %%bash cells for shell)
+	FormatMarkdown Format = "md"    // Literate markdown
+)
+
+// ParseFormat validates a format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimPrefix(s, "."))); f {
+	case FormatIPynb, FormatMarkdown:
+		return f, nil
+	case "markdown":
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (want ipynb or md)", s)
+}
+
+// cell is a notebook cell independent of the output format
+type cell struct {
+	code   bool
+	lang   string // Language of code cells: python, bash or javascript
+	source string
+	output string // Recorded output of code cells
+}
+
+// runnable maps code block languages to the languages of code cells
+var runnable = map[string]string{
+	"python": "python", "py": "python",
+	"bash": "bash", "sh": "bash", "shell": "bash", "console": "bash",
+	"javascript": "javascript", "js": "javascript",
+}
+
+// Export writes conv to w in the given format
+func Export(w io.Writer, conv *storage.Conversation, format Format) error {
+	cells := build(conv)
+	switch format {
+	case FormatIPynb:
+		return writeIPynb(w, cells)
+	case FormatMarkdown:
+		return writeMarkdown(w, cells)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// build converts a conversation into cells
+func build(conv *storage.Conversation) []cell {
+	header := fmt.Sprintf("# Conversation %s\n\nExported from igent; started %s.",
+		conv.ID, conv.CreatedAt.Format("2006-01-02 15:04"))
+	if conv.LongTermSummary != "" {
+		header += "\n\n**Long-term summary:** " + conv.LongTermSummary
+	}
+	if conv.Summary != "" {
+		header += "\n\n**Summary of earlier messages:** " + conv.Summary
+	}
+	cells := []cell{{source: header}}
+
+	tools := make(map[int][]storage.ToolRecord)
+	for _, r := range conv.ToolCalls {
+		tools[r.Message] = append(tools[r.Message], r)
+	}
+
+	for i, m := range conv.Messages {
+		switch m.Role {
+		case "user":
+			cells = append(cells, cell{source: "## Prompt\n\n" + m.Content})
+		case "assistant":
+			for _, r := range tools[i] {
+				cells = append(cells, toolCell(r))
+			}
+			cells = append(cells, answerCells(m.Content)...)
+		}
+	}
+	return cells
+}
+
+// toolCell converts a tool call: commands and snippets become code cells,
+// other tools a markdown note with their arguments and output
+func toolCell(r storage.ToolRecord) cell {
+	var args map[string]interface{}
+	json.Unmarshal([]byte(r.Args), &args)
+
+	switch r.Name {
+	case "shell", "shell_session":
+		if command, ok := args["command"].(string); ok {
+			return cell{code: true, lang: "bash", source: command, output: r.Output}
+		}
+	case "run_code":
+		code, _ := args["code"].(string)
+		lang, _ := args["language"].(string)
+		if lang == "" {
+			lang = "python"
+		}
+		if l, ok := runnable[strings.ToLower(lang)]; ok && code != "" {
+			return cell{code: true, lang: l, source: code, output: r.Output}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**Tool `%s`**", r.Name)
+	if r.Error {
+		sb.WriteString(" (failed)")
+	}
+	if len(args) > 0 {
+		sb.WriteString("\n\n")
+		keys := make([]string, 0, len(args))
+		for k := range args {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "- %s: `%v`\n", k, args[k])
+		}
+	}
+	if r.Output != "" {
+		sb.WriteString("\n" + render.Fence(r.Output, "text") + "\n")
+	}
+	return cell{source: strings.TrimRight(sb.String(), "\n")}
+}
+
+// answerCells splits an answer into markdown cells and code cells for its
+// runnable code blocks
+func answerCells(content string) []cell {
+	var cells []cell
+	var text, code strings.Builder
+	lang := ""
+	inCode, codeRunnable := false, false
+	var opening string
+
+	flushText := func() {
+		if s := strings.TrimSpace(text.String()); s != "" {
+			cells = append(cells, cell{source: s})
+		}
+		text.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inCode && strings.HasPrefix(trimmed, "```"):
+			inCode = true
+			opening = line
+			lang, codeRunnable = runnable[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "```")))]
+			code.Reset()
+		case inCode && trimmed == "```":
+			inCode = false
+			if codeRunnable {
+				flushText()
+				cells = append(cells, cell{code: true, lang: lang, source: strings.TrimRight(code.String(), "\n")})
+			} else {
+				text.WriteString(opening + code.String() + line)
+			}
+		case inCode:
+			code.WriteString(line)
+		default:
+			text.WriteString(line)
+		}
+	}
+	if inCode {
+		// Unterminated block: keep it as text
+		text.WriteString(opening + code.String())
+	}
+	flushText()
+	return cells
+}
+
+// writeMarkdown renders cells as literate markdown
+func writeMarkdown(w io.Writer, cells []cell) error {
+	var sb strings.Builder
+	for i, c := range cells {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		if !c.code {
+			sb.WriteString(c.source + "\n")
+			continue
+		}
+		sb.WriteString(render.Fence(c.source, c.lang) + "\n")
+		if c.output != "" {
+			sb.WriteString("\nOutput:\n\n" + render.Fence(c.output, "text") + "\n")
+		}
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeIPynb renders cells as an nbformat 4 notebook for a Python kernel;
+// bash and javascript cells use the %%bash and %%javascript cell magics
+func writeIPynb(w io.Writer, cells []cell) error {
+	nbCells := make([]map[string]interface{}, len(cells))
+	for i, c := range cells {
+		if !c.code {
+			nbCells[i] = map[string]interface{}{
+				"cell_type": "markdown",
+				"metadata":  map[string]interface{}{},
+				"source":    lines(c.source),
+			}
+			continue
+		}
+
+		source := c.source
+		if c.lang != "python" {
+			source = "%%" + c.lang + "\n" + source
+		}
+		outputs := []interface{}{}
+		if c.output != "" {
+			outputs = append(outputs, map[string]interface{}{
+				"output_type": "stream",
+				"name":        "stdout",
+				"text":        lines(c.output),
+			})
+		}
+		nbCells[i] = map[string]interface{}{
+			"cell_type":       "code",
+			"execution_count": nil,
+			"metadata":        map[string]interface{}{},
+			"source":          lines(source),
+			"outputs":         outputs,
+		}
+	}
+
+	nb := map[string]interface{}{
+		"nbformat":       4,
+		"nbformat_minor": 4,
+		"metadata": map[string]interface{}{
+			"kernelspec": map[string]interface{}{
+				"name":         "python3",
+				"display_name": "Python 3",
+				"language":     "python",
+			},
+			"language_info": map[string]interface{}{"name": "python"},
+		},
+		"cells": nbCells,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(nb)
+}
+
+// lines splits text into notebook source lines, keeping line endings
+func lines(s string) []string {
+	return strings.SplitAfter(strings.TrimRight(s, "\n"), "\n")
+}
@@ -0,0 +1,100 @@
+package notebook
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+func testConversation() *storage.Conversation {
+	return &storage.Conversation{
+		ID: "debug-logs",
+		Messages: []llm.Message{
+			{Role: "user", Content: "Why is the service failing?"},
+			{Role: "assistant", Content: "The log shows a timeout. Count them with:\n\n```python\nprint(open('app.log').read().count('timeout'))\n```\n\nConfig:\n\n```yaml\ntimeout: 5\n```\n"},
+		},
+		ToolCalls: []storage.ToolRecord{
+			{Message: 1, Name: "shell", Args: `{"command": "tail -n 2 app.log"}`, Output: "ERROR timeout\nERROR timeout"},
+			{Message: 1, Name: "run_code", Args: `{"language": "bash", "code": "wc -l app.log"}`, Output: "2 app.log"},
+			{Message: 1, Name: "cat", Args: `{"path": "/etc/app.yaml"}`, Output: "Error: no such file", Error: true},
+		},
+	}
+}
+
+func TestExportIPynb(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, testConversation(), FormatIPynb); err != nil {
+		t.Fatal(err)
+	}
+
+	var nb struct {
+		NBFormat int `json:"nbformat"`
+		Cells    []struct {
+			CellType string   `json:"cell_type"`
+			Source   []string `json:"source"`
+			Outputs  []struct {
+				Text []string `json:"text"`
+			} `json:"outputs"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &nb); err != nil {
+		t.Fatalf("invalid notebook JSON: %v", err)
+	}
+	if nb.NBFormat != 4 {
+		t.Errorf("nbformat = %d", nb.NBFormat)
+	}
+
+	var kinds []string
+	for _, c := range nb.Cells {
+		kinds = append(kinds, c.CellType)
+	}
+	// header, prompt, shell, run_code, cat note, answer text, python block, text with yaml
+	want := "markdown markdown code code markdown markdown code markdown"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("cells = %s, want %s", got, want)
+	}
+
+	shell := nb.Cells[2]
+	if strings.Join(shell.Source, "") != "%%bash\ntail -n 2 app.log" || len(shell.Outputs) != 1 ||
+		strings.Join(shell.Outputs[0].Text, "") != "ERROR timeout\nERROR timeout" {
+		t.Errorf("shell cell = %+v", shell)
+	}
+	if src := strings.Join(nb.Cells[6].Source, ""); src != "print(open('app.log').read().count('timeout'))" {
+		t.Errorf("python cell = %q", src)
+	}
+	if note := strings.Join(nb.Cells[4].Source, ""); !strings.Contains(note, "**Tool `cat`** (failed)") || !strings.Contains(note, "- path: `/etc/app.yaml`") {
+		t.Errorf("tool note = %q", note)
+	}
+	if text := strings.Join(nb.Cells[7].Source, ""); !strings.Contains(text, "```yaml\ntimeout: 5\n```") {
+		t.Errorf("non-runnable block not kept in markdown: %q", text)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Export(&buf, testConversation(), FormatMarkdown); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# Conversation debug-logs",
+		"## Prompt\n\nWhy is the service failing?",
+		"```bash\ntail -n 2 app.log\n```\n\nOutput:\n\n```text\nERROR timeout\nERROR timeout\n```",
+		"```python\nprint(",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	if _, err := ParseFormat("docx"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if f, err := ParseFormat(".ipynb"); err != nil || f != FormatIPynb {
+		t.Errorf("ParseFormat(.ipynb) = %v, %v", f, err)
+	}
+}
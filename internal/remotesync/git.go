@@ -0,0 +1,166 @@
+package remotesync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitIndexName is the file of the repository recording the version of
+// each synced file; git itself keeps no modification times
+const gitIndexName = "igent-sync.json"
+
+// GitBackend keeps the remote copy in a git repository. A clone in
+// <work_dir>/sync/git holds the files; every sync that changes them is one
+// commit pushed to the branch.
+type GitBackend struct {
+	url    string
+	branch string
+	dir    string
+	index  map[string]Entry
+}
+
+// NewGitBackend creates a backend for the repository at url, which may be
+// any URL or path git can push to
+func NewGitBackend(workDir, url, branch string) *GitBackend {
+	if branch == "" {
+		branch = "main"
+	}
+	return &GitBackend{url: url, branch: branch, dir: filepath.Join(workDir, Dir, "git")}
+}
+
+// git runs a git command in the clone
+func (g *GitBackend) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", g.dir}, args...)...)
+	// Commit as igent so syncing works without a git identity configured,
+	// and fail instead of prompting for credentials
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=igent", "GIT_AUTHOR_EMAIL=igent@localhost",
+		"GIT_COMMITTER_NAME=igent", "GIT_COMMITTER_EMAIL=igent@localhost",
+		"GIT_TERMINAL_PROMPT=0",
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Fetch clones the repository on first use, then resets the clone to the
+// remote branch. A remote without the branch yet starts empty.
+func (g *GitBackend) Fetch(ctx context.Context) (map[string]Entry, error) {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(g.dir, 0755); err != nil {
+			return nil, err
+		}
+		if _, err := g.git(ctx, "init", "--quiet"); err != nil {
+			return nil, err
+		}
+		if _, err := g.git(ctx, "remote", "add", "origin", g.url); err != nil {
+			return nil, err
+		}
+	} else if _, err := g.git(ctx, "remote", "set-url", "origin", g.url); err != nil {
+		return nil, err
+	}
+
+	if _, err := g.git(ctx, "fetch", "--quiet", "origin"); err != nil {
+		return nil, err
+	}
+	remoteRef := "refs/remotes/origin/" + g.branch
+	if _, err := g.git(ctx, "rev-parse", "--verify", "--quiet", remoteRef); err == nil {
+		if _, err := g.git(ctx, "checkout", "--quiet", "-B", g.branch, remoteRef); err != nil {
+			return nil, err
+		}
+		if _, err := g.git(ctx, "reset", "--quiet", "--hard", remoteRef); err != nil {
+			return nil, err
+		}
+	} else if _, err := g.git(ctx, "symbolic-ref", "HEAD", "refs/heads/"+g.branch); err != nil {
+		return nil, err
+	}
+	if _, err := g.git(ctx, "clean", "--quiet", "-fdx"); err != nil {
+		return nil, err
+	}
+
+	g.index = make(map[string]Entry)
+	data, err := os.ReadFile(filepath.Join(g.dir, gitIndexName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &g.index); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", gitIndexName, err)
+		}
+	}
+
+	entries := make(map[string]Entry, len(g.index))
+	for path, entry := range g.index {
+		entries[path] = entry
+	}
+	return entries, nil
+}
+
+// Read returns a file of the clone
+func (g *GitBackend) Read(path string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(g.dir, filepath.FromSlash(path)))
+}
+
+// Write puts a file into the clone
+func (g *GitBackend) Write(path string, data []byte, entry Entry) error {
+	file := filepath.Join(g.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return err
+	}
+	g.index[path] = entry
+	return nil
+}
+
+// Remove deletes a file from the clone
+func (g *GitBackend) Remove(path string) error {
+	err := os.Remove(filepath.Join(g.dir, filepath.FromSlash(path)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(g.index, path)
+	return nil
+}
+
+// Publish commits the changes with the index and pushes them. If another
+// machine pushed meanwhile, the push is rejected and the next sync merges
+// its changes.
+func (g *GitBackend) Publish(ctx context.Context, message string) error {
+	data, err := json.MarshalIndent(g.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(g.dir, gitIndexName), data, 0644); err != nil {
+		return err
+	}
+
+	if _, err := g.git(ctx, "add", "--all"); err != nil {
+		return err
+	}
+	if status, err := g.git(ctx, "status", "--porcelain"); err != nil || status == "" {
+		return err
+	}
+	if _, err := g.git(ctx, "commit", "--quiet", "--no-verify", "-m", message); err != nil {
+		return err
+	}
+	if _, err := g.git(ctx, "push", "--quiet", "origin", "HEAD:refs/heads/"+g.branch); err != nil {
+		return fmt.Errorf("%w (the remote may have changed; run sync again)", err)
+	}
+	return nil
+}
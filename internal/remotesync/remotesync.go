@@ -0,0 +1,322 @@
+// Package remotesync keeps the conversations and memories of a work dir in
+// sync with a remote copy, so the same agent state is available on several
+// machines, such as a laptop and a server. Changes are detected by content
+// hash against the state of the last sync; when a file changed on both
+// sides, the newer one wins.
+package remotesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/storage"
+)
+
+// Dir is the directory of the work dir holding the sync state and the
+// backends' local data
+const Dir = "sync"
+
+// syncedDirs are the directories of the work dir that are synced
+var syncedDirs = []string{"messages", "memory", "entities"}
+
+// Entry is the version of a file on one side
+type Entry struct {
+	Hash    string    `json:"hash"` // SHA-256 of the content
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Backend stores the remote copy. Paths are slash separated and relative
+// to the work dir.
+type Backend interface {
+	// Fetch brings the backend up to date with the remote and returns the
+	// remote files
+	Fetch(ctx context.Context) (map[string]Entry, error)
+	Read(path string) ([]byte, error)
+	Write(path string, data []byte, entry Entry) error
+	Remove(path string) error
+	// Publish sends the changes made since Fetch to the remote
+	Publish(ctx context.Context, message string) error
+}
+
+// NewBackend creates the backend selected by the sync config
+func NewBackend(workDir string, cfg config.SyncConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "git":
+		if cfg.URL == "" {
+			return nil, errors.New("sync.url is required for the git backend")
+		}
+		return NewGitBackend(workDir, cfg.URL, cfg.Branch), nil
+	case "":
+		return nil, errors.New("sync is not configured; set sync.backend and sync.url")
+	}
+	return nil, fmt.Errorf("unknown sync backend %q (want git)", cfg.Backend)
+}
+
+// Result reports a sync
+type Result struct {
+	Pushed        []string // Local changes sent to the remote
+	Pulled        []string // Remote changes applied locally
+	DeletedLocal  []string // Files deleted remotely, removed here
+	DeletedRemote []string // Files deleted here, removed from the remote
+	Conflicts     []string // Files changed on both sides; the newer one won
+	DryRun        bool
+}
+
+// Changes returns the number of files changed
+func (r *Result) Changes() int {
+	return len(r.Pushed) + len(r.Pulled) + len(r.DeletedLocal) + len(r.DeletedRemote)
+}
+
+// Syncer syncs a work dir with a backend
+type Syncer struct {
+	workDir string
+	backend Backend
+}
+
+// New creates a syncer for workDir
+func New(workDir string, backend Backend) *Syncer {
+	return &Syncer{workDir: workDir, backend: backend}
+}
+
+// statePath is the file recording the hash of each file at the last sync
+func (s *Syncer) statePath() string {
+	return filepath.Join(s.workDir, Dir, "state.json")
+}
+
+// Sync pushes local changes and pulls remote ones. It holds an exclusive
+// lock on the work dir meanwhile. With dryRun only the result is computed.
+func (s *Syncer) Sync(ctx context.Context, dryRun bool) (*Result, error) {
+	unlock, err := storage.LockDirectory(s.workDir, true)
+	if err != nil {
+		return nil, fmt.Errorf("locking work dir: %w", err)
+	}
+	defer unlock()
+
+	remote, err := s.backend.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching remote: %w", err)
+	}
+	for p := range remote {
+		if !validPath(p) {
+			delete(remote, p)
+		}
+	}
+	local, err := s.scan()
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	for p := range local {
+		paths[p] = true
+	}
+	for p := range remote {
+		paths[p] = true
+	}
+	for p := range state {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+
+	result := &Result{DryRun: dryRun}
+	next := make(map[string]string)
+	for _, p := range sorted {
+		l, hasLocal := local[p]
+		r, hasRemote := remote[p]
+		last := state[p]
+
+		var op func() error
+		switch {
+		case hasLocal && hasRemote && l.Hash == r.Hash:
+			next[p] = l.Hash
+		case !hasLocal && !hasRemote:
+			// Deleted on both sides
+		case hasLocal && !hasRemote && last == l.Hash:
+			result.DeletedLocal = append(result.DeletedLocal, p)
+			op = func() error { return os.Remove(s.localPath(p)) }
+		case !hasLocal && hasRemote && last == r.Hash:
+			result.DeletedRemote = append(result.DeletedRemote, p)
+			op = func() error { return s.backend.Remove(p) }
+		case hasLocal && (!hasRemote || r.Hash == last || (l.Hash != last && !r.ModTime.After(l.ModTime))):
+			if hasRemote && r.Hash != last {
+				result.Conflicts = append(result.Conflicts, p)
+			}
+			result.Pushed = append(result.Pushed, p)
+			next[p] = l.Hash
+			op = func() error { return s.push(p, l) }
+		default:
+			if hasLocal && l.Hash != last {
+				result.Conflicts = append(result.Conflicts, p)
+			}
+			result.Pulled = append(result.Pulled, p)
+			next[p] = r.Hash
+			op = func() error { return s.pull(p, r) }
+		}
+		if op != nil && !dryRun {
+			if err := op(); err != nil {
+				return nil, fmt.Errorf("syncing %s: %w", p, err)
+			}
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if len(result.Pushed) > 0 || len(result.DeletedRemote) > 0 {
+		host, _ := os.Hostname()
+		message := fmt.Sprintf("igent sync from %s: %d updated, %d deleted", host, len(result.Pushed), len(result.DeletedRemote))
+		if err := s.backend.Publish(ctx, message); err != nil {
+			return nil, fmt.Errorf("publishing to remote: %w", err)
+		}
+	}
+	if err := s.saveState(next); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// localPath returns the local file of a synced path
+func (s *Syncer) localPath(path string) string {
+	return filepath.Join(s.workDir, filepath.FromSlash(path))
+}
+
+// push copies a local file to the backend
+func (s *Syncer) push(path string, entry Entry) error {
+	data, err := os.ReadFile(s.localPath(path))
+	if err != nil {
+		return err
+	}
+	return s.backend.Write(path, data, entry)
+}
+
+// pull copies a remote file into the work dir, keeping its time so the
+// newer side can be told on later conflicts
+func (s *Syncer) pull(path string, entry Entry) error {
+	data, err := s.backend.Read(path)
+	if err != nil {
+		return err
+	}
+	local := s.localPath(path)
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(local, data, 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(local, entry.ModTime, entry.ModTime)
+}
+
+// scan returns the synced files of the work dir
+func (s *Syncer) scan() (map[string]Entry, error) {
+	files := make(map[string]Entry)
+	for _, dir := range syncedDirs {
+		root := filepath.Join(s.workDir, dir)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) && path == root {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if !d.Type().IsRegular() || strings.HasSuffix(path, ".tmp") {
+				return nil
+			}
+			rel, err := filepath.Rel(s.workDir, path)
+			if err != nil {
+				return err
+			}
+			entry, err := fileEntry(path)
+			if err != nil {
+				return err
+			}
+			files[filepath.ToSlash(rel)] = entry
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scanning %s: %w", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// fileEntry hashes a local file
+func fileEntry(path string) (Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Hash: hashContent(data), ModTime: info.ModTime().UTC()}, nil
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// validPath reports whether a remote path is a synced file inside the work
+// dir
+func validPath(path string) bool {
+	dir, _, ok := strings.Cut(path, "/")
+	if !ok || !filepath.IsLocal(filepath.FromSlash(path)) {
+		return false
+	}
+	for _, d := range syncedDirs {
+		if dir == d {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Syncer) loadState() (map[string]string, error) {
+	state := make(map[string]string)
+	data, err := os.ReadFile(s.statePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("reading sync state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("parsing sync state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *Syncer) saveState(state map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(s.statePath()), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.statePath())
+}
@@ -0,0 +1,143 @@
+package remotesync
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+)
+
+// newRemote creates a bare repository to sync with
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, workDir, path, content string, modTime time.Time) {
+	t.Helper()
+	file := filepath.Join(workDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, workDir, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(workDir, filepath.FromSlash(path)))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func syncDir(t *testing.T, workDir, remote string) *Result {
+	t.Helper()
+	backend, err := NewBackend(workDir, config.SyncConfig{Backend: "git", URL: remote, Branch: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := New(workDir, backend).Sync(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	return result
+}
+
+func TestSync_Git(t *testing.T) {
+	remote := newRemote(t)
+	laptop, server := t.TempDir(), t.TempDir()
+	start := time.Now().Add(-time.Hour)
+
+	writeFile(t, laptop, "messages/default.json", `{"id": "default"}`, start)
+	writeFile(t, laptop, "memory/m1.json", `{"id": "m1"}`, start)
+	writeFile(t, laptop, "skills/s.json", `{"id": "s"}`, start) // Not synced
+
+	// The laptop pushes, the server pulls
+	result := syncDir(t, laptop, remote)
+	if !slices.Equal(result.Pushed, []string{"memory/m1.json", "messages/default.json"}) {
+		t.Errorf("unexpected first push %+v", result)
+	}
+	result = syncDir(t, server, remote)
+	if len(result.Pulled) != 2 || readFile(t, server, "memory/m1.json") != `{"id": "m1"}` {
+		t.Errorf("unexpected pull %+v", result)
+	}
+	if readFile(t, server, "skills/s.json") != "" {
+		t.Error("skills should not be synced")
+	}
+	if result := syncDir(t, server, remote); result.Changes() != 0 {
+		t.Errorf("expected nothing to sync, got %+v", result)
+	}
+
+	// Both sides change the conversation; the newer change wins
+	writeFile(t, laptop, "messages/default.json", `{"id": "default", "from": "laptop"}`, start.Add(time.Minute))
+	writeFile(t, server, "messages/default.json", `{"id": "default", "from": "server"}`, start.Add(2*time.Minute))
+	syncDir(t, laptop, remote)
+	result = syncDir(t, server, remote)
+	if !slices.Equal(result.Conflicts, []string{"messages/default.json"}) || len(result.Pushed) != 1 {
+		t.Errorf("expected the newer server change pushed as a conflict, got %+v", result)
+	}
+	result = syncDir(t, laptop, remote)
+	if len(result.Pulled) != 1 || readFile(t, laptop, "messages/default.json") != `{"id": "default", "from": "server"}` {
+		t.Errorf("expected the laptop to pull the server change, got %+v", result)
+	}
+
+	// Deletions propagate
+	os.Remove(filepath.Join(server, "memory", "m1.json"))
+	if result := syncDir(t, server, remote); !slices.Equal(result.DeletedRemote, []string{"memory/m1.json"}) {
+		t.Errorf("expected the deletion pushed, got %+v", result)
+	}
+	if result := syncDir(t, laptop, remote); !slices.Equal(result.DeletedLocal, []string{"memory/m1.json"}) {
+		t.Errorf("expected the deletion pulled, got %+v", result)
+	}
+	if readFile(t, laptop, "memory/m1.json") != "" {
+		t.Error("expected the memory deleted on the laptop")
+	}
+}
+
+func TestSync_DryRun(t *testing.T) {
+	remote := newRemote(t)
+	workDir := t.TempDir()
+	writeFile(t, workDir, "memory/m1.json", `{"id": "m1"}`, time.Now())
+
+	backend := NewGitBackend(workDir, remote, "")
+	result, err := New(workDir, backend).Sync(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.DryRun || len(result.Pushed) != 1 {
+		t.Errorf("unexpected dry run %+v", result)
+	}
+	if result := syncDir(t, workDir, remote); len(result.Pushed) != 1 {
+		t.Errorf("expected the dry run to push nothing, got %+v", result)
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	if _, err := NewBackend(t.TempDir(), config.SyncConfig{}); err == nil {
+		t.Error("expected an error without a backend")
+	}
+	if _, err := NewBackend(t.TempDir(), config.SyncConfig{Backend: "git"}); err == nil {
+		t.Error("expected an error without a URL")
+	}
+	if _, err := NewBackend(t.TempDir(), config.SyncConfig{Backend: "ftp", URL: "x"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
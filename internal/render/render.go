@@ -0,0 +1,379 @@
+// Package render renders streamed markdown for the terminal: tables with
+// box drawing and images inline via the iTerm2 or kitty graphics protocols,
+// falling back to plain text where the terminal cannot display them.
+package render
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	xterm "github.com/charmbracelet/x/term"
+)
+
+// maxImageSize caps images rendered inline
+const maxImageSize = 10 << 20
+
+// ImageProtocol is a terminal graphics protocol
+type ImageProtocol int
+
+const (
+	ImagesNone   ImageProtocol = iota // Show image references as text
+	ImagesITerm2                      // iTerm2 inline images (also WezTerm)
+	ImagesKitty                       // kitty graphics protocol (PNG only)
+)
+
+// Capabilities describes what the terminal can display
+type Capabilities struct {
+	Images ImageProtocol
+	Tables bool // Box-drawing tables
+	Color  bool // ANSI colors and styles
+	Width  int  // Columns; 0 if unknown
+}
+
+// Detect returns the capabilities of the terminal on stdout. Output that is
+// not a terminal, or TERM=dumb, gets plain text; NO_COLOR turns off colors.
+func Detect() Capabilities {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return Capabilities{}
+	}
+	term := os.Getenv("TERM")
+	if term == "dumb" {
+		return Capabilities{}
+	}
+
+	caps := Capabilities{Tables: true, Color: os.Getenv("NO_COLOR") == ""}
+	if width, _, err := xterm.GetSize(os.Stdout.Fd()); err == nil {
+		caps.Width = width
+	}
+	switch {
+	case term == "xterm-kitty" || os.Getenv("KITTY_WINDOW_ID") != "":
+		caps.Images = ImagesKitty
+	case os.Getenv("TERM_PROGRAM") == "iTerm.app" || os.Getenv("TERM_PROGRAM") == "WezTerm":
+		caps.Images = ImagesITerm2
+	}
+	return caps
+}
+
+// ImageResolver loads the image a markdown reference points to, e.g. a
+// local file or a stored artifact
+type ImageResolver func(ref string) (data []byte, name string, ok bool)
+
+// FileImages resolves references to local files
+func FileImages(ref string) ([]byte, string, bool) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return nil, "", false
+	}
+	return data, filepath.Base(ref), true
+}
+
+// imagePattern matches markdown images: ![alt](ref)
+var imagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// Markdown renders a markdown stream written in arbitrary chunks. Text is
+// passed through as it arrives, except table rows, which are held until the
+// table ends so columns can be aligned. Images referenced on a line are
+// drawn after the line. With a Styler, blocks are styled instead.
+type Markdown struct {
+	out     io.Writer
+	caps    Capabilities
+	resolve ImageResolver
+
+	line      strings.Builder // Current line
+	holding   bool            // Current line is a table row candidate
+	lineStart bool            // Nothing of the current line was seen yet
+	table     []string        // Pending table rows
+
+	// Styling, see SetStyler
+	styler *Styler
+	block  []string // Lines of the current block
+	fenced bool     // The block is inside a code fence
+	blocks int      // Blocks written since the stream started
+}
+
+// NewMarkdown returns a renderer writing to out; resolve may be nil when
+// images should not be loaded
+func NewMarkdown(out io.Writer, caps Capabilities, resolve ImageResolver) *Markdown {
+	return &Markdown{out: out, caps: caps, resolve: resolve, lineStart: true}
+}
+
+// Write renders the next chunk of the stream
+func (m *Markdown) Write(chunk string) {
+	for chunk != "" {
+		i := strings.IndexByte(chunk, '\n')
+		part := chunk
+		if i >= 0 {
+			part = chunk[:i]
+		}
+		if m.styler != nil {
+			m.styledText(part)
+		} else {
+			m.text(part)
+		}
+		if i < 0 {
+			return
+		}
+		if m.styler != nil {
+			m.styledLine()
+		} else {
+			m.endLine()
+		}
+		chunk = chunk[i+1:]
+	}
+}
+
+// Flush renders anything held back; call it when the stream ends
+func (m *Markdown) Flush() {
+	if m.styler != nil {
+		m.flushStyled()
+		return
+	}
+	if m.holding {
+		m.table = append(m.table, m.line.String())
+		m.line.Reset()
+		m.holding = false
+		m.flushTable()
+	} else {
+		m.flushTable()
+		m.images(m.line.String())
+		m.line.Reset()
+	}
+	m.lineStart = true
+}
+
+// text handles part of a line
+func (m *Markdown) text(s string) {
+	if s == "" {
+		return
+	}
+	if m.lineStart {
+		trimmed := strings.TrimLeft(m.line.String()+s, " \t")
+		if trimmed == "" {
+			// Only indentation so far; wait for the first character
+			m.line.WriteString(s)
+			return
+		}
+		m.lineStart = false
+		m.holding = m.caps.Tables && strings.HasPrefix(trimmed, "|")
+		if !m.holding {
+			m.flushTable()
+			s = m.line.String() + s
+			m.line.Reset()
+		}
+	}
+	m.line.WriteString(s)
+	if !m.holding {
+		io.WriteString(m.out, s)
+	}
+}
+
+// endLine handles a newline
+func (m *Markdown) endLine() {
+	line := m.line.String()
+	m.line.Reset()
+	switch {
+	case m.holding:
+		m.table = append(m.table, line)
+	case m.lineStart:
+		// Blank or indentation-only line
+		m.flushTable()
+		io.WriteString(m.out, line+"\n")
+	default:
+		io.WriteString(m.out, "\n")
+		m.images(line)
+	}
+	m.holding = false
+	m.lineStart = true
+}
+
+// flushTable writes the pending table rows, boxed if they form a table
+func (m *Markdown) flushTable() {
+	if len(m.table) == 0 {
+		return
+	}
+	rows := m.table
+	m.table = nil
+	if rendered, ok := RenderTable(rows); ok {
+		io.WriteString(m.out, rendered)
+	} else {
+		io.WriteString(m.out, strings.Join(rows, "\n"))
+		io.WriteString(m.out, "\n")
+	}
+}
+
+// images draws the images referenced on a completed line
+func (m *Markdown) images(line string) {
+	if m.caps.Images == ImagesNone || m.resolve == nil {
+		return
+	}
+	for _, match := range imagePattern.FindAllStringSubmatch(line, -1) {
+		data, name, ok := m.resolve(match[2])
+		if !ok {
+			continue
+		}
+		if img := InlineImage(m.caps.Images, data, name); img != "" {
+			io.WriteString(m.out, img+"\n")
+		} else {
+			fmt.Fprintf(m.out, "[image: %s]\n", match[2])
+		}
+	}
+}
+
+// InlineImage returns the escape sequence that draws an image, or "" if
+// the protocol cannot show it
+func InlineImage(protocol ImageProtocol, data []byte, name string) string {
+	if len(data) == 0 || len(data) > maxImageSize {
+		return ""
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	switch protocol {
+	case ImagesITerm2:
+		return fmt.Sprintf("\033]1337;File=name=%s;size=%d;inline=1;preserveAspectRatio=1:%s\a",
+			base64.StdEncoding.EncodeToString([]byte(name)), len(data), encoded)
+
+	case ImagesKitty:
+		// f=100 is PNG, the only encoded format kitty accepts
+		if !strings.HasPrefix(string(data), "\x89PNG") {
+			return ""
+		}
+		var sb strings.Builder
+		for i := 0; i < len(encoded); i += 4096 {
+			end := min(i+4096, len(encoded))
+			more := 1
+			if end == len(encoded) {
+				more = 0
+			}
+			if i == 0 {
+				fmt.Fprintf(&sb, "\033_Ga=T,f=100,m=%d;%s\033\\", more, encoded[i:end])
+			} else {
+				fmt.Fprintf(&sb, "\033_Gm=%d;%s\033\\", more, encoded[i:end])
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+// tableAlign is the alignment of a table column
+type tableAlign int
+
+const (
+	alignLeft tableAlign = iota
+	alignRight
+	alignCenter
+)
+
+// separatorCell matches a cell of the header separator row, e.g. :---:
+var separatorCell = regexp.MustCompile(`^:?-{1,}:?$`)
+
+// RenderTable draws a markdown table with box-drawing characters. It
+// reports false if rows are not a table with a header separator row.
+func RenderTable(rows []string) (string, bool) {
+	if len(rows) < 2 {
+		return "", false
+	}
+	header := splitRow(rows[0])
+	seps := splitRow(rows[1])
+	if len(seps) != len(header) {
+		return "", false
+	}
+	aligns := make([]tableAlign, len(seps))
+	for i, sep := range seps {
+		if !separatorCell.MatchString(sep) {
+			return "", false
+		}
+		switch {
+		case strings.HasPrefix(sep, ":") && strings.HasSuffix(sep, ":"):
+			aligns[i] = alignCenter
+		case strings.HasSuffix(sep, ":"):
+			aligns[i] = alignRight
+		}
+	}
+
+	body := make([][]string, 0, len(rows)-2)
+	for _, row := range rows[2:] {
+		cells := splitRow(row)
+		// Pad or cut rows to the header's width
+		for len(cells) < len(header) {
+			cells = append(cells, "")
+		}
+		body = append(body, cells[:len(header)])
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, body...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+
+	var sb strings.Builder
+	border := func(left, mid, right string) {
+		sb.WriteString(left)
+		for i, w := range widths {
+			if i > 0 {
+				sb.WriteString(mid)
+			}
+			sb.WriteString(strings.Repeat("─", w+2))
+		}
+		sb.WriteString(right + "\n")
+	}
+	line := func(cells []string) {
+		sb.WriteString("│")
+		for i, cell := range cells {
+			sb.WriteString(" " + pad(cell, widths[i], aligns[i]) + " │")
+		}
+		sb.WriteString("\n")
+	}
+
+	border("┌", "┬", "┐")
+	line(header)
+	border("├", "┼", "┤")
+	for _, row := range body {
+		line(row)
+	}
+	border("└", "┴", "┘")
+	return sb.String(), true
+}
+
+// splitRow returns the trimmed cells of a table row
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	cells := strings.Split(row, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(c)
+	}
+	return cells
+}
+
+// pad aligns a cell within a column width
+func pad(cell string, width int, align tableAlign) string {
+	gap := width - utf8.RuneCountInString(cell)
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", gap) + cell
+	case alignCenter:
+		left := gap / 2
+		return strings.Repeat(" ", left) + cell + strings.Repeat(" ", gap-left)
+	}
+	return cell + strings.Repeat(" ", gap)
+}
+
+// Fence wraps text in a markdown code fence of language lang (may be
+// empty), longer than any backtick run inside the text
+func Fence(text, lang string) string {
+	ticks := "```"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	return ticks + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + ticks
+}
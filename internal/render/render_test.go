@@ -0,0 +1,221 @@
+package render
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderTable(t *testing.T) {
+	rows := []string{
+		"| Name | Size |",
+		"|:-----|-----:|",
+		"| a.go | 12 |",
+		"| béta.go | 3456 |",
+	}
+	got, ok := RenderTable(rows)
+	if !ok {
+		t.Fatal("expected a table")
+	}
+	want := "┌─────────┬──────┐\n" +
+		"│ Name    │ Size │\n" +
+		"├─────────┼──────┤\n" +
+		"│ a.go    │   12 │\n" +
+		"│ béta.go │ 3456 │\n" +
+		"└─────────┴──────┘\n"
+	if got != want {
+		t.Errorf("RenderTable() =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, ok := RenderTable([]string{"| a | b |", "| c | d |"}); ok {
+		t.Error("rows without a separator should not be a table")
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	input := "Results:\n| k | v |\n|---|---|\n| x | 1 |\nDone.\n"
+
+	t.Run("tables", func(t *testing.T) {
+		var out bytes.Buffer
+		md := NewMarkdown(&out, Capabilities{Tables: true}, nil)
+		// Chunks split lines at arbitrary points, as streams do
+		for i := 0; i < len(input); i += 3 {
+			md.Write(input[i:min(i+3, len(input))])
+		}
+		md.Flush()
+
+		got := out.String()
+		if !strings.HasPrefix(got, "Results:\n┌───┬───┐\n│ k │ v │\n") || !strings.HasSuffix(got, "└───┴───┘\nDone.\n") {
+			t.Errorf("unexpected output:\n%s", got)
+		}
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		var out bytes.Buffer
+		md := NewMarkdown(&out, Capabilities{}, nil)
+		md.Write(input)
+		md.Flush()
+		if out.String() != input {
+			t.Errorf("plain output changed the text:\n%s", out.String())
+		}
+	})
+
+	t.Run("unterminated table", func(t *testing.T) {
+		var out bytes.Buffer
+		md := NewMarkdown(&out, Capabilities{Tables: true}, nil)
+		md.Write("| not | a table")
+		md.Flush()
+		if out.String() != "| not | a table\n" {
+			t.Errorf("got %q", out.String())
+		}
+	})
+
+	t.Run("images", func(t *testing.T) {
+		png := []byte("\x89PNG\r\n\x1a\nimage")
+		resolve := func(ref string) ([]byte, string, bool) {
+			if ref == "chart.png" {
+				return png, ref, true
+			}
+			return nil, "", false
+		}
+
+		var out bytes.Buffer
+		md := NewMarkdown(&out, Capabilities{Images: ImagesITerm2}, resolve)
+		md.Write("See ![chart](chart.png) and ![gone](missing.png)\n")
+		got := out.String()
+		if !strings.Contains(got, "\033]1337;File=") || strings.Count(got, "\033]1337;") != 1 {
+			t.Errorf("expected one inline image, got %q", got)
+		}
+
+		out.Reset()
+		md = NewMarkdown(&out, Capabilities{}, resolve)
+		md.Write("See ![chart](chart.png)\n")
+		if strings.Contains(out.String(), "\033") {
+			t.Errorf("images drawn without terminal support: %q", out.String())
+		}
+	})
+}
+
+func TestMarkdownStyled(t *testing.T) {
+	input := "# Title\n\nSome **bold** text.\n\n```go\nfunc main() {\n\n\tfmt.Println(1)\n}\n```\n\n- a\n- b"
+
+	t.Run("blocks", func(t *testing.T) {
+		styler, err := NewStyler("notty", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		md := NewMarkdown(&out, Capabilities{}, nil)
+		md.SetStyler(styler)
+		for i := 0; i < len(input); i += 5 {
+			md.Write(input[i:min(i+5, len(input))])
+			// Nothing of a block is shown before it is complete
+			if strings.Contains(out.String(), "fmt.Println") && !strings.Contains(out.String(), "}") {
+				t.Fatalf("code block shown before it ended:\n%s", out.String())
+			}
+		}
+		md.Flush()
+
+		want := "  # Title\n\n  Some **bold** text.\n\n    func main() {\n\n    \tfmt.Println(1)\n    }\n\n  • a\n  • b\n"
+		if out.String() != want {
+			t.Errorf("got\n%q\nwant\n%q", out.String(), want)
+		}
+	})
+
+	t.Run("highlighting", func(t *testing.T) {
+		styler, err := NewStyler("dark", 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := styler.Render("```go\nfunc main() {}\n```")
+		if !strings.Contains(got, "\033[") || !strings.Contains(got, "func") {
+			t.Errorf("expected highlighted code, got %q", got)
+		}
+		if strings.HasSuffix(strings.TrimSuffix(got, "\033[0m"), " ") {
+			t.Errorf("expected padding trimmed, got %q", got)
+		}
+	})
+
+	if _, err := NewStyler("no-such-theme", 0); err == nil {
+		t.Error("expected an unknown theme to fail")
+	}
+}
+
+func TestInlineImage(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n" + strings.Repeat("x", 5000))
+
+	kitty := InlineImage(ImagesKitty, png, "a.png")
+	if !strings.HasPrefix(kitty, "\033_Ga=T,f=100,m=1;") || !strings.Contains(kitty, "\033_Gm=0;") {
+		t.Errorf("unexpected kitty sequence: %.40q", kitty)
+	}
+	if InlineImage(ImagesKitty, []byte("GIF89a"), "a.gif") != "" {
+		t.Error("kitty should only draw PNG images")
+	}
+	if InlineImage(ImagesNone, png, "a.png") != "" {
+		t.Error("no protocol should draw nothing")
+	}
+}
+
+func TestTheme(t *testing.T) {
+	for spec, want := range map[string]Style{"bold blue": "1;34", "1;33": "1;33", "none": "", "Bright-Cyan": "96"} {
+		if got, err := ParseStyle(spec); err != nil || got != want {
+			t.Errorf("ParseStyle(%q) = %q, %v; want %q", spec, got, err, want)
+		}
+	}
+	if _, err := ParseStyle("blod"); err == nil {
+		t.Error("expected an unknown style to fail")
+	}
+
+	theme, err := NewTheme("light", map[string]string{"prompt": "bold blue", "dim": "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Prompt != "1;34" || theme.Dim != "" || theme.Heading != LightTheme.Heading {
+		t.Errorf("expected the overrides on the light theme, got %+v", theme)
+	}
+	if got := theme.Prompt.Render("ok?"); got != "\x1b[1;34mok?\x1b[0m" {
+		t.Errorf("Render() = %q", got)
+	}
+	if got := theme.Plain().Heading.Render("Tool"); got != "Tool" {
+		t.Errorf("expected the plain theme to leave text as is, got %q", got)
+	}
+	if _, err := NewTheme("dark", map[string]string{"banner": "red"}); err == nil {
+		t.Error("expected an unknown role to fail")
+	}
+	if _, err := NewTheme("solarized", nil); err == nil {
+		t.Error("expected an unknown theme to fail")
+	}
+}
+
+func TestUseColor(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	t.Setenv("NO_COLOR", "")
+	if on, _ := UseColor("auto", f); on {
+		t.Error("expected no colors for output that is not a terminal")
+	}
+	if on, _ := UseColor("always", f); !on {
+		t.Error("expected always to force colors")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if on, _ := UseColor("auto"); on {
+		t.Error("expected NO_COLOR to turn colors off")
+	}
+	if _, err := UseColor("sometimes"); err == nil {
+		t.Error("expected an unknown mode to fail")
+	}
+}
+
+func TestFence(t *testing.T) {
+	if got := Fence("x := 1\n", "go"); got != "```go\nx := 1\n```" {
+		t.Errorf("Fence = %q", got)
+	}
+	if got := Fence("see ```go\nblock\n```", ""); !strings.HasPrefix(got, "````\n") || !strings.HasSuffix(got, "\n````") {
+		t.Errorf("expected a longer fence around backticks, got %q", got)
+	}
+}
@@ -0,0 +1,123 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+// DefaultTheme picks the dark or light style by the terminal's background
+const DefaultTheme = "auto"
+
+// defaultWidth wraps styled text when the terminal width is unknown
+const defaultWidth = 80
+
+// Styler renders markdown styled for the terminal with glamour: headings,
+// emphasis, lists, quotes, tables and fenced code highlighted by language
+type Styler struct {
+	renderer *glamour.TermRenderer
+}
+
+// NewStyler returns a styler for a glamour style: auto, dark, light,
+// dracula, pink, ascii, notty, or the path of a JSON style file. Text is
+// wrapped at width columns (0 = 80).
+func NewStyler(theme string, width int) (*Styler, error) {
+	if theme == "" {
+		theme = DefaultTheme
+	}
+	if width <= 0 {
+		width = defaultWidth
+	}
+	r, err := glamour.NewTermRenderer(glamour.WithStylePath(theme), glamour.WithWordWrap(width))
+	if err != nil {
+		return nil, fmt.Errorf("markdown theme %q: %w", theme, err)
+	}
+	return &Styler{renderer: r}, nil
+}
+
+// trailingPadding matches the spaces glamour pads lines to the wrap width
+// with, and their escape sequences
+var trailingPadding = regexp.MustCompile(`(?:\x1b\[[0-9;]*m|[ \t])+$`)
+
+// Render styles markdown, without the padding and blank lines glamour puts
+// around the document; markdown it cannot render is returned as is
+func (s *Styler) Render(md string) string {
+	out, err := s.renderer.Render(md)
+	if err != nil {
+		return md
+	}
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		line = trailingPadding.ReplaceAllString(line, "")
+		if strings.Contains(line, "\x1b[") {
+			line += "\x1b[0m"
+		}
+		lines[i] = line
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SetStyler makes the renderer style the stream with s, block by block: a
+// paragraph, list or fenced code block is shown once it is complete. A nil
+// styler passes text through as it arrives again.
+func (m *Markdown) SetStyler(s *Styler) {
+	m.styler = s
+}
+
+// styledText handles part of a line when styling
+func (m *Markdown) styledText(s string) {
+	m.line.WriteString(s)
+}
+
+// styledLine adds a completed line to the current block; a blank line
+// outside a code fence completes the block
+func (m *Markdown) styledLine() {
+	line := m.line.String()
+	m.line.Reset()
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		m.fenced = !m.fenced
+	}
+	if trimmed == "" && !m.fenced {
+		m.flushBlock()
+		return
+	}
+	m.block = append(m.block, line)
+}
+
+// flushBlock writes the current block styled, followed by the images it
+// references
+func (m *Markdown) flushBlock() {
+	if len(m.block) == 0 {
+		return
+	}
+	lines := m.block
+	m.block = nil
+	if m.blocks > 0 {
+		io.WriteString(m.out, "\n")
+	}
+	m.blocks++
+	io.WriteString(m.out, m.styler.Render(strings.Join(lines, "\n"))+"\n")
+	for _, line := range lines {
+		m.images(line)
+	}
+}
+
+// flushStyled renders what is left of the stream when it ends
+func (m *Markdown) flushStyled() {
+	if m.line.Len() > 0 {
+		m.styledLine()
+	}
+	m.fenced = false
+	m.flushBlock()
+	m.blocks = 0
+}
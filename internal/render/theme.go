@@ -0,0 +1,172 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Style is the SGR parameters of an ANSI style, such as "1;33" for bold
+// yellow; the empty style leaves text as is
+type Style string
+
+// Render wraps text in the style
+func (s Style) Render(text string) string {
+	if s == "" || text == "" {
+		return text
+	}
+	return "\x1b[" + string(s) + "m" + text + "\x1b[0m"
+}
+
+// sgrNames are the words a style can be written with
+var sgrNames = map[string]string{
+	"bold": "1", "dim": "2", "italic": "3", "underline": "4",
+	"black": "30", "red": "31", "green": "32", "yellow": "33",
+	"blue": "34", "magenta": "35", "cyan": "36", "white": "37", "gray": "90",
+	"bright-red": "91", "bright-green": "92", "bright-yellow": "93",
+	"bright-blue": "94", "bright-magenta": "95", "bright-cyan": "96", "bright-white": "97",
+}
+
+// ParseStyle reads a style written as words, such as "bold yellow", or as
+// SGR parameters such as "1;33"; "none" and "" are unstyled
+func ParseStyle(spec string) (Style, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	if spec == "" || spec == "none" {
+		return "", nil
+	}
+	if isSGR(spec) {
+		return Style(spec), nil
+	}
+	var codes []string
+	for _, word := range strings.Fields(spec) {
+		code, ok := sgrNames[word]
+		if !ok {
+			names := make([]string, 0, len(sgrNames))
+			for name := range sgrNames {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("unknown style %q: use %s, or SGR codes such as 1;33", word, strings.Join(names, ", "))
+		}
+		codes = append(codes, code)
+	}
+	return Style(strings.Join(codes, ";")), nil
+}
+
+// isSGR reports whether spec is SGR parameters: numbers separated by ;
+func isSGR(spec string) bool {
+	for _, part := range strings.Split(spec, ";") {
+		if _, err := strconv.Atoi(part); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Theme holds the styles of igent's own terminal output; answers are
+// styled by the markdown theme instead
+type Theme struct {
+	Name    string // dark or light
+	Heading Style  // The banner of a tool call
+	Label   Style  // Field names of a tool call, such as Tool: and Payload:
+	Command Style  // The command a shell tool call runs
+	Prompt  Style  // Questions such as tool confirmations
+	Warning Style  // Interrupted answers and other warnings
+	Dim     Style  // Reasoning, tool output and the usage footer
+}
+
+// DarkTheme suits terminals with a dark background
+var DarkTheme = Theme{
+	Name:    "dark",
+	Heading: "1;33",
+	Label:   "1;36",
+	Command: "1;32",
+	Prompt:  "1;33",
+	Warning: "1;33",
+	Dim:     "2",
+}
+
+// LightTheme suits terminals with a light background, where yellow and
+// cyan are hard to read
+var LightTheme = Theme{
+	Name:    "light",
+	Heading: "1;35",
+	Label:   "1;34",
+	Command: "1;32",
+	Prompt:  "1;35",
+	Warning: "1;31",
+	Dim:     "2",
+}
+
+// Plain returns the theme without styles, for output without colors
+func (t Theme) Plain() Theme {
+	return Theme{Name: t.Name}
+}
+
+// ThemeRoles are the keys of the styles a theme can override
+var ThemeRoles = []string{"command", "dim", "heading", "label", "prompt", "warning"}
+
+// NewTheme returns the dark or light theme, picking by the terminal's
+// background for "auto" or "", with styles overridden by role (see
+// ThemeRoles)
+func NewTheme(name string, overrides map[string]string) (Theme, error) {
+	var t Theme
+	switch strings.ToLower(name) {
+	case "", "auto":
+		t = DarkTheme
+		if !lipgloss.HasDarkBackground() {
+			t = LightTheme
+		}
+	case "dark":
+		t = DarkTheme
+	case "light":
+		t = LightTheme
+	default:
+		return Theme{}, fmt.Errorf("unknown theme %q: use auto, dark or light", name)
+	}
+
+	roles := map[string]*Style{
+		"heading": &t.Heading, "label": &t.Label, "command": &t.Command,
+		"prompt": &t.Prompt, "warning": &t.Warning, "dim": &t.Dim,
+	}
+	for role, spec := range overrides {
+		field, ok := roles[strings.ToLower(role)]
+		if !ok {
+			return Theme{}, fmt.Errorf("unknown color %q: use %s", role, strings.Join(ThemeRoles, ", "))
+		}
+		style, err := ParseStyle(spec)
+		if err != nil {
+			return Theme{}, fmt.Errorf("%s: %w", role, err)
+		}
+		*field = style
+	}
+	return t, nil
+}
+
+// UseColor decides whether output to files gets colors: "always",
+// "never", or "auto" (or "") for when every file is a terminal, TERM is not
+// dumb and NO_COLOR is unset
+func UseColor(mode string, files ...*os.File) (bool, error) {
+	switch strings.ToLower(mode) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "", "auto":
+	default:
+		return false, fmt.Errorf("unknown color mode %q: use auto, always or never", mode)
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false, nil
+	}
+	for _, f := range files {
+		if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
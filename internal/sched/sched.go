@@ -0,0 +1,210 @@
+// Package sched schedules LLM provider calls: a concurrency cap per
+// provider keeps igent within the provider's rate limits, and waiting calls
+// are admitted by priority (interactive before scheduled before batch), so
+// chats stay responsive while background work queues up. Calls that have
+// waited too long are admitted first regardless of priority, so low
+// priorities never starve.
+package sched
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority orders waiting calls; higher runs first
+type Priority int
+
+const (
+	Batch       Priority = iota // Autonomous runs, debates and other background work
+	Scheduled                   // Scheduled tasks
+	Interactive                 // A user waiting for the answer
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Batch:
+		return "batch"
+	case Scheduled:
+		return "scheduled"
+	case Interactive:
+		return "interactive"
+	}
+	return "unknown"
+}
+
+// DefaultMaxWait is how long a call waits before it is admitted ahead of
+// higher priorities
+const DefaultMaxWait = 30 * time.Second
+
+// Stats are the queue-time metrics of one priority
+type Stats struct {
+	Calls     int           `json:"calls"`      // Calls admitted
+	Waited    int           `json:"waited"`     // Calls that had to queue
+	TotalWait time.Duration `json:"total_wait"` // Time spent queuing, over all calls
+	MaxWait   time.Duration `json:"max_wait"`
+	Queued    int           `json:"queued"` // Calls waiting now
+}
+
+// Scheduler admits provider calls under per-provider concurrency caps.
+// It is safe for concurrent use.
+type Scheduler struct {
+	mu      sync.Mutex
+	maxWait time.Duration
+	queues  map[string]*queue
+	stats   map[Priority]*Stats
+}
+
+// queue is the state of one provider
+type queue struct {
+	limit   int // 0 = unlimited
+	running int
+	waiting []*waiter // In arrival order
+}
+
+type waiter struct {
+	priority Priority
+	since    time.Time
+	ready    chan struct{} // Closed when admitted
+}
+
+// New returns a scheduler that admits starving calls after maxWait
+// (0 = DefaultMaxWait)
+func New(maxWait time.Duration) *Scheduler {
+	if maxWait <= 0 {
+		maxWait = DefaultMaxWait
+	}
+	return &Scheduler{
+		maxWait: maxWait,
+		queues:  make(map[string]*queue),
+		stats:   make(map[Priority]*Stats),
+	}
+}
+
+// Default is the process-wide scheduler shared by all agents
+var Default = New(0)
+
+// SetLimit caps the concurrent calls to a provider (0 = unlimited)
+func (s *Scheduler) SetLimit(provider string, limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queue(provider)
+	q.limit = limit
+	s.admit(q)
+}
+
+// Acquire waits until a call to provider may start and returns a function
+// that ends it. It returns the context's error if ctx ends first.
+func (s *Scheduler) Acquire(ctx context.Context, provider string, p Priority) (release func(), err error) {
+	s.mu.Lock()
+	q := s.queue(provider)
+	st := s.stat(p)
+	if len(q.waiting) == 0 && (q.limit <= 0 || q.running < q.limit) {
+		q.running++
+		st.Calls++
+		s.mu.Unlock()
+		return s.releaser(q), nil
+	}
+
+	w := &waiter{priority: p, since: time.Now(), ready: make(chan struct{})}
+	q.waiting = append(q.waiting, w)
+	st.Queued++
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return s.releaser(q), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Admitted meanwhile: hand the slot on
+			q.running--
+			s.admit(q)
+		default:
+			for i, other := range q.waiting {
+				if other == w {
+					q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+					break
+				}
+			}
+			st.Queued--
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Stats returns the queue-time metrics by priority
+func (s *Scheduler) Stats() map[Priority]Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[Priority]Stats, len(s.stats))
+	for p, st := range s.stats {
+		stats[p] = *st
+	}
+	return stats
+}
+
+// releaser returns a function ending a call, safe to call more than once
+func (s *Scheduler) releaser(q *queue) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			q.running--
+			s.admit(q)
+		})
+	}
+}
+
+// admit starts waiting calls while the cap allows. s.mu must be held.
+func (s *Scheduler) admit(q *queue) {
+	now := time.Now()
+	for len(q.waiting) > 0 && (q.limit <= 0 || q.running < q.limit) {
+		next := 0
+		if now.Sub(q.waiting[0].since) < s.maxWait {
+			// Nobody is starving: the earliest call of the highest priority
+			for i, w := range q.waiting {
+				if w.priority > q.waiting[next].priority {
+					next = i
+				}
+			}
+		}
+		w := q.waiting[next]
+		q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+		q.running++
+
+		wait := now.Sub(w.since)
+		st := s.stat(w.priority)
+		st.Queued--
+		st.Calls++
+		st.Waited++
+		st.TotalWait += wait
+		if wait > st.MaxWait {
+			st.MaxWait = wait
+		}
+		close(w.ready)
+	}
+}
+
+// queue returns the state of a provider. s.mu must be held.
+func (s *Scheduler) queue(provider string) *queue {
+	q, ok := s.queues[provider]
+	if !ok {
+		q = &queue{}
+		s.queues[provider] = q
+	}
+	return q
+}
+
+// stat returns the metrics of a priority. s.mu must be held.
+func (s *Scheduler) stat(p Priority) *Stats {
+	st, ok := s.stats[p]
+	if !ok {
+		st = &Stats{}
+		s.stats[p] = st
+	}
+	return st
+}
@@ -0,0 +1,108 @@
+package sched
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// enqueue starts an Acquire in the background and waits until it queues
+func enqueue(t *testing.T, s *Scheduler, p Priority, order chan<- Priority) {
+	t.Helper()
+	before := s.Stats()[p].Queued
+	go func() {
+		release, err := s.Acquire(context.Background(), "prov", p)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		order <- p
+		release()
+	}()
+	for deadline := time.Now().Add(time.Second); s.Stats()[p].Queued == before; {
+		if time.Now().After(deadline) {
+			t.Fatal("call did not queue")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	s := New(time.Hour)
+	s.SetLimit("prov", 1)
+
+	release, err := s.Acquire(context.Background(), "prov", Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := make(chan Priority, 3)
+	enqueue(t, s, Batch, order)
+	enqueue(t, s, Interactive, order)
+	enqueue(t, s, Scheduled, order)
+	release()
+	release() // Releasing twice must not free a second slot
+
+	want := []Priority{Interactive, Scheduled, Batch}
+	for i, p := range want {
+		if got := <-order; got != p {
+			t.Fatalf("call %d ran %s, want %s", i+1, got, p)
+		}
+	}
+
+	stats := s.Stats()
+	if st := stats[Batch]; st.Calls != 2 || st.Waited != 1 || st.Queued != 0 || st.MaxWait <= 0 {
+		t.Errorf("batch stats = %+v", st)
+	}
+	if st := stats[Interactive]; st.Calls != 1 || st.Waited != 1 {
+		t.Errorf("interactive stats = %+v", st)
+	}
+}
+
+func TestStarvingCallsGoFirst(t *testing.T) {
+	s := New(20 * time.Millisecond)
+	s.SetLimit("prov", 1)
+
+	release, _ := s.Acquire(context.Background(), "prov", Interactive)
+	order := make(chan Priority, 2)
+	enqueue(t, s, Batch, order)
+	time.Sleep(30 * time.Millisecond)
+	enqueue(t, s, Interactive, order)
+	release()
+
+	if got := <-order; got != Batch {
+		t.Errorf("starving batch call should run first, got %s", got)
+	}
+	<-order
+}
+
+func TestAcquireCancelled(t *testing.T) {
+	s := New(0)
+	s.SetLimit("prov", 1)
+	release, _ := s.Acquire(context.Background(), "prov", Interactive)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, "prov", Batch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if q := s.Stats()[Batch].Queued; q != 0 {
+		t.Errorf("cancelled call still queued: %d", q)
+	}
+
+	// Other providers and unlimited caps are not affected
+	other, err := s.Acquire(context.Background(), "other", Batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other()
+
+	// Raising the cap admits waiting calls
+	order := make(chan Priority, 1)
+	enqueue(t, s, Scheduled, order)
+	s.SetLimit("prov", 2)
+	if got := <-order; got != Scheduled {
+		t.Errorf("got %s", got)
+	}
+	release()
+}
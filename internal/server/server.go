@@ -0,0 +1,378 @@
+// Package server exposes the agent over an OpenAI-compatible HTTP API, so
+// clients and UIs written for chat models (Open WebUI and the like) can
+// talk to igent as if it were a model. Memory, skills and tools take part
+// in every request as they do in the REPL.
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/logger"
+	"github.com/igm/igent/internal/storage"
+)
+
+// ConversationHeader selects the conversation a request continues; the
+// response names the conversation it was answered in with it
+const ConversationHeader = "X-Igent-Conversation"
+
+// maxRequestBytes bounds the body of a request
+const maxRequestBytes = 8 << 20
+
+// Server answers chat completion requests with the agent
+type Server struct {
+	agent  *agent.Agent
+	apiKey string
+	model  string
+	log    *slog.Logger
+
+	// The agent works on one conversation at a time, so requests are
+	// answered one after the other
+	mu sync.Mutex
+
+	// chats maps the chatKey of a client's chat so far, with igent's last
+	// answer, to the conversation the chat continues
+	chats map[string]string
+}
+
+// New creates a server for ag with the server config
+func New(ag *agent.Agent, cfg config.ServerConfig) *Server {
+	model := cfg.Model
+	if model == "" {
+		model = "igent"
+	}
+	return &Server{
+		agent:  ag,
+		apiKey: cfg.APIKey,
+		model:  model,
+		log:    logger.L().With("component", "server"),
+		chats:  make(map[string]string),
+	}
+}
+
+// Handler returns the HTTP handler of the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", s.handleModels)
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	return s.authenticate(mux)
+}
+
+// authenticate requires the configured API key as a bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiKey != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.apiKey)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid_api_key", "invalid or missing API key")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Model is an entry of the model list
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"object": "list",
+		"data":   []Model{{ID: s.model, Object: "model", OwnedBy: "igent"}},
+	})
+}
+
+// Message is a message of a chat completion request or response
+type Message struct {
+	Role    string  `json:"role,omitempty"`
+	Content Content `json:"content"`
+}
+
+// Content is the content of a message: a string, or a list of parts of
+// which the text parts are kept
+type Content string
+
+// UnmarshalJSON accepts both content forms
+func (c *Content) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = Content(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return errors.New("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	*c = Content(strings.Join(texts, "\n"))
+	return nil
+}
+
+// ChatCompletionRequest is the body of POST /v1/chat/completions. Sampling
+// parameters are accepted and ignored; the agent's config applies.
+type ChatCompletionRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	User     string    `json:"user"` // End user, whose chats are kept apart from others'
+}
+
+// Choice is a choice of a chat completion
+type Choice struct {
+	Index        int      `json:"index"`
+	Message      *Message `json:"message,omitempty"`
+	Delta        *Message `json:"delta,omitempty"`
+	FinishReason *string  `json:"finish_reason"`
+}
+
+// ChatCompletion is a chat completion response, or a chunk of a streamed one
+type ChatCompletion struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   *Usage   `json:"usage,omitempty"`
+}
+
+// Usage is the token usage of a completion, summed over the provider calls
+// of the turn
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// handleChatCompletions answers the last user message of the request in
+// the agent's conversation. The agent keeps the history itself, so earlier
+// messages only serve to tell which conversation the request continues.
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use POST")
+		return
+	}
+	var req ChatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+	if req.Model != "" && req.Model != s.model {
+		writeError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("unknown model %q (want %s)", req.Model, s.model))
+		return
+	}
+	if len(req.Messages) == 0 || req.Messages[len(req.Messages)-1].Role != "user" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the last message must be a user message")
+		return
+	}
+	input := string(req.Messages[len(req.Messages)-1].Content)
+	if strings.TrimSpace(input) == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "the user message is empty")
+		return
+	}
+	conversationID := r.Header.Get(ConversationHeader)
+	if conversationID != "" {
+		if err := storage.ValidateConversationID(conversationID); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Without the header, a request continues the chat whose history it
+	// resends, and anything else starts a conversation of its own
+	named := conversationID != ""
+	key := chatKey(req.User, req.Messages[:len(req.Messages)-1])
+	if !named {
+		if conversationID = s.chats[key]; conversationID == "" {
+			conversationID = newConversationID()
+		}
+	}
+	// Requests are separate clients: none inherits another's shell sessions
+	s.agent.ResetToolSession()
+	if err := s.agent.SetConversation(conversationID); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	// A used-up quota or budget is answered with its status before a
+	// stream commits to 200
+	if err := s.agent.CheckLimits(); err != nil {
+		s.log.Warn("chat completion refused", "conversation", conversationID, "error", err)
+		writeError(w, errorStatus(err), "api_error", err.Error())
+		return
+	}
+	s.log.Info("chat completion", "conversation", conversationID, "stream", req.Stream)
+	w.Header().Set(ConversationHeader, conversationID)
+	answered := func(result *agent.ChatResult) {
+		if named || result == nil {
+			return
+		}
+		delete(s.chats, key)
+		s.chats[chatKey(req.User, append(req.Messages[:len(req.Messages):len(req.Messages)],
+			Message{Role: "assistant", Content: Content(result.Content)}))] = conversationID
+	}
+
+	completion := ChatCompletion{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Created: time.Now().Unix(),
+		Model:   s.model,
+	}
+	if req.Stream {
+		answered(s.stream(w, r, completion, input))
+		return
+	}
+
+	result, err := s.agent.Chat(r.Context(), input)
+	if err != nil {
+		s.log.Warn("chat completion failed", "conversation", conversationID, "error", err)
+		writeError(w, errorStatus(err), "api_error", err.Error())
+		return
+	}
+	answered(result)
+	finish := finishReason(result)
+	completion.Object = "chat.completion"
+	completion.Choices = []Choice{{
+		Message:      &Message{Role: "assistant", Content: Content(result.Content)},
+		FinishReason: &finish,
+	}}
+	completion.Usage = &Usage{
+		PromptTokens:     result.PromptTokens,
+		CompletionTokens: result.OutputTokens,
+		TotalTokens:      result.TotalTokens,
+	}
+	writeJSON(w, http.StatusOK, completion)
+}
+
+// stream answers as server-sent events of chat.completion.chunk objects,
+// ended by [DONE], and returns the turn's result. An error after the stream
+// started is sent as an error event, the status having been written
+// already, and nil is returned.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, completion ChatCompletion, input string) *agent.ChatResult {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	completion.Object = "chat.completion.chunk"
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta Message, finish *string) {
+		completion.Choices = []Choice{{Delta: &delta, FinishReason: finish}}
+		send(completion)
+	}
+
+	chunk(Message{Role: "assistant"}, nil)
+	streamed := false
+	result, err := s.agent.ChatStream(r.Context(), input, func(text string) {
+		streamed = true
+		chunk(Message{Content: Content(text)}, nil)
+	})
+	if err != nil {
+		s.log.Warn("chat completion failed", "error", err)
+		send(errorBody("api_error", err.Error()))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		return nil
+	}
+	if !streamed {
+		// The provider does not stream; send the answer in one piece
+		chunk(Message{Content: Content(result.Content)}, nil)
+	}
+	finish := finishReason(result)
+	chunk(Message{}, &finish)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return result
+}
+
+// finishReason is the finish reason of a turn's final answer, stop if the
+// provider gave none
+func finishReason(result *agent.ChatResult) string {
+	if result.FinishReason == "" {
+		return llm.FinishReasonStop
+	}
+	return result.FinishReason
+}
+
+// chatKey hashes a chat's end user and messages. System messages are left
+// out, as clients may send them with the first request only.
+func chatKey(user string, messages []Message) string {
+	h := sha256.New()
+	h.Write([]byte(user))
+	for _, m := range messages {
+		if m.Role != "system" {
+			fmt.Fprintf(h, "\x00%s\x00%s", m.Role, m.Content)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// newConversationID returns a random conversation ID for a chat a request
+// starts
+func newConversationID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "api-" + hex.EncodeToString(b)
+}
+
+// errorStatus returns the HTTP status of an agent error, such as 429 for a
+// used-up quota
+func errorStatus(err error) int {
+	var status interface{ StatusCode() int }
+	if errors.As(err, &status) {
+		return status.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+func errorBody(errType, message string) map[string]interface{} {
+	return map[string]interface{}{
+		"error": map[string]string{"message": message, "type": errType},
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	writeJSON(w, status, errorBody(errType, message))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
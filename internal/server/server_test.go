@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/pkg/igenttest"
+)
+
+func newTestServer(t *testing.T, cfg config.ServerConfig, replies ...igenttest.Reply) (*httptest.Server, *igenttest.Harness) {
+	t.Helper()
+	h := igenttest.New(t, replies...)
+	srv := httptest.NewServer(New(h.Agent, cfg).Handler())
+	t.Cleanup(srv.Close)
+	return srv, h
+}
+
+func post(t *testing.T, srv *httptest.Server, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestChatCompletions(t *testing.T) {
+	srv, h := newTestServer(t, config.ServerConfig{}, igenttest.Text("Hello!"), igenttest.Text("Fine."),
+		igenttest.Text("Hello again!"), igenttest.Text("Hi there!"))
+
+	resp := post(t, srv, `{"model": "igent", "user": "alice", "messages": [{"role": "system", "content": "Be terse"}, {"role": "user", "content": "Hi"}]}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var completion ChatCompletion
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		t.Fatal(err)
+	}
+	if completion.Object != "chat.completion" || len(completion.Choices) != 1 ||
+		completion.Choices[0].Message.Content != "Hello!" || *completion.Choices[0].FinishReason != "stop" || completion.Usage == nil {
+		t.Errorf("unexpected completion %+v", completion)
+	}
+	id := resp.Header.Get(ConversationHeader)
+	if !strings.HasPrefix(id, "api-") {
+		t.Fatalf("expected the response to name an api- conversation, got %q", id)
+	}
+
+	// The client sends the whole chat again; the same conversation continues
+	body := `{"user": "alice", "messages": [{"role": "user", "content": "Hi"}, {"role": "assistant", "content": "Hello!"},
+		{"role": "user", "content": [{"type": "text", "text": "How are you?"}]}]}`
+	if resp := post(t, srv, body, nil); resp.StatusCode != http.StatusOK || resp.Header.Get(ConversationHeader) != id {
+		t.Fatalf("expected 200 in %s, got %d in %s", id, resp.StatusCode, resp.Header.Get(ConversationHeader))
+	}
+	messages := h.Conversation(id)
+	if len(messages) != 4 || messages[2].Content != "How are you?" || messages[3].Content != "Fine." {
+		t.Errorf("unexpected conversation %s: %+v", id, messages)
+	}
+
+	// New chats opening with the same message, from the same user or from
+	// a client that names none, get conversations of their own
+	seen := map[string]bool{id: true}
+	for _, body := range []string{
+		`{"user": "alice", "messages": [{"role": "user", "content": "Hi"}]}`,
+		`{"messages": [{"role": "user", "content": "Hi"}]}`,
+	} {
+		resp := post(t, srv, body, nil)
+		other := resp.Header.Get(ConversationHeader)
+		if resp.StatusCode != http.StatusOK || seen[other] {
+			t.Errorf("expected 200 in a new conversation, got %d in %q", resp.StatusCode, other)
+		}
+		seen[other] = true
+	}
+	h.AssertScriptDone()
+}
+
+func TestChatCompletions_Stream(t *testing.T) {
+	srv, h := newTestServer(t, config.ServerConfig{}, igenttest.Text("Streamed answer"))
+
+	header := http.Header{ConversationHeader: {"webui"}}
+	resp := post(t, srv, `{"stream": true, "messages": [{"role": "user", "content": "Hi"}]}`, header)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	var content strings.Builder
+	var finish string
+	done := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk ChatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("unexpected chunk object %q", chunk.Object)
+		}
+		content.WriteString(string(chunk.Choices[0].Delta.Content))
+		if chunk.Choices[0].FinishReason != nil {
+			finish = *chunk.Choices[0].FinishReason
+		}
+	}
+	if !done || content.String() != "Streamed answer" || finish != "stop" {
+		t.Errorf("unexpected stream: done %v, content %q, finish %q", done, content.String(), finish)
+	}
+	if messages := h.Conversation("webui"); len(messages) != 2 {
+		t.Errorf("expected the turn stored in webui, got %+v", messages)
+	}
+}
+
+func TestChatCompletions_Errors(t *testing.T) {
+	srv, _ := newTestServer(t, config.ServerConfig{APIKey: "secret", Model: "my-agent"},
+		igenttest.Fail(errors.New("provider down")))
+	auth := http.Header{"Authorization": {"Bearer secret"}}
+
+	tests := []struct {
+		name   string
+		body   string
+		header http.Header
+		status int
+	}{
+		{"no key", `{"messages": [{"role": "user", "content": "Hi"}]}`, nil, http.StatusUnauthorized},
+		{"bad JSON", `{`, auth, http.StatusBadRequest},
+		{"unknown model", `{"model": "gpt-4", "messages": [{"role": "user", "content": "Hi"}]}`, auth, http.StatusNotFound},
+		{"no user message", `{"messages": [{"role": "system", "content": "Hi"}]}`, auth, http.StatusBadRequest},
+		{"bad conversation", `{"messages": [{"role": "user", "content": "Hi"}]}`,
+			http.Header{"Authorization": {"Bearer secret"}, ConversationHeader: {"../x"}}, http.StatusBadRequest},
+		{"provider error", `{"model": "my-agent", "user": "alice", "messages": [{"role": "user", "content": "Hi"}]}`, auth, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		resp := post(t, srv, tt.body, tt.header)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.status, resp.StatusCode)
+		}
+		var body struct {
+			Error struct{ Message string } `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error.Message == "" {
+			t.Errorf("%s: expected an error body, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestChatCompletions_StreamOverBudget(t *testing.T) {
+	h := igenttest.NewWithConfig(t, func(cfg *igenttest.Config) { cfg.Budget.ConversationTokens = 100 })
+	srv := httptest.NewServer(New(h.Agent, config.ServerConfig{}).Handler())
+	t.Cleanup(srv.Close)
+	store, err := storage.NewJSONStore(h.WorkDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUsage([]string{"conversation:webui"}, time.Now(), 150, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The budget is checked before the stream starts, so the client gets
+	// the status rather than an error event
+	header := http.Header{ConversationHeader: {"webui"}}
+	resp := post(t, srv, `{"stream": true, "messages": [{"role": "user", "content": "Hi"}]}`, header)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("expected a 429 JSON error, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestModels(t *testing.T) {
+	srv, _ := newTestServer(t, config.ServerConfig{})
+	resp, err := http.Get(srv.URL + "/v1/models")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Data []Model `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "igent" {
+		t.Errorf("unexpected models %+v", list.Data)
+	}
+}
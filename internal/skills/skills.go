@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -11,6 +12,21 @@ import (
 	"github.com/igm/igent/internal/storage"
 )
 
+// TriggerPrefix starts the parameters holding a skill's trigger patterns,
+// regular expressions that activate the skill when the input matches
+const TriggerPrefix = "trigger_"
+
+// validID matches skill IDs, which name the skill's file
+var validID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// ValidateID checks that a skill ID can be stored
+func ValidateID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid skill id %q: use letters, digits, '.', '_' and '-'", id)
+	}
+	return nil
+}
+
 // Registry manages available skills
 type Registry struct {
 	store  *storage.JSONStore
@@ -69,8 +85,49 @@ func (r *Registry) List() []*storage.Skill {
 	return result
 }
 
+// All returns every stored skill, disabled ones included, sorted by ID
+func (r *Registry) All() ([]*storage.Skill, error) {
+	skills, err := r.store.LoadSkills()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(skills, func(a, b *storage.Skill) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return skills, nil
+}
+
+// Find returns a stored skill, enabled or not
+func (r *Registry) Find(id string) (*storage.Skill, error) {
+	skills, err := r.store.LoadSkills()
+	if err != nil {
+		return nil, err
+	}
+	for _, skill := range skills {
+		if skill.ID == id {
+			return skill, nil
+		}
+	}
+	return nil, fmt.Errorf("no skill %q", id)
+}
+
+// SetEnabled enables or disables a stored skill; a disabled skill is kept
+// but never matched
+func (r *Registry) SetEnabled(id string, enabled bool) (*storage.Skill, error) {
+	skill, err := r.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	skill.Enabled = enabled
+	return skill, r.Register(skill)
+}
+
 // Register adds or updates a skill
 func (r *Registry) Register(skill *storage.Skill) error {
+	if err := ValidateID(skill.ID); err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -78,13 +135,21 @@ func (r *Registry) Register(skill *storage.Skill) error {
 		return err
 	}
 
-	r.skills[skill.ID] = skill
+	if skill.Enabled {
+		r.skills[skill.ID] = skill
+	} else {
+		delete(r.skills, skill.ID)
+	}
 	r.log.Info("skill registered", "id", skill.ID, "name", skill.Name, "enabled", skill.Enabled)
 	return nil
 }
 
 // Unregister removes a skill
 func (r *Registry) Unregister(id string) error {
+	if _, err := r.Find(id); err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -101,8 +166,9 @@ func (r *Registry) Unregister(id string) error {
 	return nil
 }
 
-// Match finds skills that match the input
-func (r *Registry) Match(input string) []*storage.Skill {
+// Match finds skills that match the input, among the skills with the IDs
+// in only if any are given
+func (r *Registry) Match(input string, only ...string) []*storage.Skill {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -110,7 +176,7 @@ func (r *Registry) Match(input string) []*storage.Skill {
 	var matches []*storage.Skill
 
 	for _, skill := range r.skills {
-		if !skill.Enabled {
+		if !skill.Enabled || (len(only) > 0 && !slices.Contains(only, skill.ID)) {
 			continue
 		}
 
@@ -122,13 +188,14 @@ func (r *Registry) Match(input string) []*storage.Skill {
 		}
 
 		// Check trigger patterns
-		for key := range skill.Parameters {
-			if pattern, ok := skill.Parameters["trigger_"+key]; ok {
-				if matched, _ := regexp.MatchString(pattern, input); matched {
-					matches = append(matches, skill)
-					r.log.Debug("skill matched by pattern", "id", skill.ID, "pattern_key", key)
-					break
-				}
+		for key, pattern := range skill.Parameters {
+			if !strings.HasPrefix(key, TriggerPrefix) {
+				continue
+			}
+			if matched, _ := regexp.MatchString(pattern, input); matched {
+				matches = append(matches, skill)
+				r.log.Debug("skill matched by pattern", "id", skill.ID, "pattern_key", key)
+				break
 			}
 		}
 	}
@@ -140,9 +207,10 @@ func (r *Registry) Match(input string) []*storage.Skill {
 	return matches
 }
 
-// EnhancePrompt adds skill context to a prompt
-func (r *Registry) EnhancePrompt(input string, basePrompt string) string {
-	matches := r.Match(input)
+// EnhancePrompt adds skill context to a prompt, from the skills with the
+// IDs in only if any are given
+func (r *Registry) EnhancePrompt(input string, basePrompt string, only ...string) string {
+	matches := r.Match(input, only...)
 	if len(matches) == 0 {
 		return basePrompt
 	}
@@ -190,9 +258,12 @@ func DefaultSkills() []*storage.Skill {
 	}
 }
 
-// InitializeDefaults adds default skills if none exist
+// InitializeDefaults adds default skills if none exist, enabled or not
 func (r *Registry) InitializeDefaults() error {
-	existing := r.List()
+	existing, err := r.store.LoadSkills()
+	if err != nil {
+		return err
+	}
 	if len(existing) > 0 {
 		r.log.Debug("skills already exist, skipping defaults initialization")
 		return nil
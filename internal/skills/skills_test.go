@@ -2,6 +2,7 @@ package skills
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/igm/igent/internal/storage"
@@ -163,4 +164,75 @@ func TestEnhancePrompt(t *testing.T) {
 	if enhanced == "" {
 		t.Error("enhanced prompt should not be empty")
 	}
+
+	// Limited to other skills, the Code Assistant is not used
+	if got := registry.EnhancePrompt("help me with Code Assistant", basePrompt, "summarize"); got != basePrompt {
+		t.Errorf("expected the base prompt with only the summarize skill, got %q", got)
+	}
+	if got := registry.EnhancePrompt("help me with Code Assistant", basePrompt, "code"); !strings.Contains(got, "Additional context from skills") {
+		t.Errorf("expected the code skill used, got %q", got)
+	}
+}
+
+func TestSetEnabled(t *testing.T) {
+	store, err := storage.NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	registry, err := NewRegistry(store)
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	if err := registry.Register(&storage.Skill{ID: "../evil", Prompt: "x", Enabled: true}); err == nil {
+		t.Error("expected an error for an invalid ID")
+	}
+	skill := &storage.Skill{
+		ID:         "review",
+		Name:       "Reviewer",
+		Prompt:     "Look for bugs first.",
+		Parameters: map[string]string{TriggerPrefix + "1": `(?i)\bPR\b`},
+		Enabled:    true,
+	}
+	if err := registry.Register(skill); err != nil {
+		t.Fatalf("failed to register skill: %v", err)
+	}
+	if matches := registry.Match("please check this pr"); len(matches) != 1 {
+		t.Errorf("expected the trigger to match, got %d matches", len(matches))
+	}
+
+	if _, err := registry.SetEnabled("review", false); err != nil {
+		t.Fatalf("SetEnabled failed: %v", err)
+	}
+	if matches := registry.Match("please check this pr"); len(matches) != 0 {
+		t.Error("expected a disabled skill not to match")
+	}
+
+	// Disabled skills stay stored, and defaults are not added back
+	reopened, err := NewRegistry(store)
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	if err := reopened.InitializeDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	all, err := reopened.All()
+	if err != nil || len(all) != 1 || all[0].Enabled {
+		t.Fatalf("expected the disabled skill stored, got %+v %v", all, err)
+	}
+	if _, ok := reopened.Get("review"); ok {
+		t.Error("expected a disabled skill not loaded")
+	}
+	if found, err := reopened.Find("review"); err != nil || found.Prompt != skill.Prompt {
+		t.Errorf("expected to find the disabled skill, got %+v %v", found, err)
+	}
+
+	if _, err := reopened.SetEnabled("review", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get("review"); !ok {
+		t.Error("expected the skill enabled")
+	}
+	if err := reopened.Unregister("missing"); err == nil {
+		t.Error("expected an error removing an unknown skill")
+	}
 }
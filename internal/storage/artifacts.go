@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minArtifactRef is the shortest hash prefix accepted as an artifact reference
+const minArtifactRef = 4
+
+// Artifact describes a generated file stored by content hash
+type Artifact struct {
+	Hash           string    `json:"hash"` // SHA-256 of the content
+	Name           string    `json:"name"`
+	Language       string    `json:"language,omitempty"` // Code block language or file type
+	Size           int       `json:"size"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	Turn           int       `json:"turn,omitempty"` // 1-based user turn that produced it
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ShortHash returns the abbreviated hash used for display
+func (a *Artifact) ShortHash() string {
+	if len(a.Hash) > 12 {
+		return a.Hash[:12]
+	}
+	return a.Hash
+}
+
+// SaveArtifact stores content under its hash and records its metadata.
+// Saving identical content again returns the existing artifact.
+func (s *JSONStore) SaveArtifact(meta *Artifact, content []byte) (*Artifact, error) {
+	defer s.lock()()
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	dir := filepath.Join(s.baseDir, "artifacts")
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, fmt.Errorf("creating artifacts directory: %w", err)
+	}
+
+	metaPath := filepath.Join(dir, hash+".json")
+	if data, err := os.ReadFile(metaPath); err == nil {
+		var existing Artifact
+		if err := json.Unmarshal(data, &existing); err == nil {
+			s.log.Debug("artifact already stored", "hash", existing.ShortHash(), "name", existing.Name)
+			return &existing, nil
+		}
+	}
+
+	artifact := *meta
+	artifact.Hash = hash
+	artifact.Size = len(content)
+	if artifact.CreatedAt.IsZero() {
+		artifact.CreatedAt = time.Now()
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "objects", hash), content, 0644); err != nil {
+		return nil, fmt.Errorf("writing artifact: %w", err)
+	}
+
+	data, err := json.MarshalIndent(&artifact, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling artifact: %w", err)
+	}
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("artifact saved", "hash", artifact.ShortHash(), "name", artifact.Name, "size", artifact.Size)
+	return &artifact, nil
+}
+
+// ListArtifacts returns all artifacts, oldest first
+func (s *JSONStore) ListArtifacts() ([]*Artifact, error) {
+	defer s.rlock()()
+
+	return s.listArtifacts()
+}
+
+func (s *JSONStore) listArtifacts() ([]*Artifact, error) {
+	dir := filepath.Join(s.baseDir, "artifacts")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var artifacts []*Artifact
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			s.log.Warn("failed to read artifact", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		var a Artifact
+		if err := json.Unmarshal(data, &a); err != nil {
+			s.log.Warn("failed to parse artifact", "file", entry.Name(), "error", err)
+			continue
+		}
+		artifacts = append(artifacts, &a)
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].CreatedAt.Before(artifacts[j].CreatedAt)
+	})
+	return artifacts, nil
+}
+
+// FindArtifact resolves a hash prefix or a name (latest wins) to an artifact
+func (s *JSONStore) FindArtifact(ref string) (*Artifact, error) {
+	defer s.rlock()()
+
+	artifacts, err := s.listArtifacts()
+	if err != nil {
+		return nil, err
+	}
+
+	var byHash, byName *Artifact
+	for _, a := range artifacts {
+		if len(ref) >= minArtifactRef && strings.HasPrefix(a.Hash, ref) {
+			if byHash != nil && byHash.Hash != a.Hash {
+				return nil, fmt.Errorf("ambiguous artifact reference: %s", ref)
+			}
+			byHash = a
+		}
+		if a.Name == ref {
+			byName = a
+		}
+	}
+
+	if byHash != nil {
+		return byHash, nil
+	}
+	if byName != nil {
+		return byName, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ReadArtifact returns the content of an artifact
+func (s *JSONStore) ReadArtifact(a *Artifact) ([]byte, error) {
+	defer s.rlock()()
+
+	data, err := os.ReadFile(filepath.Join(s.baseDir, "artifacts", "objects", a.Hash))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading artifact: %w", err)
+	}
+	return data, nil
+}
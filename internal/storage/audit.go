@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// GuardrailEvent records a guardrail rule that was triggered. The matched
+// text is not kept, as it may be what the rule keeps out.
+type GuardrailEvent struct {
+	Time         time.Time `json:"time"`
+	Conversation string    `json:"conversation"`
+	Stage        string    `json:"stage"` // input, tool_call or output
+	Rule         string    `json:"rule"`
+	Action       string    `json:"action"`
+	Detail       string    `json:"detail,omitempty"` // Moderation reason or output size
+}
+
+// guardrailAuditPath is the append-only audit of triggered guardrails
+func (s *JSONStore) guardrailAuditPath() string {
+	return filepath.Join(s.baseDir, "audit", "guardrails.jsonl")
+}
+
+// AppendGuardrailEvents adds events to the guardrail audit
+func (s *JSONStore) AppendGuardrailEvents(events []GuardrailEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	defer s.lock()()
+
+	if err := os.MkdirAll(filepath.Dir(s.guardrailAuditPath()), 0755); err != nil {
+		return fmt.Errorf("creating audit directory: %w", err)
+	}
+	f, err := os.OpenFile(s.guardrailAuditPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("writing guardrail audit: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// LoadGuardrailEvents returns the guardrail audit, oldest first
+func (s *JSONStore) LoadGuardrailEvents() ([]GuardrailEvent, error) {
+	defer s.rlock()()
+
+	f, err := os.Open(s.guardrailAuditPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []GuardrailEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e GuardrailEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // Skip a line cut off by a crash
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
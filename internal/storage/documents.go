@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Document is the working document attached to a conversation
+type Document struct {
+	ConversationID string    `json:"conversation_id"`
+	Title          string    `json:"title,omitempty"`
+	Content        string    `json:"content"`
+	Previous       string    `json:"previous,omitempty"` // Content before the last edit, for diffs
+	Version        int       `json:"version"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SaveDocument stores a conversation's working document
+func (s *JSONStore) SaveDocument(doc *Document) error {
+	defer s.lock()()
+
+	dir := filepath.Join(s.baseDir, "documents")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating documents directory: %w", err)
+	}
+
+	doc.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling document: %w", err)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(doc.ConversationID)+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating documents directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	s.log.Debug("document saved", "conversation", doc.ConversationID, "version", doc.Version, "length", len(doc.Content))
+	return nil
+}
+
+// LoadDocument loads a conversation's working document
+func (s *JSONStore) LoadDocument(conversationID string) (*Document, error) {
+	defer s.rlock()()
+
+	data, err := os.ReadFile(filepath.Join(s.baseDir, "documents", filepath.FromSlash(conversationID)+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading document: %w", err)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshaling document: %w", err)
+	}
+	return &doc, nil
+}
+
+// DeleteDocument removes a conversation's working document
+func (s *JSONStore) DeleteDocument(conversationID string) error {
+	defer s.lock()()
+
+	err := os.Remove(filepath.Join(s.baseDir, "documents", filepath.FromSlash(conversationID)+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
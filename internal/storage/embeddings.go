@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ConversationEmbedding caches the embedding of a conversation's profile
+// text; Hash identifies the text and model it was computed from
+type ConversationEmbedding struct {
+	Hash   string    `json:"hash"`
+	Vector []float64 `json:"vector"`
+}
+
+// SaveEmbeddings stores the conversation embedding cache, keyed by
+// conversation ID
+func (s *JSONStore) SaveEmbeddings(embeddings map[string]*ConversationEmbedding) error {
+	defer s.lock()()
+
+	data, err := json.Marshal(embeddings)
+	if err != nil {
+		return fmt.Errorf("marshaling embeddings: %w", err)
+	}
+
+	path := filepath.Join(s.baseDir, "embeddings.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadEmbeddings loads the conversation embedding cache; a missing cache is
+// empty
+func (s *JSONStore) LoadEmbeddings() (map[string]*ConversationEmbedding, error) {
+	defer s.rlock()()
+
+	embeddings := make(map[string]*ConversationEmbedding)
+	data, err := os.ReadFile(filepath.Join(s.baseDir, "embeddings.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return embeddings, nil
+		}
+		return nil, fmt.Errorf("reading embeddings: %w", err)
+	}
+	if err := json.Unmarshal(data, &embeddings); err != nil {
+		return nil, fmt.Errorf("unmarshaling embeddings: %w", err)
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entity is a node of the entity memory: a person, project, system or
+// other thing mentioned in conversations, with attributes and relations to
+// other entities
+type Entity struct {
+	Name          string            `json:"name"`
+	Type          string            `json:"type,omitempty"`    // e.g. person, project, system
+	Aliases       []string          `json:"aliases,omitempty"` // Other names it is mentioned by
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	Relations     []Relation        `json:"relations,omitempty"`
+	Conversations []string          `json:"conversations,omitempty"` // Conversations it was recorded in
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// Relation is a directed edge to another entity, e.g. "works_on" a project
+type Relation struct {
+	Type   string `json:"type"`
+	Target string `json:"target"` // Name of the target entity
+}
+
+// EntityKey identifies an entity by name, ignoring case and spacing
+func EntityKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Names returns the entity's name followed by its aliases
+func (e *Entity) Names() []string {
+	return append([]string{e.Name}, e.Aliases...)
+}
+
+// Describe renders the entity on one line with its type, aliases,
+// attributes and relations
+func (e *Entity) Describe() string {
+	var sb strings.Builder
+	sb.WriteString(e.Name)
+	var meta []string
+	if e.Type != "" {
+		meta = append(meta, e.Type)
+	}
+	if len(e.Aliases) > 0 {
+		meta = append(meta, "aka "+strings.Join(e.Aliases, ", "))
+	}
+	if len(meta) > 0 {
+		fmt.Fprintf(&sb, " (%s)", strings.Join(meta, "; "))
+	}
+
+	keys := make([]string, 0, len(e.Attributes))
+	for k := range e.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+e.Attributes[k])
+	}
+	for _, r := range e.Relations {
+		parts = append(parts, r.Type+" "+r.Target)
+	}
+	if len(parts) > 0 {
+		sb.WriteString(": " + strings.Join(parts, "; "))
+	}
+	return sb.String()
+}
+
+// Relate adds a relation unless the entity already has it
+func (e *Entity) Relate(relType, target string) bool {
+	for _, r := range e.Relations {
+		if strings.EqualFold(r.Type, relType) && EntityKey(r.Target) == EntityKey(target) {
+			return false
+		}
+	}
+	e.Relations = append(e.Relations, Relation{Type: relType, Target: target})
+	return true
+}
+
+// Unrelate removes the relations to target, of relType or of any type when
+// relType is empty, and reports how many were removed
+func (e *Entity) Unrelate(relType, target string) int {
+	n := len(e.Relations)
+	e.Relations = slices.DeleteFunc(e.Relations, func(r Relation) bool {
+		return EntityKey(r.Target) == EntityKey(target) && (relType == "" || strings.EqualFold(r.Type, relType))
+	})
+	return n - len(e.Relations)
+}
+
+// MentionedIn records a conversation the entity was recorded in
+func (e *Entity) MentionedIn(conversationID string) {
+	if conversationID != "" && !slices.Contains(e.Conversations, conversationID) {
+		e.Conversations = append(e.Conversations, conversationID)
+	}
+}
+
+// entityPath returns the file of an entity. Keys are hex encoded so any
+// name is a safe file name.
+func (s *JSONStore) entityPath(name string) string {
+	return filepath.Join(s.baseDir, "entities", fmt.Sprintf("%x.json", EntityKey(name)))
+}
+
+// SaveEntity stores an entity, replacing the one with the same name
+func (s *JSONStore) SaveEntity(entity *Entity) error {
+	defer s.lock()()
+
+	dir := filepath.Join(s.baseDir, "entities")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating entities directory: %w", err)
+	}
+
+	entity.UpdatedAt = time.Now()
+	if entity.CreatedAt.IsZero() {
+		entity.CreatedAt = entity.UpdatedAt
+	}
+
+	data, err := json.MarshalIndent(entity, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling entity: %w", err)
+	}
+	if err := os.WriteFile(s.entityPath(entity.Name), data, 0644); err != nil {
+		return err
+	}
+
+	s.log.Debug("entity saved", "name", entity.Name, "type", entity.Type)
+	return nil
+}
+
+// LoadEntity loads an entity by name
+func (s *JSONStore) LoadEntity(name string) (*Entity, error) {
+	defer s.rlock()()
+
+	data, err := os.ReadFile(s.entityPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading entity: %w", err)
+	}
+
+	var entity Entity
+	if err := json.Unmarshal(data, &entity); err != nil {
+		return nil, fmt.Errorf("unmarshaling entity: %w", err)
+	}
+	return &entity, nil
+}
+
+// ListEntities returns all entities sorted by name
+func (s *JSONStore) ListEntities() ([]*Entity, error) {
+	defer s.rlock()()
+
+	dir := filepath.Join(s.baseDir, "entities")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entities []*Entity
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			s.log.Warn("failed to read entity", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		var entity Entity
+		if err := json.Unmarshal(data, &entity); err != nil {
+			s.log.Warn("failed to parse entity", "file", entry.Name(), "error", err)
+			continue
+		}
+		entities = append(entities, &entity)
+	}
+
+	sort.Slice(entities, func(i, j int) bool {
+		return EntityKey(entities[i].Name) < EntityKey(entities[j].Name)
+	})
+	return entities, nil
+}
+
+// DeleteEntity removes an entity. Relations of other entities pointing to
+// it are left to the caller.
+func (s *JSONStore) DeleteEntity(name string) error {
+	defer s.lock()()
+
+	err := os.Remove(s.entityPath(name))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// IntegrityEvent records that a conversation file was found modified
+// outside igent, or could not be verified. Events are kept in the
+// conversation, so the audit trail survives the chain being rebuilt on the
+// next save.
+type IntegrityEvent struct {
+	DetectedAt time.Time `json:"detected_at"`
+	Message    int       `json:"message"`              // Index of the first message that failed verification
+	Unverified string    `json:"unverified,omitempty"` // Why no message could be verified, such as a missing chain
+}
+
+// messageChain returns the rolling hash chain over messages: entry i hashes
+// entry i-1 with message i, starting from the conversation ID, so editing,
+// inserting, removing or reordering messages breaks every later entry.
+// With a key the entries are HMACs, which only holders of the key can
+// recompute; without one, anyone who edits the file can rebuild the chain.
+func messageChain(key []byte, id string, messages []llm.Message) []string {
+	chain := make([]string, len(messages))
+	prev := sha256.Sum256([]byte("igent-conversation\x00" + id))
+	for i, m := range messages {
+		data, _ := json.Marshal(m) // Messages always marshal
+		h := sha256.New()
+		if len(key) > 0 {
+			h = hmac.New(sha256.New, key)
+		}
+		h.Write(prev[:])
+		h.Write(data)
+		copy(prev[:], h.Sum(nil))
+		chain[i] = hex.EncodeToString(prev[:])
+	}
+	return chain
+}
+
+// firstTampered returns the index of the first message that does not match
+// the stored chain, or -1 when the conversation verifies. A conversation
+// whose messages cannot be verified, as it has no chain or one keyed
+// differently than the store, returns -1 with the reason.
+func firstTampered(key []byte, conv *Conversation) (int, string) {
+	switch {
+	case len(conv.Messages) == 0 && conv.Chain == nil:
+		return -1, ""
+	case conv.Chain == nil:
+		return -1, "no hash chain"
+	case conv.ChainKeyed && len(key) == 0:
+		return -1, "the chain is keyed, but storage.integrity_key is not set"
+	case !conv.ChainKeyed && len(key) > 0:
+		return -1, "the chain is not keyed"
+	}
+	chain := messageChain(key, conv.ID, conv.Messages)
+	for i := range chain {
+		if i >= len(conv.Chain) || !hmac.Equal([]byte(chain[i]), []byte(conv.Chain[i])) {
+			return i, ""
+		}
+	}
+	if len(conv.Chain) != len(chain) {
+		return len(chain), "" // Messages removed from the end
+	}
+	return -1, ""
+}
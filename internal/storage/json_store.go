@@ -3,9 +3,12 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -19,6 +22,8 @@ type JSONStore struct {
 	baseDir string
 	mu      sync.RWMutex
 	log     *slog.Logger
+
+	integrityKey []byte // HMAC key of conversation chains, if set
 }
 
 // NewJSONStore creates a new JSON-based storage
@@ -53,6 +58,113 @@ type Conversation struct {
 	UpdatedAt time.Time     `json:"updated_at"`
 	Messages  []llm.Message `json:"messages"`
 	Summary   string        `json:"summary,omitempty"`
+
+	// Title is a short description, generated from the first exchange
+	// unless set by the user; Tags are labels to find it by
+	Title string   `json:"title,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+
+	// SystemPrompt replaces agent.system_prompt in this conversation, if set
+	SystemPrompt string `json:"system_prompt,omitempty"`
+
+	// Persona is the persona switched to with /persona, if any
+	Persona string `json:"persona,omitempty"`
+
+	// LongTermSummary abstracts the conversation before Summary, which
+	// only covers the most recently summarized messages in detail
+	LongTermSummary string `json:"long_term_summary,omitempty"`
+
+	// Partial is the last answer, cut off mid-stream, if it was not
+	// continued or replaced by a new turn yet
+	Partial *PartialResponse `json:"partial,omitempty"`
+
+	// Chain is the rolling hash chain over Messages, one entry per message,
+	// verified on load to detect edits made outside igent; ChainKeyed marks
+	// a chain of HMACs under storage.integrity_key
+	Chain      []string `json:"chain,omitempty"`
+	ChainKeyed bool     `json:"chain_keyed,omitempty"`
+
+	// Tampered lists the times the file was found modified outside igent
+	Tampered []IntegrityEvent `json:"tampered,omitempty"`
+
+	// ToolCalls record the tool calls made while answering, for exports.
+	// Messages hold the full sequence as well: the assistant messages
+	// requesting tool calls and the tool results, so a resumed conversation
+	// keeps what the agent did; Transcript filters them for display.
+	ToolCalls []ToolRecord `json:"tool_calls,omitempty"`
+}
+
+// Transcript returns the messages shown to a person: the user messages and
+// the assistant answers, without tool results and assistant messages that
+// only request tool calls
+func Transcript(messages []llm.Message) []llm.Message {
+	var shown []llm.Message
+	for _, m := range messages {
+		switch {
+		case m.Role == "user":
+			shown = append(shown, m)
+		case m.Role == "assistant" && (m.Content != "" || len(m.ToolCalls) == 0):
+			shown = append(shown, m)
+		}
+	}
+	return shown
+}
+
+// ToolRecord is one tool call made while answering a turn
+type ToolRecord struct {
+	Message int    `json:"message"` // Index of the assistant message that made the call
+	Name    string `json:"name"`
+	Args    string `json:"args"`   // JSON
+	Output  string `json:"output"` // Cut at ToolRecordMaxOutput bytes
+	Error   bool   `json:"error,omitempty"`
+}
+
+// ToolRecordMaxOutput caps the tool output kept in a ToolRecord and in the
+// tool result messages of a conversation
+const ToolRecordMaxOutput = 4000
+
+// Clone returns a copy of the conversation that can be changed, or read
+// while the original changes, without affecting the other
+func (c *Conversation) Clone() *Conversation {
+	clone := *c
+	clone.Messages = slices.Clone(c.Messages)
+	clone.Tags = slices.Clone(c.Tags)
+	clone.Chain = slices.Clone(c.Chain)
+	clone.Tampered = slices.Clone(c.Tampered)
+	clone.ToolCalls = slices.Clone(c.ToolCalls)
+	if c.Partial != nil {
+		partial := *c.Partial
+		clone.Partial = &partial
+	}
+	return &clone
+}
+
+// DropMessages removes the first n messages and the tool records of their
+// calls, shifting the remaining records
+func (c *Conversation) DropMessages(n int) {
+	if n <= 0 {
+		return
+	}
+	if n > len(c.Messages) {
+		n = len(c.Messages)
+	}
+	c.Messages = c.Messages[n:]
+	kept := c.ToolCalls[:0]
+	for _, r := range c.ToolCalls {
+		if r.Message >= n {
+			r.Message -= n
+			kept = append(kept, r)
+		}
+	}
+	c.ToolCalls = kept
+}
+
+// PartialResponse is an answer interrupted mid-stream together with the
+// input that prompted it
+type PartialResponse struct {
+	Input     string    `json:"input"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // MemoryItem represents a stored memory
@@ -61,7 +173,64 @@ type MemoryItem struct {
 	Content   string    `json:"content"`
 	Type      string    `json:"type"` // fact, preference, context
 	CreatedAt time.Time `json:"created_at"`
-	Relevance float64   `json:"relevance"` // 0-1 relevance score
+	Relevance float64   `json:"relevance"`       // 0-1 relevance score
+	Scope     string    `json:"scope,omitempty"` // Conversation the memory belongs to; empty = global
+	Tags      []string  `json:"tags,omitempty"`  // Lowercase labels for filtering, e.g. project-x
+
+	// Embedding of Content for semantic retrieval; EmbeddingHash identifies
+	// the content and model it was computed from, so edits make it stale
+	Embedding     []float64 `json:"embedding,omitempty"`
+	EmbeddingHash string    `json:"embedding_hash,omitempty"`
+}
+
+// VisibleIn reports whether the memory applies to a conversation: global
+// memories apply to all of them
+func (m *MemoryItem) VisibleIn(conversationID string) bool {
+	return m.Scope == "" || m.Scope == conversationID
+}
+
+// HasTags reports whether the memory carries all of tags
+func (m *MemoryItem) HasTags(tags []string) bool {
+	for _, want := range tags {
+		if !slices.Contains(m.Tags, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// MemoryFilter selects memories; zero fields match everything
+type MemoryFilter struct {
+	Type      string   // Only memories of this type
+	Tags      []string // Only memories with all of these tags
+	VisibleIn string   // Only global memories and those of this conversation
+	Query     string   // Only memories containing this text, ignoring case
+}
+
+// Match reports whether a memory passes the filter
+func (f MemoryFilter) Match(m *MemoryItem) bool {
+	if f.Type != "" && m.Type != f.Type {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(m.Content), strings.ToLower(f.Query)) {
+		return false
+	}
+	if f.VisibleIn != "" && !m.VisibleIn(f.VisibleIn) {
+		return false
+	}
+	return m.HasTags(NormalizeTags(f.Tags))
+}
+
+// NormalizeTags lowercases and trims tags, dropping empty and duplicate ones
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
 }
 
 // Skill represents an agent skill
@@ -74,14 +243,29 @@ type Skill struct {
 	Enabled     bool              `json:"enabled"`
 }
 
+// SetIntegrityKey makes conversation chains HMACs under key, so they can't
+// be rebuilt by whoever edits a file without knowing the key. Chains saved
+// with another key, or without one, no longer verify.
+func (s *JSONStore) SetIntegrityKey(key string) {
+	s.integrityKey = []byte(key)
+}
+
 // SaveConversation saves a conversation to storage
 func (s *JSONStore) SaveConversation(conv *Conversation) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
+	if err := ValidateConversationID(conv.ID); err != nil {
+		return err
+	}
 	conv.UpdatedAt = time.Now()
+	conv.Chain = messageChain(s.integrityKey, conv.ID, conv.Messages)
+	conv.ChainKeyed = len(s.integrityKey) > 0
 
-	path := filepath.Join(s.baseDir, "messages", conv.ID+".json")
+	// Namespaced IDs such as project/default live in subdirectories
+	path := filepath.Join(s.baseDir, "messages", filepath.FromSlash(conv.ID)+".json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating conversation directory: %w", err)
+	}
 	data, err := json.MarshalIndent(conv, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshaling conversation: %w", err)
@@ -95,12 +279,29 @@ func (s *JSONStore) SaveConversation(conv *Conversation) error {
 	return nil
 }
 
+// ValidateConversationID rejects IDs that would escape the messages
+// directory. IDs may contain slashes to namespace conversations, e.g.
+// myproject/default.
+func ValidateConversationID(id string) error {
+	if id == "" || strings.HasPrefix(id, "/") || strings.Contains(id, "\\") {
+		return fmt.Errorf("invalid conversation ID: %q", id)
+	}
+	for _, part := range strings.Split(id, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid conversation ID: %q", id)
+		}
+	}
+	return nil
+}
+
 // LoadConversation loads a conversation by ID
 func (s *JSONStore) LoadConversation(id string) (*Conversation, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
 
-	path := filepath.Join(s.baseDir, "messages", id+".json")
+	if err := ValidateConversationID(id); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.baseDir, "messages", filepath.FromSlash(id)+".json")
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -114,36 +315,184 @@ func (s *JSONStore) LoadConversation(id string) (*Conversation, error) {
 		return nil, fmt.Errorf("unmarshaling conversation: %w", err)
 	}
 
+	switch i, unverified := firstTampered(s.integrityKey, &conv); {
+	case i >= 0:
+		s.log.Warn("conversation was modified outside igent", "id", id, "first_modified_message", i)
+		conv.Tampered = append(conv.Tampered, IntegrityEvent{DetectedAt: time.Now(), Message: i})
+	case unverified != "":
+		s.log.Warn("conversation could not be verified", "id", id, "reason", unverified)
+		conv.Tampered = append(conv.Tampered, IntegrityEvent{DetectedAt: time.Now(), Unverified: unverified})
+	}
+
 	s.log.Debug("conversation loaded", "id", id, "message_count", len(conv.Messages))
 	return &conv, nil
 }
 
 // ListConversations returns all conversation IDs
 func (s *JSONStore) ListConversations() ([]string, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
 
 	dir := filepath.Join(s.baseDir, "messages")
-	entries, err := os.ReadDir(dir)
+	var ids []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, strings.TrimSuffix(filepath.ToSlash(rel), ".json"))
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return ids, nil
+}
 
-	var ids []string
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
-			ids = append(ids, entry.Name()[:len(entry.Name())-5])
+// ConversationInfo describes a conversation for listings
+type ConversationInfo struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Messages  int       `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationSort orders conversation listings
+type ConversationSort string
+
+const (
+	SortUpdated  ConversationSort = "updated"  // Most recently updated first
+	SortCreated  ConversationSort = "created"  // Most recently created first
+	SortID       ConversationSort = "id"       // Alphabetical
+	SortMessages ConversationSort = "messages" // Most messages first
+)
+
+// ParseConversationSort validates a sort order name; empty is SortUpdated
+func ParseConversationSort(s string) (ConversationSort, error) {
+	switch order := ConversationSort(strings.ToLower(s)); order {
+	case "":
+		return SortUpdated, nil
+	case SortUpdated, SortCreated, SortID, SortMessages:
+		return order, nil
+	}
+	return "", fmt.Errorf("unknown sort order %q (want updated, created, id or messages)", s)
+}
+
+// ConversationQuery selects a page of conversation listings
+type ConversationQuery struct {
+	Tags   []string         // Only conversations with all of these tags
+	Sort   ConversationSort // Default SortUpdated
+	Limit  int              // Page size; 0 = all
+	Offset int              // Conversations to skip
+}
+
+// HasTags reports whether the conversation has all of the given tags
+func (c *ConversationInfo) HasTags(tags ...string) bool {
+	for _, tag := range NormalizeTags(tags) {
+		if !slices.Contains(c.Tags, tag) {
+			return false
 		}
 	}
-	return ids, nil
+	return true
+}
+
+// ListConversationInfos returns the metadata of all conversations, most
+// recently updated first. Only the metadata is decoded, so integrity is not
+// verified.
+func (s *JSONStore) ListConversationInfos() ([]*ConversationInfo, error) {
+	ids, err := s.ListConversations()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.rlock()()
+
+	infos := make([]*ConversationInfo, 0, len(ids))
+	for _, id := range ids {
+		data, err := os.ReadFile(filepath.Join(s.baseDir, "messages", filepath.FromSlash(id)+".json"))
+		if err != nil {
+			s.log.Warn("failed to read conversation", "id", id, "error", err)
+			continue
+		}
+		var raw struct {
+			ConversationInfo
+			Messages []json.RawMessage `json:"messages"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			s.log.Warn("failed to parse conversation", "id", id, "error", err)
+			continue
+		}
+		info := raw.ConversationInfo
+		info.ID, info.Messages = id, len(raw.Messages)
+		infos = append(infos, &info)
+	}
+
+	sortConversationInfos(infos, SortUpdated)
+	return infos, nil
+}
+
+// QueryConversations returns a page of the conversation listings matching
+// q, and the number of conversations matching it in total
+func (s *JSONStore) QueryConversations(q ConversationQuery) ([]*ConversationInfo, int, error) {
+	infos, err := s.ListConversationInfos()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(q.Tags) > 0 {
+		infos = slices.DeleteFunc(infos, func(info *ConversationInfo) bool {
+			return !info.HasTags(q.Tags...)
+		})
+	}
+	sortConversationInfos(infos, q.Sort)
+
+	total := len(infos)
+	start := min(max(q.Offset, 0), total)
+	end := total
+	if q.Limit > 0 {
+		end = min(start+q.Limit, total)
+	}
+	return infos[start:end], total, nil
+}
+
+// sortConversationInfos sorts listings; ties are broken by ID so pages are
+// stable
+func sortConversationInfos(infos []*ConversationInfo, order ConversationSort) {
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		switch order {
+		case SortCreated:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+		case SortMessages:
+			if a.Messages != b.Messages {
+				return a.Messages > b.Messages
+			}
+		case SortID:
+		default:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.After(b.UpdatedAt)
+			}
+		}
+		return a.ID < b.ID
+	})
 }
 
 // DeleteConversation removes a conversation
 func (s *JSONStore) DeleteConversation(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
-	path := filepath.Join(s.baseDir, "messages", id+".json")
+	if err := ValidateConversationID(id); err != nil {
+		return err
+	}
+	path := filepath.Join(s.baseDir, "messages", filepath.FromSlash(id)+".json")
 	if err := os.Remove(path); err != nil {
 		return err
 	}
@@ -152,10 +501,36 @@ func (s *JSONStore) DeleteConversation(id string) error {
 	return nil
 }
 
+// ArchiveConversation moves a conversation out of the listings into
+// archive/messages, replacing an archived conversation with the same ID
+func (s *JSONStore) ArchiveConversation(id string) error {
+	defer s.lock()()
+
+	if err := ValidateConversationID(id); err != nil {
+		return err
+	}
+	path := filepath.Join(s.baseDir, "messages", filepath.FromSlash(id)+".json")
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	archived := filepath.Join(s.baseDir, "archive", "messages", filepath.FromSlash(id)+".json")
+	if err := os.MkdirAll(filepath.Dir(archived), 0755); err != nil {
+		return fmt.Errorf("creating archive directory: %w", err)
+	}
+	if err := os.Rename(path, archived); err != nil {
+		return fmt.Errorf("archiving conversation: %w", err)
+	}
+
+	s.log.Info("conversation archived", "id", id)
+	return nil
+}
+
 // SaveMemory stores a memory item
 func (s *JSONStore) SaveMemory(item *MemoryItem) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
 	path := filepath.Join(s.baseDir, "memory", item.ID+".json")
 	data, err := json.MarshalIndent(item, "", "  ")
@@ -173,8 +548,7 @@ func (s *JSONStore) SaveMemory(item *MemoryItem) error {
 
 // LoadMemories loads all memory items
 func (s *JSONStore) LoadMemories() ([]*MemoryItem, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
 
 	dir := filepath.Join(s.baseDir, "memory")
 	entries, err := os.ReadDir(dir)
@@ -205,10 +579,24 @@ func (s *JSONStore) LoadMemories() ([]*MemoryItem, error) {
 	return memories, nil
 }
 
+// QueryMemories loads the memory items that match filter
+func (s *JSONStore) QueryMemories(filter MemoryFilter) ([]*MemoryItem, error) {
+	memories, err := s.LoadMemories()
+	if err != nil {
+		return nil, err
+	}
+	matched := memories[:0]
+	for _, m := range memories {
+		if filter.Match(m) {
+			matched = append(matched, m)
+		}
+	}
+	return matched, nil
+}
+
 // DeleteMemory removes a memory item
 func (s *JSONStore) DeleteMemory(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
 	path := filepath.Join(s.baseDir, "memory", id+".json")
 	if err := os.Remove(path); err != nil {
@@ -221,8 +609,7 @@ func (s *JSONStore) DeleteMemory(id string) error {
 
 // UpdateMemory updates an existing memory item with the provided fields
 func (s *JSONStore) UpdateMemory(id string, updates map[string]interface{}) (*MemoryItem, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
 	path := filepath.Join(s.baseDir, "memory", id+".json")
 	data, err := os.ReadFile(path)
@@ -248,6 +635,9 @@ func (s *JSONStore) UpdateMemory(id string, updates map[string]interface{}) (*Me
 	if relevance, ok := updates["relevance"].(float64); ok {
 		item.Relevance = relevance
 	}
+	if tags, ok := updates["tags"].([]string); ok {
+		item.Tags = NormalizeTags(tags)
+	}
 
 	// Save updated item
 	updatedData, err := json.MarshalIndent(&item, "", "  ")
@@ -282,8 +672,7 @@ func (s *JSONStore) FindMemoryByContent(searchText string) (*MemoryItem, error)
 
 // SaveSkill stores a skill
 func (s *JSONStore) SaveSkill(skill *Skill) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
 	path := filepath.Join(s.baseDir, "skills", skill.ID+".json")
 	data, err := json.MarshalIndent(skill, "", "  ")
@@ -301,8 +690,7 @@ func (s *JSONStore) SaveSkill(skill *Skill) error {
 
 // LoadSkills loads all skills
 func (s *JSONStore) LoadSkills() ([]*Skill, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	defer s.rlock()()
 
 	dir := filepath.Join(s.baseDir, "skills")
 	entries, err := os.ReadDir(dir)
@@ -335,8 +723,7 @@ func (s *JSONStore) LoadSkills() ([]*Skill, error) {
 
 // DeleteSkill removes a skill
 func (s *JSONStore) DeleteSkill(id string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.lock()()
 
 	path := filepath.Join(s.baseDir, "skills", id+".json")
 	if err := os.Remove(path); err != nil {
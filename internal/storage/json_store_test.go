@@ -3,6 +3,10 @@ package storage
 import (
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -305,6 +309,61 @@ func TestUpdateMemory_NotFound(t *testing.T) {
 	}
 }
 
+func TestQueryMemories(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	for _, m := range []*MemoryItem{
+		{ID: "1", Content: "Tabs", Type: "preference", Tags: []string{"project-x", "style"}},
+		{ID: "2", Content: "Deploy on Fridays", Type: "fact", Tags: []string{"project-x"}},
+		{ID: "3", Content: "Spaces", Type: "preference", Tags: []string{"project-y"}, Scope: "conv-y"},
+		{ID: "4", Content: "Dark mode", Type: "preference"},
+	} {
+		if err := store.SaveMemory(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(filter MemoryFilter) string {
+		memories, err := store.QueryMemories(filter)
+		if err != nil {
+			t.Fatalf("QueryMemories(%+v) error = %v", filter, err)
+		}
+		var ids []string
+		for _, m := range memories {
+			ids = append(ids, m.ID)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	tests := []struct {
+		filter MemoryFilter
+		want   string
+	}{
+		{MemoryFilter{}, "1,2,3,4"},
+		{MemoryFilter{Type: "preference"}, "1,3,4"},
+		{MemoryFilter{Tags: []string{" Project-X "}}, "1,2"},
+		{MemoryFilter{Type: "preference", Tags: []string{"project-x"}}, "1"},
+		{MemoryFilter{Tags: []string{"project-x", "style"}}, "1"},
+		{MemoryFilter{Tags: []string{"project-z"}}, ""},
+		{MemoryFilter{VisibleIn: "conv-x", Type: "preference"}, "1,4"},
+		{MemoryFilter{VisibleIn: "conv-y", Type: "preference"}, "1,3,4"},
+		{MemoryFilter{Query: "FRIDAY"}, "2"},
+		{MemoryFilter{Query: "s", Type: "preference", VisibleIn: "conv-x"}, "1"},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.filter); got != tt.want {
+			t.Errorf("QueryMemories(%+v) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+
+	updated, err := store.UpdateMemory("4", map[string]interface{}{"tags": []string{"UI", "ui", ""}})
+	if err != nil || strings.Join(updated.Tags, ",") != "ui" {
+		t.Errorf("UpdateMemory(tags) = %+v, %v", updated, err)
+	}
+}
+
 func TestFindMemoryByContent(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "igent-test-*")
 	if err != nil {
@@ -402,3 +461,472 @@ func TestFindMemoryByContent_Empty(t *testing.T) {
 		t.Errorf("expected ErrNotFound for empty store, got %v", err)
 	}
 }
+
+func TestArtifacts(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	if artifacts, err := store.ListArtifacts(); err != nil || len(artifacts) != 0 {
+		t.Fatalf("expected no artifacts, got %v (%v)", artifacts, err)
+	}
+
+	a, err := store.SaveArtifact(&Artifact{Name: "main.go", Language: "go", ConversationID: "conv1", Turn: 2}, []byte("package main\n"))
+	if err != nil {
+		t.Fatalf("SaveArtifact() error = %v", err)
+	}
+	if len(a.Hash) != 64 || a.Size != 13 {
+		t.Errorf("unexpected artifact: %+v", a)
+	}
+
+	// Identical content is stored once
+	dup, err := store.SaveArtifact(&Artifact{Name: "copy.go"}, []byte("package main\n"))
+	if err != nil {
+		t.Fatalf("SaveArtifact() error = %v", err)
+	}
+	if dup.Name != "main.go" {
+		t.Errorf("expected existing artifact for duplicate content, got %s", dup.Name)
+	}
+
+	if _, err := store.SaveArtifact(&Artifact{Name: "notes.md"}, []byte("# Notes\n")); err != nil {
+		t.Fatalf("SaveArtifact() error = %v", err)
+	}
+
+	artifacts, err := store.ListArtifacts()
+	if err != nil || len(artifacts) != 2 {
+		t.Fatalf("expected 2 artifacts, got %d (%v)", len(artifacts), err)
+	}
+
+	for _, ref := range []string{a.Hash[:8], "main.go"} {
+		found, err := store.FindArtifact(ref)
+		if err != nil || found.Hash != a.Hash {
+			t.Errorf("FindArtifact(%q) = %v, %v", ref, found, err)
+		}
+	}
+	if _, err := store.FindArtifact("missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.FindArtifact(a.Hash[:2]); err != ErrNotFound {
+		t.Errorf("expected short prefixes to be rejected, got %v", err)
+	}
+
+	content, err := store.ReadArtifact(a)
+	if err != nil || string(content) != "package main\n" {
+		t.Errorf("ReadArtifact() = %q, %v", content, err)
+	}
+}
+
+func TestDocumentCRUD(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	if _, err := store.LoadDocument("conv1"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	doc := &Document{ConversationID: "conv1", Title: "Draft", Content: "# Draft\n", Version: 1}
+	if err := store.SaveDocument(doc); err != nil {
+		t.Fatalf("SaveDocument() error = %v", err)
+	}
+
+	loaded, err := store.LoadDocument("conv1")
+	if err != nil {
+		t.Fatalf("LoadDocument() error = %v", err)
+	}
+	if loaded.Content != doc.Content || loaded.Version != 1 || loaded.UpdatedAt.IsZero() {
+		t.Errorf("unexpected document: %+v", loaded)
+	}
+
+	if err := store.DeleteDocument("conv1"); err != nil {
+		t.Fatalf("DeleteDocument() error = %v", err)
+	}
+	if err := store.DeleteDocument("conv1"); err != nil {
+		t.Errorf("deleting a missing document should not fail: %v", err)
+	}
+}
+
+func TestRunJournal(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	if _, err := store.LoadRun("run-1"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	run := &Run{
+		ID:       "run-1",
+		Prompt:   "refactor",
+		Status:   RunInterrupted,
+		Steps:    []RunStep{{Iteration: 1, Tool: "ls", Summary: "main.go"}},
+		Messages: []llm.Message{{Role: "user", Content: "refactor"}},
+	}
+	if err := store.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+	if err := store.SaveRun(&Run{ID: "run-2", Status: RunCompleted}); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+
+	loaded, err := store.LoadRun("run-1")
+	if err != nil {
+		t.Fatalf("LoadRun() error = %v", err)
+	}
+	if len(loaded.Steps) != 1 || len(loaded.Messages) != 1 || !loaded.Resumable() || loaded.CreatedAt.IsZero() {
+		t.Errorf("unexpected run: %+v", loaded)
+	}
+
+	runs, err := store.ListRuns()
+	if err != nil {
+		t.Fatalf("ListRuns() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != "run-2" {
+		t.Fatalf("expected 2 runs, most recent first, got %+v", runs)
+	}
+	if runs[0].Resumable() {
+		t.Error("completed run should not be resumable")
+	}
+	if runs[1].Messages != nil {
+		t.Error("listing should not load run messages")
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	now := time.Now()
+	later := &Schedule{ID: "b", Cron: "@daily", Prompt: "summarize", NextRun: now.Add(time.Hour)}
+	sooner := &Schedule{ID: "a", Cron: "@hourly", Prompt: "check", NextRun: now.Add(time.Minute)}
+	for i := 0; i < maxScheduleResults+5; i++ {
+		later.AddResult(ScheduleResult{Response: strconv.Itoa(i)})
+	}
+	for _, s := range []*Schedule{later, sooner} {
+		if err := store.SaveSchedule(s); err != nil {
+			t.Fatalf("SaveSchedule() error = %v", err)
+		}
+	}
+
+	list, err := store.ListSchedules()
+	if err != nil || len(list) != 2 || list[0].ID != "a" {
+		t.Fatalf("expected 2 schedules, soonest first, got %+v (%v)", list, err)
+	}
+	loaded, err := store.LoadSchedule("b")
+	if err != nil {
+		t.Fatalf("LoadSchedule() error = %v", err)
+	}
+	if len(loaded.Results) != maxScheduleResults || loaded.LastResult().Response != strconv.Itoa(maxScheduleResults+4) {
+		t.Errorf("expected the last %d results, got %+v", maxScheduleResults, loaded.Results)
+	}
+	if sooner.LastResult() != nil {
+		t.Error("a schedule that never ran has no last result")
+	}
+
+	if err := store.DeleteSchedule("a"); err != nil {
+		t.Fatalf("DeleteSchedule() error = %v", err)
+	}
+	if err := store.DeleteSchedule("a"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.LoadSchedule("a"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	alice := &Entity{Name: "Alice", Type: "person", Attributes: map[string]string{"role": "lead"}}
+	if !alice.Relate("works_on", "Project Atlas") || alice.Relate("WORKS_ON", "project  atlas") {
+		t.Error("expected the second relation to be a duplicate")
+	}
+	alice.MentionedIn("c1")
+	alice.MentionedIn("c1")
+	for _, e := range []*Entity{alice, {Name: "Project Atlas/v2", Type: "project"}} {
+		if err := store.SaveEntity(e); err != nil {
+			t.Fatalf("SaveEntity() error = %v", err)
+		}
+	}
+
+	loaded, err := store.LoadEntity("  ALICE ")
+	if err != nil {
+		t.Fatalf("LoadEntity() error = %v", err)
+	}
+	if got := loaded.Describe(); got != "Alice (person): role=lead; works_on Project Atlas" {
+		t.Errorf("Describe() = %q", got)
+	}
+	if len(loaded.Conversations) != 1 {
+		t.Errorf("expected one conversation, got %v", loaded.Conversations)
+	}
+
+	list, err := store.ListEntities()
+	if err != nil || len(list) != 2 || list[0].Name != "Alice" {
+		t.Fatalf("expected 2 entities sorted by name, got %+v (%v)", list, err)
+	}
+
+	if n := loaded.Unrelate("", "project atlas"); n != 1 || len(loaded.Relations) != 0 {
+		t.Errorf("Unrelate() = %d, relations %v", n, loaded.Relations)
+	}
+	if err := store.DeleteEntity("project atlas/v2"); err != nil {
+		t.Fatalf("DeleteEntity() error = %v", err)
+	}
+	if _, err := store.LoadEntity("Project Atlas/v2"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestNamespacedConversations(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	for _, id := range []string{"default", "igent/default", "igent/refactor"} {
+		if err := store.SaveConversation(&Conversation{ID: id}); err != nil {
+			t.Fatalf("SaveConversation(%s) error = %v", id, err)
+		}
+	}
+	ids, err := store.ListConversations()
+	if err != nil {
+		t.Fatalf("ListConversations() error = %v", err)
+	}
+	sort.Strings(ids)
+	if strings.Join(ids, ",") != "default,igent/default,igent/refactor" {
+		t.Errorf("unexpected conversations %v", ids)
+	}
+	if conv, err := store.LoadConversation("igent/refactor"); err != nil || conv.ID != "igent/refactor" {
+		t.Errorf("LoadConversation() = %v, %v", conv, err)
+	}
+	if err := store.DeleteConversation("igent/refactor"); err != nil {
+		t.Errorf("DeleteConversation() error = %v", err)
+	}
+
+	for _, id := range []string{"../escape", "/abs", "a//b", "a/./b", `a\b`} {
+		if err := store.SaveConversation(&Conversation{ID: id}); err == nil {
+			t.Errorf("expected invalid ID %q to be rejected", id)
+		}
+	}
+}
+
+func TestConversationIntegrity(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conv := &Conversation{ID: "audit", Messages: []llm.Message{
+		{Role: "user", Content: "delete the temp files"},
+		{Role: "assistant", Content: "Deleted 3 files."},
+		{Role: "user", Content: "thanks"},
+	}}
+	if err := store.SaveConversation(conv); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.LoadConversation("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tampered) != 0 || len(loaded.Chain) != 3 {
+		t.Fatalf("fresh conversation: tampered %v, chain %d", loaded.Tampered, len(loaded.Chain))
+	}
+
+	// Edit the second message outside igent
+	path := filepath.Join(store.baseDir, "messages", "audit.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := strings.Replace(string(data), "Deleted 3 files.", "Deleted 0 files.", 1)
+	if err := os.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.LoadConversation("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tampered) != 1 || loaded.Tampered[0].Message != 1 {
+		t.Fatalf("edited conversation: tampered %+v", loaded.Tampered)
+	}
+
+	// Saving rebuilds the chain but keeps the record of the edit
+	if err := store.SaveConversation(loaded); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.LoadConversation("audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Tampered) != 1 {
+		t.Errorf("after save: tampered %+v", loaded.Tampered)
+	}
+
+	// Truncating the history is detected too
+	loaded.Chain = append(loaded.Chain, "extra")
+	if i, _ := firstTampered(nil, loaded); i != 3 {
+		t.Errorf("removed message detected at %d, want 3", i)
+	}
+
+	// A file without a chain, such as one whose chain was deleted, is
+	// reported as unverified
+	legacy := `{"id": "legacy", "messages": [{"role": "user", "content": "hi"}]}`
+	if err := os.WriteFile(filepath.Join(store.baseDir, "messages", "legacy.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.LoadConversation("legacy")
+	if err != nil || len(loaded.Tampered) != 1 || loaded.Tampered[0].Unverified != "no hash chain" {
+		t.Errorf("legacy conversation: %+v, %v", loaded, err)
+	}
+
+	// A keyed chain verifies with its key only, and an unkeyed chain, which
+	// anyone can rebuild, does not verify under a key
+	store.SetIntegrityKey("audit-key")
+	if err := store.SaveConversation(&Conversation{ID: "keyed", Messages: conv.Messages}); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = store.LoadConversation("keyed"); err != nil || !loaded.ChainKeyed || len(loaded.Tampered) != 0 {
+		t.Fatalf("keyed conversation: %+v, %v", loaded, err)
+	}
+	if i, _ := firstTampered([]byte("other-key"), loaded); i != 0 {
+		t.Errorf("chain verified under another key")
+	}
+	if loaded, err = store.LoadConversation("audit"); err != nil || len(loaded.Tampered) != 2 || loaded.Tampered[1].Unverified != "the chain is not keyed" {
+		t.Errorf("unkeyed chain under a key: %+v, %v", loaded, err)
+	}
+}
+
+func TestStoreLocking_SharedDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two stores on one directory stand in for two igent processes: their
+	// mutexes are separate, so only the lock file serializes their writes
+	stores := make([]*JSONStore, 2)
+	for i := range stores {
+		store, err := NewJSONStore(dir)
+		if err != nil {
+			t.Fatalf("NewJSONStore failed: %v", err)
+		}
+		stores[i] = store
+	}
+
+	at := time.Now()
+	var wg sync.WaitGroup
+	for _, store := range stores {
+		wg.Add(1)
+		go func(store *JSONStore) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := store.AddUsage([]string{"total"}, at, 1, 0); err != nil {
+					t.Errorf("AddUsage failed: %v", err)
+					return
+				}
+			}
+		}(store)
+	}
+	wg.Wait()
+
+	day, _, err := stores[0].LoadUsage("total", at)
+	if err != nil {
+		t.Fatalf("LoadUsage failed: %v", err)
+	}
+	if day.Tokens != 100 {
+		t.Errorf("expected 100 tokens recorded, got %d: concurrent writes were lost", day.Tokens)
+	}
+	if _, err := os.Stat(filepath.Join(dir, LockFileName)); err != nil {
+		t.Errorf("expected the lock file: %v", err)
+	}
+}
+
+func TestLoadUsageTotal(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewJSONStore failed: %v", err)
+	}
+	for _, at := range []time.Time{
+		time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 10, 2, 12, 0, 0, 0, time.UTC),
+	} {
+		if err := store.AddUsage([]string{"conversation:work", "user:alice"}, at, 100, 0.5); err != nil {
+			t.Fatalf("AddUsage failed: %v", err)
+		}
+	}
+	total, err := store.LoadUsageTotal("conversation:work")
+	if err != nil {
+		t.Fatalf("LoadUsageTotal failed: %v", err)
+	}
+	if total.Tokens != 300 || total.Cost != 1.5 {
+		t.Errorf("expected usage over both months, got %+v", total)
+	}
+	if total, _ := store.LoadUsageTotal("conversation:other"); total.Tokens != 0 {
+		t.Errorf("expected no usage of an unknown subject, got %+v", total)
+	}
+}
+
+func TestQueryConversations(t *testing.T) {
+	store, err := NewJSONStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"b", "a", "d", "c"} {
+		conv := &Conversation{ID: id, CreatedAt: base.Add(time.Duration(-i) * time.Minute)}
+		for j := 0; j < i; j++ {
+			conv.Messages = append(conv.Messages, llm.Message{Role: "user", Content: "x"})
+		}
+		if i%2 == 0 {
+			conv.Tags = []string{"work"}
+		}
+		if err := store.SaveConversation(conv); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond) // Distinct update times
+	}
+
+	ids := func(infos []*ConversationInfo) string {
+		var s []string
+		for _, info := range infos {
+			s = append(s, info.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	tests := []struct {
+		query ConversationQuery
+		want  string
+		total int
+	}{
+		{ConversationQuery{}, "c,d,a,b", 4},
+		{ConversationQuery{Sort: SortCreated}, "b,a,d,c", 4},
+		{ConversationQuery{Sort: SortID}, "a,b,c,d", 4},
+		{ConversationQuery{Sort: SortMessages}, "c,d,a,b", 4},
+		{ConversationQuery{Sort: SortID, Limit: 2}, "a,b", 4},
+		{ConversationQuery{Sort: SortID, Limit: 2, Offset: 3}, "d", 4},
+		{ConversationQuery{Offset: 10}, "", 4},
+		{ConversationQuery{Tags: []string{"work"}, Sort: SortID}, "b,d", 2},
+	}
+	for _, tt := range tests {
+		infos, total, err := store.QueryConversations(tt.query)
+		if err != nil {
+			t.Fatalf("QueryConversations(%+v) failed: %v", tt.query, err)
+		}
+		if got := ids(infos); got != tt.want || total != tt.total {
+			t.Errorf("QueryConversations(%+v) = %q of %d, want %q of %d", tt.query, got, total, tt.want, tt.total)
+		}
+	}
+
+	if _, err := ParseConversationSort("size"); err == nil {
+		t.Error("expected an error for an unknown sort order")
+	}
+	if order, err := ParseConversationSort(""); err != nil || order != SortUpdated {
+		t.Errorf("expected updated by default, got %q, %v", order, err)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// LockFileName is the advisory lock file in the storage directory that
+// serializes access by concurrent igent processes sharing it
+const LockFileName = ".lock"
+
+// LockDirectory takes the lock file of a storage directory, exclusive for
+// writing or shared for reading, for work on its files outside a store
+// such as backups. It blocks while another process holds a conflicting
+// lock. The returned function releases it.
+func LockDirectory(dir string, exclusive bool) (unlock func() error, err error) {
+	f, err := os.OpenFile(filepath.Join(dir, LockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return unlockFile(f)
+	}, nil
+}
+
+// lock takes the store for writing: the in-process mutex and an exclusive
+// lock on the lock file, so two igent invocations against the same work
+// dir don't interleave writes. The returned function releases both.
+func (s *JSONStore) lock() (unlock func()) {
+	s.mu.Lock()
+	return s.lockDirectory(true, s.mu.Unlock)
+}
+
+// rlock takes the store for reading: the in-process read lock and a shared
+// lock on the lock file, so reads don't see a file another process is
+// writing. The returned function releases both.
+func (s *JSONStore) rlock() (unlock func()) {
+	s.mu.RLock()
+	return s.lockDirectory(false, s.mu.RUnlock)
+}
+
+// lockDirectory locks the lock file after the mutex was taken; release
+// unlocks the mutex. File locks are advisory: if the lock file can't be
+// locked, a warning is logged and only the mutex is held.
+func (s *JSONStore) lockDirectory(exclusive bool, release func()) func() {
+	unlock, err := LockDirectory(s.baseDir, exclusive)
+	if err != nil {
+		s.log.Warn("locking storage directory failed", "error", err)
+		return release
+	}
+	return func() {
+		if err := unlock(); err != nil {
+			s.log.Warn("unlocking storage directory failed", "error", err)
+		}
+		release()
+	}
+}
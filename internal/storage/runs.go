@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/igm/igent/internal/llm"
+)
+
+// RunStatus is the state of an autonomous run
+type RunStatus string
+
+const (
+	RunRunning     RunStatus = "running"
+	RunInterrupted RunStatus = "interrupted" // Cancelled; resumable
+	RunPaused      RunStatus = "paused"      // Waiting for approval at a pause point
+	RunCompleted   RunStatus = "completed"
+	RunFailed      RunStatus = "failed" // Resumable after fixing the cause
+)
+
+// Run is the progress journal of a long-running autonomous task. It is
+// saved after every iteration so the run can be resumed after an
+// interruption or crash.
+type Run struct {
+	ID             string        `json:"id"`
+	ConversationID string        `json:"conversation_id"`
+	Prompt         string        `json:"prompt"`
+	Turn           int           `json:"turn"` // User turn the run belongs to
+	Status         RunStatus     `json:"status"`
+	Iteration      int           `json:"iteration"`
+	ToolCalls      int           `json:"tool_calls"`
+	Cost           float64       `json:"cost"` // Estimated USD spent so far
+	Pause          PausePolicy   `json:"pause"`
+	PauseReason    string        `json:"pause_reason,omitempty"`
+	Approved       RunUsage      `json:"approved"` // Usage when the run was last approved
+	Steps          []RunStep     `json:"steps,omitempty"`
+	Artifacts      []string      `json:"artifacts,omitempty"`   // Short hashes of artifacts produced
+	NextAction     string        `json:"next_action,omitempty"` // What the agent intends to do next
+	Result         string        `json:"result,omitempty"`
+	Error          string        `json:"error,omitempty"`
+	Evaluate       bool          `json:"evaluate,omitempty"`   // Have a critic evaluate the run once it completes
+	Evaluation     *Evaluation   `json:"evaluation,omitempty"` // The critic's verdict
+	Messages       []llm.Message `json:"messages"`             // Loop messages after the system prompt
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// PausePolicy decides when an autonomous run stops for user review
+type PausePolicy struct {
+	EveryToolCalls int      `json:"every_tool_calls,omitempty"` // Pause after this many tool calls (0 = never)
+	EveryCost      float64  `json:"every_cost,omitempty"`       // Pause after spending this many USD (0 = never)
+	Labels         []string `json:"labels,omitempty"`           // Checkpoint labels to pause at; "*" matches all
+}
+
+// RunUsage is a snapshot of a run's usage counters
+type RunUsage struct {
+	ToolCalls int     `json:"tool_calls"`
+	Cost      float64 `json:"cost"`
+}
+
+// RunStep records one tool call of a run
+type RunStep struct {
+	Iteration int       `json:"iteration"`
+	Tool      string    `json:"tool"`
+	Summary   string    `json:"summary"` // First line of the tool output
+	Error     bool      `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Evaluation is a critic's verdict on whether a completed run satisfied
+// its task
+type Evaluation struct {
+	Model  string    `json:"model"`
+	Score  int       `json:"score"` // 0-10
+	Passed bool      `json:"passed"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Resumable reports whether the run can be continued
+func (r *Run) Resumable() bool {
+	return r.Status != RunCompleted
+}
+
+// SaveRun writes a run journal atomically so a crash never leaves it torn
+func (s *JSONStore) SaveRun(run *Run) error {
+	defer s.lock()()
+
+	dir := filepath.Join(s.baseDir, "runs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating runs directory: %w", err)
+	}
+
+	run.UpdatedAt = time.Now()
+	if run.CreatedAt.IsZero() {
+		run.CreatedAt = run.UpdatedAt
+	}
+
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling run: %w", err)
+	}
+
+	path := filepath.Join(dir, run.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replacing run journal: %w", err)
+	}
+
+	s.log.Debug("run saved", "id", run.ID, "status", run.Status, "iteration", run.Iteration)
+	return nil
+}
+
+// LoadRun loads a run journal by ID
+func (s *JSONStore) LoadRun(id string) (*Run, error) {
+	defer s.rlock()()
+
+	data, err := os.ReadFile(filepath.Join(s.baseDir, "runs", id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading run: %w", err)
+	}
+
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("unmarshaling run: %w", err)
+	}
+	return &run, nil
+}
+
+// ListRuns returns all runs, most recently updated first
+func (s *JSONStore) ListRuns() ([]*Run, error) {
+	defer s.rlock()()
+
+	dir := filepath.Join(s.baseDir, "runs")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []*Run
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			s.log.Warn("failed to read run", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		var run Run
+		if err := json.Unmarshal(data, &run); err != nil {
+			s.log.Warn("failed to parse run", "file", entry.Name(), "error", err)
+			continue
+		}
+		run.Messages = nil // Listing only needs the summary
+		runs = append(runs, &run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].UpdatedAt.After(runs[j].UpdatedAt)
+	})
+	return runs, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxScheduleResults is how many results a scheduled task keeps
+const maxScheduleResults = 20
+
+// Schedule is a prompt run on a cron schedule in a named conversation
+type Schedule struct {
+	ID             string           `json:"id"`
+	Cron           string           `json:"cron"`
+	Prompt         string           `json:"prompt"`
+	ConversationID string           `json:"conversation_id"`
+	NextRun        time.Time        `json:"next_run"`
+	Results        []ScheduleResult `json:"results,omitempty"` // Most recent last
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// ScheduleResult is the outcome of one scheduled run
+type ScheduleResult struct {
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+	Response string        `json:"response,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// AddResult records a run, keeping the most recent results
+func (s *Schedule) AddResult(r ScheduleResult) {
+	s.Results = append(s.Results, r)
+	if len(s.Results) > maxScheduleResults {
+		s.Results = s.Results[len(s.Results)-maxScheduleResults:]
+	}
+}
+
+// LastResult returns the most recent result, or nil if it never ran
+func (s *Schedule) LastResult() *ScheduleResult {
+	if len(s.Results) == 0 {
+		return nil
+	}
+	return &s.Results[len(s.Results)-1]
+}
+
+// SaveSchedule writes a scheduled task atomically
+func (s *JSONStore) SaveSchedule(sched *Schedule) error {
+	defer s.lock()()
+
+	dir := filepath.Join(s.baseDir, "schedules")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating schedules directory: %w", err)
+	}
+
+	sched.UpdatedAt = time.Now()
+	if sched.CreatedAt.IsZero() {
+		sched.CreatedAt = sched.UpdatedAt
+	}
+
+	data, err := json.MarshalIndent(sched, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling schedule: %w", err)
+	}
+
+	path := filepath.Join(dir, sched.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replacing schedule: %w", err)
+	}
+
+	s.log.Debug("schedule saved", "id", sched.ID, "next_run", sched.NextRun)
+	return nil
+}
+
+// LoadSchedule loads a scheduled task by ID
+func (s *JSONStore) LoadSchedule(id string) (*Schedule, error) {
+	defer s.rlock()()
+
+	data, err := os.ReadFile(filepath.Join(s.baseDir, "schedules", id+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("reading schedule: %w", err)
+	}
+
+	var sched Schedule
+	if err := json.Unmarshal(data, &sched); err != nil {
+		return nil, fmt.Errorf("unmarshaling schedule: %w", err)
+	}
+	return &sched, nil
+}
+
+// ListSchedules returns all scheduled tasks, soonest next run first
+func (s *JSONStore) ListSchedules() ([]*Schedule, error) {
+	defer s.rlock()()
+
+	dir := filepath.Join(s.baseDir, "schedules")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var schedules []*Schedule
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			s.log.Warn("failed to read schedule", "file", entry.Name(), "error", err)
+			continue
+		}
+
+		var sched Schedule
+		if err := json.Unmarshal(data, &sched); err != nil {
+			s.log.Warn("failed to parse schedule", "file", entry.Name(), "error", err)
+			continue
+		}
+		schedules = append(schedules, &sched)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].NextRun.Before(schedules[j].NextRun)
+	})
+	return schedules, nil
+}
+
+// DeleteSchedule removes a scheduled task
+func (s *JSONStore) DeleteSchedule(id string) error {
+	defer s.lock()()
+
+	err := os.Remove(filepath.Join(s.baseDir, "schedules", id+".json"))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -1,6 +1,9 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// ErrNotFound indicates the requested item was not found
@@ -13,15 +16,56 @@ type Storage interface {
 	SaveConversation(conv *Conversation) error
 	LoadConversation(id string) (*Conversation, error)
 	ListConversations() ([]string, error)
+	ListConversationInfos() ([]*ConversationInfo, error)
+	QueryConversations(q ConversationQuery) ([]*ConversationInfo, int, error)
 	DeleteConversation(id string) error
+	ArchiveConversation(id string) error
 
 	// Memory management
 	SaveMemory(item *MemoryItem) error
 	LoadMemories() ([]*MemoryItem, error)
+	QueryMemories(filter MemoryFilter) ([]*MemoryItem, error)
 	DeleteMemory(id string) error
 
+	// Entity memory
+	SaveEntity(entity *Entity) error
+	LoadEntity(name string) (*Entity, error)
+	ListEntities() ([]*Entity, error)
+	DeleteEntity(name string) error
+
 	// Skill management
 	SaveSkill(skill *Skill) error
 	LoadSkills() ([]*Skill, error)
 	DeleteSkill(id string) error
+
+	// Artifact management
+	SaveArtifact(meta *Artifact, content []byte) (*Artifact, error)
+	ListArtifacts() ([]*Artifact, error)
+	FindArtifact(ref string) (*Artifact, error)
+	ReadArtifact(a *Artifact) ([]byte, error)
+
+	// Working document management
+	SaveDocument(doc *Document) error
+	LoadDocument(conversationID string) (*Document, error)
+	DeleteDocument(conversationID string) error
+
+	// Run journal management
+	SaveRun(run *Run) error
+	LoadRun(id string) (*Run, error)
+	ListRuns() ([]*Run, error)
+
+	// Scheduled task management
+	SaveSchedule(sched *Schedule) error
+	LoadSchedule(id string) (*Schedule, error)
+	ListSchedules() ([]*Schedule, error)
+	DeleteSchedule(id string) error
+
+	// Conversation embedding cache
+	SaveEmbeddings(embeddings map[string]*ConversationEmbedding) error
+	LoadEmbeddings() (map[string]*ConversationEmbedding, error)
+
+	// Usage ledger
+	AddUsage(subjects []string, at time.Time, tokens int, cost float64) error
+	LoadUsage(subject string, at time.Time) (day, month UsageTotals, err error)
+	LoadUsageTotal(subject string) (UsageTotals, error)
 }
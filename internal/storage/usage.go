@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UsageTotals is the LLM usage of one subject over a period
+type UsageTotals struct {
+	Tokens int     `json:"tokens"`
+	Cost   float64 `json:"cost"` // Estimated USD
+}
+
+// usageLedger is one month of usage: subject -> day (YYYY-MM-DD) -> totals
+type usageLedger map[string]map[string]UsageTotals
+
+// AddUsage records usage for each subject in the ledger of the month of at
+func (s *JSONStore) AddUsage(subjects []string, at time.Time, tokens int, cost float64) error {
+	defer s.lock()()
+
+	ledger, err := s.readUsage(at)
+	if err != nil {
+		return err
+	}
+	day := at.Format(time.DateOnly)
+	for _, subject := range subjects {
+		if ledger[subject] == nil {
+			ledger[subject] = make(map[string]UsageTotals)
+		}
+		t := ledger[subject][day]
+		t.Tokens += tokens
+		t.Cost += cost
+		ledger[subject][day] = t
+	}
+
+	dir := filepath.Join(s.baseDir, "usage")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating usage directory: %w", err)
+	}
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling usage: %w", err)
+	}
+	path := s.usagePath(at)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replacing usage ledger: %w", err)
+	}
+	return nil
+}
+
+// LoadUsage returns a subject's usage on the day and in the month of at
+func (s *JSONStore) LoadUsage(subject string, at time.Time) (day, month UsageTotals, err error) {
+	defer s.rlock()()
+
+	ledger, err := s.readUsage(at)
+	if err != nil {
+		return day, month, err
+	}
+	for d, t := range ledger[subject] {
+		month.Tokens += t.Tokens
+		month.Cost += t.Cost
+		if d == at.Format(time.DateOnly) {
+			day = t
+		}
+	}
+	return day, month, nil
+}
+
+// LoadUsageTotal returns a subject's usage over all months in the ledger
+func (s *JSONStore) LoadUsageTotal(subject string) (UsageTotals, error) {
+	defer s.rlock()()
+
+	var total UsageTotals
+	paths, err := filepath.Glob(filepath.Join(s.baseDir, "usage", "????-??.json"))
+	if err != nil {
+		return total, err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return total, fmt.Errorf("reading usage: %w", err)
+		}
+		var ledger usageLedger
+		if err := json.Unmarshal(data, &ledger); err != nil {
+			return total, fmt.Errorf("unmarshaling usage: %w", err)
+		}
+		for _, t := range ledger[subject] {
+			total.Tokens += t.Tokens
+			total.Cost += t.Cost
+		}
+	}
+	return total, nil
+}
+
+// readUsage reads the ledger of the month of at; the caller holds the lock
+func (s *JSONStore) readUsage(at time.Time) (usageLedger, error) {
+	ledger := make(usageLedger)
+	data, err := os.ReadFile(s.usagePath(at))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ledger, nil
+		}
+		return nil, fmt.Errorf("reading usage: %w", err)
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("unmarshaling usage: %w", err)
+	}
+	return ledger, nil
+}
+
+// usagePath is the ledger file of the month of at
+func (s *JSONStore) usagePath(at time.Time) string {
+	return filepath.Join(s.baseDir, "usage", at.Format("2006-01")+".json")
+}
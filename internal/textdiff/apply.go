@@ -0,0 +1,154 @@
+package textdiff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// hunk is one @@ section of a unified diff
+type hunk struct {
+	oldStart int // 1-based
+	oldLines []string
+	newLines []string
+}
+
+// Apply applies a unified diff to text. File headers are ignored, so the
+// patch must target a single file. Hunks are located at their stated
+// position or, failing that, at the nearest position where their context
+// matches, as patch(1) does.
+func Apply(text, patch string) (string, error) {
+	hunks, err := parseHunks(patch)
+	if err != nil {
+		return "", err
+	}
+	if len(hunks) == 0 {
+		return "", fmt.Errorf("patch contains no hunks")
+	}
+
+	lines := SplitLines(text)
+	offset := 0
+	for i, h := range hunks {
+		want := h.oldStart - 1 + offset
+		if len(h.oldLines) == 0 && h.oldStart > 0 {
+			want = h.oldStart + offset // Pure insertion after line oldStart
+		}
+
+		pos := findBlock(lines, h.oldLines, want)
+		if pos < 0 {
+			return "", fmt.Errorf("hunk %d does not apply", i+1)
+		}
+
+		updated := make([]string, 0, len(lines)-len(h.oldLines)+len(h.newLines))
+		updated = append(updated, lines[:pos]...)
+		updated = append(updated, h.newLines...)
+		updated = append(updated, lines[pos+len(h.oldLines):]...)
+		lines = updated
+		offset += len(h.newLines) - len(h.oldLines)
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+// parseHunks parses the hunks of a unified diff
+func parseHunks(patch string) ([]*hunk, error) {
+	var hunks []*hunk
+	var current *hunk
+	var last *string // Most recent line, for "\ No newline" markers
+
+	for _, line := range SplitLines(patch) {
+		body := strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if strings.HasPrefix(body, "@@") {
+			start, err := parseHunkHeader(body)
+			if err != nil {
+				return nil, err
+			}
+			current = &hunk{oldStart: start}
+			hunks = append(hunks, current)
+			last = nil
+			continue
+		}
+		if current == nil {
+			continue // File headers and preamble
+		}
+
+		if strings.HasPrefix(line, "\\") {
+			if last != nil {
+				*last = strings.TrimSuffix(*last, "\n")
+			}
+			continue
+		}
+
+		// Blank context lines often lose their leading space
+		kind, content := byte(' '), "\n"
+		if body != "" {
+			kind, content = line[0], line[1:]
+		}
+
+		switch kind {
+		case ' ':
+			current.oldLines = append(current.oldLines, content)
+			current.newLines = append(current.newLines, content)
+			last = &current.newLines[len(current.newLines)-1]
+		case '-':
+			current.oldLines = append(current.oldLines, content)
+			last = &current.oldLines[len(current.oldLines)-1]
+		case '+':
+			current.newLines = append(current.newLines, content)
+			last = &current.newLines[len(current.newLines)-1]
+		default:
+			// Trailing text ends the hunk
+			current = nil
+		}
+	}
+
+	return hunks, nil
+}
+
+// parseHunkHeader returns the old start line of "@@ -l,s +l,s @@"
+func parseHunkHeader(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	start, _, _ := strings.Cut(strings.TrimPrefix(fields[1], "-"), ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	return n, nil
+}
+
+// findBlock finds block in lines, preferring the position closest to want
+func findBlock(lines, block []string, want int) int {
+	if want < 0 {
+		want = 0
+	}
+	if want > len(lines) {
+		want = len(lines)
+	}
+
+	for delta := 0; delta <= len(lines); delta++ {
+		for _, pos := range []int{want - delta, want + delta} {
+			if pos >= 0 && pos+len(block) <= len(lines) && matchAt(lines, block, pos) {
+				return pos
+			}
+			if delta == 0 {
+				break
+			}
+		}
+	}
+	return -1
+}
+
+// matchAt compares lines ignoring line endings, so a final line without a
+// newline still matches
+func matchAt(lines, block []string, pos int) bool {
+	for i, l := range block {
+		if strings.TrimRight(lines[pos+i], "\r\n") != strings.TrimRight(l, "\r\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+// Package textdiff computes line-based diffs and renders them in unified format.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpKind is the kind of a diff operation
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Op is one line of a diff
+type Op struct {
+	Kind OpKind
+	Line string // Includes the trailing newline, if any
+}
+
+// SplitLines splits text into lines, keeping line endings
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines computes the shortest edit script turning a into b (Myers' algorithm)
+func Lines(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace from the end to recover the edit script
+func backtrack(a, b []string, trace [][]int, offset int) []Op {
+	var ops []Op
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+offset]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Op{Kind: Equal, Line: a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, Op{Kind: Insert, Line: b[y-1]})
+				y--
+			} else {
+				ops = append(ops, Op{Kind: Delete, Line: a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Unified renders the difference between two texts as a unified diff with
+// the given number of context lines. It returns "" when the texts are equal.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	ops := Lines(SplitLines(oldText), SplitLines(newText))
+
+	// Line positions in a and b before each op
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.Kind != Insert {
+			aPos[i+1]++
+		}
+		if op.Kind != Delete {
+			bPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are within 2*context lines
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != Equal {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		aCount, bCount := aPos[stop]-aPos[start], bPos[stop]-bPos[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aPos[start], aCount), hunkRange(bPos[start], bCount))
+
+		for _, op := range ops[start:stop] {
+			switch op.Kind {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+			sb.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = stop
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats a hunk range; empty ranges refer to the line before them
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,135 @@
+package textdiff
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string // Op kinds: = - +
+	}{
+		{"equal", "a\nb\n", "a\nb\n", "=="},
+		{"empty", "", "", ""},
+		{"insert all", "", "a\nb\n", "++"},
+		{"delete all", "a\nb\n", "", "--"},
+		{"change middle", "a\nb\nc\n", "a\nx\nc\n", "=-+="},
+		{"append", "a\n", "a\nb\n", "=+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got strings.Builder
+			for _, op := range Lines(SplitLines(tt.a), SplitLines(tt.b)) {
+				got.WriteByte("=-+"[op.Kind])
+			}
+			if got.String() != tt.want {
+				t.Errorf("Lines() = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	if got := Unified("a", "b", "same\n", "same\n", 3); got != "" {
+		t.Errorf("expected empty diff for equal texts, got %q", got)
+	}
+
+	old := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	new := "one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven"
+	want := `--- a/f
++++ b/f
+@@ -1,5 +1,5 @@
+ one
+-two
++TWO
+ three
+ four
+ five
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+\ No newline at end of file
+`
+	if got := Unified("a/f", "b/f", old, new, 3); got != want {
+		t.Errorf("Unified() =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestUnified_PatchRoundTrip checks the output against the system patch tool
+func TestUnified_PatchRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not available")
+	}
+
+	old := "package main\n\nfunc main() {\n\tprintln(\"a\")\n}\n"
+	new := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"b\")\n}\n"
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	os.WriteFile(path, []byte(old), 0644)
+
+	cmd := exec.Command("patch", path)
+	cmd.Stdin = strings.NewReader(Unified("a/main.go", "b/main.go", old, new, 3))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("patch failed: %v\n%s", err, out)
+	}
+
+	got, _ := os.ReadFile(path)
+	if string(got) != new {
+		t.Errorf("patched file = %q, want %q", got, new)
+	}
+}
+
+func TestApply(t *testing.T) {
+	old := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	new := "zero\none\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven"
+
+	got, err := Apply(old, Unified("a", "b", old, new, 3))
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got != new {
+		t.Errorf("Apply() = %q, want %q", got, new)
+	}
+}
+
+func TestApply_OffsetAndLooseFormatting(t *testing.T) {
+	text := "header\nadded later\nfunc a() {\n\n\treturn 1\n}\n"
+
+	// Stated line numbers are off by one, and the blank context line lost its space
+	patch := "--- a/x.go\n+++ b/x.go\n@@ -2,4 +2,4 @@\n func a() {\n\n-\treturn 1\n+\treturn 2\n }\n"
+	got, err := Apply(text, patch)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if want := "header\nadded later\nfunc a() {\n\n\treturn 2\n}\n"; got != want {
+		t.Errorf("Apply() = %q, want %q", got, want)
+	}
+}
+
+func TestApply_Errors(t *testing.T) {
+	if _, err := Apply("a\n", "no hunks here"); err == nil {
+		t.Error("expected error for patch without hunks")
+	}
+	if _, err := Apply("a\n", "@@ -1 +1 @@\n-b\n+c\n"); err == nil {
+		t.Error("expected error for hunk that does not apply")
+	}
+	if _, err := Apply("a\n", "@@ bogus @@\n"); err == nil {
+		t.Error("expected error for invalid hunk header")
+	}
+}
+
+func TestApply_Insertion(t *testing.T) {
+	got, err := Apply("", "@@ -0,0 +1,2 @@\n+a\n+b\n")
+	if err != nil || got != "a\nb\n" {
+		t.Errorf("Apply() = %q, %v", got, err)
+	}
+}
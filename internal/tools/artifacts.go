@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/textdiff"
+)
+
+// registerArtifactTools registers tools for saving generated files
+func (r *Registry) registerArtifactTools() {
+	if r.store == nil {
+		return
+	}
+
+	// artifact_save - Store generated content as a named artifact
+	r.Register(&Tool{
+		Name:        "artifact_save",
+		Description: "Save generated code or a document as a named artifact so the user can list and export it later with 'igent artifacts'.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "File name for the artifact, e.g. main.go or report.md",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "The full content to save",
+				},
+				"language": map[string]interface{}{
+					"type":        "string",
+					"description": "Language or file type (optional)",
+				},
+			},
+			"required": []string{"name", "content"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			name, ok := args["name"].(string)
+			if !ok || name == "" {
+				return "", fmt.Errorf("name is required")
+			}
+			content, ok := args["content"].(string)
+			if !ok || content == "" {
+				return "", fmt.Errorf("content is required")
+			}
+			language, _ := args["language"].(string)
+
+			convID, turn := ConversationFromContext(ctx)
+			artifact, err := r.storage().SaveArtifact(&storage.Artifact{
+				Name:           name,
+				Language:       language,
+				ConversationID: convID,
+				Turn:           turn,
+			}, []byte(content))
+			if err != nil {
+				return "", fmt.Errorf("failed to save artifact: %w", err)
+			}
+
+			return fmt.Sprintf("Artifact saved: %s (%s, %d bytes)", artifact.Name, artifact.ShortHash(), artifact.Size), nil
+		},
+	})
+	r.markSafe("artifact_save")
+
+	// artifact_read - Read a stored artifact, e.g. a compressed tool output
+	r.Register(&Tool{
+		Name:        "artifact_read",
+		Description: "Read a stored artifact by hash prefix or name, optionally a range of lines. Use it to view full tool outputs that were compressed earlier in the turn.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ref": map[string]interface{}{
+					"type":        "string",
+					"description": "Artifact hash prefix (at least 4 characters) or name",
+				},
+				"start_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "First line to return, 1-based (default: 1)",
+				},
+				"end_line": map[string]interface{}{
+					"type":        "integer",
+					"description": "Last line to return (default: end of artifact)",
+				},
+			},
+			"required": []string{"ref"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			ref, ok := args["ref"].(string)
+			if !ok || ref == "" {
+				return "", fmt.Errorf("ref is required")
+			}
+
+			artifact, err := r.storage().FindArtifact(ref)
+			if errors.Is(err, storage.ErrNotFound) {
+				return "", fmt.Errorf("artifact not found: %s", ref)
+			}
+			if err != nil {
+				return "", err
+			}
+			content, err := r.storage().ReadArtifact(artifact)
+			if err != nil {
+				return "", err
+			}
+
+			lines := textdiff.SplitLines(string(content))
+			start := getInt(args, "start_line", 1)
+			end := getInt(args, "end_line", len(lines))
+			if start < 1 {
+				start = 1
+			}
+			if end > len(lines) {
+				end = len(lines)
+			}
+			if start > end {
+				return "", fmt.Errorf("invalid line range %d-%d (artifact has %d lines)", start, end, len(lines))
+			}
+
+			result := strings.Join(lines[start-1:end], "")
+			if len(result) > 10000 {
+				result = result[:10000] + "\n... (output truncated; request a smaller line range)"
+			}
+			return result, nil
+		},
+	})
+	r.markSafe("artifact_read")
+}
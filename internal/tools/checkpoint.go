@@ -0,0 +1,44 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// registerCheckpointTool registers the checkpoint tool used to label plan
+// steps. Autonomous runs can be configured to pause at given labels.
+func (r *Registry) registerCheckpointTool() {
+	r.Register(&Tool{
+		Name: "checkpoint",
+		Description: "Mark a labeled step of your plan, e.g. 'tests-pass' or 'before-deploy'. " +
+			"Call it when you finish a milestone or before a risky step; autonomous runs may pause here for user review.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"label": map[string]interface{}{
+					"type":        "string",
+					"description": "Short label of the plan step",
+				},
+				"summary": map[string]interface{}{
+					"type":        "string",
+					"description": "What was done so far and what comes next",
+				},
+			},
+			"required": []string{"label"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			label := CheckpointLabel(args)
+			if label == "" {
+				return "", fmt.Errorf("label is required")
+			}
+			return fmt.Sprintf("Checkpoint %q recorded.", label), nil
+		},
+	})
+	r.markSafe("checkpoint")
+}
+
+// CheckpointLabel returns the normalized label of checkpoint tool arguments
+func CheckpointLabel(args map[string]interface{}) string {
+	label, _ := args["label"].(string)
+	return strings.ToLower(strings.TrimSpace(label))
+}
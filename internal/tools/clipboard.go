@@ -0,0 +1,60 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+// clipboardMaxOutput caps the clipboard text returned to the model
+const clipboardMaxOutput = 15000
+
+// registerClipboardTools registers clipboard_get and clipboard_set. Both ask
+// for confirmation by default: the clipboard often holds passwords and
+// tokens, and setting it replaces what the user copied.
+func (r *Registry) registerClipboardTools() {
+	// clipboard_get - Read the system clipboard
+	r.Register(&Tool{
+		Name:        "clipboard_get",
+		Description: "Read the text on the user's system clipboard, e.g. something they just copied",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			text, err := readClipboard(ctx)
+			if err != nil {
+				return "", fmt.Errorf("reading clipboard: %w", err)
+			}
+			if text == "" {
+				return "(clipboard is empty)", nil
+			}
+			return truncateOutput(ctx, text, clipboardMaxOutput), nil
+		},
+	})
+
+	// clipboard_set - Write the system clipboard
+	r.Register(&Tool{
+		Name:        "clipboard_set",
+		Description: "Put text on the user's system clipboard, replacing its contents, so they can paste it elsewhere",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to copy",
+				},
+			},
+			"required": []string{"text"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			text, ok := args["text"].(string)
+			if !ok {
+				return "", fmt.Errorf("text is required")
+			}
+			if err := writeClipboard(ctx, text); err != nil {
+				return "", fmt.Errorf("writing clipboard: %w", err)
+			}
+			return fmt.Sprintf("Copied %d characters to the clipboard", len([]rune(text))), nil
+		},
+	})
+}
@@ -0,0 +1,86 @@
+//go:build !windows
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardBackend is a pair of commands reading and writing the clipboard
+type clipboardBackend struct {
+	get []string
+	set []string
+}
+
+// clipboardCommands returns the clipboard commands of the platform: pbcopy
+// on macOS, wl-clipboard under Wayland, then xclip or xsel under X11
+func clipboardCommands() (clipboardBackend, error) {
+	if runtime.GOOS == "darwin" {
+		return clipboardBackend{get: []string{"pbpaste"}, set: []string{"pbcopy"}}, nil
+	}
+	var candidates []clipboardBackend
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, clipboardBackend{
+			get: []string{"wl-paste", "--no-newline"},
+			set: []string{"wl-copy"},
+		})
+	}
+	candidates = append(candidates,
+		clipboardBackend{
+			get: []string{"xclip", "-selection", "clipboard", "-o"},
+			set: []string{"xclip", "-selection", "clipboard", "-i"},
+		},
+		clipboardBackend{
+			get: []string{"xsel", "--clipboard", "--output"},
+			set: []string{"xsel", "--clipboard", "--input"},
+		},
+	)
+	for _, b := range candidates {
+		if _, err := exec.LookPath(b.get[0]); err == nil {
+			return b, nil
+		}
+	}
+	return clipboardBackend{}, errors.New("no clipboard command found; install wl-clipboard, xclip or xsel")
+}
+
+func readClipboard(ctx context.Context) (string, error) {
+	b, err := clipboardCommands()
+	if err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.get[0], b.get[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		// wl-paste and xclip fail on an empty clipboard
+		if strings.Contains(msg, "No selection") || strings.Contains(msg, "target STRING not available") || strings.Contains(msg, "Nothing is copied") {
+			return "", nil
+		}
+		return "", fmt.Errorf("%s: %w: %s", b.get[0], err, msg)
+	}
+	return string(out), nil
+}
+
+func writeClipboard(ctx context.Context, text string) error {
+	b, err := clipboardCommands()
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, b.set[0], b.set[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	// wl-copy and xclip fork to serve the selection; with a pipe on stdout
+	// or stderr, Run would wait for them until something else is copied
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", b.set[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build windows
+
+package tools
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	user32           = syscall.NewLazyDLL("user32.dll")
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	openClipboard    = user32.NewProc("OpenClipboard")
+	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
+	getClipboardData = user32.NewProc("GetClipboardData")
+	setClipboardData = user32.NewProc("SetClipboardData")
+	globalAlloc      = kernel32.NewProc("GlobalAlloc")
+	globalFree       = kernel32.NewProc("GlobalFree")
+	globalLock       = kernel32.NewProc("GlobalLock")
+	globalUnlock     = kernel32.NewProc("GlobalUnlock")
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+// openClipboardRetry opens the clipboard, retrying while another program
+// holds it
+func openClipboardRetry(ctx context.Context) error {
+	for {
+		r, _, err := openClipboard.Call(0)
+		if r != 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("OpenClipboard: %w", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func readClipboard(ctx context.Context) (string, error) {
+	if err := openClipboardRetry(ctx); err != nil {
+		return "", err
+	}
+	defer closeClipboard.Call()
+
+	h, _, _ := getClipboardData.Call(cfUnicodeText)
+	if h == 0 {
+		return "", nil // Empty, or no text on the clipboard
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		return "", fmt.Errorf("GlobalLock: %w", err)
+	}
+	defer globalUnlock.Call(h)
+
+	var text []uint16
+	for ptr := globalPointer(p); ; ptr = unsafe.Add(ptr, 2) {
+		c := *(*uint16)(ptr)
+		if c == 0 {
+			break
+		}
+		text = append(text, c)
+	}
+	return string(utf16.Decode(text)), nil
+}
+
+func writeClipboard(ctx context.Context, text string) error {
+	data := utf16.Encode([]rune(text + "\x00"))
+
+	if err := openClipboardRetry(ctx); err != nil {
+		return err
+	}
+	defer closeClipboard.Call()
+
+	if r, _, err := emptyClipboard.Call(); r == 0 {
+		return fmt.Errorf("EmptyClipboard: %w", err)
+	}
+	h, _, err := globalAlloc.Call(gmemMoveable, uintptr(len(data)*2))
+	if h == 0 {
+		return fmt.Errorf("GlobalAlloc: %w", err)
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		globalFree.Call(h)
+		return fmt.Errorf("GlobalLock: %w", err)
+	}
+	copy(unsafe.Slice((*uint16)(globalPointer(p)), len(data)), data)
+	globalUnlock.Call(h)
+
+	if r, _, err := setClipboardData.Call(cfUnicodeText, h); r == 0 {
+		globalFree.Call(h)
+		return fmt.Errorf("SetClipboardData: %w", err)
+	}
+	// The clipboard owns the memory now
+	return nil
+}
+
+// globalPointer converts the address of locked global memory, which the Go
+// garbage collector doesn't manage, to a pointer
+func globalPointer(p uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&p))
+}
@@ -0,0 +1,309 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// codeDefaultTimeout is the wall-clock limit of a snippet in seconds
+	codeDefaultTimeout = 30
+
+	// codeMaxTimeout caps the timeout a call may request
+	codeMaxTimeout = 300
+
+	// codeMaxOutput caps each of stdout and stderr in the result
+	codeMaxOutput = 10000
+)
+
+// CodeConfig configures the run_code tool
+type CodeConfig struct {
+	Backend    string // process or docker; empty disables run_code
+	Image      string // Docker image for all languages (empty = per-language default)
+	Timeout    int    // Default wall-clock limit in seconds
+	CPUSeconds int    // CPU time limit (0 = none)
+	MemoryMB   int    // Memory limit (0 = none)
+}
+
+// codeLanguage describes how to run snippets of one language
+type codeLanguage struct {
+	file    string   // Source file name
+	command []string // Interpreter; the source file is appended
+	image   string   // Default Docker image
+}
+
+var codeLanguages = map[string]codeLanguage{
+	"python":     {file: "main.py", command: []string{"python3", "-I", "-u"}, image: "python:3-alpine"},
+	"javascript": {file: "main.js", command: []string{"node"}, image: "node:alpine"},
+	"bash":       {file: "main.sh", command: []string{"bash"}, image: "bash:latest"},
+}
+
+// SetCodeRunner registers the run_code tool with the given sandbox backend
+func (r *Registry) SetCodeRunner(cfg CodeConfig) error {
+	switch cfg.Backend {
+	case "":
+		return nil
+	case "process", "docker":
+	default:
+		return fmt.Errorf("unknown code backend: %s", cfg.Backend)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = codeDefaultTimeout
+	}
+
+	languages := make([]string, 0, len(codeLanguages))
+	for name := range codeLanguages {
+		languages = append(languages, name)
+	}
+	sort.Strings(languages)
+
+	// The process backend only limits resources; files outside its
+	// scratch directory are as reachable as for any local program
+	sandbox := "in a container without network access. Only /tmp is writable, and files written there are discarded."
+	if cfg.Backend == "process" {
+		sandbox = "as a local process in a scratch directory that is removed afterwards. " +
+			"The snippet can still read and write the user's files and use the network."
+	}
+
+	// run_code - Execute a code snippet in a sandbox
+	r.Register(&Tool{
+		Name: "run_code",
+		Description: "Run a code snippet with CPU time and memory limits and return stdout, stderr and the exit code. " +
+			"The snippet runs " + sandbox,
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"language": map[string]interface{}{
+					"type":        "string",
+					"description": "Language of the snippet (default: python)",
+					"enum":        languages,
+				},
+				"code": map[string]interface{}{
+					"type":        "string",
+					"description": "Source code to run",
+				},
+				"stdin": map[string]interface{}{
+					"type":        "string",
+					"description": "Input passed to the program on stdin",
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Timeout in seconds (default: %d, max: %d)", cfg.Timeout, codeMaxTimeout),
+				},
+			},
+			"required": []string{"code"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			return runCode(ctx, cfg, args)
+		},
+	})
+	return nil
+}
+
+// runCode executes the run_code tool
+func runCode(ctx context.Context, cfg CodeConfig, args map[string]interface{}) (string, error) {
+	code, ok := args["code"].(string)
+	if !ok || code == "" {
+		return "", fmt.Errorf("code is required")
+	}
+	langName := "python"
+	if l, ok := args["language"].(string); ok && l != "" {
+		langName = strings.ToLower(l)
+	}
+	lang, ok := codeLanguages[langName]
+	if !ok {
+		return "", fmt.Errorf("unsupported language: %s", langName)
+	}
+
+	timeout := callTimeout(ctx, args, cfg.Timeout, codeMaxTimeout)
+
+	// The snippet runs in a scratch directory removed afterwards
+	dir, err := os.MkdirTemp("", "igent-code-*")
+	if err != nil {
+		return "", fmt.Errorf("creating sandbox directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0755); err != nil {
+		return "", fmt.Errorf("preparing sandbox directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lang.file), []byte(code), 0644); err != nil {
+		return "", fmt.Errorf("writing snippet: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	var container string
+	if cfg.Backend == "docker" {
+		container = "igent-code-" + randomSuffix()
+		cmd = exec.CommandContext(runCtx, "docker", dockerRunArgs(cfg, lang, dir, container)...)
+		cmd.Env = os.Environ()
+	} else {
+		command := append(append([]string(nil), lang.command...), lang.file)
+		name, cmdArgs := withResourceLimits(command[0], command[1:], cfg.CPUSeconds, cfg.MemoryMB)
+		cmd = exec.CommandContext(runCtx, name, cmdArgs...)
+		cmd.Env = sandboxEnv(dir)
+	}
+	cmd.Dir = dir
+	cmd.WaitDelay = time.Second
+	killProcessGroup(cmd)
+	if stdin, ok := args["stdin"].(string); ok {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	out := &codeOutput{live: outputFromContext(ctx)}
+	cmd.Stdout = out.stream(&out.stdout)
+	cmd.Stderr = out.stream(&out.stderr)
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start).Round(10 * time.Millisecond)
+
+	if container != "" && runCtx.Err() != nil {
+		// Killing the docker client leaves the container running
+		exec.Command("docker", "rm", "-f", container).Run()
+	}
+
+	var status string
+	switch {
+	case ctx.Err() != nil:
+		return "", fmt.Errorf("execution cancelled")
+	case runCtx.Err() == context.DeadlineExceeded:
+		status = fmt.Sprintf("timed out after %d seconds", timeout)
+	case err == nil:
+		status = fmt.Sprintf("exit code: 0 (%s)", elapsed)
+	default:
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return "", fmt.Errorf("running %s: %w", langName, err)
+		}
+		status = fmt.Sprintf("exit code: %d (%s)", exitErr.ExitCode(), elapsed)
+		if exitErr.ExitCode() == -1 {
+			// Killed by a signal, typically the CPU time limit
+			status = fmt.Sprintf("killed: %s (%s)", exitErr, elapsed)
+		}
+	}
+	return out.format(status), nil
+}
+
+// dockerRunArgs builds a docker run command line for a snippet: no network,
+// a read-only root and source mount, and the configured resource limits
+func dockerRunArgs(cfg CodeConfig, lang codeLanguage, dir, container string) []string {
+	image := cfg.Image
+	if image == "" {
+		image = lang.image
+	}
+
+	args := []string{
+		"run", "--rm", "-i",
+		"--name", container,
+		"--network", "none",
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--pids-limit", "128",
+		"--security-opt", "no-new-privileges",
+		"-e", "HOME=/tmp",
+		"-v", dir + ":/work:ro",
+		"-w", "/work",
+	}
+	if cfg.MemoryMB > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%dm", cfg.MemoryMB))
+	}
+	if cfg.CPUSeconds > 0 {
+		args = append(args, "--ulimit", fmt.Sprintf("cpu=%d:%d", cfg.CPUSeconds, cfg.CPUSeconds))
+	}
+	args = append(args, image)
+	args = append(args, lang.command...)
+	return append(args, lang.file)
+}
+
+// sandboxEnv is the minimal environment of a snippet run as a process:
+// no credentials or configuration leak in from the agent's environment
+func sandboxEnv(dir string) []string {
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+		"PYTHONDONTWRITEBYTECODE=1",
+	}
+	if runtime.GOOS == "windows" {
+		env = append(env, "SystemRoot="+os.Getenv("SystemRoot"), "TEMP="+dir, "TMP="+dir)
+	}
+	return env
+}
+
+// randomSuffix returns a short random hex string
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// codeOutput collects stdout and stderr, forwarding chunks to a live
+// output callback as they arrive
+type codeOutput struct {
+	mu     sync.Mutex
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	live   func(string)
+}
+
+// stream returns a writer appending to buf
+func (o *codeOutput) stream(buf *bytes.Buffer) *codeStream {
+	return &codeStream{out: o, buf: buf}
+}
+
+// format renders the collected output and the exit status
+func (o *codeOutput) format(status string) string {
+	var sb strings.Builder
+	for _, part := range []struct {
+		name string
+		buf  *bytes.Buffer
+	}{{"stdout", &o.stdout}, {"stderr", &o.stderr}} {
+		text := strings.TrimRight(part.buf.String(), "\n")
+		if text == "" {
+			continue
+		}
+		if len(text) > codeMaxOutput {
+			text = text[:codeMaxOutput] + "\n... (output truncated)"
+		}
+		fmt.Fprintf(&sb, "%s:\n%s\n", part.name, text)
+	}
+	if sb.Len() == 0 {
+		sb.WriteString("(no output)\n")
+	}
+	sb.WriteString(status)
+	return sb.String()
+}
+
+// codeStream is the writer of one output stream
+type codeStream struct {
+	out *codeOutput
+	buf *bytes.Buffer
+}
+
+func (s *codeStream) Write(p []byte) (int, error) {
+	s.out.mu.Lock()
+	defer s.out.mu.Unlock()
+	// Keep a little more than is returned so truncation is detected
+	if s.buf.Len() <= codeMaxOutput {
+		s.buf.Write(p)
+	}
+	if s.out.live != nil {
+		s.out.live(string(p))
+	}
+	return len(p), nil
+}
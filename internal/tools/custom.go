@@ -0,0 +1,298 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	customDefaultTimeout = 30
+	customMaxOutput      = 15000
+)
+
+var (
+	// placeholder matches ${name} at the start of the rest of a custom
+	// tool's command
+	placeholder = regexp.MustCompile(`^\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+	// validParamName matches the parameter names custom tools may declare
+	validParamName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// CustomTool declares a shell-backed tool (tools.custom in the config)
+type CustomTool struct {
+	Name        string
+	Namespace   string // Optional, as in deploy.status
+	Description string
+	Parameters  []CustomParam
+	Command     string // Shell command; ${name} is replaced by the argument, passed in $IGENT_ARG_name
+	Timeout     int    // Seconds; default 30
+}
+
+// CustomParam is one parameter of a custom tool
+type CustomParam struct {
+	Name        string
+	Type        string // string (default), integer, number, boolean or array
+	Description string
+	Required    bool
+	Enum        []string
+	Default     interface{} // Used when the model omits the parameter
+}
+
+// RegisterCustomTools compiles tools declared in the config into tools that
+// run their command with sh -c. Arguments are passed in environment
+// variables the command refers to, so the model can't inject commands
+// through them, whether ${name} stands quoted or not; ${...} naming no parameter
+// is left for the shell. Custom tools ask for confirmation like any tool
+// not marked safe, and may not replace other tools.
+func (r *Registry) RegisterCustomTools(defs []CustomTool) error {
+	for _, def := range defs {
+		tool, err := compileCustomTool(def)
+		if err != nil {
+			return fmt.Errorf("tools.custom %q: %w", def.Name, err)
+		}
+		if err := r.Add(tool); err != nil {
+			return fmt.Errorf("tools.custom %q: %w", def.Name, err)
+		}
+		r.log.Info("custom tool registered", "name", tool.Name)
+	}
+	return nil
+}
+
+// compileCustomTool validates a declaration and builds its tool
+func compileCustomTool(def CustomTool) (*Tool, error) {
+	def.Name = QualifiedName(def.Namespace, def.Name)
+	if !validQualifiedName(def.Name) {
+		return nil, errors.New("invalid tool name")
+	}
+	if def.Description == "" {
+		return nil, errors.New("description is required")
+	}
+	if strings.TrimSpace(def.Command) == "" {
+		return nil, errors.New("command is required")
+	}
+	if def.Timeout <= 0 {
+		def.Timeout = customDefaultTimeout
+	}
+
+	properties := make(map[string]interface{}, len(def.Parameters))
+	required := []string{}
+	params := make(map[string]CustomParam, len(def.Parameters))
+	for _, p := range def.Parameters {
+		if !validParamName.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if _, dup := params[p.Name]; dup {
+			return nil, fmt.Errorf("parameter %s is declared twice", p.Name)
+		}
+		if p.Type == "" {
+			p.Type = "string"
+		}
+		prop := map[string]interface{}{"type": p.Type}
+		switch p.Type {
+		case "string", "integer", "number", "boolean":
+		case "array":
+			prop["items"] = map[string]interface{}{"type": "string"}
+		default:
+			return nil, fmt.Errorf("parameter %s: unsupported type %q", p.Name, p.Type)
+		}
+		if p.Description != "" {
+			prop["description"] = p.Description
+		}
+		if len(p.Enum) > 0 {
+			prop["enum"] = p.Enum
+		}
+		if p.Default != nil {
+			prop["default"] = p.Default
+		}
+		if p.Required {
+			required = append(required, p.Name)
+		}
+		properties[p.Name] = prop
+		params[p.Name] = p
+	}
+
+	return &Tool{
+		Name:        def.Name,
+		Description: def.Description,
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			command, env, err := expandCommand(def.Command, params, args)
+			if err != nil {
+				return "", err
+			}
+			return runCustomTool(ctx, def.Name, command, env, def.Timeout)
+		},
+	}, nil
+}
+
+// expandCommand resolves the arguments of a call and substitutes them into
+// a command template. The values never become shell code: they are passed
+// in IGENT_ARG_<name> environment variables, and each ${name} becomes a
+// reference to its variable quoted for where it stands in the template.
+// Unquoted, an array expands to one word per element.
+func expandCommand(template string, params map[string]CustomParam, args map[string]interface{}) (string, []string, error) {
+	values := make(map[string]interface{}, len(params))
+	for name, p := range params {
+		v, ok := args[name]
+		if !ok || v == nil {
+			if p.Required {
+				return "", nil, fmt.Errorf("%s is required", name)
+			}
+			v = p.Default
+		}
+		if s, isString := v.(string); isString && len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+			return "", nil, fmt.Errorf("%s must be one of %s", name, strings.Join(p.Enum, ", "))
+		}
+		values[name] = v
+	}
+
+	var env []string
+	for _, name := range sortedParamNames(params) {
+		words := argWords(values[name])
+		env = append(env, argVar(name)+"="+strings.Join(words, " "))
+		if _, isArray := values[name].([]interface{}); isArray {
+			for i, word := range words {
+				env = append(env, fmt.Sprintf("%s_%d=%s", argVar(name), i, word))
+			}
+		}
+	}
+
+	const (
+		unquoted = iota
+		singleQuoted
+		doubleQuoted
+	)
+	var sb strings.Builder
+	state := unquoted
+	for i := 0; i < len(template); {
+		if m := placeholder.FindStringSubmatchIndex(template[i:]); m != nil {
+			name := template[i+m[2] : i+m[3]]
+			if _, ok := params[name]; ok {
+				ref := "${" + argVar(name) + "}"
+				switch state {
+				case doubleQuoted:
+					sb.WriteString(ref)
+				case singleQuoted:
+					sb.WriteString(`'"` + ref + `"'`)
+				default:
+					if v, isArray := values[name].([]interface{}); isArray {
+						refs := make([]string, len(v))
+						for j := range v {
+							refs[j] = fmt.Sprintf(`"${%s_%d}"`, argVar(name), j)
+						}
+						sb.WriteString(strings.Join(refs, " "))
+					} else {
+						sb.WriteString(`"` + ref + `"`)
+					}
+				}
+				i += m[1]
+				continue
+			}
+			// Not a parameter: an environment variable, for the shell
+		}
+		c := template[i]
+		switch {
+		case c == '\\' && state != singleQuoted && i+1 < len(template):
+			sb.WriteString(template[i : i+2])
+			i += 2
+			continue
+		case c == '\'' && state == unquoted:
+			state = singleQuoted
+		case c == '\'' && state == singleQuoted:
+			state = unquoted
+		case c == '"' && state == unquoted:
+			state = doubleQuoted
+		case c == '"' && state == doubleQuoted:
+			state = unquoted
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return sb.String(), env, nil
+}
+
+// argVar is the environment variable passing a parameter's value
+func argVar(name string) string {
+	return "IGENT_ARG_" + name
+}
+
+// sortedParamNames returns the names of the parameters, sorted
+func sortedParamNames(params map[string]CustomParam) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// argWords formats an argument as text; arrays give one word per element
+func argWords(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return []string{""}
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []interface{}:
+		words := make([]string, len(v))
+		for i, e := range v {
+			words[i] = strings.Join(argWords(e), " ")
+		}
+		return words
+	case bool, int, int64:
+		return []string{fmt.Sprint(v)}
+	}
+	data, _ := json.Marshal(v)
+	return []string{string(data)}
+}
+
+// runCustomTool runs an expanded command with sh -c, with the arguments in
+// env, and returns its output
+func runCustomTool(ctx context.Context, name, command string, env []string, timeout int) (string, error) {
+	if lim, ok := limitsFromContext(ctx); ok && lim.Timeout > 0 {
+		timeout = lim.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	shell := "/bin/sh"
+	if _, err := os.Stat(shell); os.IsNotExist(err) {
+		shell = "sh"
+	}
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	if id, turn := ConversationFromContext(ctx); id != "" {
+		cmd.Env = append(cmd.Env, "IGENT_CONVERSATION="+id, fmt.Sprintf("IGENT_TURN=%d", turn))
+	}
+	cmd.WaitDelay = time.Second
+	killProcessGroup(cmd)
+
+	output, err := cmd.CombinedOutput()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return "", fmt.Errorf("%s timed out after %d seconds", name, timeout)
+	case context.Canceled:
+		return "", fmt.Errorf("%s cancelled", name)
+	}
+	result := truncateOutput(ctx, strings.TrimSpace(string(output)), customMaxOutput)
+	if err != nil {
+		return result, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return result, nil
+}
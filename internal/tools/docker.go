@@ -0,0 +1,216 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerDefaultLogLines is the number of log lines docker_logs shows by default
+	dockerDefaultLogLines = 100
+
+	// dockerDefaultTimeout and dockerMaxTimeout bound docker_exec, in seconds
+	dockerDefaultTimeout = 30
+	dockerMaxTimeout     = 120
+
+	// dockerMaxOutput caps the output of docker_exec
+	dockerMaxOutput = 15000
+)
+
+// registerDockerTools registers the Docker tools. Listing containers and
+// reading logs run without confirmation; docker_exec always asks.
+func (r *Registry) registerDockerTools() {
+	containerParam := map[string]interface{}{
+		"type":        "string",
+		"description": "Container name or ID",
+	}
+
+	// docker_ps - List containers
+	r.Register(&Tool{
+		Name:        "docker_ps",
+		Description: "List Docker containers with their ID, name, image, status and ports.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"all": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Include stopped containers (default: false)",
+				},
+				"filter": map[string]interface{}{
+					"type":        "string",
+					"description": "docker ps filter, e.g. name=web or status=exited",
+				},
+			},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			dockerArgs := []string{"ps", "--format", "table {{.ID}}\t{{.Names}}\t{{.Image}}\t{{.Status}}\t{{.Ports}}"}
+			if getBool(args, "all", false) {
+				dockerArgs = append(dockerArgs, "--all")
+			}
+			if filter, ok := args["filter"].(string); ok && filter != "" {
+				dockerArgs = append(dockerArgs, "--filter", filter)
+			}
+			out, err := runDocker(ctx, dockerArgs...)
+			if err != nil {
+				return "", err
+			}
+			if !strings.Contains(out, "\n") {
+				out += "\n(no containers)"
+			}
+			return out, nil
+		},
+	})
+	r.markSafe("docker_ps")
+
+	// docker_logs - Show container logs
+	r.Register(&Tool{
+		Name:        "docker_logs",
+		Description: "Show the most recent log lines (stdout and stderr) of a Docker container.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"container": containerParam,
+				"tail": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of lines from the end (default: %d)", dockerDefaultLogLines),
+				},
+				"since": map[string]interface{}{
+					"type":        "string",
+					"description": "Only logs newer than this, e.g. 10m, 2h or an RFC 3339 timestamp",
+				},
+				"timestamps": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Prefix lines with timestamps (default: false)",
+				},
+			},
+			"required": []string{"container"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			container, err := dockerContainer(args)
+			if err != nil {
+				return "", err
+			}
+			tail := getInt(args, "tail", dockerDefaultLogLines)
+			if tail <= 0 {
+				tail = dockerDefaultLogLines
+			}
+			dockerArgs := []string{"logs", "--tail", strconv.Itoa(tail)}
+			if since, ok := args["since"].(string); ok && since != "" {
+				dockerArgs = append(dockerArgs, "--since", since)
+			}
+			if getBool(args, "timestamps", false) {
+				dockerArgs = append(dockerArgs, "--timestamps")
+			}
+			out, err := runDocker(ctx, append(dockerArgs, "--", container)...)
+			if err != nil {
+				return "", err
+			}
+			if out == "" {
+				return "(no log output)", nil
+			}
+			return out, nil
+		},
+	})
+	r.markSafe("docker_logs")
+
+	// docker_exec - Run a command in a container
+	r.Register(&Tool{
+		Name: "docker_exec",
+		Description: "Run a shell command inside a running Docker container (via sh -c). " +
+			"Returns the combined output.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"container": containerParam,
+				"command": map[string]interface{}{
+					"type":        "string",
+					"description": "Shell command to run in the container",
+				},
+				"user": map[string]interface{}{
+					"type":        "string",
+					"description": "User to run as (default: the container's user)",
+				},
+				"workdir": map[string]interface{}{
+					"type":        "string",
+					"description": "Working directory inside the container",
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Timeout in seconds (default: %d, max: %d)", dockerDefaultTimeout, dockerMaxTimeout),
+				},
+			},
+			"required": []string{"container", "command"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			container, err := dockerContainer(args)
+			if err != nil {
+				return "", err
+			}
+			command, ok := args["command"].(string)
+			if !ok || command == "" {
+				return "", fmt.Errorf("command is required")
+			}
+
+			timeout := callTimeout(ctx, args, dockerDefaultTimeout, dockerMaxTimeout)
+
+			dockerArgs := []string{"exec", "-i"}
+			if user, ok := args["user"].(string); ok && user != "" {
+				dockerArgs = append(dockerArgs, "--user", user)
+			}
+			if workdir, ok := args["workdir"].(string); ok && workdir != "" {
+				dockerArgs = append(dockerArgs, "--workdir", workdir)
+			}
+			dockerArgs = append(dockerArgs, "--", container, "sh", "-c", command)
+
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+
+			cmd := exec.CommandContext(ctx, "docker", dockerArgs...)
+			cmd.Env = os.Environ()
+			cmd.WaitDelay = time.Second
+			killProcessGroup(cmd)
+
+			output, err := cmd.CombinedOutput()
+			switch ctx.Err() {
+			case context.DeadlineExceeded:
+				return "", fmt.Errorf("command timed out after %d seconds", timeout)
+			case context.Canceled:
+				return "", fmt.Errorf("command cancelled")
+			}
+			if err != nil {
+				return string(output), fmt.Errorf("command failed: %w", err)
+			}
+
+			return truncateOutput(ctx, strings.TrimSpace(string(output)), dockerMaxOutput), nil
+		},
+	})
+}
+
+// dockerContainer returns the validated container argument
+func dockerContainer(args map[string]interface{}) (string, error) {
+	container, ok := args["container"].(string)
+	if !ok || container == "" {
+		return "", fmt.Errorf("container is required")
+	}
+	if strings.HasPrefix(container, "-") {
+		return "", fmt.Errorf("invalid container: %s", container)
+	}
+	return container, nil
+}
+
+// runDocker runs a docker command, reporting docker's own message on failure
+func runDocker(ctx context.Context, dockerArgs ...string) (string, error) {
+	out, err := runCommandContext(ctx, "docker", dockerArgs...)
+	if err != nil {
+		if msg := strings.TrimSpace(out); msg != "" {
+			return "", fmt.Errorf("%s: %w", msg, err)
+		}
+		return "", err
+	}
+	return out, nil
+}
@@ -0,0 +1,262 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/textdiff"
+)
+
+// registerDocumentTools registers the working document (canvas) tools.
+// Each conversation has at most one document; edits return a diff instead
+// of the full text so long drafts are not re-emitted every turn.
+func (r *Registry) registerDocumentTools() {
+	if r.store == nil {
+		return
+	}
+
+	// document_read - Read the working document
+	r.Register(&Tool{
+		Name:        "document_read",
+		Description: "Read the working document of this conversation. Use before editing if you are unsure of its current content.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			doc, err := r.loadDocument(ctx)
+			if err != nil {
+				return "", err
+			}
+			if doc.Version == 0 {
+				return "No working document yet. Create one with document_write.", nil
+			}
+			header := fmt.Sprintf("Working document (version %d", doc.Version)
+			if doc.Title != "" {
+				header += ", " + doc.Title
+			}
+			return header + "):\n\n" + doc.Content, nil
+		},
+	})
+	r.markSafe("document_read")
+
+	// document_write - Create or replace the working document
+	r.Register(&Tool{
+		Name:        "document_write",
+		Description: "Create the working document or replace its entire content. Prefer document_append or document_replace_section for edits.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "The full document content (markdown)",
+				},
+				"title": map[string]interface{}{
+					"type":        "string",
+					"description": "Document title (optional)",
+				},
+			},
+			"required": []string{"content"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			content, ok := args["content"].(string)
+			if !ok {
+				return "", fmt.Errorf("content is required")
+			}
+			return r.editDocument(ctx, func(doc *storage.Document) error {
+				if title, ok := args["title"].(string); ok && title != "" {
+					doc.Title = title
+				}
+				doc.Content = content
+				return nil
+			})
+		},
+	})
+	r.markSafe("document_write")
+
+	// document_append - Append to the working document
+	r.Register(&Tool{
+		Name:        "document_append",
+		Description: "Append text to the end of the working document.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to append",
+				},
+			},
+			"required": []string{"content"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			content, ok := args["content"].(string)
+			if !ok || content == "" {
+				return "", fmt.Errorf("content is required")
+			}
+			return r.editDocument(ctx, func(doc *storage.Document) error {
+				if doc.Content != "" && !strings.HasSuffix(doc.Content, "\n") {
+					doc.Content += "\n"
+				}
+				doc.Content += content
+				return nil
+			})
+		},
+	})
+	r.markSafe("document_append")
+
+	// document_replace_section - Replace the body of a markdown section
+	r.Register(&Tool{
+		Name:        "document_replace_section",
+		Description: "Replace the body of a markdown section of the working document, identified by its heading text. The section runs until the next heading of the same or higher level. A missing section is appended.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"heading": map[string]interface{}{
+					"type":        "string",
+					"description": "Heading text without the leading #, e.g. Introduction",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "New section body (the heading line is kept)",
+				},
+			},
+			"required": []string{"heading", "content"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			heading, ok := args["heading"].(string)
+			if !ok || heading == "" {
+				return "", fmt.Errorf("heading is required")
+			}
+			content, _ := args["content"].(string)
+			return r.editDocument(ctx, func(doc *storage.Document) error {
+				doc.Content = replaceSection(doc.Content, heading, content)
+				return nil
+			})
+		},
+	})
+	r.markSafe("document_replace_section")
+
+	// document_diff - Show the last change
+	r.Register(&Tool{
+		Name:        "document_diff",
+		Description: "Show a unified diff of the last change to the working document.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			doc, err := r.loadDocument(ctx)
+			if err != nil {
+				return "", err
+			}
+			diff := textdiff.Unified("previous", "current", doc.Previous, doc.Content, 3)
+			if diff == "" {
+				return "No changes.", nil
+			}
+			return diff, nil
+		},
+	})
+	r.markSafe("document_diff")
+}
+
+// loadDocument returns the document of the conversation in ctx, or an
+// empty one if none exists yet
+func (r *Registry) loadDocument(ctx context.Context) (*storage.Document, error) {
+	convID, _ := ConversationFromContext(ctx)
+	if convID == "" {
+		return nil, fmt.Errorf("no active conversation")
+	}
+
+	doc, err := r.storage().LoadDocument(convID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return &storage.Document{ConversationID: convID}, nil
+	}
+	return doc, err
+}
+
+// editDocument applies an edit, saves a new version and returns its diff
+func (r *Registry) editDocument(ctx context.Context, edit func(doc *storage.Document) error) (string, error) {
+	doc, err := r.loadDocument(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	before := doc.Content
+	if err := edit(doc); err != nil {
+		return "", err
+	}
+	if doc.Content == before && doc.Version > 0 {
+		return "No changes.", nil
+	}
+
+	doc.Previous = before
+	doc.Version++
+	if err := r.storage().SaveDocument(doc); err != nil {
+		return "", fmt.Errorf("failed to save document: %w", err)
+	}
+
+	diff := textdiff.Unified("previous", "current", before, doc.Content, 2)
+	return fmt.Sprintf("Document updated to version %d.\n%s", doc.Version, diff), nil
+}
+
+// replaceSection replaces the body under a markdown heading, appending a
+// new section if the heading does not exist
+func replaceSection(content, heading, body string) string {
+	lines := strings.Split(content, "\n")
+	start, level := -1, 0
+	for i, line := range lines {
+		l, text := parseHeading(line)
+		if l > 0 && strings.EqualFold(text, strings.TrimSpace(heading)) {
+			start, level = i, l
+			break
+		}
+	}
+
+	body = strings.TrimRight(body, "\n")
+	if start < 0 {
+		section := "## " + strings.TrimSpace(heading) + "\n\n" + body + "\n"
+		if strings.TrimSpace(content) == "" {
+			return section
+		}
+		return strings.TrimRight(content, "\n") + "\n\n" + section
+	}
+
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if l, _ := parseHeading(lines[i]); l > 0 && l <= level {
+			end = i
+			break
+		}
+	}
+
+	replacement := []string{lines[start], ""}
+	if body != "" {
+		replacement = append(replacement, strings.Split(body, "\n")...)
+	}
+	if end < len(lines) {
+		replacement = append(replacement, "")
+	}
+
+	result := append(append(append([]string(nil), lines[:start]...), replacement...), lines[end:]...)
+	joined := strings.Join(result, "\n")
+	if strings.HasSuffix(content, "\n") && !strings.HasSuffix(joined, "\n") {
+		joined += "\n"
+	}
+	return joined
+}
+
+// parseHeading returns the level and text of a markdown ATX heading
+func parseHeading(line string) (int, string) {
+	trimmed := strings.TrimSpace(line)
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(trimmed) && trimmed[level] != ' ') {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+}
@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/igm/igent/internal/textdiff"
+)
+
+// registerEditTools registers the file editing tools
+func (r *Registry) registerEditTools() {
+	// edit_file - Apply a search/replace edit or a unified diff to a file
+	r.Register(&Tool{
+		Name: "edit_file",
+		Description: "Edit a file by replacing old_string with new_string, or by applying a unified diff in patch. " +
+			"old_string must match exactly once unless replace_all is set. With an empty old_string and a missing file, " +
+			"the file is created with new_string. The file is written atomically and the resulting diff is returned.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the file to edit",
+				},
+				"old_string": map[string]interface{}{
+					"type":        "string",
+					"description": "Exact text to replace, including indentation",
+				},
+				"new_string": map[string]interface{}{
+					"type":        "string",
+					"description": "Replacement text",
+				},
+				"replace_all": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Replace every occurrence of old_string (default: false)",
+				},
+				"patch": map[string]interface{}{
+					"type":        "string",
+					"description": "Unified diff to apply instead of old_string/new_string",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			path, ok := args["path"].(string)
+			if !ok || path == "" {
+				return "", fmt.Errorf("path is required")
+			}
+			oldString, _ := args["old_string"].(string)
+			newString, hasNew := args["new_string"].(string)
+			patch, _ := args["patch"].(string)
+
+			if patch != "" && (oldString != "" || hasNew) {
+				return "", fmt.Errorf("use either patch or old_string/new_string, not both")
+			}
+			if patch == "" && !hasNew {
+				return "", fmt.Errorf("either patch or new_string is required")
+			}
+
+			original, err := os.ReadFile(path)
+			exists := err == nil
+			if err != nil && !(os.IsNotExist(err) && patch == "" && oldString == "") {
+				return "", fmt.Errorf("reading file: %w", err)
+			}
+
+			var updated string
+			switch {
+			case patch != "":
+				updated, err = textdiff.Apply(string(original), patch)
+				if err != nil {
+					return "", fmt.Errorf("applying patch: %w", err)
+				}
+			case !exists:
+				updated = newString
+			case oldString == "":
+				return "", fmt.Errorf("old_string is required to edit an existing file")
+			default:
+				updated, err = replaceString(string(original), oldString, newString, getBool(args, "replace_all", false))
+				if err != nil {
+					return "", err
+				}
+			}
+
+			if exists && updated == string(original) {
+				return "No changes.", nil
+			}
+
+			if err := writeFileAtomic(path, []byte(updated)); err != nil {
+				return "", err
+			}
+
+			name := filepath.ToSlash(path)
+			diff := textdiff.Unified("a/"+name, "b/"+name, string(original), updated, 3)
+			if !exists {
+				return fmt.Sprintf("Created %s\n%s", path, diff), nil
+			}
+			return fmt.Sprintf("Edited %s\n%s", path, diff), nil
+		},
+	})
+}
+
+// replaceString replaces old with new, requiring a unique match unless all is set
+func replaceString(text, old, new string, all bool) (string, error) {
+	count := strings.Count(text, old)
+	switch {
+	case count == 0:
+		return "", fmt.Errorf("old_string not found in file")
+	case count > 1 && !all:
+		return "", fmt.Errorf("old_string matches %d times; add surrounding context to make it unique or set replace_all", count)
+	case all:
+		return strings.ReplaceAll(text, old, new), nil
+	default:
+		return strings.Replace(text, old, new, 1), nil
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, keeping the original file mode
+func writeFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing file: %w", err)
+	}
+	return nil
+}
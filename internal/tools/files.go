@@ -0,0 +1,314 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// registerFileTools registers the file management tools. make_dir never
+// destroys data, so it runs without confirmation; copy, move and remove ask
+// first. copy refuses to overwrite but can still put a file anywhere, such
+// as a secret into a shared directory.
+func (r *Registry) registerFileTools() {
+	// make_dir - Create a directory
+	r.Register(&Tool{
+		Name:        "make_dir",
+		Description: "Create a directory, including missing parent directories. Succeeds if it already exists.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Directory to create",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			path, err := pathArg(args, "path")
+			if err != nil {
+				return "", err
+			}
+			if info, err := os.Stat(path); err == nil {
+				if !info.IsDir() {
+					return "", fmt.Errorf("%s exists and is not a directory", path)
+				}
+				return fmt.Sprintf("%s already exists", path), nil
+			}
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Created directory %s", path), nil
+		},
+	})
+	r.markSafe("make_dir")
+
+	// remove - Delete a file or directory
+	r.Register(&Tool{
+		Name:        "remove",
+		Description: "Delete a file, symlink or directory. Non-empty directories need recursive.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "File or directory to delete",
+				},
+				"recursive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Delete a non-empty directory with all its contents (default: false)",
+				},
+			},
+			"required": []string{"path"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			path, err := pathArg(args, "path")
+			if err != nil {
+				return "", err
+			}
+			if err := checkRemovable(path); err != nil {
+				return "", err
+			}
+			info, err := os.Lstat(path)
+			if err != nil {
+				return "", err
+			}
+			if !info.IsDir() {
+				if err := os.Remove(path); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("Removed %s", path), nil
+			}
+
+			if !getBool(args, "recursive", false) {
+				if err := os.Remove(path); err != nil {
+					if isNotEmpty(err) {
+						return "", fmt.Errorf("%s is a non-empty directory; set recursive to delete its contents", path)
+					}
+					return "", err
+				}
+				return fmt.Sprintf("Removed empty directory %s", path), nil
+			}
+			files := countFiles(path)
+			if err := os.RemoveAll(path); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Removed %s (%d files)", path, files), nil
+		},
+	})
+
+	// move - Move or rename a file or directory
+	r.Register(&Tool{
+		Name: "move",
+		Description: "Move or rename a file or directory. If destination is an existing directory, source is moved into it. " +
+			"An existing destination file is only replaced with overwrite.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"source": map[string]interface{}{
+					"type":        "string",
+					"description": "File or directory to move",
+				},
+				"destination": map[string]interface{}{
+					"type":        "string",
+					"description": "New path, or an existing directory to move into",
+				},
+				"overwrite": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Replace an existing destination file (default: false)",
+				},
+			},
+			"required": []string{"source", "destination"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			src, dst, err := transferPaths(args, getBool(args, "overwrite", false))
+			if err != nil {
+				return "", err
+			}
+			if err := checkRemovable(src); err != nil {
+				return "", err
+			}
+			err = os.Rename(src, dst)
+			if errors.Is(err, syscall.EXDEV) {
+				// Across file systems: copy, then delete the source
+				if err = copyTree(src, dst); err == nil {
+					err = os.RemoveAll(src)
+				}
+			}
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Moved %s to %s", src, dst), nil
+		},
+	})
+
+	// copy - Copy a file or directory
+	r.Register(&Tool{
+		Name: "copy",
+		Description: "Copy a file or directory (recursively, keeping file modes and symlinks). If destination is an " +
+			"existing directory, source is copied into it. Never overwrites an existing file.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"source": map[string]interface{}{
+					"type":        "string",
+					"description": "File or directory to copy",
+				},
+				"destination": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the copy, or an existing directory to copy into",
+				},
+			},
+			"required": []string{"source", "destination"},
+		},
+		Executor: func(args map[string]interface{}) (string, error) {
+			src, dst, err := transferPaths(args, false)
+			if err != nil {
+				return "", err
+			}
+			if rel, err := filepath.Rel(src, dst); err == nil && filepath.IsLocal(rel) {
+				return "", fmt.Errorf("cannot copy %s into itself", src)
+			}
+			if err := copyTree(src, dst); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Copied %s to %s (%d files)", src, dst, countFiles(dst)), nil
+		},
+	})
+}
+
+// pathArg returns a required path argument, with ~ expanded
+func pathArg(args map[string]interface{}, key string) (string, error) {
+	path, ok := args[key].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("%s is required", key)
+	}
+	return filepath.Clean(expandTilde(path)), nil
+}
+
+// transferPaths resolves the source and destination of move and copy: a
+// destination that is an existing directory receives the source by name,
+// and an existing destination is refused unless overwrite is set
+func transferPaths(args map[string]interface{}, overwrite bool) (string, string, error) {
+	src, err := pathArg(args, "source")
+	if err != nil {
+		return "", "", err
+	}
+	dst, err := pathArg(args, "destination")
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Lstat(src); err != nil {
+		return "", "", err
+	}
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+	if info, err := os.Lstat(dst); err == nil {
+		if !overwrite {
+			return "", "", fmt.Errorf("%s already exists", dst)
+		}
+		if info.IsDir() {
+			return "", "", fmt.Errorf("%s is a directory; remove it first", dst)
+		}
+	}
+	if src == dst {
+		return "", "", fmt.Errorf("source and destination are the same")
+	}
+	return src, dst, nil
+}
+
+// checkRemovable refuses to delete or move the file system root, the home
+// directory or the working directory, mistakes that are never intended
+func checkRemovable(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	protected := []string{filepath.VolumeName(abs) + string(filepath.Separator)}
+	if home, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, home)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		protected = append(protected, wd)
+	}
+	for _, p := range protected {
+		if abs == filepath.Clean(p) {
+			return fmt.Errorf("refusing to remove or move %s", abs)
+		}
+	}
+	return nil
+}
+
+// copyTree copies a file, symlink or directory tree to dst, keeping modes
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.IsDir():
+			return os.Mkdir(target, info.Mode().Perm()|0700)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return fmt.Errorf("cannot copy special file %s", path)
+	})
+}
+
+// copyFile copies one regular file, failing if dst exists
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// countFiles returns the number of non-directory entries under path
+func countFiles(path string) int {
+	n := 0
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// isNotEmpty reports whether err is the error of removing a non-empty directory
+func isNotEmpty(err error) bool {
+	return errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST)
+}
@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// RegisterFunc registers a Go function as a tool. Its arguments are the
+// struct T, whose JSON schema is derived from the fields:
+//
+//	type weatherArgs struct {
+//		City  string `json:"city" desc:"City name"`
+//		Units string `json:"units,omitempty" desc:"Temperature units" enum:"metric,imperial"`
+//		Days  *int   `json:"days" desc:"Forecast days"`
+//	}
+//
+// Field names come from the json tag, descriptions from desc and allowed
+// values from enum (comma-separated). Fields are required unless tagged
+// omitempty or of pointer type. Calls missing a required field or with
+// arguments of the wrong type fail with an error the model can act on,
+// before fn runs.
+func RegisterFunc[T any](r *Registry, name, description string, fn func(context.Context, T) (string, error)) error {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() != reflect.Struct {
+		return fmt.Errorf("tool %s: arguments must be a struct, not %s", name, typ)
+	}
+	schema, err := structSchema(typ, map[reflect.Type]bool{})
+	if err != nil {
+		return fmt.Errorf("tool %s: %w", name, err)
+	}
+	required, _ := schema["required"].([]string)
+
+	return r.Add(&Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  schema,
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			for _, field := range required {
+				if _, ok := args[field]; !ok {
+					return "", fmt.Errorf("%s is required", field)
+				}
+			}
+			// Arguments were decoded from JSON, so they re-encode cleanly
+			data, err := json.Marshal(args)
+			if err != nil {
+				return "", fmt.Errorf("encoding arguments: %w", err)
+			}
+			var v T
+			if err := json.Unmarshal(data, &v); err != nil {
+				return "", fmt.Errorf("invalid arguments: %s", describeDecodeError(err))
+			}
+			return fn(ctx, v)
+		},
+	})
+}
+
+// describeDecodeError rewords JSON type errors in terms of the arguments
+func describeDecodeError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Sprintf("%s must be %s, not %s", typeErr.Field, schemaTypeName(typeErr.Type), typeErr.Value)
+	}
+	return err.Error()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structSchema returns the JSON schema of a struct's exported fields.
+// seen guards against recursive types, which have no finite schema.
+func structSchema(typ reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	if seen[typ] {
+		return nil, fmt.Errorf("recursive type %s", typ)
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if name == "" && f.Anonymous && f.Type.Kind() == reflect.Struct {
+			// Embedded structs are flattened, as encoding/json does
+			embedded, err := structSchema(f.Type, seen)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range embedded["properties"].(map[string]interface{}) {
+				properties[k] = v
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop, err := typeSchema(f.Type, seen)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if desc := f.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = prop
+
+		if f.Type.Kind() != reflect.Pointer && !strings.Contains(","+opts+",", ",omitempty,") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// typeSchema returns the JSON schema of a Go type
+func typeSchema(typ reflect.Type, seen map[reflect.Type]bool) (map[string]interface{}, error) {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		return structSchema(typ, seen)
+	case reflect.Slice, reflect.Array:
+		items, err := typeSchema(typ.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, not %s", typ.Key())
+		}
+		values, err := typeSchema(typ.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil // Any value
+	}
+
+	name := schemaTypeName(typ)
+	if name == "" {
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+	return map[string]interface{}{"type": name}, nil
+}
+
+// schemaTypeName returns the JSON schema type of a scalar Go type, or an
+// empty string if it has none
+func schemaTypeName(typ reflect.Type) string {
+	switch typ.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return ""
+}
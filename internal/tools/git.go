@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gitDefaultLogCount is the number of commits git_log shows by default
+const gitDefaultLogCount = 10
+
+// registerGitTools registers the git tools. Read-only tools run without
+// confirmation; git_commit always asks.
+func (r *Registry) registerGitTools() {
+	repoParam := map[string]interface{}{
+		"type":        "string",
+		"description": "Repository directory (default: current directory)",
+	}
+
+	// git_status - Show working tree status
+	r.Register(&Tool{
+		Name:        "git_status",
+		Description: "Show the branch and the staged, unstaged and untracked files of a git repository.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"repo": repoParam,
+			},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			out, err := runGit(ctx, args, "status", "--short", "--branch")
+			if err != nil {
+				return "", err
+			}
+			if !strings.Contains(out, "\n") {
+				out += "\n(clean working tree)"
+			}
+			return out, nil
+		},
+	})
+	r.markSafe("git_status")
+
+	// git_diff - Show changes
+	r.Register(&Tool{
+		Name:        "git_diff",
+		Description: "Show a unified diff of unstaged changes, staged changes, or against a commit.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"repo": repoParam,
+				"staged": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Show staged changes instead of unstaged ones (default: false)",
+				},
+				"commit": map[string]interface{}{
+					"type":        "string",
+					"description": "Compare against this commit or branch instead, e.g. HEAD~1 or main",
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Limit the diff to this file or directory",
+				},
+			},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			gitArgs := []string{"diff"}
+			if getBool(args, "staged", false) {
+				gitArgs = append(gitArgs, "--staged")
+			}
+			if commit, ok := args["commit"].(string); ok && commit != "" {
+				if strings.HasPrefix(commit, "-") {
+					return "", fmt.Errorf("invalid commit: %s", commit)
+				}
+				gitArgs = append(gitArgs, commit)
+			}
+			gitArgs = append(gitArgs, "--")
+			if path, ok := args["path"].(string); ok && path != "" {
+				gitArgs = append(gitArgs, path)
+			}
+
+			out, err := runGit(ctx, args, gitArgs...)
+			if err != nil {
+				return "", err
+			}
+			if out == "" {
+				return "No changes.", nil
+			}
+			return out, nil
+		},
+	})
+	r.markSafe("git_diff")
+
+	// git_log - Show recent commits
+	r.Register(&Tool{
+		Name:        "git_log",
+		Description: "Show recent commits (hash, date, author, subject), optionally for one path.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"repo": repoParam,
+				"count": map[string]interface{}{
+					"type":        "integer",
+					"description": "Number of commits to show (default: 10)",
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Only show commits touching this file or directory",
+				},
+			},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			count := getInt(args, "count", gitDefaultLogCount)
+			if count <= 0 {
+				count = gitDefaultLogCount
+			}
+
+			gitArgs := []string{"log", "-n", strconv.Itoa(count), "--date=short", "--format=%h %ad %an: %s", "--"}
+			if path, ok := args["path"].(string); ok && path != "" {
+				gitArgs = append(gitArgs, path)
+			}
+			return runGit(ctx, args, gitArgs...)
+		},
+	})
+	r.markSafe("git_log")
+
+	// git_commit - Commit changes (requires confirmation)
+	r.Register(&Tool{
+		Name: "git_commit",
+		Description: "Commit changes to a git repository. Stages the given files (or all changes with all=true) " +
+			"before committing; with neither, commits what is already staged.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"repo": repoParam,
+				"message": map[string]interface{}{
+					"type":        "string",
+					"description": "Commit message",
+				},
+				"files": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Files to stage before committing",
+				},
+				"all": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Stage all changes, including untracked files (default: false)",
+				},
+			},
+			"required": []string{"message"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			message, ok := args["message"].(string)
+			if !ok || strings.TrimSpace(message) == "" {
+				return "", fmt.Errorf("message is required")
+			}
+
+			var files []string
+			if list, ok := args["files"].([]interface{}); ok {
+				for _, f := range list {
+					if s, ok := f.(string); ok && s != "" {
+						files = append(files, s)
+					}
+				}
+			}
+
+			switch {
+			case getBool(args, "all", false):
+				if _, err := runGit(ctx, args, "add", "--all"); err != nil {
+					return "", err
+				}
+			case len(files) > 0:
+				if _, err := runGit(ctx, args, append([]string{"add", "--"}, files...)...); err != nil {
+					return "", err
+				}
+			}
+
+			return runGit(ctx, args, "commit", "-m", message)
+		},
+	})
+}
+
+// runGit runs git in the repository given by the repo argument. Failures
+// carry git's output so the model can see what went wrong.
+func runGit(ctx context.Context, args map[string]interface{}, gitArgs ...string) (string, error) {
+	cmdArgs := []string{"--no-pager"}
+	if repo, ok := args["repo"].(string); ok && repo != "" {
+		cmdArgs = append(cmdArgs, "-C", repo)
+	}
+
+	out, err := runCommandContext(ctx, "git", append(cmdArgs, gitArgs...)...)
+	if err != nil {
+		if msg := strings.TrimSpace(out); msg != "" {
+			return "", fmt.Errorf("%s: %w", msg, err)
+		}
+		return "", err
+	}
+	return out, nil
+}
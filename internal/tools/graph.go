@@ -0,0 +1,314 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/igm/igent/internal/storage"
+)
+
+// maxEntityName caps entity names so their files stay within name limits
+const maxEntityName = 100
+
+// registerGraphTools registers memory_graph, which maintains the entity
+// memory: people, projects, systems and how they relate
+func (r *Registry) registerGraphTools() {
+	if r.store == nil {
+		return
+	}
+
+	r.Register(&Tool{
+		Name: "memory_graph",
+		Description: "Maintain the entity memory: people, projects, systems and other things the user mentions, " +
+			"with attributes and relations between them. Entities named in a message are recalled automatically. " +
+			"Actions: upsert (create or update an entity), relate/unrelate (add or remove a relation from name to target), " +
+			"get (an entity with its relations), list, delete.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"action": map[string]interface{}{
+					"type":        "string",
+					"description": "What to do",
+					"enum":        []string{"upsert", "relate", "unrelate", "get", "list", "delete"},
+				},
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "Entity name (or alias), e.g. Alice or Project Atlas",
+				},
+				"type": map[string]interface{}{
+					"type":        "string",
+					"description": "Entity type for upsert, e.g. person, project, system; filters list",
+				},
+				"aliases": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Other names the entity is mentioned by (upsert)",
+				},
+				"attributes": map[string]interface{}{
+					"type":        "object",
+					"description": "Attributes to set (upsert), e.g. {\"role\": \"tech lead\"}; an empty value removes one",
+				},
+				"relation": map[string]interface{}{
+					"type":        "string",
+					"description": "Relation type for relate/unrelate, e.g. works_on, owns, depends_on",
+				},
+				"target": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the related entity for relate/unrelate",
+				},
+			},
+			"required": []string{"action"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			action, _ := args["action"].(string)
+			name, _ := args["name"].(string)
+			name = strings.TrimSpace(name)
+			if action != "list" && name == "" {
+				return "", fmt.Errorf("name is required for %s", action)
+			}
+			if len(name) > maxEntityName {
+				return "", fmt.Errorf("name is longer than %d bytes", maxEntityName)
+			}
+
+			switch action {
+			case "upsert":
+				return r.upsertEntity(ctx, name, args)
+			case "relate", "unrelate":
+				return r.relateEntity(ctx, action, name, args)
+			case "get":
+				return r.describeEntity(name)
+			case "list":
+				return r.listEntities(args)
+			case "delete":
+				return r.deleteEntity(name)
+			default:
+				return "", fmt.Errorf("unknown action: %s", action)
+			}
+		},
+	})
+	r.markSafe("memory_graph")
+}
+
+// findEntity loads an entity by name or alias; nil if there is none
+func (r *Registry) findEntity(name string) (*storage.Entity, error) {
+	entity, err := r.storage().LoadEntity(name)
+	if err == nil || !errors.Is(err, storage.ErrNotFound) {
+		return entity, err
+	}
+
+	entities, err := r.storage().ListEntities()
+	if err != nil {
+		return nil, err
+	}
+	key := storage.EntityKey(name)
+	for _, e := range entities {
+		for _, alias := range e.Aliases {
+			if storage.EntityKey(alias) == key {
+				return e, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// loadOrNewEntity finds an entity or starts a new one named name
+func (r *Registry) loadOrNewEntity(name string) (*storage.Entity, bool, error) {
+	entity, err := r.findEntity(name)
+	if err != nil || entity != nil {
+		return entity, false, err
+	}
+	return &storage.Entity{Name: name}, true, nil
+}
+
+func (r *Registry) upsertEntity(ctx context.Context, name string, args map[string]interface{}) (string, error) {
+	entity, created, err := r.loadOrNewEntity(name)
+	if err != nil {
+		return "", err
+	}
+
+	if t, _ := args["type"].(string); strings.TrimSpace(t) != "" {
+		entity.Type = strings.ToLower(strings.TrimSpace(t))
+	}
+	for _, alias := range getStrings(args, "aliases") {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || len(alias) > maxEntityName {
+			continue
+		}
+		known := false
+		for _, n := range entity.Names() {
+			known = known || storage.EntityKey(n) == storage.EntityKey(alias)
+		}
+		if !known {
+			entity.Aliases = append(entity.Aliases, alias)
+		}
+	}
+	if attrs, ok := args["attributes"].(map[string]interface{}); ok {
+		for k, v := range attrs {
+			k = strings.TrimSpace(k)
+			value := strings.TrimSpace(fmt.Sprint(v))
+			if k == "" {
+				continue
+			}
+			if v == nil || value == "" {
+				delete(entity.Attributes, k)
+				continue
+			}
+			if entity.Attributes == nil {
+				entity.Attributes = make(map[string]string)
+			}
+			entity.Attributes[k] = value
+		}
+	}
+
+	convID, _ := ConversationFromContext(ctx)
+	entity.MentionedIn(convID)
+	if err := r.storage().SaveEntity(entity); err != nil {
+		return "", fmt.Errorf("failed to save entity: %w", err)
+	}
+
+	verb := "updated"
+	if created {
+		verb = "created"
+	}
+	return fmt.Sprintf("Entity %s: %s", verb, entity.Describe()), nil
+}
+
+func (r *Registry) relateEntity(ctx context.Context, action, name string, args map[string]interface{}) (string, error) {
+	relation, _ := args["relation"].(string)
+	relation = strings.ToLower(strings.Join(strings.Fields(relation), "_"))
+	target, _ := args["target"].(string)
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", fmt.Errorf("target is required for %s", action)
+	}
+	if len(target) > maxEntityName {
+		return "", fmt.Errorf("target is longer than %d bytes", maxEntityName)
+	}
+
+	if action == "unrelate" {
+		entity, err := r.findEntity(name)
+		if err != nil {
+			return "", err
+		}
+		if entity == nil {
+			return "", fmt.Errorf("entity not found: %s", name)
+		}
+		n := entity.Unrelate(relation, target)
+		if n == 0 {
+			return fmt.Sprintf("%s has no such relation to %s", entity.Name, target), nil
+		}
+		if err := r.storage().SaveEntity(entity); err != nil {
+			return "", fmt.Errorf("failed to save entity: %w", err)
+		}
+		return fmt.Sprintf("Removed %d relation(s): %s", n, entity.Describe()), nil
+	}
+
+	if relation == "" {
+		return "", fmt.Errorf("relation is required for relate")
+	}
+	convID, _ := ConversationFromContext(ctx)
+
+	// Both ends are nodes of the graph, so an unknown target is created too
+	targetEntity, created, err := r.loadOrNewEntity(target)
+	if err != nil {
+		return "", err
+	}
+	if created {
+		targetEntity.MentionedIn(convID)
+		if err := r.storage().SaveEntity(targetEntity); err != nil {
+			return "", fmt.Errorf("failed to save entity: %w", err)
+		}
+	}
+
+	entity, _, err := r.loadOrNewEntity(name)
+	if err != nil {
+		return "", err
+	}
+	entity.Relate(relation, targetEntity.Name)
+	entity.MentionedIn(convID)
+	if err := r.storage().SaveEntity(entity); err != nil {
+		return "", fmt.Errorf("failed to save entity: %w", err)
+	}
+	return "Related: " + entity.Describe(), nil
+}
+
+func (r *Registry) describeEntity(name string) (string, error) {
+	entity, err := r.findEntity(name)
+	if err != nil {
+		return "", err
+	}
+	if entity == nil {
+		return fmt.Sprintf("No entity named %s", name), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(entity.Describe() + "\n")
+
+	entities, err := r.storage().ListEntities()
+	if err != nil {
+		return "", err
+	}
+	key := storage.EntityKey(entity.Name)
+	for _, e := range entities {
+		for _, rel := range e.Relations {
+			if storage.EntityKey(rel.Target) == key {
+				fmt.Fprintf(&sb, "- %s %s %s\n", e.Name, rel.Type, entity.Name)
+			}
+		}
+	}
+	if len(entity.Conversations) > 0 {
+		fmt.Fprintf(&sb, "Recorded in: %s\n", strings.Join(entity.Conversations, ", "))
+	}
+	return sb.String(), nil
+}
+
+func (r *Registry) listEntities(args map[string]interface{}) (string, error) {
+	entities, err := r.storage().ListEntities()
+	if err != nil {
+		return "", err
+	}
+	entityType, _ := args["type"].(string)
+
+	var sb strings.Builder
+	count := 0
+	for _, e := range entities {
+		if entityType != "" && !strings.EqualFold(e.Type, entityType) {
+			continue
+		}
+		sb.WriteString("- " + e.Describe() + "\n")
+		count++
+	}
+	if count == 0 {
+		return "No entities found.", nil
+	}
+	return fmt.Sprintf("Found %d entities:\n%s", count, sb.String()), nil
+}
+
+func (r *Registry) deleteEntity(name string) (string, error) {
+	entity, err := r.findEntity(name)
+	if err != nil {
+		return "", err
+	}
+	if entity == nil {
+		return "", fmt.Errorf("entity not found: %s", name)
+	}
+	if err := r.storage().DeleteEntity(entity.Name); err != nil {
+		return "", err
+	}
+
+	// Drop the relations pointing to it
+	entities, err := r.storage().ListEntities()
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entities {
+		if e.Unrelate("", entity.Name) > 0 {
+			if err := r.storage().SaveEntity(e); err != nil {
+				return "", fmt.Errorf("failed to save entity: %w", err)
+			}
+		}
+	}
+	return fmt.Sprintf("Entity deleted: %s", entity.Name), nil
+}
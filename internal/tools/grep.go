@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// grepDefaultMatches is the default cap on reported matches
+	grepDefaultMatches = 100
+
+	// grepMaxLineLength truncates long matching lines
+	grepMaxLineLength = 300
+
+	// grepMaxOutput caps the total output size
+	grepMaxOutput = 10000
+)
+
+// errGrepLimit stops the walk once enough matches were found
+var errGrepLimit = errors.New("match limit reached")
+
+// grepSkipDirs are version control directories never searched recursively
+var grepSkipDirs = map[string]bool{".git": true, ".hg": true, ".svn": true}
+
+// registerSearchTools registers the file search tools
+func (r *Registry) registerSearchTools() {
+	// grep - Search files for a regular expression
+	r.Register(&Tool{
+		Name: "grep",
+		Description: "Search files for lines matching a regular expression (Go RE2 syntax). " +
+			"Returns matches as path:line:text. Binary files and .git directories are skipped.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Regular expression to search for",
+				},
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "File or directory to search (default: current directory)",
+				},
+				"recursive": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Search subdirectories (default: true)",
+				},
+				"ignore_case": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Case-insensitive matching (default: false)",
+				},
+				"max_matches": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of matches to return (default: 100)",
+				},
+			},
+			"required": []string{"pattern"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			pattern, ok := args["pattern"].(string)
+			if !ok || pattern == "" {
+				return "", fmt.Errorf("pattern is required")
+			}
+			if getBool(args, "ignore_case", false) {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", fmt.Errorf("invalid pattern: %w", err)
+			}
+
+			path := "."
+			if p, ok := args["path"].(string); ok && p != "" {
+				path = p
+			}
+			maxMatches := getInt(args, "max_matches", grepDefaultMatches)
+			if maxMatches <= 0 {
+				maxMatches = grepDefaultMatches
+			}
+
+			return grepPath(ctx, re, path, getBool(args, "recursive", true), maxMatches)
+		},
+	})
+}
+
+// grepPath searches a file or directory and formats the matches
+func grepPath(ctx context.Context, re *regexp.Regexp, root string, recursive bool, maxMatches int) (string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	matches, files := 0, 0
+	search := func(path string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Unreadable files are skipped like grep -s, keeping any matches found
+		n, _ := grepFile(re, path, maxMatches-matches, &out)
+		if n > 0 {
+			files++
+		}
+		matches += n
+		if matches >= maxMatches || out.Len() >= grepMaxOutput {
+			return errGrepLimit
+		}
+		return nil
+	}
+
+	if !info.IsDir() {
+		err = search(root)
+	} else {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && (!recursive || grepSkipDirs[d.Name()]) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			return search(path)
+		})
+	}
+
+	limited := errors.Is(err, errGrepLimit)
+	if err != nil && !limited {
+		return "", err
+	}
+	if matches == 0 {
+		return "No matches found.", nil
+	}
+
+	result := out.String()
+	if len(result) > grepMaxOutput {
+		result = result[:grepMaxOutput]
+	}
+	if limited {
+		result += fmt.Sprintf("\n... (stopped after %d matches; narrow the pattern or path)", matches)
+	} else {
+		result += fmt.Sprintf("\n%d matches in %d files", matches, files)
+	}
+	return result, nil
+}
+
+// grepFile writes up to limit matching lines of a file to out and returns
+// how many were written. Binary files yield no matches.
+func grepFile(re *regexp.Regexp, path string, limit int, out *strings.Builder) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, err := reader.Peek(8000)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return 0, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return 0, nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	n, lineNo := 0, 0
+	for scanner.Scan() && n < limit {
+		lineNo++
+		line := scanner.Text()
+		if !re.MatchString(line) {
+			continue
+		}
+		if len(line) > grepMaxLineLength {
+			line = line[:grepMaxLineLength] + "..."
+		}
+		fmt.Fprintf(out, "%s:%d:%s\n", filepath.ToSlash(path), lineNo, line)
+		n++
+	}
+	return n, scanner.Err()
+}
@@ -0,0 +1,222 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// httpDefaultTimeout is the request timeout in seconds
+	httpDefaultTimeout = 30
+
+	// httpMaxBody caps the response body returned to the model
+	httpMaxBody = 20000
+)
+
+// registerHTTPTool registers the curl tool, implemented with net/http so it
+// works without a curl binary
+func (r *Registry) registerHTTPTool() {
+	// curl - Make HTTP requests
+	r.Register(&Tool{
+		Name: "curl",
+		Description: "Make HTTP requests to URLs. Supports GET, POST, and other methods. " +
+			"Returns the status, response headers and body; JSON bodies are pretty-printed.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"url": map[string]interface{}{
+					"type":        "string",
+					"description": "The URL to request",
+				},
+				"method": map[string]interface{}{
+					"type":        "string",
+					"description": "HTTP method (GET, POST, PUT, DELETE, etc.)",
+					"enum":        []string{"GET", "POST", "PUT", "DELETE", "HEAD", "PATCH"},
+				},
+				"headers": map[string]interface{}{
+					"type":        "object",
+					"description": "HTTP headers as key-value pairs",
+				},
+				"query": map[string]interface{}{
+					"type":        "object",
+					"description": "Query parameters as key-value pairs, added to the URL",
+				},
+				"data": map[string]interface{}{
+					"type":        "string",
+					"description": "Raw request body (for POST, PUT, PATCH)",
+				},
+				"json": map[string]interface{}{
+					"type":        "object",
+					"description": "Request body sent as JSON with Content-Type: application/json (instead of data)",
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": "Request timeout in seconds (default: 30)",
+				},
+				"follow_redirects": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Follow redirects (default: true)",
+				},
+			},
+			"required": []string{"url"},
+		},
+		ContextExecutor: r.httpRequest,
+	})
+}
+
+// httpRequest executes the curl tool
+func (r *Registry) httpRequest(ctx context.Context, args map[string]interface{}) (string, error) {
+	rawURL, ok := args["url"].(string)
+	if !ok || rawURL == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	u, err := parseRequestURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if err := r.networkPolicy().CheckURL(u.String()); err != nil {
+		return "", err
+	}
+
+	if query, ok := args["query"].(map[string]interface{}); ok {
+		q := u.Query()
+		for k, v := range query {
+			q.Set(k, fmt.Sprint(v))
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	method := http.MethodGet
+	if m, ok := args["method"].(string); ok && m != "" {
+		method = strings.ToUpper(m)
+	}
+
+	var body io.Reader
+	contentType := ""
+	if data, ok := args["json"]; ok && data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return "", fmt.Errorf("encoding json body: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+		contentType = "application/json"
+	} else if data, ok := args["data"].(string); ok && data != "" {
+		body = strings.NewReader(data)
+		// curl -d defaults to a form body
+		contentType = "application/x-www-form-urlencoded"
+	}
+	if body != nil && method == http.MethodGet {
+		method = http.MethodPost
+	}
+
+	timeout := callTimeout(ctx, args, httpDefaultTimeout, 0)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", "igent")
+	if headers, ok := args["headers"].(map[string]interface{}); ok {
+		for k, v := range headers {
+			if vs, ok := v.(string); ok {
+				req.Header.Set(k, vs)
+			}
+		}
+	}
+
+	// The policy transport rechecks every hop, so redirects cannot leave
+	// the allowlist, and adds the host's client certificate
+	client := &http.Client{
+		Transport: r.networkPolicy().Transport("curl", http.DefaultTransport.(*http.Transport).Clone()),
+	}
+	if !getBool(args, "follow_redirects", true) {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, httpMaxBody+1))
+	if err != nil {
+		return "", fmt.Errorf("reading response: %w", err)
+	}
+	return formatHTTPResponse(resp, respBody), nil
+}
+
+// parseRequestURL parses a URL, treating bare hosts such as example.com/path
+// as http URLs like curl does
+func parseRequestURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q (only http and https)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("parsing URL: no host in %q", rawURL)
+	}
+	return u, nil
+}
+
+// formatHTTPResponse renders the status, headers and body as text
+func formatHTTPResponse(resp *http.Response, body []byte) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Status: %s\n", resp.Status)
+	if resp.Request != nil && resp.Request.URL != nil {
+		fmt.Fprintf(&sb, "URL: %s\n", resp.Request.URL)
+	}
+
+	sb.WriteString("Headers:\n")
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range resp.Header[name] {
+			fmt.Fprintf(&sb, "  %s: %s\n", name, v)
+		}
+	}
+
+	truncated := len(body) > httpMaxBody
+	if truncated {
+		body = body[:httpMaxBody]
+	}
+	if len(body) == 0 {
+		sb.WriteString("Body: (empty)\n")
+		return sb.String()
+	}
+
+	sb.WriteString("Body:\n")
+	var pretty bytes.Buffer
+	if !truncated && strings.Contains(resp.Header.Get("Content-Type"), "json") && json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	sb.Write(body)
+	if truncated {
+		sb.WriteString("\n... (body truncated)")
+	}
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ToolLimits overrides the built-in timeout and output size of one tool.
+// Zero fields keep the tool's defaults.
+type ToolLimits struct {
+	Timeout    int // Default timeout in seconds
+	MaxTimeout int // Longest timeout a call may request, for tools with a timeout argument
+	MaxOutput  int // Output cap in bytes
+}
+
+// truncatedNote marks output cut at the size limit
+const truncatedNote = "\n... (output truncated)"
+
+// limitsKey is the context key for the limits of the running tool
+type limitsKey struct{}
+
+// SetLimits configures per-tool limits, keyed by tool name
+func (r *Registry) SetLimits(limits map[string]ToolLimits) error {
+	for name, lim := range limits {
+		if lim.Timeout < 0 || lim.MaxTimeout < 0 || lim.MaxOutput < 0 {
+			return fmt.Errorf("negative limit for tool %s", name)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range limits {
+		if _, ok := r.tools[name]; !ok {
+			r.log.Warn("limits configured for unknown tool", "name", name)
+		}
+	}
+	r.limits = limits
+	return nil
+}
+
+// limitsFromContext returns the configured limits of the running tool
+func limitsFromContext(ctx context.Context) (ToolLimits, bool) {
+	lim, ok := ctx.Value(limitsKey{}).(ToolLimits)
+	return lim, ok
+}
+
+// callTimeout returns the timeout in seconds of a call to a tool with a
+// timeout argument: the requested value, else the default, capped at max
+// (0 = uncapped). Configured limits replace def and max.
+func callTimeout(ctx context.Context, args map[string]interface{}, def, max int) int {
+	if lim, ok := limitsFromContext(ctx); ok {
+		if lim.Timeout > 0 {
+			def = lim.Timeout
+			if max > 0 && max < def {
+				max = def
+			}
+		}
+		if lim.MaxTimeout > 0 {
+			max = lim.MaxTimeout
+		}
+	}
+	timeout := getInt(args, "timeout", def)
+	if timeout <= 0 {
+		timeout = def
+	}
+	if max > 0 && timeout > max {
+		timeout = max
+	}
+	return timeout
+}
+
+// truncateOutput caps output at def bytes. With a configured output limit
+// the output is returned whole, since Execute applies that limit.
+func truncateOutput(ctx context.Context, output string, def int) string {
+	if lim, ok := limitsFromContext(ctx); ok && lim.MaxOutput > 0 {
+		return output
+	}
+	if len(output) > def {
+		return output[:def] + truncatedNote
+	}
+	return output
+}
+
+// hasTimeoutArg reports whether a tool takes a timeout argument and so
+// enforces its own deadline
+func hasTimeoutArg(tool *Tool) bool {
+	props, _ := tool.Parameters["properties"].(map[string]interface{})
+	_, ok := props["timeout"]
+	return ok
+}
+
+// runWithLimits executes a tool under its configured limits: a deadline for
+// tools without a timeout argument, and the output cap
+func (r *Registry) runWithLimits(ctx context.Context, tool *Tool, args map[string]interface{}) (string, error) {
+	r.mu.RLock()
+	lim, ok := r.limits[tool.Name]
+	r.mu.RUnlock()
+	if !ok {
+		return r.run(ctx, tool, args)
+	}
+	ctx = context.WithValue(ctx, limitsKey{}, lim)
+
+	var output string
+	var err error
+	if lim.Timeout > 0 && !hasTimeoutArg(tool) {
+		runCtx, cancel := context.WithTimeout(ctx, time.Duration(lim.Timeout)*time.Second)
+		defer cancel()
+		output, err = r.run(runCtx, tool, args)
+		if runCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			return "", fmt.Errorf("%s timed out after %d seconds", tool.Name, lim.Timeout)
+		}
+	} else {
+		output, err = r.run(ctx, tool, args)
+	}
+
+	if lim.MaxOutput > 0 && len(output) > lim.MaxOutput {
+		output = output[:lim.MaxOutput] + truncatedNote
+	}
+	return output, err
+}
+
+// run calls a tool's executor. Executors without a context cannot be
+// interrupted; when ctx ends first their result is abandoned.
+func (r *Registry) run(ctx context.Context, tool *Tool, args map[string]interface{}) (string, error) {
+	if tool.ContextExecutor != nil {
+		return tool.ContextExecutor(ctx, args)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return tool.Executor(args)
+	}
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := tool.Executor(args)
+		done <- result{output, err}
+	}()
+	select {
+	case res := <-done:
+		return res.output, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// NamespaceSeparator joins a namespace and a tool name, as in
+// mcp.github.search_issues. Tools from plugins and the config may declare a
+// namespace so their names don't collide with each other or built-in tools.
+const NamespaceSeparator = "."
+
+// wireSeparator replaces NamespaceSeparator in the names sent to providers,
+// which only accept [a-zA-Z0-9_-] in function names
+const wireSeparator = "__"
+
+// ErrToolExists is returned when a tool name is already taken
+var ErrToolExists = errors.New("tool name already registered")
+
+// validNameSegment matches one dot-separated part of a tool name
+var validNameSegment = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// QualifiedName returns name in namespace ("" = no namespace)
+func QualifiedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + NamespaceSeparator + name
+}
+
+// WireName returns the name a tool is offered to the provider under
+func WireName(name string) string {
+	return strings.ReplaceAll(name, NamespaceSeparator, wireSeparator)
+}
+
+// validQualifiedName reports whether name, optionally namespaced, is a valid
+// tool name whose wire name providers accept
+func validQualifiedName(name string) bool {
+	for _, part := range strings.Split(name, NamespaceSeparator) {
+		if !validNameSegment.MatchString(part) {
+			return false
+		}
+	}
+	return len(WireName(name)) <= 64
+}
+
+// Add registers a tool unless its name, or the name it is offered to the
+// provider under, is taken; the error then wraps ErrToolExists. Unlike
+// Register it never replaces a tool.
+func (r *Registry) Add(tool *Tool) error {
+	if !validQualifiedName(tool.Name) {
+		return fmt.Errorf("invalid tool name %q", tool.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.resolve(WireName(tool.Name)); existing != "" {
+		if existing == tool.Name {
+			return fmt.Errorf("%w: %s", ErrToolExists, tool.Name)
+		}
+		return fmt.Errorf("%w: %s and %s are both offered as %s", ErrToolExists, tool.Name, existing, WireName(tool.Name))
+	}
+	r.tools[tool.Name] = tool
+	r.log.Debug("tool registered", "name", tool.Name)
+	return nil
+}
+
+// Resolve returns the registered name of a tool called by its name or its
+// wire name, or "" if there is none
+func (r *Registry) Resolve(name string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolve(name)
+}
+
+// resolve is Resolve with r.mu held
+func (r *Registry) resolve(name string) string {
+	if _, ok := r.tools[name]; ok {
+		return name
+	}
+	for registered := range r.tools {
+		if WireName(registered) == name {
+			return registered
+		}
+	}
+	return ""
+}
+
+// SetAliases registers each alias as another name of its target tool, such
+// as search for mcp.github.search_issues. An alias is a tool of its own to
+// the model, tools.enabled/disabled and tools.confirm, and needs
+// confirmation exactly when its target does.
+func (r *Registry) SetAliases(aliases map[string]string) error {
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	for _, alias := range names {
+		target := r.Resolve(aliases[alias])
+		if target == "" {
+			return fmt.Errorf("tools.aliases.%s: unknown tool %q", alias, aliases[alias])
+		}
+		orig, _ := r.Get(target)
+		tool := *orig
+		tool.Name = alias
+		if err := r.Add(&tool); err != nil {
+			return fmt.Errorf("tools.aliases.%s: %w", alias, err)
+		}
+		if r.IsSafeTool(target) {
+			r.markSafe(alias)
+		}
+		r.log.Debug("tool alias registered", "alias", alias, "target", target)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	pluginDefaultTimeout = 30
+	pluginMaxOutput      = 15000
+)
+
+// pluginManifest describes an executable tool plugin. It lives next to the
+// executable as <executable>.json.
+type pluginManifest struct {
+	Name        string                 `json:"name"`      // Default: the executable's name
+	Namespace   string                 `json:"namespace"` // Optional, as in jira.get_issue
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"` // JSON schema of the arguments
+	Command     string                 `json:"command"`    // Executable, relative to the manifest; default: manifest name without .json
+	Timeout     int                    `json:"timeout"`    // Seconds; default 30
+}
+
+// LoadPlugins registers the executable tool plugins in dir. Every
+// <name>.json manifest describes the executable <name>; a call runs it with
+// the arguments as a JSON object on stdin and returns its stdout. Broken
+// plugins are skipped with a warning, and plugins never replace built-in
+// tools. A missing dir is not an error.
+func (r *Registry) LoadPlugins(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading plugin directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		tool, err := loadPlugin(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			r.log.Warn("skipping tool plugin", "manifest", entry.Name(), "error", err)
+			continue
+		}
+		if err := r.Add(tool); err != nil {
+			r.log.Warn("skipping tool plugin", "manifest", entry.Name(), "error", err)
+			continue
+		}
+		r.log.Info("tool plugin registered", "name", tool.Name)
+	}
+	return nil
+}
+
+// loadPlugin reads a plugin manifest and returns its tool
+func loadPlugin(manifestPath string) (*Tool, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	var m pluginManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(manifestPath), ".json")
+	if m.Name == "" {
+		m.Name = base
+	}
+	m.Name = QualifiedName(m.Namespace, m.Name)
+	if !validQualifiedName(m.Name) {
+		return nil, fmt.Errorf("invalid tool name %q", m.Name)
+	}
+	if m.Description == "" {
+		return nil, errors.New("description is required")
+	}
+	if m.Parameters == nil {
+		m.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	if m.Timeout <= 0 {
+		m.Timeout = pluginDefaultTimeout
+	}
+
+	command := m.Command
+	if command == "" {
+		command = base
+	}
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(filepath.Dir(manifestPath), command)
+	}
+	info, err := os.Stat(command)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+		return nil, fmt.Errorf("%s is not executable", command)
+	}
+
+	return &Tool{
+		Name:        m.Name,
+		Description: m.Description,
+		Parameters:  m.Parameters,
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			return runPlugin(ctx, m.Name, command, m.Timeout, args)
+		},
+	}, nil
+}
+
+// runPlugin runs a plugin executable with args as JSON on stdin
+func runPlugin(ctx context.Context, name, command string, timeout int, args map[string]interface{}) (string, error) {
+	input, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("encoding arguments: %w", err)
+	}
+
+	if lim, ok := limitsFromContext(ctx); ok && lim.Timeout > 0 {
+		timeout = lim.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Env = os.Environ()
+	if id, turn := ConversationFromContext(ctx); id != "" {
+		cmd.Env = append(cmd.Env, "IGENT_CONVERSATION="+id, fmt.Sprintf("IGENT_TURN=%d", turn))
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	killProcessGroup(cmd)
+
+	err = cmd.Run()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return "", fmt.Errorf("%s timed out after %d seconds", name, timeout)
+	case context.Canceled:
+		return "", fmt.Errorf("%s cancelled", name)
+	}
+	output := truncateOutput(ctx, strings.TrimSpace(stdout.String()), pluginMaxOutput)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return output, fmt.Errorf("%s failed: %w: %s", name, err, truncateOutput(ctx, msg, pluginMaxOutput))
+		}
+		return output, fmt.Errorf("%s failed: %w", name, err)
+	}
+	return output, nil
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// killProcessGroup runs cmd in its own process group and kills the whole group
+// on cancellation, so children of `sh -c` don't outlive the tool call
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// withResourceLimits wraps a command so it runs under CPU time (seconds)
+// and data segment (MB) limits; zero leaves a limit unset
+func withResourceLimits(name string, args []string, cpuSeconds, memoryMB int) (string, []string) {
+	var limits []string
+	if cpuSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", cpuSeconds))
+	}
+	if memoryMB > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -d %d", memoryMB*1024))
+	}
+	if len(limits) == 0 {
+		return name, args
+	}
+	script := strings.Join(limits, " && ") + ` && exec "$@"`
+	return "/bin/sh", append([]string{"-c", script, "sh", name}, args...)
+}
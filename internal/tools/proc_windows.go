@@ -0,0 +1,14 @@
+//go:build windows
+
+package tools
+
+import "os/exec"
+
+// killProcessGroup is a no-op on Windows; the default cancel kills the process
+func killProcessGroup(cmd *exec.Cmd) {}
+
+// withResourceLimits returns the command unchanged; Windows has no ulimit,
+// so only the timeout applies
+func withResourceLimits(name string, args []string, cpuSeconds, memoryMB int) (string, []string) {
+	return name, args
+}
@@ -0,0 +1,338 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// processStat is one row of a process listing. CPU and Mem are percentages,
+// CPU over the process's lifetime as ps computes it.
+type processStat struct {
+	PID  int
+	CPU  float64
+	Mem  float64
+	RSS  int64 // Resident memory in KiB
+	Name string
+}
+
+// topDefaultLimit is the number of processes top shows by default
+const topDefaultLimit = 10
+
+// registerProcessTools registers proc_info, top and kill, which complement
+// ps. They read and signal processes with gopsutil. Only top runs without
+// confirmation: proc_info shows command lines, which may hold secrets passed
+// as arguments, and kill signals.
+func (r *Registry) registerProcessTools() {
+	// proc_info - Details of one process
+	r.Register(&Tool{
+		Name:        "proc_info",
+		Description: "Show details of one process: parent, user, state, CPU and memory usage, running time and full command line.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"pid": map[string]interface{}{
+					"type":        "integer",
+					"description": "Process ID",
+				},
+			},
+			"required": []string{"pid"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			pid, err := pidArg(args)
+			if err != nil {
+				return "", err
+			}
+			return processDetails(ctx, pid)
+		},
+	})
+
+	// top - Snapshot of the heaviest processes
+	r.Register(&Tool{
+		Name:        "top",
+		Description: "Show the processes using the most CPU or memory right now, heaviest first.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"sort": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"cpu", "mem"},
+					"description": "Order by CPU or memory usage (default: cpu)",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of processes to show (default: %d)", topDefaultLimit),
+				},
+			},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			by, _ := args["sort"].(string)
+			if by == "" {
+				by = "cpu"
+			}
+			if by != "cpu" && by != "mem" {
+				return "", fmt.Errorf("sort must be cpu or mem")
+			}
+			limit := getInt(args, "limit", topDefaultLimit)
+			if limit <= 0 {
+				limit = topDefaultLimit
+			}
+
+			procs, err := listProcesses(ctx)
+			if err != nil {
+				return "", err
+			}
+			return formatTop(procs, by, limit), nil
+		},
+	})
+	r.markSafe("top")
+
+	// kill - Signal a process
+	r.Register(&Tool{
+		Name:        "kill",
+		Description: "Send a signal to a process, by default TERM to ask it to exit. Use KILL only when it does not respond.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"pid": map[string]interface{}{
+					"type":        "integer",
+					"description": "Process ID",
+				},
+				"signal": map[string]interface{}{
+					"type":        "string",
+					"description": "Signal name: TERM, KILL, INT, HUP, QUIT, USR1, USR2, STOP or CONT (default: TERM). Windows supports TERM and KILL.",
+				},
+			},
+			"required": []string{"pid"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			pid, err := pidArg(args)
+			if err != nil {
+				return "", err
+			}
+			if pid == os.Getpid() {
+				return "", fmt.Errorf("refusing to signal igent itself")
+			}
+			if pid == 1 {
+				return "", fmt.Errorf("refusing to signal the init process")
+			}
+			sig, _ := args["signal"].(string)
+			sig = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(sig)), "SIG")
+			if sig == "" {
+				sig = "TERM"
+			}
+			if err := signalProcess(ctx, pid, sig); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Sent SIG%s to process %d", sig, pid), nil
+		},
+	})
+}
+
+// pidArg returns the required pid argument
+func pidArg(args map[string]interface{}) (int, error) {
+	pid := getInt(args, "pid", 0)
+	if pid <= 0 {
+		return 0, fmt.Errorf("pid must be a positive process ID")
+	}
+	return pid, nil
+}
+
+// formatTop renders the limit heaviest processes by cpu or mem as a table
+func formatTop(procs []processStat, by string, limit int) string {
+	sort.SliceStable(procs, func(i, j int) bool {
+		a, b := procs[i], procs[j]
+		if by == "cpu" && a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		if a.RSS != b.RSS {
+			return a.RSS > b.RSS
+		}
+		return a.PID < b.PID
+	})
+	if len(procs) > limit {
+		procs = procs[:limit]
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%7s %6s %6s %10s  %s\n", "PID", "%CPU", "%MEM", "RSS", "COMMAND")
+	for _, p := range procs {
+		fmt.Fprintf(&sb, "%7d %6.1f %6.1f %10s  %s\n", p.PID, p.CPU, p.Mem, formatKiB(p.RSS), p.Name)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatKiB renders a size in KiB with a readable unit
+func formatKiB(kib int64) string {
+	switch {
+	case kib >= 1<<20:
+		return fmt.Sprintf("%.1fG", float64(kib)/(1<<20))
+	case kib >= 1<<10:
+		return fmt.Sprintf("%.1fM", float64(kib)/(1<<10))
+	}
+	return fmt.Sprintf("%dK", kib)
+}
+
+// errNoProcess is the error for a pid that names no process
+func errNoProcess(pid int) error {
+	return fmt.Errorf("no process with PID %d", pid)
+}
+
+// findProcess returns the process pid
+func findProcess(ctx context.Context, pid int) (*process.Process, error) {
+	p, err := process.NewProcessWithContext(ctx, int32(pid))
+	if errors.Is(err, process.ErrorProcessNotRunning) {
+		return nil, errNoProcess(pid)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding process %d: %w", pid, err)
+	}
+	return p, nil
+}
+
+// memPercent returns the share of the installed memory, total bytes, that
+// rss KiB are, or 0 when the total is unknown
+func memPercent(rss int64, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(rss) * 1024 / float64(total) * 100
+}
+
+// listProcesses lists all processes
+func listProcesses(ctx context.Context) ([]processStat, error) {
+	ps, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %w", err)
+	}
+	var total uint64
+	if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		total = vm.Total
+	}
+
+	var procs []processStat
+	for _, p := range ps {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		name, err := p.NameWithContext(ctx)
+		if err != nil {
+			// Exited since the listing, or not ours to read
+			continue
+		}
+		stat := processStat{PID: int(p.Pid), Name: name}
+		stat.CPU, _ = p.CPUPercentWithContext(ctx)
+		if m, err := p.MemoryInfoWithContext(ctx); err == nil {
+			stat.RSS = int64(m.RSS / 1024)
+			stat.Mem = memPercent(stat.RSS, total)
+		}
+		procs = append(procs, stat)
+	}
+	return procs, nil
+}
+
+// processDetails describes one process; what the platform does not report
+// is shown as ?
+func processDetails(ctx context.Context, pid int) (string, error) {
+	p, err := findProcess(ctx, pid)
+	if err != nil {
+		return "", err
+	}
+	name, err := p.NameWithContext(ctx)
+	if err != nil {
+		return "", errNoProcess(pid)
+	}
+	or := func(s string, err error) string {
+		if err != nil || s == "" {
+			return "?"
+		}
+		return s
+	}
+
+	parent := "?"
+	if ppid, err := p.PpidWithContext(ctx); err == nil {
+		parent = fmt.Sprint(ppid)
+	}
+	status, err := p.StatusWithContext(ctx)
+	state := or(strings.Join(status, ","), err)
+	cpu, _ := p.CPUPercentWithContext(ctx)
+	memory := "?"
+	if m, err := p.MemoryInfoWithContext(ctx); err == nil {
+		rss := int64(m.RSS / 1024)
+		var total uint64
+		if vm, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+			total = vm.Total
+		}
+		memory = fmt.Sprintf("%.1f%% (%s resident)", memPercent(rss, total), formatKiB(rss))
+	}
+	running := "?"
+	if created, err := p.CreateTimeWithContext(ctx); err == nil {
+		running = formatElapsed(time.Since(time.UnixMilli(created)))
+	}
+	command, _ := p.CmdlineWithContext(ctx)
+	if command = strings.TrimSpace(command); command == "" {
+		// Kernel threads have no command line
+		command = "[" + name + "]"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "PID:      %d\n", pid)
+	fmt.Fprintf(&sb, "Parent:   %s\n", parent)
+	fmt.Fprintf(&sb, "User:     %s\n", or(p.UsernameWithContext(ctx)))
+	fmt.Fprintf(&sb, "State:    %s\n", state)
+	fmt.Fprintf(&sb, "CPU:      %.1f%%\n", cpu)
+	fmt.Fprintf(&sb, "Memory:   %s\n", memory)
+	fmt.Fprintf(&sb, "Running:  %s\n", running)
+	fmt.Fprintf(&sb, "Command:  %s", command)
+	return sb.String(), nil
+}
+
+// signalProcess sends the named signal to pid. TERM and KILL work on every
+// platform; the others are in signals where the platform has them.
+func signalProcess(ctx context.Context, pid int, name string) error {
+	p, err := findProcess(ctx, pid)
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "TERM":
+		err = p.TerminateWithContext(ctx)
+	case "KILL":
+		err = p.KillWithContext(ctx)
+	default:
+		sig, ok := signals[name]
+		if !ok {
+			return fmt.Errorf("unknown signal %q", name)
+		}
+		err = p.SendSignalWithContext(ctx, sig)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH) {
+			return errNoProcess(pid)
+		}
+		return fmt.Errorf("signaling process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// formatElapsed renders a running time as ps does: [[dd-]hh:]mm:ss
+func formatElapsed(d time.Duration) string {
+	secs := int64(d / time.Second)
+	days, hours, mins := secs/86400, secs/3600%24, secs/60%60
+	secs %= 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, mins, secs)
+	case hours > 0:
+		return fmt.Sprintf("%02d:%02d:%02d", hours, mins, secs)
+	}
+	return fmt.Sprintf("%02d:%02d", mins, secs)
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package tools
+
+import "syscall"
+
+// signals are the signals kill accepts besides TERM and KILL, by name
+// without the SIG prefix
+var signals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
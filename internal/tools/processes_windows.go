@@ -0,0 +1,8 @@
+//go:build windows
+
+package tools
+
+import "syscall"
+
+// signals is empty: Windows processes can only be ended, with TERM or KILL
+var signals = map[string]syscall.Signal{}
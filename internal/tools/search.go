@@ -0,0 +1,278 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default endpoints of the hosted search backends
+const (
+	braveSearchURL      = "https://api.search.brave.com/res/v1/web/search"
+	duckDuckGoSearchURL = "https://html.duckduckgo.com/html/"
+)
+
+// searchDefaultResults is the default number of results returned
+const searchDefaultResults = 5
+
+// SearchConfig configures the web_search tool backend
+type SearchConfig struct {
+	Backend    string // searxng, brave or duckduckgo
+	URL        string // Instance URL (required for searxng; overrides the default endpoint otherwise)
+	APIKey     string // Brave Search API subscription token
+	MaxResults int    // Results per query (default 5)
+}
+
+// SearchResult is one web search hit
+type SearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// searchBackend queries a search engine
+type searchBackend func(ctx context.Context, client *http.Client, cfg SearchConfig, query string, n int) ([]SearchResult, error)
+
+var searchBackends = map[string]searchBackend{
+	"searxng":    searchSearxNG,
+	"brave":      searchBrave,
+	"duckduckgo": searchDuckDuckGo,
+}
+
+// SetSearch enables the web_search tool with the given backend
+func (r *Registry) SetSearch(cfg SearchConfig) error {
+	if cfg.Backend == "" {
+		return nil
+	}
+	backend, ok := searchBackends[cfg.Backend]
+	if !ok {
+		return fmt.Errorf("unknown search backend: %s", cfg.Backend)
+	}
+	if cfg.Backend == "searxng" && cfg.URL == "" {
+		return fmt.Errorf("search backend searxng requires a url")
+	}
+	if cfg.Backend == "brave" && cfg.APIKey == "" {
+		return fmt.Errorf("search backend brave requires an api_key")
+	}
+	if cfg.MaxResults <= 0 {
+		cfg.MaxResults = searchDefaultResults
+	}
+
+	// web_search - Search the web
+	r.Register(&Tool{
+		Name:        "web_search",
+		Description: "Search the web. Returns titles, URLs and snippets; fetch a page with curl to read it.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Search query",
+				},
+				"max_results": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of results (default: %d)", cfg.MaxResults),
+				},
+			},
+			"required": []string{"query"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			query, ok := args["query"].(string)
+			if !ok || strings.TrimSpace(query) == "" {
+				return "", fmt.Errorf("query is required")
+			}
+			n := getInt(args, "max_results", cfg.MaxResults)
+			if n <= 0 || n > 20 {
+				n = cfg.MaxResults
+			}
+
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			client := &http.Client{
+				Timeout:   30 * time.Second,
+				Transport: r.networkPolicy().Transport("web_search", transport),
+			}
+
+			results, err := backend(ctx, client, cfg, query, n)
+			if err != nil {
+				return "", fmt.Errorf("%s search: %w", cfg.Backend, err)
+			}
+			return formatSearchResults(results), nil
+		},
+	})
+	r.log.Debug("web search enabled", "backend", cfg.Backend)
+	return nil
+}
+
+// formatSearchResults renders results as a numbered list
+func formatSearchResults(results []SearchResult) string {
+	if len(results) == 0 {
+		return "No results found."
+	}
+
+	var sb strings.Builder
+	for i, res := range results {
+		fmt.Fprintf(&sb, "%d. %s\n   %s\n", i+1, res.Title, res.URL)
+		if res.Snippet != "" {
+			fmt.Fprintf(&sb, "   %s\n", res.Snippet)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// searchGet performs a GET request and returns the body of a 200 response
+func searchGet(ctx context.Context, client *http.Client, endpoint string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", "igent")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// searchSearxNG queries a SearxNG instance through its JSON API
+func searchSearxNG(ctx context.Context, client *http.Client, cfg SearchConfig, query string, n int) ([]SearchResult, error) {
+	endpoint := strings.TrimRight(cfg.URL, "/") + "/search?" + url.Values{"q": {query}, "format": {"json"}}.Encode()
+	body, err := searchGet(ctx, client, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+
+	var results []SearchResult
+	for _, r := range data.Results {
+		if len(results) == n {
+			break
+		}
+		results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: cleanSnippet(r.Content)})
+	}
+	return results, nil
+}
+
+// searchBrave queries the Brave Search API
+func searchBrave(ctx context.Context, client *http.Client, cfg SearchConfig, query string, n int) ([]SearchResult, error) {
+	base := braveSearchURL
+	if cfg.URL != "" {
+		base = cfg.URL
+	}
+	endpoint := base + "?" + url.Values{"q": {query}, "count": {strconv.Itoa(n)}}.Encode()
+	body, err := searchGet(ctx, client, endpoint, http.Header{
+		"Accept":               {"application/json"},
+		"X-Subscription-Token": {cfg.APIKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+
+	var results []SearchResult
+	for _, r := range data.Web.Results {
+		if len(results) == n {
+			break
+		}
+		results = append(results, SearchResult{Title: cleanSnippet(r.Title), URL: r.URL, Snippet: cleanSnippet(r.Description)})
+	}
+	return results, nil
+}
+
+var (
+	ddgResultRe  = regexp.MustCompile(`(?s)<a[^>]+class="result__a"[^>]+href="([^"]+)"[^>]*>(.*?)</a>`)
+	ddgSnippetRe = regexp.MustCompile(`(?s)class="result__snippet"[^>]*>(.*?)</a>`)
+	htmlTagRe    = regexp.MustCompile(`<[^>]+>`)
+)
+
+// searchDuckDuckGo scrapes the DuckDuckGo HTML endpoint, which needs no API key
+func searchDuckDuckGo(ctx context.Context, client *http.Client, cfg SearchConfig, query string, n int) ([]SearchResult, error) {
+	base := duckDuckGoSearchURL
+	if cfg.URL != "" {
+		base = cfg.URL
+	}
+	body, err := searchGet(ctx, client, base+"?"+url.Values{"q": {query}}.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	page := string(body)
+	links := ddgResultRe.FindAllStringSubmatch(page, -1)
+	snippets := ddgSnippetRe.FindAllStringSubmatch(page, -1)
+
+	var results []SearchResult
+	for i, link := range links {
+		if len(results) == n {
+			break
+		}
+		res := SearchResult{Title: cleanSnippet(link[2]), URL: ddgTargetURL(html.UnescapeString(link[1]))}
+		if i < len(snippets) {
+			res.Snippet = cleanSnippet(snippets[i][1])
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// ddgTargetURL extracts the destination from a DuckDuckGo redirect link
+func ddgTargetURL(link string) string {
+	if strings.HasPrefix(link, "//") {
+		link = "https:" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	if target := u.Query().Get("uddg"); target != "" {
+		return target
+	}
+	return link
+}
+
+// cleanSnippet strips HTML tags and entities and collapses whitespace
+func cleanSnippet(s string) string {
+	s = html.UnescapeString(htmlTagRe.ReplaceAllString(s, ""))
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,283 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionMaxBuffer caps the output a session holds for one command; older
+// output is dropped first so the completion marker is always seen
+const sessionMaxBuffer = 1 << 20
+
+// registerSessionTool adds the shell_session tool
+func (r *Registry) registerSessionTool() {
+	r.sessions = make(map[string]*shellSession)
+
+	// shell_session - Run commands in a shell that persists between calls
+	r.Register(&Tool{
+		Name: "shell_session",
+		Description: "Execute a command in a persistent shell that lives for the whole conversation. " +
+			"The working directory, environment variables, shell functions and activated virtualenvs carry over " +
+			"to the next call, so 'cd', 'export' and 'source' work as in a terminal. " +
+			"Commands must not read from stdin. A timed out command restarts the session.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"command": map[string]interface{}{
+					"type":        "string",
+					"description": "The shell command to execute",
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Timeout in seconds (default: %d, max: %d)", shellDefaultTimeout, shellMaxTimeout),
+				},
+				"restart": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Start a fresh session before running the command (default: false)",
+				},
+			},
+			"required": []string{"command"},
+		},
+		ContextExecutor: r.runInSession,
+	})
+}
+
+// runInSession executes the shell_session tool in the session of the call's
+// conversation, starting it if needed
+func (r *Registry) runInSession(ctx context.Context, args map[string]interface{}) (string, error) {
+	command, ok := args["command"].(string)
+	if !ok || command == "" {
+		return "", fmt.Errorf("command is required")
+	}
+	timeout := callTimeout(ctx, args, shellDefaultTimeout, shellMaxTimeout)
+	id, _ := ConversationFromContext(ctx)
+
+	r.sessionsMu.Lock()
+	s := r.sessions[id]
+	if s != nil && (getBool(args, "restart", false) || s.exited()) {
+		s.close()
+		s = nil
+	}
+	if s == nil {
+		var err error
+		if s, err = startShellSession(); err != nil {
+			r.sessionsMu.Unlock()
+			return "", fmt.Errorf("starting shell session: %w", err)
+		}
+		r.sessions[id] = s
+		r.log.Debug("shell session started", "conversation", id, "pid", s.cmd.Process.Pid)
+	}
+	r.sessionsMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	output, status, err := s.run(ctx, command)
+	if err != nil {
+		// The shell is stuck in the command or gone; the next call starts afresh
+		r.sessionsMu.Lock()
+		if r.sessions[id] == s {
+			delete(r.sessions, id)
+		}
+		r.sessionsMu.Unlock()
+		s.close()
+
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			err = fmt.Errorf("command timed out after %d seconds; the session was restarted", timeout)
+		case context.Canceled:
+			err = fmt.Errorf("command cancelled; the session was restarted")
+		}
+		return truncateOutput(ctx, output, shellMaxOutput), err
+	}
+
+	output = truncateOutput(ctx, output, shellMaxOutput)
+	if status != 0 {
+		return output, fmt.Errorf("command exited with status %d", status)
+	}
+	return output, nil
+}
+
+// CloseSessions ends all shell sessions. Sessions also end by themselves
+// when igent exits, as their shell reads EOF.
+func (r *Registry) CloseSessions() {
+	r.sessionsMu.Lock()
+	defer r.sessionsMu.Unlock()
+	for id, s := range r.sessions {
+		s.close()
+		delete(r.sessions, id)
+	}
+}
+
+// shellSession is a long-lived shell that runs one command at a time.
+// Commands are written to its stdin and followed by a marker line carrying
+// the exit status; the marker includes a random nonce so command output
+// cannot fake it.
+type shellSession struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc // Kills the shell's process group
+	stdin  io.WriteCloser
+	marker string
+	done   chan struct{} // Closed when the shell exits
+
+	mu     sync.Mutex // Serializes commands
+	outMu  sync.Mutex
+	out    bytes.Buffer
+	notify chan struct{} // Signals new output
+}
+
+// startShellSession starts a shell in its own process group with stdout and
+// stderr merged
+func startShellSession() (*shellSession, error) {
+	shell := "/bin/sh"
+	if _, err := os.Stat(shell); os.IsNotExist(err) {
+		shell = "sh"
+	}
+
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, shell)
+	cmd.Env = os.Environ()
+	killProcessGroup(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		cancel()
+		pr.Close()
+		pw.Close()
+		return nil, err
+	}
+	pw.Close() // The shell and its children hold the write end
+
+	s := &shellSession{
+		cmd:    cmd,
+		cancel: cancel,
+		stdin:  stdin,
+		marker: "__igent_done_" + hex.EncodeToString(nonce) + "__",
+		done:   make(chan struct{}),
+		notify: make(chan struct{}, 1),
+	}
+	go s.read(pr)
+	go func() {
+		cmd.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// read collects the shell's output until the pipe closes
+func (s *shellSession) read(pr *os.File) {
+	defer pr.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := pr.Read(buf)
+		if n > 0 {
+			s.outMu.Lock()
+			s.out.Write(buf[:n])
+			if extra := s.out.Len() - sessionMaxBuffer; extra > 0 {
+				s.out.Next(extra)
+			}
+			s.outMu.Unlock()
+			select {
+			case s.notify <- struct{}{}:
+			default:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// run executes command in the session and returns its combined output and
+// exit status. An error means the session is unusable.
+func (s *shellSession) run(ctx context.Context, command string) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outMu.Lock()
+	s.out.Reset()
+	s.outMu.Unlock()
+
+	// eval runs the command in the shell itself, so cd and export persist;
+	// stdin is /dev/null so the command cannot swallow the script that follows
+	script := fmt.Sprintf("eval %s </dev/null\nprintf '\\n%s %%d\\n' \"$?\"\n", shellQuote(command), s.marker)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		return "", 0, fmt.Errorf("shell session ended: %w", err)
+	}
+
+	for {
+		s.outMu.Lock()
+		output := s.out.String()
+		s.outMu.Unlock()
+		if i := strings.Index(output, "\n"+s.marker+" "); i >= 0 {
+			rest := output[i+len(s.marker)+2:]
+			if j := strings.IndexByte(rest, '\n'); j >= 0 {
+				status, _ := strconv.Atoi(rest[:j])
+				return strings.TrimSpace(output[:i]), status, nil
+			}
+		}
+
+		select {
+		case <-s.notify:
+		case <-ctx.Done():
+			return strings.TrimSpace(output), 0, ctx.Err()
+		case <-s.done:
+			// Give the reader a moment to drain the pipe
+			select {
+			case <-s.notify:
+				continue
+			case <-time.After(100 * time.Millisecond):
+			}
+			s.outMu.Lock()
+			output = s.out.String()
+			s.outMu.Unlock()
+			return strings.TrimSpace(output), 0, fmt.Errorf("shell session ended; the next call starts a new one")
+		}
+	}
+}
+
+// exited reports whether the shell has exited
+func (s *shellSession) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// close kills the shell and everything it started
+func (s *shellSession) close() {
+	s.stdin.Close()
+	s.cancel()
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,333 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igm/igent/internal/netpolicy"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// sshDefaultTimeout is the default limit of a remote command in seconds
+	sshDefaultTimeout = 30
+
+	// sshMaxTimeout caps the timeout a call may request
+	sshMaxTimeout = 300
+
+	// sshDialTimeout bounds connecting and the SSH handshake
+	sshDialTimeout = 10 * time.Second
+
+	// sshMaxOutput caps the output returned to the model
+	sshMaxOutput = 15000
+)
+
+// SSHConfig configures the ssh tool. Authentication uses the ssh-agent and
+// key files only, so no password ever appears in a tool call.
+type SSHConfig struct {
+	Hosts          []string // Allowed hosts or *.domain patterns; empty disables ssh
+	User           string   // Default remote user (empty = local user)
+	IdentityFiles  []string // Private keys (empty = ~/.ssh/id_ed25519, id_ecdsa, id_rsa)
+	KnownHostsFile string   // Host keys to verify against (empty = ~/.ssh/known_hosts)
+	Timeout        int      // Default command timeout in seconds
+}
+
+// SetSSH registers the ssh tool for the allowed hosts
+func (r *Registry) SetSSH(cfg SSHConfig) error {
+	if len(cfg.Hosts) == 0 {
+		return nil
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = sshDefaultTimeout
+	}
+	hosts := make([]string, 0, len(cfg.Hosts))
+	for _, h := range cfg.Hosts {
+		hosts = append(hosts, strings.ToLower(strings.TrimSpace(h)))
+	}
+	cfg.Hosts = hosts
+	identityFiles := make([]string, 0, len(cfg.IdentityFiles))
+	for _, f := range cfg.IdentityFiles {
+		identityFiles = append(identityFiles, expandTilde(f))
+	}
+	cfg.IdentityFiles = identityFiles
+	cfg.KnownHostsFile = expandTilde(cfg.KnownHostsFile)
+	if cfg.KnownHostsFile == "" {
+		cfg.KnownHostsFile = filepath.Join(sshDir(), "known_hosts")
+	}
+	// Host keys are re-read on every call; fail early if there are none
+	if _, err := knownhosts.New(cfg.KnownHostsFile); err != nil {
+		return fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	// ssh - Run a command on a remote host
+	r.Register(&Tool{
+		Name: "ssh",
+		Description: "Run a command on a remote host over SSH and return its output and exit status. " +
+			"Only hosts allowed in the configuration can be reached: " + strings.Join(cfg.Hosts, ", "),
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"host": map[string]interface{}{
+					"type":        "string",
+					"description": "Remote host, optionally as user@host or host:port",
+				},
+				"command": map[string]interface{}{
+					"type":        "string",
+					"description": "Command to run on the remote host",
+				},
+				"timeout": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Timeout in seconds (default: %d, max: %d)", cfg.Timeout, sshMaxTimeout),
+				},
+			},
+			"required": []string{"host", "command"},
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			return r.runSSH(ctx, cfg, args)
+		},
+	})
+	return nil
+}
+
+// runSSH executes the ssh tool
+func (r *Registry) runSSH(ctx context.Context, cfg SSHConfig, args map[string]interface{}) (string, error) {
+	target, ok := args["host"].(string)
+	if !ok || target == "" {
+		return "", fmt.Errorf("host is required")
+	}
+	command, ok := args["command"].(string)
+	if !ok || command == "" {
+		return "", fmt.Errorf("command is required")
+	}
+	user, host, port, err := parseSSHTarget(target, cfg.User)
+	if err != nil {
+		return "", err
+	}
+	if !sshHostAllowed(cfg.Hosts, host) {
+		return "", fmt.Errorf("host %s is not in ssh.hosts", host)
+	}
+	if !r.networkPolicy().Allowed(host) {
+		return "", fmt.Errorf("%w: %s", netpolicy.ErrHostNotAllowed, host)
+	}
+	r.networkPolicy().Audit("ssh", "EXEC", "ssh://"+net.JoinHostPort(host, port))
+
+	timeout := callTimeout(ctx, args, cfg.Timeout, sshMaxTimeout)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	client, err := dialSSH(ctx, cfg, user, net.JoinHostPort(host, port))
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("opening session: %w", err)
+	}
+	defer session.Close()
+
+	// The session copies stdout and stderr in separate goroutines
+	var output lockedBuffer
+	session.Stdout = &output
+	session.Stderr = &output
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	select {
+	case <-ctx.Done():
+		// Closing the connection ends the remote command's session
+		client.Close()
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("command timed out after %d seconds", timeout)
+		}
+		return "", fmt.Errorf("command cancelled")
+	case err = <-done:
+	}
+
+	result := truncateOutput(ctx, strings.TrimSpace(output.String()), sshMaxOutput)
+	if result == "" {
+		result = "(no output)"
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return result + "\nexit status: 0", nil
+	case errors.As(err, &exitErr):
+		return fmt.Sprintf("%s\nexit status: %d", result, exitErr.ExitStatus()), nil
+	default:
+		return "", fmt.Errorf("running command: %w", err)
+	}
+}
+
+// dialSSH connects and authenticates to addr, verifying its host key
+func dialSSH(ctx context.Context, cfg SSHConfig, user, addr string) (*ssh.Client, error) {
+	knownHostsFile := cfg.KnownHostsFile
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading known hosts: %w", err)
+	}
+
+	auth, closeAgent := sshAuth(cfg)
+	defer closeAgent()
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("no SSH credentials: start ssh-agent or set ssh.identity_files")
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User: user,
+		Auth: auth,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := hostKeys(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+				return fmt.Errorf("host key of %s is not in %s; verify it and add it there first", hostname, knownHostsFile)
+			}
+			return err
+		},
+		Timeout: sshDialTimeout,
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, sshDialTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+
+	// NewClientConn has no context; bound the handshake by closing the connection
+	stop := context.AfterFunc(dialCtx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	stop()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// sshAuth returns the available authentication methods: keys held by the
+// ssh-agent, then unencrypted key files. The returned func releases the
+// agent connection.
+func sshAuth(cfg SSHConfig) ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+
+	files := cfg.IdentityFiles
+	if len(files) == 0 {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			files = append(files, filepath.Join(sshDir(), name))
+		}
+	}
+	var signers []ssh.Signer
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// Encrypted keys need the ssh-agent; passphrases are never asked for
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	return methods, closeAgent
+}
+
+// parseSSHTarget splits [user@]host[:port], defaulting the user to
+// defaultUser or the local user and the port to 22
+func parseSSHTarget(target, defaultUser string) (user, host, port string, err error) {
+	user = defaultUser
+	if u, rest, ok := strings.Cut(target, "@"); ok {
+		user, target = u, rest
+	}
+	host, port = target, "22"
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		host, port = h, p
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	if host == "" || strings.HasPrefix(host, "-") {
+		return "", "", "", fmt.Errorf("invalid host: %s", target)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return "", "", "", fmt.Errorf("invalid port: %s", port)
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	if user == "" {
+		return "", "", "", fmt.Errorf("no user given for %s", host)
+	}
+	return user, host, port, nil
+}
+
+// sshHostAllowed matches a host against exact names and *.domain patterns
+func sshHostAllowed(hosts []string, host string) bool {
+	for _, pattern := range hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTilde resolves a leading ~/ to the home directory
+func expandTilde(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// sshDir returns ~/.ssh
+func sshDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh")
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent writes
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
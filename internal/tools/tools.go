@@ -7,19 +7,38 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/igm/igent/internal/logger"
+	"github.com/igm/igent/internal/netpolicy"
 	"github.com/igm/igent/internal/storage"
 )
 
+const (
+	// shellDefaultTimeout and shellMaxTimeout bound the shell tool, in seconds
+	shellDefaultTimeout = 30
+	shellMaxTimeout     = 120
+
+	// shellMaxOutput caps the output of the shell tool
+	shellMaxOutput = 15000
+
+	// commandMaxOutput caps the output of tools wrapping a single command
+	commandMaxOutput = 10000
+)
+
 // Tool represents a tool that can be called by the LLM
 type Tool struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 	Executor    func(args map[string]interface{}) (string, error)
+
+	// ContextExecutor is used instead of Executor when set, so long-running
+	// tools can be cancelled through the call context
+	ContextExecutor func(ctx context.Context, args map[string]interface{}) (string, error)
 }
 
 // ToolCall represents a tool call request from the LLM
@@ -38,12 +57,20 @@ type ToolResult struct {
 	Error      string `json:"error,omitempty"`
 }
 
-// Registry manages available tools
+// Registry manages available tools. It is safe for concurrent use: tools
+// may be registered while others execute.
 type Registry struct {
+	mu        sync.RWMutex // Guards the fields up to limits
 	tools     map[string]*Tool
 	store     *storage.JSONStore
-	safeTools map[string]bool // Tools that don't require user confirmation
+	netPolicy *netpolicy.Policy
+	scorer    MemoryScorer          // Scores memories stored by memory_add; nil = off
+	safeTools map[string]bool       // Tools that don't require user confirmation
+	limits    map[string]ToolLimits // Configured per-tool limits
 	log       *slog.Logger
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*shellSession // shell_session shells by conversation
 }
 
 // NewRegistry creates a new tool registry with default tools
@@ -54,34 +81,190 @@ func NewRegistry() *Registry {
 		log:       logger.L().With("component", "tools"),
 	}
 	r.registerDefaults()
+	r.registerSessionTool()
+	r.registerEditTools()
+	r.registerFileTools()
+	r.registerClipboardTools()
+	r.registerProcessTools()
+	r.registerSearchTools()
+	r.registerHTTPTool()
+	r.registerGitTools()
+	r.registerDockerTools()
+	r.registerCheckpointTool()
 	return r
 }
 
 // SetStorage sets the storage backend for tools that need it
 func (r *Registry) SetStorage(store *storage.JSONStore) {
+	r.mu.Lock()
 	r.store = store
+	r.mu.Unlock()
 	r.registerMemoryTools()
+	r.registerGraphTools()
+	r.registerArtifactTools()
+	r.registerDocumentTools()
+}
+
+// conversationKey is the context key for the active conversation
+type conversationKey struct{}
+
+type conversationInfo struct {
+	id   string
+	turn int
+}
+
+// WithConversation returns a context carrying the conversation and turn
+// a tool call belongs to
+func WithConversation(ctx context.Context, id string, turn int) context.Context {
+	return context.WithValue(ctx, conversationKey{}, conversationInfo{id: id, turn: turn})
+}
+
+// ConversationFromContext returns the conversation and turn set by WithConversation
+func ConversationFromContext(ctx context.Context) (string, int) {
+	info, _ := ctx.Value(conversationKey{}).(conversationInfo)
+	return info.id, info.turn
+}
+
+// outputKey is the context key for live tool output
+type outputKey struct{}
+
+// WithOutput returns a context whose tools report output to fn as it is
+// produced, before the call returns its full result
+func WithOutput(ctx context.Context, fn func(chunk string)) context.Context {
+	return context.WithValue(ctx, outputKey{}, fn)
+}
+
+// outputFromContext returns the live output callback set by WithOutput
+func outputFromContext(ctx context.Context) func(string) {
+	fn, _ := ctx.Value(outputKey{}).(func(string))
+	return fn
+}
+
+// SetNetworkPolicy restricts the hosts network tools may contact
+func (r *Registry) SetNetworkPolicy(policy *netpolicy.Policy) {
+	r.mu.Lock()
+	r.netPolicy = policy
+	r.mu.Unlock()
+}
+
+// MemoryScorer rates the importance (0-1) of a memory and normalizes its
+// type, given the type the model proposed
+type MemoryScorer func(ctx context.Context, content, memType string) (string, float64, error)
+
+// SetMemoryScorer makes memory_add ask scorer for the type and relevance of
+// new memories, unless the model gave a relevance itself
+func (r *Registry) SetMemoryScorer(scorer MemoryScorer) {
+	r.mu.Lock()
+	r.scorer = scorer
+	r.mu.Unlock()
+}
+
+// memoryScorer returns the scorer set by SetMemoryScorer
+func (r *Registry) memoryScorer() MemoryScorer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.scorer
+}
+
+// storage returns the storage backend set by SetStorage
+func (r *Registry) storage() *storage.JSONStore {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.store
+}
+
+// networkPolicy returns the policy set by SetNetworkPolicy
+func (r *Registry) networkPolicy() *netpolicy.Policy {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.netPolicy
 }
 
 // IsSafeTool returns true if the tool doesn't require user confirmation
 func (r *Registry) IsSafeTool(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.safeTools[name]
 }
 
-// Register adds a tool to the registry
+// markSafe lets a tool run without user confirmation
+func (r *Registry) markSafe(name string) {
+	r.mu.Lock()
+	r.safeTools[name] = true
+	r.mu.Unlock()
+}
+
+// Register adds a tool to the registry, replacing one of the same name
 func (r *Registry) Register(tool *Tool) {
+	r.mu.Lock()
 	r.tools[tool.Name] = tool
+	r.mu.Unlock()
 	r.log.Debug("tool registered", "name", tool.Name)
 }
 
+// Restrict removes the tools the model may not call. Both lists hold tool
+// names or glob patterns such as git_*; an empty enabled list allows every
+// tool, and disabled wins over enabled.
+func (r *Registry) Restrict(enabled, disabled []string) error {
+	patterns := append(append([]string(nil), enabled...), disabled...)
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", p, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Patterns that match no tool are most likely typos
+	for _, p := range patterns {
+		if !r.matchTools(p) {
+			r.log.Warn("tool pattern matches no registered tool", "pattern", p)
+		}
+	}
+
+	for name := range r.tools {
+		allowed := len(enabled) == 0 || matchToolName(enabled, name)
+		if !allowed || matchToolName(disabled, name) {
+			delete(r.tools, name)
+			r.log.Debug("tool disabled", "name", name)
+		}
+	}
+	return nil
+}
+
+// matchTools reports whether a pattern matches any registered tool. r.mu
+// must be held.
+func (r *Registry) matchTools(pattern string) bool {
+	for name := range r.tools {
+		if matchToolName([]string{pattern}, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchToolName reports whether name matches one of the (valid) patterns
+func matchToolName(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Get retrieves a tool by name
 func (r *Registry) Get(name string) (*Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tool, ok := r.tools[name]
 	return tool, ok
 }
 
 // List returns all registered tools
 func (r *Registry) List() []*Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tools := make([]*Tool, 0, len(r.tools))
 	for _, t := range r.tools {
 		tools = append(tools, t)
@@ -91,12 +274,14 @@ func (r *Registry) List() []*Tool {
 
 // ToOpenAIFormat converts tools to OpenAI function format
 func (r *Registry) ToOpenAIFormat() []map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	tools := make([]map[string]interface{}, 0, len(r.tools))
 	for _, t := range r.tools {
 		tools = append(tools, map[string]interface{}{
 			"type": "function",
 			"function": map[string]interface{}{
-				"name":        t.Name,
+				"name":        WireName(t.Name),
 				"description": t.Description,
 				"parameters":  t.Parameters,
 			},
@@ -109,7 +294,7 @@ func (r *Registry) ToOpenAIFormat() []map[string]interface{} {
 func (r *Registry) Execute(ctx context.Context, call *ToolCall) *ToolResult {
 	r.log.Info("executing tool", "name", call.Name, "id", call.ID)
 
-	tool, ok := r.tools[call.Name]
+	tool, ok := r.Get(call.Name)
 	if !ok {
 		return &ToolResult{
 			ToolCallID: call.ID,
@@ -118,7 +303,7 @@ func (r *Registry) Execute(ctx context.Context, call *ToolCall) *ToolResult {
 		}
 	}
 
-	output, err := tool.Executor(call.Args)
+	output, err := r.runWithLimits(ctx, tool, call.Args)
 	if err != nil {
 		r.log.Error("tool execution failed", "name", call.Name, "error", err)
 		return &ToolResult{
@@ -181,7 +366,7 @@ func (r *Registry) registerDefaults() {
 				},
 			},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			path := "."
 			if p, ok := args["path"].(string); ok && p != "" {
 				path = p
@@ -196,7 +381,7 @@ func (r *Registry) registerDefaults() {
 			}
 			cmdArgs = append(cmdArgs, path)
 
-			return runCommand("ls", cmdArgs...)
+			return runCommandContext(ctx, "ls", cmdArgs...)
 		},
 	})
 
@@ -261,84 +446,13 @@ func (r *Registry) registerDefaults() {
 				},
 			},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			// Use ps command with custom format
 			cmdArgs := []string{"-o", "pid,pcpu,pmem,comm"}
 			if getBool(args, "all", false) {
 				cmdArgs = []string{"-e", "-o", "pid,pcpu,pmem,comm"}
 			}
-			return runCommand("ps", cmdArgs...)
-		},
-	})
-
-	// curl - Make HTTP requests
-	r.Register(&Tool{
-		Name:        "curl",
-		Description: "Make HTTP requests to URLs. Supports GET, POST, and other methods. Returns response body and status.",
-		Parameters: map[string]interface{}{
-			"type": "object",
-			"properties": map[string]interface{}{
-				"url": map[string]interface{}{
-					"type":        "string",
-					"description": "The URL to request",
-				},
-				"method": map[string]interface{}{
-					"type":        "string",
-					"description": "HTTP method (GET, POST, PUT, DELETE, etc.)",
-					"enum":        []string{"GET", "POST", "PUT", "DELETE", "HEAD", "PATCH"},
-				},
-				"headers": map[string]interface{}{
-					"type":        "object",
-					"description": "HTTP headers as key-value pairs",
-				},
-				"data": map[string]interface{}{
-					"type":        "string",
-					"description": "Request body data (for POST, PUT, PATCH)",
-				},
-				"timeout": map[string]interface{}{
-					"type":        "integer",
-					"description": "Request timeout in seconds (default: 30)",
-				},
-			},
-			"required": []string{"url"},
-		},
-		Executor: func(args map[string]interface{}) (string, error) {
-			url, ok := args["url"].(string)
-			if !ok || url == "" {
-				return "", fmt.Errorf("url is required")
-			}
-
-			cmdArgs := []string{"-s", "-i"} // Silent but include headers
-
-			// Method
-			if method, ok := args["method"].(string); ok && method != "" {
-				cmdArgs = append(cmdArgs, "-X", strings.ToUpper(method))
-			}
-
-			// Headers
-			if headers, ok := args["headers"].(map[string]interface{}); ok {
-				for k, v := range headers {
-					if vs, ok := v.(string); ok {
-						cmdArgs = append(cmdArgs, "-H", fmt.Sprintf("%s: %s", k, vs))
-					}
-				}
-			}
-
-			// Body data
-			if data, ok := args["data"].(string); ok && data != "" {
-				cmdArgs = append(cmdArgs, "-d", data)
-			}
-
-			// Timeout
-			timeout := 30
-			if t, ok := args["timeout"].(float64); ok {
-				timeout = int(t)
-			}
-			cmdArgs = append(cmdArgs, "--max-time", fmt.Sprintf("%d", timeout))
-
-			cmdArgs = append(cmdArgs, url)
-
-			return runCommand("curl", cmdArgs...)
+			return runCommandContext(ctx, "ps", cmdArgs...)
 		},
 	})
 
@@ -356,12 +470,12 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"command"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			cmd, ok := args["command"].(string)
 			if !ok || cmd == "" {
 				return "", fmt.Errorf("command is required")
 			}
-			return runCommand("which", cmd)
+			return runCommandContext(ctx, "which", cmd)
 		},
 	})
 
@@ -431,7 +545,7 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"path"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			path, ok := args["path"].(string)
 			if !ok || path == "" {
 				return "", fmt.Errorf("path is required")
@@ -445,7 +559,7 @@ func (r *Registry) registerDefaults() {
 				}
 			}
 
-			return runCommand("head", "-n", fmt.Sprintf("%d", lines), path)
+			return runCommandContext(ctx, "head", "-n", fmt.Sprintf("%d", lines), path)
 		},
 	})
 
@@ -467,7 +581,7 @@ func (r *Registry) registerDefaults() {
 			},
 			"required": []string{"path"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			path, ok := args["path"].(string)
 			if !ok || path == "" {
 				return "", fmt.Errorf("path is required")
@@ -481,7 +595,7 @@ func (r *Registry) registerDefaults() {
 				}
 			}
 
-			return runCommand("tail", "-n", fmt.Sprintf("%d", lines), path)
+			return runCommandContext(ctx, "tail", "-n", fmt.Sprintf("%d", lines), path)
 		},
 	})
 
@@ -498,12 +612,12 @@ func (r *Registry) registerDefaults() {
 				},
 			},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			cmdArgs := []string{}
 			if getBool(args, "human", true) {
 				cmdArgs = append(cmdArgs, "-h")
 			}
-			return runCommand("df", cmdArgs...)
+			return runCommandContext(ctx, "df", cmdArgs...)
 		},
 	})
 
@@ -520,11 +634,11 @@ func (r *Registry) registerDefaults() {
 				},
 			},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			if getBool(args, "all", true) {
-				return runCommand("uname", "-a")
+				return runCommandContext(ctx, "uname", "-a")
 			}
-			return runCommand("uname")
+			return runCommandContext(ctx, "uname")
 		},
 	})
 
@@ -541,24 +655,18 @@ func (r *Registry) registerDefaults() {
 				},
 				"timeout": map[string]interface{}{
 					"type":        "integer",
-					"description": "Timeout in seconds (default: 30, max: 120)",
+					"description": fmt.Sprintf("Timeout in seconds (default: %d, max: %d)", shellDefaultTimeout, shellMaxTimeout),
 				},
 			},
 			"required": []string{"command"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			command, ok := args["command"].(string)
 			if !ok || command == "" {
 				return "", fmt.Errorf("command is required")
 			}
 
-			timeout := 30
-			if t, ok := args["timeout"].(float64); ok && t > 0 {
-				timeout = int(t)
-				if timeout > 120 {
-					timeout = 120
-				}
-			}
+			timeout := callTimeout(ctx, args, shellDefaultTimeout, shellMaxTimeout)
 
 			// Use sh -c for Unix-like systems
 			shell := "/bin/sh"
@@ -567,31 +675,38 @@ func (r *Registry) registerDefaults() {
 				shell = "sh"
 			}
 
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+			ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 			defer cancel()
 
 			cmd := exec.CommandContext(ctx, shell, "-c", command)
 			cmd.Env = os.Environ()
+			cmd.WaitDelay = time.Second
+			killProcessGroup(cmd)
 
 			output, err := cmd.CombinedOutput()
-			if ctx.Err() == context.DeadlineExceeded {
+			switch ctx.Err() {
+			case context.DeadlineExceeded:
 				return "", fmt.Errorf("command timed out after %d seconds", timeout)
+			case context.Canceled:
+				return "", fmt.Errorf("command cancelled")
 			}
 			if err != nil {
 				return string(output), fmt.Errorf("command failed: %w", err)
 			}
 
-			result := strings.TrimSpace(string(output))
-			if len(result) > 15000 {
-				result = result[:15000] + "\n... (output truncated)"
-			}
-
-			return result, nil
+			return truncateOutput(ctx, strings.TrimSpace(string(output)), shellMaxOutput), nil
 		},
 	})
 }
 
-// ParseToolCall parses a tool call from LLM response
+// Limits on model-produced tool arguments, checked before decoding them
+const (
+	maxToolArgsBytes = 1 << 20 // 1 MB
+	maxToolArgsDepth = 32      // Nesting of objects and arrays
+)
+
+// ParseToolCall parses a tool call from LLM response. Oversized or deeply
+// nested arguments are rejected with an error the model can act on.
 func ParseToolCall(id, name, argsJSON string) (*ToolCall, error) {
 	call := &ToolCall{
 		ID:      id,
@@ -600,31 +715,74 @@ func ParseToolCall(id, name, argsJSON string) (*ToolCall, error) {
 		Args:    make(map[string]interface{}),
 	}
 
-	if argsJSON != "" {
+	if strings.TrimSpace(argsJSON) != "" {
+		if len(argsJSON) > maxToolArgsBytes {
+			return nil, fmt.Errorf("tool arguments are %d KB, over the %d KB limit; pass large content in several smaller calls",
+				len(argsJSON)>>10, maxToolArgsBytes>>10)
+		}
+		if depth := jsonDepth(argsJSON); depth > maxToolArgsDepth {
+			return nil, fmt.Errorf("tool arguments are nested %d levels deep, over the limit of %d; use a flatter structure",
+				depth, maxToolArgsDepth)
+		}
 		if err := json.Unmarshal([]byte(argsJSON), &call.Args); err != nil {
 			return nil, fmt.Errorf("parsing tool arguments: %w", err)
 		}
+		if call.Args == nil {
+			// "null"
+			call.Args = make(map[string]interface{})
+		}
 	}
 
 	return call, nil
 }
 
+// jsonDepth returns the deepest nesting of objects and arrays in a JSON
+// text, ignoring brackets inside strings. It does not validate the JSON.
+func jsonDepth(s string) int {
+	depth, max := 0, 0
+	inString, escaped := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '{' || c == '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case c == '}' || c == ']':
+			depth--
+		}
+	}
+	return max
+}
+
 // runCommand safely executes a shell command
 func runCommand(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+	return runCommandContext(context.Background(), name, args...)
+}
+
+// runCommandContext executes a command that is killed when ctx is cancelled
+func runCommandContext(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Env = os.Environ()
+	cmd.WaitDelay = time.Second
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return string(output), fmt.Errorf("command failed: %w", err)
 	}
 
-	result := strings.TrimSpace(string(output))
-	if len(result) > 10000 {
-		result = result[:10000] + "\n... (output truncated)"
-	}
-
-	return result, nil
+	return truncateOutput(ctx, strings.TrimSpace(string(output)), commandMaxOutput), nil
 }
 
 // getBool safely gets a boolean from args with default
@@ -635,6 +793,27 @@ func getBool(args map[string]interface{}, key string, def bool) bool {
 	return def
 }
 
+// getInt safely gets an integer from args with default
+func getInt(args map[string]interface{}, key string, def int) int {
+	if v, ok := args[key].(float64); ok {
+		return int(v)
+	}
+	return def
+}
+
+// getStrings safely gets a list of strings from args
+func getStrings(args map[string]interface{}, key string) []string {
+	var values []string
+	if list, ok := args[key].([]interface{}); ok {
+		for _, v := range list {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
 // registerMemoryTools registers the memory management tools
 func (r *Registry) registerMemoryTools() {
 	if r.store == nil {
@@ -659,12 +838,22 @@ func (r *Registry) registerMemoryTools() {
 				},
 				"relevance": map[string]interface{}{
 					"type":        "number",
-					"description": "Relevance score 0-1 (default: 0.8)",
+					"description": "Relevance score 0-1 (default: 0.8, or rated automatically)",
+				},
+				"scope": map[string]interface{}{
+					"type":        "string",
+					"description": "global to remember it in every conversation (default), conversation to only remember it in this one",
+					"enum":        []string{"global", "conversation"},
+				},
+				"tags": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Labels to find it by later, e.g. a project name",
 				},
 			},
 			"required": []string{"content", "type"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
 			content, ok := args["content"].(string)
 			if !ok || content == "" {
 				return "", fmt.Errorf("content is required")
@@ -679,9 +868,27 @@ func (r *Registry) registerMemoryTools() {
 			}
 
 			relevance := 0.8
-			if rel, ok := args["relevance"].(float64); ok && rel >= 0 && rel <= 1 {
+			rel, explicit := args["relevance"].(float64)
+			if explicit = explicit && rel >= 0 && rel <= 1; explicit {
 				relevance = rel
 			}
+			if scorer := r.memoryScorer(); scorer != nil {
+				if scoredType, importance, err := scorer(ctx, content, memType); err != nil {
+					r.log.Warn("scoring memory failed", "error", err)
+				} else {
+					memType = scoredType
+					if !explicit {
+						relevance = importance
+					}
+				}
+			}
+
+			var scope string
+			if s, _ := args["scope"].(string); s == "conversation" {
+				if scope, _ = ConversationFromContext(ctx); scope == "" {
+					return "", fmt.Errorf("no active conversation to scope the memory to")
+				}
+			}
 
 			memory := &storage.MemoryItem{
 				ID:        fmt.Sprintf("%d", time.Now().UnixNano()),
@@ -689,27 +896,40 @@ func (r *Registry) registerMemoryTools() {
 				Type:      memType,
 				CreatedAt: time.Now(),
 				Relevance: relevance,
+				Scope:     scope,
+				Tags:      storage.NormalizeTags(getStrings(args, "tags")),
 			}
 
-			if err := r.store.SaveMemory(memory); err != nil {
+			if err := r.storage().SaveMemory(memory); err != nil {
 				return "", fmt.Errorf("failed to save memory: %w", err)
 			}
 
-			return fmt.Sprintf("Memory stored successfully (id: %s, type: %s)", memory.ID, memory.Type), nil
+			return fmt.Sprintf("Memory stored successfully (id: %s, type: %s, scope: %s)", memory.ID, memory.Type, memoryScope(memory)), nil
 		},
 	})
-	r.safeTools["memory_add"] = true
+	r.markSafe("memory_add")
 
 	// memory_list - List all memories
 	r.Register(&Tool{
 		Name:        "memory_list",
-		Description: "List all stored memories. Shows all facts, preferences, and context items.",
+		Description: "List all stored memories: global ones and those of this conversation, optionally only of one type or with given tags.",
 		Parameters: map[string]interface{}{
-			"type":       "object",
-			"properties": map[string]interface{}{},
+			"type": "object",
+			"properties": map[string]interface{}{
+				"type": map[string]interface{}{
+					"type":        "string",
+					"description": "Only memories of this type",
+					"enum":        []string{"fact", "preference", "context"},
+				},
+				"tags": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Only memories with all of these tags",
+				},
+			},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
-			memories, err := r.store.LoadMemories()
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			memories, err := r.queryMemories(ctx, args)
 			if err != nil {
 				return "", fmt.Errorf("failed to load memories: %w", err)
 			}
@@ -721,46 +941,48 @@ func (r *Registry) registerMemoryTools() {
 			var sb strings.Builder
 			sb.WriteString(fmt.Sprintf("Found %d memories:\n\n", len(memories)))
 			for _, mem := range memories {
-				sb.WriteString(fmt.Sprintf("- [%s] (id: %s, relevance: %.1f) %s\n", mem.Type, mem.ID, mem.Relevance, mem.Content))
+				sb.WriteString(fmt.Sprintf("- [%s] (id: %s, relevance: %.1f, scope: %s%s) %s\n", mem.Type, mem.ID, mem.Relevance, memoryScope(mem), memoryTags(mem), mem.Content))
 			}
 			return sb.String(), nil
 		},
 	})
-	r.safeTools["memory_list"] = true
+	r.markSafe("memory_list")
 
 	// memory_search - Find memories by keyword
 	r.Register(&Tool{
 		Name:        "memory_search",
-		Description: "Search for memories containing specific keywords or text.",
+		Description: "Search the global memories and those of this conversation for specific keywords or text, by type or by tags.",
 		Parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
 				"query": map[string]interface{}{
 					"type":        "string",
-					"description": "Search query - finds memories containing this text",
+					"description": "Search query - finds memories containing this text (optional with type or tags)",
+				},
+				"type": map[string]interface{}{
+					"type":        "string",
+					"description": "Only memories of this type",
+					"enum":        []string{"fact", "preference", "context"},
+				},
+				"tags": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Only memories with all of these tags",
 				},
 			},
-			"required": []string{"query"},
 		},
-		Executor: func(args map[string]interface{}) (string, error) {
-			query, ok := args["query"].(string)
-			if !ok || query == "" {
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			query, _ := args["query"].(string)
+			memType, _ := args["type"].(string)
+			if query == "" && memType == "" && len(getStrings(args, "tags")) == 0 {
 				return "", fmt.Errorf("query is required")
 			}
 
-			memories, err := r.store.LoadMemories()
+			matches, err := r.queryMemories(ctx, args)
 			if err != nil {
 				return "", fmt.Errorf("failed to load memories: %w", err)
 			}
 
-			queryLower := strings.ToLower(query)
-			var matches []*storage.MemoryItem
-			for _, mem := range memories {
-				if strings.Contains(strings.ToLower(mem.Content), queryLower) {
-					matches = append(matches, mem)
-				}
-			}
-
 			if len(matches) == 0 {
 				return fmt.Sprintf("No memories found matching '%s'.", query), nil
 			}
@@ -768,12 +990,12 @@ func (r *Registry) registerMemoryTools() {
 			var sb strings.Builder
 			sb.WriteString(fmt.Sprintf("Found %d memories matching '%s':\n\n", len(matches), query))
 			for _, mem := range matches {
-				sb.WriteString(fmt.Sprintf("- [%s] (id: %s) %s\n", mem.Type, mem.ID, mem.Content))
+				sb.WriteString(fmt.Sprintf("- [%s] (id: %s%s) %s\n", mem.Type, mem.ID, memoryTags(mem), mem.Content))
 			}
 			return sb.String(), nil
 		},
 	})
-	r.safeTools["memory_search"] = true
+	r.markSafe("memory_search")
 
 	// memory_update - Update memory by ID or content match
 	r.Register(&Tool{
@@ -803,6 +1025,11 @@ func (r *Registry) registerMemoryTools() {
 					"type":        "number",
 					"description": "New relevance score 0-1",
 				},
+				"tags": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "New tags, replacing the current ones (empty list removes them)",
+				},
 			},
 		},
 		Executor: func(args map[string]interface{}) (string, error) {
@@ -819,7 +1046,7 @@ func (r *Registry) registerMemoryTools() {
 
 			if id != "" {
 				// Find by ID - need to load and match
-				memories, loadErr := r.store.LoadMemories()
+				memories, loadErr := r.storage().LoadMemories()
 				if loadErr != nil {
 					return "", fmt.Errorf("failed to load memories: %w", loadErr)
 				}
@@ -834,7 +1061,7 @@ func (r *Registry) registerMemoryTools() {
 				}
 			} else {
 				// Find by search
-				memory, err = r.store.FindMemoryByContent(search)
+				memory, err = r.storage().FindMemoryByContent(search)
 				if err != nil {
 					return "", fmt.Errorf("memory not found matching '%s'", search)
 				}
@@ -851,12 +1078,15 @@ func (r *Registry) registerMemoryTools() {
 			if relevance, ok := args["relevance"].(float64); ok && relevance >= 0 && relevance <= 1 {
 				updates["relevance"] = relevance
 			}
+			if _, ok := args["tags"]; ok {
+				updates["tags"] = getStrings(args, "tags")
+			}
 
 			if len(updates) == 0 {
 				return "", fmt.Errorf("no updates provided")
 			}
 
-			updated, err := r.store.UpdateMemory(memory.ID, updates)
+			updated, err := r.storage().UpdateMemory(memory.ID, updates)
 			if err != nil {
 				return "", fmt.Errorf("failed to update memory: %w", err)
 			}
@@ -864,7 +1094,7 @@ func (r *Registry) registerMemoryTools() {
 			return fmt.Sprintf("Memory updated successfully (id: %s): [%s] %s", updated.ID, updated.Type, updated.Content), nil
 		},
 	})
-	r.safeTools["memory_update"] = true
+	r.markSafe("memory_update")
 
 	// memory_delete - Delete memory by ID or content match
 	r.Register(&Tool{
@@ -893,19 +1123,46 @@ func (r *Registry) registerMemoryTools() {
 
 			// Find the memory if using search
 			if id == "" {
-				memory, err := r.store.FindMemoryByContent(search)
+				memory, err := r.storage().FindMemoryByContent(search)
 				if err != nil {
 					return "", fmt.Errorf("memory not found matching '%s'", search)
 				}
 				id = memory.ID
 			}
 
-			if err := r.store.DeleteMemory(id); err != nil {
+			if err := r.storage().DeleteMemory(id); err != nil {
 				return "", fmt.Errorf("failed to delete memory: %w", err)
 			}
 
 			return fmt.Sprintf("Memory deleted successfully (id: %s)", id), nil
 		},
 	})
-	r.safeTools["memory_delete"] = true
+	r.markSafe("memory_delete")
+}
+
+// queryMemories loads the memories matching the type and tags arguments
+// among the global ones and those of the conversation in ctx (all of them
+// outside a conversation)
+func (r *Registry) queryMemories(ctx context.Context, args map[string]interface{}) ([]*storage.MemoryItem, error) {
+	filter := storage.MemoryFilter{Tags: getStrings(args, "tags")}
+	filter.Type, _ = args["type"].(string)
+	filter.Query, _ = args["query"].(string)
+	filter.VisibleIn, _ = ConversationFromContext(ctx)
+	return r.storage().QueryMemories(filter)
+}
+
+// memoryScope describes the scope of a memory for tool output
+func memoryScope(mem *storage.MemoryItem) string {
+	if mem.Scope == "" {
+		return "global"
+	}
+	return "conversation " + mem.Scope
+}
+
+// memoryTags describes the tags of a memory for tool output
+func memoryTags(mem *storage.MemoryItem) string {
+	if len(mem.Tags) == 0 {
+		return ""
+	}
+	return ", tags: " + strings.Join(mem.Tags, ", ")
 }
@@ -1,12 +1,31 @@
 package tools
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/igm/igent/internal/netpolicy"
 	"github.com/igm/igent/internal/storage"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 func TestNewRegistry(t *testing.T) {
@@ -102,6 +121,54 @@ func TestParseToolCallInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestParseToolCallLimits(t *testing.T) {
+	huge := `{"content": "` + strings.Repeat("a", maxToolArgsBytes) + `"}`
+	if _, err := ParseToolCall("1", "write_file", huge); err == nil || !strings.Contains(err.Error(), "smaller calls") {
+		t.Errorf("oversized arguments: %v", err)
+	}
+
+	deep := `{"a": ` + strings.Repeat("[", maxToolArgsDepth) + strings.Repeat("]", maxToolArgsDepth) + "}"
+	if _, err := ParseToolCall("1", "echo", deep); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("deeply nested arguments: %v", err)
+	}
+
+	// Brackets inside strings do not count
+	brackets := `{"text": "` + strings.Repeat("[{", 100) + `\"]"}`
+	call, err := ParseToolCall("1", "echo", brackets)
+	if err != nil {
+		t.Fatalf("brackets in strings: %v", err)
+	}
+	if !strings.HasSuffix(call.Args["text"].(string), `"]`) {
+		t.Errorf("unexpected text %q", call.Args["text"])
+	}
+
+	call, err = ParseToolCall("1", "date", "null")
+	if err != nil || call.Args == nil {
+		t.Errorf("null arguments: %v, %v", call, err)
+	}
+}
+
+func FuzzParseToolCall(f *testing.F) {
+	for _, seed := range []string{
+		``, `{}`, `null`, `[]`, `{"path": "/tmp", "long": true}`, `{"a": {"b": [1, 2, {"c": null}]}}`,
+		`{"text": "\"{["}`, `{invalid json}`, `{"a": [[[[[[[[]]]]]]]]}`, `"string"`, `{"n": 1e999}`,
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, args string) {
+		call, err := ParseToolCall("id", "tool", args)
+		if err != nil {
+			return
+		}
+		if call.Args == nil {
+			t.Fatal("nil Args without error")
+		}
+		if len(args) > maxToolArgsBytes || jsonDepth(args) > maxToolArgsDepth {
+			t.Fatalf("arguments over the limits accepted: %d bytes, depth %d", len(args), jsonDepth(args))
+		}
+	})
+}
+
 func TestDateTool(t *testing.T) {
 	registry := NewRegistry()
 
@@ -660,6 +727,63 @@ func TestCurlTool_MissingURL(t *testing.T) {
 	}
 }
 
+func TestCurlTool_Local(t *testing.T) {
+	var gotMethod, gotType, gotBody, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/json", http.StatusFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotType, gotBody, gotQuery = r.Method, r.Header.Get("Content-Type"), string(body), r.URL.Query().Get("q")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	registry := NewRegistry()
+	result := registry.Execute(context.Background(), &ToolCall{
+		ID:   "1",
+		Name: "curl",
+		Args: map[string]interface{}{
+			"url":   server.URL + "/json",
+			"json":  map[string]interface{}{"name": "igent"},
+			"query": map[string]interface{}{"q": "go"},
+		},
+	})
+	if result.Error != "" {
+		t.Fatalf("curl failed: %s", result.Error)
+	}
+	if gotMethod != "POST" || gotType != "application/json" || gotBody != `{"name":"igent"}` || gotQuery != "go" {
+		t.Errorf("unexpected request: %s %s %s q=%s", gotMethod, gotType, gotBody, gotQuery)
+	}
+	for _, want := range []string{"Status: 201 Created", "  X-Test: yes", "Body:\n{\n  \"ok\": true\n}"} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("expected %q in output:\n%s", want, result.Output)
+		}
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{
+		ID:   "2",
+		Name: "curl",
+		Args: map[string]interface{}{"url": server.URL + "/redirect", "follow_redirects": false},
+	})
+	if !strings.Contains(result.Output, "Status: 302 Found") {
+		t.Errorf("expected redirect not to be followed, got:\n%s", result.Output)
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{
+		ID:   "3",
+		Name: "curl",
+		Args: map[string]interface{}{"url": "file:///etc/passwd"},
+	})
+	if result.Error == "" {
+		t.Error("expected non-HTTP scheme to be rejected")
+	}
+}
+
 func TestShellTool_Timeout(t *testing.T) {
 	registry := NewRegistry()
 
@@ -682,6 +806,63 @@ func TestShellTool_Timeout(t *testing.T) {
 	}
 }
 
+func TestShellSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	registry := NewRegistry()
+	defer registry.CloseSessions()
+	dir := t.TempDir()
+
+	run := func(conv, command string, extra map[string]interface{}) *ToolResult {
+		args := map[string]interface{}{"command": command}
+		for k, v := range extra {
+			args[k] = v
+		}
+		ctx := WithConversation(context.Background(), conv, 1)
+		return registry.Execute(ctx, &ToolCall{ID: "s", Name: "shell_session", Args: args})
+	}
+
+	// cd and exported variables persist between calls
+	if r := run("a", "cd "+dir+" && export IGENT_TEST_VAR='it''s set'", nil); r.Error != "" {
+		t.Fatalf("unexpected error: %s", r.Error)
+	}
+	r := run("a", `pwd; echo "$IGENT_TEST_VAR"; echo oops >&2`, nil)
+	resolved, _ := filepath.EvalSymlinks(dir)
+	if r.Error != "" || (r.Output != dir+"\nits set\noops" && r.Output != resolved+"\nits set\noops") {
+		t.Errorf("state not kept: output %q, error %q", r.Output, r.Error)
+	}
+
+	// Another conversation has its own shell
+	if r := run("b", `echo "${IGENT_TEST_VAR:-unset}"`, nil); r.Output != "unset" {
+		t.Errorf("expected separate session, got %q", r.Output)
+	}
+
+	// A failing command reports its status and keeps the session
+	r = run("a", "false", nil)
+	if !strings.Contains(r.Error, "status 1") {
+		t.Errorf("expected exit status error, got %q", r.Error)
+	}
+
+	// A timeout restarts the session
+	r = run("a", "sleep 5", map[string]interface{}{"timeout": 1.0})
+	if !strings.Contains(r.Error, "timed out") {
+		t.Errorf("expected timeout, got %q", r.Error)
+	}
+	if r := run("a", `echo "${IGENT_TEST_VAR:-unset}"`, nil); r.Output != "unset" {
+		t.Errorf("expected fresh session after timeout, got %q", r.Output)
+	}
+
+	// Exiting the shell ends the session; the next call starts a new one
+	run("a", "export IGENT_TEST_VAR=x", nil)
+	if r := run("a", "exit 3", nil); !strings.Contains(r.Error, "ended") {
+		t.Errorf("expected ended session, got %q", r.Error)
+	}
+	if r := run("a", `echo "${IGENT_TEST_VAR:-unset}"`, nil); r.Output != "unset" || r.Error != "" {
+		t.Errorf("expected new session, got %q (%s)", r.Output, r.Error)
+	}
+}
+
 func TestShellTool_OutputTruncation(t *testing.T) {
 	registry := NewRegistry()
 
@@ -938,6 +1119,186 @@ func TestMemoryList(t *testing.T) {
 	}
 }
 
+func TestMemoryScope(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+	inA := WithConversation(context.Background(), "a", 1)
+	inB := WithConversation(context.Background(), "b", 1)
+
+	add := func(ctx context.Context, content, scope string) ToolResult {
+		return *registry.Execute(ctx, &ToolCall{
+			ID:   "add",
+			Name: "memory_add",
+			Args: map[string]interface{}{"content": content, "type": "fact", "scope": scope},
+		})
+	}
+	if res := add(inA, "Uses tabs here", "conversation"); res.Error != "" || !strings.Contains(res.Output, "scope: conversation a") {
+		t.Fatalf("scoped add = %+v", res)
+	}
+	if res := add(inA, "Name is Sam", ""); res.Error != "" || !strings.Contains(res.Output, "scope: global") {
+		t.Fatalf("global add = %+v", res)
+	}
+	if res := add(context.Background(), "Orphan", "conversation"); res.Error == "" {
+		t.Error("scoping a memory outside a conversation should fail")
+	}
+
+	memories, _ := store.LoadMemories()
+	if len(memories) != 2 {
+		t.Fatalf("expected 2 memories, got %d", len(memories))
+	}
+
+	list := func(ctx context.Context) string {
+		return registry.Execute(ctx, &ToolCall{ID: "list", Name: "memory_list", Args: map[string]interface{}{}}).Output
+	}
+	if out := list(inA); !strings.Contains(out, "Uses tabs") || !strings.Contains(out, "Name is Sam") {
+		t.Errorf("conversation a should see both memories: %s", out)
+	}
+	if out := list(inB); strings.Contains(out, "Uses tabs") || !strings.Contains(out, "Name is Sam") {
+		t.Errorf("conversation b should only see the global memory: %s", out)
+	}
+	search := registry.Execute(inB, &ToolCall{ID: "search", Name: "memory_search", Args: map[string]interface{}{"query": "tabs"}})
+	if !strings.Contains(search.Output, "No memories found") {
+		t.Errorf("search in b should not find a's memory: %s", search.Output)
+	}
+}
+
+func TestMemoryTags(t *testing.T) {
+	registry, _, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+	ctx := context.Background()
+
+	for i, args := range []map[string]interface{}{
+		{"content": "Uses tabs", "type": "preference", "tags": []interface{}{"Project-X", "style"}},
+		{"content": "Ships on Fridays", "type": "fact", "tags": []interface{}{"project-x"}},
+		{"content": "Likes dark mode", "type": "preference"},
+	} {
+		if res := registry.Execute(ctx, &ToolCall{ID: fmt.Sprint(i), Name: "memory_add", Args: args}); res.Error != "" {
+			t.Fatalf("memory_add: %s", res.Error)
+		}
+	}
+
+	list := registry.Execute(ctx, &ToolCall{ID: "list", Name: "memory_list", Args: map[string]interface{}{
+		"type": "preference", "tags": []interface{}{"project-x"},
+	}})
+	if !strings.Contains(list.Output, "Found 1 memories") || !strings.Contains(list.Output, "tags: project-x, style) Uses tabs") {
+		t.Errorf("memory_list by type and tag: %s", list.Output)
+	}
+
+	search := registry.Execute(ctx, &ToolCall{ID: "search", Name: "memory_search", Args: map[string]interface{}{
+		"tags": []interface{}{"project-x"},
+	}})
+	if search.Error != "" || !strings.Contains(search.Output, "Found 2 memories") {
+		t.Errorf("memory_search by tag: %+v", search)
+	}
+
+	update := registry.Execute(ctx, &ToolCall{ID: "update", Name: "memory_update", Args: map[string]interface{}{
+		"search": "dark mode", "tags": []interface{}{"ui"},
+	}})
+	if update.Error != "" {
+		t.Fatalf("memory_update tags: %s", update.Error)
+	}
+	search = registry.Execute(ctx, &ToolCall{ID: "search", Name: "memory_search", Args: map[string]interface{}{
+		"query": "mode", "tags": []interface{}{"ui"},
+	}})
+	if !strings.Contains(search.Output, "Found 1 memories") {
+		t.Errorf("memory_search after tagging: %s", search.Output)
+	}
+}
+
+func TestMemoryAdd_Scorer(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+	ctx := context.Background()
+
+	registry.SetMemoryScorer(func(ctx context.Context, content, memType string) (string, float64, error) {
+		if content == "fails" {
+			return "", 0, errors.New("model unavailable")
+		}
+		return "preference", 0.4, nil
+	})
+
+	for i, args := range []map[string]interface{}{
+		{"content": "Likes tabs", "type": "fact"},
+		{"content": "Deploys on Fridays", "type": "fact", "relevance": 0.9},
+		{"content": "fails", "type": "context"},
+	} {
+		if res := registry.Execute(ctx, &ToolCall{ID: fmt.Sprint(i), Name: "memory_add", Args: args}); res.Error != "" {
+			t.Fatalf("memory_add: %s", res.Error)
+		}
+	}
+
+	memories, err := store.LoadMemories()
+	if err != nil {
+		t.Fatalf("failed to load memories: %v", err)
+	}
+	got := make(map[string]string)
+	for _, m := range memories {
+		got[m.Content] = fmt.Sprintf("%s %.1f", m.Type, m.Relevance)
+	}
+	want := map[string]string{
+		"Likes tabs":         "preference 0.4", // Scored
+		"Deploys on Fridays": "preference 0.9", // Given relevance wins
+		"fails":              "context 0.8",    // Defaults when scoring fails
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("memories = %v, want %v", got, want)
+	}
+}
+
+func TestMemoryGraph(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+	ctx := WithConversation(context.Background(), "c1", 1)
+
+	graph := func(args map[string]interface{}) *ToolResult {
+		t.Helper()
+		return registry.Execute(ctx, &ToolCall{ID: "g", Name: "memory_graph", Args: args})
+	}
+
+	res := graph(map[string]interface{}{
+		"action": "upsert", "name": "Alice", "type": "Person",
+		"aliases":    []interface{}{"Al", "alice"},
+		"attributes": map[string]interface{}{"role": "tech lead", "team": "infra"},
+	})
+	if res.Error != "" || !strings.Contains(res.Output, "Entity created: Alice (person; aka Al): role=tech lead; team=infra") {
+		t.Fatalf("upsert: %+v", res)
+	}
+	res = graph(map[string]interface{}{"action": "upsert", "name": "al", "attributes": map[string]interface{}{"team": ""}})
+	if !strings.Contains(res.Output, "Entity updated: Alice (person; aka Al): role=tech lead") {
+		t.Errorf("upsert by alias should update and remove emptied attributes: %+v", res)
+	}
+
+	res = graph(map[string]interface{}{"action": "relate", "name": "Alice", "relation": "works on", "target": "Atlas"})
+	if res.Error != "" || !strings.Contains(res.Output, "works_on Atlas") {
+		t.Fatalf("relate: %+v", res)
+	}
+	if _, err := store.LoadEntity("Atlas"); err != nil {
+		t.Errorf("relate should create the target: %v", err)
+	}
+
+	res = graph(map[string]interface{}{"action": "get", "name": "atlas"})
+	if !strings.Contains(res.Output, "- Alice works_on Atlas") {
+		t.Errorf("get should show incoming relations: %s", res.Output)
+	}
+	res = graph(map[string]interface{}{"action": "list", "type": "person"})
+	if !strings.Contains(res.Output, "Found 1 entities") {
+		t.Errorf("list by type: %s", res.Output)
+	}
+
+	res = graph(map[string]interface{}{"action": "delete", "name": "Atlas"})
+	if res.Error != "" {
+		t.Fatalf("delete: %s", res.Error)
+	}
+	alice, err := store.LoadEntity("Alice")
+	if err != nil || len(alice.Relations) != 0 || len(alice.Conversations) != 1 || alice.Conversations[0] != "c1" {
+		t.Errorf("expected relations to the deleted entity removed, got %+v (%v)", alice, err)
+	}
+
+	if res := graph(map[string]interface{}{"action": "get"}); res.Error == "" {
+		t.Error("expected an error without a name")
+	}
+}
+
 func TestMemoryList_Empty(t *testing.T) {
 	registry, _, tmpDir := setupMemoryTest(t)
 	defer os.RemoveAll(tmpDir)
@@ -1456,3 +1817,1334 @@ func TestMemoryEndToEnd(t *testing.T) {
 		t.Errorf("expected 0 memories after delete, got %d", len(finalMemories))
 	}
 }
+
+func TestShellTool_Cancelled(t *testing.T) {
+	registry := NewRegistry()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	result := registry.Execute(ctx, &ToolCall{
+		ID:   "test-cancel",
+		Name: "shell",
+		Args: map[string]interface{}{"command": "sleep 5"},
+	})
+
+	if time.Since(start) > 2*time.Second {
+		t.Error("shell command was not aborted on cancellation")
+	}
+	if !strings.Contains(result.Error, "cancelled") {
+		t.Errorf("expected cancellation error, got %q", result.Error)
+	}
+}
+
+func TestExecute_PrefersContextExecutor(t *testing.T) {
+	registry := NewRegistry()
+
+	type ctxKey struct{}
+	registry.Register(&Tool{
+		Name: "ctx_tool",
+		Executor: func(args map[string]interface{}) (string, error) {
+			return "plain", nil
+		},
+		ContextExecutor: func(ctx context.Context, args map[string]interface{}) (string, error) {
+			v, _ := ctx.Value(ctxKey{}).(string)
+			return "ctx:" + v, nil
+		},
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	result := registry.Execute(ctx, &ToolCall{ID: "1", Name: "ctx_tool"})
+	if result.Output != "ctx:value" {
+		t.Errorf("expected context executor output, got %q", result.Output)
+	}
+}
+
+func TestCurlTool_NetworkPolicy(t *testing.T) {
+	registry := NewRegistry()
+	policy, err := netpolicy.New(netpolicy.Config{AllowedHosts: []string{"example.com"}})
+	if err != nil {
+		t.Fatalf("netpolicy.New() error = %v", err)
+	}
+	registry.SetNetworkPolicy(policy)
+
+	result := registry.Execute(context.Background(), &ToolCall{
+		ID:   "1",
+		Name: "curl",
+		Args: map[string]interface{}{"url": "https://blocked.example.org/"},
+	})
+	if result.Error == "" || !strings.Contains(result.Error, "not allowed") {
+		t.Errorf("expected request to be blocked, got %+v", result)
+	}
+}
+
+func TestArtifactSave(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+
+	ctx := WithConversation(context.Background(), "conv1", 3)
+	result := registry.Execute(ctx, &ToolCall{
+		ID:   "1",
+		Name: "artifact_save",
+		Args: map[string]interface{}{"name": "hello.py", "content": "print('hi')\n", "language": "python"},
+	})
+	if result.Error != "" {
+		t.Fatalf("artifact_save failed: %s", result.Error)
+	}
+	if !registry.IsSafeTool("artifact_save") {
+		t.Error("artifact_save should not require confirmation")
+	}
+
+	a, err := store.FindArtifact("hello.py")
+	if err != nil {
+		t.Fatalf("artifact not stored: %v", err)
+	}
+	if a.ConversationID != "conv1" || a.Turn != 3 || a.Language != "python" {
+		t.Errorf("unexpected artifact metadata: %+v", a)
+	}
+
+	result = registry.Execute(ctx, &ToolCall{ID: "2", Name: "artifact_save", Args: map[string]interface{}{"name": "empty"}})
+	if result.Error == "" {
+		t.Error("expected error for missing content")
+	}
+}
+
+func TestArtifactReadTool(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+
+	a, err := store.SaveArtifact(&storage.Artifact{Name: "out.txt"}, []byte("one\ntwo\nthree\n"))
+	if err != nil {
+		t.Fatalf("SaveArtifact failed: %v", err)
+	}
+
+	result := registry.Execute(context.Background(), &ToolCall{
+		ID:   "1",
+		Name: "artifact_read",
+		Args: map[string]interface{}{"ref": a.ShortHash(), "start_line": float64(2), "end_line": float64(3)},
+	})
+	if result.Error != "" {
+		t.Fatalf("artifact_read failed: %s", result.Error)
+	}
+	if result.Output != "two\nthree\n" {
+		t.Errorf("unexpected line range: %q", result.Output)
+	}
+	if !registry.IsSafeTool("artifact_read") {
+		t.Error("artifact_read should not require confirmation")
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{ID: "2", Name: "artifact_read", Args: map[string]interface{}{"ref": "missing"}})
+	if result.Error == "" {
+		t.Error("expected error for unknown artifact")
+	}
+}
+
+func TestDocumentTools(t *testing.T) {
+	registry, store, tmpDir := setupMemoryTest(t)
+	defer os.RemoveAll(tmpDir)
+
+	ctx := WithConversation(context.Background(), "draft", 1)
+	run := func(name string, args map[string]interface{}) *ToolResult {
+		return registry.Execute(ctx, &ToolCall{ID: name, Name: name, Args: args})
+	}
+
+	if result := run("document_read", nil); !strings.Contains(result.Output, "No working document") {
+		t.Errorf("expected empty document, got %q", result.Output)
+	}
+
+	result := run("document_write", map[string]interface{}{
+		"title":   "Plan",
+		"content": "# Plan\n\n## Goals\n\nOld goals\n\n## Risks\n\nNone\n",
+	})
+	if result.Error != "" || !strings.Contains(result.Output, "version 1") {
+		t.Fatalf("document_write failed: %+v", result)
+	}
+
+	result = run("document_replace_section", map[string]interface{}{"heading": "goals", "content": "Ship v1"})
+	if result.Error != "" || !strings.Contains(result.Output, "-Old goals") || !strings.Contains(result.Output, "+Ship v1") {
+		t.Fatalf("document_replace_section returned unexpected diff: %+v", result)
+	}
+
+	run("document_append", map[string]interface{}{"content": "## Notes\n\nDone.\n"})
+
+	doc, err := store.LoadDocument("draft")
+	if err != nil {
+		t.Fatalf("LoadDocument() error = %v", err)
+	}
+	want := "# Plan\n\n## Goals\n\nShip v1\n\n## Risks\n\nNone\n## Notes\n\nDone.\n"
+	if doc.Content != want || doc.Version != 3 || doc.Title != "Plan" {
+		t.Errorf("unexpected document (version %d):\n%q\nwant:\n%q", doc.Version, doc.Content, want)
+	}
+
+	if result := run("document_diff", nil); !strings.Contains(result.Output, "+## Notes") {
+		t.Errorf("expected diff of last append, got %q", result.Output)
+	}
+
+	if result := registry.Execute(context.Background(), &ToolCall{ID: "x", Name: "document_read"}); result.Error == "" {
+		t.Error("expected error without an active conversation")
+	}
+}
+
+func TestReplaceSection(t *testing.T) {
+	tests := []struct {
+		name, content, heading, body, want string
+	}{
+		{
+			name:    "nested sections are part of the parent",
+			content: "# A\n\n## B\n\nb\n\n### C\n\nc\n\n## D\n\nd\n",
+			heading: "B", body: "new",
+			want: "# A\n\n## B\n\nnew\n\n## D\n\nd\n",
+		},
+		{
+			name:    "last section keeps trailing newline",
+			content: "## A\n\na\n",
+			heading: "A", body: "x\n",
+			want: "## A\n\nx\n",
+		},
+		{
+			name:    "missing section is appended",
+			content: "## A\n\na\n",
+			heading: "B", body: "b",
+			want: "## A\n\na\n\n## B\n\nb\n",
+		},
+		{
+			name:    "empty document",
+			content: "",
+			heading: "Intro", body: "hi",
+			want: "## Intro\n\nhi\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceSection(tt.content, tt.heading, tt.body); got != tt.want {
+				t.Errorf("replaceSection() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditFile(t *testing.T) {
+	registry := NewRegistry()
+	dir := t.TempDir()
+	path := dir + "/main.go"
+	edit := func(args map[string]interface{}) *ToolResult {
+		args["path"] = path
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "edit_file", Args: args})
+	}
+
+	if registry.IsSafeTool("edit_file") {
+		t.Error("edit_file should require confirmation")
+	}
+
+	// Create
+	result := edit(map[string]interface{}{"new_string": "package main\n\nfunc a() int { return 1 }\nfunc b() int { return 1 }\n"})
+	if result.Error != "" || !strings.Contains(result.Output, "Created") {
+		t.Fatalf("create failed: %+v", result)
+	}
+	os.Chmod(path, 0600)
+
+	// Ambiguous search/replace is rejected
+	result = edit(map[string]interface{}{"old_string": "return 1", "new_string": "return 2"})
+	if !strings.Contains(result.Error, "matches 2 times") {
+		t.Errorf("expected ambiguity error, got %+v", result)
+	}
+
+	// Unique search/replace returns the diff
+	result = edit(map[string]interface{}{"old_string": "func a() int { return 1 }", "new_string": "func a() int { return 2 }"})
+	if result.Error != "" || !strings.Contains(result.Output, "+func a() int { return 2 }") {
+		t.Fatalf("replace failed: %+v", result)
+	}
+
+	// Unified diff
+	patch := "--- a/main.go\n+++ b/main.go\n@@ -4 +4 @@\n-func b() int { return 1 }\n+func b() int { return 3 }\n"
+	result = edit(map[string]interface{}{"patch": patch})
+	if result.Error != "" {
+		t.Fatalf("patch failed: %+v", result)
+	}
+
+	data, _ := os.ReadFile(path)
+	if want := "package main\n\nfunc a() int { return 2 }\nfunc b() int { return 3 }\n"; string(data) != want {
+		t.Errorf("unexpected file content: %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected file mode to be preserved, got %v", info.Mode().Perm())
+	}
+
+	// Failed edits leave the file untouched
+	result = edit(map[string]interface{}{"patch": "@@ -1 +1 @@\n-nope\n+x\n"})
+	if result.Error == "" {
+		t.Error("expected error for patch that does not apply")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(data) {
+		t.Error("file changed after failed edit")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected no leftover temp files, got %d entries", len(entries))
+	}
+}
+
+func TestGrepTool(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":         "package a\n\nfunc Hello() {}\n",
+		"sub/b.go":     "package b\n\n// hello world\nfunc World() {}\n",
+		".git/config":  "hello from git\n",
+		"bin/data.bin": "hello\x00binary",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := NewRegistry()
+	grep := func(args map[string]interface{}) *ToolResult {
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "grep", Args: args})
+	}
+
+	result := grep(map[string]interface{}{"pattern": "hello", "path": dir, "ignore_case": true})
+	if result.Error != "" {
+		t.Fatalf("grep failed: %s", result.Error)
+	}
+	if !strings.Contains(result.Output, "a.go:3:func Hello() {}") || !strings.Contains(result.Output, "b.go:3:// hello world") {
+		t.Errorf("expected matches with line numbers, got:\n%s", result.Output)
+	}
+	if strings.Contains(result.Output, ".git") || strings.Contains(result.Output, "data.bin") {
+		t.Errorf("expected .git and binary files to be skipped, got:\n%s", result.Output)
+	}
+	if !strings.Contains(result.Output, "2 matches in 2 files") {
+		t.Errorf("expected match summary, got:\n%s", result.Output)
+	}
+
+	result = grep(map[string]interface{}{"pattern": "hello", "path": dir, "ignore_case": true, "recursive": false})
+	if strings.Contains(result.Output, "b.go") {
+		t.Errorf("expected non-recursive search to skip subdirectories, got:\n%s", result.Output)
+	}
+
+	result = grep(map[string]interface{}{"pattern": "^(package|func)", "path": dir, "max_matches": float64(2)})
+	if !strings.Contains(result.Output, "stopped after 2 matches") {
+		t.Errorf("expected match limit notice, got:\n%s", result.Output)
+	}
+
+	if result := grep(map[string]interface{}{"pattern": "nomatch", "path": dir}); result.Output != "No matches found." {
+		t.Errorf("expected no matches, got %q", result.Output)
+	}
+	if result := grep(map[string]interface{}{"pattern": "(", "path": dir}); result.Error == "" {
+		t.Error("expected error for invalid pattern")
+	}
+}
+
+func TestGitTools(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "Test"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := NewRegistry()
+	git := func(name string, args map[string]interface{}) *ToolResult {
+		args["repo"] = repo
+		return registry.Execute(context.Background(), &ToolCall{ID: name, Name: name, Args: args})
+	}
+
+	if result := git("git_status", map[string]interface{}{}); !strings.Contains(result.Output, "?? a.txt") {
+		t.Errorf("expected untracked file in status, got %+v", result)
+	}
+
+	result := git("git_commit", map[string]interface{}{"message": "Add a.txt", "files": []interface{}{"a.txt"}})
+	if result.Error != "" {
+		t.Fatalf("git_commit failed: %s", result.Error)
+	}
+	if registry.IsSafeTool("git_commit") {
+		t.Error("git_commit should require confirmation")
+	}
+	if !registry.IsSafeTool("git_status") || !registry.IsSafeTool("git_diff") || !registry.IsSafeTool("git_log") {
+		t.Error("read-only git tools should not require confirmation")
+	}
+
+	if result := git("git_log", map[string]interface{}{}); !strings.Contains(result.Output, "Add a.txt") {
+		t.Errorf("expected commit in log, got %+v", result)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = git("git_diff", map[string]interface{}{})
+	if !strings.Contains(result.Output, "-one") || !strings.Contains(result.Output, "+two") {
+		t.Errorf("expected unstaged change in diff, got %+v", result)
+	}
+	if result := git("git_diff", map[string]interface{}{"staged": true}); result.Output != "No changes." {
+		t.Errorf("expected no staged changes, got %+v", result)
+	}
+
+	if result := git("git_commit", map[string]interface{}{"message": "Nothing staged"}); result.Error == "" {
+		t.Error("expected error committing with nothing staged")
+	}
+	if result := git("git_diff", map[string]interface{}{"commit": "--output=/tmp/x"}); result.Error == "" {
+		t.Error("expected option-like commit to be rejected")
+	}
+}
+
+func TestWebSearchTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		switch r.URL.Path {
+		case "/searx/search":
+			if r.URL.Query().Get("format") != "json" {
+				http.Error(w, "format", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"results":[{"title":"Go","url":"https://go.dev","content":"The <b>%s</b> language"},{"title":"Two","url":"https://two.example"}]}`, q)
+		case "/brave":
+			if r.Header.Get("X-Subscription-Token") != "brave-key" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"web":{"results":[{"title":"Brave hit","url":"https://brave.example","description":"snippet &amp; more"}]}}`)
+		case "/ddg":
+			fmt.Fprint(w, `<div class="result"><a rel="nofollow" class="result__a" href="//duckduckgo.com/l/?uddg=https%3A%2F%2Fddg.example%2Fpage&amp;rut=x">DDG <b>hit</b></a>
+<a class="result__snippet" href="#">A <b>duck</b> snippet</a></div>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	search := func(cfg SearchConfig, args map[string]interface{}) *ToolResult {
+		registry := NewRegistry()
+		if err := registry.SetSearch(cfg); err != nil {
+			t.Fatalf("SetSearch failed: %v", err)
+		}
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "web_search", Args: args})
+	}
+
+	result := search(SearchConfig{Backend: "searxng", URL: server.URL + "/searx"}, map[string]interface{}{"query": "golang", "max_results": float64(1)})
+	if result.Error != "" {
+		t.Fatalf("searxng search failed: %s", result.Error)
+	}
+	if !strings.Contains(result.Output, "1. Go\n   https://go.dev\n   The golang language") || strings.Contains(result.Output, "Two") {
+		t.Errorf("unexpected searxng output:\n%s", result.Output)
+	}
+
+	result = search(SearchConfig{Backend: "brave", URL: server.URL + "/brave", APIKey: "brave-key"}, map[string]interface{}{"query": "q"})
+	if !strings.Contains(result.Output, "https://brave.example") || !strings.Contains(result.Output, "snippet & more") {
+		t.Errorf("unexpected brave output: %+v", result)
+	}
+
+	result = search(SearchConfig{Backend: "duckduckgo", URL: server.URL + "/ddg"}, map[string]interface{}{"query": "q"})
+	if !strings.Contains(result.Output, "1. DDG hit\n   https://ddg.example/page\n   A duck snippet") {
+		t.Errorf("unexpected duckduckgo output: %+v", result)
+	}
+
+	registry := NewRegistry()
+	if _, ok := registry.Get("web_search"); ok {
+		t.Error("web_search should not be registered without a backend")
+	}
+	if err := registry.SetSearch(SearchConfig{Backend: "bing"}); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+	if err := registry.SetSearch(SearchConfig{Backend: "brave"}); err == nil {
+		t.Error("expected error for brave without an API key")
+	}
+	if err := registry.SetSearch(SearchConfig{Backend: "searxng"}); err == nil {
+		t.Error("expected error for searxng without a URL")
+	}
+}
+
+func TestRunCodeTool(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	registry := NewRegistry()
+	if err := registry.SetCodeRunner(CodeConfig{Backend: "process", CPUSeconds: 1, MemoryMB: 256}); err != nil {
+		t.Fatalf("SetCodeRunner() error = %v", err)
+	}
+	if registry.IsSafeTool("run_code") {
+		t.Error("run_code should require confirmation")
+	}
+	t.Setenv("IGENT_TEST_SECRET", "hunter2")
+
+	var live strings.Builder
+	ctx := WithOutput(context.Background(), func(chunk string) { live.WriteString(chunk) })
+	result := registry.Execute(ctx, &ToolCall{
+		ID:   "1",
+		Name: "run_code",
+		Args: map[string]interface{}{
+			"language": "bash",
+			"code":     "read name; echo \"hello $name\"; echo \"secret=$IGENT_TEST_SECRET\"; echo oops >&2; exit 3",
+			"stdin":    "igent\n",
+		},
+	})
+	if result.Error != "" {
+		t.Fatalf("run_code failed: %s", result.Error)
+	}
+	for _, want := range []string{"stdout:\nhello igent\nsecret=\n", "stderr:\noops", "exit code: 3"} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("expected %q in output:\n%s", want, result.Output)
+		}
+	}
+	if !strings.Contains(live.String(), "hello igent") {
+		t.Errorf("expected output streamed live, got %q", live.String())
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{
+		ID:   "2",
+		Name: "run_code",
+		Args: map[string]interface{}{"language": "bash", "code": "echo started; sleep 5", "timeout": 1.0},
+	})
+	if !strings.Contains(result.Output, "started") || !strings.Contains(result.Output, "timed out after 1 seconds") {
+		t.Errorf("expected partial output and timeout, got %+v", result)
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{
+		ID:   "3",
+		Name: "run_code",
+		Args: map[string]interface{}{"language": "bash", "code": "while :; do :; done", "timeout": 10.0},
+	})
+	if !strings.Contains(result.Output, "killed") {
+		t.Errorf("expected CPU limit to kill the snippet, got %+v", result)
+	}
+
+	result = registry.Execute(context.Background(), &ToolCall{
+		ID:   "4",
+		Name: "run_code",
+		Args: map[string]interface{}{"language": "cobol", "code": "DISPLAY 'HI'."},
+	})
+	if result.Error == "" {
+		t.Error("expected error for unsupported language")
+	}
+}
+
+func TestRunCodeConfig(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.SetCodeRunner(CodeConfig{}); err != nil || registry.tools["run_code"] != nil {
+		t.Errorf("expected run_code to stay disabled without a backend, err = %v", err)
+	}
+	if err := registry.SetCodeRunner(CodeConfig{Backend: "vm"}); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+
+	args := strings.Join(dockerRunArgs(CodeConfig{MemoryMB: 256, CPUSeconds: 5}, codeLanguages["python"], "/tmp/x", "c1"), " ")
+	for _, want := range []string{"--network none", "--read-only", "--memory 256m", "--ulimit cpu=5:5", "-v /tmp/x:/work:ro", "python:3-alpine python3 -I -u main.py"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("expected %q in docker args: %s", want, args)
+		}
+	}
+
+	// Only the docker backend promises to discard what the snippet writes
+	for backend, want := range map[string]string{"process": "can still read and write the user's files", "docker": "files written there are discarded"} {
+		registry := NewRegistry()
+		if err := registry.SetCodeRunner(CodeConfig{Backend: backend}); err != nil {
+			t.Fatal(err)
+		}
+		if desc := registry.tools["run_code"].Description; !strings.Contains(desc, want) {
+			t.Errorf("expected the %s description to say %q, got %q", backend, want, desc)
+		}
+	}
+}
+
+func TestDockerTools(t *testing.T) {
+	// A fake docker binary echoes its arguments
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = exec ] && [ \"$FAKE_DOCKER_SLEEP\" = 1 ]; then sleep 5; fi\necho \"docker $*\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	registry := NewRegistry()
+	if !registry.IsSafeTool("docker_ps") || !registry.IsSafeTool("docker_logs") || registry.IsSafeTool("docker_exec") {
+		t.Error("docker_ps and docker_logs should be safe, docker_exec should require confirmation")
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"docker_ps", map[string]interface{}{"all": true, "filter": "name=web"}, "--all --filter name=web"},
+		{"docker_logs", map[string]interface{}{"container": "web", "tail": 20.0, "since": "10m"}, "docker logs --tail 20 --since 10m -- web"},
+		{"docker_exec", map[string]interface{}{"container": "web", "command": "ls /app", "workdir": "/app"}, "docker exec -i --workdir /app -- web sh -c ls /app"},
+	}
+	for _, tt := range tests {
+		result := registry.Execute(context.Background(), &ToolCall{ID: "1", Name: tt.name, Args: tt.args})
+		if result.Error != "" || !strings.Contains(result.Output, tt.want) {
+			t.Errorf("%s: expected %q, got %+v", tt.name, tt.want, result)
+		}
+	}
+
+	result := registry.Execute(context.Background(), &ToolCall{ID: "2", Name: "docker_logs", Args: map[string]interface{}{"container": "--help"}})
+	if result.Error == "" {
+		t.Error("expected option-like container to be rejected")
+	}
+
+	t.Setenv("FAKE_DOCKER_SLEEP", "1")
+	result = registry.Execute(context.Background(), &ToolCall{ID: "3", Name: "docker_exec", Args: map[string]interface{}{"container": "web", "command": "sleep 60", "timeout": 1.0}})
+	if !strings.Contains(result.Error, "timed out") {
+		t.Errorf("expected timeout, got %+v", result)
+	}
+}
+
+func TestSSHTool(t *testing.T) {
+	clientKey := newSSHSigner(t)
+	addr, hostKey := startSSHServer(t, clientKey.PublicKey())
+	host, port, _ := net.SplitHostPort(addr)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_ed25519")
+	writeSSHKey(t, keyFile)
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{addr}, hostKey)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	registry := NewRegistry()
+	if _, ok := registry.Get("ssh"); ok {
+		t.Fatal("ssh should not be registered without allowed hosts")
+	}
+	if err := registry.SetSSH(SSHConfig{Hosts: []string{host}, KnownHostsFile: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected missing known hosts file to be reported")
+	}
+	if err := registry.SetSSH(SSHConfig{
+		Hosts:          []string{host},
+		User:           "ops",
+		IdentityFiles:  []string{keyFile},
+		KnownHostsFile: knownHosts,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if registry.IsSafeTool("ssh") {
+		t.Error("ssh should require confirmation")
+	}
+
+	run := func(target, command string) ToolResult {
+		return *registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "ssh", Args: map[string]interface{}{"host": target, "command": command}})
+	}
+
+	result := run(host+":"+port, "uptime")
+	if result.Error != "" || !strings.Contains(result.Output, "ops ran: uptime") || !strings.HasSuffix(result.Output, "exit status: 0") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	result = run("root@"+host+":"+port, "exit 3")
+	if !strings.Contains(result.Output, "root ran: exit 3") || !strings.HasSuffix(result.Output, "exit status: 3") {
+		t.Errorf("expected exit status 3, got %+v", result)
+	}
+	if result = run("example.com", "uptime"); !strings.Contains(result.Error, "not in ssh.hosts") {
+		t.Errorf("expected disallowed host to be rejected, got %+v", result)
+	}
+
+	// Host keys not in known_hosts are refused
+	if err := os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{"other.example"}, hostKey)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if result = run(host+":"+port, "uptime"); !strings.Contains(result.Error, "not in "+knownHosts) {
+		t.Errorf("expected unknown host key to be refused, got %+v", result)
+	}
+}
+
+func TestParseSSHTarget(t *testing.T) {
+	tests := []struct {
+		target, user, host, port string
+	}{
+		{"web1", "deploy", "web1", "22"},
+		{"root@Web1.example.com", "root", "web1.example.com", "22"},
+		{"web1:2222", "deploy", "web1", "2222"},
+		{"admin@[::1]:2200", "admin", "::1", "2200"},
+	}
+	for _, tt := range tests {
+		user, host, port, err := parseSSHTarget(tt.target, "deploy")
+		if err != nil || user != tt.user || host != tt.host || port != tt.port {
+			t.Errorf("parseSSHTarget(%q) = %s, %s, %s, %v", tt.target, user, host, port, err)
+		}
+	}
+	for _, bad := range []string{"-oProxyCommand=x", "web1:99999", "@"} {
+		if _, _, _, err := parseSSHTarget(bad, "deploy"); err == nil {
+			t.Errorf("parseSSHTarget(%q) should fail", bad)
+		}
+	}
+
+	if !sshHostAllowed([]string{"*.example.com"}, "db.example.com") || sshHostAllowed([]string{"*.example.com"}, "example.org") {
+		t.Error("wildcard host patterns not matched correctly")
+	}
+}
+
+// testSSHKey is the client key used by TestSSHTool
+var testSSHKey = func() ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	copy(seed, "igent ssh tool test key")
+	return ed25519.NewKeyFromSeed(seed)
+}()
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	signer, err := ssh.NewSignerFromKey(testSSHKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func writeSSHKey(t *testing.T, path string) {
+	block, err := ssh.MarshalPrivateKey(testSSHKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startSSHServer runs an SSH server accepting clientKey whose exec requests
+// reply "<user> ran: <command>", exiting with N for "exit N"
+func startSSHServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return ln.Addr().String(), hostSigner.PublicKey()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		for req := range chReqs {
+			if req.Type != "exec" {
+				req.Reply(false, nil)
+				continue
+			}
+			var payload struct{ Command string }
+			ssh.Unmarshal(req.Payload, &payload)
+			req.Reply(true, nil)
+
+			fmt.Fprintf(ch, "%s ran: %s\n", sconn.User(), payload.Command)
+			status := 0
+			fmt.Sscanf(payload.Command, "exit %d", &status)
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			ch.Close()
+		}
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	names := func(r *Registry) []string {
+		var out []string
+		for _, tool := range r.List() {
+			out = append(out, tool.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	registry := NewRegistry()
+	if err := registry.Restrict([]string{"shell", "cat", "git_*"}, []string{"git_commit"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cat", "git_diff", "git_log", "git_status", "shell"}
+	if got := names(registry); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Restrict() left %v, want %v", got, want)
+	}
+	if result := registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "ls"}); !strings.Contains(result.Error, "unknown tool") {
+		t.Errorf("disabled tool should not run, got %+v", result)
+	}
+
+	registry = NewRegistry()
+	if err := registry.Restrict(nil, []string{"*"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(registry); len(got) != 0 {
+		t.Errorf("expected no tools, got %v", got)
+	}
+
+	if err := NewRegistry().Restrict([]string{"[shell"}, nil); err == nil {
+		t.Error("expected invalid pattern to be rejected")
+	}
+}
+
+func TestToolLimits(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&Tool{
+		Name: "slow",
+		Executor: func(args map[string]interface{}) (string, error) {
+			time.Sleep(3 * time.Second)
+			return "done", nil
+		},
+	})
+	if err := registry.SetLimits(map[string]ToolLimits{
+		"shell": {Timeout: 1, MaxOutput: 10},
+		"slow":  {Timeout: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := func(name string, args map[string]interface{}) *ToolResult {
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: name, Args: args})
+	}
+
+	result := exec("shell", map[string]interface{}{"command": "echo 0123456789abcdef"})
+	if result.Output != "0123456789"+truncatedNote {
+		t.Errorf("expected output cut at 10 bytes, got %+v", result)
+	}
+	start := time.Now()
+	result = exec("shell", map[string]interface{}{"command": "sleep 5"})
+	if !strings.Contains(result.Error, "timed out after 1 seconds") || time.Since(start) > 3*time.Second {
+		t.Errorf("expected configured shell timeout, got %+v", result)
+	}
+	result = exec("slow", nil)
+	if !strings.Contains(result.Error, "slow timed out after 1 seconds") {
+		t.Errorf("expected executor deadline, got %+v", result)
+	}
+
+	// Calls may ask for up to max_timeout
+	ctx := context.WithValue(context.Background(), limitsKey{}, ToolLimits{Timeout: 60, MaxTimeout: 200})
+	if got := callTimeout(ctx, map[string]interface{}{"timeout": 500.0}, 30, 120); got != 200 {
+		t.Errorf("callTimeout() = %d, want 200", got)
+	}
+	if got := callTimeout(ctx, nil, 30, 120); got != 60 {
+		t.Errorf("callTimeout() = %d, want 60", got)
+	}
+	if got := callTimeout(context.Background(), map[string]interface{}{"timeout": 500.0}, 30, 120); got != 120 {
+		t.Errorf("callTimeout() = %d, want 120", got)
+	}
+
+	if err := registry.SetLimits(map[string]ToolLimits{"shell": {Timeout: -1}}); err == nil {
+		t.Error("expected negative limits to be rejected")
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("plugins are shell scripts in this test")
+	}
+	dir := t.TempDir()
+	write := func(name, content string, mode os.FileMode) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("echo_args", "#!/bin/sh\ncat\necho\necho \"conv=$IGENT_CONVERSATION\"\n", 0755)
+	write("echo_args.json", `{"description": "Echo the arguments", "parameters": {"type": "object", "properties": {"text": {"type": "string"}}}}`, 0644)
+	write("fail", "#!/bin/sh\necho 'bad input' >&2\nexit 3\n", 0755)
+	write("fail.json", `{"name": "always_fail", "description": "Fails"}`, 0644)
+	write("shell", "#!/bin/sh\necho hijacked\n", 0755)
+	write("shell.json", `{"description": "Not the real shell"}`, 0644)
+	write("noexec", "#!/bin/sh\necho hi\n", 0644)
+	write("noexec.json", `{"description": "Not executable"}`, 0644)
+	write("missing.json", `{"description": "No executable"}`, 0644)
+
+	r := NewRegistry()
+	if err := r.LoadPlugins(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadPlugins(filepath.Join(dir, "nope")); err != nil {
+		t.Errorf("missing plugin dir: %v", err)
+	}
+
+	tool, ok := r.Get("echo_args")
+	if !ok || tool.Description != "Echo the arguments" {
+		t.Fatalf("echo_args not registered: %+v", tool)
+	}
+	for _, name := range []string{"noexec", "missing"} {
+		if _, ok := r.Get(name); ok {
+			t.Errorf("broken plugin %s registered", name)
+		}
+	}
+	if shell, _ := r.Get("shell"); shell.Description == "Not the real shell" {
+		t.Error("plugin replaced the built-in shell tool")
+	}
+
+	ctx := WithConversation(context.Background(), "proj/default", 2)
+	result := r.Execute(ctx, &ToolCall{ID: "1", Name: "echo_args", Args: map[string]interface{}{"text": "hi"}})
+	if result.Error != "" || result.Output != "{\"text\":\"hi\"}\nconv=proj/default" {
+		t.Errorf("echo_args = %q, error %q", result.Output, result.Error)
+	}
+
+	result = r.Execute(ctx, &ToolCall{ID: "2", Name: "always_fail", Args: map[string]interface{}{}})
+	if !strings.Contains(result.Error, "exit status 3: bad input") {
+		t.Errorf("always_fail error = %q", result.Error)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	type Location struct {
+		City    string `json:"city" desc:"City name"`
+		Country string `json:"country,omitempty"`
+	}
+	type forecastArgs struct {
+		Location
+		Units  string            `json:"units,omitempty" enum:"metric,imperial"`
+		Days   *int              `json:"days" desc:"Forecast days"`
+		Tags   []string          `json:"tags,omitempty"`
+		Extra  map[string]string `json:"extra,omitempty"`
+		hidden bool
+	}
+
+	r := NewRegistry()
+	var got forecastArgs
+	err := RegisterFunc(r, "forecast", "Weather forecast", func(ctx context.Context, args forecastArgs) (string, error) {
+		got = args
+		return "sunny in " + args.City, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterFunc failed: %v", err)
+	}
+
+	tool, _ := r.Get("forecast")
+	props := tool.Parameters["properties"].(map[string]interface{})
+	if city := props["city"].(map[string]interface{}); city["type"] != "string" || city["description"] != "City name" {
+		t.Errorf("city schema = %v", city)
+	}
+	if units := props["units"].(map[string]interface{}); !reflect.DeepEqual(units["enum"], []string{"metric", "imperial"}) {
+		t.Errorf("units schema = %v", units)
+	}
+	if tags := props["tags"].(map[string]interface{}); tags["type"] != "array" || tags["items"].(map[string]interface{})["type"] != "string" {
+		t.Errorf("tags schema = %v", tags)
+	}
+	if _, ok := props["hidden"]; ok {
+		t.Error("unexported field in schema")
+	}
+	if req := tool.Parameters["required"]; !reflect.DeepEqual(req, []string{"city"}) {
+		t.Errorf("required = %v", req)
+	}
+
+	result := r.Execute(context.Background(), &ToolCall{ID: "1", Name: "forecast", Args: map[string]interface{}{
+		"city": "Oslo", "days": 3.0, "tags": []interface{}{"wind"},
+	}})
+	if result.Error != "" || result.Output != "sunny in Oslo" {
+		t.Fatalf("forecast = %q, error %q", result.Output, result.Error)
+	}
+	if got.Days == nil || *got.Days != 3 || got.Tags[0] != "wind" {
+		t.Errorf("decoded args = %+v", got)
+	}
+
+	result = r.Execute(context.Background(), &ToolCall{ID: "2", Name: "forecast", Args: map[string]interface{}{}})
+	if result.Error != "city is required" {
+		t.Errorf("missing field error = %q", result.Error)
+	}
+	result = r.Execute(context.Background(), &ToolCall{ID: "3", Name: "forecast", Args: map[string]interface{}{"city": "Oslo", "days": "three"}})
+	if result.Error != "invalid arguments: days must be integer, not string" {
+		t.Errorf("type error = %q", result.Error)
+	}
+
+	if err := RegisterFunc(r, "forecast", "", func(context.Context, forecastArgs) (string, error) { return "", nil }); err == nil {
+		t.Error("expected error registering a duplicate name")
+	}
+	if err := RegisterFunc(r, "bad", "", func(context.Context, string) (string, error) { return "", nil }); err == nil {
+		t.Error("expected error for non-struct arguments")
+	}
+	type node struct {
+		Next *node `json:"next"`
+	}
+	if err := RegisterFunc(r, "recursive", "", func(context.Context, node) (string, error) { return "", nil }); err == nil {
+		t.Error("expected error for a recursive type")
+	}
+}
+
+func TestFileTools(t *testing.T) {
+	registry := NewRegistry()
+	dir := t.TempDir()
+	run := func(name string, args map[string]interface{}) *ToolResult {
+		t.Helper()
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: name, Args: args})
+	}
+
+	for name, safe := range map[string]bool{"make_dir": true, "copy": false, "move": false, "remove": false} {
+		if registry.IsSafeTool(name) != safe {
+			t.Errorf("IsSafeTool(%s) = %v, want %v", name, !safe, safe)
+		}
+	}
+
+	src := filepath.Join(dir, "src", "nested")
+	if res := run("make_dir", map[string]interface{}{"path": src}); res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	os.WriteFile(filepath.Join(src, "a.sh"), []byte("echo a"), 0755)
+	os.Symlink("a.sh", filepath.Join(src, "link"))
+
+	// Copy a tree into an existing directory
+	os.Mkdir(filepath.Join(dir, "dst"), 0755)
+	if res := run("copy", map[string]interface{}{"source": filepath.Join(dir, "src"), "destination": filepath.Join(dir, "dst")}); res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	copied := filepath.Join(dir, "dst", "src", "nested")
+	if info, err := os.Stat(filepath.Join(copied, "a.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("copied file: %v %v", info, err)
+	}
+	if link, _ := os.Readlink(filepath.Join(copied, "link")); link != "a.sh" {
+		t.Errorf("symlink not kept: %q", link)
+	}
+	if res := run("copy", map[string]interface{}{"source": filepath.Join(dir, "src"), "destination": filepath.Join(dir, "dst")}); !strings.Contains(res.Error, "already exists") {
+		t.Errorf("copy should not overwrite, got %q", res.Error)
+	}
+	if res := run("copy", map[string]interface{}{"source": filepath.Join(dir, "src"), "destination": src}); !strings.Contains(res.Error, "into itself") {
+		t.Errorf("expected copy into itself error, got %q", res.Error)
+	}
+
+	// Move refuses to replace a file unless asked
+	a, b := filepath.Join(src, "a.sh"), filepath.Join(dir, "b.sh")
+	os.WriteFile(b, []byte("old"), 0644)
+	if res := run("move", map[string]interface{}{"source": a, "destination": b}); res.Error == "" {
+		t.Error("move should not overwrite without overwrite")
+	}
+	if res := run("move", map[string]interface{}{"source": a, "destination": b, "overwrite": true}); res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "echo a" {
+		t.Errorf("moved content = %q", data)
+	}
+	if _, err := os.Stat(a); !os.IsNotExist(err) {
+		t.Error("source still exists after move")
+	}
+
+	// Non-empty directories need recursive
+	if res := run("remove", map[string]interface{}{"path": filepath.Join(dir, "dst")}); !strings.Contains(res.Error, "recursive") {
+		t.Errorf("expected recursive hint, got %q", res.Error)
+	}
+	if res := run("remove", map[string]interface{}{"path": filepath.Join(dir, "dst"), "recursive": true}); res.Error != "" {
+		t.Fatal(res.Error)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dst")); !os.IsNotExist(err) {
+		t.Error("directory not removed")
+	}
+	if res := run("remove", map[string]interface{}{"path": "/", "recursive": true}); !strings.Contains(res.Error, "refusing") {
+		t.Errorf("expected refusal for /, got %q", res.Error)
+	}
+}
+
+func TestClipboardTools(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("uses a fake xclip")
+	}
+	dir := t.TempDir()
+	store := filepath.Join(dir, "clipboard")
+	script := "#!/bin/sh\ncase \"$3\" in\n-i) cat > " + store + " ;;\n-o) cat " + store + " 2>/dev/null || { echo 'Error: target STRING not available' >&2; exit 1; } ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("WAYLAND_DISPLAY", "")
+
+	registry := NewRegistry()
+	if registry.IsSafeTool("clipboard_get") || registry.IsSafeTool("clipboard_set") {
+		t.Error("clipboard tools should need confirmation")
+	}
+	get := &ToolCall{ID: "1", Name: "clipboard_get", Args: map[string]interface{}{}}
+	if res := registry.Execute(context.Background(), get); res.Error != "" || res.Output != "(clipboard is empty)" {
+		t.Errorf("empty clipboard: %+v", res)
+	}
+	set := &ToolCall{ID: "2", Name: "clipboard_set", Args: map[string]interface{}{"text": "héllo\nworld"}}
+	if res := registry.Execute(context.Background(), set); res.Error != "" || !strings.Contains(res.Output, "11 characters") {
+		t.Fatalf("set: %+v", res)
+	}
+	if res := registry.Execute(context.Background(), get); res.Output != "héllo\nworld" {
+		t.Errorf("get = %+v", res)
+	}
+}
+
+func TestProcessTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	registry := NewRegistry()
+	if registry.IsSafeTool("proc_info") || !registry.IsSafeTool("top") || registry.IsSafeTool("kill") {
+		t.Error("top should be safe, proc_info and kill should need confirmation")
+	}
+	ctx := context.Background()
+
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	pid := float64(cmd.Process.Pid)
+
+	info := registry.Execute(ctx, &ToolCall{ID: "1", Name: "proc_info", Args: map[string]interface{}{"pid": pid}})
+	if info.Error != "" || !strings.Contains(info.Output, "sleep 30") || !strings.Contains(info.Output, fmt.Sprintf("Parent:   %d", os.Getpid())) {
+		t.Errorf("proc_info = %+v", info)
+	}
+
+	top := registry.Execute(ctx, &ToolCall{ID: "2", Name: "top", Args: map[string]interface{}{"sort": "mem", "limit": float64(3)}})
+	if lines := strings.Split(top.Output, "\n"); top.Error != "" || len(lines) != 4 || !strings.Contains(lines[0], "COMMAND") {
+		t.Errorf("top = %+v", top)
+	}
+	if res := registry.Execute(ctx, &ToolCall{ID: "3", Name: "top", Args: map[string]interface{}{"sort": "disk"}}); res.Error == "" {
+		t.Error("top should reject an unknown sort")
+	}
+
+	for _, args := range []map[string]interface{}{
+		{"pid": float64(os.Getpid())},
+		{"pid": pid, "signal": "BOGUS"},
+		{"pid": float64(0)},
+	} {
+		if res := registry.Execute(ctx, &ToolCall{ID: "4", Name: "kill", Args: args}); res.Error == "" {
+			t.Errorf("kill %v should fail", args)
+		}
+	}
+	res := registry.Execute(ctx, &ToolCall{ID: "5", Name: "kill", Args: map[string]interface{}{"pid": pid, "signal": "sigkill"}})
+	if res.Error != "" || res.Output != fmt.Sprintf("Sent SIGKILL to process %d", cmd.Process.Pid) {
+		t.Fatalf("kill = %+v", res)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Error("sleep should have been killed")
+	}
+	if res := registry.Execute(ctx, &ToolCall{ID: "6", Name: "proc_info", Args: map[string]interface{}{"pid": pid}}); res.Error == "" {
+		t.Error("proc_info of a finished process should fail")
+	}
+}
+
+func TestCustomTools(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	registry := NewRegistry()
+	err := registry.RegisterCustomTools([]CustomTool{{
+		Name:        "greet",
+		Description: "Greet someone",
+		Parameters: []CustomParam{
+			{Name: "name", Required: true},
+			{Name: "greeting", Enum: []string{"hello", "hi"}, Default: "hello"},
+			{Name: "times", Type: "integer"},
+			{Name: "tags", Type: "array"},
+		},
+		Command: `printf '%s|' ${greeting} ${name} ${times} ${tags}; echo "${HOME:+home}"`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tool, ok := registry.Get("greet")
+	if !ok || registry.IsSafeTool("greet") {
+		t.Fatal("custom tool should be registered and need confirmation")
+	}
+	if req := tool.Parameters["required"].([]string); len(req) != 1 || req[0] != "name" {
+		t.Errorf("required = %v", req)
+	}
+
+	run := func(args map[string]interface{}) *ToolResult {
+		return registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "greet", Args: args})
+	}
+	// Arguments are quoted: no injection, arrays expand to words
+	res := run(map[string]interface{}{"name": "Bob; rm -rf x $(id)", "times": float64(2), "tags": []interface{}{"a b", "c"}})
+	if res.Error != "" || res.Output != "hello|Bob; rm -rf x $(id)|2|a b|c|home" {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	// Quoted placeholders don't let arguments out of the quotes either
+	err = registry.RegisterCustomTools([]CustomTool{{
+		Name:        "quoted",
+		Description: "Echo in quotes",
+		Parameters:  []CustomParam{{Name: "text"}, {Name: "words", Type: "array"}},
+		Command:     `echo "double ${text} ${words}"; echo 'single ${text}'; echo \${text}`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	evil := "$(echo pwned) `echo pwned` \" ' x"
+	res = registry.Execute(context.Background(), &ToolCall{ID: "2", Name: "quoted", Args: map[string]interface{}{
+		"text": evil, "words": []interface{}{"a", "b"},
+	}})
+	if want := "double " + evil + " a b\nsingle " + evil + "\n${text}"; res.Error != "" || res.Output != want {
+		t.Errorf("unexpected quoted result: %+v, want %q", res, want)
+	}
+
+	if res := run(map[string]interface{}{}); !strings.Contains(res.Error, "name is required") {
+		t.Errorf("expected missing argument error, got %+v", res)
+	}
+	if res := run(map[string]interface{}{"name": "x", "greeting": "yo"}); !strings.Contains(res.Error, "one of") {
+		t.Errorf("expected enum error, got %+v", res)
+	}
+
+	for _, bad := range []CustomTool{
+		{Name: "bad name", Description: "x", Command: "true"},
+		{Name: "nodesc", Command: "true"},
+		{Name: "nocmd", Description: "x"},
+		{Name: "badtype", Description: "x", Command: "true", Parameters: []CustomParam{{Name: "a", Type: "object"}}},
+		{Name: "dup", Description: "x", Command: "true", Parameters: []CustomParam{{Name: "a"}, {Name: "a"}}},
+		{Name: "shell", Description: "x", Command: "true"},
+	} {
+		if err := registry.RegisterCustomTools([]CustomTool{bad}); err == nil {
+			t.Errorf("expected %s to be rejected", bad.Name)
+		}
+	}
+}
+
+func TestToolNamespaces(t *testing.T) {
+	registry := NewRegistry()
+	echo := func(name string) *Tool {
+		return &Tool{
+			Name:        name,
+			Description: "echo",
+			Parameters:  map[string]interface{}{"type": "object"},
+			Executor:    func(map[string]interface{}) (string, error) { return name, nil },
+		}
+	}
+
+	name := QualifiedName("mcp.github", "search_issues")
+	if name != "mcp.github.search_issues" || WireName(name) != "mcp__github__search_issues" {
+		t.Fatalf("unexpected names %q / %q", name, WireName(name))
+	}
+	if err := registry.Add(echo(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Add(echo(QualifiedName("mcp.jira", "search_issues"))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Conflicts: the same name, a name offered under the same wire name, a built-in
+	for _, dup := range []string{name, "mcp__github__search_issues", "shell"} {
+		if err := registry.Add(echo(dup)); !errors.Is(err, ErrToolExists) {
+			t.Errorf("Add(%s) = %v, want ErrToolExists", dup, err)
+		}
+	}
+	if err := registry.Add(echo("bad..name")); err == nil || errors.Is(err, ErrToolExists) {
+		t.Errorf("expected invalid name error, got %v", err)
+	}
+
+	// The provider sees wire names; calls by wire name resolve
+	found := false
+	for _, def := range registry.ToOpenAIFormat() {
+		fn := def["function"].(map[string]interface{})
+		if strings.Contains(fn["name"].(string), ".") {
+			t.Errorf("dotted name offered to the provider: %s", fn["name"])
+		}
+		found = found || fn["name"] == "mcp__github__search_issues"
+	}
+	if !found {
+		t.Error("namespaced tool not offered")
+	}
+	if got := registry.Resolve("mcp__github__search_issues"); got != name {
+		t.Errorf("Resolve = %q", got)
+	}
+	if got := registry.Resolve("nope"); got != "" {
+		t.Errorf("Resolve(unknown) = %q", got)
+	}
+
+	// Aliases run their target and inherit its confirmation
+	if err := registry.SetAliases(map[string]string{"search": "mcp__github__search_issues", "gs": "git_status"}); err != nil {
+		t.Fatal(err)
+	}
+	res := registry.Execute(context.Background(), &ToolCall{ID: "1", Name: "search"})
+	if res.Output != name {
+		t.Errorf("alias ran %+v", res)
+	}
+	if !registry.IsSafeTool("gs") || registry.IsSafeTool("search") {
+		t.Error("aliases should need confirmation exactly when their target does")
+	}
+	if err := registry.SetAliases(map[string]string{"shell": "git_status"}); !errors.Is(err, ErrToolExists) {
+		t.Errorf("alias over a tool: %v", err)
+	}
+	if err := registry.SetAliases(map[string]string{"x": "missing"}); err == nil {
+		t.Error("expected unknown alias target to fail")
+	}
+}
+
+// TestRegistryConcurrentUse registers, lists and executes tools from many
+// goroutines; run with -race to catch unguarded access
+func TestRegistryConcurrentUse(t *testing.T) {
+	registry := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("tool_%d_%d", i, j)
+				registry.Register(&Tool{
+					Name:     name,
+					Executor: func(map[string]interface{}) (string, error) { return name, nil },
+				})
+				if err := registry.Add(&Tool{Name: name}); !errors.Is(err, ErrToolExists) {
+					t.Errorf("Add(%s) = %v", name, err)
+				}
+				registry.markSafe(name)
+				if res := registry.Execute(context.Background(), &ToolCall{Name: name}); res.Output != name {
+					t.Errorf("Execute(%s) = %+v", name, res)
+				}
+				registry.List()
+				registry.ToOpenAIFormat()
+				registry.IsSafeTool("shell")
+				registry.Resolve("mcp__x__y")
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		registry.SetStorage(nil)
+		registry.SetNetworkPolicy(nil)
+		if err := registry.SetLimits(map[string]ToolLimits{"shell": {MaxOutput: 10}}); err != nil {
+			t.Error(err)
+		}
+		if err := registry.Restrict(nil, []string{"docker_*"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	if got := len(registry.List()); got < 8*50 {
+		t.Errorf("expected all tools registered, got %d", got)
+	}
+	if _, ok := registry.Get("docker_ps"); ok {
+		t.Error("restricted tool still registered")
+	}
+}
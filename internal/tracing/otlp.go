@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// WriterExporter writes each export as one line of OTLP JSON, the format
+// the collector's otlpjsonfile receiver reads
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter creates an exporter writing to w; w is closed on
+// shutdown if it is an io.Closer
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// ExportSpans implements sdktrace.SpanExporter
+func (e *WriterExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(encodeSpans(spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+// Shutdown implements sdktrace.SpanExporter
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// OTLP JSON messages (ExportTraceServiceRequest). IDs are hex, 64-bit
+// integers are strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string         `json:"stringValue,omitempty"`
+		BoolValue   *bool           `json:"boolValue,omitempty"`
+		IntValue    *string         `json:"intValue,omitempty"`
+		DoubleValue *float64        `json:"doubleValue,omitempty"`
+		ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+	}
+	otlpArrayValue struct {
+		Values []otlpAnyValue `json:"values"`
+	}
+)
+
+// OTLP status codes, which order Ok and Error unlike the API's codes
+const (
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+// encodeSpans groups spans by resource and instrumentation scope
+func encodeSpans(spans []sdktrace.ReadOnlySpan) otlpRequest {
+	var req otlpRequest
+	resources := make(map[string]int)
+	scopes := make(map[[2]string]int)
+	for _, s := range spans {
+		resKey := s.Resource().Encoded(attribute.DefaultEncoder())
+		ri, ok := resources[resKey]
+		if !ok {
+			ri = len(req.ResourceSpans)
+			resources[resKey] = ri
+			req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+				Resource: otlpResource{Attributes: encodeAttributes(s.Resource().Attributes())},
+			})
+		}
+		rs := &req.ResourceSpans[ri]
+
+		scope := s.InstrumentationScope()
+		scopeKey := [2]string{resKey, scope.Name + "@" + scope.Version}
+		si, ok := scopes[scopeKey]
+		if !ok {
+			si = len(rs.ScopeSpans)
+			scopes[scopeKey] = si
+			rs.ScopeSpans = append(rs.ScopeSpans, otlpScopeSpans{Scope: otlpScope{Name: scope.Name, Version: scope.Version}})
+		}
+		rs.ScopeSpans[si].Spans = append(rs.ScopeSpans[si].Spans, encodeSpan(s))
+	}
+	return req
+}
+
+func encodeSpan(s sdktrace.ReadOnlySpan) otlpSpan {
+	span := otlpSpan{
+		TraceID:           s.SpanContext().TraceID().String(),
+		SpanID:            s.SpanContext().SpanID().String(),
+		Name:              s.Name(),
+		Kind:              int(s.SpanKind()),
+		StartTimeUnixNano: unixNano(s.StartTime()),
+		EndTimeUnixNano:   unixNano(s.EndTime()),
+		Attributes:        encodeAttributes(s.Attributes()),
+	}
+	if s.Parent().HasSpanID() {
+		span.ParentSpanID = s.Parent().SpanID().String()
+	}
+	for _, e := range s.Events() {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(e.Time),
+			Name:         e.Name,
+			Attributes:   encodeAttributes(e.Attributes),
+		})
+	}
+	switch s.Status().Code {
+	case codes.Ok:
+		span.Status.Code = otlpStatusOk
+	case codes.Error:
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Status().Description}
+	}
+	return span
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func encodeAttributes(attrs []attribute.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	result := make([]otlpKeyValue, len(attrs))
+	for i, kv := range attrs {
+		result[i] = otlpKeyValue{Key: string(kv.Key), Value: encodeValue(kv.Value)}
+	}
+	return result
+}
+
+func encodeValue(v attribute.Value) otlpAnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpAnyValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpAnyValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return otlpAnyValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		return encodeArray(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return encodeArray(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return encodeArray(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return encodeArray(v.AsStringSlice(), attribute.StringValue)
+	default:
+		s := v.Emit()
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+func encodeArray[T any](values []T, value func(T) attribute.Value) otlpAnyValue {
+	arr := &otlpArrayValue{Values: make([]otlpAnyValue, len(values))}
+	for i, v := range values {
+		arr.Values[i] = encodeValue(value(v))
+	}
+	return otlpAnyValue{ArrayValue: arr}
+}
@@ -0,0 +1,137 @@
+// Package tracing sets up OpenTelemetry tracing of the agent: turns,
+// provider calls and tool executions become spans, exported with OTLP over
+// HTTP to a collector or appended to a file, so the time of slow turns can
+// be broken down.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of igent's spans
+const ScopeName = "github.com/igm/igent"
+
+// Exporters
+const (
+	ExporterOTLP = "otlp" // OTLP/HTTP, with the OpenTelemetry exporter
+	ExporterFile = "file" // OTLP JSON, one export request per line
+)
+
+// DefaultEndpoint is the traces URL of a local OpenTelemetry collector
+const DefaultEndpoint = "http://localhost:4318/v1/traces"
+
+// Config configures tracing
+type Config struct {
+	Exporter    string            // otlp or file; empty disables tracing
+	Endpoint    string            // OTLP traces URL (default: OTEL_EXPORTER_OTLP_* or DefaultEndpoint)
+	Headers     map[string]string // Sent with every OTLP export (default: OTEL_EXPORTER_OTLP_*HEADERS)
+	File        string            // Output of the file exporter
+	ServiceName string
+	Version     string
+	SampleRatio float64 // Fraction of traces kept (0 = all)
+
+	// Transport sends OTLP exports, e.g. through the network policy
+	// (default http.DefaultTransport)
+	Transport http.RoundTripper
+}
+
+// Setup installs the global tracer provider for cfg and returns the
+// function that flushes the remaining spans and stops it. Without an
+// exporter tracing stays off and the function does nothing.
+func Setup(cfg Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var err error
+		if exporter, err = otlptracehttp.New(context.Background(), otlpOptions(cfg)...); err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+	case ExporterFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("tracing: the file exporter needs tracing.file")
+		}
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exporter = NewWriterExporter(f)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (want otlp or file)", cfg.Exporter)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = "igent"
+	}
+	res, err := sdkresource.Merge(sdkresource.Default(), sdkresource.NewSchemaless(
+		attribute.String("service.name", name),
+		attribute.String("service.version", cfg.Version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// otlpOptions configures the OTLP exporter. The exporter reads the standard
+// OTEL_EXPORTER_OTLP_* variables itself; the endpoint and headers of cfg
+// override them, and without any endpoint it sends to DefaultEndpoint
+// rather than the exporter's default of HTTPS.
+func otlpOptions(cfg Config) []otlptracehttp.Option {
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithHTTPClient(&http.Client{Transport: transport})}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		endpoint = DefaultEndpoint
+	}
+	if endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	return opts
+}
+
+// Tracer returns igent's tracer from the global provider; it records
+// nothing until Setup installed an exporter
+func Tracer() trace.Tracer {
+	return otel.Tracer(ScopeName)
+}
+
+// End ends a span, marking it failed if err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,217 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordSpans creates a turn span with a failed child and exports them
+func recordSpans(t *testing.T, exporter sdktrace.SpanExporter) {
+	t.Helper()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := tp.Tracer(ScopeName)
+
+	ctx, turn := tracer.Start(context.Background(), "igent.chat")
+	turn.SetAttributes(attribute.String("igent.conversation", "work"), attribute.Int("igent.turn", 3))
+	_, tool := tracer.Start(ctx, "execute_tool shell")
+	tool.SetAttributes(attribute.StringSlice("tags", []string{"a", "b"}))
+	End(tool, errors.New("exit status 1"))
+	End(turn, nil)
+
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+}
+
+// exportedSpans decodes the spans of OTLP JSON export requests by name
+func exportedSpans(t *testing.T, requests ...[]byte) map[string]otlpSpan {
+	t.Helper()
+	spans := make(map[string]otlpSpan)
+	for _, body := range requests {
+		var req otlpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("invalid OTLP JSON %s: %v", body, err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				if ss.Scope.Name != ScopeName {
+					t.Errorf("unexpected scope %+v", ss.Scope)
+				}
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	recordSpans(t, NewWriterExporter(&buf))
+
+	var lines [][]byte
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		lines = append(lines, line)
+	}
+	spans := exportedSpans(t, lines...)
+	turn, tool := spans["igent.chat"], spans["execute_tool shell"]
+	if len(turn.TraceID) != 32 || len(turn.SpanID) != 16 || turn.ParentSpanID != "" {
+		t.Errorf("unexpected turn span %+v", turn)
+	}
+	if tool.TraceID != turn.TraceID || tool.ParentSpanID != turn.SpanID {
+		t.Errorf("expected the tool span under the turn, got %+v", tool)
+	}
+	if tool.Status.Code != otlpStatusError || tool.Status.Message != "exit status 1" || len(tool.Events) != 1 {
+		t.Errorf("expected the tool span failed with the error event, got %+v", tool)
+	}
+	for _, kv := range turn.Attributes {
+		if kv.Key == "igent.turn" && (kv.Value.IntValue == nil || *kv.Value.IntValue != "3") {
+			t.Errorf("expected the turn as an OTLP int string, got %+v", kv.Value)
+		}
+	}
+	if tool.Attributes[0].Value.ArrayValue == nil || len(tool.Attributes[0].Value.ArrayValue.Values) != 2 {
+		t.Errorf("expected an array attribute, got %+v", tool.Attributes)
+	}
+}
+
+// collector serves OTLP/HTTP protobuf trace requests and records the span
+// names and headers it received
+type collector struct {
+	mu      sync.Mutex
+	paths   []string
+	headers []http.Header
+	spans   []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req collectortrace.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	c.headers = append(c.headers, r.Header)
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				c.spans = append(c.spans, s.Name)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+func TestSetup_OTLP(t *testing.T) {
+	var c collector
+	srv := httptest.NewServer(&c)
+	defer srv.Close()
+
+	var proxied atomic.Int32
+	transport := roundTripper(func(r *http.Request) (*http.Response, error) {
+		proxied.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	shutdown, err := Setup(Config{Exporter: ExporterOTLP, Endpoint: srv.URL + "/otlp/v1/traces", Headers: map[string]string{"x-api-key": "secret"}, Transport: transport})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "igent.chat")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	if len(c.spans) != 1 || c.spans[0] != "igent.chat" {
+		t.Errorf("expected the span at the collector, got %v", c.spans)
+	}
+	if c.paths[0] != "/otlp/v1/traces" || c.headers[0].Get("X-Api-Key") != "secret" {
+		t.Errorf("unexpected request %s %v", c.paths[0], c.headers[0])
+	}
+	if proxied.Load() == 0 {
+		t.Error("expected the export through the configured transport")
+	}
+}
+
+func TestSetup_OTLPEnv(t *testing.T) {
+	var c collector
+	srv := httptest.NewServer(&c)
+	defer srv.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer%20token")
+	shutdown, err := Setup(Config{Exporter: ExporterOTLP})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "igent.chat")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	if len(c.paths) != 1 || c.paths[0] != "/v1/traces" {
+		t.Fatalf("expected an export to the environment's endpoint, got %v", c.paths)
+	}
+	if got := c.headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("expected the environment's headers, got %q", got)
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestSetup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(Config{Exporter: ExporterFile, File: path, Version: "1.2.3"})
+	if err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "igent.chat")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := exportedSpans(t, []byte(strings.TrimSpace(string(data))))["igent.chat"]; !ok {
+		t.Errorf("expected the span in the file, got %s", data)
+	}
+	if !strings.Contains(string(data), `"service.name","value":{"stringValue":"igent"}`) {
+		t.Errorf("expected the igent service resource, got %s", data)
+	}
+
+	if _, err := Setup(Config{Exporter: "zipkin"}); err == nil {
+		t.Error("expected an unknown exporter to fail")
+	}
+	if _, err := Setup(Config{Exporter: ExporterFile}); err == nil {
+		t.Error("expected the file exporter without a file to fail")
+	}
+	if shutdown, err := Setup(Config{}); err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("expected tracing off without an exporter, got %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Package transcript records sessions to replayable transcript files: one
+// JSON event per line for each prompt, response, tool call and tool result,
+// with timings. igent replay reads them back to re-render a session or to
+// run its prompts again against another model.
+package transcript
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventSession    = "session"     // Start of a recording: provider and model
+	EventPrompt     = "prompt"      // User input of a turn
+	EventResponse   = "response"    // Final answer of a turn
+	EventError      = "error"       // A turn that failed
+	EventToolCall   = "tool_call"   // A tool call the model made
+	EventToolResult = "tool_result" // The result of a tool call
+)
+
+// Event is a line of a transcript
+type Event struct {
+	Type         string                 `json:"type"`
+	Time         time.Time              `json:"time"`
+	Conversation string                 `json:"conversation,omitempty"`
+	Provider     string                 `json:"provider,omitempty"`
+	Model        string                 `json:"model,omitempty"`
+	Text         string                 `json:"text,omitempty"` // Prompt, response or error
+	Tool         string                 `json:"tool,omitempty"`
+	CallID       string                 `json:"call_id,omitempty"`
+	Args         map[string]interface{} `json:"args,omitempty"`
+	Output       string                 `json:"output,omitempty"`
+	DurationMS   int64                  `json:"duration_ms,omitempty"` // Of the turn or tool call
+	Continued    bool                   `json:"continued,omitempty"`   // Prompt resumed an interrupted answer (/continue)
+}
+
+// Duration returns the duration of a response, error or tool result
+func (e *Event) Duration() time.Duration {
+	return time.Duration(e.DurationMS) * time.Millisecond
+}
+
+// Recorder appends events to a transcript. It is safe for concurrent use,
+// as tool calls run in parallel; write errors are logged once and
+// otherwise ignored so a full disk never breaks the conversation.
+type Recorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	failed bool
+	tap    func(Event)
+	log    *slog.Logger
+}
+
+// NewRecorder records to w
+func NewRecorder(w io.Writer, log *slog.Logger) *Recorder {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Recorder{w: w, log: log}
+}
+
+// Create opens a transcript file for appending, so several sessions can be
+// recorded to the same file
+func Create(path string, log *slog.Logger) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening transcript: %w", err)
+	}
+	r := NewRecorder(f, log)
+	r.closer = f
+	return r, nil
+}
+
+// Record appends an event, stamping it with the current time if it has
+// none. It is a no-op on a nil recorder.
+func (r *Recorder) Record(e Event) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		_, err = r.w.Write(append(data, '\n'))
+	}
+	if err != nil && !r.failed {
+		r.failed = true
+		r.log.Warn("writing transcript failed", "error", err)
+	}
+	if r.tap != nil {
+		r.tap(e)
+	}
+}
+
+// Tap calls fn with every event recorded until the returned function is
+// called
+func (r *Recorder) Tap(fn func(Event)) func() {
+	r.mu.Lock()
+	r.tap = fn
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		r.tap = nil
+		r.mu.Unlock()
+	}
+}
+
+// Close closes the transcript file
+func (r *Recorder) Close() error {
+	if r == nil || r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Read parses a transcript
+func Read(r io.Reader) ([]Event, error) {
+	var events []Event
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// Load reads a transcript file
+func Load(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	events, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return events, nil
+}
+
+// Turn groups the events of one turn
+type Turn struct {
+	Session  *Event  // Session the turn was recorded in, if known
+	Prompt   Event   // The user input
+	Tools    []Event // Tool calls and results, in the order recorded
+	Response *Event  // The answer, or nil if the turn failed or was cut off
+	Error    *Event  // The failure, if any
+}
+
+// Turns groups the events of a transcript by turn. Tool events before the
+// first prompt are dropped.
+func Turns(events []Event) []Turn {
+	var turns []Turn
+	var session *Event
+	for i := range events {
+		e := &events[i]
+		switch e.Type {
+		case EventSession:
+			session = e
+			continue
+		case EventPrompt:
+			turns = append(turns, Turn{Session: session, Prompt: *e})
+			continue
+		}
+		if len(turns) == 0 {
+			continue
+		}
+		t := &turns[len(turns)-1]
+		switch e.Type {
+		case EventToolCall, EventToolResult:
+			t.Tools = append(t.Tools, *e)
+		case EventResponse:
+			t.Response = e
+		case EventError:
+			t.Error = e
+		}
+	}
+	return turns
+}
+
+// ToolCalls returns the number of tool calls of the turn
+func (t *Turn) ToolCalls() int {
+	n := 0
+	for _, e := range t.Tools {
+		if e.Type == EventToolCall {
+			n++
+		}
+	}
+	return n
+}
+
+// Duration returns how long the turn took, or 0 if it was cut off
+func (t *Turn) Duration() time.Duration {
+	switch {
+	case t.Response != nil:
+		return t.Response.Duration()
+	case t.Error != nil:
+		return t.Error.Duration()
+	}
+	return 0
+}
+
+// Outcome returns the answer of the turn, or a note on how it ended
+// without one
+func (t *Turn) Outcome() string {
+	switch {
+	case t.Response != nil:
+		return t.Response.Text
+	case t.Error != nil:
+		return "(failed: " + t.Error.Text + ")"
+	}
+	return "(no answer recorded)"
+}
+
+// Render writes the turns as a readable session: prompts, tool calls with
+// their results and durations, answers and turn timings
+func Render(w io.Writer, turns []Turn) {
+	var session *Event
+	for i, t := range turns {
+		if t.Session != nil && t.Session != session {
+			session = t.Session
+			fmt.Fprintf(w, "=== Session %s, %s/%s ===\n\n", session.Time.Format("2006-01-02 15:04:05"), session.Provider, session.Model)
+		}
+		fmt.Fprintf(w, "--- Turn %d, %s ---\n> %s\n\n", i+1, t.Prompt.Time.Format("15:04:05"), t.Prompt.Text)
+		if t.Prompt.Continued {
+			fmt.Fprint(w, "(continuing the interrupted answer)\n\n")
+		}
+		for _, e := range t.Tools {
+			switch e.Type {
+			case EventToolCall:
+				args, _ := json.Marshal(e.Args)
+				fmt.Fprintf(w, "[tool %s] %s\n", e.Tool, args)
+			case EventToolResult:
+				fmt.Fprintf(w, "[result %s, %s]\n%s\n\n", e.Tool, e.Duration().Round(time.Millisecond), strings.TrimRight(e.Output, "\n"))
+			}
+		}
+		fmt.Fprintf(w, "%s\n\n(%s", t.Outcome(), t.Duration().Round(time.Millisecond))
+		if n := t.ToolCalls(); n > 0 {
+			fmt.Fprintf(w, ", %d tool calls", n)
+		}
+		fmt.Fprint(w, ")\n\n")
+	}
+}
@@ -0,0 +1,72 @@
+package transcript
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	r, err := Create(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tapped []string
+	untap := r.Tap(func(e Event) { tapped = append(tapped, e.Type) })
+	r.Record(Event{Type: EventSession, Provider: "openai", Model: "gpt-4o"})
+	r.Record(Event{Type: EventToolResult, Tool: "cat"}) // Before any prompt: dropped
+	r.Record(Event{Type: EventPrompt, Text: "list files"})
+	untap()
+	r.Record(Event{Type: EventToolCall, Tool: "shell", Args: map[string]interface{}{"command": "ls"}})
+	r.Record(Event{Type: EventToolResult, Tool: "shell", Output: "a.go\n", DurationMS: 12})
+	r.Record(Event{Type: EventResponse, Text: "One file: a.go", DurationMS: 1500})
+	r.Record(Event{Type: EventPrompt, Text: "and now?"})
+	r.Record(Event{Type: EventError, Text: "connection reset", DurationMS: 300})
+	r.Record(Event{Type: EventPrompt, Text: "and now?", Continued: true})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tapped, ",") != "session,tool_result,prompt" {
+		t.Errorf("unexpected tapped events %v", tapped)
+	}
+
+	events, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(events) != 9 || events[0].Time.IsZero() {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	turns := Turns(events)
+	if len(turns) != 3 {
+		t.Fatalf("expected 3 turns, got %d", len(turns))
+	}
+	first := turns[0]
+	if first.Session == nil || first.Session.Model != "gpt-4o" || first.ToolCalls() != 1 || len(first.Tools) != 2 ||
+		first.Outcome() != "One file: a.go" || first.Duration() != 1500*time.Millisecond {
+		t.Errorf("unexpected first turn %+v", first)
+	}
+	if turns[1].Outcome() != "(failed: connection reset)" || turns[1].Duration() != 300*time.Millisecond {
+		t.Errorf("unexpected failed turn %+v", turns[1])
+	}
+	if !turns[2].Prompt.Continued || turns[2].Outcome() != "(no answer recorded)" {
+		t.Errorf("unexpected cut off turn %+v", turns[2])
+	}
+
+	var out bytes.Buffer
+	Render(&out, turns)
+	for _, want := range []string{"openai/gpt-4o", "> list files", `[tool shell] {"command":"ls"}`, "[result shell, 12ms]", "(1.5s, 1 tool calls)", "continuing the interrupted answer"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("rendered session lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRead_Invalid(t *testing.T) {
+	if _, err := Read(strings.NewReader("{\"type\": \"prompt\"}\nnot json\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,511 @@
+// Package tui is igent tui: a full-screen terminal UI for conversations,
+// an alternative to the readline REPL. A sidebar lists the conversations,
+// the main pane scrolls through the current one while answers stream in,
+// running tool calls show their status, and tool calls that need
+// confirmation are asked about inline.
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+	"github.com/igm/igent/internal/tools"
+)
+
+// Layout
+const (
+	sidebarWidth = 30
+	inputHeight  = 3
+)
+
+// focus is the part of the UI keys go to
+type focus int
+
+const (
+	focusInput focus = iota
+	focusSidebar
+)
+
+// Messages the agent's goroutines send to the UI; they all go through
+// Model.events, so they arrive in the order they were sent
+type (
+	chunkMsg   string
+	warningMsg string
+
+	toolMsg struct {
+		call   *tools.ToolCall
+		result *tools.ToolResult // nil while the call runs
+	}
+
+	// confirmMsg asks the user a question; the answer goes to reply
+	confirmMsg struct {
+		text   string
+		always bool // Whether "always" is an answer
+		reply  chan agent.ToolAnswer
+	}
+
+	doneMsg struct {
+		result *agent.ChatResult
+		err    error
+	}
+)
+
+// toolStatus is a tool call of the running turn
+type toolStatus struct {
+	call   *tools.ToolCall
+	result *tools.ToolResult // nil while the call runs
+}
+
+// Options configure the UI
+type Options struct {
+	Name      string // The assistant's name in the conversation pane
+	AssumeYes bool   // Run tool calls that need confirmation without asking
+}
+
+// Model is the state of the UI
+type Model struct {
+	agent *agent.Agent
+	opts  Options
+
+	ctx    context.Context
+	cancel context.CancelFunc // Stops the UI, and with it a running turn
+	events chan tea.Msg
+	turns  sync.WaitGroup // The running turn's goroutine
+
+	width, height int
+	focus         focus
+	viewport      viewport.Model
+	input         textarea.Model
+	spinner       spinner.Model
+
+	// Sidebar
+	conversations []*storage.ConversationInfo
+	selected      int
+
+	// Current conversation
+	messages []llm.Message
+
+	// Running turn
+	running    bool
+	cancelTurn context.CancelFunc
+	prompt     string
+	answer     strings.Builder
+	tools      []*toolStatus
+	dialog     *confirmMsg
+
+	status string // Warning, error or metadata of the last turn
+}
+
+// New returns the UI of an agent whose conversation is set. It takes over
+// the agent's tool and budget prompts, warnings and tool status reports.
+func New(ctx context.Context, ag *agent.Agent, opts Options) *Model {
+	ctx, cancel := context.WithCancel(ctx)
+
+	input := textarea.New()
+	input.Placeholder = "Send a message (Enter to send, Alt+Enter for a new line)"
+	input.ShowLineNumbers = false
+	input.Prompt = "┃ "
+	input.CharLimit = 0
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline = key.NewBinding(key.WithKeys("alt+enter", "ctrl+j"))
+	input.Focus()
+
+	m := &Model{
+		agent:    ag,
+		opts:     opts,
+		ctx:      ctx,
+		cancel:   cancel,
+		events:   make(chan tea.Msg),
+		viewport: viewport.New(0, 0),
+		input:    input,
+		spinner:  spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(toolRunningStyle)),
+	}
+
+	ag.SetToolPrompt(m.confirmTool)
+	ag.SetBudgetPrompt(m.confirmBudget)
+	ag.SetWarningHandler(func(msg string) { m.send(warningMsg(msg)) })
+	ag.SetToolStatusHandler(func(call *tools.ToolCall, result *tools.ToolResult) {
+		m.send(toolMsg{call: call, result: result})
+	})
+
+	m.loadConversation()
+	m.loadConversations()
+	return m
+}
+
+// Run shows the UI on the terminal until the user quits
+func Run(ctx context.Context, ag *agent.Agent, opts Options) error {
+	m := New(ctx, ag, opts)
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion()).Run()
+	// A turn still running is cancelled; wait for it to finish saving
+	m.cancel()
+	m.turns.Wait()
+	return err
+}
+
+// send passes a message from the agent's goroutines to the UI, unless the
+// UI has quit
+func (m *Model) send(msg tea.Msg) {
+	select {
+	case m.events <- msg:
+	case <-m.ctx.Done():
+	}
+}
+
+// listen waits for the next message of the agent
+func (m *Model) listen() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case msg := <-m.events:
+			return msg
+		case <-m.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ask shows a confirmation dialog and waits for the answer; quitting
+// denies
+func (m *Model) ask(text string, always bool) agent.ToolAnswer {
+	reply := make(chan agent.ToolAnswer, 1)
+	m.send(confirmMsg{text: text, always: always, reply: reply})
+	select {
+	case answer := <-reply:
+		return answer
+	case <-m.ctx.Done():
+		return agent.ToolAnswerNo
+	}
+}
+
+func (m *Model) confirmTool(call *tools.ToolCall) agent.ToolAnswer {
+	if m.opts.AssumeYes {
+		return agent.ToolAnswerYes
+	}
+	return m.ask(formatToolCall(call), true)
+}
+
+func (m *Model) confirmBudget(e *agent.BudgetError) bool {
+	text := fmt.Sprintf("The %s token budget of %d is used up (%d tokens). Continue anyway?", e.Scope, e.Limit, e.Used)
+	return m.ask(text, false) == agent.ToolAnswerYes
+}
+
+// Init implements tea.Model
+func (m *Model) Init() tea.Cmd {
+	return tea.Batch(textarea.Blink, m.listen())
+}
+
+// Update implements tea.Model
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case spinner.TickMsg:
+		if !m.running {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		m.refresh()
+		return m, cmd
+
+	case chunkMsg:
+		m.answer.WriteString(string(msg))
+		m.refresh()
+		return m, m.listen()
+
+	case toolMsg:
+		m.trackTool(msg)
+		m.refresh()
+		return m, m.listen()
+
+	case confirmMsg:
+		m.dialog = &msg
+		m.input.Blur()
+		m.refresh()
+		return m, m.listen()
+
+	case warningMsg:
+		m.status = "Warning: " + string(msg)
+		return m, m.listen()
+
+	case doneMsg:
+		m.finishTurn(msg)
+		return m, m.listen()
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// handleKey routes a key to the dialog, the sidebar or the input
+func (m *Model) handleKey(msg tea.KeyMsg) tea.Cmd {
+	if m.dialog != nil {
+		m.answerDialog(msg)
+		return nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c":
+		if m.running {
+			m.cancelTurn()
+			m.status = "Cancelling…"
+			return nil
+		}
+		m.cancel()
+		return tea.Quit
+	case "tab":
+		m.toggleFocus()
+		return nil
+	case "ctrl+n":
+		return m.newConversation()
+	case "pgup", "pgdown", "ctrl+u", "ctrl+d":
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+
+	if m.focus == focusSidebar {
+		return m.handleSidebarKey(msg)
+	}
+
+	if msg.Type == tea.KeyEnter {
+		text := strings.TrimSpace(m.input.Value())
+		switch {
+		case text == "":
+			return nil
+		case text == "/exit" || text == "/quit":
+			m.cancel()
+			return tea.Quit
+		case m.running:
+			m.status = "Wait for the answer, or press Ctrl+C to cancel it"
+			return nil
+		}
+		m.input.Reset()
+		return tea.Batch(m.startTurn(text), m.spinner.Tick)
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return cmd
+}
+
+// answerDialog answers the open confirmation dialog
+func (m *Model) answerDialog(msg tea.KeyMsg) {
+	answer := agent.ToolAnswerNo
+	switch msg.String() {
+	case "y", "Y":
+		answer = agent.ToolAnswerYes
+	case "a", "A":
+		if !m.dialog.always {
+			return
+		}
+		answer = agent.ToolAnswerAlways
+	case "n", "N", "esc", "ctrl+c":
+	default:
+		return
+	}
+	m.dialog.reply <- answer
+	m.dialog = nil
+	if m.focus == focusInput {
+		m.input.Focus()
+	}
+	m.refresh()
+}
+
+func (m *Model) handleSidebarKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "down", "j":
+		if m.selected < len(m.conversations)-1 {
+			m.selected++
+		}
+	case "n":
+		return m.newConversation()
+	case "enter":
+		if len(m.conversations) == 0 {
+			return nil
+		}
+		m.switchConversation(m.conversations[m.selected].ID)
+		m.toggleFocus()
+	case "esc":
+		m.toggleFocus()
+	}
+	return nil
+}
+
+func (m *Model) toggleFocus() {
+	if m.focus == focusInput {
+		m.focus = focusSidebar
+		m.input.Blur()
+		m.loadConversations()
+		return
+	}
+	m.focus = focusInput
+	m.input.Focus()
+}
+
+// newConversation starts a conversation named after the time
+func (m *Model) newConversation() tea.Cmd {
+	m.switchConversation("tui-" + time.Now().Format("20060102-150405"))
+	if m.focus == focusSidebar {
+		m.toggleFocus()
+	}
+	return nil
+}
+
+// switchConversation makes id the current conversation, unless a turn runs
+func (m *Model) switchConversation(id string) {
+	if m.running {
+		m.status = "Wait for the answer before switching conversations"
+		return
+	}
+	if err := m.agent.SetConversation(id); err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.status = ""
+	m.loadConversation()
+	m.loadConversations()
+}
+
+// startTurn sends a prompt to the agent; what the agent does comes back
+// through events, ending with a doneMsg
+func (m *Model) startTurn(prompt string) tea.Cmd {
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running = true
+	m.cancelTurn = cancel
+	m.prompt = prompt
+	m.answer.Reset()
+	m.tools = nil
+	m.status = ""
+	m.refresh()
+	m.viewport.GotoBottom()
+
+	m.turns.Add(1)
+	return func() tea.Msg {
+		defer m.turns.Done()
+		defer cancel()
+		result, err := m.agent.ChatStream(ctx, prompt, func(chunk string) {
+			m.send(chunkMsg(chunk))
+		})
+		m.send(doneMsg{result: result, err: err})
+		return nil
+	}
+}
+
+func (m *Model) finishTurn(msg doneMsg) {
+	m.running = false
+	m.cancelTurn = nil
+	m.dialog = nil
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		m.status = "Cancelled"
+	case msg.err != nil:
+		m.status = "Error: " + msg.err.Error()
+	case msg.result != nil:
+		m.status = msg.result.Summary()
+	}
+	m.prompt = ""
+	m.answer.Reset()
+	m.tools = nil
+	if m.focus == focusInput {
+		m.input.Focus()
+	}
+	m.loadConversation()
+	m.loadConversations()
+}
+
+// trackTool records a tool call starting or finishing
+func (m *Model) trackTool(msg toolMsg) {
+	for _, t := range m.tools {
+		if t.call == msg.call {
+			t.result = msg.result
+			return
+		}
+	}
+	m.tools = append(m.tools, &toolStatus{call: msg.call, result: msg.result})
+}
+
+// loadConversation reads the messages of the current conversation
+func (m *Model) loadConversation() {
+	messages, err := m.agent.Transcript()
+	if err != nil {
+		m.status = "Error: " + err.Error()
+	}
+	m.messages = messages
+	m.refresh()
+	m.viewport.GotoBottom()
+}
+
+// loadConversations reads the sidebar, selecting the current conversation
+func (m *Model) loadConversations() {
+	infos, err := m.agent.ConversationInfos()
+	if err != nil {
+		m.status = "Error: " + err.Error()
+		return
+	}
+	m.conversations = infos
+	m.selected = 0
+	for i, info := range infos {
+		if info.ID == m.agent.ConversationID() {
+			m.selected = i
+		}
+	}
+}
+
+// layout sizes the panes to the terminal
+func (m *Model) layout() {
+	mainWidth := m.mainWidth()
+	m.input.SetWidth(mainWidth)
+	// Header, status line and help line around the viewport and input
+	m.viewport.Width = mainWidth
+	m.viewport.Height = max(m.height-inputHeight-3, 1)
+	m.refresh()
+}
+
+func (m *Model) mainWidth() int {
+	return max(m.width-sidebarWidth-1, 20)
+}
+
+// refresh renders the conversation into the viewport, keeping it scrolled
+// to the bottom if it was
+func (m *Model) refresh() {
+	bottom := m.viewport.AtBottom()
+	m.viewport.SetContent(m.renderConversation(m.viewport.Width))
+	if bottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+// formatToolCall describes a tool call for the confirmation dialog
+func formatToolCall(call *tools.ToolCall) string {
+	return strings.TrimSpace(agent.FormatToolCallPlain(call))
+}
@@ -0,0 +1,127 @@
+package tui
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/igm/igent/pkg/igenttest"
+)
+
+// turn sends a prompt and feeds what the agent does to the model until the
+// turn is done, calling onDialog for each confirmation dialog
+func turn(t *testing.T, m *Model, prompt string, onDialog func()) {
+	t.Helper()
+	m.input.SetValue(prompt)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.running || m.prompt != prompt || cmd == nil {
+		t.Fatalf("expected the turn to run, got running=%v prompt=%q", m.running, m.prompt)
+	}
+	// Enter starts the turn and the spinner; run the turn only
+	batch, ok := cmd().(tea.BatchMsg)
+	if !ok {
+		t.Fatal("expected Enter to start a batch")
+	}
+	go batch[0]()
+	for {
+		msg := m.listen()()
+		m.Update(msg)
+		switch msg.(type) {
+		case confirmMsg:
+			onDialog()
+		case doneMsg:
+			return
+		}
+	}
+}
+
+func newModel(t *testing.T, replies ...igenttest.Reply) (*Model, *igenttest.Harness) {
+	h := igenttest.New(t, replies...)
+	m := New(context.Background(), h.Agent, Options{Name: "igent"})
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	return m, h
+}
+
+func TestTurn(t *testing.T) {
+	m, h := newModel(t, igenttest.Text("Hello there."))
+	turn(t, m, "hi", func() { t.Error("unexpected dialog") })
+
+	if m.running || m.prompt != "" {
+		t.Error("expected the turn to be over")
+	}
+	if len(m.messages) != 2 || m.messages[1].Content != "Hello there." {
+		t.Errorf("expected the conversation reloaded, got %+v", m.messages)
+	}
+	view := m.View()
+	if !strings.Contains(view, "Hello there.") || !strings.Contains(view, igenttest.ConversationID) {
+		t.Errorf("expected the answer and conversation in the view:\n%s", view)
+	}
+	if !strings.Contains(m.status, "tokens") {
+		t.Errorf("expected the turn's metadata as status, got %q", m.status)
+	}
+	h.AssertScriptDone()
+}
+
+func TestConfirmDialog(t *testing.T) {
+	m, h := newModel(t,
+		igenttest.Call("shell", map[string]interface{}{"command": "echo tui-dialog"}),
+		igenttest.Text("Done."),
+	)
+	dialogs := 0
+	turn(t, m, "run it", func() {
+		dialogs++
+		if view := m.View(); !strings.Contains(view, "echo tui-dialog") || !strings.Contains(view, "[a] allow for the session") {
+			t.Errorf("expected the dialog in the view:\n%s", view)
+		}
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")}) // Not an answer
+		if m.dialog == nil {
+			t.Fatal("expected the dialog to stay open")
+		}
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+		if m.dialog != nil {
+			t.Error("expected the dialog closed")
+		}
+	})
+	if dialogs != 1 {
+		t.Errorf("expected one dialog, got %d", dialogs)
+	}
+	result := h.AssertToolCalled("shell")
+	if !strings.Contains(result.Content, "tui-dialog") {
+		t.Errorf("expected the command run, got %q", result.Content)
+	}
+}
+
+func TestSidebar(t *testing.T) {
+	m, h := newModel(t)
+	if err := h.Agent.SetConversation("other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Agent.SetConversation(igenttest.ConversationID); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	if m.focus != focusSidebar || len(m.conversations) != 2 {
+		t.Fatalf("expected the sidebar focused with 2 conversations, got %v %d", m.focus, len(m.conversations))
+	}
+	for i, info := range m.conversations {
+		if info.ID == "other" {
+			m.selected = i
+		}
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if got := h.Agent.ConversationID(); got != "other" {
+		t.Errorf("expected to switch to other, got %s", got)
+	}
+	if m.focus != focusInput {
+		t.Error("expected the input focused after switching")
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlN})
+	if got := h.Agent.ConversationID(); !strings.HasPrefix(got, "tui-") {
+		t.Errorf("expected a new conversation, got %s", got)
+	}
+}
@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/igm/igent/internal/tools"
+)
+
+// Styles
+var (
+	headerStyle      = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	userStyle        = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("10"))
+	assistantStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	dimStyle         = lipgloss.NewStyle().Faint(true)
+	toolRunningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	toolDoneStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	toolFailedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	dialogStyle      = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("11")).Padding(0, 1)
+	sidebarStyle     = lipgloss.NewStyle().Width(sidebarWidth).Border(lipgloss.NormalBorder(), false, true, false, false).PaddingRight(1)
+	selectedStyle    = lipgloss.NewStyle().Reverse(true)
+	currentStyle     = lipgloss.NewStyle().Bold(true)
+)
+
+// View implements tea.Model
+func (m *Model) View() string {
+	if m.width == 0 {
+		return "Starting…"
+	}
+	main := lipgloss.JoinVertical(lipgloss.Left,
+		m.renderHeader(),
+		m.viewport.View(),
+		m.renderStatus(),
+		m.input.View(),
+		m.renderHelp(),
+	)
+	return lipgloss.JoinHorizontal(lipgloss.Top, m.renderSidebar(), main)
+}
+
+func (m *Model) renderHeader() string {
+	header := m.agent.ConversationID()
+	for _, info := range m.conversations {
+		if info.ID == header && info.Title != "" {
+			header += " · " + info.Title
+		}
+	}
+	if persona := m.agent.Persona(); persona != "" {
+		header += " · persona " + persona
+	}
+	return headerStyle.Render(truncate(header, m.mainWidth()))
+}
+
+// renderStatus shows what the running turn does, else the last status
+func (m *Model) renderStatus() string {
+	width := m.mainWidth()
+	switch {
+	case m.dialog != nil:
+		return toolRunningStyle.Render(truncate("Waiting for your answer", width))
+	case m.running:
+		activity := "Thinking…"
+		for _, t := range m.tools {
+			if t.result == nil {
+				activity = "Running " + t.call.Name + "…"
+			}
+		}
+		return m.spinner.View() + " " + truncate(activity, width-2)
+	}
+	return dimStyle.Render(truncate(m.status, width))
+}
+
+func (m *Model) renderHelp() string {
+	help := "Enter send · Alt+Enter new line · Tab conversations · Ctrl+N new · PgUp/PgDn scroll · Ctrl+C cancel/quit"
+	switch {
+	case m.dialog != nil && m.dialog.always:
+		help = "y allow · a allow for the session · n deny"
+	case m.dialog != nil:
+		help = "y yes · n no"
+	case m.focus == focusSidebar:
+		help = "↑/↓ select · Enter open · n new · Tab back"
+	}
+	return dimStyle.Render(truncate(help, m.mainWidth()))
+}
+
+// renderSidebar lists the conversations, most recently updated first
+func (m *Model) renderSidebar() string {
+	height := max(m.height, 1)
+	lines := []string{headerStyle.Render("Conversations")}
+
+	// Keep the selection in view
+	rows := height - 1
+	first := 0
+	if m.selected >= rows {
+		first = m.selected - rows + 1
+	}
+	for i := first; i < len(m.conversations) && len(lines) < height; i++ {
+		info := m.conversations[i]
+		label := info.Title
+		if label == "" {
+			label = info.ID
+		}
+		if info.ID == m.agent.ConversationID() {
+			label = currentStyle.Render("▸ " + truncate(label, sidebarWidth-3))
+		} else {
+			label = "  " + truncate(label, sidebarWidth-3)
+		}
+		if i == m.selected && m.focus == focusSidebar {
+			label = selectedStyle.Render(label)
+		}
+		lines = append(lines, label)
+	}
+	return sidebarStyle.Height(height).MaxHeight(height).Render(strings.Join(lines, "\n"))
+}
+
+// renderConversation renders the messages of the conversation and of the
+// running turn, with its tool calls and confirmation dialog
+func (m *Model) renderConversation(width int) string {
+	if width <= 0 {
+		return ""
+	}
+	wrap := lipgloss.NewStyle().Width(width)
+
+	var sb strings.Builder
+	message := func(role, content string) {
+		label := userStyle.Render("You")
+		if role == "assistant" {
+			label = assistantStyle.Render(m.opts.Name)
+		}
+		sb.WriteString(label + "\n" + wrap.Render(strings.TrimSpace(content)) + "\n\n")
+	}
+	for _, msg := range m.messages {
+		message(msg.Role, msg.Content)
+	}
+
+	if m.prompt == "" {
+		return strings.TrimRight(sb.String(), "\n")
+	}
+	message("user", m.prompt)
+	for _, t := range m.tools {
+		sb.WriteString(wrap.Render(m.renderTool(t)) + "\n")
+	}
+	if len(m.tools) > 0 {
+		sb.WriteString("\n")
+	}
+	if m.answer.Len() > 0 {
+		message("assistant", m.answer.String())
+	}
+	if m.dialog != nil {
+		sb.WriteString(m.renderDialog(width) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// renderTool is the status line of a tool call
+func (m *Model) renderTool(t *toolStatus) string {
+	switch {
+	case t.result == nil:
+		return toolRunningStyle.Render(m.spinner.View()+" "+t.call.Name) + " " + dimStyle.Render(toolSummary(t.call))
+	case t.result.Error != "":
+		return toolFailedStyle.Render("✗ "+t.call.Name) + " " + dimStyle.Render(t.result.Error)
+	}
+	return toolDoneStyle.Render("✓ "+t.call.Name) + " " + dimStyle.Render(toolSummary(t.call))
+}
+
+// renderDialog is the confirmation dialog, inline after the running turn
+func (m *Model) renderDialog(width int) string {
+	answers := "[y] yes  [n] no"
+	if m.dialog.always {
+		answers = "[y] allow  [a] allow for the session  [n] deny"
+	}
+	box := dialogStyle.Width(max(width-2, 10))
+	return box.Render(m.dialog.text + "\n\n" + toolRunningStyle.Render(answers))
+}
+
+// toolSummary is the most telling argument of a tool call, on one line
+func toolSummary(call *tools.ToolCall) string {
+	for _, key := range []string{"command", "path", "url", "query"} {
+		if v, ok := call.Args[key].(string); ok {
+			return truncate(strings.Join(strings.Fields(v), " "), 60)
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to width cells, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
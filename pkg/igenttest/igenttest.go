@@ -0,0 +1,347 @@
+// Package igenttest runs the agent end to end against a scripted fake
+// provider in a temporary work directory, so integration tests of agent
+// behavior need no real API.
+//
+//	h := igenttest.New(t,
+//		igenttest.Call("cat", map[string]interface{}{"path": path}),
+//		igenttest.Text("The file says hello."),
+//	)
+//	h.Chat("What does the file say?")
+//	h.AssertToolCalled("cat")
+//	h.AssertLastReply("The file says hello.")
+//
+// The agent and config types live in internal packages; Agent and Config
+// name them for tests outside the igent module.
+package igenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/igm/igent/internal/agent"
+	"github.com/igm/igent/internal/config"
+	"github.com/igm/igent/internal/llm"
+	"github.com/igm/igent/internal/storage"
+)
+
+// Agent is the agent a harness runs
+type Agent = agent.Agent
+
+// Config is the configuration of a harness's agent, as NewWithConfig lets
+// tests adjust it
+type Config = config.Config
+
+// ConversationID is the conversation a harness chats in
+const ConversationID = "test"
+
+// ErrScriptExhausted is returned when the agent calls the provider after
+// the last scripted reply
+var ErrScriptExhausted = errors.New("igenttest: no scripted reply left")
+
+// Reply is one scripted provider response
+type Reply struct {
+	Content   string
+	ToolCalls []ToolCall
+	Err       error // Returned instead of a response
+}
+
+// ToolCall is a tool call requested by a scripted reply
+type ToolCall struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// Text returns a reply that answers with content
+func Text(content string) Reply {
+	return Reply{Content: content}
+}
+
+// Call returns a reply that calls one tool
+func Call(name string, args map[string]interface{}) Reply {
+	return Reply{ToolCalls: []ToolCall{{Name: name, Args: args}}}
+}
+
+// Fail returns a reply that fails with err
+func Fail(err error) Reply {
+	return Reply{Err: err}
+}
+
+// Message is a message the agent sent to the provider or stored
+type Message struct {
+	Role       string // system, user, assistant, tool
+	Content    string
+	Name       string // Tool name of tool results
+	ToolCallID string // Tool call a tool result answers
+}
+
+// Request is one provider call made by the agent
+type Request struct {
+	Messages []Message
+}
+
+// Provider is a fake LLM provider that answers with scripted replies in
+// order and records the requests it receives. It is safe for concurrent use.
+type Provider struct {
+	mu       sync.Mutex
+	replies  []Reply
+	requests []Request
+	calls    int // Tool calls issued, for IDs
+}
+
+// NewProvider returns a provider scripted with replies
+func NewProvider(replies ...Reply) *Provider {
+	return &Provider{replies: replies}
+}
+
+// Add appends replies to the script
+func (p *Provider) Add(replies ...Reply) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replies = append(p.replies, replies...)
+}
+
+// Requests returns the requests received so far
+func (p *Provider) Requests() []Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Request(nil), p.requests...)
+}
+
+// Remaining returns the number of replies not used yet
+func (p *Provider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.replies)
+}
+
+// Complete implements llm.Provider
+func (p *Provider) Complete(ctx context.Context, messages []llm.Message) (*llm.Response, error) {
+	return p.CompleteWithOptions(ctx, messages, nil)
+}
+
+// CompleteWithOptions implements llm.Provider
+func (p *Provider) CompleteWithOptions(ctx context.Context, messages []llm.Message, opts *llm.CompleteOptions) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req := Request{Messages: make([]Message, len(messages))}
+	for i, m := range messages {
+		req.Messages[i] = Message{Role: m.Role, Content: m.Content, Name: m.Name, ToolCallID: m.ToolCallID}
+	}
+	p.requests = append(p.requests, req)
+
+	if len(p.replies) == 0 {
+		return nil, ErrScriptExhausted
+	}
+	reply := p.replies[0]
+	p.replies = p.replies[1:]
+	if reply.Err != nil {
+		return nil, reply.Err
+	}
+
+	resp := &llm.Response{Content: reply.Content, FinishReason: llm.FinishReasonStop}
+	for _, tc := range reply.ToolCalls {
+		args, err := json.Marshal(tc.Args)
+		if err != nil {
+			return nil, fmt.Errorf("igenttest: marshaling %s arguments: %w", tc.Name, err)
+		}
+		p.calls++
+		resp.ToolCalls = append(resp.ToolCalls, llm.ToolCall{
+			ID:       fmt.Sprintf("call_%d", p.calls),
+			Type:     "function",
+			Function: &llm.ToolCallFunction{Name: tc.Name, Arguments: string(args)},
+		})
+	}
+	if len(resp.ToolCalls) > 0 {
+		resp.FinishReason = llm.FinishReasonToolCalls
+	}
+	return resp, nil
+}
+
+// Stream implements llm.Provider
+func (p *Provider) Stream(ctx context.Context, messages []llm.Message, onChunk func(string)) error {
+	resp, err := p.Complete(ctx, messages)
+	if err != nil {
+		return err
+	}
+	onChunk(resp.Content)
+	return nil
+}
+
+// CountTokens implements llm.Provider with a rough 4 bytes per token
+func (p *Provider) CountTokens(messages []llm.Message) int {
+	n := 0
+	for _, m := range messages {
+		n += len(m.Content)/4 + 4
+	}
+	return n
+}
+
+// Harness is an agent wired to a scripted provider, storing its data in a
+// temporary work directory
+type Harness struct {
+	Agent    *Agent
+	Provider *Provider
+	Config   *Config
+
+	// WorkDir holds the agent's storage (conversations, memory, skills)
+	WorkDir string
+
+	// Workspace is an empty directory for files the tools work on
+	Workspace string
+
+	t testing.TB
+}
+
+// New returns a harness whose provider answers with replies
+func New(t testing.TB, replies ...Reply) *Harness {
+	return NewWithConfig(t, nil, replies...)
+}
+
+// NewWithConfig is like New, letting configure adjust the default config
+// before the agent is created
+func NewWithConfig(t testing.TB, configure func(*Config), replies ...Reply) *Harness {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Provider.APIKey = "igenttest"
+	cfg.Storage.WorkDir = t.TempDir()
+	cfg.Storage.AutoArtifacts = false
+	cfg.Agent.ProjectNamespace = false
+	cfg.Agent.AutoTitle = false // Keep the script for the conversation itself
+	cfg.Logging.Level = "error"
+	if configure != nil {
+		configure(cfg)
+	}
+
+	provider := NewProvider(replies...)
+	ag, err := agent.NewWithProvider(cfg, provider)
+	if err != nil {
+		t.Fatalf("igenttest: creating agent: %v", err)
+	}
+	if err := ag.SetConversation(ConversationID); err != nil {
+		t.Fatalf("igenttest: setting conversation: %v", err)
+	}
+
+	return &Harness{
+		Agent:     ag,
+		Provider:  provider,
+		Config:    cfg,
+		WorkDir:   cfg.Storage.WorkDir,
+		Workspace: t.TempDir(),
+		t:         t,
+	}
+}
+
+// Chat sends a prompt and returns the final answer, failing the test on error
+func (h *Harness) Chat(prompt string) string {
+	h.t.Helper()
+	result, err := h.Agent.Chat(context.Background(), prompt)
+	if err != nil {
+		h.t.Fatalf("igenttest: chat %q: %v", prompt, err)
+	}
+	return result.Content
+}
+
+// WriteFile creates a file in the workspace and returns its absolute path
+func (h *Harness) WriteFile(name, content string) string {
+	h.t.Helper()
+	path := h.Path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		h.t.Fatalf("igenttest: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		h.t.Fatalf("igenttest: %v", err)
+	}
+	return path
+}
+
+// Path returns the absolute path of a workspace file
+func (h *Harness) Path(name string) string {
+	return filepath.Join(h.Workspace, filepath.FromSlash(name))
+}
+
+// ToolResults returns the tool results the agent sent to the provider, in
+// the order the tools were called
+func (h *Harness) ToolResults() []Message {
+	seen := make(map[string]bool)
+	var results []Message
+	for _, req := range h.Provider.Requests() {
+		for _, m := range req.Messages {
+			if m.Role == "tool" && !seen[m.ToolCallID] {
+				seen[m.ToolCallID] = true
+				results = append(results, m)
+			}
+		}
+	}
+	return results
+}
+
+// AssertToolCalled fails the test unless the tool ran, and returns its
+// first result
+func (h *Harness) AssertToolCalled(name string) Message {
+	h.t.Helper()
+	var called []string
+	for _, m := range h.ToolResults() {
+		if m.Name == name {
+			return m
+		}
+		called = append(called, m.Name)
+	}
+	h.t.Fatalf("igenttest: tool %s was not called; called: %v", name, called)
+	return Message{}
+}
+
+// AssertNoToolCalls fails the test if any tool ran
+func (h *Harness) AssertNoToolCalls() {
+	h.t.Helper()
+	if results := h.ToolResults(); len(results) > 0 {
+		h.t.Fatalf("igenttest: expected no tool calls, got %d (first: %s)", len(results), results[0].Name)
+	}
+}
+
+// AssertScriptDone fails the test if scripted replies were not used
+func (h *Harness) AssertScriptDone() {
+	h.t.Helper()
+	if n := h.Provider.Remaining(); n > 0 {
+		h.t.Fatalf("igenttest: %d scripted replies not used", n)
+	}
+}
+
+// Conversation returns the stored messages of a conversation
+func (h *Harness) Conversation(id string) []Message {
+	h.t.Helper()
+	store, err := storage.NewJSONStore(h.WorkDir)
+	if err != nil {
+		h.t.Fatalf("igenttest: opening storage: %v", err)
+	}
+	conv, err := store.LoadConversation(id)
+	if err != nil {
+		h.t.Fatalf("igenttest: loading conversation %s: %v", id, err)
+	}
+	messages := make([]Message, len(conv.Messages))
+	for i, m := range conv.Messages {
+		messages[i] = Message{Role: m.Role, Content: m.Content, Name: m.Name, ToolCallID: m.ToolCallID}
+	}
+	return messages
+}
+
+// AssertLastReply fails the test unless the last stored message of the
+// harness conversation is an assistant answer equal to want
+func (h *Harness) AssertLastReply(want string) {
+	h.t.Helper()
+	messages := h.Conversation(ConversationID)
+	if len(messages) == 0 {
+		h.t.Fatalf("igenttest: conversation %s is empty", ConversationID)
+	}
+	last := messages[len(messages)-1]
+	if last.Role != "assistant" || last.Content != want {
+		h.t.Fatalf("igenttest: last message is %s %q, want assistant %q", last.Role, last.Content, want)
+	}
+}
@@ -0,0 +1,54 @@
+package igenttest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestHarness(t *testing.T) {
+	h := New(t)
+	path := h.WriteFile("notes/hello.txt", "hello from the workspace")
+	h.Provider.Add(
+		Call("cat", map[string]interface{}{"path": path}),
+		Text("The file says hello."),
+	)
+
+	if got := h.Chat("What does the file say?"); got != "The file says hello." {
+		t.Errorf("Chat = %q", got)
+	}
+	result := h.AssertToolCalled("cat")
+	if !strings.Contains(result.Content, "hello from the workspace") {
+		t.Errorf("cat result = %q", result.Content)
+	}
+	h.AssertLastReply("The file says hello.")
+	h.AssertScriptDone()
+
+	reqs := h.Provider.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	first := reqs[0].Messages
+	if first[0].Role != "system" || first[len(first)-1].Content != "What does the file say?" {
+		t.Errorf("unexpected first request: %+v", first)
+	}
+
+	conv := h.Conversation(ConversationID)
+	if len(conv) != 4 || conv[0].Role != "user" || conv[0].Content != "What does the file say?" ||
+		conv[2].Role != "tool" || conv[2].Content != "hello from the workspace" {
+		t.Errorf("stored conversation = %+v", conv)
+	}
+}
+
+func TestHarnessErrors(t *testing.T) {
+	boom := errors.New("boom")
+	h := New(t, Fail(boom))
+	if _, err := h.Agent.Chat(context.Background(), "hi"); !errors.Is(err, boom) {
+		t.Errorf("expected scripted error, got %v", err)
+	}
+	if _, err := h.Agent.Chat(context.Background(), "hi"); !errors.Is(err, ErrScriptExhausted) {
+		t.Errorf("expected ErrScriptExhausted, got %v", err)
+	}
+	h.AssertNoToolCalls()
+}